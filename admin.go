@@ -0,0 +1,135 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/namsral/flag"
+)
+
+// openDBFlags adds the flags to open the database with to fs and returns a
+// function that opens it (as db)
+func openDBFlags(fs *flag.FlagSet) func() error {
+	var dbpath, encryptionKeyFile string
+
+	fs.StringVar(&dbpath, "dbpath", "search.db", "database path or uri")
+	fs.StringVar(&encryptionKeyFile, "encryption-key-file", "",
+		"file containing the key the database is encrypted with")
+
+	return func() (err error) {
+		db, err = OpenDB(dbpath, encryptionKeyFile)
+		return
+	}
+}
+
+// AddBookmark validates and saves a bookmark. Existing bookmarks are only
+// updated if replace is true.
+func AddBookmark(name, url string, replace bool) error {
+	name = strings.ToLower(strings.Trim(name, "/"))
+	if err := ValidateBookmark(name, url); err != nil {
+		return err
+	}
+
+	old, err := bookmarkURL(name)
+	if err != nil {
+		return err
+	}
+	if old != "" && !replace {
+		return fmt.Errorf("bookmark %s already exists (use -replace to update it)", name)
+	}
+	return SaveBookmark(name, url)
+}
+
+// RemoveBookmarks deletes the named bookmarks, failing on the first one
+// that doesn't exist
+func RemoveBookmarks(names []string) error {
+	for _, name := range names {
+		name = strings.ToLower(strings.Trim(name, "/"))
+		old, err := bookmarkURL(name)
+		if err != nil {
+			return err
+		}
+		if old == "" {
+			return fmt.Errorf("no bookmark named %s", name)
+		}
+		if err := DeleteBookmark(name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// WriteBookmarks writes the name and url of every bookmark as a table
+func WriteBookmarks(w io.Writer) error {
+	bookmarks, err := ListBookmarks()
+	if err != nil {
+		return err
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	for _, bookmark := range bookmarks {
+		fmt.Fprintf(tw, "%s\t%s\n", bookmark.Name(), bookmark.URL())
+	}
+	return tw.Flush()
+}
+
+func runAdd(args []string) error {
+	var replace bool
+
+	fs := flag.NewFlagSet("add", flag.ExitOnError)
+	open := openDBFlags(fs)
+	fs.BoolVar(&replace, "replace", false, "update the bookmark if it already exists")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 2 {
+		return errors.New("usage: golinks add [options] <name> <url>")
+	}
+
+	if err := open(); err != nil {
+		return err
+	}
+	defer db.Close()
+
+	return AddBookmark(fs.Arg(0), fs.Arg(1), replace)
+}
+
+func runRm(args []string) error {
+	fs := flag.NewFlagSet("rm", flag.ExitOnError)
+	open := openDBFlags(fs)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() == 0 {
+		return errors.New("usage: golinks rm [options] <name>...")
+	}
+
+	if err := open(); err != nil {
+		return err
+	}
+	defer db.Close()
+
+	return RemoveBookmarks(fs.Args())
+}
+
+func runList(args []string) error {
+	fs := flag.NewFlagSet("list", flag.ExitOnError)
+	open := openDBFlags(fs)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 0 {
+		return errors.New("usage: golinks list [options]")
+	}
+
+	if err := open(); err != nil {
+		return err
+	}
+	defer db.Close()
+
+	return WriteBookmarks(os.Stdout)
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAddRemoveBookmarks(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir("", "golinks")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	db, err = OpenStore(filepath.Join(dir, "test.db"))
+	assert.NoError(err)
+	defer db.Close()
+
+	assert.NoError(AddBookmark("GH", "https://github.com/%s", false))
+	assert.NoError(AddBookmark("wiki", "https://en.wikipedia.org/wiki/%s", false))
+	assert.EqualError(
+		AddBookmark("gh", "https://gitlab.com/%s", false),
+		"bookmark gh already exists (use -replace to update it)",
+	)
+	assert.NoError(AddBookmark("gh", "https://gitlab.com/%s", true))
+	assert.Error(AddBookmark("add", "https://example.com", false))
+
+	var buf bytes.Buffer
+	assert.NoError(WriteBookmarks(&buf))
+	assert.Equal("gh    https://gitlab.com/%s\nwiki  https://en.wikipedia.org/wiki/%s\n", buf.String())
+
+	assert.NoError(RemoveBookmarks([]string{"wiki"}))
+	assert.EqualError(RemoveBookmarks([]string{"wiki"}), "no bookmark named wiki")
+	_, ok := LookupBookmark("wiki")
+	assert.False(ok)
+}
+
+func TestSubcommands(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir("", "golinks")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	dbpath := filepath.Join(dir, "test.db")
+	for _, name := range []string{"serve", "add", "rm", "list", "dump", "migrate", "help"} {
+		assert.NotNil(subcommand(name), name)
+	}
+	assert.Nil(subcommand("nope"))
+
+	assert.NoError(subcommand("add")([]string{"-dbpath", dbpath, "gh", "https://github.com/%s"}))
+	assert.Error(subcommand("add")([]string{"-dbpath", dbpath, "gh"}))
+	assert.NoError(subcommand("rm")([]string{"-dbpath", dbpath, "gh"}))
+	assert.Error(subcommand("rm")([]string{"-dbpath", dbpath, "gh"}))
+	assert.NoError(subcommand("list")([]string{"-dbpath", dbpath}))
+}
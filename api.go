@@ -0,0 +1,61 @@
+package main
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+)
+
+// API error codes clients can branch on
+const (
+	ErrCodeBadRequest   = "bad_request"
+	ErrCodeUnauthorized = "unauthorized"
+	ErrCodeForbidden    = "forbidden"
+	ErrCodeNotFound     = "not_found"
+	ErrCodeConflict     = "conflict"
+	ErrCodeUpstream     = "upstream_error"
+	ErrCodeInternal     = "internal_error"
+	ErrCodeUnavailable  = "unavailable"
+
+	ErrCodePreconditionFailed = "precondition_failed"
+)
+
+// APIError is the error model returned by all API endpoints
+type APIError struct {
+	Code      string      `json:"code"`
+	Message   string      `json:"message"`
+	Details   interface{} `json:"details,omitempty"`
+	RequestID string      `json:"request_id,omitempty"`
+}
+
+// APIErrorResponse is the JSON envelope an APIError is returned in
+type APIErrorResponse struct {
+	Error APIError `json:"error"`
+}
+
+// WriteJSON writes v as JSON with the given status code
+func WriteJSON(w http.ResponseWriter, status int, v interface{}) {
+	bs, err := json.Marshal(v)
+	if err != nil {
+		slog.Error("error encoding json response", "err", err)
+		status = http.StatusInternalServerError
+		bs = []byte(`{"error":{"code":"internal_error","message":"error encoding response"}}`)
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	w.Write(bs)
+}
+
+// WriteAPIError writes a JSON error envelope with the given status code,
+// error code, message and optional details.
+func WriteAPIError(w http.ResponseWriter, r *http.Request, status int, code, message string, details interface{}) {
+	WriteJSON(w, status, APIErrorResponse{
+		Error: APIError{
+			Code:      code,
+			Message:   message,
+			Details:   details,
+			RequestID: RequestID(r),
+		},
+	})
+}
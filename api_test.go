@@ -0,0 +1,154 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWriteAPIError(t *testing.T) {
+	assert := assert.New(t)
+
+	var res APIErrorResponse
+
+	h := RequestIDs(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		WriteAPIError(w, r, http.StatusNotFound, ErrCodeNotFound, "no such thing", "foo")
+	}))
+
+	w := httptest.NewRecorder()
+	r, _ := http.NewRequest("GET", "/", nil)
+	r.Header.Set(RequestIDHeader, "abc-123")
+	h.ServeHTTP(w, r)
+
+	assert.Equal(http.StatusNotFound, w.Code)
+	assert.Equal("application/json; charset=utf-8", w.Header().Get("Content-Type"))
+	assert.Equal("abc-123", w.Header().Get(RequestIDHeader))
+
+	assert.NoError(json.Unmarshal(w.Body.Bytes(), &res))
+	assert.Equal(ErrCodeNotFound, res.Error.Code)
+	assert.Equal("no such thing", res.Error.Message)
+	assert.Equal("foo", res.Error.Details)
+	assert.Equal("abc-123", res.Error.RequestID)
+}
+
+func TestRequestIDGenerated(t *testing.T) {
+	assert := assert.New(t)
+
+	var id string
+	h := RequestIDs(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id = RequestID(r)
+	}))
+
+	w := httptest.NewRecorder()
+	r, _ := http.NewRequest("GET", "/", nil)
+	r.Header.Set(RequestIDHeader, "<script>")
+	h.ServeHTTP(w, r)
+
+	assert.NotEmpty(id)
+	assert.NotEqual("<script>", id)
+	assert.Equal(id, w.Header().Get(RequestIDHeader))
+}
+
+func TestSuggestionsUpstreamError(t *testing.T) {
+	assert := assert.New(t)
+
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "oops", http.StatusServiceUnavailable)
+	}))
+	defer upstream.Close()
+
+	s, err := NewServer(":8000", Config{SuggestURL: upstream.URL + "/?q=%s"})
+	assert.NoError(err)
+
+	w := httptest.NewRecorder()
+	r, _ := http.NewRequest("GET", "/suggest?q=foo", nil)
+
+	s.SuggestionsHandler()(w, r, httprouter.Params{})
+	assert.Equal(http.StatusBadGateway, w.Code)
+
+	var res APIErrorResponse
+	assert.NoError(json.Unmarshal(w.Body.Bytes(), &res))
+	assert.Equal(ErrCodeUpstream, res.Error.Code)
+}
+
+func TestWriteSuggestionsError(t *testing.T) {
+	assert := assert.New(t)
+
+	write := func(err error) (res APIErrorResponse) {
+		w := httptest.NewRecorder()
+		writeSuggestionsError(w, httptest.NewRequest("GET", "/suggest?q=foo", nil), err)
+		assert.Equal(http.StatusBadGateway, w.Code)
+		assert.NoError(json.Unmarshal(w.Body.Bytes(), &res))
+		assert.Equal(ErrCodeUpstream, res.Error.Code)
+		return
+	}
+
+	// Wrapped upstream errors are unwrapped, any other error is generic
+	res := write(fmt.Errorf("error: %w", &UpstreamError{Message: "suggestions response too large"}))
+	assert.Equal("suggestions response too large", res.Error.Message)
+	res = write(errors.New("secret internal details"))
+	assert.Equal("error retrieving suggestions", res.Error.Message)
+}
+
+func TestSuggestionsTooLarge(t *testing.T) {
+	assert := assert.New(t)
+
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`["foo",["foo bar","foo baz","foo qux"]]`))
+	}))
+	defer upstream.Close()
+
+	s, err := NewServer(":8000", Config{SuggestURL: upstream.URL + "/?q=%s", SuggestMaxBytes: 16})
+	assert.NoError(err)
+
+	w := httptest.NewRecorder()
+	r, _ := http.NewRequest("GET", "/suggest?q=foo", nil)
+
+	s.SuggestionsHandler()(w, r, httprouter.Params{})
+	assert.Equal(http.StatusBadGateway, w.Code)
+	assert.Contains(w.Body.String(), "too large")
+}
+
+func TestSuggestionsInvalidJSON(t *testing.T) {
+	assert := assert.New(t)
+
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`<html>Not Found</html>`))
+	}))
+	defer upstream.Close()
+
+	s, err := NewServer(":8000", Config{SuggestURL: upstream.URL + "/?q=%s"})
+	assert.NoError(err)
+
+	w := httptest.NewRecorder()
+	r, _ := http.NewRequest("GET", "/suggest?q=foo", nil)
+
+	s.SuggestionsHandler()(w, r, httprouter.Params{})
+	assert.Equal(http.StatusBadGateway, w.Code)
+	assert.Contains(w.Body.String(), "not valid JSON")
+}
+
+func TestSuggestions(t *testing.T) {
+	assert := assert.New(t)
+
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`["foo",["foo bar"]]`))
+	}))
+	defer upstream.Close()
+
+	s, err := NewServer(":8000", Config{SuggestURL: upstream.URL + "/?q=%s"})
+	assert.NoError(err)
+
+	w := httptest.NewRecorder()
+	r, _ := http.NewRequest("GET", "/suggest?q=foo", nil)
+
+	s.SuggestionsHandler()(w, r, httprouter.Params{})
+	assert.Equal(http.StatusOK, w.Code)
+	assert.Equal(`["foo",["foo bar"]]`, w.Body.String())
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+// AssetsHandler serves the named static asset. Assets found in the assets
+// override directory (if configured) take precedence over built-in ones.
+func (s *Server) AssetsHandler(name string) httprouter.Handle {
+	modtime := time.Now()
+
+	return func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+		w.Header().Set("Cache-Control", "public, max-age=86400")
+
+		if s.config.AssetsDir != "" {
+			path := filepath.Join(s.config.AssetsDir, name)
+			if info, err := os.Stat(path); err == nil && info.Mode().IsRegular() {
+				http.ServeFile(w, r, path)
+				return
+			}
+		}
+
+		data, err := s.assets.Bytes(name)
+		if err != nil {
+			http.NotFound(w, r)
+			return
+		}
+
+		http.ServeContent(w, r, name, modtime, bytes.NewReader(data))
+	}
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDefaultFavicon(t *testing.T) {
+	assert := assert.New(t)
+
+	s, err := NewServer(":8000", Config{})
+	assert.NoError(err)
+
+	w := httptest.NewRecorder()
+	r, _ := http.NewRequest("GET", "/favicon.ico", nil)
+
+	s.AssetsHandler("favicon.ico")(w, r, httprouter.Params{})
+	assert.Equal(http.StatusOK, w.Code)
+	assert.NotEmpty(w.Body.Bytes())
+	assert.Contains(w.Header().Get("Cache-Control"), "max-age")
+}
+
+func TestAssetsOverride(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir("", "golinks")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	err = ioutil.WriteFile(filepath.Join(dir, "apple-touch-icon.png"), []byte("foo"), 0644)
+	assert.NoError(err)
+
+	s, err := NewServer(":8000", Config{AssetsDir: dir})
+	assert.NoError(err)
+
+	w := httptest.NewRecorder()
+	r, _ := http.NewRequest("GET", "/apple-touch-icon.png", nil)
+
+	s.AssetsHandler("apple-touch-icon.png")(w, r, httprouter.Params{})
+	assert.Equal(http.StatusOK, w.Code)
+	assert.Equal("foo", w.Body.String())
+}
+
+func TestUnknownAsset(t *testing.T) {
+	assert := assert.New(t)
+
+	s, err := NewServer(":8000", Config{})
+	assert.NoError(err)
+
+	w := httptest.NewRecorder()
+	r, _ := http.NewRequest("GET", "/foo.png", nil)
+
+	s.AssetsHandler("foo.png")(w, r, httprouter.Params{})
+	assert.Equal(http.StatusNotFound, w.Code)
+}
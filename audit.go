@@ -0,0 +1,258 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+const (
+	// DefaultAuditPageSize is the number of audit entries per page
+	DefaultAuditPageSize = 100
+
+	// MaxAuditPageSize is the maximum number of audit entries per page
+	MaxAuditPageSize = 1000
+)
+
+// Audited changes besides those of bookmarks (EventBookmarkCreated,
+// EventBookmarkUpdated and EventBookmarkDeleted)
+const (
+	AuditConfigChanged     = "config.changed"
+	AuditTokenCreated      = "token.created"
+	AuditTokenRevoked      = "token.revoked"
+	AuditTeamMemberAdded   = "team.member_added"
+	AuditTeamMemberRemoved = "team.member_removed"
+)
+
+// AuditEntry is a change made by a user (or API token): what changed
+// (the bookmark, token or team named Name) and how
+type AuditEntry struct {
+	ID     string    `json:"id"`
+	Time   time.Time `json:"time"`
+	User   string    `json:"user,omitempty"`
+	Action string    `json:"action"`
+	Name   string    `json:"name,omitempty"`
+	URL    string    `json:"url,omitempty"`
+	OldURL string    `json:"old_url,omitempty"`
+	Detail string    `json:"detail,omitempty"`
+}
+
+// AuditPage is a page of audit entries, newest first. Next is the cursor
+// for the page of older entries (empty if there are none).
+type AuditPage struct {
+	Entries []AuditEntry `json:"entries"`
+	Next    string       `json:"next,omitempty"`
+}
+
+func auditKey(id string) []byte {
+	return []byte(fmt.Sprintf("audit_%s", id))
+}
+
+// auditUser returns who made a request: the logged in user, or else the
+// API token (as token:<id>)
+func auditUser(r *http.Request) string {
+	if user := RequestUser(r); user != "" {
+		return user
+	}
+	if token, ok := RequestToken(r); ok {
+		return "token:" + token.ID
+	}
+	return ""
+}
+
+// AddAuditEntry appends an entry to the audit log. Entries are never
+// changed or deleted.
+func AddAuditEntry(entry AuditEntry) (AuditEntry, error) {
+	if entry.Time.IsZero() {
+		entry.Time = time.Now()
+	}
+	entry.ID = newHistoryID(entry.Time)
+
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return entry, err
+	}
+	return entry, db.Put(auditKey(entry.ID), data)
+}
+
+// audit records a change made by the request (see auditAs)
+func audit(r *http.Request, entry AuditEntry) {
+	auditAs(auditUser(r), entry)
+}
+
+// auditAs records a change made by user outside of a web request, e.g: a
+// chat user (as telegram:<user>), the sender of an email (as
+// email:<address>), an API token (as token:<id>) or a sync (as
+// sync:<service>). This is a best-effort write so failing to record never
+// fails the change itself.
+func auditAs(user string, entry AuditEntry) {
+	entry.User = user
+	if _, err := AddAuditEntry(entry); err != nil {
+		slog.Error("error recording audit entry", "action", entry.Action, "name", entry.Name, "err", err)
+	}
+}
+
+// auditBookmark records the change of a bookmark's url made by the request
+// (see auditBookmarkAs)
+func auditBookmark(r *http.Request, name, old, url string) {
+	auditBookmarkAs(auditUser(r), name, old, url)
+}
+
+// auditBookmarkAs records the change of a bookmark's url from old to url
+// made by user, either of which is empty if the bookmark was created or
+// deleted
+func auditBookmarkAs(user, name, old, url string) {
+	action := EventBookmarkUpdated
+	switch {
+	case old == url:
+		return
+	case old == "":
+		action = EventBookmarkCreated
+	case url == "":
+		action = EventBookmarkDeleted
+	}
+	auditAs(user, AuditEntry{Action: action, Name: name, URL: url, OldURL: old})
+}
+
+// auditSettings records a change of the runtime settings, with the
+// settings changed as its detail
+func auditSettings(r *http.Request, update SettingsUpdate) {
+	data, err := json.Marshal(update)
+	if err != nil {
+		slog.Error("error encoding settings", "err", err)
+	}
+	audit(r, AuditEntry{Action: AuditConfigChanged, Detail: string(data)})
+}
+
+// scopedURL returns the url of a bookmark named as in the add and remove
+// commands (e.g: ~gh for a personal bookmark in multi-user mode)
+func scopedURL(r *http.Request, name string) string {
+	ns := RequestNamespaces(r)
+	if _, _, ok, _ := ns.writable(name); ok {
+		bookmark, _ := ns.Lookup(name)
+		return bookmark.URL()
+	}
+	url, _ := bookmarkURL(name)
+	return url
+}
+
+// ListAudit returns up to limit audit entries older than the cursor before
+// (or the newest entries if before is empty)
+func ListAudit(before string, limit int) (page AuditPage, err error) {
+	if limit <= 0 {
+		limit = DefaultAuditPageSize
+	}
+
+	// Keys are scanned oldest first so keep a window of the newest
+	// limit+1 ids, the extra one tells whether there are older entries
+	var ids []string
+	err = db.Scan([]byte("audit_"), func(key []byte) error {
+		id := strings.TrimPrefix(string(key), "audit_")
+		if before != "" && id >= before {
+			return errStopScan
+		}
+		ids = append(ids, id)
+		if len(ids) > limit+1 {
+			ids = ids[1:]
+		}
+		return nil
+	})
+	if err != nil && err != errStopScan {
+		return
+	}
+	err = nil
+
+	if len(ids) > limit {
+		ids = ids[1:]
+		page.Next = ids[0]
+	}
+
+	for i := len(ids) - 1; i >= 0; i-- {
+		var val []byte
+		if val, err = db.Get(auditKey(ids[i])); err != nil {
+			return
+		}
+		var entry AuditEntry
+		if err = json.Unmarshal(val, &entry); err != nil {
+			return
+		}
+		entry.ID = ids[i]
+		page.Entries = append(page.Entries, entry)
+	}
+
+	return
+}
+
+// AuditHandler renders a page of the audit log, newest first, as HTML,
+// JSON or CSV (see negotiateFormat), e.g:
+// /audit?before=<cursor>&limit=100&format=json
+func (s *Server) AuditHandler() httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+		s.counters.Inc("n_audit_view")
+
+		w.Header().Set("Vary", "Accept")
+		format, err := negotiateFormat(r)
+		if err != nil {
+			http.Error(w, "Bad Request: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		limit := DefaultAuditPageSize
+		if v := r.URL.Query().Get("limit"); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n <= 0 {
+				http.Error(w, "Bad Request: invalid limit", http.StatusBadRequest)
+				return
+			}
+			limit = n
+		}
+		if limit > MaxAuditPageSize {
+			limit = MaxAuditPageSize
+		}
+
+		page, err := ListAudit(r.URL.Query().Get("before"), limit)
+		if err != nil {
+			slog.Error("error reading audit log", "err", err)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+
+		if page.Next != "" {
+			next := r.URL.Query()
+			next.Set("before", page.Next)
+			next.Set("limit", strconv.Itoa(limit))
+			w.Header().Set("Link", fmt.Sprintf(`</audit?%s>; rel="next"`, next.Encode()))
+		}
+
+		switch format {
+		case FormatJSON:
+			if page.Entries == nil {
+				page.Entries = []AuditEntry{}
+			}
+			WriteJSON(w, http.StatusOK, page)
+			return
+		case FormatCSV:
+			var rows [][]string
+			for _, entry := range page.Entries {
+				rows = append(rows, []string{
+					entry.ID, entry.Time.UTC().Format(time.RFC3339Nano), entry.User,
+					entry.Action, entry.Name, entry.URL, entry.OldURL, entry.Detail,
+				})
+			}
+			writeCSV(w, []string{"id", "time", "user", "action", "name", "url", "old_url", "detail"}, rows)
+			return
+		}
+
+		s.render("audit", w, r, map[string]interface{}{
+			"Entries": page.Entries,
+			"Next":    page.Next,
+			"Limit":   limit,
+		})
+	}
+}
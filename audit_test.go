@@ -0,0 +1,101 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAudit(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir("", "golinks")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	db, err = OpenStore(filepath.Join(dir, "test.db"))
+	assert.NoError(err)
+	defer db.Close()
+
+	s, err := NewServer(":8000", Config{AuthHeader: "X-Forwarded-User"})
+	assert.NoError(err)
+
+	token, secret, err := CreateToken("ci", []string{ScopeAdmin})
+	assert.NoError(err)
+
+	do := func(method, user, path, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r, _ := http.NewRequest(method, path, strings.NewReader(body))
+		if user != "" {
+			r.RemoteAddr = "127.0.0.1:1234"
+			r.Header.Set("X-Forwarded-User", user)
+		} else {
+			r.Header.Set("Authorization", "Bearer "+secret)
+		}
+		s.server.Handler.ServeHTTP(w, r)
+		return w
+	}
+
+	add := func(user, q string) int {
+		w := httptest.NewRecorder()
+		r := postQuery(url.Values{"q": {q}})
+		r.RemoteAddr = "127.0.0.1:1234"
+		r.Header.Set("X-Forwarded-User", user)
+		s.server.Handler.ServeHTTP(w, r)
+		return w.Code
+	}
+
+	assert.Equal(http.StatusOK, add("alice", "add g https://google.com/search?q=%s"))
+	assert.Equal(http.StatusOK, add("bob", "add g https://duckduckgo.com/?q=%s"))
+	assert.Equal(http.StatusNoContent, do("DELETE", "", "/api/v1/bookmarks/g", "").Code)
+	assert.Equal(http.StatusOK, do("PATCH", "", "/api/v1/admin/config", `{"title": "Links"}`).Code)
+
+	// Failed changes aren't recorded
+	assert.Equal(http.StatusNotFound, do("DELETE", "", "/api/v1/bookmarks/g", "").Code)
+
+	w := do("GET", "alice", "/audit?format=json", "")
+	assert.Equal(http.StatusOK, w.Code)
+	var page AuditPage
+	assert.NoError(json.Unmarshal(w.Body.Bytes(), &page))
+	assert.Len(page.Entries, 4)
+
+	// Newest first
+	assert.Equal(AuditConfigChanged, page.Entries[0].Action)
+	assert.Equal("token:"+token.ID, page.Entries[0].User)
+	assert.Equal(`{"title":"Links"}`, page.Entries[0].Detail)
+
+	assert.Equal(EventBookmarkDeleted, page.Entries[1].Action)
+	assert.Equal("https://duckduckgo.com/?q=%s", page.Entries[1].OldURL)
+
+	assert.Equal(EventBookmarkUpdated, page.Entries[2].Action)
+	assert.Equal("bob", page.Entries[2].User)
+	assert.Equal("g", page.Entries[2].Name)
+	assert.Equal("https://duckduckgo.com/?q=%s", page.Entries[2].URL)
+	assert.Equal("https://google.com/search?q=%s", page.Entries[2].OldURL)
+
+	assert.Equal(EventBookmarkCreated, page.Entries[3].Action)
+	assert.Equal("alice", page.Entries[3].User)
+
+	// Pages link to the older entries
+	w = do("GET", "alice", "/audit?format=json&limit=3", "")
+	assert.NoError(json.Unmarshal(w.Body.Bytes(), &page))
+	assert.Len(page.Entries, 3)
+	assert.Contains(w.Header().Get("Link"), "before="+page.Next)
+	w = do("GET", "alice", "/audit?format=json&before="+page.Next, "")
+	assert.NoError(json.Unmarshal(w.Body.Bytes(), &page))
+	assert.Len(page.Entries, 1)
+	assert.Equal(EventBookmarkCreated, page.Entries[0].Action)
+
+	w = do("GET", "alice", "/audit", "")
+	assert.Equal(http.StatusOK, w.Code)
+	assert.Contains(w.Body.String(), "bookmark.updated")
+	assert.Contains(w.Body.String(), "https://duckduckgo.com/?q=%s")
+}
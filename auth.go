@@ -0,0 +1,279 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/julienschmidt/httprouter"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// AuthExemptPaths are served without authentication: the instance id the
+// FQDN check fetches (which is random and reveals nothing), inbound
+// emails (which are signed with the email secret) and the public bookmarks
+// (which are published anyway)
+var AuthExemptPaths = []string{
+	"/debug/instance",
+	"/inbound/email",
+	PublicBookmarksPath,
+}
+
+// LoginPaths are the pages users log in and out with, served without
+// logging in first. Only these exact paths are: other paths (even under
+// /auth/) are queries, e.g: /auth/foo runs the auth bookmark.
+var LoginPaths = []string{
+	"/auth/login",
+	"/auth/logout",
+	OIDCCallbackPath,
+	GitHubCallbackPath,
+}
+
+// loginPage reports whether the request is for one of the LoginPaths
+func loginPage(r *http.Request) bool {
+	for _, path := range LoginPaths {
+		if r.URL.Path == path {
+			return true
+		}
+	}
+	return false
+}
+
+// userKey is the request context key of the user making the request
+const userKey contextKey = "user"
+
+// RequestUser returns the user making the request (if known), as logged in
+// with Basic auth, OpenID Connect, GitHub or a trusted proxy
+func RequestUser(r *http.Request) string {
+	if r == nil {
+		return ""
+	}
+	if user, ok := r.Context().Value(userKey).(string); ok {
+		return user
+	}
+	return ""
+}
+
+// withUser returns the request made by user
+func withUser(r *http.Request, user string) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), userKey, user))
+}
+
+// Credentials are the users allowed to access golinks and their password
+// hashes, from -auth-user/-auth-pass or an htpasswd file
+type Credentials struct {
+	sync.RWMutex
+
+	users map[string]string
+
+	// verified caches the hashes of verified passwords, as bcrypt is
+	// (deliberately) too slow to check on every request
+	verified map[[sha256.Size]byte]bool
+}
+
+// NewCredentials returns the credentials of a single user with a plain
+// text password
+func NewCredentials(user, pass string) *Credentials {
+	return &Credentials{
+		users:    map[string]string{user: "{PLAIN}" + pass},
+		verified: make(map[[sha256.Size]byte]bool),
+	}
+}
+
+// LoadHtpasswd loads the credentials of an htpasswd file with bcrypt
+// (htpasswd -B) or SHA-1 (htpasswd -s) passwords
+func LoadHtpasswd(path string) (*Credentials, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	c := &Credentials{
+		users:    make(map[string]string),
+		verified: make(map[[sha256.Size]byte]bool),
+	}
+
+	n := 0
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		n++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		user, hash, ok := strings.Cut(line, ":")
+		if !ok || user == "" {
+			return nil, fmt.Errorf("%s:%d: invalid htpasswd entry (expected user:hash)", path, n)
+		}
+		if !strings.HasPrefix(hash, "$2") && !strings.HasPrefix(hash, "{SHA}") {
+			return nil, fmt.Errorf(
+				"%s:%d: unsupported password hash for %q (use htpasswd -B or -s)",
+				path, n, user,
+			)
+		}
+		c.users[user] = hash
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	if len(c.users) == 0 {
+		return nil, fmt.Errorf("%s: no users", path)
+	}
+	return c, nil
+}
+
+// loadCredentials returns the credentials of -auth-file, or else of
+// -auth-user and -auth-pass
+func loadCredentials(config Config) (*Credentials, error) {
+	if config.AuthFile != "" {
+		if config.AuthUser != "" || config.AuthPass != "" {
+			return nil, fmt.Errorf("-auth-file can't be used with -auth-user or -auth-pass")
+		}
+		return LoadHtpasswd(config.AuthFile)
+	}
+	if config.AuthUser == "" || config.AuthPass == "" {
+		return nil, fmt.Errorf("-auth-user and -auth-pass must be used together")
+	}
+	return NewCredentials(config.AuthUser, config.AuthPass), nil
+}
+
+// Verify reports whether the user exists and the password is theirs
+func (c *Credentials) Verify(user, pass string) bool {
+	hash, ok := c.users[user]
+	if !ok {
+		return false
+	}
+
+	key := sha256.Sum256([]byte(user + ":" + pass + ":" + hash))
+	c.RLock()
+	verified := c.verified[key]
+	c.RUnlock()
+	if verified {
+		return true
+	}
+
+	switch {
+	case strings.HasPrefix(hash, "{PLAIN}"):
+		ok = subtle.ConstantTimeCompare([]byte(pass), []byte(strings.TrimPrefix(hash, "{PLAIN}"))) == 1
+	case strings.HasPrefix(hash, "{SHA}"):
+		sum := sha1.Sum([]byte(pass))
+		encoded := base64.StdEncoding.EncodeToString(sum[:])
+		ok = subtle.ConstantTimeCompare([]byte(encoded), []byte(strings.TrimPrefix(hash, "{SHA}"))) == 1
+	default:
+		ok = bcrypt.CompareHashAndPassword([]byte(hash), []byte(pass)) == nil
+	}
+
+	if ok {
+		c.Lock()
+		c.verified[key] = true
+		c.Unlock()
+	}
+	return ok
+}
+
+// loginRequired reports whether users must log in to use golinks at all
+// (with Basic auth, OpenID Connect or a trusted proxy), rather than only to
+// edit bookmarks (with GitHub) or not at all
+func (s *Server) loginRequired() bool {
+	return s.creds != nil || s.oidc != nil || s.config.AuthHeader != ""
+}
+
+// authenticated reports whether a request needs no credentials: it is for
+// a path exempt from authentication or has a valid bearer token (an API
+// token or the replication secret) so API clients and replicas keep working
+func authenticated(r *http.Request, replicationSecret string) bool {
+	for _, path := range AuthExemptPaths {
+		if r.URL.Path == path {
+			return true
+		}
+	}
+
+	if secret := bearerToken(r); secret != "" {
+		if _, ok := LookupToken(secret); ok {
+			return true
+		}
+		if replicationSecret != "" &&
+			subtle.ConstantTimeCompare([]byte(secret), []byte(replicationSecret)) == 1 {
+			return true
+		}
+	}
+	return false
+}
+
+// BasicAuth only serves requests to next with the credentials of a user
+// (HTTP Basic auth) or the session of one logged in with the login page,
+// unless they need none (see authenticated). Browsers asking for pages are
+// sent to the login page and everything else is challenged with a 401.
+func BasicAuth(next http.Handler, creds *Credentials, sessions *Sessions, replicationSecret string, counters *Counters) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if authenticated(r, replicationSecret) || loginPage(r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if user, pass, ok := r.BasicAuth(); ok && creds.Verify(user, pass) {
+			next.ServeHTTP(w, withUser(r, user))
+			return
+		}
+		if session, err := sessions.Session(r); err == nil {
+			next.ServeHTTP(w, withUser(r, session.User()))
+			return
+		}
+
+		if r.Method == "GET" && r.Header.Get("Authorization") == "" &&
+			strings.Contains(r.Header.Get("Accept"), "text/html") {
+			http.Redirect(w, r, "/auth/login?next="+url.QueryEscape(r.URL.RequestURI()), http.StatusFound)
+			return
+		}
+
+		counters.Inc("n_auth_failed")
+		w.Header().Set("WWW-Authenticate", `Basic realm="golinks", charset="UTF-8"`)
+		if strings.HasPrefix(r.URL.Path, "/api/") {
+			WriteAPIError(w, r, http.StatusUnauthorized, ErrCodeUnauthorized, "authentication required", nil)
+		} else {
+			http.Error(w, "Unauthorized: authentication required", http.StatusUnauthorized)
+		}
+	})
+}
+
+// PasswordLoginHandler logs users in with the credentials of Basic auth
+// from a form, so browsers keep a session (that they can log out of)
+// rather than asking for the password, e.g: /auth/login?next=/?q=gh
+func (s *Server) PasswordLoginHandler() httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+		if r.Method == "GET" {
+			s.render("login", w, r, map[string]interface{}{
+				"Next": localPath(queryParam(r.URL.RawQuery, "next")),
+			})
+			return
+		}
+
+		user, next := r.PostFormValue("user"), localPath(r.PostFormValue("next"))
+		if !s.creds.Verify(user, r.PostFormValue("pass")) {
+			s.counters.Inc("n_auth_failed")
+			s.render("login", w, r, map[string]interface{}{
+				"Next":  next,
+				"User":  user,
+				"Error": "Invalid user or password",
+			})
+			return
+		}
+
+		s.counters.Inc("n_password_logins")
+		slog.Info("logged in with password", "user", user)
+		s.loginSession(w, r, Session{Subject: user}, next)
+	}
+}
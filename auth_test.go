@@ -0,0 +1,144 @@
+package main
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/rcrowley/go-metrics"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestLoadHtpasswd(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir("", "golinks")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	hash, err := bcrypt.GenerateFromPassword([]byte("s3cr3t"), bcrypt.MinCost)
+	assert.NoError(err)
+
+	path := filepath.Join(dir, "htpasswd")
+	assert.NoError(ioutil.WriteFile(path, []byte(
+		"# users\n"+
+			"alice:"+string(hash)+"\n"+
+			"bob:{SHA}W6ph5Mm5Pz8GgiULbPgzG37mj9g=\n",
+	), 0600))
+
+	creds, err := LoadHtpasswd(path)
+	assert.NoError(err)
+
+	assert.True(creds.Verify("alice", "s3cr3t"))
+	assert.True(creds.Verify("alice", "s3cr3t")) // cached
+	assert.False(creds.Verify("alice", "password"))
+	assert.True(creds.Verify("bob", "password"))
+	assert.False(creds.Verify("bob", "s3cr3t"))
+	assert.False(creds.Verify("eve", "s3cr3t"))
+
+	// Unsupported hashes are rejected rather than never matching
+	assert.NoError(ioutil.WriteFile(path, []byte("alice:$apr1$salt$hash\n"), 0600))
+	_, err = LoadHtpasswd(path)
+	assert.Error(err)
+
+	assert.NoError(ioutil.WriteFile(path, []byte("# no users\n"), 0600))
+	_, err = LoadHtpasswd(path)
+	assert.Error(err)
+}
+
+func TestLoadCredentials(t *testing.T) {
+	assert := assert.New(t)
+
+	creds, err := loadCredentials(Config{AuthUser: "admin", AuthPass: "s3cr3t"})
+	assert.NoError(err)
+	assert.True(creds.Verify("admin", "s3cr3t"))
+	assert.False(creds.Verify("admin", "s3cr3"))
+
+	_, err = loadCredentials(Config{AuthUser: "admin"})
+	assert.Error(err)
+
+	_, err = loadCredentials(Config{AuthUser: "admin", AuthPass: "s3cr3t", AuthFile: "htpasswd"})
+	assert.Error(err)
+}
+
+func TestBasicAuth(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir("", "golinks")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	db, err = OpenStore(filepath.Join(dir, "test.db"))
+	assert.NoError(err)
+	defer db.Close()
+
+	counters := NewCounters()
+	sessions := NewSessions("s3cr3t", time.Hour)
+	h := BasicAuth(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}),
+		NewCredentials("admin", "s3cr3t"), sessions, "replicate", counters,
+	)
+
+	do := func(path string, auth func(r *http.Request)) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r, _ := http.NewRequest("GET", path, nil)
+		if auth != nil {
+			auth(r)
+		}
+		h.ServeHTTP(w, r)
+		return w
+	}
+
+	w := do("/?q=gh", nil)
+	assert.Equal(http.StatusUnauthorized, w.Code)
+	assert.Contains(w.Header().Get("WWW-Authenticate"), "Basic")
+
+	w = do("/api/v1/bookmarks", nil)
+	assert.Equal(http.StatusUnauthorized, w.Code)
+	assert.Contains(w.Body.String(), `"code":"unauthorized"`)
+
+	assert.Equal(http.StatusUnauthorized, do("/?q=gh", func(r *http.Request) {
+		r.SetBasicAuth("admin", "password")
+	}).Code)
+	assert.Equal(http.StatusOK, do("/?q=gh", func(r *http.Request) {
+		r.SetBasicAuth("admin", "s3cr3t")
+	}).Code)
+
+	// API tokens and the replication secret are accepted, but not any
+	// bearer token
+	assert.Equal(http.StatusOK, do("/api/v1/bookmarks", func(r *http.Request) {
+		authorize(r, ScopeRead)
+	}).Code)
+	assert.Equal(http.StatusOK, do("/replication", func(r *http.Request) {
+		r.Header.Set("Authorization", "Bearer replicate")
+	}).Code)
+	assert.Equal(http.StatusUnauthorized, do("/?q=gh", func(r *http.Request) {
+		r.Header.Set("Authorization", "Bearer "+TokenPrefix+"bogus")
+	}).Code)
+
+	// The instance id is left open for the FQDN check
+	assert.Equal(http.StatusOK, do("/debug/instance", nil).Code)
+
+	// Browsers are sent to the login page, which keeps them logged in
+	w = do("/?q=gh", func(r *http.Request) {
+		r.Header.Set("Accept", "text/html,application/xhtml+xml")
+	})
+	assert.Equal(http.StatusFound, w.Code)
+	assert.Equal("/auth/login?next=%2F%3Fq%3Dgh", w.Header().Get("Location"))
+	assert.Equal(http.StatusOK, do("/auth/login", nil).Code)
+
+	login := httptest.NewRecorder()
+	assert.NoError(sessions.Login(login, httptest.NewRequest("POST", "/auth/login", nil), Session{Subject: "admin"}))
+	assert.Equal(http.StatusOK, do("/?q=gh", func(r *http.Request) {
+		r.AddCookie(login.Result().Cookies()[0])
+	}).Code)
+
+	counter, ok := counters.r.Get("n_auth_failed").(metrics.Counter)
+	assert.True(ok)
+	assert.Equal(int64(4), counter.Count())
+}
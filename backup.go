@@ -0,0 +1,253 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"log/slog"
+	"path"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	backupNamePrefix = "golinks-"
+	backupNameSuffix = ".json.gz"
+)
+
+// backupAD authenticates encrypted backups (see sealBackup)
+var backupAD = []byte("golinks backup")
+
+// NewBackuperFromConfig returns a Backuper for the configured backup url or
+// nil if backups are not configured.
+func NewBackuperFromConfig(config Config, counters *Counters) (*Backuper, error) {
+	if config.BackupURL == "" {
+		return nil, nil
+	}
+
+	endpoint, bucket, prefix, region, err := ParseS3URL(config.BackupURL)
+	if err != nil {
+		return nil, err
+	}
+
+	s3 := NewS3Client(
+		endpoint, bucket, region,
+		config.BackupAccessKey, config.BackupSecretKey,
+	)
+
+	return NewBackuper(s3, prefix, config.BackupRetain, counters), nil
+}
+
+// Backuper periodically uploads compressed snapshots of the store to S3
+// compatible object storage, keeping only the last N snapshots.
+type Backuper struct {
+	sync.RWMutex
+
+	s3       *S3Client
+	prefix   string
+	retain   int
+	counters *Counters
+
+	lastBackup string
+}
+
+// NewBackuper ...
+func NewBackuper(s3 *S3Client, prefix string, retain int, counters *Counters) *Backuper {
+	if prefix != "" && !strings.HasSuffix(prefix, "/") {
+		prefix += "/"
+	}
+
+	return &Backuper{
+		s3:       s3,
+		prefix:   prefix,
+		retain:   retain,
+		counters: counters,
+	}
+}
+
+// LastBackup returns the object key of the last successful backup
+func (b *Backuper) LastBackup() string {
+	b.RLock()
+	defer b.RUnlock()
+
+	return b.lastBackup
+}
+
+// sealBackup encrypts a compressed snapshot with the encryption key of the
+// store, if values are encrypted, so backups leave no more in plaintext than
+// the store itself
+func sealBackup(data []byte) ([]byte, error) {
+	es, ok := encryptedStore(db)
+	if !ok {
+		return data, nil
+	}
+	return es.seal(data, backupAD)
+}
+
+// openBackup decrypts a backup encrypted by sealBackup, if it is
+func openBackup(data []byte) ([]byte, error) {
+	if !bytes.HasPrefix(data, encryptedMagic) {
+		return data, nil
+	}
+	es, ok := encryptedStore(db)
+	if !ok {
+		return nil, fmt.Errorf("backup is encrypted, but the store isn't (see -encryption-key-file)")
+	}
+	return es.open(data, backupAD)
+}
+
+// Backup uploads a new snapshot of the store (encrypted with it, see
+// sealBackup) and prunes old snapshots
+func (b *Backuper) Backup() (string, error) {
+	snapshot, err := TakeSnapshot(db)
+	if err != nil {
+		b.counters.Inc("n_backup_failed")
+		return "", err
+	}
+
+	buf := &bytes.Buffer{}
+	if err := snapshot.WriteCompressed(buf); err != nil {
+		b.counters.Inc("n_backup_failed")
+		return "", err
+	}
+
+	data, err := sealBackup(buf.Bytes())
+	if err != nil {
+		b.counters.Inc("n_backup_failed")
+		return "", err
+	}
+
+	key := b.prefix + backupNamePrefix + snapshot.Created.Format(s3TimeFormat) + backupNameSuffix
+	if err := b.s3.Put(key, data); err != nil {
+		b.counters.Inc("n_backup_failed")
+		return "", err
+	}
+
+	b.Lock()
+	b.lastBackup = key
+	b.Unlock()
+
+	b.counters.Inc("n_backup")
+
+	if err := b.Prune(); err != nil {
+		slog.Error("error pruning old backups", "err", err)
+	}
+
+	return key, nil
+}
+
+// Backups returns the object keys of all backups, oldest first
+func (b *Backuper) Backups() ([]string, error) {
+	objects, err := b.s3.List(b.prefix + backupNamePrefix)
+	if err != nil {
+		return nil, err
+	}
+
+	var keys []string
+	for _, object := range objects {
+		if strings.HasSuffix(object.Key, backupNameSuffix) {
+			keys = append(keys, object.Key)
+		}
+	}
+
+	return keys, nil
+}
+
+// Prune deletes all but the last N backups
+func (b *Backuper) Prune() error {
+	if b.retain <= 0 {
+		return nil
+	}
+
+	keys, err := b.Backups()
+	if err != nil {
+		return err
+	}
+
+	if len(keys) <= b.retain {
+		return nil
+	}
+
+	for _, key := range keys[:len(keys)-b.retain] {
+		if err := b.s3.Delete(key); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Fetch retrieves a snapshot by name. The name is either "latest" or the
+// name of a backup object (with or without the configured prefix).
+func (b *Backuper) Fetch(name string) (*Snapshot, error) {
+	key := name
+	if name == "latest" {
+		keys, err := b.Backups()
+		if err != nil {
+			return nil, err
+		}
+		if len(keys) == 0 {
+			return nil, fmt.Errorf("no backups found")
+		}
+		key = keys[len(keys)-1]
+	} else if !strings.HasPrefix(key, b.prefix) {
+		key = b.prefix + path.Base(key)
+	}
+
+	data, err := b.s3.Get(key)
+	if err != nil {
+		return nil, err
+	}
+	if data, err = openBackup(data); err != nil {
+		return nil, err
+	}
+
+	return ReadCompressedSnapshot(bytes.NewReader(data))
+}
+
+// Run backs up the store every interval until ctx is cancelled
+func (b *Backuper) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		key, err := b.Backup()
+		if err != nil {
+			slog.Error("error backing up store", "err", err)
+			continue
+		}
+		slog.Info("backed up store", "key", key)
+	}
+}
+
+// RestoreFrom restores the store from a local snapshot file (if one exists
+// at the given path) or from the named backup in object storage.
+func RestoreFrom(name string, backuper *Backuper) (int, error) {
+	var (
+		snapshot *Snapshot
+		err      error
+	)
+
+	if data, ferr := ioutil.ReadFile(name); ferr == nil {
+		if data, err = openBackup(data); err == nil {
+			snapshot, err = ReadCompressedSnapshot(bytes.NewReader(data))
+		}
+	} else if backuper != nil {
+		snapshot, err = backuper.Fetch(name)
+	} else {
+		return 0, fmt.Errorf("no such file %s and no backup storage configured", name)
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	return snapshot.Restore(db)
+}
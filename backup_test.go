@@ -0,0 +1,151 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBackuper(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir("", "golinks")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	db, err = OpenStore(filepath.Join(dir, "test.db"))
+	assert.NoError(err)
+	defer db.Close()
+
+	assert.NoError(db.Put([]byte("bookmark_g"), []byte("https://google.com")))
+
+	fake, ts := newFakeS3()
+	defer ts.Close()
+
+	b, err := NewBackuperFromConfig(Config{BackupURL: "s3://localhost/bucket/golinks?insecure=true"}, NewCounters())
+	assert.NoError(err)
+	b.s3.Endpoint = ts.URL
+	b.retain = 2
+
+	// Fake three older backups
+	fake.objects["golinks/golinks-20190101T000000Z.json.gz"] = nil
+	fake.objects["golinks/golinks-20190102T000000Z.json.gz"] = nil
+	fake.objects["golinks/golinks-20190103T000000Z.json.gz"] = nil
+
+	key, err := b.Backup()
+	assert.NoError(err)
+	assert.Equal(key, b.LastBackup())
+
+	keys, err := b.Backups()
+	assert.NoError(err)
+	assert.Equal([]string{"golinks/golinks-20190103T000000Z.json.gz", key}, keys)
+
+	// Restore the latest backup into a fresh store
+	db, err = OpenStore(filepath.Join(dir, "restored.db"))
+	assert.NoError(err)
+	defer db.Close()
+
+	n, err := RestoreFrom("latest", b)
+	assert.NoError(err)
+	assert.Equal(1, n)
+
+	val, err := db.Get([]byte("bookmark_g"))
+	assert.NoError(err)
+	assert.Equal("https://google.com", string(val))
+}
+
+func TestNewBackuperFromConfig(t *testing.T) {
+	assert := assert.New(t)
+
+	b, err := NewBackuperFromConfig(Config{}, NewCounters())
+	assert.NoError(err)
+	assert.Nil(b)
+
+	_, err = NewBackuperFromConfig(Config{BackupURL: "foo"}, NewCounters())
+	assert.Error(err)
+}
+
+func TestRestoreFromFile(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir("", "golinks")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	snapshot := &Snapshot{
+		Version: SnapshotVersion,
+		Data:    map[string]string{"bookmark_gh": "https://github.com"},
+	}
+	buf := &bytes.Buffer{}
+	assert.NoError(snapshot.WriteCompressed(buf))
+
+	path := filepath.Join(dir, "snapshot.json.gz")
+	assert.NoError(ioutil.WriteFile(path, buf.Bytes(), 0644))
+
+	db, err = OpenStore(filepath.Join(dir, "test.db"))
+	assert.NoError(err)
+	defer db.Close()
+
+	n, err := RestoreFrom(path, nil)
+	assert.NoError(err)
+	assert.Equal(1, n)
+	assert.True(db.Has([]byte("bookmark_gh")))
+
+	_, err = RestoreFrom(filepath.Join(dir, "missing"), nil)
+	assert.Error(err)
+}
+
+func TestEncryptedBackup(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir("", "golinks")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	key := bytes.Repeat([]byte("k"), EncryptionKeySize)
+	open := func(name string) Store {
+		store, err := OpenStore(filepath.Join(dir, name))
+		assert.NoError(err)
+		es, err := NewEncryptedStore(store, key)
+		assert.NoError(err)
+		return NewInstrumentedStore(es, NewCounters())
+	}
+
+	db = open("test.db")
+	defer db.Close()
+	assert.NoError(db.Put([]byte("bookmark_g"), []byte("https://google.com")))
+
+	fake, ts := newFakeS3()
+	defer ts.Close()
+
+	b, err := NewBackuperFromConfig(Config{BackupURL: "s3://localhost/bucket/golinks?insecure=true"}, NewCounters())
+	assert.NoError(err)
+	b.s3.Endpoint = ts.URL
+
+	// Backups of encrypted stores are encrypted with them
+	name, err := b.Backup()
+	assert.NoError(err)
+	_, err = ReadCompressedSnapshot(bytes.NewReader(fake.objects[name]))
+	assert.Error(err)
+	assert.NotContains(string(fake.objects[name]), "google.com")
+
+	db = open("restored.db")
+	defer db.Close()
+	n, err := RestoreFrom("latest", b)
+	assert.NoError(err)
+	assert.Equal(1, n)
+	val, err := db.Get([]byte("bookmark_g"))
+	assert.NoError(err)
+	assert.Equal("https://google.com", string(val))
+
+	// and can't be restored without the key
+	db, err = OpenStore(filepath.Join(dir, "plain.db"))
+	assert.NoError(err)
+	defer db.Close()
+	_, err = RestoreFrom("latest", b)
+	assert.Error(err)
+}
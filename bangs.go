@@ -0,0 +1,169 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/namsral/flag"
+)
+
+const (
+	// DefaultBangsURL is the public list of DuckDuckGo !bangs
+	DefaultBangsURL = "https://duckduckgo.com/bang.js"
+
+	// MaxBangsBytes is the maximum size of the list of bangs
+	MaxBangsBytes = 32 << 20
+)
+
+// Bang is a DuckDuckGo !bang search shortcut
+type Bang struct {
+	Trigger     string `json:"t"`
+	URL         string `json:"u"`
+	Name        string `json:"s"`
+	Domain      string `json:"d"`
+	Category    string `json:"c"`
+	Subcategory string `json:"sc"`
+}
+
+// BookmarkURL returns the bang's url template as a bookmark url, i.e: with
+// the {{{s}}} placeholder replaced by %s
+func (b Bang) BookmarkURL() string {
+	u := strings.Replace(b.URL, "%", "%%", -1)
+	u = strings.Replace(u, "{{{s}}}", "%s", -1)
+	if strings.HasPrefix(u, "/") {
+		u = "https://duckduckgo.com" + u
+	}
+	return u
+}
+
+// ParseBangs parses DuckDuckGo's list of bangs (bang.js)
+func ParseBangs(r io.Reader) ([]Bang, error) {
+	var bangs []Bang
+	if err := json.NewDecoder(r).Decode(&bangs); err != nil {
+		return nil, err
+	}
+	return bangs, nil
+}
+
+// InstallBangs installs the bangs with the given triggers (or all bangs) as
+// bookmarks named after their triggers, e.g: !gh => gh. Existing bookmarks
+// are never overwritten.
+func InstallBangs(bangs []Bang, triggers []string, all bool) (summary ImportSummary) {
+	byTrigger := make(map[string]Bang)
+	for _, bang := range bangs {
+		trigger := strings.ToLower(bang.Trigger)
+		if trigger == "" || strings.ContainsAny(trigger, "/ \t") || bang.URL == "" {
+			continue
+		}
+		if _, ok := byTrigger[trigger]; !ok {
+			byTrigger[trigger] = bang
+		}
+	}
+
+	if all {
+		triggers = nil
+		for trigger := range byTrigger {
+			triggers = append(triggers, trigger)
+		}
+		sort.Strings(triggers)
+	}
+
+	for _, trigger := range triggers {
+		trigger = strings.ToLower(strings.TrimPrefix(trigger, "!"))
+		result := ImportResult{Name: trigger}
+
+		bang, ok := byTrigger[trigger]
+		if !ok {
+			result.Status = ImportFailed
+			result.Error = "no such bang"
+		} else {
+			result.Title, result.URL = bang.Name, bang.BookmarkURL()
+
+			existing, exists := LookupBookmark(trigger)
+			switch {
+			case exists && existing.URL() == result.URL:
+				result.Status = ImportExists
+			case exists:
+				result.Status = ImportFailed
+				result.Error = "name is taken by another bookmark"
+			default:
+				result.Status = ImportAdded
+				if err := SaveBookmark(trigger, result.URL); err != nil {
+					result.Status = ImportFailed
+					result.Error = err.Error()
+				}
+			}
+		}
+
+		switch result.Status {
+		case ImportAdded:
+			summary.Added++
+		case ImportExists:
+			summary.Exists++
+		case ImportFailed:
+			summary.Failed++
+		}
+		summary.Results = append(summary.Results, result)
+	}
+
+	return
+}
+
+func runBangs(args []string) error {
+	var (
+		dbpath, encryptionKeyFile string
+		source                    string
+		all, verbose              bool
+	)
+
+	fs := flag.NewFlagSet("bangs", flag.ExitOnError)
+	fs.StringVar(&dbpath, "dbpath", "search.db", "database path or uri")
+	fs.StringVar(&encryptionKeyFile, "encryption-key-file", "",
+		"file containing the key the database is encrypted with")
+	fs.StringVar(&source, "url", DefaultBangsURL, "url (or file) of the list of bangs")
+	fs.BoolVar(&all, "all", false, "install all bangs")
+	fs.BoolVar(&verbose, "v", false, "print the outcome of each bang")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if !all && fs.NArg() == 0 {
+		return errors.New("usage: golinks bangs [-all] [trigger ...]")
+	}
+
+	data, err := fetchSource(source, MaxBangsBytes)
+	if err != nil {
+		return err
+	}
+	bangs, err := ParseBangs(bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("error parsing bangs from %s: %s", source, err)
+	}
+
+	db, err = OpenDB(dbpath, encryptionKeyFile)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	summary := InstallBangs(bangs, fs.Args(), all)
+	for _, result := range summary.Results {
+		if verbose || result.Status == ImportFailed && !all {
+			fmt.Fprintf(os.Stderr, "%s: %s %s\n", result.Name, result.Status, result.Error)
+		}
+	}
+
+	slog.Info(
+		"installed bangs", "db", dbpath,
+		"added", summary.Added, "existing", summary.Exists, "failed", summary.Failed,
+	)
+
+	return nil
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const testBangs = `[
+  {"c": "Shopping", "d": "www.amazon.com", "r": 0, "s": "Amazon", "sc": "Online", "t": "a", "u": "https://www.amazon.com/s?k={{{s}}}"},
+  {"c": "Tech", "d": "github.com", "r": 0, "s": "GitHub", "sc": "Programming", "t": "gh", "u": "https://github.com/search?utf8=%E2%9C%93&q={{{s}}}"},
+  {"c": "Tech", "d": "www.npmjs.com", "r": 0, "s": "npm", "sc": "Programming", "t": "npm", "u": "https://www.npmjs.com/search?q={{{s}}}"},
+  {"c": "Online Services", "d": "duckduckgo.com", "r": 0, "s": "DuckDuckGo Images", "sc": "Search", "t": "i", "u": "/?q={{{s}}}&ia=images"}
+]`
+
+func TestParseBangs(t *testing.T) {
+	assert := assert.New(t)
+
+	bangs, err := ParseBangs(strings.NewReader(testBangs))
+	assert.NoError(err)
+	assert.Len(bangs, 4)
+	assert.Equal("gh", bangs[1].Trigger)
+	assert.Equal("GitHub", bangs[1].Name)
+	assert.Equal("https://github.com/search?utf8=%%E2%%9C%%93&q=%s", bangs[1].BookmarkURL())
+	assert.Equal("https://duckduckgo.com/?q=%s&ia=images", bangs[3].BookmarkURL())
+
+	_, err = ParseBangs(strings.NewReader("{"))
+	assert.Error(err)
+}
+
+func TestInstallBangs(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir("", "golinks")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	db, err = OpenStore(filepath.Join(dir, "test.db"))
+	assert.NoError(err)
+	defer db.Close()
+
+	bangs, err := ParseBangs(strings.NewReader(testBangs))
+	assert.NoError(err)
+
+	assert.NoError(SaveBookmark("a", "https://example.com/?q=%s"))
+
+	summary := InstallBangs(bangs, []string{"!gh", "npm", "a", "nope"}, false)
+	assert.Equal(2, summary.Added)
+	assert.Equal(2, summary.Failed)
+
+	bookmark, ok := LookupBookmark("gh")
+	assert.True(ok)
+	assert.Equal("https://github.com/search?utf8=%E2%9C%93&q=golinks", bookmark.Expand("golinks"))
+
+	bookmark, ok = LookupBookmark("a")
+	assert.True(ok)
+	assert.Equal("https://example.com/?q=%s", bookmark.URL())
+
+	summary = InstallBangs(bangs, nil, true)
+	assert.Equal(1, summary.Added)
+	assert.Equal(2, summary.Exists)
+	assert.Equal(1, summary.Failed)
+
+	_, ok = LookupBookmark("i")
+	assert.True(ok)
+}
@@ -1,18 +1,24 @@
 package main
 
 import (
+	"encoding/json"
 	"fmt"
-	"log"
+	"log/slog"
 	"net/http"
+	"sort"
 	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
 
 	"github.com/prologic/bitcask"
 )
 
 // Bookmark ...
 type Bookmark struct {
-	name string
-	url  string
+	name  string
+	url   string
+	owner string
 }
 
 // Name ...
@@ -25,24 +31,129 @@ func (b Bookmark) URL() string {
 	return b.url
 }
 
+// Owner returns the user who created the bookmark, if known (only set on
+// bookmarks read with their owner, see BookmarkOwner)
+func (b Bookmark) Owner() string {
+	return b.owner
+}
+
+// MarshalJSON ...
+func (b Bookmark) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Name  string `json:"name"`
+		URL   string `json:"url"`
+		Owner string `json:"owner,omitempty"`
+	}{b.name, b.url, b.owner})
+}
+
+// Expand returns the bookmark's url with the query q substituted, or for
+// urls with template actions (e.g: {{ join "-" .Args }}) the url rendered
+// as a UserTemplate
+func (b Bookmark) Expand(q string) string {
+	if strings.Contains(b.url, "{{") {
+		return b.render(q)
+	}
+	if q == "" {
+		return b.url
+	}
+	return fmt.Sprintf(b.url, q)
+}
+
+// render returns the url of the bookmark rendered as a UserTemplate with
+// the query q, or the url as is if it can't be rendered
+func (b Bookmark) render(q string) string {
+	tmpl, err := ParseUserTemplate(b.name, b.url, 0)
+	if err != nil {
+		slog.Error("error parsing bookmark template", "name", b.name, "err", err)
+		return b.url
+	}
+	u, err := tmpl.Execute(UserTemplateData{Name: b.name, Query: q, Args: strings.Fields(q)})
+	if err != nil {
+		slog.Warn("error rendering bookmark template", "name", b.name, "err", err)
+		return b.url
+	}
+	return u
+}
+
 // Exec ...
 func (b Bookmark) Exec(w http.ResponseWriter, r *http.Request, q string) {
-	url := b.url
-	if q != "" {
-		url = fmt.Sprintf(b.url, q)
+	redirect(w, r, b.Expand(q))
+}
+
+// redirect redirects to url with a 302. Absolute urls (i.e: those of
+// bookmarks) skip the parsing and HTML body of http.Redirect, which
+// allocate on every redirect, but are escaped like it.
+func redirect(w http.ResponseWriter, r *http.Request, url string) {
+	if !strings.HasPrefix(url, "https://") && !strings.HasPrefix(url, "http://") {
+		http.Redirect(w, r, url, http.StatusFound)
+		return
+	}
+	w.Header()["Location"] = []string{hexEscapeNonASCII(url)}
+	w.WriteHeader(http.StatusFound)
+}
+
+// hexEscapeNonASCII percent-encodes the bytes of non-ASCII characters, as
+// http.Redirect does, returning ASCII strings as is
+func hexEscapeNonASCII(s string) string {
+	n := 0
+	for i := 0; i < len(s); i++ {
+		if s[i] >= utf8.RuneSelf {
+			n += 2
+		}
 	}
-	http.Redirect(w, r, url, http.StatusFound)
+	if n == 0 {
+		return s
+	}
+
+	b := make([]byte, 0, len(s)+n)
+	for i := 0; i < len(s); i++ {
+		if s[i] >= utf8.RuneSelf {
+			b = append(b, '%', "0123456789abcdef"[s[i]>>4], "0123456789abcdef"[s[i]&15])
+		} else {
+			b = append(b, s[i])
+		}
+	}
+	return string(b)
+}
+
+// keyBuffers pools the buffers keys are built in by lookups on every
+// redirect
+var keyBuffers = sync.Pool{
+	New: func() interface{} {
+		buf := make([]byte, 0, 64)
+		return &buf
+	},
+}
+
+// getKey gets the value of the key prefix+name, building the key in a
+// pooled buffer rather than allocating it
+func getKey(prefix, name string) ([]byte, error) {
+	buf := keyBuffers.Get().(*[]byte)
+	key := append(append((*buf)[:0], prefix...), name...)
+	val, err := db.Get(key)
+	*buf = key
+	keyBuffers.Put(buf)
+	return val, err
 }
 
 // LookupBookmark ...
 func LookupBookmark(name string) (bookmark Bookmark, ok bool) {
-	key := fmt.Sprintf("bookmark_%s", strings.ToLower(name))
-	val, err := db.Get([]byte(key))
+	// Names are usually lowercase already, which ToLower doesn't copy
+	val, err := getKey("bookmark_", strings.ToLower(name))
+	if err == bitcask.ErrKeyNotFound {
+		// Aliases (e.g: declared in a bookmarks manifest) refer to a bookmark
+		target, aerr := getKey("alias_", strings.ToLower(name))
+		if aerr != nil {
+			return
+		}
+		name = string(target)
+		val, err = getKey("bookmark_", name)
+	}
 	if err != nil {
 		if err == bitcask.ErrKeyNotFound {
 			return
 		}
-		log.Printf("error looking up bookmark for %s: %s", name, err)
+		slog.Error("error looking up bookmark", "name", name, "err", err)
 	}
 
 	bookmark.name = name
@@ -51,3 +162,107 @@ func LookupBookmark(name string) (bookmark Bookmark, ok bool) {
 
 	return
 }
+
+func modifiedKey(name string) []byte {
+	return []byte(fmt.Sprintf("modified_%s", name))
+}
+
+// SaveBookmark creates or updates the bookmark with the given name and
+// records when it was last modified
+func SaveBookmark(name, url string) error {
+	old, err := bookmarkURL(name)
+	if err != nil {
+		return err
+	}
+
+	key := []byte(fmt.Sprintf("bookmark_%s", name))
+	if err := db.Put(key, []byte(url)); err != nil {
+		return err
+	}
+	if err := indexTarget(name, old, url); err != nil {
+		return err
+	}
+	return db.Put(modifiedKey(name), []byte(time.Now().UTC().Format(time.RFC3339Nano)))
+}
+
+// DeleteBookmark deletes the bookmark with the given name
+func DeleteBookmark(name string) error {
+	old, err := bookmarkURL(name)
+	if err != nil {
+		return err
+	}
+
+	key := []byte(fmt.Sprintf("bookmark_%s", name))
+	if err := db.Delete(key); err != nil {
+		return err
+	}
+	if err := indexTarget(name, old, ""); err != nil {
+		return err
+	}
+	if err := db.Delete(ownerKey(name)); err != nil {
+		return err
+	}
+	return db.Delete(modifiedKey(name))
+}
+
+func ownerKey(name string) []byte {
+	return []byte(fmt.Sprintf("owner_%s", name))
+}
+
+// ClaimBookmark records user as the owner of the bookmark with the given
+// name, unless the user is unknown or the bookmark already has an owner
+func ClaimBookmark(name, user string) error {
+	if user == "" || db.Has(ownerKey(name)) {
+		return nil
+	}
+	return db.Put(ownerKey(name), []byte(user))
+}
+
+// BookmarkOwner returns the user who created the bookmark with the given
+// name, or an empty string if it was created anonymously or by a sync
+func BookmarkOwner(name string) string {
+	val, err := db.Get(ownerKey(name))
+	if err != nil {
+		return ""
+	}
+	return string(val)
+}
+
+// BookmarkModified returns when the bookmark with the given name was last
+// modified. Bookmarks saved before modification times were recorded report
+// false.
+func BookmarkModified(name string) (time.Time, bool) {
+	val, err := db.Get(modifiedKey(name))
+	if err != nil {
+		return time.Time{}, false
+	}
+	t, err := time.Parse(time.RFC3339Nano, string(val))
+	if err != nil {
+		return time.Time{}, false
+	}
+	return t, true
+}
+
+// ListBookmarks returns all bookmarks sorted by name
+func ListBookmarks() ([]Bookmark, error) {
+	return listBookmarks("bookmark_", "")
+}
+
+// listBookmarks returns the bookmarks stored under the key prefix, sorted
+// by name, named with the given sigil (e.g: ~ or @infra/)
+func listBookmarks(prefix, sigil string) ([]Bookmark, error) {
+	var bookmarks []Bookmark
+	err := db.Scan([]byte(prefix), func(key []byte) error {
+		val, err := db.Get(key)
+		if err != nil {
+			return err
+		}
+		name := sigil + strings.TrimPrefix(string(key), prefix)
+		bookmarks = append(bookmarks, Bookmark{name: name, url: string(val)})
+		return nil
+	})
+	sort.Slice(bookmarks, func(i, j int) bool {
+		return bookmarks[i].name < bookmarks[j].name
+	})
+	return bookmarks, err
+}
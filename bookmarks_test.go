@@ -55,6 +55,43 @@ func TestBookmarkWithQuery(t *testing.T) {
 	)
 }
 
+func TestBookmarkNonASCII(t *testing.T) {
+	assert := assert.New(t)
+
+	bookmark := Bookmark{
+		name: "w",
+		url:  "https://de.wikipedia.org/wiki/%s",
+	}
+
+	r, _ := http.NewRequest("GET", "", nil)
+	w := httptest.NewRecorder()
+	bookmark.Exec(w, r, "Straße")
+	assert.Equal(http.StatusFound, w.Code)
+	assert.Equal("https://de.wikipedia.org/wiki/Stra%c3%9fe", w.Header().Get("Location"))
+
+	// Escaped like http.Redirect does
+	expected := httptest.NewRecorder()
+	http.Redirect(expected, r, "https://de.wikipedia.org/wiki/Straße", http.StatusFound)
+	assert.Equal(expected.Header().Get("Location"), w.Header().Get("Location"))
+}
+
+func TestBookmarkWithTemplate(t *testing.T) {
+	assert := assert.New(t)
+
+	bookmark := Bookmark{
+		name: "jira",
+		url:  `https://jira.example.com/browse/{{ join "-" .Args | upper }}`,
+	}
+	assert.Equal("https://jira.example.com/browse/GL-1", bookmark.Expand("gl 1"))
+
+	// Templates that fail to render leave the url as is
+	bookmark.url = `https://example.com/{{ range 1000000000000 }}{{ end }}`
+	assert.Equal(bookmark.url, bookmark.Expand("x"))
+
+	assert.NoError(ValidateBookmark("jira", `https://jira.example.com/browse/{{ .Query }}`))
+	assert.Error(ValidateBookmark("jira", `https://jira.example.com/browse/{{ env "HOME" }}`))
+}
+
 func TestBookmarkWithoutQuery(t *testing.T) {
 	assert := assert.New(t)
 
@@ -0,0 +1,267 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+// MaxBookmarkRequestBytes is the maximum size of a bookmark request body
+const MaxBookmarkRequestBytes = 64 * 1024
+
+// BookmarkRequest is the body of requests creating or updating a bookmark
+type BookmarkRequest struct {
+	Name string `json:"name"`
+	URL  string `json:"url"`
+}
+
+// ValidateBookmark returns an error if name or url are not valid for a
+// bookmark. Names are case insensitive and must not shadow a command, and
+// urls with template actions must be valid user templates.
+func ValidateBookmark(name, url string) error {
+	if name == "" {
+		return fmt.Errorf("name is required")
+	}
+	if strings.ContainsAny(name, " \t\r\n") || strings.HasPrefix(name, "/") || strings.HasSuffix(name, "/") {
+		return fmt.Errorf("invalid name %q", name)
+	}
+	if LookupCommand(name) != nil {
+		return fmt.Errorf("name %q is a command", name)
+	}
+	if !strings.HasPrefix(url, "http://") && !strings.HasPrefix(url, "https://") {
+		return fmt.Errorf("url must be an absolute http(s) url")
+	}
+	if strings.Contains(url, "{{") {
+		if _, err := ParseUserTemplate(name, url, 0); err != nil {
+			return fmt.Errorf("invalid url template: %w", err)
+		}
+	}
+	return nil
+}
+
+func decodeBookmarkRequest(r *http.Request) (req BookmarkRequest, err error) {
+	err = json.NewDecoder(io.LimitReader(r.Body, MaxBookmarkRequestBytes)).Decode(&req)
+	return
+}
+
+// bookmarkName returns the (possibly slash separated) name of the bookmark
+// in the request path, e.g: /api/v1/bookmarks/work/jira => work/jira
+func bookmarkName(p httprouter.Params) string {
+	return strings.ToLower(strings.Trim(p.ByName("name"), "/"))
+}
+
+// writable writes an error and returns false if the instance is read-only
+func (s *Server) writable(w http.ResponseWriter, r *http.Request) bool {
+	if s.config.ReadOnly {
+		WriteAPIError(w, r, http.StatusForbidden, ErrCodeForbidden, "instance is read-only", nil)
+		return false
+	}
+	return true
+}
+
+// BookmarksHandler lists bookmarks as JSON, optionally only those pointing
+// at a target domain (or its subdomains), e.g:
+// /api/v1/bookmarks?target=service-x.corp
+func (s *Server) BookmarksHandler() httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+		s.counters.Inc("n_api_bookmarks")
+
+		var (
+			bookmarks []Bookmark
+			err       error
+		)
+
+		if target, ok := r.URL.Query()["target"]; ok {
+			if TargetDomain(target[0]) == "" {
+				WriteAPIError(w, r, http.StatusBadRequest, ErrCodeBadRequest, "invalid target", nil)
+				return
+			}
+			bookmarks, err = FindBookmarksByTarget(target[0])
+		} else {
+			bookmarks, err = ListBookmarks()
+		}
+		if err != nil {
+			WriteAPIError(
+				w, r, http.StatusInternalServerError, ErrCodeInternal,
+				"error reading bookmarks", err.Error(),
+			)
+			return
+		}
+
+		if bookmarks == nil {
+			bookmarks = []Bookmark{}
+		}
+		WriteJSON(w, http.StatusOK, map[string]interface{}{"bookmarks": bookmarks})
+	}
+}
+
+// GetBookmarkHandler returns a single bookmark
+func (s *Server) GetBookmarkHandler() httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		s.counters.Inc("n_api_bookmarks_get")
+
+		name := bookmarkName(p)
+		url, err := bookmarkURL(name)
+		if err != nil {
+			WriteAPIError(
+				w, r, http.StatusInternalServerError, ErrCodeInternal,
+				"error reading bookmark", err.Error(),
+			)
+			return
+		}
+		if url == "" {
+			WriteAPIError(
+				w, r, http.StatusNotFound, ErrCodeNotFound,
+				fmt.Sprintf("no bookmark named %s", name), nil,
+			)
+			return
+		}
+
+		WriteJSON(w, http.StatusOK, Bookmark{name: name, url: url, owner: BookmarkOwner(name)})
+	}
+}
+
+// CreateBookmarkHandler creates a bookmark from a JSON body, e.g:
+// {"name": "g", "url": "https://www.google.com/search?q=%s"}
+func (s *Server) CreateBookmarkHandler() httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+		s.counters.Inc("n_api_bookmarks_create")
+
+		if !s.writable(w, r) {
+			return
+		}
+
+		req, err := decodeBookmarkRequest(r)
+		if err != nil {
+			WriteAPIError(w, r, http.StatusBadRequest, ErrCodeBadRequest, "invalid json", err.Error())
+			return
+		}
+		req.Name = strings.ToLower(strings.Trim(req.Name, "/"))
+		if err := ValidateBookmark(req.Name, req.URL); err != nil {
+			WriteAPIError(w, r, http.StatusBadRequest, ErrCodeBadRequest, err.Error(), nil)
+			return
+		}
+
+		if db.Has([]byte(fmt.Sprintf("bookmark_%s", req.Name))) {
+			WriteAPIError(
+				w, r, http.StatusConflict, ErrCodeConflict,
+				fmt.Sprintf("bookmark %s already exists", req.Name), nil,
+			)
+			return
+		}
+
+		owner := RequestUser(r)
+		err = SaveBookmark(req.Name, req.URL)
+		if err == nil {
+			err = ClaimBookmark(req.Name, owner)
+		}
+		if err != nil {
+			WriteAPIError(
+				w, r, http.StatusInternalServerError, ErrCodeInternal,
+				"error saving bookmark", err.Error(),
+			)
+			return
+		}
+
+		auditBookmark(r, req.Name, "", req.URL)
+		w.Header().Set("Location", "/api/v1/bookmarks/"+req.Name)
+		WriteJSON(w, http.StatusCreated, Bookmark{name: req.Name, url: req.URL, owner: owner})
+	}
+}
+
+// UpdateBookmarkHandler updates the url of an existing bookmark from a JSON
+// body, e.g: {"url": "https://duckduckgo.com/?q=%s"}
+func (s *Server) UpdateBookmarkHandler() httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		s.counters.Inc("n_api_bookmarks_update")
+
+		if !s.writable(w, r) {
+			return
+		}
+
+		name := bookmarkName(p)
+		req, err := decodeBookmarkRequest(r)
+		if err != nil {
+			WriteAPIError(w, r, http.StatusBadRequest, ErrCodeBadRequest, "invalid json", err.Error())
+			return
+		}
+		if req.Name != "" && strings.ToLower(req.Name) != name {
+			WriteAPIError(w, r, http.StatusBadRequest, ErrCodeBadRequest, "bookmarks cannot be renamed", nil)
+			return
+		}
+		if err := ValidateBookmark(name, req.URL); err != nil {
+			WriteAPIError(w, r, http.StatusBadRequest, ErrCodeBadRequest, err.Error(), nil)
+			return
+		}
+
+		old, err := bookmarkURL(name)
+		if err != nil {
+			WriteAPIError(
+				w, r, http.StatusInternalServerError, ErrCodeInternal,
+				"error reading bookmark", err.Error(),
+			)
+			return
+		}
+		if old == "" {
+			WriteAPIError(
+				w, r, http.StatusNotFound, ErrCodeNotFound,
+				fmt.Sprintf("no bookmark named %s", name), nil,
+			)
+			return
+		}
+
+		if err := SaveBookmark(name, req.URL); err != nil {
+			WriteAPIError(
+				w, r, http.StatusInternalServerError, ErrCodeInternal,
+				"error saving bookmark", err.Error(),
+			)
+			return
+		}
+		auditBookmark(r, name, old, req.URL)
+
+		WriteJSON(w, http.StatusOK, Bookmark{name: name, url: req.URL})
+	}
+}
+
+// DeleteBookmarkHandler deletes a bookmark
+func (s *Server) DeleteBookmarkHandler() httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		s.counters.Inc("n_api_bookmarks_delete")
+
+		if !s.writable(w, r) {
+			return
+		}
+
+		name := bookmarkName(p)
+		old, err := bookmarkURL(name)
+		if err != nil {
+			WriteAPIError(
+				w, r, http.StatusInternalServerError, ErrCodeInternal,
+				"error reading bookmark", err.Error(),
+			)
+			return
+		}
+		if old == "" {
+			WriteAPIError(
+				w, r, http.StatusNotFound, ErrCodeNotFound,
+				fmt.Sprintf("no bookmark named %s", name), nil,
+			)
+			return
+		}
+
+		if err := DeleteBookmark(name); err != nil {
+			WriteAPIError(
+				w, r, http.StatusInternalServerError, ErrCodeInternal,
+				"error deleting bookmark", err.Error(),
+			)
+			return
+		}
+		auditBookmark(r, name, old, "")
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
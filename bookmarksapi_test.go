@@ -0,0 +1,96 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBookmarksAPI(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir("", "golinks")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	db, err = OpenStore(filepath.Join(dir, "test.db"))
+	assert.NoError(err)
+	defer db.Close()
+
+	s, err := NewServer(":8000", Config{})
+	assert.NoError(err)
+
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r, _ := http.NewRequest(method, path, strings.NewReader(body))
+		authorize(r, ScopeWrite)
+		s.router.ServeHTTP(w, r)
+		return w
+	}
+
+	w := do("POST", "/api/v1/bookmarks", `{"name": "Work/JIRA", "url": "https://jira.example.com/browse/%s"}`)
+	assert.Equal(http.StatusCreated, w.Code)
+	assert.Equal("/api/v1/bookmarks/work/jira", w.Header().Get("Location"))
+	assert.JSONEq(`{"name": "work/jira", "url": "https://jira.example.com/browse/%s"}`, w.Body.String())
+
+	w = do("POST", "/api/v1/bookmarks", `{"name": "work/jira", "url": "https://jira.example.com/"}`)
+	assert.Equal(http.StatusConflict, w.Code)
+
+	for _, body := range []string{
+		`{"name": "", "url": "https://example.com"}`,
+		`{"name": "a b", "url": "https://example.com"}`,
+		`{"name": "add", "url": "https://example.com"}`,
+		`{"name": "x", "url": "javascript:alert(1)"}`,
+		`{"name": "x"`,
+	} {
+		w = do("POST", "/api/v1/bookmarks", body)
+		assert.Equal(http.StatusBadRequest, w.Code, body)
+	}
+
+	w = do("GET", "/api/v1/bookmarks/work/jira", "")
+	assert.Equal(http.StatusOK, w.Code)
+	assert.JSONEq(`{"name": "work/jira", "url": "https://jira.example.com/browse/%s"}`, w.Body.String())
+
+	w = do("PUT", "/api/v1/bookmarks/work/jira", `{"url": "https://jira.example.com/issues/%s"}`)
+	assert.Equal(http.StatusOK, w.Code)
+	bookmark, ok := LookupBookmark("work/jira")
+	assert.True(ok)
+	assert.Equal("https://jira.example.com/issues/%s", bookmark.URL())
+
+	w = do("PUT", "/api/v1/bookmarks/work/jira", `{"name": "jira", "url": "https://jira.example.com/"}`)
+	assert.Equal(http.StatusBadRequest, w.Code)
+
+	w = do("PUT", "/api/v1/bookmarks/missing", `{"url": "https://example.com/"}`)
+	assert.Equal(http.StatusNotFound, w.Code)
+
+	w = do("GET", "/api/v1/bookmarks", "")
+	assert.Equal(http.StatusOK, w.Code)
+	var res struct {
+		Bookmarks []json.RawMessage `json:"bookmarks"`
+	}
+	assert.NoError(json.Unmarshal(w.Body.Bytes(), &res))
+	assert.Len(res.Bookmarks, 1)
+
+	w = do("DELETE", "/api/v1/bookmarks/work/jira", "")
+	assert.Equal(http.StatusNoContent, w.Code)
+	_, ok = LookupBookmark("work/jira")
+	assert.False(ok)
+
+	w = do("DELETE", "/api/v1/bookmarks/work/jira", "")
+	assert.Equal(http.StatusNotFound, w.Code)
+
+	w = do("GET", "/api/v1/bookmarks/work/jira", "")
+	assert.Equal(http.StatusNotFound, w.Code)
+
+	s, err = NewServer(":8000", Config{ReadOnly: true})
+	assert.NoError(err)
+	w = do("POST", "/api/v1/bookmarks", `{"name": "g", "url": "https://google.com"}`)
+	assert.Equal(http.StatusForbidden, w.Code)
+}
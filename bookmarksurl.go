@@ -0,0 +1,156 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// ManifestFetcher periodically mirrors a bookmarks manifest served over
+// http(s), e.g: a central team maintained list, into the store. Conditional
+// requests (ETag and Last-Modified) avoid refetching unchanged manifests.
+type ManifestFetcher struct {
+	sync.Mutex
+
+	url      string
+	counters *Counters
+
+	// apply syncs the manifest (its bookmarks and settings)
+	apply func(*Manifest) (SyncResult, error)
+
+	etag         string
+	lastModified string
+}
+
+// NewManifestFetcher ...
+func NewManifestFetcher(url string, counters *Counters, apply func(*Manifest) (SyncResult, error)) *ManifestFetcher {
+	return &ManifestFetcher{url: url, counters: counters, apply: apply}
+}
+
+// ETag returns the ETag of the last synced manifest (if any)
+func (f *ManifestFetcher) ETag() string {
+	f.Lock()
+	defer f.Unlock()
+
+	return f.etag
+}
+
+// fetch returns the manifest or nil if it is unchanged since the last sync
+func (f *ManifestFetcher) fetch() (*Manifest, *http.Response, error) {
+	req, err := http.NewRequest("GET", f.url, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	if f.etag != "" {
+		req.Header.Set("If-None-Match", f.etag)
+	}
+	if f.lastModified != "" {
+		req.Header.Set("If-Modified-Since", f.lastModified)
+	}
+
+	res, err := client.Do(req)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer res.Body.Close()
+
+	switch res.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotModified:
+		return nil, res, nil
+	default:
+		return nil, nil, fmt.Errorf("error fetching %s: %s", f.url, res.Status)
+	}
+
+	data, err := ioutil.ReadAll(io.LimitReader(res.Body, MaxManifestBytes+1))
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(data) > MaxManifestBytes {
+		return nil, nil, fmt.Errorf("error fetching %s: larger than %d bytes", f.url, MaxManifestBytes)
+	}
+
+	manifest, err := ParseManifest(bytes.NewReader(data))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return manifest, res, nil
+}
+
+// Sync fetches the manifest and syncs it unless it is unchanged
+func (f *ManifestFetcher) Sync() (changed bool, result SyncResult, err error) {
+	f.Lock()
+	defer f.Unlock()
+
+	manifest, res, err := f.fetch()
+	if err != nil {
+		f.counters.Inc("n_manifest_url_failed")
+		return
+	}
+	if manifest == nil {
+		f.counters.Inc("n_manifest_url_not_modified")
+		return
+	}
+
+	if result, err = f.apply(manifest); err != nil {
+		f.counters.Inc("n_manifest_url_failed")
+		return
+	}
+
+	f.etag = res.Header.Get("ETag")
+	f.lastModified = res.Header.Get("Last-Modified")
+	f.counters.Inc("n_manifest_url_sync")
+
+	return true, result, nil
+}
+
+// SyncAndLog syncs the manifest and logs what changed (if anything)
+func (f *ManifestFetcher) SyncAndLog() error {
+	changed, result, err := f.Sync()
+	if err != nil {
+		return err
+	}
+	if changed {
+		slog.Info("synced bookmarks", "url", f.url, "result", result)
+	}
+	return nil
+}
+
+// Run syncs the manifest every interval until ctx is cancelled
+func (f *ManifestFetcher) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		if err := f.SyncAndLog(); err != nil {
+			slog.Error("error syncing bookmarks", "url", f.url, "err", err)
+		}
+	}
+}
+
+// SyncBookmarksURL syncs the configured remote bookmarks manifest (if any)
+func (s *Server) SyncBookmarksURL() error {
+	if s.manifestFetcher == nil {
+		return nil
+	}
+
+	if s.config.ReadOnly {
+		slog.Warn("not syncing bookmarks in read-only mode", "url", s.config.BookmarksURL)
+		return nil
+	}
+
+	return s.manifestFetcher.SyncAndLog()
+}
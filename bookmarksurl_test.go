@@ -0,0 +1,72 @@
+package main
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestManifestFetcher(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir("", "golinks")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	db, err = OpenStore(filepath.Join(dir, "test.db"))
+	assert.NoError(err)
+	defer db.Close()
+
+	manifest, etag := testManifest, `"v1"`
+	var fetched int
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("If-None-Match") == etag {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		fetched++
+		w.Header().Set("ETag", etag)
+		w.Write([]byte(manifest))
+	}))
+	defer ts.Close()
+
+	s, err := NewServer(":8000", Config{BookmarksURL: ts.URL + "/links.yaml"})
+	assert.NoError(err)
+	assert.NoError(s.SyncBookmarksURL())
+
+	_, ok := LookupBookmark("jira")
+	assert.True(ok)
+	assert.Equal(`"v1"`, s.manifestFetcher.ETag())
+
+	// Unchanged manifests are not fetched again
+	changed, _, err := s.manifestFetcher.Sync()
+	assert.NoError(err)
+	assert.False(changed)
+	assert.Equal(1, fetched)
+
+	manifest, etag = "bookmarks:\n  gh: https://github.com\n", `"v2"`
+	changed, result, err := s.manifestFetcher.Sync()
+	assert.NoError(err)
+	assert.True(changed)
+	assert.Equal(SyncResult{Updated: 1, Removed: 1}, result)
+	assert.Equal(`"v2"`, s.manifestFetcher.ETag())
+
+	// Invalid manifests are not synced
+	manifest, etag = "bookmarks: [\n", `"v3"`
+	assert.Error(s.SyncBookmarksURL())
+	assert.Equal(`"v2"`, s.manifestFetcher.ETag())
+	bookmark, ok := LookupBookmark("gh")
+	assert.True(ok)
+	assert.Equal("https://github.com", bookmark.URL())
+
+	_, err = NewServer(":8000", Config{BookmarksURL: ts.URL, BookmarksFile: "bookmarks.yaml"})
+	assert.Error(err)
+
+	_, err = NewServer(":8000", Config{Offline: true, BookmarksURL: ts.URL})
+	assert.Error(err)
+}
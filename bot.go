@@ -0,0 +1,244 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	// BotPrefix starts messages the bots answer, e.g: go gh golang/go
+	BotPrefix = "go"
+
+	// BotPollTimeout is how long the bots long-poll for new messages
+	BotPollTimeout = 30 * time.Second
+
+	// MaxBotRetryDelay is the longest polling is backed off for on errors
+	MaxBotRetryDelay = 5 * time.Minute
+)
+
+// BotMessage is a chat message received by a bot
+type BotMessage struct {
+	// ID of the message and Chat (or room) it was sent to
+	ID   string
+	Chat string
+
+	// From are the identities of the sender, e.g: its id and username,
+	// matched against the bot users
+	From []string
+
+	Text string
+}
+
+// BotClient is a chat service a bot long-polls for messages
+type BotClient interface {
+	Name() string
+	Poll() ([]BotMessage, error)
+	Reply(msg BotMessage, text string) error
+}
+
+// ParseBotUsers parses a comma separated list of chat users and the scope
+// they are granted, e.g: alice=write,@bob:example.org=admin. Anyone can
+// resolve links through the bots, only users granted the write scope (or
+// admin) can add and remove bookmarks.
+func ParseBotUsers(s string) (map[string]string, error) {
+	users := make(map[string]string)
+	for _, user := range strings.Split(s, ",") {
+		user = strings.TrimSpace(user)
+		if user == "" {
+			continue
+		}
+		i := strings.LastIndex(user, "=")
+		if i <= 0 {
+			return nil, fmt.Errorf("invalid bot user %q (expected <user>=<scope>)", user)
+		}
+		scope := strings.ToLower(strings.TrimSpace(user[i+1:]))
+		if _, ok := scopeLevels[scope]; !ok {
+			return nil, ErrInvalidScope
+		}
+		users[strings.TrimSpace(user[:i])] = scope
+	}
+	return users, nil
+}
+
+// Bot answers chat messages like "go gh golang/go" with the url the query
+// resolves to, and "go add <name> <url>" and "go remove <name>" from users
+// allowed to write
+type Bot struct {
+	server *Server
+	client BotClient
+	users  map[string]string
+
+	retryDelay time.Duration
+	done       chan struct{}
+}
+
+// NewBot ...
+func NewBot(server *Server, client BotClient, users map[string]string) *Bot {
+	return &Bot{
+		server: server,
+		client: client,
+		users:  users,
+
+		retryDelay: time.Second,
+		done:       make(chan struct{}),
+	}
+}
+
+// user returns the identity of the sender of the message granted the scope
+// as audited (e.g: telegram:alice), or an empty string if it isn't granted
+func (b *Bot) user(msg BotMessage, scope string) string {
+	for _, from := range msg.From {
+		if granted, ok := b.users[from]; ok && scopeLevels[granted] >= scopeLevels[scope] {
+			return b.client.Name() + ":" + from
+		}
+	}
+	return ""
+}
+
+// resolve returns the url the query resolves to, like a redirect would
+func (b *Bot) resolve(query string) string {
+	tokens := strings.Fields(query)
+	cmd, q := tokens[0], strings.Join(tokens[1:], " ")
+
+	if command := LookupCommand(cmd); command != nil {
+		if b.server.config.FQDN != "" {
+			return fmt.Sprintf("http://%s/?q=%s", b.server.config.FQDN, url.QueryEscape(query))
+		}
+		return fmt.Sprintf("%s is a command", command.Name())
+	}
+
+	t0 := time.Now()
+	var kind, name, target string
+	if bookmark, ok := LookupBookmark(cmd); ok {
+		kind, name, target = HitBookmark, bookmark.Name(), bookmark.Expand(q)
+	} else if bookmark, ok := b.server.resolvePeers(cmd); ok {
+		kind, name, target = HitPeer, bookmark.Name(), bookmark.Expand(q)
+	} else if defaultURL := b.server.settings().URL; defaultURL != "" {
+		target = fmt.Sprintf(defaultURL, query)
+	} else {
+		return fmt.Sprintf("Nothing matches %s", cmd)
+	}
+
+	b.server.recordHistory("", query, name, target)
+	b.server.publishRedirect(query, name, target)
+	if kind != "" {
+		b.server.hits.Record(kind, name, time.Since(t0))
+	}
+
+	return target
+}
+
+// Handle returns the reply to a message, or an empty string if the message
+// is not for the bot
+func (b *Bot) Handle(msg BotMessage) string {
+	// Also accept commands, e.g: /go or /go@golinks_bot on Telegram
+	tokens := strings.Fields(msg.Text)
+	if len(tokens) == 0 {
+		return ""
+	}
+	if prefix := strings.SplitN(strings.TrimPrefix(tokens[0], "/"), "@", 2)[0]; strings.ToLower(prefix) != BotPrefix {
+		return ""
+	}
+	args := tokens[1:]
+	if len(args) == 0 {
+		return "Usage: go <name> [args], go add <name> <url> or go remove <name>"
+	}
+
+	b.server.counters.Inc(fmt.Sprintf("n_bot_%s", b.client.Name()))
+
+	switch strings.ToLower(args[0]) {
+	case "add":
+		user := b.user(msg, ScopeWrite)
+		if user == "" {
+			return "You are not allowed to add bookmarks"
+		}
+		if len(args) != 3 {
+			return "Usage: go add <name> <url>"
+		}
+		name := strings.ToLower(strings.Trim(args[1], "/"))
+		if err := ValidateBookmark(name, args[2]); err != nil {
+			return fmt.Sprintf("Error adding %s: %s", name, err)
+		}
+		old, err := bookmarkURL(name)
+		if err == nil {
+			err = SaveBookmark(name, args[2])
+		}
+		if err != nil {
+			slog.Error("error saving bookmark", "name", name, "err", err)
+			return fmt.Sprintf("Error adding %s: %s", name, err)
+		}
+		auditBookmarkAs(user, name, old, args[2])
+		return fmt.Sprintf("Added %s: %s", name, args[2])
+	case "remove":
+		user := b.user(msg, ScopeWrite)
+		if user == "" {
+			return "You are not allowed to remove bookmarks"
+		}
+		if len(args) != 2 {
+			return "Usage: go remove <name>"
+		}
+		name := strings.ToLower(strings.Trim(args[1], "/"))
+		if _, ok := LookupBookmark(name); !ok {
+			return fmt.Sprintf("No bookmark named %s", name)
+		}
+		old, err := bookmarkURL(name)
+		if err == nil {
+			err = DeleteBookmark(name)
+		}
+		if err != nil {
+			slog.Error("error deleting bookmark", "name", name, "err", err)
+			return fmt.Sprintf("Error removing %s: %s", name, err)
+		}
+		auditBookmarkAs(user, name, old, "")
+		return fmt.Sprintf("Removed %s", name)
+	default:
+		return b.resolve(strings.Join(args, " "))
+	}
+}
+
+// Run polls for messages and answers them until stopped, backing off when
+// polling fails
+func (b *Bot) Run() {
+	delay := b.retryDelay
+	for {
+		select {
+		case <-b.done:
+			return
+		default:
+		}
+
+		msgs, err := b.client.Poll()
+		if err != nil {
+			b.server.counters.Inc("n_bot_errors")
+			slog.Warn("error polling chat", "chat", b.client.Name(), "err", err, "retry_in", delay)
+			select {
+			case <-b.done:
+				return
+			case <-time.After(delay):
+			}
+			if delay *= 2; delay > MaxBotRetryDelay {
+				delay = MaxBotRetryDelay
+			}
+			continue
+		}
+		delay = b.retryDelay
+
+		for _, msg := range msgs {
+			reply := b.Handle(msg)
+			if reply == "" {
+				continue
+			}
+			if err := b.client.Reply(msg, reply); err != nil {
+				slog.Error("error replying on chat", "chat", b.client.Name(), "err", err)
+			}
+		}
+	}
+}
+
+// Stop stops polling once the current poll returns
+func (b *Bot) Stop() {
+	close(b.done)
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type testBotClient struct {
+	mu      sync.Mutex
+	polls   [][]BotMessage
+	replies []string
+}
+
+func (c *testBotClient) Name() string { return "test" }
+
+func (c *testBotClient) Poll() ([]BotMessage, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if len(c.polls) == 0 {
+		time.Sleep(time.Millisecond)
+		return nil, nil
+	}
+	msgs := c.polls[0]
+	c.polls = c.polls[1:]
+	if msgs == nil {
+		return nil, errors.New("connection reset")
+	}
+	return msgs, nil
+}
+
+func (c *testBotClient) Reply(msg BotMessage, text string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.replies = append(c.replies, msg.Chat+": "+text)
+	return nil
+}
+
+func (c *testBotClient) Replies() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]string{}, c.replies...)
+}
+
+func TestParseBotUsers(t *testing.T) {
+	assert := assert.New(t)
+
+	users, err := ParseBotUsers(" alice=write, @bob:example.org=Admin ,12345=read")
+	assert.NoError(err)
+	assert.Equal(map[string]string{
+		"alice": ScopeWrite, "@bob:example.org": ScopeAdmin, "12345": ScopeRead,
+	}, users)
+
+	users, err = ParseBotUsers("")
+	assert.NoError(err)
+	assert.Empty(users)
+
+	_, err = ParseBotUsers("alice")
+	assert.Error(err)
+
+	_, err = ParseBotUsers("alice=owner")
+	assert.Error(err)
+}
+
+func TestBotHandle(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir("", "golinks")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	db, err = OpenStore(filepath.Join(dir, "test.db"))
+	assert.NoError(err)
+	defer db.Close()
+
+	s, err := NewServer(":8000", Config{FQDN: "go.corp", URL: "https://www.google.com/search?q=%s"})
+	assert.NoError(err)
+
+	users, err := ParseBotUsers("alice=write,carol=read")
+	assert.NoError(err)
+	bot := NewBot(s, &testBotClient{}, users)
+
+	alice := BotMessage{From: []string{"1", "alice"}}
+	bob := BotMessage{From: []string{"2", "bob"}}
+	carol := BotMessage{From: []string{"3", "carol"}}
+	say := func(from BotMessage, text string) string {
+		from.Text = text
+		return bot.Handle(from)
+	}
+
+	assert.Equal("", say(bob, "hello"))
+	assert.Equal("", say(bob, "gopher"))
+	assert.Contains(say(bob, "go"), "Usage")
+
+	assert.Equal("You are not allowed to add bookmarks", say(bob, "go add gh https://github.com/%s"))
+	assert.Equal("You are not allowed to add bookmarks", say(carol, "go add gh https://github.com/%s"))
+	assert.Equal("Added gh: https://github.com/%s", say(alice, "go add GH https://github.com/%s"))
+	assert.Contains(say(alice, "go add x javascript:alert(1)"), "Error adding x")
+	assert.Contains(say(alice, "go add gh"), "Usage")
+
+	assert.Equal("https://github.com/golang/go", say(bob, "go gh golang/go"))
+	assert.Equal("https://github.com/golang/go", say(bob, "/go gh golang/go"))
+	assert.Equal("https://github.com/golang/go", say(bob, "/go@golinks_bot gh golang/go"))
+	assert.Equal("https://www.google.com/search?q=golang generics", say(bob, "go golang generics"))
+	assert.Equal("http://go.corp/?q=list", say(bob, "go list"))
+
+	assert.Equal("You are not allowed to remove bookmarks", say(bob, "go remove gh"))
+	assert.Equal("No bookmark named nope", say(alice, "go remove nope"))
+	assert.Equal("Removed gh", say(alice, "go remove gh"))
+	_, ok := LookupBookmark("gh")
+	assert.False(ok)
+
+	// Changes are audited as the chat user
+	audit, err := ListAudit("", 10)
+	assert.NoError(err)
+	assert.Len(audit.Entries, 2)
+	assert.Equal(EventBookmarkDeleted, audit.Entries[0].Action)
+	assert.Equal(EventBookmarkCreated, audit.Entries[1].Action)
+	assert.Equal("test:alice", audit.Entries[0].User)
+	assert.Equal("test:alice", audit.Entries[1].User)
+
+	page, err := ListHistory("", 10)
+	assert.NoError(err)
+	assert.Len(page.Entries, 4)
+	assert.Equal("gh golang/go", page.Entries[3].Query)
+}
+
+func TestBotRun(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir("", "golinks")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	db, err = OpenStore(filepath.Join(dir, "test.db"))
+	assert.NoError(err)
+	defer db.Close()
+
+	s, err := NewServer(":8000", Config{DisableHistory: true})
+	assert.NoError(err)
+	assert.NoError(SaveBookmark("gh", "https://github.com/%s"))
+
+	client := &testBotClient{polls: [][]BotMessage{
+		nil,
+		{{Chat: "a", Text: "go gh golang/go"}, {Chat: "a", Text: "lunch?"}},
+		{{Chat: "b", Text: "go gh"}},
+	}}
+	bot := NewBot(s, client, nil)
+	bot.retryDelay = time.Millisecond
+
+	go bot.Run()
+	defer bot.Stop()
+
+	for i := 0; i < 1000 && len(client.Replies()) < 2; i++ {
+		time.Sleep(time.Millisecond)
+	}
+	assert.Equal([]string{"a: https://github.com/golang/go", "b: https://github.com/%s"}, client.Replies())
+}
@@ -0,0 +1,232 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultBrowserNamespace is the namespace bookmarks pulled from browser
+// sync services are saved under
+const DefaultBrowserNamespace = "browser"
+
+// BrowserBookmark is a bookmark pulled from a browser sync service
+type BrowserBookmark struct {
+	Title  string
+	URL    string
+	Folder []string
+}
+
+// BrowserConnector pulls bookmarks from a browser sync service (e.g:
+// xBrowserSync)
+type BrowserConnector interface {
+	Name() string
+	Fetch() ([]BrowserBookmark, error)
+}
+
+func browserSyncKey(name string) []byte {
+	return []byte(fmt.Sprintf("browsersync_%s", name))
+}
+
+// BrowserSyncResult ...
+type BrowserSyncResult struct {
+	Added   int `json:"added"`
+	Updated int `json:"updated"`
+	Removed int `json:"removed"`
+	Skipped int `json:"skipped"`
+}
+
+func (r BrowserSyncResult) String() string {
+	return fmt.Sprintf(
+		"%d added, %d updated, %d removed, %d skipped",
+		r.Added, r.Updated, r.Removed, r.Skipped,
+	)
+}
+
+// BrowserSyncer periodically pulls bookmarks from a browser sync service
+// into a namespace, e.g: a JIRA bookmark in a Work folder becomes
+// browser/work/jira. Like remote defaults, the url last pulled for each
+// bookmark is remembered so bookmarks changed locally are left alone and
+// bookmarks removed from the browser are only removed if they weren't.
+type BrowserSyncer struct {
+	sync.Mutex
+
+	connector BrowserConnector
+	namespace string
+	counters  *Counters
+}
+
+// NewBrowserSyncer ...
+func NewBrowserSyncer(connector BrowserConnector, namespace string, counters *Counters) *BrowserSyncer {
+	namespace = strings.Trim(namespace, "/")
+	if namespace == "" {
+		namespace = DefaultBrowserNamespace
+	}
+	return &BrowserSyncer{connector: connector, namespace: namespace, counters: counters}
+}
+
+// names returns the name of each bookmark in the namespace, appending a
+// numeric suffix to duplicates
+func (s *BrowserSyncer) names(bookmarks []BrowserBookmark) map[string]string {
+	urls := make(map[string]string)
+	for _, bookmark := range bookmarks {
+		prefix := s.namespace + "/"
+		for _, folder := range bookmark.Folder {
+			prefix += Slugify(folder, "") + "/"
+		}
+
+		slug := prefix + Slugify(bookmark.Title, bookmark.URL)
+		name := slug
+		for i := 2; i <= MaxSlugSuffix; i++ {
+			if url, taken := urls[name]; !taken || url == bookmark.URL {
+				urls[name] = bookmark.URL
+				break
+			}
+			name = fmt.Sprintf("%s-%d", slug, i)
+		}
+	}
+	return urls
+}
+
+// Sync pulls the bookmarks of the connector into the namespace
+func (s *BrowserSyncer) Sync() (result BrowserSyncResult, err error) {
+	s.Lock()
+	defer s.Unlock()
+
+	result, err = s.sync()
+	if err != nil {
+		s.counters.Inc("n_browsersync_failed")
+		return
+	}
+	s.counters.Inc("n_browsersync_sync")
+	return
+}
+
+func (s *BrowserSyncer) sync() (result BrowserSyncResult, err error) {
+	bookmarks, err := s.connector.Fetch()
+	if err != nil {
+		return
+	}
+	remote := s.names(bookmarks)
+
+	pulled := make(map[string]string)
+	err = db.Scan([]byte("browsersync_"), func(key []byte) error {
+		val, err := db.Get(key)
+		if err != nil {
+			return err
+		}
+		pulled[strings.TrimPrefix(string(key), "browsersync_")] = string(val)
+		return nil
+	})
+	if err != nil {
+		return
+	}
+
+	for name, url := range remote {
+		var local string
+		if local, err = bookmarkURL(name); err != nil {
+			return
+		}
+
+		last, ok := pulled[name]
+		switch {
+		case local == url:
+			if !ok || last != url {
+				err = db.Put(browserSyncKey(name), []byte(url))
+			}
+		case local != "" && (!ok || local != last):
+			// Created or changed locally
+			result.Skipped++
+		default:
+			if err = SaveBookmark(name, url); err != nil {
+				return
+			}
+			auditBookmarkAs(s.user(), name, local, url)
+			err = db.Put(browserSyncKey(name), []byte(url))
+			if local == "" {
+				result.Added++
+			} else {
+				result.Updated++
+			}
+		}
+		if err != nil {
+			return
+		}
+	}
+
+	for name, last := range pulled {
+		if _, ok := remote[name]; ok {
+			continue
+		}
+
+		var local string
+		if local, err = bookmarkURL(name); err != nil {
+			return
+		}
+		if local == last {
+			if err = DeleteBookmark(name); err != nil {
+				return
+			}
+			auditBookmarkAs(s.user(), name, local, "")
+			result.Removed++
+		}
+		if err = db.Delete(browserSyncKey(name)); err != nil {
+			return
+		}
+	}
+
+	return
+}
+
+// user is who changes are audited as, e.g: sync:xbrowsersync
+func (s *BrowserSyncer) user() string {
+	return "sync:" + s.connector.Name()
+}
+
+// SyncAndLog pulls the bookmarks and logs what changed (if anything)
+func (s *BrowserSyncer) SyncAndLog() error {
+	result, err := s.Sync()
+	if err != nil {
+		return err
+	}
+	if result.Added+result.Updated+result.Removed > 0 {
+		slog.Info("synced bookmarks", "browser_sync", s.connector.Name(), "result", result)
+	}
+	return nil
+}
+
+// Run pulls the bookmarks every interval until ctx is cancelled
+func (s *BrowserSyncer) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		if err := s.SyncAndLog(); err != nil {
+			slog.Error("error syncing bookmarks", "browser_sync", s.connector.Name(), "err", err)
+		}
+	}
+}
+
+// SyncBrowser pulls bookmarks from the configured browser sync service (if
+// any)
+func (s *Server) SyncBrowser() error {
+	if s.browserSync == nil {
+		return nil
+	}
+
+	if s.config.ReadOnly {
+		slog.Warn("not syncing bookmarks in read-only mode", "browser_sync", s.browserSync.connector.Name())
+		return nil
+	}
+
+	return s.browserSync.SyncAndLog()
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeConnector struct {
+	bookmarks []BrowserBookmark
+	err       error
+}
+
+func (c *fakeConnector) Name() string {
+	return "fake"
+}
+
+func (c *fakeConnector) Fetch() ([]BrowserBookmark, error) {
+	return c.bookmarks, c.err
+}
+
+func TestBrowserSyncer(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir("", "golinks")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	db, err = OpenStore(filepath.Join(dir, "test.db"))
+	assert.NoError(err)
+	defer db.Close()
+
+	connector := &fakeConnector{bookmarks: []BrowserBookmark{
+		{Title: "Go Documentation", URL: "https://golang.org/doc/"},
+		{Title: "JIRA", URL: "https://jira.example.com/", Folder: []string{"Work"}},
+		{Title: "JIRA", URL: "https://jira.example.org/", Folder: []string{"Work"}},
+		{Title: "Wiki", URL: "https://wiki.example.com/"},
+	}}
+	s := NewBrowserSyncer(connector, "/ff/", NewCounters())
+
+	// A bookmark created locally in the namespace is left alone
+	assert.NoError(SaveBookmark("ff/wiki", "https://mine.example.com/"))
+
+	result, err := s.Sync()
+	assert.NoError(err)
+	assert.Equal(BrowserSyncResult{Added: 3, Skipped: 1}, result)
+
+	for name, url := range map[string]string{
+		"ff/go-documentation": "https://golang.org/doc/",
+		"ff/work/jira":        "https://jira.example.com/",
+		"ff/work/jira-2":      "https://jira.example.org/",
+		"ff/wiki":             "https://mine.example.com/",
+	} {
+		bookmark, ok := LookupBookmark(name)
+		assert.True(ok, name)
+		assert.Equal(url, bookmark.URL(), name)
+	}
+
+	result, err = s.Sync()
+	assert.NoError(err)
+	assert.Equal(BrowserSyncResult{Skipped: 1}, result)
+
+	// Changed in the browser, changed locally and removed from the browser
+	assert.NoError(SaveBookmark("ff/work/jira-2", "https://jira.example.net/"))
+	connector.bookmarks = []BrowserBookmark{
+		{Title: "Go Documentation", URL: "https://go.dev/doc/"},
+		{Title: "Wiki", URL: "https://wiki.example.com/"},
+	}
+
+	result, err = s.Sync()
+	assert.NoError(err)
+	assert.Equal(BrowserSyncResult{Updated: 1, Removed: 1, Skipped: 1}, result)
+
+	bookmark, ok := LookupBookmark("ff/go-documentation")
+	assert.True(ok)
+	assert.Equal("https://go.dev/doc/", bookmark.URL())
+	assert.False(db.Has([]byte("bookmark_ff/work/jira")))
+	bookmark, ok = LookupBookmark("ff/work/jira-2")
+	assert.True(ok)
+	assert.Equal("https://jira.example.net/", bookmark.URL())
+
+	// Changes pulled are audited as the sync
+	audit, err := ListAudit("", 10)
+	assert.NoError(err)
+	assert.Len(audit.Entries, 5)
+	assert.Equal(EventBookmarkDeleted, audit.Entries[0].Action)
+	assert.Equal("ff/work/jira", audit.Entries[0].Name)
+	for _, entry := range audit.Entries {
+		assert.Equal("sync:fake", entry.User)
+	}
+
+	connector.err = errors.New("unavailable")
+	_, err = s.Sync()
+	assert.Error(err)
+}
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+const (
+	// MaxBulkBookmarks is the maximum number of bookmarks per bulk request
+	MaxBulkBookmarks = 1000
+
+	// MaxBulkRequestBytes is the maximum size of a bulk request body
+	MaxBulkRequestBytes = 4 << 20
+)
+
+// Outcomes of a bookmark in a bulk request
+const (
+	BulkCreated   = "created"
+	BulkUpdated   = "updated"
+	BulkUnchanged = "unchanged"
+	BulkConflict  = "conflict"
+	BulkInvalid   = "invalid"
+	BulkFailed    = "failed"
+)
+
+// BulkRequest is the body of a bulk request. The bookmarks can also be
+// POSTed as a plain array (without options).
+type BulkRequest struct {
+	Bookmarks []BookmarkRequest `json:"bookmarks"`
+
+	// Replace updates existing bookmarks instead of reporting a conflict
+	Replace bool `json:"replace"`
+
+	// DryRun reports what would happen without saving anything
+	DryRun bool `json:"dry_run"`
+}
+
+// BulkResult is the outcome of a single bookmark of a bulk request
+type BulkResult struct {
+	Index  int    `json:"index"`
+	Name   string `json:"name"`
+	URL    string `json:"url"`
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+
+	// old is the url of the bookmark before it was updated
+	old string
+}
+
+// BulkSummary is the response to a bulk request
+type BulkSummary struct {
+	DryRun    bool         `json:"dry_run"`
+	Created   int          `json:"created"`
+	Updated   int          `json:"updated"`
+	Unchanged int          `json:"unchanged"`
+	Failed    int          `json:"failed"`
+	Results   []BulkResult `json:"results"`
+}
+
+// decodeBulkRequest decodes a bulk request or a plain array of bookmarks
+func decodeBulkRequest(data []byte) (req BulkRequest, err error) {
+	if bytes.HasPrefix(bytes.TrimSpace(data), []byte("[")) {
+		err = json.Unmarshal(data, &req.Bookmarks)
+	} else {
+		err = json.Unmarshal(data, &req)
+	}
+	return
+}
+
+// SaveBookmarks saves many bookmarks at once. Each bookmark is validated and
+// saved independently so one failing doesn't prevent the others from being
+// saved. Names are case insensitive and may only appear once per request.
+func SaveBookmarks(req BulkRequest) (summary BulkSummary) {
+	summary.DryRun = req.DryRun
+	summary.Results = []BulkResult{}
+
+	seen := make(map[string]int)
+	for i, bookmark := range req.Bookmarks {
+		name := strings.ToLower(strings.Trim(bookmark.Name, "/"))
+		result := BulkResult{Index: i, Name: name, URL: bookmark.URL}
+
+		if err := ValidateBookmark(name, bookmark.URL); err != nil {
+			result.Status, result.Error = BulkInvalid, err.Error()
+		} else if j, ok := seen[name]; ok {
+			result.Status = BulkInvalid
+			result.Error = fmt.Sprintf("duplicate of bookmarks[%d]", j)
+		} else if old, err := bookmarkURL(name); err != nil {
+			result.Status, result.Error = BulkFailed, err.Error()
+		} else {
+			result.old = old
+			switch {
+			case old == bookmark.URL:
+				result.Status = BulkUnchanged
+			case old != "" && !req.Replace:
+				result.Status = BulkConflict
+				result.Error = fmt.Sprintf("bookmark %s already exists", name)
+			case old != "":
+				result.Status = BulkUpdated
+			default:
+				result.Status = BulkCreated
+			}
+
+			if !req.DryRun && (result.Status == BulkCreated || result.Status == BulkUpdated) {
+				if err := SaveBookmark(name, bookmark.URL); err != nil {
+					result.Status, result.Error = BulkFailed, err.Error()
+				}
+			}
+		}
+		if name != "" {
+			if _, ok := seen[name]; !ok {
+				seen[name] = i
+			}
+		}
+
+		switch result.Status {
+		case BulkCreated:
+			summary.Created++
+		case BulkUpdated:
+			summary.Updated++
+		case BulkUnchanged:
+			summary.Unchanged++
+		default:
+			summary.Failed++
+		}
+		summary.Results = append(summary.Results, result)
+	}
+
+	return
+}
+
+// BulkBookmarksHandler creates or updates many bookmarks at once, e.g:
+// {"bookmarks": [{"name": "g", "url": "..."}, ...], "dry_run": true}
+func (s *Server) BulkBookmarksHandler() httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+		s.counters.Inc("n_api_bookmarks_bulk")
+
+		if !s.writable(w, r) {
+			return
+		}
+
+		data, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, MaxBulkRequestBytes))
+		if err != nil {
+			WriteAPIError(w, r, http.StatusBadRequest, ErrCodeBadRequest, "error reading request body", err.Error())
+			return
+		}
+		req, err := decodeBulkRequest(data)
+		if err != nil {
+			WriteAPIError(w, r, http.StatusBadRequest, ErrCodeBadRequest, "invalid json", err.Error())
+			return
+		}
+		if len(req.Bookmarks) == 0 {
+			WriteAPIError(w, r, http.StatusBadRequest, ErrCodeBadRequest, "no bookmarks", nil)
+			return
+		}
+		if len(req.Bookmarks) > MaxBulkBookmarks {
+			WriteAPIError(
+				w, r, http.StatusBadRequest, ErrCodeBadRequest,
+				fmt.Sprintf("too many bookmarks (at most %d per request)", MaxBulkBookmarks), nil,
+			)
+			return
+		}
+
+		summary := SaveBookmarks(req)
+		s.counters.IncBy("n_api_bookmarks_bulk_saved", int64(summary.Created+summary.Updated))
+		if !req.DryRun {
+			for _, result := range summary.Results {
+				if result.Status == BulkCreated || result.Status == BulkUpdated {
+					auditBookmark(r, result.Name, result.old, result.URL)
+				}
+			}
+		}
+		WriteJSON(w, http.StatusOK, summary)
+	}
+}
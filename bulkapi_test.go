@@ -0,0 +1,104 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBulkBookmarksAPI(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir("", "golinks")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	db, err = OpenStore(filepath.Join(dir, "test.db"))
+	assert.NoError(err)
+	defer db.Close()
+
+	assert.NoError(SaveBookmark("gh", "https://github.com/%s"))
+	assert.NoError(SaveBookmark("wiki", "https://en.wikipedia.org/wiki/%s"))
+
+	s, err := NewServer(":8000", Config{})
+	assert.NoError(err)
+
+	do := func(scope, body string) (int, BulkSummary) {
+		w := httptest.NewRecorder()
+		r, _ := http.NewRequest("POST", "/api/v1/bookmarks/bulk", strings.NewReader(body))
+		authorize(r, scope)
+		s.router.ServeHTTP(w, r)
+		var summary BulkSummary
+		if w.Code == http.StatusOK {
+			assert.NoError(json.Unmarshal(w.Body.Bytes(), &summary))
+		}
+		return w.Code, summary
+	}
+	statuses := func(summary BulkSummary) (statuses []string) {
+		for _, result := range summary.Results {
+			statuses = append(statuses, result.Status)
+		}
+		return
+	}
+
+	body := `{"dry_run": true, "bookmarks": [
+		{"name": "Jira", "url": "https://jira.example.com/browse/%s"},
+		{"name": "gh", "url": "https://github.com/%s"},
+		{"name": "wiki", "url": "https://wiki.example.com/%s"},
+		{"name": "add", "url": "https://example.com/"},
+		{"name": "jira", "url": "https://jira.example.com/"}
+	]}`
+
+	code, _ := do(ScopeRead, body)
+	assert.Equal(http.StatusForbidden, code)
+
+	// Dry runs report what would happen without saving anything
+	code, summary := do(ScopeWrite, body)
+	assert.Equal(http.StatusOK, code)
+	assert.True(summary.DryRun)
+	assert.Equal([]string{BulkCreated, BulkUnchanged, BulkConflict, BulkInvalid, BulkInvalid}, statuses(summary))
+	assert.Equal("jira", summary.Results[0].Name)
+	assert.Equal(`name "add" is a command`, summary.Results[3].Error)
+	assert.Equal("duplicate of bookmarks[0]", summary.Results[4].Error)
+	assert.Equal(1, summary.Created)
+	assert.Equal(1, summary.Unchanged)
+	assert.Equal(3, summary.Failed)
+	_, ok := LookupBookmark("jira")
+	assert.False(ok)
+
+	// Valid bookmarks are saved even if others fail
+	code, summary = do(ScopeWrite, strings.Replace(body, `"dry_run": true`, `"replace": true`, 1))
+	assert.Equal(http.StatusOK, code)
+	assert.False(summary.DryRun)
+	assert.Equal([]string{BulkCreated, BulkUnchanged, BulkUpdated, BulkInvalid, BulkInvalid}, statuses(summary))
+	bookmark, ok := LookupBookmark("jira")
+	assert.True(ok)
+	assert.Equal("https://jira.example.com/browse/%s", bookmark.URL())
+	bookmark, _ = LookupBookmark("wiki")
+	assert.Equal("https://wiki.example.com/%s", bookmark.URL())
+
+	// A plain array of bookmarks
+	code, summary = do(ScopeWrite, `[{"name": "g", "url": "https://www.google.com/search?q=%s"}]`)
+	assert.Equal(http.StatusOK, code)
+	assert.Equal(1, summary.Created)
+
+	for _, body := range []string{`[]`, `{"bookmarks": 1}`, `[{`} {
+		code, _ = do(ScopeWrite, body)
+		assert.Equal(http.StatusBadRequest, code, body)
+	}
+
+	var many []string
+	for i := 0; i <= MaxBulkBookmarks; i++ {
+		many = append(many, fmt.Sprintf(`{"name": "b%d", "url": "https://example.com/%d"}`, i, i))
+	}
+	code, _ = do(ScopeWrite, "["+strings.Join(many, ",")+"]")
+	assert.Equal(http.StatusBadRequest, code)
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultCatalogTTL is how long names resolved from the catalog (or not
+	// found in it) are cached for
+	DefaultCatalogTTL = time.Hour
+
+	// MaxCatalogCacheEntries is the maximum number of names cached from the
+	// catalog
+	MaxCatalogCacheEntries = 10000
+)
+
+type catalogEntry struct {
+	res     Resolution
+	ok      bool
+	expires time.Time
+}
+
+// Catalog resolves names not found locally (or by peers) from a remote,
+// read-only catalog: any golinks instance serving /api/v1/resolve. Unlike
+// peers, results (including misses) are cached for a while so personal
+// instances can lean on a shared catalog without asking it on every query.
+// Errors aren't cached.
+type Catalog struct {
+	url      string
+	ttl      time.Duration
+	client   *http.Client
+	counters *Counters
+
+	mu    sync.Mutex
+	cache map[string]catalogEntry
+}
+
+// ParseCatalogURL ...
+func ParseCatalogURL(s string) (string, error) {
+	s = strings.TrimRight(strings.TrimSpace(s), "/")
+	u, err := url.Parse(s)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return "", fmt.Errorf("invalid catalog url %q", s)
+	}
+	return s, nil
+}
+
+// NewCatalog ...
+func NewCatalog(url string, ttl, timeout time.Duration, counters *Counters) *Catalog {
+	return &Catalog{
+		url: url,
+		ttl: ttl,
+		client: &http.Client{
+			Timeout:   timeout,
+			Transport: client.Transport,
+		},
+		counters: counters,
+		cache:    make(map[string]catalogEntry),
+	}
+}
+
+// URL ...
+func (c *Catalog) URL() string {
+	return c.url
+}
+
+func (c *Catalog) cached(name string, now time.Time) (catalogEntry, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry, ok := c.cache[name]
+	if ok && now.After(entry.expires) {
+		delete(c.cache, name)
+		return entry, false
+	}
+	return entry, ok
+}
+
+func (c *Catalog) store(name string, entry catalogEntry, now time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if len(c.cache) >= MaxCatalogCacheEntries {
+		for name, entry := range c.cache {
+			if now.After(entry.expires) {
+				delete(c.cache, name)
+			}
+		}
+	}
+	if len(c.cache) >= MaxCatalogCacheEntries {
+		c.cache = make(map[string]catalogEntry)
+	}
+	c.cache[name] = entry
+}
+
+// Resolve resolves the name from the cache or else the catalog
+func (c *Catalog) Resolve(name string) (Resolution, bool) {
+	name = strings.ToLower(name)
+	now := time.Now()
+
+	if entry, ok := c.cached(name, now); ok {
+		c.counters.Inc("n_catalog_cached")
+		return entry.res, entry.ok
+	}
+
+	res, ok, err := resolveRemote(c.client, c.url, name)
+	if err != nil {
+		c.counters.Inc("n_catalog_error")
+		slog.Error("error resolving from catalog", "name", name, "catalog", c.url, "err", err)
+		return Resolution{}, false
+	}
+	if ok {
+		c.counters.Inc("n_catalog_hit")
+	} else {
+		c.counters.Inc("n_catalog_miss")
+	}
+
+	c.store(name, catalogEntry{res: res, ok: ok, expires: now.Add(c.ttl)}, now)
+	return res, ok
+}
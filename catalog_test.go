@@ -0,0 +1,105 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseCatalogURL(t *testing.T) {
+	assert := assert.New(t)
+
+	url, err := ParseCatalogURL(" https://go.example.com/ ")
+	assert.NoError(err)
+	assert.Equal("https://go.example.com", url)
+
+	_, err = ParseCatalogURL("go.example.com")
+	assert.Error(err)
+}
+
+func TestCatalog(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir("", "golinks")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	db, err = OpenStore(filepath.Join(dir, "test.db"))
+	assert.NoError(err)
+	defer db.Close()
+
+	assert.NoError(SaveBookmark("local", "https://local.example.com/%s"))
+
+	var queried []string
+	failing := false
+	catalog := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		name := r.URL.Query().Get("name")
+		queried = append(queried, name)
+		switch {
+		case failing:
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		case name == "wiki":
+			WriteJSON(w, http.StatusOK, Resolution{Name: "wiki", URL: "https://wiki.example.com/?q=%s"})
+		default:
+			WriteAPIError(w, r, http.StatusNotFound, ErrCodeNotFound, "not found", nil)
+		}
+	}))
+	defer catalog.Close()
+
+	s, err := NewServer(":8000", Config{Catalog: catalog.URL, CatalogTTL: time.Hour})
+	assert.NoError(err)
+
+	get := func(path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r, _ := http.NewRequest("GET", path, nil)
+		s.router.ServeHTTP(w, r)
+		return w
+	}
+
+	// Names not found locally are redirected via the catalog
+	w := get("/?q=wiki+golinks")
+	assert.Equal(http.StatusFound, w.Code)
+	assert.Equal("https://wiki.example.com/?q=golinks", w.Header().Get("Location"))
+
+	// and cached, as are misses
+	w = get("/api/v1/resolve?name=WIKI")
+	assert.Equal(http.StatusOK, w.Code)
+	var res Resolution
+	assert.NoError(json.Unmarshal(w.Body.Bytes(), &res))
+	assert.Equal(Resolution{Name: "wiki", URL: "https://wiki.example.com/?q=%s", Peer: catalog.URL}, res)
+
+	get("/api/v1/resolve?name=missing")
+	w = get("/api/v1/resolve?name=missing")
+	assert.Equal(http.StatusNotFound, w.Code)
+
+	get("/?q=local")
+	assert.Equal([]string{"wiki", "missing"}, queried)
+
+	// Errors are not cached
+	failing = true
+	_, ok := s.catalog.Resolve("other")
+	assert.False(ok)
+	_, ok = s.catalog.Resolve("other")
+	assert.False(ok)
+	assert.Equal([]string{"wiki", "missing", "other", "other"}, queried)
+
+	// Expired entries are resolved again
+	s.catalog.mu.Lock()
+	entry := s.catalog.cache["wiki"]
+	entry.expires = time.Now().Add(-time.Second)
+	s.catalog.cache["wiki"] = entry
+	s.catalog.mu.Unlock()
+	_, ok = s.catalog.Resolve("wiki")
+	assert.False(ok)
+	assert.Len(queried, 5)
+
+	_, err = NewServer(":8000", Config{Offline: true, Catalog: catalog.URL})
+	assert.Error(err)
+}
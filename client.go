@@ -0,0 +1,284 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/namsral/flag"
+)
+
+const (
+	// DefaultClientConfig is the config file of the client in the home directory
+	DefaultClientConfig = ".golinks"
+
+	// MaxClientResponseBytes is the maximum size of an API response
+	MaxClientResponseBytes = 16 << 20
+)
+
+var clientUsage = errors.New(`usage: golinks client [options] <command> [arguments]
+
+commands:
+  add <name> <url>      add a bookmark (-replace to update an existing one)
+  rm <name>...          remove bookmarks
+  ls                    list bookmarks
+  search <text>         list bookmarks whose name or url contain text
+  history               show the most recent queries (-n to show more)
+  names                 list bookmark and command names (-bookmarks for just bookmarks)
+  completion <shell>    print the completion script for bash, zsh or fish`)
+
+// ClientError is an error response of the API
+type ClientError struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *ClientError) Error() string {
+	return e.Message
+}
+
+// Client is a minimal client of the golinks REST API
+type Client struct {
+	baseURL string
+	token   string
+}
+
+// NewClient ...
+func NewClient(baseURL, token string) *Client {
+	return &Client{baseURL: strings.TrimRight(baseURL, "/"), token: token}
+}
+
+func (c *Client) do(method, path string, body, v interface{}) error {
+	var r io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		r = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequest(method, c.baseURL+path, r)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	res, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	data, err := ioutil.ReadAll(io.LimitReader(res.Body, MaxClientResponseBytes))
+	if err != nil {
+		return err
+	}
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		msg := res.Status
+		var apiErr APIErrorResponse
+		if json.Unmarshal(data, &apiErr) == nil && apiErr.Error.Message != "" {
+			msg = apiErr.Error.Message
+		}
+		return &ClientError{
+			StatusCode: res.StatusCode,
+			Message:    fmt.Sprintf("%s %s: %s", method, path, msg),
+		}
+	}
+
+	if v == nil || res.StatusCode == http.StatusNoContent {
+		return nil
+	}
+	return json.Unmarshal(data, v)
+}
+
+// AddBookmark creates a bookmark. If it already exists it is updated if
+// replace is true.
+func (c *Client) AddBookmark(name, url string, replace bool) error {
+	err := c.do("POST", "/api/v1/bookmarks", BookmarkRequest{Name: name, URL: url}, nil)
+	if e, ok := err.(*ClientError); ok && replace && e.StatusCode == http.StatusConflict {
+		return c.do("PUT", "/api/v1/bookmarks/"+name, BookmarkRequest{URL: url}, nil)
+	}
+	return err
+}
+
+// DeleteBookmark ...
+func (c *Client) DeleteBookmark(name string) error {
+	return c.do("DELETE", "/api/v1/bookmarks/"+name, nil, nil)
+}
+
+// ListBookmarks returns all bookmarks sorted by name
+func (c *Client) ListBookmarks() ([]BookmarkRequest, error) {
+	var res struct {
+		Bookmarks []BookmarkRequest `json:"bookmarks"`
+	}
+	if err := c.do("GET", "/api/v1/bookmarks", nil, &res); err != nil {
+		return nil, err
+	}
+	sort.Slice(res.Bookmarks, func(i, j int) bool {
+		return res.Bookmarks[i].Name < res.Bookmarks[j].Name
+	})
+	return res.Bookmarks, nil
+}
+
+// SearchBookmarks returns the bookmarks whose name or url contain text
+// (case insensitive)
+func (c *Client) SearchBookmarks(text string) ([]BookmarkRequest, error) {
+	bookmarks, err := c.ListBookmarks()
+	if err != nil {
+		return nil, err
+	}
+
+	var matches []BookmarkRequest
+	for _, bookmark := range bookmarks {
+		if contains(bookmark.Name, text) || contains(bookmark.URL, text) {
+			matches = append(matches, bookmark)
+		}
+	}
+	return matches, nil
+}
+
+// History returns up to limit of the most recent queries
+func (c *Client) History(limit int) ([]HistoryEntry, error) {
+	var page HistoryPage
+	path := "/history?" + url.Values{"limit": {strconv.Itoa(limit)}}.Encode()
+	if err := c.do("GET", path, nil, &page); err != nil {
+		return nil, err
+	}
+	return page.Entries, nil
+}
+
+// clientCommand runs a client command, writing its output to w
+func clientCommand(c *Client, w io.Writer, args []string) error {
+	if len(args) == 0 {
+		return clientUsage
+	}
+
+	var (
+		replace       bool
+		limit         int
+		bookmarksOnly bool
+	)
+	fs := flag.NewFlagSet("client "+args[0], flag.ContinueOnError)
+	fs.SetOutput(ioutil.Discard)
+	switch args[0] {
+	case "add":
+		fs.BoolVar(&replace, "replace", false, "update the bookmark if it already exists")
+	case "history":
+		fs.IntVar(&limit, "n", 20, "number of queries to show")
+	case "names":
+		fs.BoolVar(&bookmarksOnly, "bookmarks", false, "only list bookmark names")
+	}
+	if err := fs.Parse(args[1:]); err != nil {
+		return err
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	list := func(bookmarks []BookmarkRequest, err error) error {
+		if err != nil {
+			return err
+		}
+		for _, bookmark := range bookmarks {
+			fmt.Fprintf(tw, "%s\t%s\n", bookmark.Name, bookmark.URL)
+		}
+		return tw.Flush()
+	}
+
+	switch {
+	case args[0] == "add" && fs.NArg() == 2:
+		return c.AddBookmark(fs.Arg(0), fs.Arg(1), replace)
+	case args[0] == "rm" && fs.NArg() > 0:
+		for _, name := range fs.Args() {
+			if err := c.DeleteBookmark(name); err != nil {
+				return err
+			}
+		}
+		return nil
+	case args[0] == "ls" && fs.NArg() == 0:
+		return list(c.ListBookmarks())
+	case args[0] == "search" && fs.NArg() > 0:
+		return list(c.SearchBookmarks(strings.Join(fs.Args(), " ")))
+	case args[0] == "history" && fs.NArg() == 0:
+		entries, err := c.History(limit)
+		if err != nil {
+			return err
+		}
+		// Oldest first so the most recent queries are nearest the prompt
+		for i := len(entries) - 1; i >= 0; i-- {
+			entry := entries[i]
+			fmt.Fprintf(tw, "%s\t%s\t%s\n", entry.Time.Local().Format("2006-01-02 15:04:05"), entry.Query, entry.URL)
+		}
+		return tw.Flush()
+	case args[0] == "names" && fs.NArg() == 0:
+		names, err := c.Names(bookmarksOnly)
+		if err != nil {
+			return err
+		}
+		for _, name := range names {
+			fmt.Fprintln(w, name)
+		}
+		return nil
+	case args[0] == "completion" && fs.NArg() == 1:
+		return WriteCompletion(w, fs.Arg(0))
+	}
+	return clientUsage
+}
+
+// runClient runs the companion client of a golinks server. The server and
+// token are read from flags, the environment (GOLINKS_SERVER and
+// GOLINKS_TOKEN) or ~/.golinks, which supports profiles like -config.
+func runClient(args []string) error {
+	var server, token, config, profile string
+
+	fs := flag.NewFlagSetWithEnvPrefix("client", "GOLINKS", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, clientUsage)
+		fmt.Fprintln(os.Stderr, "\noptions:")
+		fs.PrintDefaults()
+	}
+	fs.StringVar(&server, "server", "http://localhost:8000", "url of the golinks server")
+	fs.StringVar(&token, "token", "", "API token (see golinks tokens)")
+	fs.StringVar(&config, "config", "", "client config file (default ~/.golinks if it exists)")
+	fs.StringVar(&profile, "profile", "", "profile of the client config file to use")
+
+	// The config file is parsed below to support profiles
+	flag.DefaultConfigFlagname = ""
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if config == "" {
+		if home, err := os.UserHomeDir(); err == nil {
+			path := filepath.Join(home, DefaultClientConfig)
+			if _, err := os.Stat(path); err == nil {
+				config = path
+			}
+		}
+	}
+	if config != "" {
+		if err := ParseConfigFile(fs, config, profile); err != nil {
+			return fmt.Errorf("error parsing client config: %s", err)
+		}
+	} else if profile != "" {
+		return errors.New("-profile requires a client config file")
+	}
+
+	return clientCommand(NewClient(server, token), os.Stdout, fs.Args())
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClient(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir("", "golinks")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	db, err = OpenStore(filepath.Join(dir, "test.db"))
+	assert.NoError(err)
+	defer db.Close()
+
+	_, secret, err := CreateToken("cli", []string{ScopeRead, ScopeWrite})
+	assert.NoError(err)
+
+	s, err := NewServer(":8000", Config{})
+	assert.NoError(err)
+	ts := httptest.NewServer(s.router)
+	defer ts.Close()
+
+	c := NewClient(ts.URL+"/", secret)
+	run := func(args ...string) (string, error) {
+		var buf bytes.Buffer
+		err := clientCommand(c, &buf, args)
+		return buf.String(), err
+	}
+
+	_, err = run("add", "gh", "https://github.com/%s")
+	assert.NoError(err)
+	_, err = run("add", "wiki", "https://en.wikipedia.org/wiki/%s")
+	assert.NoError(err)
+
+	_, err = run("add", "gh", "https://gitlab.com/%s")
+	assert.EqualError(err, "POST /api/v1/bookmarks: bookmark gh already exists")
+	_, err = run("add", "-replace", "gh", "https://gitlab.com/%s")
+	assert.NoError(err)
+
+	out, err := run("ls")
+	assert.NoError(err)
+	assert.Equal("gh    https://gitlab.com/%s\nwiki  https://en.wikipedia.org/wiki/%s\n", out)
+
+	out, err = run("search", "WIKIPEDIA")
+	assert.NoError(err)
+	assert.Equal("wiki  https://en.wikipedia.org/wiki/%s\n", out)
+
+	_, err = run("rm", "wiki")
+	assert.NoError(err)
+	err = c.DeleteBookmark("wiki")
+	assert.IsType(&ClientError{}, err)
+	assert.Equal(http.StatusNotFound, err.(*ClientError).StatusCode)
+
+	_, err = AddHistory(HistoryEntry{Time: time.Now(), Query: "gh golinks", Name: "gh", URL: "https://gitlab.com/golinks"})
+	assert.NoError(err)
+	out, err = run("history", "-n", "5")
+	assert.NoError(err)
+	assert.Contains(out, "gh golinks  https://gitlab.com/golinks\n")
+
+	for _, args := range [][]string{{}, {"ls", "extra"}, {"add", "gh"}, {"nope"}} {
+		_, err = run(args...)
+		assert.Equal(clientUsage, err, args)
+	}
+
+	err = clientCommand(NewClient(ts.URL, ""), ioutil.Discard, []string{"ls"})
+	assert.Error(err)
+	assert.Equal(http.StatusUnauthorized, err.(*ClientError).StatusCode)
+}
@@ -2,7 +2,7 @@ package main
 
 import (
 	"fmt"
-	"log"
+	"log/slog"
 	"net/http"
 	"strings"
 	"time"
@@ -12,6 +12,10 @@ import (
 type Command interface {
 	Name() string
 	Desc() string
+
+	// Exec executes the command with the args of a request. Commands
+	// answering with data (e.g: date) answer in the language and time
+	// zone of the request's CommandContext (see RequestCommandContext).
 	Exec(w http.ResponseWriter, r *http.Request, args []string) error
 }
 
@@ -26,6 +30,8 @@ func init() {
 	RegisterCommand("time", Time{})
 	RegisterCommand("add", Add{})
 	RegisterCommand("remove", Remove{})
+	RegisterCommand("save", Save{})
+	RegisterCommand("reading", Reading{})
 }
 
 // RegisterCommand ...
@@ -121,13 +127,16 @@ func (p Date) Name() string {
 func (p Date) Desc() string {
 	return `date
 
-	Display the current date and time
+	Display the current date and time, in GMT unless given a time zone
+	(e.g: /?q=date&tz=Europe/Berlin) and in your browser's language (or
+	&lang=de)
 	`
 }
 
 // Exec ...
 func (p Date) Exec(w http.ResponseWriter, r *http.Request, args []string) error {
-	w.Write([]byte(time.Now().Format(http.TimeFormat)))
+	ctx := RequestCommandContext(r)
+	writeLocalized(w, ctx, ctx.FormatDate(time.Now()))
 	return nil
 }
 
@@ -143,13 +152,15 @@ func (p Time) Name() string {
 func (p Time) Desc() string {
 	return `time
 
-	Display the current time
+	Display the current time, of the server unless given a time zone
+	(e.g: /?q=time&tz=America/New_York)
 	`
 }
 
 // Exec ...
 func (p Time) Exec(w http.ResponseWriter, r *http.Request, args []string) error {
-	w.Write([]byte(time.Now().Format("15:04:05")))
+	ctx := RequestCommandContext(r)
+	writeLocalized(w, ctx, ctx.FormatTime(time.Now()))
 	return nil
 }
 
@@ -172,6 +183,9 @@ func (p Add) Desc() string {
 
 	Will add a new command called 'g' which will redirect to Google's search
 	passing in arguments as '%s'
+
+	In multi-user mode, ~name adds a personal bookmark and @team/name one
+	of your team, looked up before the global bookmarks.
 	`
 }
 
@@ -185,13 +199,22 @@ func (p Add) Exec(w http.ResponseWriter, r *http.Request, args []string) error {
 		return fmt.Errorf("expected 2 arguments got %d", len(args))
 	}
 
-	key := []byte(fmt.Sprintf("bookmark_%s", name))
-	val := []byte(url)
-
-	if err := db.Put(key, val); err != nil {
-		log.Printf("put key failed: %s", err)
+	old := scopedURL(r, name)
+	scoped, err := SaveScopedBookmark(r, name, url)
+	if err != nil {
 		return err
 	}
+	if !scoped {
+		if err := SaveBookmark(name, url); err != nil {
+			slog.Error("put key failed", "err", err)
+			return err
+		}
+		if err := ClaimBookmark(name, RequestUser(r)); err != nil {
+			slog.Error("put key failed", "err", err)
+			return err
+		}
+	}
+	auditBookmark(r, name, old, url)
 
 	w.Write([]byte("OK"))
 
@@ -228,11 +251,18 @@ func (p Remove) Exec(w http.ResponseWriter, r *http.Request, args []string) erro
 		return fmt.Errorf("expected 1 arguments got %d", len(args))
 	}
 
-	key := []byte(fmt.Sprintf("bookmark_%s", name))
-	if err := db.Delete(key); err != nil {
-		log.Printf("delete key failed: %s", err)
+	old := scopedURL(r, name)
+	scoped, err := DeleteScopedBookmark(r, name)
+	if err != nil {
 		return err
 	}
+	if !scoped {
+		if err := DeleteBookmark(name); err != nil {
+			slog.Error("delete key failed", "err", err)
+			return err
+		}
+	}
+	auditBookmark(r, name, old, "")
 
 	w.Write([]byte("OK"))
 
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/rcrowley/go-metrics"
+)
+
+// CommandInfo describes a registered command for external UIs and CLIs,
+// e.g: to render help or autocomplete arguments
+type CommandInfo struct {
+	Name        string   `json:"name"`
+	Description string   `json:"description"`
+	Signature   string   `json:"signature"`
+	Args        []string `json:"args"`
+	Uses        int64    `json:"uses"`
+}
+
+// SortedCommands returns all registered commands sorted by name
+func SortedCommands() []Command {
+	var names []string
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var sorted []Command
+	for _, name := range names {
+		sorted = append(sorted, commands[name])
+	}
+	return sorted
+}
+
+// DescribeCommand parses a command's description whose first line is its
+// usage (e.g: "add [name] [url]") followed by indented help text
+func DescribeCommand(command Command) CommandInfo {
+	info := CommandInfo{Name: command.Name(), Args: []string{}}
+
+	lines := strings.Split(strings.TrimSpace(command.Desc()), "\n")
+
+	usage := strings.Fields(lines[0])
+	if len(usage) > 0 && usage[0] == command.Name() {
+		usage = usage[1:]
+	}
+	info.Signature = strings.Join(usage, " ")
+	for _, arg := range usage {
+		info.Args = append(info.Args, strings.Trim(arg, "[]<>"))
+	}
+
+	var text []string
+	for _, line := range lines[1:] {
+		text = append(text, strings.TrimSpace(line))
+	}
+	info.Description = strings.TrimSpace(strings.Join(text, "\n"))
+
+	return info
+}
+
+// commandCounter is the name of the counter of uses of a command
+func commandCounter(name string) string {
+	return fmt.Sprintf("n_command_%s", name)
+}
+
+// describeCommand describes a command with how many times it was used since
+// startup
+func (s *Server) describeCommand(command Command) CommandInfo {
+	info := DescribeCommand(command)
+	if counter, ok := s.counters.r.Get(commandCounter(info.Name)).(metrics.Counter); ok {
+		info.Uses = counter.Count()
+	}
+	return info
+}
+
+// CommandsHandler lists all registered commands with their description,
+// arguments and how many times each was used since startup
+func (s *Server) CommandsHandler() httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+		s.counters.Inc("n_commands")
+
+		infos := []CommandInfo{}
+		for _, command := range s.enabledCommands() {
+			infos = append(infos, s.describeCommand(command))
+		}
+
+		WriteJSON(w, http.StatusOK, map[string]interface{}{"commands": infos})
+	}
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDescribeCommand(t *testing.T) {
+	assert := assert.New(t)
+
+	info := DescribeCommand(Add{})
+	assert.Equal("add", info.Name)
+	assert.Equal("[name] [url]", info.Signature)
+	assert.Equal([]string{"name", "url"}, info.Args)
+	assert.Contains(info.Description, "Adds a new bookmark")
+	assert.NotContains(info.Description, "\t")
+
+	info = DescribeCommand(Ping{})
+	assert.Equal("", info.Signature)
+	assert.Equal([]string{}, info.Args)
+	assert.Equal(`Responds with "pong <ts>" where ts is the current UNIX timestamp.`, info.Description)
+}
+
+func TestCommandsHandler(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir("", "golinks")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	db, err = OpenStore(filepath.Join(dir, "test.db"))
+	assert.NoError(err)
+	defer db.Close()
+
+	s, err := NewServer(":8000", Config{})
+	assert.NoError(err)
+
+	for i := 0; i < 2; i++ {
+		w := httptest.NewRecorder()
+		r, _ := http.NewRequest("GET", "/?q=ping", nil)
+		s.router.ServeHTTP(w, r)
+		assert.Equal(http.StatusOK, w.Code)
+	}
+
+	w := httptest.NewRecorder()
+	r, _ := http.NewRequest("GET", "/api/v1/commands", nil)
+	authorize(r, ScopeRead)
+	s.router.ServeHTTP(w, r)
+	assert.Equal(http.StatusOK, w.Code)
+	assert.Contains(w.Header().Get("Content-Type"), "application/json")
+
+	var res struct {
+		Commands []CommandInfo `json:"commands"`
+	}
+	assert.NoError(json.Unmarshal(w.Body.Bytes(), &res))
+	assert.Len(res.Commands, len(commands))
+
+	uses := make(map[string]int64)
+	for i, info := range res.Commands {
+		if i > 0 {
+			assert.True(res.Commands[i-1].Name < info.Name, "sorted by name")
+		}
+		uses[info.Name] = info.Uses
+	}
+	assert.Equal(int64(2), uses["ping"])
+	assert.Equal(int64(0), uses["add"])
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// ErrMergeNotSupported is returned when the store cannot be compacted
+var ErrMergeNotSupported = errors.New("error: store does not support merging")
+
+// Merger is implemented by stores that can reclaim space used by stale
+// (overwritten or deleted) values, e.g: bitcask
+type Merger interface {
+	Merge() error
+}
+
+// Datafile ...
+type Datafile struct {
+	Name string `json:"name"`
+	Size int64  `json:"size"`
+}
+
+// DBStats ...
+type DBStats struct {
+	Path      string     `json:"path"`
+	Keys      int        `json:"keys"`
+	Datafiles []Datafile `json:"datafiles"`
+	TotalSize int64      `json:"total_size"`
+
+	LastMerge         time.Time `json:"last_merge"`
+	LastMergeDuration string    `json:"last_merge_duration"`
+	LastMergeError    string    `json:"last_merge_error,omitempty"`
+}
+
+// Compactor periodically merges the store's datafiles. History writes and
+// overwritten bookmarks otherwise cause datafiles to grow forever.
+type Compactor struct {
+	sync.RWMutex
+
+	uri      string
+	counters *Counters
+
+	lastMerge         time.Time
+	lastMergeDuration time.Duration
+	lastMergeError    error
+}
+
+// NewCompactor ...
+func NewCompactor(uri string, counters *Counters) *Compactor {
+	return &Compactor{uri: uri, counters: counters}
+}
+
+// Merge merges the store's datafiles if the store supports it
+func (c *Compactor) Merge() error {
+	merger, ok := db.(Merger)
+	if !ok {
+		return ErrMergeNotSupported
+	}
+
+	t0 := time.Now()
+	err := merger.Merge()
+
+	c.Lock()
+	defer c.Unlock()
+
+	c.lastMerge = t0
+	c.lastMergeDuration = time.Since(t0)
+	c.lastMergeError = err
+
+	if err != nil {
+		c.counters.Inc("n_merge_failed")
+	} else {
+		c.counters.Inc("n_merge")
+	}
+
+	return err
+}
+
+// Stats returns the current size of the store's datafiles and the result
+// of the last merge.
+func (c *Compactor) Stats() (stats DBStats, err error) {
+	_, path := ParseStoreURI(c.uri)
+
+	stats.Path = path
+	if db != nil {
+		stats.Keys = db.Len()
+	}
+
+	err = filepath.Walk(path, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.Mode().IsRegular() {
+			name, _ := filepath.Rel(path, p)
+			stats.Datafiles = append(stats.Datafiles, Datafile{name, info.Size()})
+			stats.TotalSize += info.Size()
+		}
+		return nil
+	})
+	if err != nil && !os.IsNotExist(err) {
+		return
+	}
+	err = nil
+
+	sort.Slice(stats.Datafiles, func(i, j int) bool {
+		return stats.Datafiles[i].Name < stats.Datafiles[j].Name
+	})
+
+	c.RLock()
+	defer c.RUnlock()
+
+	stats.LastMerge = c.lastMerge
+	stats.LastMergeDuration = c.lastMergeDuration.String()
+	if c.lastMergeError != nil {
+		stats.LastMergeError = c.lastMergeError.Error()
+	}
+
+	return
+}
+
+// Run merges the store every interval until ctx is cancelled
+func (c *Compactor) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		if err := c.Merge(); err != nil {
+			slog.Error("error merging store", "err", err)
+		}
+	}
+}
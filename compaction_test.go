@@ -0,0 +1,86 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/stretchr/testify/assert"
+)
+
+type nonMergingStore struct {
+	Store
+}
+
+func TestCompactorMerge(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir("", "golinks")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "test.db")
+	db, err = OpenStore(path)
+	assert.NoError(err)
+	defer db.Close()
+
+	assert.NoError(db.Put([]byte("bookmark_g"), []byte("https://google.com")))
+
+	c := NewCompactor(path, NewCounters())
+	assert.NoError(c.Merge())
+
+	stats, err := c.Stats()
+	assert.NoError(err)
+	assert.Equal(path, stats.Path)
+	assert.Equal(1, stats.Keys)
+	assert.False(stats.LastMerge.IsZero())
+	assert.Empty(stats.LastMergeError)
+}
+
+func TestCompactorMergeNotSupported(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir("", "golinks")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	store, err := OpenStore(filepath.Join(dir, "test.db"))
+	assert.NoError(err)
+	defer store.Close()
+
+	db = nonMergingStore{store}
+
+	c := NewCompactor(filepath.Join(dir, "test.db"), NewCounters())
+	assert.Equal(ErrMergeNotSupported, c.Merge())
+}
+
+func TestDBHandler(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir("", "golinks")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "test.db")
+	db, err = OpenStore(path)
+	assert.NoError(err)
+	defer db.Close()
+
+	s, err := NewServer(":8000", Config{DBPath: path})
+	assert.NoError(err)
+
+	w := httptest.NewRecorder()
+	r, _ := http.NewRequest("GET", "/debug/db", nil)
+
+	s.DBHandler()(w, r, httprouter.Params{})
+	assert.Equal(http.StatusOK, w.Code)
+
+	var stats DBStats
+	assert.NoError(json.Unmarshal(w.Body.Bytes(), &stats))
+	assert.Equal(path, stats.Path)
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// ClientCommands are the commands of the client (see clientCommand)
+var ClientCommands = []string{"add", "rm", "ls", "search", "history", "names", "completion"}
+
+const bashCompletion = `# bash completion for golinks
+# eval "$(golinks client completion bash)"
+_golinks() {
+	local cur=${COMP_WORDS[COMP_CWORD]}
+	if (( COMP_CWORD == 1 )); then
+		COMPREPLY=($(compgen -W "%[1]s" -- "$cur"))
+		return
+	fi
+	[[ ${COMP_WORDS[1]} == client ]] || return
+	if (( COMP_CWORD == 2 )); then
+		COMPREPLY=($(compgen -W "%[2]s" -- "$cur"))
+		return
+	fi
+	case ${COMP_WORDS[2]} in
+	rm) COMPREPLY=($(compgen -W "$(golinks client names -bookmarks 2>/dev/null)" -- "$cur")) ;;
+	search) COMPREPLY=($(compgen -W "$(golinks client names 2>/dev/null)" -- "$cur")) ;;
+	completion) COMPREPLY=($(compgen -W "bash zsh fish" -- "$cur")) ;;
+	esac
+}
+complete -F _golinks golinks
+`
+
+const zshCompletion = `#compdef golinks
+# source <(golinks client completion zsh)
+_golinks() {
+	if (( CURRENT == 2 )); then
+		compadd -- %[1]s
+		return
+	fi
+	[[ ${words[2]} == client ]] || return
+	if (( CURRENT == 3 )); then
+		compadd -- %[2]s
+		return
+	fi
+	case ${words[3]} in
+	rm) compadd -- ${(f)"$(golinks client names -bookmarks 2>/dev/null)"} ;;
+	search) compadd -- ${(f)"$(golinks client names 2>/dev/null)"} ;;
+	completion) compadd -- bash zsh fish ;;
+	esac
+}
+compdef _golinks golinks
+`
+
+const fishCompletion = `# fish completion for golinks
+# golinks client completion fish | source
+function __golinks_client_using
+	set -l tokens (commandline -opc)
+	test (count $tokens) -ge 3 -a "$tokens[2]" = client -a "$tokens[3]" = $argv[1]
+end
+complete -c golinks -f -n "test (count (commandline -opc)) -eq 1" -a "%[1]s"
+complete -c golinks -f -n "__fish_seen_subcommand_from client; and test (count (commandline -opc)) -eq 2" -a "%[2]s"
+complete -c golinks -f -n "__golinks_client_using rm" -a "(golinks client names -bookmarks 2>/dev/null)"
+complete -c golinks -f -n "__golinks_client_using search" -a "(golinks client names 2>/dev/null)"
+complete -c golinks -f -n "__golinks_client_using completion" -a "bash zsh fish"
+`
+
+// WriteCompletion writes the completion script of the client for shell
+// (bash, zsh or fish), which also completes the subcommands of golinks.
+// Bookmark and command names are completed by the script asking the server
+// with golinks client names.
+func WriteCompletion(w io.Writer, shell string) error {
+	var script string
+	switch shell {
+	case "bash":
+		script = bashCompletion
+	case "zsh":
+		script = zshCompletion
+	case "fish":
+		script = fishCompletion
+	default:
+		return fmt.Errorf("unsupported shell %q (expected bash, zsh or fish)", shell)
+	}
+
+	_, err := fmt.Fprintf(w, script, strings.Join(Subcommands, " "), strings.Join(ClientCommands, " "))
+	return err
+}
+
+// ListCommands returns the names of all commands of the server
+func (c *Client) ListCommands() ([]string, error) {
+	var res struct {
+		Commands []CommandInfo `json:"commands"`
+	}
+	if err := c.do("GET", "/api/v1/commands", nil, &res); err != nil {
+		return nil, err
+	}
+
+	var names []string
+	for _, command := range res.Commands {
+		names = append(names, command.Name)
+	}
+	return names, nil
+}
+
+// Names returns the names of all bookmarks (and commands unless
+// bookmarksOnly), sorted, for completion
+func (c *Client) Names(bookmarksOnly bool) ([]string, error) {
+	bookmarks, err := c.ListBookmarks()
+	if err != nil {
+		return nil, err
+	}
+
+	var names []string
+	for _, bookmark := range bookmarks {
+		names = append(names, bookmark.Name)
+	}
+	if !bookmarksOnly {
+		commands, err := c.ListCommands()
+		if err != nil {
+			return nil, err
+		}
+		names = append(names, commands...)
+	}
+	sort.Strings(names)
+	return names, nil
+}
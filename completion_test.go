@@ -0,0 +1,69 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWriteCompletion(t *testing.T) {
+	assert := assert.New(t)
+
+	for _, shell := range []string{"bash", "zsh", "fish"} {
+		var buf bytes.Buffer
+		assert.NoError(WriteCompletion(&buf, shell))
+		assert.NotContains(buf.String(), "%!", shell)
+		assert.Contains(buf.String(), strings.Join(ClientCommands, " "), shell)
+		assert.Contains(buf.String(), strings.Join(Subcommands, " "), shell)
+		assert.Contains(buf.String(), "golinks client names -bookmarks", shell)
+	}
+	assert.Error(WriteCompletion(ioutil.Discard, "powershell"))
+
+	for _, name := range Subcommands {
+		assert.NotNil(subcommand(name), name)
+	}
+}
+
+func TestClientNames(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir("", "golinks")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	db, err = OpenStore(filepath.Join(dir, "test.db"))
+	assert.NoError(err)
+	defer db.Close()
+
+	assert.NoError(SaveBookmark("gh", "https://github.com/%s"))
+	_, secret, err := CreateToken("cli", []string{ScopeRead})
+	assert.NoError(err)
+
+	s, err := NewServer(":8000", Config{})
+	assert.NoError(err)
+	ts := httptest.NewServer(s.router)
+	defer ts.Close()
+
+	c := NewClient(ts.URL, secret)
+
+	var buf bytes.Buffer
+	assert.NoError(clientCommand(c, &buf, []string{"names", "-bookmarks"}))
+	assert.Equal("gh\n", buf.String())
+
+	buf.Reset()
+	assert.NoError(clientCommand(c, &buf, []string{"names"}))
+	names := strings.Fields(buf.String())
+	assert.Contains(names, "gh")
+	assert.Contains(names, "help")
+	assert.True(len(names) > 2)
+
+	buf.Reset()
+	assert.NoError(clientCommand(c, &buf, []string{"completion", "bash"}))
+	assert.Contains(buf.String(), "complete -F _golinks golinks")
+}
@@ -1,9 +1,218 @@
 package main
 
+import (
+	"time"
+)
+
 // Config ...
 type Config struct {
 	Title      string
 	FQDN       string
 	URL        string
 	SuggestURL string
+	DBPath     string
+	AssetsDir  string
+	ReadOnly   bool
+	Offline    bool
+
+	// DisableHistory disables recording and browsing the history of queries
+	DisableHistory bool
+
+	// RollupInterval is how often the history is rolled up into daily usage
+	// and HistoryRetention how long history is kept for after that
+	RollupInterval   time.Duration
+	HistoryRetention time.Duration
+
+	// HistoryTrashTTL is how long cleared history can be restored for
+	HistoryTrashTTL time.Duration
+
+	// LearnAliases is how many times a misspelling of a bookmark is typed
+	// before it is learned as an alias of it (0 to disable)
+	LearnAliases int
+
+	BookmarksFile     string
+	BookmarksURL      string
+	BookmarksInterval time.Duration
+
+	Defaults         string
+	DefaultsInterval time.Duration
+
+	Peers       []string
+	PeerTimeout time.Duration
+
+	// Webhooks are sent bookmark events (and redirects if WebhookHits),
+	// signed with WebhookSecret
+	Webhooks      []string
+	WebhookSecret string
+	WebhookHits   bool
+
+	// EventBus is the url of a NATS or MQTT server to publish redirects and
+	// bookmark changes to, under EventBusPrefix
+	EventBus       string
+	EventBusPrefix string
+
+	// MetricsExport is the url of a StatsD server or InfluxDB database to
+	// flush metrics to every MetricsExportInterval
+	MetricsExport         string
+	MetricsExportInterval time.Duration
+
+	// MetricsTopN is how many of the most used bookmarks and commands the
+	// metrics are labeled by name (0 for all, -1 for none)
+	MetricsTopN int
+
+	// Catalog is the url of a read-only instance to resolve names not found
+	// locally or by peers from, cached for CatalogTTL
+	Catalog    string
+	CatalogTTL time.Duration
+
+	RaindropToken      string
+	RaindropCollection int64
+	RaindropInterval   time.Duration
+
+	// Browser sync pulls bookmarks from an xBrowserSync sync into
+	// BrowserNamespace every BrowserSyncInterval
+	XBrowserSyncURL      string
+	XBrowserSyncID       string
+	XBrowserSyncPassword string
+	BrowserNamespace     string
+	BrowserSyncInterval  time.Duration
+
+	// ReadLater is the read-later service (pocket, instapaper or wallabag)
+	// the save command saves pages to
+	ReadLater         string
+	ReadLaterURL      string
+	ReadLaterKey      string
+	ReadLaterUser     string
+	ReadLaterPassword string
+
+	// Bots answer "go <name> [args]" messages on Telegram and/or Matrix;
+	// BotUsers grants chat users scopes, e.g: alice=write
+	TelegramToken string
+	MatrixURL     string
+	MatrixToken   string
+	BotUsers      string
+
+	FetchConcurrency int
+	FetchHostDelay   time.Duration
+
+	// MaxConcurrent is how many requests are handled concurrently before
+	// suggestions and analytics are shed (0 to never shed)
+	MaxConcurrent int
+
+	// RateLimit is how many queries and suggestions each client ip can
+	// make a minute (0 for no limit), in bursts of up to RateLimitBurst
+	// (RateLimit if 0)
+	RateLimit      int
+	RateLimitBurst int
+
+	WriteFailureThreshold int
+	WriteFailureBackoff   time.Duration
+
+	GitRepo     string
+	GitBranch   string
+	GitPath     string
+	GitInterval time.Duration
+
+	GRPCBind string
+
+	// TLSCert and TLSKey are the PEM files of the certificate (chain) and
+	// key to serve HTTPS with rather than HTTP
+	TLSCert string
+	TLSKey  string
+
+	FallbackStatus       int
+	FallbackCacheControl string
+
+	SuggestMaxBytes int64
+	Dictionary      string
+
+	FQDNCheckInterval time.Duration
+	LinkCheckInterval time.Duration
+	MergeInterval     time.Duration
+
+	// LinkRotAfter is how long a link must stay broken before an archived
+	// copy is looked up and offered in its place
+	LinkRotAfter time.Duration
+
+	BackupURL       string
+	BackupAccessKey string
+	BackupSecretKey string
+	BackupInterval  time.Duration
+	BackupRetain    int
+
+	ReplicateTo       string
+	ReplicationSecret string
+
+	// AuthUser and AuthPass, or the users of the htpasswd AuthFile, are
+	// required to access golinks with HTTP Basic auth
+	AuthUser string
+	AuthPass string
+	AuthFile string
+
+	// OIDCIssuer is the OpenID Connect provider users log in with, as the
+	// client OIDCClientID, optionally only with an email in OIDCDomains
+	OIDCIssuer       string
+	OIDCClientID     string
+	OIDCClientSecret string
+	OIDCRedirectURL  string
+	OIDCDomains      string
+
+	// GitHubClientID logs users in with GitHub so only members of
+	// GitHubOrgs (orgs or org/team) can add or edit bookmarks
+	GitHubClientID     string
+	GitHubClientSecret string
+	GitHubRedirectURL  string
+	GitHubOrgs         string
+
+	// SessionSecret signs the session cookies of users logged in with Basic
+	// auth, OpenID Connect or GitHub (default: the client secret) and
+	// SessionTTL is how long they stay logged in for (0 for the default)
+	SessionSecret string
+	SessionTTL    time.Duration
+
+	// AuthHeader is the header a reverse proxy authenticating users sets to
+	// who they are (e.g. X-Forwarded-User), trusted only from AuthProxies
+	// (ips or CIDRs) if any
+	AuthHeader  string
+	AuthProxies string
+
+	// AllowIPs and DenyIPs (ips or CIDRs) limit the clients let in, as
+	// told by X-Forwarded-For behind the IPProxies
+	AllowIPs  string
+	DenyIPs   string
+	IPProxies string
+
+	// MultiUser gives every logged in user personal bookmarks, and the
+	// members of Teams (user=team) those of their teams, looked up before
+	// the global bookmarks
+	MultiUser bool
+	Teams     string
+
+	// EmailSecret enables creating bookmarks by email at /inbound/email,
+	// optionally only from EmailSenders
+	EmailSecret  string
+	EmailSenders string
+
+	// PublishTag publishes bookmarks tagged with it as an RSS feed and an
+	// ActivityStreams outbox, and to anyone at /api/public/v1/bookmarks
+	// with the PublicCacheControl header
+	PublishTag         string
+	PublicCacheControl string
+
+	// LogFormat is the format of the logs (text or json), also used for
+	// the access log
+	LogFormat string
+
+	// AccessLog is a file requests are logged to instead of the
+	// application logs, rotated once over AccessLogMaxSize bytes or every
+	// AccessLogRotate, keeping AccessLogMaxBackups (optionally gzipped)
+	AccessLog           string
+	AccessLogMaxSize    int64
+	AccessLogRotate     time.Duration
+	AccessLogMaxBackups int
+	AccessLogCompress   bool
+
+	// FrameAncestors are the origins (besides golinks itself) allowed to
+	// embed the widgets, e.g: intranet portals and dashboards
+	FrameAncestors string
 }
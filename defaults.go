@@ -2,6 +2,7 @@ package main
 
 import (
 	"net/http/httptest"
+	"time"
 )
 
 const (
@@ -9,6 +10,12 @@ const (
 	DefaultURL string = "https://www.google.com/search?q=%s&btnK"
 	// DefaultSuggestURL provides search suggestions from Google
 	DefaultSuggestURL string = "https://suggestqueries.google.com/complete/search?client=firefox&q=%s"
+	// DefaultSuggestMaxBytes limits the size of upstream suggestion responses
+	DefaultSuggestMaxBytes int64 = 64 * 1024
+	// DefaultPeerTimeout is the time peers have to resolve a name
+	DefaultPeerTimeout time.Duration = time.Second
+	// DefaultGitPath is the path of the bookmarks manifest in a git repository
+	DefaultGitPath string = "bookmarks.yaml"
 )
 
 // DefaultBookmarks ...
@@ -45,5 +52,10 @@ func EnsureDefaultBookmarks() error {
 			}
 		}
 	}
-	return nil
+
+	// New databases are created with the current layout
+	if db.Has(schemaKey) {
+		return nil
+	}
+	return db.Put(schemaKey, []byte(SchemaVersion))
 }
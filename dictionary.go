@@ -0,0 +1,195 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	rice "github.com/GeertJohan/go.rice"
+)
+
+const (
+	// BuiltinDictionary is the name of the dictionary shipped with golinks
+	BuiltinDictionary = "builtin"
+
+	// MaxSuggestions is the maximum number of offline suggestions returned
+	MaxSuggestions = 10
+
+	dictionaryFile = "dictionary.txt"
+)
+
+type dictionaryWord struct {
+	word string
+	freq int
+}
+
+// Dictionary is a word frequency list used to complete search queries
+// without an upstream suggestions service (e.g: air-gapped deployments).
+type Dictionary struct {
+	words []dictionaryWord // sorted by word
+}
+
+// ParseDictionary parses a dictionary of "<word> <frequency>" lines. Blank
+// lines and lines starting with # are ignored and the frequency is optional.
+func ParseDictionary(r io.Reader) (*Dictionary, error) {
+	var (
+		words []dictionaryWord
+		line  int
+	)
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line++
+
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+
+		fields := strings.Fields(text)
+		if len(fields) > 2 {
+			return nil, fmt.Errorf("invalid dictionary entry on line %d: %q", line, text)
+		}
+
+		word := dictionaryWord{word: strings.ToLower(fields[0]), freq: 1}
+		if len(fields) == 2 {
+			freq, err := strconv.Atoi(fields[1])
+			if err != nil {
+				return nil, fmt.Errorf("invalid frequency on line %d: %s", line, err)
+			}
+			word.freq = freq
+		}
+
+		words = append(words, word)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	sort.Slice(words, func(i, j int) bool {
+		return words[i].word < words[j].word
+	})
+
+	return &Dictionary{words: words}, nil
+}
+
+// LoadDictionary loads the builtin dictionary (if name is "builtin") from
+// the static assets or a dictionary file at the given path.
+func LoadDictionary(name string, assets *rice.Box) (*Dictionary, error) {
+	if name == BuiltinDictionary {
+		data, err := assets.Bytes(dictionaryFile)
+		if err != nil {
+			return nil, err
+		}
+		return ParseDictionary(bytes.NewReader(data))
+	}
+
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return ParseDictionary(f)
+}
+
+// Len returns the number of words in the dictionary
+func (d *Dictionary) Len() int {
+	return len(d.words)
+}
+
+// Complete returns up to n words starting with prefix, most frequent first
+func (d *Dictionary) Complete(prefix string, n int) []string {
+	prefix = strings.ToLower(prefix)
+	if prefix == "" {
+		return nil
+	}
+
+	i := sort.Search(len(d.words), func(i int) bool {
+		return d.words[i].word >= prefix
+	})
+
+	var matches []dictionaryWord
+	for ; i < len(d.words) && strings.HasPrefix(d.words[i].word, prefix); i++ {
+		matches = append(matches, d.words[i])
+	}
+
+	sort.SliceStable(matches, func(i, j int) bool {
+		return matches[i].freq > matches[j].freq
+	})
+
+	var completions []string
+	for _, match := range matches {
+		if len(completions) == n {
+			break
+		}
+		completions = append(completions, match.word)
+	}
+
+	return completions
+}
+
+// CompleteBookmarks returns up to n bookmark names starting with prefix
+func CompleteBookmarks(prefix string, n int) ([]string, error) {
+	var names []string
+
+	key := []byte(fmt.Sprintf("bookmark_%s", strings.ToLower(prefix)))
+	err := db.Scan(key, func(key []byte) error {
+		if len(names) < n {
+			names = append(names, strings.TrimPrefix(string(key), "bookmark_"))
+		}
+		return nil
+	})
+
+	return names, err
+}
+
+// OfflineSuggestions completes the query from local bookmarks and the
+// dictionary. Bookmarks are completed for the first word of the query only
+// (the bookmark name), dictionary words for the last word.
+func OfflineSuggestions(q string, dictionary *Dictionary) Suggestions {
+	suggestions := Suggestions{Query: q, Completions: []string{}}
+
+	seen := make(map[string]bool)
+	add := func(completion string) {
+		if !seen[completion] && len(suggestions.Completions) < MaxSuggestions {
+			seen[completion] = true
+			suggestions.Completions = append(suggestions.Completions, completion)
+		}
+	}
+
+	trimmed := strings.TrimSpace(q)
+	if trimmed == "" {
+		return suggestions
+	}
+
+	if !strings.Contains(trimmed, " ") {
+		names, err := CompleteBookmarks(trimmed, MaxSuggestions)
+		if err != nil {
+			slog.Error("error completing bookmarks", "prefix", trimmed, "err", err)
+		}
+		for _, name := range names {
+			add(name)
+		}
+	}
+
+	if dictionary != nil && !strings.HasSuffix(q, " ") {
+		var head, last string
+		if i := strings.LastIndex(q, " "); i >= 0 {
+			head, last = q[:i+1], q[i+1:]
+		} else {
+			last = q
+		}
+		for _, word := range dictionary.Complete(last, MaxSuggestions) {
+			add(strings.ToLower(head) + word)
+		}
+	}
+
+	return suggestions
+}
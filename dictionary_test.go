@@ -0,0 +1,134 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/stretchr/testify/assert"
+)
+
+const testDictionary = `# test dictionary
+foo 10
+food 50
+football 30
+fool
+bar 5
+`
+
+func TestParseDictionary(t *testing.T) {
+	assert := assert.New(t)
+
+	dictionary, err := ParseDictionary(strings.NewReader(testDictionary))
+	assert.NoError(err)
+	assert.Equal(5, dictionary.Len())
+
+	assert.Equal([]string{"food", "football", "foo", "fool"}, dictionary.Complete("Foo", 10))
+	assert.Equal([]string{"food", "football"}, dictionary.Complete("foo", 2))
+	assert.Nil(dictionary.Complete("baz", 10))
+	assert.Nil(dictionary.Complete("", 10))
+
+	_, err = ParseDictionary(strings.NewReader("foo bar baz\n"))
+	assert.Error(err)
+
+	_, err = ParseDictionary(strings.NewReader("foo bar\n"))
+	assert.Error(err)
+}
+
+func TestBuiltinDictionary(t *testing.T) {
+	assert := assert.New(t)
+
+	s, err := NewServer(":8000", Config{Dictionary: BuiltinDictionary})
+	assert.NoError(err)
+	assert.NotNil(s.dictionary)
+	assert.True(s.dictionary.Len() > 1000)
+	assert.Equal([]string{"the"}, s.dictionary.Complete("the", 1))
+
+	_, err = NewServer(":8000", Config{Dictionary: "/does/not/exist"})
+	assert.Error(err)
+}
+
+func TestOfflineSuggestions(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir("", "golinks")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	db, err = OpenStore(filepath.Join(dir, "test.db"))
+	assert.NoError(err)
+	defer db.Close()
+
+	assert.NoError(SaveBookmark("fo", "https://fo.com"))
+	assert.NoError(SaveBookmark("foobar", "https://foobar.com"))
+
+	dictionary, err := ParseDictionary(strings.NewReader(testDictionary))
+	assert.NoError(err)
+
+	assert.Equal(
+		[]string{"fo", "foobar", "food", "football", "foo", "fool"},
+		OfflineSuggestions("fo", dictionary).Completions,
+	)
+	assert.Equal(
+		[]string{"bar food", "bar football", "bar foo", "bar fool"},
+		OfflineSuggestions("bar fo", dictionary).Completions,
+	)
+	assert.Equal([]string{}, OfflineSuggestions("bar ", dictionary).Completions)
+	assert.Equal([]string{}, OfflineSuggestions("", dictionary).Completions)
+}
+
+func TestSuggestionsOfflineFallback(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir("", "golinks")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	db, err = OpenStore(filepath.Join(dir, "test.db"))
+	assert.NoError(err)
+	defer db.Close()
+
+	assert.NoError(SaveBookmark("go", "https://golang.org"))
+
+	f, err := ioutil.TempFile(dir, "dictionary")
+	assert.NoError(err)
+	f.WriteString(testDictionary)
+	f.Close()
+
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "oops", http.StatusServiceUnavailable)
+	}))
+	defer upstream.Close()
+
+	s, err := NewServer(":8000", Config{
+		SuggestURL: upstream.URL + "/?q=%s",
+		Dictionary: f.Name(),
+	})
+	assert.NoError(err)
+
+	w := httptest.NewRecorder()
+	r, _ := http.NewRequest("GET", "/suggest?q=foo", nil)
+	s.SuggestionsHandler()(w, r, httprouter.Params{})
+	assert.Equal(http.StatusOK, w.Code)
+	assert.Equal(`["foo",["food","football","foo","fool"]]`, w.Body.String())
+
+	s.config.SuggestURL = ""
+
+	w = httptest.NewRecorder()
+	r, _ = http.NewRequest("GET", "/suggest?q=g", nil)
+	s.SuggestionsHandler()(w, r, httprouter.Params{})
+	assert.Equal(http.StatusOK, w.Code)
+
+	var res []interface{}
+	assert.NoError(json.Unmarshal(w.Body.Bytes(), &res))
+	assert.Equal([]interface{}{
+		"g", []interface{}{"go"},
+		[]interface{}{"https://golang.org"}, []interface{}{"https://golang.org"},
+	}, res)
+}
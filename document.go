@@ -0,0 +1,428 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log/slog"
+	"mime"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/julienschmidt/httprouter"
+	"gopkg.in/yaml.v2"
+)
+
+// MaxDocumentBytes is the maximum size of a bookmarks document
+const MaxDocumentBytes = 16 << 20
+
+// DocumentBookmark is a bookmark of the bookmarks document
+type DocumentBookmark struct {
+	URL         string   `json:"url" yaml:"url"`
+	Aliases     []string `json:"aliases,omitempty" yaml:"aliases,omitempty"`
+	Tags        []string `json:"tags,omitempty" yaml:"tags,omitempty"`
+	Description string   `json:"description,omitempty" yaml:"description,omitempty"`
+}
+
+// equal reports whether the bookmarks are the same (aliases and tags
+// being sorted)
+func (b DocumentBookmark) equal(other DocumentBookmark) bool {
+	return b.URL == other.URL && b.Description == other.Description &&
+		equalStrings(b.Aliases, other.Aliases) && equalStrings(b.Tags, other.Tags)
+}
+
+// BookmarksDocument is the whole set of bookmarks (and the runtime
+// settings) as a single document, e.g:
+//
+//	{"bookmarks": {"gh": {"url": "https://github.com/%s", "tags": ["dev"]}},
+//	 "settings": {"url": "https://www.google.com/search?q=%s", ...}}
+//
+// served at a stable url and replaced as a whole, so bookmarks can be
+// synced with any HTTP client and an instance reproduced from one file.
+// Documents without settings leave them unchanged.
+type BookmarksDocument struct {
+	Bookmarks map[string]DocumentBookmark `json:"bookmarks" yaml:"bookmarks"`
+	Settings  *Settings                   `json:"settings,omitempty" yaml:"settings,omitempty"`
+}
+
+// DocumentDiff lists the names of the bookmarks changed by a document and
+// whether it changes the settings
+type DocumentDiff struct {
+	Created   []string `json:"created"`
+	Updated   []string `json:"updated"`
+	Removed   []string `json:"removed"`
+	Unchanged int      `json:"unchanged"`
+	Settings  bool     `json:"settings"`
+}
+
+// DocumentResult is the outcome of replacing the bookmarks document
+type DocumentResult struct {
+	DryRun bool   `json:"dry_run"`
+	ETag   string `json:"etag"`
+	DocumentDiff
+}
+
+// ETag returns the entity tag of the document: a hash of its canonical
+// JSON, so it is the same whatever format the document is served in
+func (doc BookmarksDocument) ETag() string {
+	data, _ := json.Marshal(doc)
+	sum := sha256.Sum256(data)
+	return `"` + hex.EncodeToString(sum[:16]) + `"`
+}
+
+// CurrentDocument returns the bookmarks (with their aliases, tags and
+// descriptions) as a document
+func CurrentDocument() (BookmarksDocument, error) {
+	doc := BookmarksDocument{Bookmarks: make(map[string]DocumentBookmark)}
+
+	bookmarks, err := ListBookmarks()
+	if err != nil {
+		return doc, err
+	}
+	for _, bookmark := range bookmarks {
+		b := DocumentBookmark{URL: bookmark.URL()}
+		if val, err := db.Get([]byte(fmt.Sprintf("tags_%s", bookmark.Name()))); err == nil && len(val) > 0 {
+			b.Tags = strings.Split(string(val), ",")
+		}
+		if val, err := db.Get([]byte(fmt.Sprintf("description_%s", bookmark.Name()))); err == nil {
+			b.Description = string(val)
+		}
+		doc.Bookmarks[bookmark.Name()] = b
+	}
+
+	err = db.Scan([]byte("alias_"), func(key []byte) error {
+		target, err := db.Get(key)
+		if err != nil {
+			return err
+		}
+		b, ok := doc.Bookmarks[string(target)]
+		if !ok {
+			return nil
+		}
+		b.Aliases = append(b.Aliases, strings.TrimPrefix(string(key), "alias_"))
+		sort.Strings(b.Aliases)
+		doc.Bookmarks[string(target)] = b
+		return nil
+	})
+
+	return doc, err
+}
+
+// document returns the bookmarks and the runtime settings as a document
+func (s *Server) document() (BookmarksDocument, error) {
+	doc, err := CurrentDocument()
+	settings := s.settings()
+	doc.Settings = &settings
+	return doc, err
+}
+
+// Normalize lowercases the names and aliases of the document, sorts aliases
+// and tags and returns an error if any bookmark or the settings are invalid
+// or an alias is declared twice (or is also the name of a bookmark)
+func (doc BookmarksDocument) Normalize() (BookmarksDocument, error) {
+	normalized := BookmarksDocument{Bookmarks: make(map[string]DocumentBookmark)}
+
+	if doc.Settings != nil {
+		settings, err := doc.Settings.Update().Apply(Settings{})
+		if err != nil {
+			return normalized, fmt.Errorf("settings: %s", err)
+		}
+		normalized.Settings = &settings
+	}
+
+	for name, bookmark := range doc.Bookmarks {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if _, ok := normalized.Bookmarks[name]; ok {
+			return normalized, fmt.Errorf("bookmark %q is declared twice", name)
+		}
+		if err := ValidateBookmark(name, bookmark.URL); err != nil {
+			return normalized, fmt.Errorf("bookmark %q: %s", name, err)
+		}
+
+		var aliases []string
+		for _, alias := range bookmark.Aliases {
+			aliases = append(aliases, strings.ToLower(strings.TrimSpace(alias)))
+		}
+		sort.Strings(aliases)
+		bookmark.Aliases = aliases
+
+		bookmark.Tags = append([]string(nil), bookmark.Tags...)
+		sort.Strings(bookmark.Tags)
+		for _, tag := range bookmark.Tags {
+			if tag == "" || strings.Contains(tag, ",") {
+				return normalized, fmt.Errorf("bookmark %q: invalid tag %q", name, tag)
+			}
+		}
+
+		normalized.Bookmarks[name] = bookmark
+	}
+
+	aliases := make(map[string]string)
+	for name, bookmark := range normalized.Bookmarks {
+		for _, alias := range bookmark.Aliases {
+			if err := ValidateBookmark(alias, bookmark.URL); err != nil {
+				return normalized, fmt.Errorf("alias %q of %q: %s", alias, name, err)
+			}
+			if _, ok := normalized.Bookmarks[alias]; ok {
+				return normalized, fmt.Errorf("alias %q of %q is the name of a bookmark", alias, name)
+			}
+			if other, ok := aliases[alias]; ok {
+				return normalized, fmt.Errorf("alias %q of %q is already declared by %q", alias, name, other)
+			}
+			aliases[alias] = name
+		}
+	}
+
+	return normalized, nil
+}
+
+// DiffDocuments returns the changes replacing the current document with
+// the new one makes
+func DiffDocuments(current, doc BookmarksDocument) DocumentDiff {
+	diff := DocumentDiff{Created: []string{}, Updated: []string{}, Removed: []string{}}
+
+	for name, bookmark := range doc.Bookmarks {
+		old, ok := current.Bookmarks[name]
+		switch {
+		case !ok:
+			diff.Created = append(diff.Created, name)
+		case !old.equal(bookmark):
+			diff.Updated = append(diff.Updated, name)
+		default:
+			diff.Unchanged++
+		}
+	}
+	for name := range current.Bookmarks {
+		if _, ok := doc.Bookmarks[name]; !ok {
+			diff.Removed = append(diff.Removed, name)
+		}
+	}
+
+	sort.Strings(diff.Created)
+	sort.Strings(diff.Updated)
+	sort.Strings(diff.Removed)
+
+	diff.Settings = doc.Settings != nil && (current.Settings == nil || *current.Settings != *doc.Settings)
+	return diff
+}
+
+// putOrDelete puts the value under key or deletes the key if value is empty
+func putOrDelete(key, value string) error {
+	if value == "" {
+		return db.Delete([]byte(key))
+	}
+	return db.Put([]byte(key), []byte(value))
+}
+
+// saveDocumentBookmark saves a bookmark of a document along with its
+// aliases, tags and description
+func saveDocumentBookmark(name string, old, bookmark DocumentBookmark) error {
+	if old.URL != bookmark.URL {
+		if err := SaveBookmark(name, bookmark.URL); err != nil {
+			return err
+		}
+	}
+	for _, alias := range bookmark.Aliases {
+		if err := db.Put([]byte(fmt.Sprintf("alias_%s", alias)), []byte(name)); err != nil {
+			return err
+		}
+	}
+	if err := putOrDelete(fmt.Sprintf("tags_%s", name), strings.Join(bookmark.Tags, ",")); err != nil {
+		return err
+	}
+	return putOrDelete(fmt.Sprintf("description_%s", name), bookmark.Description)
+}
+
+// removeDocumentBookmark removes a bookmark along with its tags and
+// description
+func removeDocumentBookmark(name string) error {
+	for _, key := range []string{"tags_%s", "description_%s", "managed_%s"} {
+		if err := db.Delete([]byte(fmt.Sprintf(key, name))); err != nil {
+			return err
+		}
+	}
+	return DeleteBookmark(name)
+}
+
+// ApplyDocument replaces the bookmarks with those of the (normalized)
+// document: bookmarks not in the document are removed. The settings are
+// left to the server (see UpdateSettings).
+func ApplyDocument(current, doc BookmarksDocument, diff DocumentDiff) error {
+	// Aliases can move between bookmarks so all those of changed bookmarks
+	// are removed before any are saved
+	for _, names := range [][]string{diff.Removed, diff.Created, diff.Updated} {
+		for _, name := range names {
+			for _, alias := range current.Bookmarks[name].Aliases {
+				if err := db.Delete([]byte(fmt.Sprintf("alias_%s", alias))); err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	for _, name := range diff.Removed {
+		if err := removeDocumentBookmark(name); err != nil {
+			return err
+		}
+	}
+	for _, names := range [][]string{diff.Created, diff.Updated} {
+		for _, name := range names {
+			if err := saveDocumentBookmark(name, current.Bookmarks[name], doc.Bookmarks[name]); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// DocumentHandler serves the bookmarks document in the format (json or
+// yaml) with an ETag, answering 304 Not Modified to a matching If-None-Match
+func (s *Server) DocumentHandler(format string) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+		s.counters.Inc("n_api_document")
+
+		doc, err := s.document()
+		if err != nil {
+			slog.Error("error reading bookmarks document", "err", err)
+			WriteAPIError(w, r, http.StatusInternalServerError, ErrCodeInternal, "error reading bookmarks", err.Error())
+			return
+		}
+
+		etag := doc.ETag()
+		w.Header().Set("ETag", etag)
+		w.Header().Set("Cache-Control", "no-cache")
+		if r.Header.Get("If-None-Match") == etag {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+
+		if format == "yaml" {
+			data, err := yaml.Marshal(doc)
+			if err != nil {
+				WriteAPIError(w, r, http.StatusInternalServerError, ErrCodeInternal, "error encoding bookmarks", err.Error())
+				return
+			}
+			w.Header().Set("Content-Type", "application/yaml")
+			w.Write(data)
+			return
+		}
+		WriteJSON(w, http.StatusOK, doc)
+	}
+}
+
+// decodeDocument decodes a JSON or YAML document, rejecting unknown fields
+func decodeDocument(format string, r io.Reader) (doc BookmarksDocument, err error) {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return
+	}
+	if format == "yaml" {
+		err = yaml.UnmarshalStrict(data, &doc)
+		return
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	err = dec.Decode(&doc)
+	return
+}
+
+// UpdateDocumentHandler replaces all bookmarks (and the settings, with the
+// admin scope, if the document has them) with those of a document in the
+// format (unless the Content-Type is JSON or YAML), returning what changed.
+// With If-Match the document is only replaced if it hasn't changed since it
+// was read; with ?dry_run=true only the changes are returned.
+func (s *Server) UpdateDocumentHandler(format string) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+		s.counters.Inc("n_api_document_update")
+
+		if !s.writable(w, r) {
+			return
+		}
+
+		if mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type")); err == nil {
+			switch mediaType {
+			case "application/json":
+				format = "json"
+			case "application/yaml", "application/x-yaml", "text/yaml":
+				format = "yaml"
+			}
+		}
+
+		doc, err := decodeDocument(format, io.LimitReader(r.Body, MaxDocumentBytes))
+		if err != nil {
+			WriteAPIError(w, r, http.StatusBadRequest, ErrCodeBadRequest, fmt.Sprintf("invalid %s", format), err.Error())
+			return
+		}
+		if doc, err = doc.Normalize(); err != nil {
+			WriteAPIError(w, r, http.StatusBadRequest, ErrCodeBadRequest, err.Error(), nil)
+			return
+		}
+
+		s.documentMu.Lock()
+		defer s.documentMu.Unlock()
+
+		current, err := s.document()
+		if err != nil {
+			slog.Error("error reading bookmarks document", "err", err)
+			WriteAPIError(w, r, http.StatusInternalServerError, ErrCodeInternal, "error reading bookmarks", err.Error())
+			return
+		}
+		if match := r.Header.Get("If-Match"); match != "" && match != "*" && match != current.ETag() {
+			w.Header().Set("ETag", current.ETag())
+			WriteAPIError(
+				w, r, http.StatusPreconditionFailed, ErrCodePreconditionFailed,
+				"bookmarks have changed since the document was read", nil,
+			)
+			return
+		}
+
+		result := DocumentResult{
+			DryRun:       r.URL.Query().Get("dry_run") == "true",
+			DocumentDiff: DiffDocuments(current, doc),
+		}
+		if token, ok := RequestToken(r); ok && result.Settings && !token.Allows(ScopeAdmin) {
+			s.counters.Inc("n_api_forbidden")
+			WriteAPIError(
+				w, r, http.StatusForbidden, ErrCodeForbidden,
+				fmt.Sprintf("token does not have the %s scope to change settings", ScopeAdmin), nil,
+			)
+			return
+		}
+		if result.DryRun {
+			result.ETag = current.ETag()
+			WriteJSON(w, http.StatusOK, result)
+			return
+		}
+
+		if err := ApplyDocument(current, doc, result.DocumentDiff); err != nil {
+			slog.Error("error applying bookmarks document", "err", err)
+			WriteAPIError(w, r, http.StatusInternalServerError, ErrCodeInternal, "error saving bookmarks", err.Error())
+			return
+		}
+		if result.Settings {
+			if _, err := s.UpdateSettings(doc.Settings.Update()); err != nil {
+				slog.Error("error applying settings of bookmarks document", "err", err)
+				WriteAPIError(w, r, http.StatusInternalServerError, ErrCodeInternal, "error saving settings", err.Error())
+				return
+			}
+			auditSettings(r, doc.Settings.Update())
+		}
+		for _, names := range [][]string{result.Created, result.Updated, result.Removed} {
+			for _, name := range names {
+				auditBookmark(r, name, current.Bookmarks[name].URL, doc.Bookmarks[name].URL)
+			}
+		}
+		s.counters.IncBy("n_api_document_changed", int64(len(result.Created)+len(result.Updated)+len(result.Removed)))
+
+		if updated, err := s.document(); err == nil {
+			result.ETag = updated.ETag()
+			w.Header().Set("ETag", result.ETag)
+		}
+		WriteJSON(w, http.StatusOK, result)
+	}
+}
@@ -0,0 +1,211 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNormalizeDocument(t *testing.T) {
+	assert := assert.New(t)
+
+	doc, err := BookmarksDocument{Bookmarks: map[string]DocumentBookmark{
+		"GH": {URL: "https://github.com/%s", Aliases: []string{"Hub", "github"}, Tags: []string{"git", "code"}},
+	}}.Normalize()
+	assert.NoError(err)
+	assert.Equal(DocumentBookmark{
+		URL:     "https://github.com/%s",
+		Aliases: []string{"github", "hub"},
+		Tags:    []string{"code", "git"},
+	}, doc.Bookmarks["gh"])
+
+	for _, invalid := range []map[string]DocumentBookmark{
+		{"gh": {URL: "github.com"}},
+		{"gh": {URL: "https://github.com", Tags: []string{"a,b"}}},
+		{"gh": {URL: "https://github.com", Aliases: []string{"go"}}, "go": {URL: "https://golang.org"}},
+		{"gh": {URL: "https://github.com", Aliases: []string{"x"}}, "go": {URL: "https://golang.org", Aliases: []string{"x"}}},
+		{"gh": {URL: "https://github.com"}, "GH": {URL: "https://github.com"}},
+	} {
+		_, err := BookmarksDocument{Bookmarks: invalid}.Normalize()
+		assert.Error(err, invalid)
+	}
+
+	doc, err = BookmarksDocument{Settings: &Settings{URL: " https://duckduckgo.com/?q=%s", Title: "Go"}}.Normalize()
+	assert.NoError(err)
+	assert.Equal(&Settings{URL: "https://duckduckgo.com/?q=%s", Title: "Go"}, doc.Settings)
+
+	_, err = BookmarksDocument{Settings: &Settings{URL: "duckduckgo.com", Title: "Go"}}.Normalize()
+	assert.Error(err)
+	_, err = BookmarksDocument{Settings: &Settings{}}.Normalize()
+	assert.Error(err)
+}
+
+func TestDiffDocuments(t *testing.T) {
+	assert := assert.New(t)
+
+	current := BookmarksDocument{Bookmarks: map[string]DocumentBookmark{
+		"gh":   {URL: "https://github.com/%s"},
+		"go":   {URL: "https://golang.org"},
+		"wiki": {URL: "https://en.wikipedia.org/wiki/%s"},
+	}}
+	doc := BookmarksDocument{Bookmarks: map[string]DocumentBookmark{
+		"gh":  {URL: "https://github.com/%s"},
+		"go":  {URL: "https://golang.org", Tags: []string{"dev"}},
+		"npm": {URL: "https://npmjs.com/package/%s"},
+	}}
+
+	assert.Equal(DocumentDiff{
+		Created:   []string{"npm"},
+		Updated:   []string{"go"},
+		Removed:   []string{"wiki"},
+		Unchanged: 1,
+	}, DiffDocuments(current, doc))
+	assert.Equal(current.ETag(), current.ETag())
+	assert.NotEqual(current.ETag(), doc.ETag())
+
+	// Settings only change if the document has them
+	current.Settings = &Settings{Title: "Search"}
+	assert.False(DiffDocuments(current, current).Settings)
+	assert.False(DiffDocuments(current, BookmarksDocument{}).Settings)
+	assert.True(DiffDocuments(current, BookmarksDocument{Settings: &Settings{Title: "Go"}}).Settings)
+}
+
+func TestDocumentAPI(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir("", "golinks")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	db, err = OpenStore(filepath.Join(dir, "test.db"))
+	assert.NoError(err)
+	defer db.Close()
+
+	s, err := NewServer(":8000", Config{Title: "Search"})
+	assert.NoError(err)
+
+	assert.NoError(SaveBookmark("gh", "https://github.com/%s"))
+	assert.NoError(SaveBookmark("wiki", "https://en.wikipedia.org/wiki/%s"))
+	assert.NoError(db.Put([]byte("alias_hub"), []byte("gh")))
+	assert.NoError(db.Put([]byte("tags_gh"), []byte("code")))
+
+	do := func(method, path, body string, header http.Header, scope string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r, _ := http.NewRequest(method, path, strings.NewReader(body))
+		for k := range header {
+			r.Header.Set(k, header.Get(k))
+		}
+		authorize(r, scope)
+		s.router.ServeHTTP(w, r)
+		return w
+	}
+
+	w := do("GET", "/api/v1/bookmarks.json", "", nil, ScopeRead)
+	assert.Equal(http.StatusOK, w.Code)
+	assert.JSONEq(`{"bookmarks": {
+		"gh": {"url": "https://github.com/%s", "aliases": ["hub"], "tags": ["code"]},
+		"wiki": {"url": "https://en.wikipedia.org/wiki/%s"}
+	}, "settings": {"url": "", "suggest_url": "", "title": "Search"}}`, w.Body.String())
+	etag := w.Header().Get("ETag")
+	assert.NotEmpty(etag)
+
+	w = do("GET", "/api/v1/bookmarks.yaml", "", nil, ScopeRead)
+	assert.Equal(http.StatusOK, w.Code)
+	assert.Equal("application/yaml", w.Header().Get("Content-Type"))
+	assert.Contains(w.Body.String(), "  gh:\n    url: https://github.com/%s\n")
+	assert.Equal(etag, w.Header().Get("ETag"))
+
+	w = do("GET", "/api/v1/bookmarks.json", "", http.Header{"If-None-Match": {etag}}, ScopeRead)
+	assert.Equal(http.StatusNotModified, w.Code)
+
+	assert.Equal(http.StatusForbidden, do("PUT", "/api/v1/bookmarks.json", `{"bookmarks": {}}`, nil, ScopeRead).Code)
+	assert.Equal(http.StatusBadRequest, do("PUT", "/api/v1/bookmarks.json", `{"links": {}}`, nil, ScopeWrite).Code)
+	assert.Equal(http.StatusBadRequest, do("PUT", "/api/v1/bookmarks.json", `{"bookmarks": {"gh": {"url": "github.com"}}}`, nil, ScopeWrite).Code)
+
+	// The alias moves from gh to github, wiki is removed and go created
+	doc := `
+bookmarks:
+  gh:
+    url: https://github.com/%s
+  github:
+    url: https://github.com
+    aliases: [hub]
+  go:
+    url: https://golang.org
+    description: The Go website
+`
+	w = do("PUT", "/api/v1/bookmarks.yaml?dry_run=true", doc, http.Header{"If-Match": {etag}}, ScopeWrite)
+	assert.Equal(http.StatusOK, w.Code)
+	var result DocumentResult
+	assert.NoError(json.Unmarshal(w.Body.Bytes(), &result))
+	assert.True(result.DryRun)
+	assert.Equal([]string{"github", "go"}, result.Created)
+	assert.Equal([]string{"gh"}, result.Updated)
+	assert.Equal([]string{"wiki"}, result.Removed)
+	_, ok := LookupBookmark("wiki")
+	assert.True(ok)
+
+	w = do("PUT", "/api/v1/bookmarks.yaml", doc, http.Header{"If-Match": {`"stale"`}}, ScopeWrite)
+	assert.Equal(http.StatusPreconditionFailed, w.Code)
+	assert.Equal(etag, w.Header().Get("ETag"))
+
+	w = do("PUT", "/api/v1/bookmarks.yaml", doc, http.Header{"If-Match": {etag}}, ScopeWrite)
+	assert.Equal(http.StatusOK, w.Code)
+	result = DocumentResult{}
+	assert.NoError(json.Unmarshal(w.Body.Bytes(), &result))
+	assert.False(result.DryRun)
+	assert.Equal([]string{"wiki"}, result.Removed)
+	assert.NotEqual(etag, result.ETag)
+	assert.Equal(result.ETag, w.Header().Get("ETag"))
+
+	_, ok = LookupBookmark("wiki")
+	assert.False(ok)
+	bookmark, ok := LookupBookmark("hub")
+	assert.True(ok)
+	assert.Equal("github", bookmark.Name())
+	assert.False(db.Has([]byte("tags_gh")))
+
+	current, err := s.document()
+	assert.NoError(err)
+	assert.Equal(result.ETag, current.ETag())
+	assert.Equal("The Go website", current.Bookmarks["go"].Description)
+
+	// Putting the same document again changes nothing
+	w = do("PUT", "/api/v1/bookmarks.json", `{"bookmarks": {"gh": {"url": "https://github.com/%s"}, "github": {"url": "https://github.com", "aliases": ["hub"]}, "go": {"url": "https://golang.org", "description": "The Go website"}}}`, nil, ScopeWrite)
+	assert.Equal(http.StatusOK, w.Code)
+	result = DocumentResult{}
+	assert.NoError(json.Unmarshal(w.Body.Bytes(), &result))
+	assert.Equal(3, result.Unchanged)
+	assert.Empty(result.Created)
+	assert.Empty(result.Updated)
+	assert.Empty(result.Removed)
+	assert.False(result.Settings)
+
+	// Changing the settings requires the admin scope
+	doc = `
+bookmarks:
+  go:
+    url: https://golang.org
+settings:
+  url: https://duckduckgo.com/?q=%s
+  title: Go
+`
+	w = do("PUT", "/api/v1/bookmarks.yaml", doc, nil, ScopeWrite)
+	assert.Equal(http.StatusForbidden, w.Code)
+
+	w = do("PUT", "/api/v1/bookmarks.yaml", doc, nil, ScopeAdmin)
+	assert.Equal(http.StatusOK, w.Code)
+	result = DocumentResult{}
+	assert.NoError(json.Unmarshal(w.Body.Bytes(), &result))
+	assert.True(result.Settings)
+	assert.Equal([]string{"gh", "github"}, result.Removed)
+	assert.Equal(Settings{URL: "https://duckduckgo.com/?q=%s", Title: "Go"}, s.settings())
+	assert.True(db.Has(settingsKey))
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+
+	"github.com/namsral/flag"
+)
+
+// Dump writes a JSON snapshot of every key in the store to w
+func Dump(store Store, w io.Writer) error {
+	snapshot, err := TakeSnapshot(store)
+	if err != nil {
+		return err
+	}
+	return snapshot.WriteJSON(w)
+}
+
+// Load reads a JSON snapshot from r into the store and returns the number
+// of keys loaded.
+func Load(store Store, r io.Reader) (int, error) {
+	snapshot, err := ReadSnapshot(r)
+	if err != nil {
+		return 0, fmt.Errorf("error reading snapshot: %s", err)
+	}
+	return snapshot.Restore(store)
+}
+
+func runDump(args []string) error {
+	var dbpath, encryptionKeyFile string
+
+	fs := flag.NewFlagSet("dump", flag.ExitOnError)
+	fs.StringVar(&dbpath, "dbpath", "search.db", "database path or uri")
+	fs.StringVar(&encryptionKeyFile, "encryption-key-file", "",
+		"file containing the key the database is encrypted with")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	store, err := OpenDB(dbpath, encryptionKeyFile)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	return Dump(store, os.Stdout)
+}
+
+func runLoad(args []string) error {
+	var dbpath, encryptionKeyFile string
+
+	fs := flag.NewFlagSet("load", flag.ExitOnError)
+	fs.StringVar(&dbpath, "dbpath", "search.db", "database path or uri")
+	fs.StringVar(&encryptionKeyFile, "encryption-key-file", "",
+		"file containing the key to encrypt the database with")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	var r io.Reader = os.Stdin
+	if fs.NArg() > 0 && fs.Arg(0) != "-" {
+		f, err := os.Open(fs.Arg(0))
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		r = f
+	}
+
+	store, err := OpenDB(dbpath, encryptionKeyFile)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	n, err := Load(store, r)
+	if err != nil {
+		return err
+	}
+
+	slog.Info("loaded keys", "keys", n, "db", dbpath)
+
+	return nil
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDumpLoad(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir("", "golinks")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	src, err := OpenStore(filepath.Join(dir, "src.db"))
+	assert.NoError(err)
+	defer src.Close()
+
+	assert.NoError(src.Put([]byte("bookmark_gh"), []byte("https://github.com/search?q=%s")))
+	assert.NoError(src.Put([]byte("bookmark_g"), []byte("https://google.com/search?q=%s")))
+
+	buf := &bytes.Buffer{}
+	assert.NoError(Dump(src, buf))
+
+	dump := buf.String()
+	assert.Contains(dump, `"version": 1`)
+	assert.True(strings.Index(dump, `"bookmark_g"`) < strings.Index(dump, "bookmark_gh"))
+
+	dst, err := OpenStore(filepath.Join(dir, "dst.db"))
+	assert.NoError(err)
+	defer dst.Close()
+
+	n, err := Load(dst, strings.NewReader(dump))
+	assert.NoError(err)
+	assert.Equal(2, n)
+
+	val, err := dst.Get([]byte("bookmark_gh"))
+	assert.NoError(err)
+	assert.Equal("https://github.com/search?q=%s", string(val))
+}
+
+func TestLoadInvalid(t *testing.T) {
+	assert := assert.New(t)
+
+	_, err := Load(nil, strings.NewReader("{}"))
+	assert.Error(err)
+
+	_, err = Load(nil, strings.NewReader("foo"))
+	assert.Error(err)
+}
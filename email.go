@@ -0,0 +1,356 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/mail"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+const (
+	// MaxInboundEmailBytes is the maximum size of an inbound email
+	MaxInboundEmailBytes = 1 << 20
+
+	// MaxInboundEmailAge is how old the timestamp of a signed email service
+	// request can be, so captured requests can't be replayed later
+	MaxInboundEmailAge = 15 * time.Minute
+)
+
+// ErrNoEmailBookmark is returned for emails without a name and url
+var ErrNoEmailBookmark = errors.New("no bookmark found (expected a line with a name and url)")
+
+// InboundEmail is an email received by the gateway. Verified is whether
+// From is covered by the signature (only for raw emails).
+type InboundEmail struct {
+	From     string
+	Subject  string
+	Date     string
+	Text     string
+	Verified bool
+}
+
+// SeenTokens remembers the tokens (or signatures) of inbound emails for
+// MaxInboundEmailAge, as long as their timestamps are accepted, so signed
+// requests can't be replayed.
+type SeenTokens struct {
+	sync.Mutex
+	tokens map[string]time.Time
+}
+
+// NewSeenTokens ...
+func NewSeenTokens() *SeenTokens {
+	return &SeenTokens{tokens: make(map[string]time.Time)}
+}
+
+// Seen records token and reports whether it was already seen
+func (s *SeenTokens) Seen(token string) bool {
+	s.Lock()
+	defer s.Unlock()
+
+	now := time.Now()
+	for t, expires := range s.tokens {
+		if now.After(expires) {
+			delete(s.tokens, t)
+		}
+	}
+
+	if _, ok := s.tokens[token]; ok {
+		return true
+	}
+	// Timestamps up to MaxInboundEmailAge in the future are accepted too
+	s.tokens[token] = now.Add(2 * MaxInboundEmailAge)
+	return false
+}
+
+// checkEmailAge rejects timestamps more than MaxInboundEmailAge apart from
+// now
+func checkEmailAge(t time.Time) error {
+	if age := time.Since(t); age > MaxInboundEmailAge || age < -MaxInboundEmailAge {
+		return errors.New("timestamp too old")
+	}
+	return nil
+}
+
+// ParseEmailSenders parses a comma separated list of email addresses
+func ParseEmailSenders(s string) ([]string, error) {
+	var senders []string
+	for _, sender := range strings.Split(s, ",") {
+		if strings.TrimSpace(sender) == "" {
+			continue
+		}
+		addr, err := mail.ParseAddress(sender)
+		if err != nil {
+			return nil, fmt.Errorf("invalid email sender %q: %s", sender, err)
+		}
+		senders = append(senders, strings.ToLower(addr.Address))
+	}
+	return senders, nil
+}
+
+// ParseEmailBookmark returns the name and url of the bookmark in an email:
+// the subject or first line of the body that is a name and an url (with an
+// optional leading "add"), e.g: "gh https://github.com/%s". Quoted replies
+// and signatures are ignored.
+func ParseEmailBookmark(email InboundEmail) (name, url string, err error) {
+	lines := []string{email.Subject}
+	scanner := bufio.NewScanner(strings.NewReader(email.Text))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "--" || strings.HasPrefix(line, "-- ") {
+			break
+		}
+		if strings.HasPrefix(line, ">") {
+			continue
+		}
+		lines = append(lines, line)
+	}
+
+	for _, line := range lines {
+		fields := strings.Fields(line)
+		if len(fields) == 3 && strings.EqualFold(fields[0], "add") {
+			fields = fields[1:]
+		}
+		if len(fields) != 2 {
+			continue
+		}
+		if strings.HasPrefix(fields[1], "http://") || strings.HasPrefix(fields[1], "https://") {
+			return strings.ToLower(strings.Trim(fields[0], "/")), fields[1], nil
+		}
+	}
+
+	return "", "", ErrNoEmailBookmark
+}
+
+// ReadEmail reads a raw (RFC 822) email, using the first text/plain part
+// of multipart emails as its text
+func ReadEmail(r io.Reader) (InboundEmail, error) {
+	msg, err := mail.ReadMessage(r)
+	if err != nil {
+		return InboundEmail{}, err
+	}
+
+	dec := new(mime.WordDecoder)
+	subject, err := dec.DecodeHeader(msg.Header.Get("Subject"))
+	if err != nil {
+		subject = msg.Header.Get("Subject")
+	}
+	email := InboundEmail{
+		From:    msg.Header.Get("From"),
+		Subject: subject,
+		Date:    msg.Header.Get("Date"),
+	}
+
+	text, err := readEmailText(msg.Header.Get("Content-Type"), msg.Body)
+	if err != nil {
+		return email, err
+	}
+	email.Text = text
+
+	return email, nil
+}
+
+func readEmailText(contentType string, body io.Reader) (string, error) {
+	mediaType, params, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		mediaType = "text/plain"
+	}
+
+	if strings.HasPrefix(mediaType, "multipart/") {
+		mr := multipart.NewReader(body, params["boundary"])
+		for {
+			part, err := mr.NextPart()
+			if err == io.EOF {
+				return "", nil
+			}
+			if err != nil {
+				return "", err
+			}
+			text, err := readEmailText(part.Header.Get("Content-Type"), part)
+			if err != nil || text != "" {
+				return text, err
+			}
+		}
+	}
+
+	if mediaType != "text/plain" {
+		return "", nil
+	}
+	data, err := ioutil.ReadAll(body)
+	return string(data), err
+}
+
+// verifyEmailServiceSignature verifies a signed request of an email service
+// (e.g: Mailgun routes): the HMAC-SHA256 of its timestamp and token
+func verifyEmailServiceSignature(secret string, r *http.Request) error {
+	timestamp, token := r.FormValue("timestamp"), r.FormValue("token")
+
+	ts, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return errors.New("missing or invalid timestamp")
+	}
+	if err := checkEmailAge(time.Unix(ts, 0)); err != nil {
+		return err
+	}
+	if token == "" {
+		return errors.New("missing token")
+	}
+
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + token))
+	if !hmac.Equal([]byte(hex.EncodeToString(mac.Sum(nil))), []byte(r.FormValue("signature"))) {
+		return errors.New("invalid signature")
+	}
+	return nil
+}
+
+// readInboundEmail reads and verifies the email of a request, either a form
+// posted by an email service or a raw email signed like webhooks. Email
+// services only sign the timestamp and token, so their From isn't verified.
+// Raw emails must have a recent Date. Either is rejected if replayed.
+func (s *Server) readInboundEmail(r *http.Request) (InboundEmail, error) {
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+
+	if mediaType == "application/x-www-form-urlencoded" || mediaType == "multipart/form-data" {
+		if err := r.ParseMultipartForm(MaxInboundEmailBytes); err != nil && err != http.ErrNotMultipart {
+			return InboundEmail{}, err
+		}
+		if err := verifyEmailServiceSignature(s.config.EmailSecret, r); err != nil {
+			return InboundEmail{}, err
+		}
+		if s.emailTokens.Seen("token:" + r.FormValue("token")) {
+			return InboundEmail{}, errors.New("replayed request")
+		}
+
+		email := InboundEmail{From: r.FormValue("from"), Subject: r.FormValue("subject")}
+		if email.From == "" {
+			email.From = r.FormValue("sender")
+		}
+		if email.Text = r.FormValue("stripped-text"); email.Text == "" {
+			email.Text = r.FormValue("body-plain")
+		}
+		return email, nil
+	}
+
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return InboundEmail{}, err
+	}
+	signature := r.Header.Get("X-Golinks-Signature")
+	if !hmac.Equal([]byte(signature), []byte(SignWebhook(s.config.EmailSecret, body))) {
+		return InboundEmail{}, errors.New("invalid signature")
+	}
+
+	email, err := ReadEmail(bytes.NewReader(body))
+	if err != nil {
+		return InboundEmail{}, err
+	}
+	date, err := mail.ParseDate(email.Date)
+	if err != nil {
+		return InboundEmail{}, errors.New("missing or invalid date")
+	}
+	if err := checkEmailAge(date); err != nil {
+		return InboundEmail{}, err
+	}
+	if s.emailTokens.Seen("signature:" + signature) {
+		return InboundEmail{}, errors.New("replayed email")
+	}
+	email.Verified = true
+	return email, nil
+}
+
+// allowsSender reports whether bookmarks can be created by the email: any
+// email if no senders are configured, else only signed emails from them
+func (s *Server) allowsSender(email InboundEmail) bool {
+	if len(s.emailSenders) == 0 {
+		return true
+	}
+	if !email.Verified {
+		return false
+	}
+	addr, err := mail.ParseAddress(email.From)
+	if err != nil {
+		return false
+	}
+	for _, sender := range s.emailSenders {
+		if strings.EqualFold(sender, addr.Address) {
+			return true
+		}
+	}
+	return false
+}
+
+// InboundEmailHandler creates a bookmark from an email, e.g: with the
+// subject "gh https://github.com/%s", forwarded by an email service or
+// posted as a raw email signed with the email secret
+func (s *Server) InboundEmailHandler() httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+		s.counters.Inc("n_inbound_email")
+
+		if !s.writable(w, r) {
+			return
+		}
+
+		r.Body = http.MaxBytesReader(w, r.Body, MaxInboundEmailBytes)
+		email, err := s.readInboundEmail(r)
+		if err != nil {
+			s.counters.Inc("n_inbound_email_rejected")
+			WriteAPIError(w, r, http.StatusUnauthorized, ErrCodeUnauthorized, "invalid email", err.Error())
+			return
+		}
+		if !s.allowsSender(email) {
+			s.counters.Inc("n_inbound_email_rejected")
+			msg := fmt.Sprintf("sender %q is not allowed", email.From)
+			if !email.Verified {
+				msg = "sender can't be verified (email services don't sign it)"
+			}
+			WriteAPIError(w, r, http.StatusForbidden, ErrCodeForbidden, msg, nil)
+			return
+		}
+
+		name, url, err := ParseEmailBookmark(email)
+		if err == nil {
+			err = ValidateBookmark(name, url)
+		}
+		if err != nil {
+			WriteAPIError(w, r, http.StatusBadRequest, ErrCodeBadRequest, err.Error(), nil)
+			return
+		}
+
+		if db.Has([]byte(fmt.Sprintf("bookmark_%s", name))) {
+			WriteAPIError(
+				w, r, http.StatusConflict, ErrCodeConflict,
+				fmt.Sprintf("bookmark %s already exists", name), nil,
+			)
+			return
+		}
+		if err := SaveBookmark(name, url); err != nil {
+			WriteAPIError(
+				w, r, http.StatusInternalServerError, ErrCodeInternal,
+				"error saving bookmark", err.Error(),
+			)
+			return
+		}
+		user := "email"
+		if email.Verified {
+			user = "email:" + email.From
+		}
+		auditBookmarkAs(user, name, "", url)
+
+		WriteJSON(w, http.StatusCreated, Bookmark{name: name, url: url})
+	}
+}
@@ -0,0 +1,212 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseEmailBookmark(t *testing.T) {
+	assert := assert.New(t)
+
+	name, url, err := ParseEmailBookmark(InboundEmail{Subject: "GH https://github.com/%s"})
+	assert.NoError(err)
+	assert.Equal("gh", name)
+	assert.Equal("https://github.com/%s", url)
+
+	name, url, err = ParseEmailBookmark(InboundEmail{
+		Subject: "Fwd: a link",
+		Text:    "> jira https://quoted.example.com\n\nadd jira https://jira.example.com/browse/%s\n-- \ndocs https://signature.example.com\n",
+	})
+	assert.NoError(err)
+	assert.Equal("jira", name)
+	assert.Equal("https://jira.example.com/browse/%s", url)
+
+	_, _, err = ParseEmailBookmark(InboundEmail{Subject: "hello", Text: "see you at lunch\n-- \ndocs https://signature.example.com"})
+	assert.Equal(ErrNoEmailBookmark, err)
+}
+
+func TestReadEmail(t *testing.T) {
+	assert := assert.New(t)
+
+	raw := strings.Join([]string{
+		"From: Alice <alice@example.com>",
+		"Subject: =?UTF-8?Q?wiki_https://wiki.example.com/=25s?=",
+		"MIME-Version: 1.0",
+		`Content-Type: multipart/alternative; boundary="b1"`,
+		"",
+		"--b1",
+		"Content-Type: text/html",
+		"",
+		"<p>ignored</p>",
+		"--b1",
+		"Content-Type: text/plain; charset=utf-8",
+		"",
+		"Sent from my phone",
+		"--b1--",
+		"",
+	}, "\r\n")
+
+	email, err := ReadEmail(strings.NewReader(raw))
+	assert.NoError(err)
+	assert.Equal("Alice <alice@example.com>", email.From)
+	assert.Equal("wiki https://wiki.example.com/%s", email.Subject)
+	assert.Equal("Sent from my phone", email.Text)
+}
+
+func TestParseEmailSenders(t *testing.T) {
+	assert := assert.New(t)
+
+	senders, err := ParseEmailSenders("Alice <Alice@Example.com>, bob@example.com,")
+	assert.NoError(err)
+	assert.Equal([]string{"alice@example.com", "bob@example.com"}, senders)
+
+	_, err = ParseEmailSenders("not an address")
+	assert.Error(err)
+}
+
+func TestInboundEmailHandler(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir("", "golinks")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	db, err = OpenStore(filepath.Join(dir, "test.db"))
+	assert.NoError(err)
+	defer db.Close()
+
+	s, err := NewServer(":8000", Config{EmailSecret: "s3cr3t", EmailSenders: "alice@example.com"})
+	assert.NoError(err)
+
+	// Raw emails are signed like webhooks
+	post := func(raw, signature string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r, _ := http.NewRequest("POST", "/inbound/email", strings.NewReader(raw))
+		r.Header.Set("Content-Type", "message/rfc822")
+		r.Header.Set("X-Golinks-Signature", signature)
+		s.router.ServeHTTP(w, r)
+		return w
+	}
+
+	// Raw emails must be recent
+	date := "Date: " + time.Now().Format(time.RFC1123Z) + "\r\n"
+	raw := "From: alice@example.com\r\nSubject: gh https://github.com/%s\r\n\r\nThanks!\r\n"
+	assert.Equal(http.StatusUnauthorized, post(raw, SignWebhook("s3cr3t", []byte(raw))).Code)
+	old := "Date: " + time.Now().Add(-time.Hour).Format(time.RFC1123Z) + "\r\n" + raw
+	assert.Equal(http.StatusUnauthorized, post(old, SignWebhook("s3cr3t", []byte(old))).Code)
+
+	raw = date + raw
+	w := post(raw, SignWebhook("s3cr3t", []byte(raw)))
+	assert.Equal(http.StatusCreated, w.Code)
+	assert.JSONEq(`{"name": "gh", "url": "https://github.com/%s"}`, w.Body.String())
+	bookmark, ok := LookupBookmark("gh")
+	assert.True(ok)
+	assert.Equal("https://github.com/%s", bookmark.URL())
+	audit, err := ListAudit("", 10)
+	assert.NoError(err)
+	assert.Len(audit.Entries, 1)
+	assert.Equal("email:alice@example.com", audit.Entries[0].User)
+
+	// Replayed emails are rejected, even once the bookmark is deleted
+	assert.NoError(DeleteBookmark("gh"))
+	assert.Equal(http.StatusUnauthorized, post(raw, SignWebhook("s3cr3t", []byte(raw))).Code)
+	assert.Equal(http.StatusUnauthorized, post(raw, SignWebhook("wrong", []byte(raw))).Code)
+
+	raw = date + "From: alice@example.com\r\nSubject: gh https://github.com/%s\r\n\r\nAgain\r\n"
+	assert.Equal(http.StatusCreated, post(raw, SignWebhook("s3cr3t", []byte(raw))).Code)
+	raw = date + "From: alice@example.com\r\nSubject: gh https://github.com/%s\r\n\r\nOnce more\r\n"
+	assert.Equal(http.StatusConflict, post(raw, SignWebhook("s3cr3t", []byte(raw))).Code)
+
+	raw = date + "From: mallory@example.com\r\nSubject: gl https://gitlab.com/%s\r\n\r\n"
+	assert.Equal(http.StatusForbidden, post(raw, SignWebhook("s3cr3t", []byte(raw))).Code)
+
+	raw = date + "From: alice@example.com\r\nSubject: hello\r\n\r\nno links here\r\n"
+	assert.Equal(http.StatusBadRequest, post(raw, SignWebhook("s3cr3t", []byte(raw))).Code)
+
+	// Email services sign the timestamp and token of their requests
+	form := func(timestamp int64, token, key string) url.Values {
+		ts := fmt.Sprintf("%d", timestamp)
+		mac := hmac.New(sha256.New, []byte(key))
+		mac.Write([]byte(ts + token))
+		return url.Values{
+			"timestamp":     {ts},
+			"token":         {token},
+			"signature":     {hex.EncodeToString(mac.Sum(nil))},
+			"sender":        {"alice@example.com"},
+			"subject":       {"Links"},
+			"stripped-text": {"docs https://docs.example.com/?q=%s"},
+		}
+	}
+	postForm := func(values url.Values) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r, _ := http.NewRequest("POST", "/inbound/email", strings.NewReader(values.Encode()))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		s.router.ServeHTTP(w, r)
+		return w
+	}
+
+	assert.Equal(http.StatusUnauthorized, postForm(form(time.Now().Unix(), "t0k3n", "wrong")).Code)
+	assert.Equal(http.StatusUnauthorized, postForm(form(time.Now().Add(-time.Hour).Unix(), "t0k3n", "s3cr3t")).Code)
+	assert.Equal(http.StatusUnauthorized, postForm(form(time.Now().Unix(), "", "s3cr3t")).Code)
+
+	// Their senders aren't signed so can't be allowed
+	assert.Equal(http.StatusForbidden, postForm(form(time.Now().Unix(), "t0k3n", "s3cr3t")).Code)
+	_, ok = LookupBookmark("docs")
+	assert.False(ok)
+
+	s, err = NewServer(":8000", Config{EmailSecret: "s3cr3t"})
+	assert.NoError(err)
+
+	values := form(time.Now().Unix(), "t0k3n", "s3cr3t")
+	assert.Equal(http.StatusCreated, postForm(values).Code)
+	_, ok = LookupBookmark("docs")
+	assert.True(ok)
+	audit, err = ListAudit("", 1)
+	assert.NoError(err)
+	assert.Equal("email", audit.Entries[0].User)
+
+	// Replayed requests are rejected, even once the bookmark is deleted
+	assert.NoError(DeleteBookmark("docs"))
+	assert.Equal(http.StatusUnauthorized, postForm(values).Code)
+	_, ok = LookupBookmark("docs")
+	assert.False(ok)
+}
+
+func TestSeenTokens(t *testing.T) {
+	assert := assert.New(t)
+
+	tokens := NewSeenTokens()
+	assert.False(tokens.Seen("foo"))
+	assert.True(tokens.Seen("foo"))
+	assert.False(tokens.Seen("bar"))
+
+	// Expired tokens are forgotten
+	tokens.tokens["foo"] = time.Now().Add(-time.Second)
+	assert.False(tokens.Seen("foo"))
+	assert.Len(tokens.tokens, 2)
+}
+
+func TestInboundEmailDisabled(t *testing.T) {
+	assert := assert.New(t)
+
+	s, err := NewServer(":8000", Config{})
+	assert.NoError(err)
+
+	w := httptest.NewRecorder()
+	r, _ := http.NewRequest("POST", "/inbound/email", strings.NewReader(""))
+	s.router.ServeHTTP(w, r)
+	assert.Equal(http.StatusNotFound, w.Code)
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+)
+
+// EncryptionKeySize is the size of the AES-256 key used for encryption
+const EncryptionKeySize = 32
+
+// encryptedMagic prefixes encrypted values so that existing plaintext values
+// can still be read after enabling encryption.
+var encryptedMagic = []byte("\x00enc1")
+
+// ErrInvalidEncryptionKey ...
+var ErrInvalidEncryptionKey = fmt.Errorf(
+	"error: invalid encryption key: expected %d bytes (raw or hex encoded)",
+	EncryptionKeySize,
+)
+
+// ErrDecryptionFailed ...
+var ErrDecryptionFailed = errors.New("error: decryption failed")
+
+// LoadEncryptionKey reads an encryption key from the given file. The file
+// must contain exactly 32 bytes of raw key material or its hex encoding.
+func LoadEncryptionKey(path string) ([]byte, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(data) == EncryptionKeySize {
+		return data, nil
+	}
+
+	key, err := hex.DecodeString(string(bytes.TrimSpace(data)))
+	if err != nil || len(key) != EncryptionKeySize {
+		return nil, ErrInvalidEncryptionKey
+	}
+
+	return key, nil
+}
+
+// EncryptedStore wraps a Store and encrypts all values at rest with
+// AES-GCM. Keys are stored in plaintext so that prefix scans still work.
+type EncryptedStore struct {
+	Store
+
+	aead cipher.AEAD
+
+	// hashKey is the key of keyHash, derived from the encryption key
+	hashKey []byte
+}
+
+// NewEncryptedStore ...
+func NewEncryptedStore(store Store, key []byte) (*EncryptedStore, error) {
+	if len(key) != EncryptionKeySize {
+		return nil, ErrInvalidEncryptionKey
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+
+	hashKey := sha256.Sum256(append([]byte("golinks key hash "), key...))
+	return &EncryptedStore{Store: store, aead: aead, hashKey: hashKey[:]}, nil
+}
+
+// storeWrapper is implemented by stores wrapping another store
+type storeWrapper interface {
+	Unwrap() Store
+}
+
+// encryptedStore returns the EncryptedStore store is or wraps (e.g: behind
+// an InstrumentedStore), if values are encrypted
+func encryptedStore(store Store) (*EncryptedStore, bool) {
+	for {
+		if es, ok := store.(*EncryptedStore); ok {
+			return es, true
+		}
+		wrapper, ok := store.(storeWrapper)
+		if !ok {
+			return nil, false
+		}
+		store = wrapper.Unwrap()
+	}
+}
+
+// keyHash returns a hash of s to use in keys (e.g: of indexes) in place of
+// s, which would leak what values are encrypted to: an HMAC with a key
+// derived from the encryption key if values are encrypted
+func keyHash(s string) string {
+	var key []byte
+	if es, ok := encryptedStore(db); ok {
+		key = es.hashKey
+	}
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(s))
+	return hex.EncodeToString(mac.Sum(nil)[:16])
+}
+
+// seal encrypts value, authenticating it with ad (e.g: its key)
+func (s *EncryptedStore) seal(value, ad []byte) ([]byte, error) {
+	nonce := make([]byte, s.aead.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+
+	buf := make([]byte, 0, len(encryptedMagic)+len(nonce)+len(value)+s.aead.Overhead())
+	buf = append(buf, encryptedMagic...)
+	buf = append(buf, nonce...)
+	return s.aead.Seal(buf, nonce, value, ad), nil
+}
+
+// open decrypts a value encrypted by seal with the same ad
+func (s *EncryptedStore) open(val, ad []byte) ([]byte, error) {
+	data := val[len(encryptedMagic):]
+	if len(data) < s.aead.NonceSize() {
+		return nil, ErrDecryptionFailed
+	}
+
+	nonce, ciphertext := data[:s.aead.NonceSize()], data[s.aead.NonceSize():]
+	plaintext, err := s.aead.Open(nil, nonce, ciphertext, ad)
+	if err != nil {
+		return nil, ErrDecryptionFailed
+	}
+
+	return plaintext, nil
+}
+
+// Get ...
+func (s *EncryptedStore) Get(key []byte) ([]byte, error) {
+	val, err := s.Store.Get(key)
+	if err != nil {
+		return nil, err
+	}
+
+	if !bytes.HasPrefix(val, encryptedMagic) {
+		return val, nil
+	}
+
+	return s.open(val, key)
+}
+
+// Put ...
+func (s *EncryptedStore) Put(key, value []byte) error {
+	buf, err := s.seal(value, key)
+	if err != nil {
+		return err
+	}
+
+	return s.Store.Put(key, buf)
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoadEncryptionKey(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir("", "golinks")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	raw := bytes.Repeat([]byte{0x42}, EncryptionKeySize)
+
+	path := filepath.Join(dir, "raw.key")
+	assert.NoError(ioutil.WriteFile(path, raw, 0600))
+	key, err := LoadEncryptionKey(path)
+	assert.NoError(err)
+	assert.Equal(raw, key)
+
+	path = filepath.Join(dir, "hex.key")
+	assert.NoError(ioutil.WriteFile(path, []byte(hex.EncodeToString(raw)+"\n"), 0600))
+	key, err = LoadEncryptionKey(path)
+	assert.NoError(err)
+	assert.Equal(raw, key)
+
+	path = filepath.Join(dir, "bad.key")
+	assert.NoError(ioutil.WriteFile(path, []byte("foo"), 0600))
+	_, err = LoadEncryptionKey(path)
+	assert.Equal(ErrInvalidEncryptionKey, err)
+}
+
+func TestEncryptedStore(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir("", "golinks")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	store, err := OpenStore(filepath.Join(dir, "test.db"))
+	assert.NoError(err)
+	defer store.Close()
+
+	// Existing plaintext values remain readable
+	assert.NoError(store.Put([]byte("bookmark_old"), []byte("https://old.com")))
+
+	key := bytes.Repeat([]byte{0x42}, EncryptionKeySize)
+	es, err := NewEncryptedStore(store, key)
+	assert.NoError(err)
+
+	assert.NoError(es.Put([]byte("bookmark_g"), []byte("https://google.com")))
+
+	raw, err := store.Get([]byte("bookmark_g"))
+	assert.NoError(err)
+	assert.NotContains(string(raw), "google")
+
+	val, err := es.Get([]byte("bookmark_g"))
+	assert.NoError(err)
+	assert.Equal("https://google.com", string(val))
+
+	val, err = es.Get([]byte("bookmark_old"))
+	assert.NoError(err)
+	assert.Equal("https://old.com", string(val))
+
+	// Wrong key fails to decrypt
+	other, err := NewEncryptedStore(store, bytes.Repeat([]byte{0x24}, EncryptionKeySize))
+	assert.NoError(err)
+	_, err = other.Get([]byte("bookmark_g"))
+	assert.Equal(ErrDecryptionFailed, err)
+
+	// Values are bound to their keys
+	assert.NoError(store.Put([]byte("bookmark_x"), raw))
+	_, err = es.Get([]byte("bookmark_x"))
+	assert.Equal(ErrDecryptionFailed, err)
+}
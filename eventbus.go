@@ -0,0 +1,190 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultEventBusPrefix prefixes the subjects (or topics) events are
+	// published to
+	DefaultEventBusPrefix = "golinks"
+
+	// EventBusQueueSize is the maximum number of pending events
+	EventBusQueueSize = 4096
+
+	// MaxEventBusRetryDelay is the longest reconnecting to the bus is backed
+	// off for
+	MaxEventBusRetryDelay = time.Minute
+)
+
+// EventBusConn is a connection to an event bus
+type EventBusConn interface {
+	Publish(subject string, data []byte) error
+	Close() error
+}
+
+// ParseEventBusURL parses the url of a NATS (nats://) or MQTT (mqtt://)
+// server to publish events to
+func ParseEventBusURL(s string) (*url.URL, error) {
+	u, err := url.Parse(strings.TrimSpace(s))
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme != "nats" && u.Scheme != "mqtt" {
+		return nil, fmt.Errorf("unsupported event bus %q (expected nats:// or mqtt://)", s)
+	}
+	if u.Hostname() == "" {
+		return nil, fmt.Errorf("invalid event bus url %q (missing host)", s)
+	}
+	return u, nil
+}
+
+// EventBus publishes every redirect and bookmark change as JSON (the same
+// as sent to webhooks) to a NATS subject or MQTT topic per type of event,
+// e.g: golinks.bookmark.created or golinks/bookmark/created. Events are
+// published in order in the background, reconnecting with backoff whenever
+// the connection fails. If the queue fills up (e.g: the bus is down) events
+// are dropped and counted, so publishing never blocks writes or redirects.
+type EventBus struct {
+	url      *url.URL
+	prefix   string
+	counters *Counters
+
+	dial       func() (EventBusConn, error)
+	retryDelay time.Duration
+
+	queue chan Event
+	done  chan struct{}
+	wg    sync.WaitGroup
+}
+
+// NewEventBus ...
+func NewEventBus(u *url.URL, prefix string, counters *Counters) *EventBus {
+	if prefix == "" {
+		prefix = DefaultEventBusPrefix
+	}
+
+	b := &EventBus{
+		url:      u,
+		prefix:   prefix,
+		counters: counters,
+
+		retryDelay: time.Second,
+
+		queue: make(chan Event, EventBusQueueSize),
+		done:  make(chan struct{}),
+	}
+	b.dial = func() (EventBusConn, error) {
+		if u.Scheme == "mqtt" {
+			conn, err := DialMQTT(u, 10*time.Second)
+			if err != nil {
+				return nil, err
+			}
+			return conn, nil
+		}
+		conn, err := DialNATS(u, 10*time.Second)
+		if err != nil {
+			return nil, err
+		}
+		return conn, nil
+	}
+	return b
+}
+
+// Subject returns the subject (or topic) events of the type are published to
+func (b *EventBus) Subject(eventType string) string {
+	if b.url.Scheme == "mqtt" {
+		return strings.Trim(b.prefix, "/") + "/" + strings.Replace(eventType, ".", "/", -1)
+	}
+	return strings.Trim(b.prefix, ".") + "." + eventType
+}
+
+// Publish queues an event for the bus without blocking. History entries
+// are not published (every redirect is).
+func (b *EventBus) Publish(event Event) {
+	if event.Type == EventHistory {
+		return
+	}
+
+	select {
+	case b.queue <- event:
+	default:
+		b.counters.Inc("n_eventbus_dropped")
+	}
+}
+
+// Start starts publishing queued events in the background
+func (b *EventBus) Start() {
+	b.wg.Add(1)
+	go b.run()
+}
+
+func (b *EventBus) run() {
+	defer b.wg.Done()
+
+	var conn EventBusConn
+	defer func() {
+		if conn != nil {
+			conn.Close()
+		}
+	}()
+
+	delay := b.retryDelay
+	for {
+		var event Event
+		select {
+		case event = <-b.queue:
+		case <-b.done:
+			return
+		}
+
+		data, err := json.Marshal(event)
+		if err != nil {
+			slog.Error("error encoding event", "err", err)
+			continue
+		}
+
+		// Retry (reconnecting) until the event is published or the bus is
+		// stopped
+		for {
+			if conn == nil {
+				conn, err = b.dial()
+			}
+			if err == nil {
+				if err = conn.Publish(b.Subject(event.Type), data); err == nil {
+					b.counters.Inc("n_eventbus_published")
+					delay = b.retryDelay
+					break
+				}
+				conn.Close()
+				conn = nil
+			}
+
+			b.counters.Inc("n_eventbus_failed")
+			slog.Warn("error publishing to event bus", "host", b.url.Host, "err", err, "retry_in", delay)
+
+			select {
+			case <-b.done:
+				b.counters.Inc("n_eventbus_dropped")
+				return
+			case <-time.After(delay):
+			}
+			if delay *= 2; delay > MaxEventBusRetryDelay {
+				delay = MaxEventBusRetryDelay
+			}
+		}
+	}
+}
+
+// Stop stops publishing events. Pending events are dropped.
+func (b *EventBus) Stop() {
+	close(b.done)
+	b.wg.Wait()
+	b.counters.IncBy("n_eventbus_dropped", int64(len(b.queue)))
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+const (
+	// MaxEventSubscribers is the maximum number of concurrent /events streams
+	MaxEventSubscribers = 256
+
+	// EventSubscriberBuffer is how many events may be pending for a
+	// subscriber before events are dropped for it
+	EventSubscriberBuffer = 64
+
+	// EventsKeepAlive is how often a comment is sent on idle /events streams
+	// so proxies don't time them out
+	EventsKeepAlive = 30 * time.Second
+)
+
+// ErrTooManySubscribers is returned when MaxEventSubscribers are subscribed
+var ErrTooManySubscribers = errors.New("error: too many event subscribers")
+
+// Broker fans events out to subscribers (e.g: /events streams) without
+// blocking publishers: events are dropped (and counted) for subscribers that
+// don't keep up.
+type Broker struct {
+	sync.Mutex
+
+	counters    *Counters
+	subscribers map[chan Event]struct{}
+	done        chan struct{}
+	closed      bool
+}
+
+// NewBroker ...
+func NewBroker(counters *Counters) *Broker {
+	return &Broker{
+		counters:    counters,
+		subscribers: make(map[chan Event]struct{}),
+		done:        make(chan struct{}),
+	}
+}
+
+// Subscribe returns a channel receiving every event published until
+// Unsubscribe is called
+func (b *Broker) Subscribe() (chan Event, error) {
+	b.Lock()
+	defer b.Unlock()
+
+	if len(b.subscribers) >= MaxEventSubscribers {
+		return nil, ErrTooManySubscribers
+	}
+
+	ch := make(chan Event, EventSubscriberBuffer)
+	b.subscribers[ch] = struct{}{}
+	b.counters.Gauge("n_events_subscribers", int64(len(b.subscribers)))
+	return ch, nil
+}
+
+// Unsubscribe ...
+func (b *Broker) Unsubscribe(ch chan Event) {
+	b.Lock()
+	defer b.Unlock()
+
+	delete(b.subscribers, ch)
+	b.counters.Gauge("n_events_subscribers", int64(len(b.subscribers)))
+}
+
+// Publish sends the event to every subscriber
+func (b *Broker) Publish(event Event) {
+	b.Lock()
+	defer b.Unlock()
+
+	for ch := range b.subscribers {
+		select {
+		case ch <- event:
+		default:
+			b.counters.Inc("n_events_dropped")
+		}
+	}
+}
+
+// Done is closed when the broker is closed
+func (b *Broker) Done() <-chan struct{} {
+	return b.done
+}
+
+// Close ends all subscriptions (e.g: on shutdown, so streams don't keep the
+// server from shutting down)
+func (b *Broker) Close() {
+	b.Lock()
+	defer b.Unlock()
+
+	if !b.closed {
+		b.closed = true
+		close(b.done)
+	}
+}
+
+// EventsHandler streams events as they happen as server-sent events
+// (text/event-stream): history entries as they are recorded and bookmarks
+// as they are created, updated or deleted. ?types= restricts the stream to
+// a comma separated list of event types, e.g: /events?types=history
+func (s *Server) EventsHandler() httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+		flusher, ok := w.(http.Flusher)
+		if !ok {
+			http.Error(w, "Streaming not supported", http.StatusInternalServerError)
+			return
+		}
+
+		types := make(map[string]bool)
+		for _, t := range strings.Split(r.URL.Query().Get("types"), ",") {
+			if t = strings.TrimSpace(t); t != "" {
+				types[t] = true
+			}
+		}
+
+		events, err := s.broker.Subscribe()
+		if err != nil {
+			http.Error(w, "Service Unavailable: "+err.Error(), http.StatusServiceUnavailable)
+			return
+		}
+		defer s.broker.Unsubscribe(events)
+
+		s.counters.Inc("n_events_streams")
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Header().Set("X-Accel-Buffering", "no")
+		w.WriteHeader(http.StatusOK)
+		fmt.Fprint(w, ": connected\n\n")
+		flusher.Flush()
+
+		keepAlive := time.NewTicker(EventsKeepAlive)
+		defer keepAlive.Stop()
+
+		for {
+			select {
+			case event := <-events:
+				if len(types) > 0 && !types[event.Type] {
+					continue
+				}
+				data, err := json.Marshal(event)
+				if err != nil {
+					continue
+				}
+				if event.ID != "" {
+					fmt.Fprintf(w, "id: %s\n", event.ID)
+				}
+				fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event.Type, data)
+				flusher.Flush()
+			case <-keepAlive.C:
+				fmt.Fprint(w, ": keep-alive\n\n")
+				flusher.Flush()
+			case <-r.Context().Done():
+				return
+			case <-s.broker.Done():
+				return
+			}
+		}
+	}
+}
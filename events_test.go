@@ -0,0 +1,109 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBroker(t *testing.T) {
+	assert := assert.New(t)
+
+	b := NewBroker(NewCounters())
+
+	ch, err := b.Subscribe()
+	assert.NoError(err)
+
+	b.Publish(Event{Type: EventBookmarkCreated, Name: "gh"})
+	assert.Equal("gh", (<-ch).Name)
+
+	// Slow subscribers miss events rather than blocking publishers
+	for i := 0; i < EventSubscriberBuffer+1; i++ {
+		b.Publish(Event{Type: EventHistory})
+	}
+	assert.Len(ch, EventSubscriberBuffer)
+
+	b.Unsubscribe(ch)
+	for i := 0; i < MaxEventSubscribers; i++ {
+		_, err := b.Subscribe()
+		assert.NoError(err)
+	}
+	_, err = b.Subscribe()
+	assert.Equal(ErrTooManySubscribers, err)
+
+	b.Close()
+	b.Close()
+	<-b.Done()
+}
+
+func TestEventsHandler(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir("", "golinks")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	db, err = OpenStore(filepath.Join(dir, "test.db"))
+	assert.NoError(err)
+	defer db.Close()
+
+	s, err := NewServer(":8000", Config{})
+	assert.NoError(err)
+
+	store := db
+	db = NewEventsStore(store, s.publish)
+	defer func() { db = store }()
+
+	ts := httptest.NewServer(s.server.Handler)
+	defer ts.Close()
+
+	res, err := http.Get(ts.URL + "/events?types=history,bookmark.created")
+	assert.NoError(err)
+	defer res.Body.Close()
+	assert.Equal("text/event-stream", res.Header.Get("Content-Type"))
+	assert.Empty(res.Header.Get("Content-Encoding"))
+
+	lines := bufio.NewScanner(res.Body)
+	next := func() (event string, data Event) {
+		for lines.Scan() {
+			line := lines.Text()
+			switch {
+			case strings.HasPrefix(line, "event: "):
+				event = strings.TrimPrefix(line, "event: ")
+			case strings.HasPrefix(line, "data: "):
+				assert.NoError(json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), &data))
+			case line == "" && event != "":
+				return
+			}
+		}
+		return
+	}
+
+	assert.NoError(SaveBookmark("gh", "https://github.com/%s"))
+	event, data := next()
+	assert.Equal(EventBookmarkCreated, event)
+	assert.Equal("gh", data.Name)
+
+	// The redirect event is filtered out, the history entry is not
+	r, _ := http.NewRequest("GET", "/?q=gh+golinks", nil)
+	s.router.ServeHTTP(httptest.NewRecorder(), r)
+	event, data = next()
+	assert.Equal(EventHistory, event)
+	assert.Equal("gh golinks", data.Query)
+	assert.Equal("https://github.com/golinks", data.URL)
+	assert.NotEmpty(data.ID)
+
+	// Closing the broker ends the stream
+	s.broker.Close()
+	for lines.Scan() {
+	}
+	assert.NoError(lines.Err())
+}
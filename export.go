@@ -0,0 +1,70 @@
+package main
+
+import (
+	"fmt"
+	"html"
+	"io"
+	"log/slog"
+	"net/http"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+const netscapeHeader = `<!DOCTYPE NETSCAPE-Bookmark-file-1>
+<!-- This is an automatically generated file.
+     It will be read and overwritten.
+     DO NOT EDIT! -->
+<META HTTP-EQUIV="Content-Type" CONTENT="text/html; charset=UTF-8">
+<TITLE>Bookmarks</TITLE>
+<H1>Bookmarks</H1>
+`
+
+// WriteNetscapeBookmarks writes the bookmarks in the Netscape bookmark
+// format understood by all browsers and most bookmark managers. Bookmarks
+// are placed in a folder with the given title and named by their golinks
+// name which is also used as the keyword (SHORTCUTURL) so that bookmarks
+// with a %s placeholder work as keyword searches in Firefox.
+func WriteNetscapeBookmarks(w io.Writer, folder string, bookmarks []Bookmark) error {
+	if _, err := io.WriteString(w, netscapeHeader); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(w, "<DL><p>\n")
+	fmt.Fprintf(w, "    <DT><H3>%s</H3>\n", html.EscapeString(folder))
+	fmt.Fprintf(w, "    <DL><p>\n")
+	for _, bookmark := range bookmarks {
+		fmt.Fprintf(
+			w, "        <DT><A HREF=\"%s\" SHORTCUTURL=\"%s\">%s</A>\n",
+			html.EscapeString(bookmark.URL()),
+			html.EscapeString(bookmark.Name()),
+			html.EscapeString(bookmark.Name()),
+		)
+	}
+	fmt.Fprintf(w, "    </DL><p>\n")
+	_, err := fmt.Fprintf(w, "</DL><p>\n")
+
+	return err
+}
+
+// ExportBookmarksHandler serves all bookmarks as a Netscape bookmark file
+func (s *Server) ExportBookmarksHandler() httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+		bookmarks, err := ListBookmarks()
+		if err != nil {
+			slog.Error("error listing bookmarks", "err", err)
+			http.Error(w, "Internal Error", http.StatusInternalServerError)
+			return
+		}
+
+		folder := s.settings().Title
+		if folder == "" {
+			folder = "golinks"
+		}
+
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Header().Set("Content-Disposition", `attachment; filename="bookmarks.html"`)
+		if err := WriteNetscapeBookmarks(w, folder, bookmarks); err != nil {
+			slog.Error("error writing bookmarks export", "err", err)
+		}
+	}
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWriteNetscapeBookmarks(t *testing.T) {
+	assert := assert.New(t)
+
+	buf := &strings.Builder{}
+	err := WriteNetscapeBookmarks(buf, "Search & Links", []Bookmark{
+		{name: "g", url: "https://www.google.com/search?q=%s&btnK"},
+		{name: "gh", url: "https://github.com"},
+	})
+	assert.NoError(err)
+	assert.Contains(buf.String(), "<!DOCTYPE NETSCAPE-Bookmark-file-1>")
+	assert.Contains(buf.String(), "<H3>Search &amp; Links</H3>")
+	assert.Contains(
+		buf.String(),
+		`<A HREF="https://www.google.com/search?q=%s&amp;btnK" SHORTCUTURL="g">g</A>`,
+	)
+
+	bookmarks, err := ParseNetscapeBookmarks(strings.NewReader(buf.String()))
+	assert.NoError(err)
+	assert.Equal([]ImportedBookmark{
+		{
+			Title:  "g",
+			URL:    "https://www.google.com/search?q=%s&btnK",
+			Folder: []string{"Search & Links"},
+		},
+		{
+			Title:  "gh",
+			URL:    "https://github.com",
+			Folder: []string{"Search & Links"},
+		},
+	}, bookmarks)
+}
+
+func TestExportBookmarksHandler(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir("", "golinks")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	db, err = OpenStore(filepath.Join(dir, "test.db"))
+	assert.NoError(err)
+	defer db.Close()
+
+	assert.NoError(SaveBookmark("gh", "https://github.com"))
+
+	s, err := NewServer(":8000", Config{Title: "Search"})
+	assert.NoError(err)
+
+	w := httptest.NewRecorder()
+	r, _ := http.NewRequest("GET", "/export/bookmarks.html", nil)
+	s.router.ServeHTTP(w, r)
+	assert.Equal(http.StatusOK, w.Code)
+	assert.Equal("text/html; charset=utf-8", w.Header().Get("Content-Type"))
+	assert.Contains(w.Body.String(), "<H3>Search</H3>")
+	assert.Contains(w.Body.String(), `<A HREF="https://github.com" SHORTCUTURL="gh">gh</A>`)
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+)
+
+const (
+	// DefaultFallbackStatus is the status of redirects to the default url
+	DefaultFallbackStatus = http.StatusFound
+
+	// DefaultFallbackCacheControl prevents browsers and proxies caching
+	// redirects to the default url, which would outlive changing it
+	DefaultFallbackCacheControl = "no-store"
+)
+
+var redirectStatuses = map[int]bool{
+	http.StatusMovedPermanently:  true,
+	http.StatusFound:             true,
+	http.StatusSeeOther:          true,
+	http.StatusTemporaryRedirect: true,
+	http.StatusPermanentRedirect: true,
+}
+
+// checkFallback returns an error if the fallback redirect is misconfigured
+func checkFallback(config Config) error {
+	if config.FallbackStatus != 0 && !redirectStatuses[config.FallbackStatus] {
+		return fmt.Errorf(
+			"invalid -fallback-status %d (expected 301, 302, 303, 307 or 308)",
+			config.FallbackStatus,
+		)
+	}
+	return nil
+}
+
+// fallback redirects a query matching no command or bookmark to the default
+// url with the configured status and cache headers (independently of
+// bookmark redirects)
+func (s *Server) fallback(w http.ResponseWriter, r *http.Request, url string) {
+	status := s.config.FallbackStatus
+	if status == 0 {
+		status = DefaultFallbackStatus
+	}
+	if s.config.FallbackCacheControl != "" {
+		w.Header().Set("Cache-Control", s.config.FallbackCacheControl)
+	}
+	http.Redirect(w, r, url, status)
+}
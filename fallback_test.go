@@ -0,0 +1,59 @@
+package main
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFallbackRedirect(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir("", "golinks")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	db, err = OpenStore(filepath.Join(dir, "test.db"))
+	assert.NoError(err)
+	defer db.Close()
+
+	assert.NoError(SaveBookmark("gh", "https://github.com/%s"))
+
+	get := func(s *Server, path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r, _ := http.NewRequest("GET", path, nil)
+		s.router.ServeHTTP(w, r)
+		return w
+	}
+
+	// Defaults: the status is unchanged but the redirect isn't cached
+	s, err := NewServer(":8000", Config{URL: DefaultURL})
+	assert.NoError(err)
+	w := get(s, "/?q=foo")
+	assert.Equal(http.StatusFound, w.Code)
+	assert.Empty(w.Header().Get("Cache-Control"))
+
+	s, err = NewServer(":8000", Config{
+		URL:                  DefaultURL,
+		FallbackStatus:       http.StatusTemporaryRedirect,
+		FallbackCacheControl: DefaultFallbackCacheControl,
+	})
+	assert.NoError(err)
+
+	w = get(s, "/?q=foo")
+	assert.Equal(http.StatusTemporaryRedirect, w.Code)
+	assert.Equal("no-store", w.Header().Get("Cache-Control"))
+
+	// Bookmarks are unaffected
+	w = get(s, "/?q=gh+golinks")
+	assert.Equal(http.StatusFound, w.Code)
+	assert.Empty(w.Header().Get("Cache-Control"))
+
+	_, err = NewServer(":8000", Config{FallbackStatus: http.StatusOK})
+	assert.Error(err)
+}
@@ -0,0 +1,191 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+const (
+	// FederatedHeader marks resolve requests made on behalf of a peer so
+	// they are only resolved locally (avoiding loops between peers)
+	FederatedHeader = "X-Golinks-Federated"
+
+	// MaxResolveBytes is the maximum size of a peer's resolve response
+	MaxResolveBytes = 64 * 1024
+)
+
+// Resolution is a bookmark resolved by name, either locally or by a peer
+type Resolution struct {
+	Name string `json:"name"`
+	URL  string `json:"url"`
+	Peer string `json:"peer,omitempty"`
+}
+
+// ParsePeers parses a comma separated list of peer instance urls
+func ParsePeers(s string) ([]string, error) {
+	var peers []string
+	for _, peer := range strings.Split(s, ",") {
+		peer = strings.TrimRight(strings.TrimSpace(peer), "/")
+		if peer == "" {
+			continue
+		}
+		u, err := url.Parse(peer)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return nil, fmt.Errorf("invalid peer url %q", peer)
+		}
+		peers = append(peers, peer)
+	}
+	return peers, nil
+}
+
+// Federation resolves names not found locally by asking sibling instances,
+// so e.g: department level instances can fall back to the company wide one.
+// Peers are queried in order and the first match wins.
+type Federation struct {
+	peers    []string
+	client   *http.Client
+	counters *Counters
+}
+
+// NewFederation ...
+func NewFederation(peers []string, timeout time.Duration, counters *Counters) *Federation {
+	return &Federation{
+		peers: peers,
+		client: &http.Client{
+			Timeout:   timeout,
+			Transport: client.Transport,
+		},
+		counters: counters,
+	}
+}
+
+// Peers ...
+func (f *Federation) Peers() []string {
+	return f.peers
+}
+
+// resolveRemote asks the golinks instance at base to resolve the name
+func resolveRemote(c *http.Client, base, name string) (res Resolution, ok bool, err error) {
+	req, err := http.NewRequest(
+		"GET",
+		fmt.Sprintf("%s/api/v1/resolve?name=%s", base, url.QueryEscape(name)),
+		nil,
+	)
+	if err != nil {
+		return
+	}
+	req.Header.Set(FederatedHeader, "1")
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := c.Do(req)
+	if err != nil {
+		return
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		return
+	default:
+		err = fmt.Errorf("unexpected status %s", resp.Status)
+		return
+	}
+
+	data, err := ioutil.ReadAll(io.LimitReader(resp.Body, MaxResolveBytes))
+	if err != nil {
+		return
+	}
+	if err = json.Unmarshal(data, &res); err != nil {
+		return
+	}
+	if res.URL == "" {
+		err = fmt.Errorf("response has no url")
+		return
+	}
+
+	res.Peer = base
+	return res, true, nil
+}
+
+// Resolve asks each peer in turn to resolve the name
+func (f *Federation) Resolve(name string) (Resolution, bool) {
+	for _, peer := range f.peers {
+		res, ok, err := resolveRemote(f.client, peer, name)
+		if err != nil {
+			f.counters.Inc("n_federation_error")
+			slog.Error("error resolving from peer", "name", name, "peer", peer, "err", err)
+			continue
+		}
+		if ok {
+			f.counters.Inc("n_federation_hit")
+			return res, true
+		}
+	}
+
+	f.counters.Inc("n_federation_miss")
+	return Resolution{}, false
+}
+
+// resolveRemote resolves a name not found locally from the peers and then
+// the catalog (if any)
+func (s *Server) resolveRemote(name string) (Resolution, bool) {
+	if s.federation != nil {
+		if res, ok := s.federation.Resolve(name); ok {
+			return res, true
+		}
+	}
+	if s.catalog != nil {
+		return s.catalog.Resolve(name)
+	}
+	return Resolution{}, false
+}
+
+// resolvePeers resolves a name not found locally from the peers or catalog
+func (s *Server) resolvePeers(name string) (Bookmark, bool) {
+	res, ok := s.resolveRemote(name)
+	if !ok {
+		return Bookmark{}, false
+	}
+	return Bookmark{name: res.Name, url: res.URL}, true
+}
+
+// ResolveHandler resolves a bookmark by name (or alias), falling back to
+// peers and the catalog unless the request was itself made by a peer
+func (s *Server) ResolveHandler() httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+		s.counters.Inc("n_resolve")
+
+		name := r.URL.Query().Get("name")
+		if name == "" {
+			WriteAPIError(w, r, http.StatusBadRequest, ErrCodeBadRequest, "name is required", nil)
+			return
+		}
+
+		if bookmark, ok := LookupBookmark(name); ok {
+			WriteJSON(w, http.StatusOK, Resolution{Name: bookmark.Name(), URL: bookmark.URL()})
+			return
+		}
+
+		if r.Header.Get(FederatedHeader) == "" {
+			if res, ok := s.resolveRemote(name); ok {
+				WriteJSON(w, http.StatusOK, res)
+				return
+			}
+		}
+
+		WriteAPIError(
+			w, r, http.StatusNotFound, ErrCodeNotFound,
+			fmt.Sprintf("no bookmark named %s", name), nil,
+		)
+	}
+}
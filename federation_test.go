@@ -0,0 +1,107 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParsePeers(t *testing.T) {
+	assert := assert.New(t)
+
+	peers, err := ParsePeers(" https://go.example.com/, http://go.dept.example.com ,")
+	assert.NoError(err)
+	assert.Equal([]string{"https://go.example.com", "http://go.dept.example.com"}, peers)
+
+	peers, err = ParsePeers("")
+	assert.NoError(err)
+	assert.Empty(peers)
+
+	_, err = ParsePeers("go.example.com")
+	assert.Error(err)
+}
+
+func TestFederation(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir("", "golinks")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	db, err = OpenStore(filepath.Join(dir, "test.db"))
+	assert.NoError(err)
+	defer db.Close()
+
+	assert.NoError(SaveBookmark("local", "https://local.example.com/%s"))
+
+	var federated []string
+	peer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		federated = append(federated, r.Header.Get(FederatedHeader))
+		if r.URL.Query().Get("name") != "wiki" {
+			WriteAPIError(w, r, http.StatusNotFound, ErrCodeNotFound, "not found", nil)
+			return
+		}
+		WriteJSON(w, http.StatusOK, Resolution{Name: "wiki", URL: "https://wiki.example.com/?q=%s"})
+	}))
+	defer peer.Close()
+
+	broken := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+	}))
+	defer broken.Close()
+
+	s, err := NewServer(":8000", Config{
+		Peers:       []string{broken.URL, peer.URL},
+		PeerTimeout: time.Second,
+	})
+	assert.NoError(err)
+
+	// Names not found locally are redirected via a peer
+	w := httptest.NewRecorder()
+	r, _ := http.NewRequest("GET", "/?q=wiki+golinks", nil)
+	s.router.ServeHTTP(w, r)
+	assert.Equal(http.StatusFound, w.Code)
+	assert.Equal("https://wiki.example.com/?q=golinks", w.Header().Get("Location"))
+	assert.Equal([]string{"1"}, federated)
+
+	// Local bookmarks take precedence
+	w = httptest.NewRecorder()
+	r, _ = http.NewRequest("GET", "/api/v1/resolve?name=local", nil)
+	s.router.ServeHTTP(w, r)
+	assert.Equal(http.StatusOK, w.Code)
+	var res Resolution
+	assert.NoError(json.Unmarshal(w.Body.Bytes(), &res))
+	assert.Equal(Resolution{Name: "local", URL: "https://local.example.com/%s"}, res)
+
+	w = httptest.NewRecorder()
+	r, _ = http.NewRequest("GET", "/api/v1/resolve?name=wiki", nil)
+	s.router.ServeHTTP(w, r)
+	assert.Equal(http.StatusOK, w.Code)
+	assert.NoError(json.Unmarshal(w.Body.Bytes(), &res))
+	assert.Equal(peer.URL, res.Peer)
+
+	// Requests from peers are only resolved locally
+	w = httptest.NewRecorder()
+	r, _ = http.NewRequest("GET", "/api/v1/resolve?name=wiki", nil)
+	r.Header.Set(FederatedHeader, "1")
+	s.router.ServeHTTP(w, r)
+	assert.Equal(http.StatusNotFound, w.Code)
+
+	w = httptest.NewRecorder()
+	r, _ = http.NewRequest("GET", "/api/v1/resolve", nil)
+	s.router.ServeHTTP(w, r)
+	assert.Equal(http.StatusBadRequest, w.Code)
+
+	_, ok := s.federation.Resolve("missing")
+	assert.False(ok)
+
+	_, err = NewServer(":8000", Config{Offline: true, Peers: []string{peer.URL}})
+	assert.Error(err)
+}
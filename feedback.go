@@ -0,0 +1,152 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/prologic/bitcask"
+)
+
+// Feedback is how often people answered whether a bookmark took them to
+// the right place, a signal of which links mislead people
+type Feedback struct {
+	Name     string    `json:"name"`
+	Yes      int64     `json:"yes"`
+	No       int64     `json:"no"`
+	LastVote time.Time `json:"last_vote"`
+}
+
+func feedbackKey(name string) []byte {
+	return []byte(fmt.Sprintf("feedback_%s", name))
+}
+
+// GetFeedback returns the feedback on a bookmark (none if never given)
+func GetFeedback(name string) (Feedback, error) {
+	feedback := Feedback{Name: name}
+
+	data, err := db.Get(feedbackKey(name))
+	if err == bitcask.ErrKeyNotFound {
+		return feedback, nil
+	}
+	if err != nil {
+		return feedback, err
+	}
+	if err := json.Unmarshal(data, &feedback); err != nil {
+		return feedback, err
+	}
+	feedback.Name = name
+	return feedback, nil
+}
+
+// RecordFeedback records whether a bookmark took someone to the right place
+func RecordFeedback(name string, right bool) error {
+	feedback, err := GetFeedback(name)
+	if err != nil {
+		return err
+	}
+	if right {
+		feedback.Yes++
+	} else {
+		feedback.No++
+	}
+	feedback.LastVote = time.Now().UTC()
+
+	data, err := json.Marshal(feedback)
+	if err != nil {
+		return err
+	}
+	return db.Put(feedbackKey(name), data)
+}
+
+// ListFeedback returns the feedback on all bookmarks, those that mislead
+// people most often first
+func ListFeedback() ([]Feedback, error) {
+	all := []Feedback{}
+	err := db.Scan([]byte("feedback_"), func(key []byte) error {
+		feedback, err := GetFeedback(strings.TrimPrefix(string(key), "feedback_"))
+		if err != nil {
+			return err
+		}
+		all = append(all, feedback)
+		return nil
+	})
+	sort.Slice(all, func(i, j int) bool {
+		if all[i].No != all[j].No {
+			return all[i].No > all[j].No
+		}
+		if all[i].Yes != all[j].Yes {
+			return all[i].Yes < all[j].Yes
+		}
+		return all[i].Name < all[j].Name
+	})
+	return all, err
+}
+
+// feedbackReturn returns where to send people back to after they gave
+// feedback: the page they gave it on if it is on this instance
+func feedbackReturn(r *http.Request) string {
+	u, err := url.Parse(r.Referer())
+	if err != nil || u.Host != r.Host {
+		return "/"
+	}
+	return localPath(u.RequestURI())
+}
+
+// FeedbackHandler records the answer of the "was this the right place?"
+// widget (form name and right=yes|no) and sends people back where they
+// were
+func (s *Server) FeedbackHandler() httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+		if s.config.ReadOnly {
+			http.Error(w, "Forbidden: instance is read-only", http.StatusForbidden)
+			return
+		}
+
+		name := strings.ToLower(strings.TrimSpace(r.FormValue("name")))
+		right := r.FormValue("right")
+		if right != "yes" && right != "no" {
+			http.Error(w, "Bad Request: right must be yes or no", http.StatusBadRequest)
+			return
+		}
+		if _, ok := LookupBookmark(name); !ok {
+			http.Error(w, fmt.Sprintf("Not Found: no bookmark named %s", name), http.StatusNotFound)
+			return
+		}
+
+		if err := RecordFeedback(name, right == "yes"); err != nil {
+			slog.Error("error recording feedback", "name", name, "err", err)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+		s.counters.Inc("n_feedback_" + right)
+
+		next := feedbackReturn(r)
+		sep := "?"
+		if strings.Contains(next, "?") {
+			sep = "&"
+		}
+		http.Redirect(w, r, next+sep+"feedback=thanks", http.StatusSeeOther)
+	}
+}
+
+// FeedbackAPIHandler returns the feedback on all bookmarks, those that
+// mislead people most often first
+func (s *Server) FeedbackAPIHandler() httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+		s.counters.Inc("n_api_feedback")
+
+		all, err := ListFeedback()
+		if err != nil {
+			WriteAPIError(w, r, http.StatusInternalServerError, ErrCodeInternal, "error reading feedback", err.Error())
+			return
+		}
+		WriteJSON(w, http.StatusOK, map[string]interface{}{"feedback": all})
+	}
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFeedback(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir("", "golinks")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	db, err = OpenStore(filepath.Join(dir, "test.db"))
+	assert.NoError(err)
+	defer db.Close()
+
+	assert.NoError(RecordFeedback("gh", true))
+	assert.NoError(RecordFeedback("gh", true))
+	assert.NoError(RecordFeedback("wiki", false))
+	assert.NoError(RecordFeedback("wiki", true))
+	assert.NoError(RecordFeedback("jira", true))
+
+	feedback, err := GetFeedback("wiki")
+	assert.NoError(err)
+	assert.Equal(int64(1), feedback.Yes)
+	assert.Equal(int64(1), feedback.No)
+	assert.False(feedback.LastVote.IsZero())
+
+	// Most misleading first
+	all, err := ListFeedback()
+	assert.NoError(err)
+	if assert.Len(all, 3) {
+		assert.Equal("wiki", all[0].Name)
+		assert.Equal("jira", all[1].Name)
+		assert.Equal("gh", all[2].Name)
+	}
+}
+
+func TestFeedbackHandler(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir("", "golinks")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	db, err = OpenStore(filepath.Join(dir, "test.db"))
+	assert.NoError(err)
+	defer db.Close()
+
+	assert.NoError(SaveBookmark("gh", "https://github.com/%s"))
+
+	s, err := NewServer(":8000", Config{})
+	assert.NoError(err)
+
+	vote := func(name, right, referer string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		form := url.Values{"name": {name}, "right": {right}}
+		r, _ := http.NewRequest("POST", "/feedback", strings.NewReader(form.Encode()))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		r.Host = "go.example.com"
+		r.Header.Set("Referer", referer)
+		withCSRF(r)
+		s.router.ServeHTTP(w, r)
+		return w
+	}
+
+	// People are sent back to the page they gave feedback on
+	w := vote("gh", "no", "http://go.example.com/debug/resolve?q=gh")
+	assert.Equal(http.StatusSeeOther, w.Code)
+	assert.Equal("/debug/resolve?q=gh&feedback=thanks", w.Header().Get("Location"))
+
+	// But never to another site
+	w = vote("gh", "yes", "https://evil.com/")
+	assert.Equal(http.StatusSeeOther, w.Code)
+	assert.Equal("/?feedback=thanks", w.Header().Get("Location"))
+
+	assert.Equal(http.StatusBadRequest, vote("gh", "maybe", "").Code)
+	assert.Equal(http.StatusNotFound, vote("nope", "yes", "").Code)
+
+	w = httptest.NewRecorder()
+	r, _ := http.NewRequest("GET", "/api/v1/feedback", nil)
+	authorize(r, ScopeRead)
+	s.router.ServeHTTP(w, r)
+	assert.Equal(http.StatusOK, w.Code)
+
+	var res struct {
+		Feedback []Feedback `json:"feedback"`
+	}
+	assert.NoError(json.Unmarshal(w.Body.Bytes(), &res))
+	if assert.Len(res.Feedback, 1) {
+		assert.Equal(Feedback{Name: "gh", Yes: 1, No: 1, LastVote: res.Feedback[0].LastVote}, res.Feedback[0])
+	}
+
+	// The widget is shown where a query is resolved to a bookmark
+	w = httptest.NewRecorder()
+	r, _ = http.NewRequest("GET", "/debug/resolve?q=gh+prologic", nil)
+	authorize(r, ScopeAdmin)
+	s.router.ServeHTTP(w, r)
+	assert.Equal(http.StatusOK, w.Code)
+	assert.Contains(w.Body.String(), `action="/feedback"`)
+	assert.Contains(w.Body.String(), `name="name" value="gh"`)
+
+	// Read-only instances don't collect feedback
+	s.config.ReadOnly = true
+	assert.Equal(http.StatusForbidden, vote("gh", "yes", "").Code)
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultFetchConcurrency is the number of concurrent background fetches
+	DefaultFetchConcurrency = 4
+
+	// DefaultFetchHostDelay is the minimum delay between background fetches
+	// from the same host
+	DefaultFetchHostDelay = time.Second
+
+	// fetchQueueSize is the number of fetches that can be queued per worker
+	fetchQueueSize = 256
+)
+
+// ErrFetchQueueFull is returned when a fetch cannot be queued
+var ErrFetchQueueFull = errors.New("error: fetch queue is full")
+
+// ErrFetchPoolStopped is returned when submitting to a stopped pool
+var ErrFetchPoolStopped = errors.New("error: fetch pool is stopped")
+
+type fetchJob struct {
+	host string
+	fn   func()
+}
+
+// FetchPool runs the background fetches of all subsystems (link checks,
+// favicons, archiving, ...) on a shared, bounded number of workers and
+// spaces out fetches from the same host, so background work can't saturate
+// the network or upstream services.
+type FetchPool struct {
+	sync.Mutex
+
+	delay    time.Duration
+	counters *Counters
+
+	jobs    chan fetchJob
+	next    map[string]time.Time
+	stopped bool
+	quit    chan struct{}
+	wg      sync.WaitGroup
+	pending sync.WaitGroup
+}
+
+// NewFetchPool starts a pool of concurrency workers that wait at least
+// delay between fetches from the same host
+func NewFetchPool(concurrency int, delay time.Duration, counters *Counters) *FetchPool {
+	if concurrency <= 0 {
+		concurrency = DefaultFetchConcurrency
+	}
+
+	p := &FetchPool{
+		delay:    delay,
+		counters: counters,
+		jobs:     make(chan fetchJob, concurrency*fetchQueueSize),
+		next:     make(map[string]time.Time),
+		quit:     make(chan struct{}),
+	}
+
+	for i := 0; i < concurrency; i++ {
+		p.wg.Add(1)
+		go p.worker()
+	}
+
+	return p
+}
+
+// reserve reserves the next slot to fetch from host and returns how long to
+// wait for it
+func (p *FetchPool) reserve(host string) time.Duration {
+	p.Lock()
+	defer p.Unlock()
+
+	now := time.Now()
+	slot := now
+	if next, ok := p.next[host]; ok && next.After(now) {
+		slot = next
+	}
+	p.next[host] = slot.Add(p.delay)
+
+	// Forget hosts that haven't been fetched from in a while
+	if len(p.next) > 1024 {
+		for h, next := range p.next {
+			if next.Before(now) {
+				delete(p.next, h)
+			}
+		}
+	}
+
+	return slot.Sub(now)
+}
+
+func (p *FetchPool) worker() {
+	defer p.wg.Done()
+
+	for job := range p.jobs {
+		select {
+		case <-p.quit:
+			// Stopped, drop the remaining queued fetches
+			p.pending.Done()
+			continue
+		case <-time.After(p.reserve(job.host)):
+		}
+		job.fn()
+		p.counters.Inc("n_fetch")
+		p.pending.Done()
+	}
+}
+
+// Submit queues fn which fetches from host. It never blocks: if the queue is
+// full the fetch is dropped and ErrFetchQueueFull returned.
+func (p *FetchPool) Submit(host string, fn func()) error {
+	p.Lock()
+	defer p.Unlock()
+
+	if p.stopped {
+		return ErrFetchPoolStopped
+	}
+
+	p.pending.Add(1)
+	select {
+	case p.jobs <- fetchJob{host: host, fn: fn}:
+		return nil
+	default:
+		p.pending.Done()
+		p.counters.Inc("n_fetch_dropped")
+		return ErrFetchQueueFull
+	}
+}
+
+// Wait waits for the fetches queued so far to run
+func (p *FetchPool) Wait() {
+	p.pending.Wait()
+}
+
+// Stop stops accepting fetches, drops queued fetches and waits for
+// in-flight fetches to finish
+func (p *FetchPool) Stop() {
+	p.Lock()
+	if p.stopped {
+		p.Unlock()
+		return
+	}
+	p.stopped = true
+	close(p.quit)
+	close(p.jobs)
+	p.Unlock()
+
+	p.wg.Wait()
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFetchPoolConcurrency(t *testing.T) {
+	assert := assert.New(t)
+
+	p := NewFetchPool(2, 0, NewCounters())
+
+	var running, max, done int32
+	for i := 0; i < 10; i++ {
+		assert.NoError(p.Submit(string(rune('a'+i)), func() {
+			n := atomic.AddInt32(&running, 1)
+			for {
+				m := atomic.LoadInt32(&max)
+				if n <= m || atomic.CompareAndSwapInt32(&max, m, n) {
+					break
+				}
+			}
+			time.Sleep(10 * time.Millisecond)
+			atomic.AddInt32(&running, -1)
+			atomic.AddInt32(&done, 1)
+		}))
+	}
+
+	// Wait for the queue to drain before stopping
+	for atomic.LoadInt32(&done) < 10 {
+		time.Sleep(time.Millisecond)
+	}
+	p.Stop()
+
+	assert.Equal(int32(2), max)
+	assert.Equal(ErrFetchPoolStopped, p.Submit("a", func() {}))
+}
+
+func TestFetchPoolHostDelay(t *testing.T) {
+	assert := assert.New(t)
+
+	delay := 50 * time.Millisecond
+	p := NewFetchPool(4, delay, NewCounters())
+
+	var (
+		mu    sync.Mutex
+		times = make(map[string][]time.Time)
+		wg    sync.WaitGroup
+	)
+	start := time.Now()
+	for _, host := range []string{"a", "a", "a", "b"} {
+		host := host
+		wg.Add(1)
+		assert.NoError(p.Submit(host, func() {
+			mu.Lock()
+			times[host] = append(times[host], time.Now())
+			mu.Unlock()
+			wg.Done()
+		}))
+	}
+	wg.Wait()
+	p.Stop()
+
+	// Fetches from the same host wait for their slot, whenever the
+	// previous one happened to start
+	assert.Len(times["a"], 3)
+	for i, t := range times["a"] {
+		assert.True(t.Sub(start) >= time.Duration(i)*delay)
+	}
+	assert.Len(times["b"], 1)
+	assert.True(times["b"][0].Sub(start) < delay)
+}
+
+func TestFetchPoolQueueFull(t *testing.T) {
+	assert := assert.New(t)
+
+	p := NewFetchPool(1, 0, NewCounters())
+
+	block := make(chan struct{})
+	var err error
+	for i := 0; i <= fetchQueueSize+1 && err == nil; i++ {
+		err = p.Submit("a", func() { <-block })
+	}
+	assert.Equal(ErrFetchQueueFull, err)
+
+	close(block)
+	p.Stop()
+}
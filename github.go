@@ -0,0 +1,342 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+const (
+	// GitHubSessionTTL is how long members stay logged in for by default.
+	// It is short so users removed from an org or team soon can't edit
+	// anymore.
+	GitHubSessionTTL = 24 * time.Hour
+
+	// githubStateCookie is the cookie of a login in progress
+	githubStateCookie = "golinks_github"
+
+	// GitHubCallbackPath is where GitHub redirects users back to
+	GitHubCallbackPath = "/auth/github/callback"
+)
+
+// ErrNoAccessToken is returned when GitHub doesn't exchange a code for an
+// access token (e.g. it expired or was already used)
+var ErrNoAccessToken = errors.New("error: no access token")
+
+// editCommands are the commands that add or edit bookmarks
+var editCommands = map[string]bool{
+	"add":    true,
+	"remove": true,
+}
+
+// editPaths are the pages that add or edit bookmarks when posted to
+var editPaths = map[string]bool{
+	"/history/save":    true,
+	"/linkrot/archive": true,
+}
+
+// editing reports whether a request adds or edits bookmarks, either as a
+// query (e.g: /?q=add gh https://github.com/%s or /add/gh/...) or a form
+func editing(r *http.Request) bool {
+	if r.Method == "POST" && editPaths[r.URL.Path] {
+		return true
+	}
+
+	var cmd string
+	if r.URL.Path == "/" {
+		q := queryParam(r.URL.RawQuery, "q")
+		if q == "" && r.Method == "POST" {
+			q = r.FormValue("q")
+		}
+		cmd, _, _ = strings.Cut(q, " ")
+	} else {
+		// Split paths like NotFoundHandler does, e.g: //add/gh/... is add
+		for _, token := range strings.Split(r.URL.Path, "/") {
+			if token != "" {
+				cmd = token
+				break
+			}
+		}
+	}
+	return editCommands[strings.ToLower(cmd)]
+}
+
+// githubLogin is a login in progress, signed into the state cookie
+type githubLogin struct {
+	State   string `json:"state"`
+	Next    string `json:"next"`
+	Expires int64  `json:"exp"`
+}
+
+// GitHub logs users in with GitHub (OAuth) so only members of some orgs or
+// teams can add or edit bookmarks, while redirects and everything else
+// stay public.
+type GitHub struct {
+	clientID     string
+	clientSecret string
+	redirectURL  string
+	orgs         []string
+	counters     *Counters
+
+	// signer signs the state cookie with a key derived from the client
+	// secret
+	signer
+
+	// baseURL is where users log in and apiURL where their memberships
+	// are looked up (GitHub Enterprise or a fake in tests)
+	baseURL string
+	apiURL  string
+
+	now func() time.Time
+}
+
+// NewGitHub returns a GitHub login only allowing members of orgs, each an
+// org (e.g. golang) or a team of an org (e.g. golang/core)
+func NewGitHub(clientID, clientSecret, redirectURL string, orgs []string, counters *Counters) *GitHub {
+	return &GitHub{
+		clientID:     clientID,
+		clientSecret: clientSecret,
+		redirectURL:  redirectURL,
+		orgs:         orgs,
+		counters:     counters,
+		signer:       newSigner(clientSecret),
+		baseURL:      "https://github.com",
+		apiURL:       "https://api.github.com",
+		now:          time.Now,
+	}
+}
+
+// ParseOrgs parses a comma separated list of orgs and org/team
+func ParseOrgs(s string) []string {
+	var orgs []string
+	for _, org := range strings.Split(s, ",") {
+		org = strings.ToLower(strings.Trim(strings.TrimSpace(org), "/"))
+		if org != "" {
+			orgs = append(orgs, org)
+		}
+	}
+	return orgs
+}
+
+// allowed reports whether a user with the memberships (orgs and org/team,
+// in lower case) can add or edit bookmarks
+func (g *GitHub) allowed(memberships []string) bool {
+	for _, membership := range memberships {
+		for _, org := range g.orgs {
+			if membership == org {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// exchange exchanges the code of a login for an access token
+func (g *GitHub) exchange(code, redirectURL string) (string, error) {
+	form := url.Values{
+		"client_id":     {g.clientID},
+		"client_secret": {g.clientSecret},
+		"code":          {code},
+		"redirect_uri":  {redirectURL},
+	}
+	req, err := http.NewRequest("POST", g.baseURL+"/login/oauth/access_token", strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+
+	res, err := client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("error exchanging code: unexpected status %s", res.Status)
+	}
+
+	var token struct {
+		AccessToken string `json:"access_token"`
+		Error       string `json:"error"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&token); err != nil {
+		return "", fmt.Errorf("error exchanging code: %s", err)
+	}
+	if token.Error != "" {
+		return "", fmt.Errorf("error exchanging code: %s", token.Error)
+	}
+	if token.AccessToken == "" {
+		return "", ErrNoAccessToken
+	}
+	return token.AccessToken, nil
+}
+
+// get fetches path of the API as the user of the access token into v
+func (g *GitHub) get(token, path string, v interface{}) error {
+	req, err := http.NewRequest("GET", g.apiURL+path, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/vnd.github+json")
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	res, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("error fetching %s: unexpected status %s", path, res.Status)
+	}
+	if err := json.NewDecoder(res.Body).Decode(v); err != nil {
+		return fmt.Errorf("error fetching %s: %s", path, err)
+	}
+	return nil
+}
+
+// user returns the login of the user of the access token and their
+// memberships: their orgs and the teams of their orgs as org/team
+func (g *GitHub) user(token string) (string, []string, error) {
+	var user struct {
+		Login string `json:"login"`
+	}
+	if err := g.get(token, "/user", &user); err != nil {
+		return "", nil, err
+	}
+
+	var orgs []struct {
+		Login string `json:"login"`
+	}
+	if err := g.get(token, "/user/orgs?per_page=100", &orgs); err != nil {
+		return "", nil, err
+	}
+
+	var teams []struct {
+		Slug         string `json:"slug"`
+		Organization struct {
+			Login string `json:"login"`
+		} `json:"organization"`
+	}
+	if err := g.get(token, "/user/teams?per_page=100", &teams); err != nil {
+		return "", nil, err
+	}
+
+	var memberships []string
+	for _, org := range orgs {
+		memberships = append(memberships, strings.ToLower(org.Login))
+	}
+	for _, team := range teams {
+		memberships = append(memberships, strings.ToLower(team.Organization.Login+"/"+team.Slug))
+	}
+	return user.Login, memberships, nil
+}
+
+// Handler only serves requests to next that add or edit bookmarks (see
+// editing) from logged in members, unless they need no credentials (see
+// authenticated). Pages redirect users to log in and forms are answered
+// with a 401. Everything else is served to anyone.
+func (g *GitHub) Handler(next http.Handler, sessions *Sessions, replicationSecret string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if session, err := sessions.Session(r); err == nil {
+			next.ServeHTTP(w, withUser(r, session.User()))
+			return
+		}
+
+		if !editing(r) || authenticated(r, replicationSecret) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if r.Method != "GET" && r.Method != "HEAD" {
+			http.Error(w, "Unauthorized: login required to edit bookmarks", http.StatusUnauthorized)
+			return
+		}
+		http.Redirect(w, r, "/auth/login?next="+url.QueryEscape(r.URL.RequestURI()), http.StatusFound)
+	})
+}
+
+// GitHubLoginHandler redirects users to log in with GitHub, e.g:
+// /auth/login?next=/?q=add+gh+https://github.com/%s
+func (s *Server) GitHubLoginHandler() httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+		login := githubLogin{
+			State:   randomString(),
+			Next:    localPath(queryParam(r.URL.RawQuery, "next")),
+			Expires: s.github.now().Add(oidcLoginTTL).Unix(),
+		}
+		value, err := s.github.sign(login)
+		if err != nil {
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+		setCookie(w, r, githubStateCookie, "/auth/", value, oidcLoginTTL)
+
+		params := url.Values{
+			"client_id":    {s.github.clientID},
+			"redirect_uri": {callbackURL(r, s.github.redirectURL, GitHubCallbackPath)},
+			"scope":        {"read:org"},
+			"state":        {login.State},
+		}
+		http.Redirect(w, r, s.github.baseURL+"/login/oauth/authorize?"+params.Encode(), http.StatusFound)
+	}
+}
+
+// GitHubCallbackHandler logs members in once GitHub redirects them back
+// with a code, and redirects them to where they were going
+func (s *Server) GitHubCallbackHandler() httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+		fail := func(status int, msg string) {
+			s.counters.Inc("n_auth_failed")
+			http.Error(w, fmt.Sprintf("%s: %s", http.StatusText(status), msg), status)
+		}
+
+		var login githubLogin
+		cookie, err := r.Cookie(githubStateCookie)
+		if err != nil || s.github.verify(cookie.Value, &login) != nil || s.github.now().Unix() >= login.Expires {
+			fail(http.StatusBadRequest, "login expired, try again")
+			return
+		}
+		setCookie(w, r, githubStateCookie, "/auth/", "", -time.Second)
+
+		query := r.URL.Query()
+		if query.Get("state") != login.State {
+			fail(http.StatusBadRequest, "invalid login state")
+			return
+		}
+		if msg := query.Get("error"); msg != "" {
+			fail(http.StatusUnauthorized, fmt.Sprintf("login failed (%s)", msg))
+			return
+		}
+
+		token, err := s.github.exchange(query.Get("code"), callbackURL(r, s.github.redirectURL, GitHubCallbackPath))
+		if err != nil {
+			slog.Warn("error logging in with github", "err", err)
+			fail(http.StatusUnauthorized, "login failed")
+			return
+		}
+		user, memberships, err := s.github.user(token)
+		if err != nil {
+			slog.Error("error looking up github user", "err", err)
+			http.Error(w, "Bad Gateway: error contacting GitHub", http.StatusBadGateway)
+			return
+		}
+		if !s.github.allowed(memberships) {
+			slog.Warn("github user not allowed", "user", user)
+			fail(http.StatusForbidden, "you must be a member of an allowed org or team to edit bookmarks")
+			return
+		}
+
+		s.counters.Inc("n_github_logins")
+		slog.Info("logged in with github", "user", user)
+		s.loginSession(w, r, Session{Subject: user}, login.Next)
+	}
+}
@@ -0,0 +1,215 @@
+package main
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGitHub(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir("", "golinks")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	db, err = OpenStore(filepath.Join(dir, "test.db"))
+	assert.NoError(err)
+	defer db.Close()
+
+	assert.NoError(SaveBookmark("gh", "https://github.com/%s"))
+
+	// A fake GitHub where the code c0de logs in alice of golang/core and
+	// any other code logs in eve of no org
+	github := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/login/oauth/access_token":
+			assert.Equal("golinks", r.FormValue("client_id"))
+			assert.Equal("s3cr3t", r.FormValue("client_secret"))
+			WriteJSON(w, http.StatusOK, map[string]string{"access_token": r.FormValue("code")})
+		case "/user":
+			login := "alice"
+			if r.Header.Get("Authorization") != "Bearer c0de" {
+				login = "eve"
+			}
+			WriteJSON(w, http.StatusOK, map[string]string{"login": login})
+		case "/user/orgs":
+			if r.Header.Get("Authorization") != "Bearer c0de" {
+				WriteJSON(w, http.StatusOK, []interface{}{})
+				return
+			}
+			WriteJSON(w, http.StatusOK, []map[string]string{{"login": "golang"}})
+		case "/user/teams":
+			if r.Header.Get("Authorization") != "Bearer c0de" {
+				WriteJSON(w, http.StatusOK, []interface{}{})
+				return
+			}
+			WriteJSON(w, http.StatusOK, []map[string]interface{}{
+				{"slug": "core", "organization": map[string]string{"login": "Golang"}},
+			})
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer github.Close()
+
+	s, err := NewServer(":8000", Config{
+		GitHubClientID:     "golinks",
+		GitHubClientSecret: "s3cr3t",
+		GitHubOrgs:         "golang/core",
+	})
+	assert.NoError(err)
+	s.github.baseURL, s.github.apiURL = github.URL, github.URL
+
+	do := func(method, path string, cookies ...*http.Cookie) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r, _ := http.NewRequest(method, path, nil)
+		r.Host = "go.example.com"
+		for _, cookie := range cookies {
+			r.AddCookie(cookie)
+		}
+		s.server.Handler.ServeHTTP(w, r)
+		return w
+	}
+	cookie := func(w *httptest.ResponseRecorder, name string) *http.Cookie {
+		for _, cookie := range w.Result().Cookies() {
+			if cookie.Name == name {
+				return cookie
+			}
+		}
+		return nil
+	}
+	login := func(code string) *httptest.ResponseRecorder {
+		w := do("GET", "/auth/login?next=%2F%3Fq%3Dadd%2Bgo%2Bhttps%3A%2F%2Fgolang.org")
+		assert.Equal(http.StatusFound, w.Code)
+		u, err := url.Parse(w.Header().Get("Location"))
+		assert.NoError(err)
+		assert.Equal(github.URL+"/login/oauth/authorize", u.Scheme+"://"+u.Host+u.Path)
+		params := u.Query()
+		assert.Equal("golinks", params.Get("client_id"))
+		assert.Equal("http://go.example.com/auth/github/callback", params.Get("redirect_uri"))
+		assert.Equal("read:org", params.Get("scope"))
+		return do("GET", "/auth/github/callback?code="+code+"&state="+params.Get("state"), cookie(w, githubStateCookie))
+	}
+
+	// Redirects are public
+	w := do("GET", "/?q=gh+prologic")
+	assert.Equal(http.StatusFound, w.Code)
+	assert.Equal("https://github.com/prologic", w.Header().Get("Location"))
+
+	// Editing sends users to log in first
+	w = do("GET", "/?q=add+go+https://golang.org")
+	assert.Equal(http.StatusFound, w.Code)
+	assert.Equal("/auth/login?next=%2F%3Fq%3Dadd%2Bgo%2Bhttps%3A%2F%2Fgolang.org", w.Header().Get("Location"))
+
+	w = do("GET", "/add/go")
+	assert.Equal(http.StatusFound, w.Code)
+	assert.Contains(w.Header().Get("Location"), "/auth/login?next=")
+
+	w = do("GET", "/?q=remove+gh")
+	assert.Equal(http.StatusFound, w.Code)
+	assert.Contains(w.Header().Get("Location"), "/auth/login?next=")
+
+	// Empty path segments are skipped when dispatching, so they are here too
+	for _, path := range []string{"//add/go/https:%2F%2Fgolang.org", "//remove/gh"} {
+		w = httptest.NewRecorder()
+		s.server.Handler.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+		assert.Equal(http.StatusFound, w.Code)
+		assert.Contains(w.Header().Get("Location"), "/auth/login?next=")
+	}
+	_, ok := LookupBookmark("go")
+	assert.False(ok)
+	_, ok = LookupBookmark("gh")
+	assert.True(ok)
+
+	w = do("POST", "/history/save")
+	assert.Equal(http.StatusUnauthorized, w.Code)
+
+	// Users outside the allowed teams can't log in
+	w = login("other")
+	assert.Equal(http.StatusForbidden, w.Code)
+	assert.Nil(cookie(w, SessionCookie))
+
+	w = login("c0de")
+	assert.Equal(http.StatusFound, w.Code)
+	assert.Equal("/?q=add+go+https://golang.org", w.Header().Get("Location"))
+	session := cookie(w, SessionCookie)
+	assert.NotNil(session)
+	assert.True(session.HttpOnly)
+
+	// Users confirm what they were about to do, which posts it as a form
+	w = do("GET", "/?q=add+go+https://golang.org", session)
+	assert.Equal(http.StatusOK, w.Code)
+	assert.Contains(w.Body.String(), `name="q" value="add go https://golang.org"`)
+	_, ok = LookupBookmark("go")
+	assert.False(ok)
+
+	w = httptest.NewRecorder()
+	r := postQuery(url.Values{"q": {"add go https://golang.org"}})
+	r.AddCookie(session)
+	s.server.Handler.ServeHTTP(w, r)
+	assert.Equal(http.StatusOK, w.Code)
+	_, ok = LookupBookmark("go")
+	assert.True(ok)
+
+	// Logging out is a form, so other sites can't log users out
+	w = do("POST", "/auth/logout", session)
+	assert.Equal(http.StatusForbidden, w.Code)
+
+	w = httptest.NewRecorder()
+	r, _ = http.NewRequest("POST", "/auth/logout", nil)
+	r.AddCookie(session)
+	withCSRF(r)
+	s.server.Handler.ServeHTTP(w, r)
+	assert.Equal(http.StatusOK, w.Code)
+	assert.Equal(-1, cookie(w, SessionCookie).MaxAge)
+}
+
+func TestGitHubAllowed(t *testing.T) {
+	assert := assert.New(t)
+
+	g := NewGitHub("golinks", "s3cr3t", "", ParseOrgs("Golang, kubernetes/sig-docs/"), NewCounters())
+
+	assert.True(g.allowed([]string{"golang"}))
+	assert.True(g.allowed([]string{"kubernetes", "kubernetes/sig-docs"}))
+	assert.False(g.allowed([]string{"kubernetes", "kubernetes/sig-apps"}))
+	assert.False(g.allowed(nil))
+}
+
+func TestGitHubOffline(t *testing.T) {
+	assert := assert.New(t)
+
+	// Logins need GitHub, which can't be reached offline
+	_, err := NewServer(":8000", Config{
+		Offline:        true,
+		GitHubClientID: "golinks", GitHubClientSecret: "s3cr3t", GitHubOrgs: "golang",
+	})
+	assert.EqualError(err, "GitHub logins (-github-client-id) cannot be used in offline mode")
+}
+
+func TestEditing(t *testing.T) {
+	assert := assert.New(t)
+
+	edits := func(method, path string) bool {
+		return editing(httptest.NewRequest(method, path, nil))
+	}
+
+	assert.True(edits("GET", "/?q=add+gh+https://github.com/%25s"))
+	assert.True(edits("GET", "/?q=Remove+gh"))
+	assert.True(edits("GET", "/add/gh/https:%2F%2Fgithub.com"))
+	assert.True(edits("POST", "/history/save"))
+	assert.True(edits("POST", "/linkrot/archive"))
+	assert.True(edits("GET", "//add/gh/https:%2F%2Fgithub.com"))
+	assert.True(edits("GET", "///Remove/gh"))
+
+	assert.False(edits("GET", "/?q=gh+prologic"))
+	assert.False(edits("GET", "/gh/prologic"))
+	assert.False(edits("GET", "/history"))
+	assert.False(edits("POST", "/feedback"))
+}
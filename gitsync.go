@@ -0,0 +1,213 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"log/slog"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// GitTimeout is the maximum time a single git command may take
+const GitTimeout = 2 * time.Minute
+
+// isRemoteRepo reports whether a git repository is remote (e.g:
+// https://host/repo.git or git@host:repo.git) rather than a local path
+func isRemoteRepo(repo string) bool {
+	return strings.Contains(repo, "://") || strings.Contains(repo, "@")
+}
+
+// GitSyncer periodically clones or pulls a git repository and syncs the
+// bookmarks manifest in it, so teams can manage their golinks via pull
+// requests. The manifest is only synced when the revision changes.
+type GitSyncer struct {
+	sync.RWMutex
+
+	repo     string
+	branch   string
+	path     string
+	dir      string
+	counters *Counters
+
+	// apply syncs the manifest (its bookmarks and settings)
+	apply func(*Manifest) (SyncResult, error)
+
+	revision string
+}
+
+// NewGitSyncer ...
+func NewGitSyncer(repo, branch, path string, counters *Counters, apply func(*Manifest) (SyncResult, error)) *GitSyncer {
+	if path == "" {
+		path = DefaultGitPath
+	}
+
+	return &GitSyncer{
+		repo:     repo,
+		branch:   branch,
+		path:     path,
+		counters: counters,
+		apply:    apply,
+	}
+}
+
+// Revision returns the revision of the last synced manifest
+func (g *GitSyncer) Revision() string {
+	g.RLock()
+	defer g.RUnlock()
+
+	return g.revision
+}
+
+func (g *GitSyncer) git(args ...string) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), GitTimeout)
+	defer cancel()
+
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, "git", args...)
+	cmd.Env = append(os.Environ(), "GIT_TERMINAL_PROMPT=0")
+	cmd.Stderr = &stderr
+
+	out, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("git %s: %s: %s", args[0], err, strings.TrimSpace(stderr.String()))
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+// update clones the repository or pulls the latest changes and returns the
+// checked out revision
+func (g *GitSyncer) update() (string, error) {
+	if g.dir == "" {
+		dir, err := ioutil.TempDir("", "golinks-git")
+		if err != nil {
+			return "", err
+		}
+		g.dir = dir
+	}
+
+	if _, err := os.Stat(filepath.Join(g.dir, ".git")); os.IsNotExist(err) {
+		args := []string{"clone", "--quiet", "--depth", "1"}
+		if g.branch != "" {
+			args = append(args, "--branch", g.branch)
+		}
+		if _, err := g.git(append(args, "--", g.repo, g.dir)...); err != nil {
+			return "", err
+		}
+	} else {
+		ref := g.branch
+		if ref == "" {
+			ref = "HEAD"
+		}
+		if _, err := g.git("-C", g.dir, "fetch", "--quiet", "--depth", "1", "origin", ref); err != nil {
+			return "", err
+		}
+		if _, err := g.git("-C", g.dir, "reset", "--quiet", "--hard", "FETCH_HEAD"); err != nil {
+			return "", err
+		}
+	}
+
+	return g.git("-C", g.dir, "rev-parse", "HEAD")
+}
+
+// Sync pulls the repository and syncs the manifest if the revision changed
+func (g *GitSyncer) Sync() (changed bool, result SyncResult, err error) {
+	g.Lock()
+	defer g.Unlock()
+
+	revision, err := g.update()
+	if err != nil {
+		g.counters.Inc("n_git_sync_failed")
+		return
+	}
+
+	if revision == g.revision {
+		return
+	}
+
+	var manifest *Manifest
+	if manifest, err = LoadManifest(filepath.Join(g.dir, g.path)); err != nil {
+		g.counters.Inc("n_git_sync_failed")
+		return
+	}
+	if result, err = g.apply(manifest); err != nil {
+		g.counters.Inc("n_git_sync_failed")
+		return
+	}
+
+	g.revision = revision
+	g.counters.Inc("n_git_sync")
+
+	return true, result, nil
+}
+
+// SyncAndLog syncs the repository and logs what changed (if anything)
+func (g *GitSyncer) SyncAndLog() error {
+	changed, result, err := g.Sync()
+	if err != nil {
+		return err
+	}
+	if changed {
+		slog.Info("synced bookmarks", "repo", g.repo, "revision", g.Revision(), "result", result)
+	}
+	return nil
+}
+
+// Run syncs the repository every interval until ctx is cancelled
+func (g *GitSyncer) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		if err := g.SyncAndLog(); err != nil {
+			slog.Error("error syncing bookmarks", "repo", g.repo, "err", err)
+		}
+	}
+}
+
+// Close removes the local clone of the repository
+func (g *GitSyncer) Close() error {
+	g.Lock()
+	defer g.Unlock()
+
+	if g.dir == "" {
+		return nil
+	}
+	return os.RemoveAll(g.dir)
+}
+
+// SyncGitRepo syncs the configured git repository (if any)
+func (s *Server) SyncGitRepo() error {
+	if s.gitSyncer == nil {
+		return nil
+	}
+
+	if s.config.ReadOnly {
+		slog.Warn("not syncing bookmarks in read-only mode", "repo", s.config.GitRepo)
+		return nil
+	}
+
+	return s.gitSyncer.SyncAndLog()
+}
+
+// checkGitSync returns an error if git sync is misconfigured
+func checkGitSync(config Config) error {
+	if config.GitRepo == "" {
+		return nil
+	}
+	if _, err := exec.LookPath("git"); err != nil {
+		return fmt.Errorf("-git-repo requires git: %s", err)
+	}
+	return nil
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func commitManifest(t *testing.T, repo, manifest string) {
+	assert := assert.New(t)
+
+	assert.NoError(ioutil.WriteFile(filepath.Join(repo, DefaultGitPath), []byte(manifest), 0644))
+
+	for _, args := range [][]string{
+		{"add", DefaultGitPath},
+		{"-c", "user.name=test", "-c", "user.email=test@example.com", "commit", "--quiet", "-m", "Update bookmarks"},
+	} {
+		cmd := exec.Command("git", append([]string{"-C", repo}, args...)...)
+		out, err := cmd.CombinedOutput()
+		assert.NoError(err, string(out))
+	}
+}
+
+func TestGitSyncer(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir("", "golinks")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	db, err = OpenStore(filepath.Join(dir, "test.db"))
+	assert.NoError(err)
+	defer db.Close()
+
+	repo := filepath.Join(dir, "repo")
+	out, err := exec.Command("git", "init", "--quiet", repo).CombinedOutput()
+	assert.NoError(err, string(out))
+	commitManifest(t, repo, testManifest)
+
+	s, err := NewServer(":8000", Config{GitRepo: repo})
+	assert.NoError(err)
+	defer s.gitSyncer.Close()
+
+	assert.NoError(s.SyncGitRepo())
+	bookmark, ok := LookupBookmark("hub")
+	assert.True(ok)
+	assert.Equal("gh", bookmark.Name())
+	revision := s.gitSyncer.Revision()
+	assert.NotEmpty(revision)
+
+	// Nothing is synced until the revision changes
+	changed, _, err := s.gitSyncer.Sync()
+	assert.NoError(err)
+	assert.False(changed)
+
+	commitManifest(t, repo, "bookmarks:\n  gh: https://github.com\n")
+	changed, result, err := s.gitSyncer.Sync()
+	assert.NoError(err)
+	assert.True(changed)
+	assert.Equal(SyncResult{Updated: 1, Removed: 1}, result)
+	assert.NotEqual(revision, s.gitSyncer.Revision())
+
+	_, ok = LookupBookmark("jira")
+	assert.False(ok)
+
+	// A broken manifest is not synced (and retried on the next sync)
+	commitManifest(t, repo, "bookmarks: [\n")
+	assert.Error(s.SyncGitRepo())
+	assert.Error(s.SyncGitRepo())
+}
+
+func TestGitSyncConfig(t *testing.T) {
+	assert := assert.New(t)
+
+	_, err := NewServer(":8000", Config{GitRepo: "repo", BookmarksFile: "bookmarks.yaml"})
+	assert.Error(err)
+
+	_, err = NewServer(":8000", Config{Offline: true, GitRepo: "https://git.example.com/golinks.git"})
+	assert.Error(err)
+
+	assert.True(isRemoteRepo("git@github.com:example/golinks.git"))
+	assert.False(isRemoteRepo("/srv/golinks"))
+}
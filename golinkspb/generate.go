@@ -0,0 +1,5 @@
+// Package golinkspb contains the gRPC service and messages of golinks
+// generated from golinks.proto.
+package golinkspb
+
+//go:generate protoc --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative golinks.proto
@@ -0,0 +1,645 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.10
+// 	protoc        (unknown)
+// source: golinks.proto
+
+package golinkspb
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+type Resolution_Kind int32
+
+const (
+	Resolution_KIND_UNSPECIFIED Resolution_Kind = 0
+	Resolution_KIND_COMMAND     Resolution_Kind = 1
+	Resolution_KIND_BOOKMARK    Resolution_Kind = 2
+	Resolution_KIND_PEER        Resolution_Kind = 3
+	Resolution_KIND_DEFAULT     Resolution_Kind = 4
+)
+
+// Enum value maps for Resolution_Kind.
+var (
+	Resolution_Kind_name = map[int32]string{
+		0: "KIND_UNSPECIFIED",
+		1: "KIND_COMMAND",
+		2: "KIND_BOOKMARK",
+		3: "KIND_PEER",
+		4: "KIND_DEFAULT",
+	}
+	Resolution_Kind_value = map[string]int32{
+		"KIND_UNSPECIFIED": 0,
+		"KIND_COMMAND":     1,
+		"KIND_BOOKMARK":    2,
+		"KIND_PEER":        3,
+		"KIND_DEFAULT":     4,
+	}
+)
+
+func (x Resolution_Kind) Enum() *Resolution_Kind {
+	p := new(Resolution_Kind)
+	*p = x
+	return p
+}
+
+func (x Resolution_Kind) String() string {
+	return protoimpl.X.EnumStringOf(x.Descriptor(), protoreflect.EnumNumber(x))
+}
+
+func (Resolution_Kind) Descriptor() protoreflect.EnumDescriptor {
+	return file_golinks_proto_enumTypes[0].Descriptor()
+}
+
+func (Resolution_Kind) Type() protoreflect.EnumType {
+	return &file_golinks_proto_enumTypes[0]
+}
+
+func (x Resolution_Kind) Number() protoreflect.EnumNumber {
+	return protoreflect.EnumNumber(x)
+}
+
+// Deprecated: Use Resolution_Kind.Descriptor instead.
+func (Resolution_Kind) EnumDescriptor() ([]byte, []int) {
+	return file_golinks_proto_rawDescGZIP(), []int{3, 0}
+}
+
+type LookupRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Name          string                 `protobuf:"bytes,1,opt,name=name,proto3" json:"name,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *LookupRequest) Reset() {
+	*x = LookupRequest{}
+	mi := &file_golinks_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *LookupRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*LookupRequest) ProtoMessage() {}
+
+func (x *LookupRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_golinks_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use LookupRequest.ProtoReflect.Descriptor instead.
+func (*LookupRequest) Descriptor() ([]byte, []int) {
+	return file_golinks_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *LookupRequest) GetName() string {
+	if x != nil {
+		return x.Name
+	}
+	return ""
+}
+
+type Link struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Name          string                 `protobuf:"bytes,1,opt,name=name,proto3" json:"name,omitempty"`
+	Url           string                 `protobuf:"bytes,2,opt,name=url,proto3" json:"url,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Link) Reset() {
+	*x = Link{}
+	mi := &file_golinks_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Link) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Link) ProtoMessage() {}
+
+func (x *Link) ProtoReflect() protoreflect.Message {
+	mi := &file_golinks_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Link.ProtoReflect.Descriptor instead.
+func (*Link) Descriptor() ([]byte, []int) {
+	return file_golinks_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *Link) GetName() string {
+	if x != nil {
+		return x.Name
+	}
+	return ""
+}
+
+func (x *Link) GetUrl() string {
+	if x != nil {
+		return x.Url
+	}
+	return ""
+}
+
+type ResolveRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Query         string                 `protobuf:"bytes,1,opt,name=query,proto3" json:"query,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ResolveRequest) Reset() {
+	*x = ResolveRequest{}
+	mi := &file_golinks_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ResolveRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ResolveRequest) ProtoMessage() {}
+
+func (x *ResolveRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_golinks_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ResolveRequest.ProtoReflect.Descriptor instead.
+func (*ResolveRequest) Descriptor() ([]byte, []int) {
+	return file_golinks_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *ResolveRequest) GetQuery() string {
+	if x != nil {
+		return x.Query
+	}
+	return ""
+}
+
+type Resolution struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	Kind  Resolution_Kind        `protobuf:"varint,1,opt,name=kind,proto3,enum=golinks.v1.Resolution_Kind" json:"kind,omitempty"`
+	// Name of the command or bookmark the query matched (if any)
+	Name string `protobuf:"bytes,2,opt,name=name,proto3" json:"name,omitempty"`
+	// Url the query redirects to (empty for commands)
+	Url string `protobuf:"bytes,3,opt,name=url,proto3" json:"url,omitempty"`
+	// Peer the bookmark was resolved by (if any)
+	Peer          string `protobuf:"bytes,4,opt,name=peer,proto3" json:"peer,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Resolution) Reset() {
+	*x = Resolution{}
+	mi := &file_golinks_proto_msgTypes[3]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Resolution) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Resolution) ProtoMessage() {}
+
+func (x *Resolution) ProtoReflect() protoreflect.Message {
+	mi := &file_golinks_proto_msgTypes[3]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Resolution.ProtoReflect.Descriptor instead.
+func (*Resolution) Descriptor() ([]byte, []int) {
+	return file_golinks_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *Resolution) GetKind() Resolution_Kind {
+	if x != nil {
+		return x.Kind
+	}
+	return Resolution_KIND_UNSPECIFIED
+}
+
+func (x *Resolution) GetName() string {
+	if x != nil {
+		return x.Name
+	}
+	return ""
+}
+
+func (x *Resolution) GetUrl() string {
+	if x != nil {
+		return x.Url
+	}
+	return ""
+}
+
+func (x *Resolution) GetPeer() string {
+	if x != nil {
+		return x.Peer
+	}
+	return ""
+}
+
+type AddBookmarkRequest struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	Name  string                 `protobuf:"bytes,1,opt,name=name,proto3" json:"name,omitempty"`
+	Url   string                 `protobuf:"bytes,2,opt,name=url,proto3" json:"url,omitempty"`
+	// Replace an existing bookmark with the same name
+	Replace       bool `protobuf:"varint,3,opt,name=replace,proto3" json:"replace,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *AddBookmarkRequest) Reset() {
+	*x = AddBookmarkRequest{}
+	mi := &file_golinks_proto_msgTypes[4]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *AddBookmarkRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*AddBookmarkRequest) ProtoMessage() {}
+
+func (x *AddBookmarkRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_golinks_proto_msgTypes[4]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use AddBookmarkRequest.ProtoReflect.Descriptor instead.
+func (*AddBookmarkRequest) Descriptor() ([]byte, []int) {
+	return file_golinks_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *AddBookmarkRequest) GetName() string {
+	if x != nil {
+		return x.Name
+	}
+	return ""
+}
+
+func (x *AddBookmarkRequest) GetUrl() string {
+	if x != nil {
+		return x.Url
+	}
+	return ""
+}
+
+func (x *AddBookmarkRequest) GetReplace() bool {
+	if x != nil {
+		return x.Replace
+	}
+	return false
+}
+
+type HistoryRequest struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// Cursor of the page to return (the next cursor of the previous page)
+	Before        string `protobuf:"bytes,1,opt,name=before,proto3" json:"before,omitempty"`
+	Limit         int32  `protobuf:"varint,2,opt,name=limit,proto3" json:"limit,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *HistoryRequest) Reset() {
+	*x = HistoryRequest{}
+	mi := &file_golinks_proto_msgTypes[5]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *HistoryRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*HistoryRequest) ProtoMessage() {}
+
+func (x *HistoryRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_golinks_proto_msgTypes[5]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use HistoryRequest.ProtoReflect.Descriptor instead.
+func (*HistoryRequest) Descriptor() ([]byte, []int) {
+	return file_golinks_proto_rawDescGZIP(), []int{5}
+}
+
+func (x *HistoryRequest) GetBefore() string {
+	if x != nil {
+		return x.Before
+	}
+	return ""
+}
+
+func (x *HistoryRequest) GetLimit() int32 {
+	if x != nil {
+		return x.Limit
+	}
+	return 0
+}
+
+type HistoryEntry struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Id            string                 `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	TimeUnixNano  int64                  `protobuf:"varint,2,opt,name=time_unix_nano,json=timeUnixNano,proto3" json:"time_unix_nano,omitempty"`
+	Query         string                 `protobuf:"bytes,3,opt,name=query,proto3" json:"query,omitempty"`
+	Name          string                 `protobuf:"bytes,4,opt,name=name,proto3" json:"name,omitempty"`
+	Url           string                 `protobuf:"bytes,5,opt,name=url,proto3" json:"url,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *HistoryEntry) Reset() {
+	*x = HistoryEntry{}
+	mi := &file_golinks_proto_msgTypes[6]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *HistoryEntry) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*HistoryEntry) ProtoMessage() {}
+
+func (x *HistoryEntry) ProtoReflect() protoreflect.Message {
+	mi := &file_golinks_proto_msgTypes[6]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use HistoryEntry.ProtoReflect.Descriptor instead.
+func (*HistoryEntry) Descriptor() ([]byte, []int) {
+	return file_golinks_proto_rawDescGZIP(), []int{6}
+}
+
+func (x *HistoryEntry) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+func (x *HistoryEntry) GetTimeUnixNano() int64 {
+	if x != nil {
+		return x.TimeUnixNano
+	}
+	return 0
+}
+
+func (x *HistoryEntry) GetQuery() string {
+	if x != nil {
+		return x.Query
+	}
+	return ""
+}
+
+func (x *HistoryEntry) GetName() string {
+	if x != nil {
+		return x.Name
+	}
+	return ""
+}
+
+func (x *HistoryEntry) GetUrl() string {
+	if x != nil {
+		return x.Url
+	}
+	return ""
+}
+
+type HistoryPage struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Entries       []*HistoryEntry        `protobuf:"bytes,1,rep,name=entries,proto3" json:"entries,omitempty"`
+	Next          string                 `protobuf:"bytes,2,opt,name=next,proto3" json:"next,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *HistoryPage) Reset() {
+	*x = HistoryPage{}
+	mi := &file_golinks_proto_msgTypes[7]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *HistoryPage) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*HistoryPage) ProtoMessage() {}
+
+func (x *HistoryPage) ProtoReflect() protoreflect.Message {
+	mi := &file_golinks_proto_msgTypes[7]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use HistoryPage.ProtoReflect.Descriptor instead.
+func (*HistoryPage) Descriptor() ([]byte, []int) {
+	return file_golinks_proto_rawDescGZIP(), []int{7}
+}
+
+func (x *HistoryPage) GetEntries() []*HistoryEntry {
+	if x != nil {
+		return x.Entries
+	}
+	return nil
+}
+
+func (x *HistoryPage) GetNext() string {
+	if x != nil {
+		return x.Next
+	}
+	return ""
+}
+
+var File_golinks_proto protoreflect.FileDescriptor
+
+const file_golinks_proto_rawDesc = "" +
+	"\n" +
+	"\rgolinks.proto\x12\n" +
+	"golinks.v1\"#\n" +
+	"\rLookupRequest\x12\x12\n" +
+	"\x04name\x18\x01 \x01(\tR\x04name\",\n" +
+	"\x04Link\x12\x12\n" +
+	"\x04name\x18\x01 \x01(\tR\x04name\x12\x10\n" +
+	"\x03url\x18\x02 \x01(\tR\x03url\"&\n" +
+	"\x0eResolveRequest\x12\x14\n" +
+	"\x05query\x18\x01 \x01(\tR\x05query\"\xdb\x01\n" +
+	"\n" +
+	"Resolution\x12/\n" +
+	"\x04kind\x18\x01 \x01(\x0e2\x1b.golinks.v1.Resolution.KindR\x04kind\x12\x12\n" +
+	"\x04name\x18\x02 \x01(\tR\x04name\x12\x10\n" +
+	"\x03url\x18\x03 \x01(\tR\x03url\x12\x12\n" +
+	"\x04peer\x18\x04 \x01(\tR\x04peer\"b\n" +
+	"\x04Kind\x12\x14\n" +
+	"\x10KIND_UNSPECIFIED\x10\x00\x12\x10\n" +
+	"\fKIND_COMMAND\x10\x01\x12\x11\n" +
+	"\rKIND_BOOKMARK\x10\x02\x12\r\n" +
+	"\tKIND_PEER\x10\x03\x12\x10\n" +
+	"\fKIND_DEFAULT\x10\x04\"T\n" +
+	"\x12AddBookmarkRequest\x12\x12\n" +
+	"\x04name\x18\x01 \x01(\tR\x04name\x12\x10\n" +
+	"\x03url\x18\x02 \x01(\tR\x03url\x12\x18\n" +
+	"\areplace\x18\x03 \x01(\bR\areplace\">\n" +
+	"\x0eHistoryRequest\x12\x16\n" +
+	"\x06before\x18\x01 \x01(\tR\x06before\x12\x14\n" +
+	"\x05limit\x18\x02 \x01(\x05R\x05limit\"\x80\x01\n" +
+	"\fHistoryEntry\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\tR\x02id\x12$\n" +
+	"\x0etime_unix_nano\x18\x02 \x01(\x03R\ftimeUnixNano\x12\x14\n" +
+	"\x05query\x18\x03 \x01(\tR\x05query\x12\x12\n" +
+	"\x04name\x18\x04 \x01(\tR\x04name\x12\x10\n" +
+	"\x03url\x18\x05 \x01(\tR\x03url\"U\n" +
+	"\vHistoryPage\x122\n" +
+	"\aentries\x18\x01 \x03(\v2\x18.golinks.v1.HistoryEntryR\aentries\x12\x12\n" +
+	"\x04next\x18\x02 \x01(\tR\x04next2\x80\x02\n" +
+	"\aGolinks\x125\n" +
+	"\x06Lookup\x12\x19.golinks.v1.LookupRequest\x1a\x10.golinks.v1.Link\x12=\n" +
+	"\aResolve\x12\x1a.golinks.v1.ResolveRequest\x1a\x16.golinks.v1.Resolution\x12?\n" +
+	"\vAddBookmark\x12\x1e.golinks.v1.AddBookmarkRequest\x1a\x10.golinks.v1.Link\x12>\n" +
+	"\aHistory\x12\x1a.golinks.v1.HistoryRequest\x1a\x17.golinks.v1.HistoryPageB'Z%github.com/prologic/golinks/golinkspbb\x06proto3"
+
+var (
+	file_golinks_proto_rawDescOnce sync.Once
+	file_golinks_proto_rawDescData []byte
+)
+
+func file_golinks_proto_rawDescGZIP() []byte {
+	file_golinks_proto_rawDescOnce.Do(func() {
+		file_golinks_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_golinks_proto_rawDesc), len(file_golinks_proto_rawDesc)))
+	})
+	return file_golinks_proto_rawDescData
+}
+
+var file_golinks_proto_enumTypes = make([]protoimpl.EnumInfo, 1)
+var file_golinks_proto_msgTypes = make([]protoimpl.MessageInfo, 8)
+var file_golinks_proto_goTypes = []any{
+	(Resolution_Kind)(0),       // 0: golinks.v1.Resolution.Kind
+	(*LookupRequest)(nil),      // 1: golinks.v1.LookupRequest
+	(*Link)(nil),               // 2: golinks.v1.Link
+	(*ResolveRequest)(nil),     // 3: golinks.v1.ResolveRequest
+	(*Resolution)(nil),         // 4: golinks.v1.Resolution
+	(*AddBookmarkRequest)(nil), // 5: golinks.v1.AddBookmarkRequest
+	(*HistoryRequest)(nil),     // 6: golinks.v1.HistoryRequest
+	(*HistoryEntry)(nil),       // 7: golinks.v1.HistoryEntry
+	(*HistoryPage)(nil),        // 8: golinks.v1.HistoryPage
+}
+var file_golinks_proto_depIdxs = []int32{
+	0, // 0: golinks.v1.Resolution.kind:type_name -> golinks.v1.Resolution.Kind
+	7, // 1: golinks.v1.HistoryPage.entries:type_name -> golinks.v1.HistoryEntry
+	1, // 2: golinks.v1.Golinks.Lookup:input_type -> golinks.v1.LookupRequest
+	3, // 3: golinks.v1.Golinks.Resolve:input_type -> golinks.v1.ResolveRequest
+	5, // 4: golinks.v1.Golinks.AddBookmark:input_type -> golinks.v1.AddBookmarkRequest
+	6, // 5: golinks.v1.Golinks.History:input_type -> golinks.v1.HistoryRequest
+	2, // 6: golinks.v1.Golinks.Lookup:output_type -> golinks.v1.Link
+	4, // 7: golinks.v1.Golinks.Resolve:output_type -> golinks.v1.Resolution
+	2, // 8: golinks.v1.Golinks.AddBookmark:output_type -> golinks.v1.Link
+	8, // 9: golinks.v1.Golinks.History:output_type -> golinks.v1.HistoryPage
+	6, // [6:10] is the sub-list for method output_type
+	2, // [2:6] is the sub-list for method input_type
+	2, // [2:2] is the sub-list for extension type_name
+	2, // [2:2] is the sub-list for extension extendee
+	0, // [0:2] is the sub-list for field type_name
+}
+
+func init() { file_golinks_proto_init() }
+func file_golinks_proto_init() {
+	if File_golinks_proto != nil {
+		return
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_golinks_proto_rawDesc), len(file_golinks_proto_rawDesc)),
+			NumEnums:      1,
+			NumMessages:   8,
+			NumExtensions: 0,
+			NumServices:   1,
+		},
+		GoTypes:           file_golinks_proto_goTypes,
+		DependencyIndexes: file_golinks_proto_depIdxs,
+		EnumInfos:         file_golinks_proto_enumTypes,
+		MessageInfos:      file_golinks_proto_msgTypes,
+	}.Build()
+	File_golinks_proto = out.File
+	file_golinks_proto_goTypes = nil
+	file_golinks_proto_depIdxs = nil
+}
@@ -0,0 +1,259 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.5.1
+// - protoc             (unknown)
+// source: golinks.proto
+
+package golinkspb
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.64.0 or later.
+const _ = grpc.SupportPackageIsVersion9
+
+const (
+	Golinks_Lookup_FullMethodName      = "/golinks.v1.Golinks/Lookup"
+	Golinks_Resolve_FullMethodName     = "/golinks.v1.Golinks/Resolve"
+	Golinks_AddBookmark_FullMethodName = "/golinks.v1.Golinks/AddBookmark"
+	Golinks_History_FullMethodName     = "/golinks.v1.Golinks/History"
+)
+
+// GolinksClient is the client API for Golinks service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+//
+// Golinks lets internal tooling look up, resolve and add bookmarks and read
+// the history of queries without scraping the web UI.
+//
+// Lookup and Resolve are as open as redirects; History requires an API token
+// with the read scope and AddBookmark one with the write scope, passed as
+// "authorization: Bearer <token>" metadata.
+type GolinksClient interface {
+	// Lookup returns the bookmark with the given name (or alias)
+	Lookup(ctx context.Context, in *LookupRequest, opts ...grpc.CallOption) (*Link, error)
+	// Resolve resolves a query (e.g: "gh prologic/golinks") to the url it
+	// would redirect to
+	Resolve(ctx context.Context, in *ResolveRequest, opts ...grpc.CallOption) (*Resolution, error)
+	// AddBookmark creates or updates a bookmark
+	AddBookmark(ctx context.Context, in *AddBookmarkRequest, opts ...grpc.CallOption) (*Link, error)
+	// History returns a page of the history of queries, newest first
+	History(ctx context.Context, in *HistoryRequest, opts ...grpc.CallOption) (*HistoryPage, error)
+}
+
+type golinksClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewGolinksClient(cc grpc.ClientConnInterface) GolinksClient {
+	return &golinksClient{cc}
+}
+
+func (c *golinksClient) Lookup(ctx context.Context, in *LookupRequest, opts ...grpc.CallOption) (*Link, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(Link)
+	err := c.cc.Invoke(ctx, Golinks_Lookup_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *golinksClient) Resolve(ctx context.Context, in *ResolveRequest, opts ...grpc.CallOption) (*Resolution, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(Resolution)
+	err := c.cc.Invoke(ctx, Golinks_Resolve_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *golinksClient) AddBookmark(ctx context.Context, in *AddBookmarkRequest, opts ...grpc.CallOption) (*Link, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(Link)
+	err := c.cc.Invoke(ctx, Golinks_AddBookmark_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *golinksClient) History(ctx context.Context, in *HistoryRequest, opts ...grpc.CallOption) (*HistoryPage, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(HistoryPage)
+	err := c.cc.Invoke(ctx, Golinks_History_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// GolinksServer is the server API for Golinks service.
+// All implementations must embed UnimplementedGolinksServer
+// for forward compatibility.
+//
+// Golinks lets internal tooling look up, resolve and add bookmarks and read
+// the history of queries without scraping the web UI.
+//
+// Lookup and Resolve are as open as redirects; History requires an API token
+// with the read scope and AddBookmark one with the write scope, passed as
+// "authorization: Bearer <token>" metadata.
+type GolinksServer interface {
+	// Lookup returns the bookmark with the given name (or alias)
+	Lookup(context.Context, *LookupRequest) (*Link, error)
+	// Resolve resolves a query (e.g: "gh prologic/golinks") to the url it
+	// would redirect to
+	Resolve(context.Context, *ResolveRequest) (*Resolution, error)
+	// AddBookmark creates or updates a bookmark
+	AddBookmark(context.Context, *AddBookmarkRequest) (*Link, error)
+	// History returns a page of the history of queries, newest first
+	History(context.Context, *HistoryRequest) (*HistoryPage, error)
+	mustEmbedUnimplementedGolinksServer()
+}
+
+// UnimplementedGolinksServer must be embedded to have
+// forward compatible implementations.
+//
+// NOTE: this should be embedded by value instead of pointer to avoid a nil
+// pointer dereference when methods are called.
+type UnimplementedGolinksServer struct{}
+
+func (UnimplementedGolinksServer) Lookup(context.Context, *LookupRequest) (*Link, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Lookup not implemented")
+}
+func (UnimplementedGolinksServer) Resolve(context.Context, *ResolveRequest) (*Resolution, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Resolve not implemented")
+}
+func (UnimplementedGolinksServer) AddBookmark(context.Context, *AddBookmarkRequest) (*Link, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method AddBookmark not implemented")
+}
+func (UnimplementedGolinksServer) History(context.Context, *HistoryRequest) (*HistoryPage, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method History not implemented")
+}
+func (UnimplementedGolinksServer) mustEmbedUnimplementedGolinksServer() {}
+func (UnimplementedGolinksServer) testEmbeddedByValue()                 {}
+
+// UnsafeGolinksServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to GolinksServer will
+// result in compilation errors.
+type UnsafeGolinksServer interface {
+	mustEmbedUnimplementedGolinksServer()
+}
+
+func RegisterGolinksServer(s grpc.ServiceRegistrar, srv GolinksServer) {
+	// If the following call pancis, it indicates UnimplementedGolinksServer was
+	// embedded by pointer and is nil.  This will cause panics if an
+	// unimplemented method is ever invoked, so we test this at initialization
+	// time to prevent it from happening at runtime later due to I/O.
+	if t, ok := srv.(interface{ testEmbeddedByValue() }); ok {
+		t.testEmbeddedByValue()
+	}
+	s.RegisterService(&Golinks_ServiceDesc, srv)
+}
+
+func _Golinks_Lookup_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(LookupRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(GolinksServer).Lookup(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Golinks_Lookup_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(GolinksServer).Lookup(ctx, req.(*LookupRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Golinks_Resolve_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ResolveRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(GolinksServer).Resolve(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Golinks_Resolve_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(GolinksServer).Resolve(ctx, req.(*ResolveRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Golinks_AddBookmark_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(AddBookmarkRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(GolinksServer).AddBookmark(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Golinks_AddBookmark_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(GolinksServer).AddBookmark(ctx, req.(*AddBookmarkRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Golinks_History_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(HistoryRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(GolinksServer).History(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Golinks_History_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(GolinksServer).History(ctx, req.(*HistoryRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// Golinks_ServiceDesc is the grpc.ServiceDesc for Golinks service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var Golinks_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "golinks.v1.Golinks",
+	HandlerType: (*GolinksServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "Lookup",
+			Handler:    _Golinks_Lookup_Handler,
+		},
+		{
+			MethodName: "Resolve",
+			Handler:    _Golinks_Resolve_Handler,
+		},
+		{
+			MethodName: "AddBookmark",
+			Handler:    _Golinks_AddBookmark_Handler,
+		},
+		{
+			MethodName: "History",
+			Handler:    _Golinks_History_Handler,
+		},
+	},
+	Streams:  []grpc.StreamDesc{},
+	Metadata: "golinks.proto",
+}
@@ -0,0 +1,707 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// This is a small GraphQL executor for the subset of the language used by
+// dashboards: queries and mutations with arguments, variables (and their
+// defaults), aliases, nested selections, named and inline fragments (type
+// conditions are not checked) and __typename. Directives, subscriptions and
+// introspection are not supported.
+
+// gqlArgs are the arguments of a field with variables substituted
+type gqlArgs map[string]interface{}
+
+// String returns the string argument name or "" if it's not given
+func (a gqlArgs) String(name string) (string, error) {
+	switch v := a[name].(type) {
+	case nil:
+		return "", nil
+	case string:
+		return v, nil
+	default:
+		return "", fmt.Errorf("argument %s: expected String", name)
+	}
+}
+
+// Int returns the integer argument name or def if it's not given
+func (a gqlArgs) Int(name string, def int) (int, error) {
+	switch v := a[name].(type) {
+	case nil:
+		return def, nil
+	case int:
+		return v, nil
+	case float64:
+		if v == float64(int(v)) {
+			return int(v), nil
+		}
+	}
+	return 0, fmt.Errorf("argument %s: expected Int", name)
+}
+
+// Bool returns the boolean argument name or false if it's not given
+func (a gqlArgs) Bool(name string) (bool, error) {
+	switch v := a[name].(type) {
+	case nil:
+		return false, nil
+	case bool:
+		return v, nil
+	default:
+		return false, fmt.Errorf("argument %s: expected Boolean", name)
+	}
+}
+
+// gqlResolver resolves a field from its arguments
+type gqlResolver = func(args gqlArgs) (interface{}, error)
+
+// gqlObject is an object of type Type whose Fields are either values or
+// gqlResolvers. Values may be scalars, gqlObjects or slices of either.
+type gqlObject struct {
+	Type   string
+	Fields map[string]interface{}
+}
+
+// gqlError is an error in a GraphQL response
+type gqlError struct {
+	Message string        `json:"message"`
+	Path    []interface{} `json:"path,omitempty"`
+}
+
+// gqlResponse is the response to a GraphQL request
+type gqlResponse struct {
+	Data   interface{} `json:"data"`
+	Errors []gqlError  `json:"errors,omitempty"`
+}
+
+// gqlMap is a JSON object keeping the order of its fields, since results
+// must be in the order of the selection
+type gqlMap struct {
+	keys   []string
+	values map[string]interface{}
+}
+
+func (m *gqlMap) set(key string, value interface{}) {
+	if m.values == nil {
+		m.values = make(map[string]interface{})
+	}
+	if _, ok := m.values[key]; !ok {
+		m.keys = append(m.keys, key)
+	}
+	m.values[key] = value
+}
+
+// MarshalJSON ...
+func (m *gqlMap) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i, key := range m.keys {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		k, _ := json.Marshal(key)
+		buf.Write(k)
+		buf.WriteByte(':')
+		v, err := json.Marshal(m.values[key])
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(v)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+// gqlVariable is a reference to a variable in an argument value
+type gqlVariable string
+
+// gqlSelection is a field (or a fragment spread when Fragment is set)
+type gqlSelection struct {
+	Alias      string
+	Name       string
+	Args       map[string]interface{}
+	Selections []gqlSelection
+	Fragment   string
+}
+
+// gqlOperation is a query or mutation
+type gqlOperation struct {
+	Kind       string
+	Name       string
+	Defaults   map[string]interface{}
+	Selections []gqlSelection
+}
+
+// gqlDocument is a parsed GraphQL document
+type gqlDocument struct {
+	Operations []gqlOperation
+	Fragments  map[string][]gqlSelection
+}
+
+const (
+	gqlEOF = iota
+	gqlPunct
+	gqlName
+	gqlInt
+	gqlFloat
+	gqlString
+)
+
+type gqlToken struct {
+	kind  int
+	value string
+}
+
+// gqlLex splits a GraphQL document into tokens
+func gqlLex(src string) ([]gqlToken, error) {
+	var tokens []gqlToken
+
+	isName := func(c byte, first bool) bool {
+		return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (!first && c >= '0' && c <= '9')
+	}
+
+	for i := 0; i < len(src); {
+		c := src[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == ',':
+			i++
+		case c == '#':
+			for i < len(src) && src[i] != '\n' {
+				i++
+			}
+		case strings.HasPrefix(src[i:], "..."):
+			tokens = append(tokens, gqlToken{gqlPunct, "..."})
+			i += 3
+		case strings.IndexByte("!$():=@[]{}|", c) >= 0:
+			tokens = append(tokens, gqlToken{gqlPunct, string(c)})
+			i++
+		case isName(c, true):
+			j := i
+			for j < len(src) && isName(src[j], false) {
+				j++
+			}
+			tokens = append(tokens, gqlToken{gqlName, src[i:j]})
+			i = j
+		case c == '-' || (c >= '0' && c <= '9'):
+			j, kind := i+1, gqlInt
+			for j < len(src) && strings.IndexByte("0123456789.eE+-", src[j]) >= 0 {
+				if strings.IndexByte(".eE", src[j]) >= 0 {
+					kind = gqlFloat
+				}
+				j++
+			}
+			tokens = append(tokens, gqlToken{kind, src[i:j]})
+			i = j
+		case c == '"':
+			j := i + 1
+			for j < len(src) && src[j] != '"' {
+				if src[j] == '\\' {
+					j++
+				}
+				if j < len(src) && src[j] == '\n' {
+					return nil, fmt.Errorf("syntax error: unterminated string")
+				}
+				j++
+			}
+			if j >= len(src) {
+				return nil, fmt.Errorf("syntax error: unterminated string")
+			}
+			s, err := strconv.Unquote(src[i : j+1])
+			if err != nil {
+				return nil, fmt.Errorf("syntax error: invalid string %s", src[i:j+1])
+			}
+			tokens = append(tokens, gqlToken{gqlString, s})
+			i = j + 1
+		default:
+			return nil, fmt.Errorf("syntax error: unexpected character %q", c)
+		}
+	}
+
+	return append(tokens, gqlToken{kind: gqlEOF}), nil
+}
+
+type gqlParser struct {
+	tokens []gqlToken
+	pos    int
+}
+
+func (p *gqlParser) peek() gqlToken {
+	return p.tokens[p.pos]
+}
+
+func (p *gqlParser) next() gqlToken {
+	t := p.tokens[p.pos]
+	if t.kind != gqlEOF {
+		p.pos++
+	}
+	return t
+}
+
+func (p *gqlParser) is(punct string) bool {
+	t := p.peek()
+	return t.kind == gqlPunct && t.value == punct
+}
+
+func (p *gqlParser) skip(punct string) bool {
+	if p.is(punct) {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *gqlParser) unexpected() error {
+	t := p.peek()
+	if t.kind == gqlEOF {
+		return fmt.Errorf("syntax error: unexpected end of document")
+	}
+	return fmt.Errorf("syntax error: unexpected %q", t.value)
+}
+
+func (p *gqlParser) expect(punct string) error {
+	if !p.skip(punct) {
+		return p.unexpected()
+	}
+	return nil
+}
+
+func (p *gqlParser) name() (string, error) {
+	if p.peek().kind != gqlName {
+		return "", p.unexpected()
+	}
+	return p.next().value, nil
+}
+
+// gqlParse parses a GraphQL document
+func gqlParse(src string) (*gqlDocument, error) {
+	tokens, err := gqlLex(src)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &gqlParser{tokens: tokens}
+	doc := &gqlDocument{Fragments: make(map[string][]gqlSelection)}
+
+	for p.peek().kind != gqlEOF {
+		if p.is("{") {
+			selections, err := p.selectionSet()
+			if err != nil {
+				return nil, err
+			}
+			doc.Operations = append(doc.Operations, gqlOperation{Kind: "query", Selections: selections})
+			continue
+		}
+
+		keyword, err := p.name()
+		if err != nil {
+			return nil, err
+		}
+		switch keyword {
+		case "query", "mutation":
+			op, err := p.operation(keyword)
+			if err != nil {
+				return nil, err
+			}
+			doc.Operations = append(doc.Operations, op)
+		case "fragment":
+			name, err := p.name()
+			if err != nil {
+				return nil, err
+			}
+			if on, err := p.name(); err != nil || on != "on" {
+				return nil, fmt.Errorf("syntax error: expected type condition of fragment %s", name)
+			}
+			if _, err := p.name(); err != nil {
+				return nil, err
+			}
+			if doc.Fragments[name], err = p.selectionSet(); err != nil {
+				return nil, err
+			}
+		default:
+			return nil, fmt.Errorf("unsupported definition %q", keyword)
+		}
+	}
+
+	if len(doc.Operations) == 0 {
+		return nil, fmt.Errorf("document has no operations")
+	}
+	return doc, nil
+}
+
+func (p *gqlParser) operation(kind string) (op gqlOperation, err error) {
+	op = gqlOperation{Kind: kind, Defaults: make(map[string]interface{})}
+
+	if p.peek().kind == gqlName {
+		op.Name = p.next().value
+	}
+
+	if p.skip("(") {
+		for !p.skip(")") {
+			if err = p.expect("$"); err != nil {
+				return
+			}
+			var name string
+			if name, err = p.name(); err != nil {
+				return
+			}
+			if err = p.expect(":"); err != nil {
+				return
+			}
+			if err = p.typeRef(); err != nil {
+				return
+			}
+			if p.skip("=") {
+				if op.Defaults[name], err = p.value(true); err != nil {
+					return
+				}
+			}
+		}
+	}
+
+	op.Selections, err = p.selectionSet()
+	return
+}
+
+// typeRef skips a type such as [String!]! (arguments are checked by the
+// resolvers instead)
+func (p *gqlParser) typeRef() error {
+	if p.skip("[") {
+		if err := p.typeRef(); err != nil {
+			return err
+		}
+		if err := p.expect("]"); err != nil {
+			return err
+		}
+	} else if _, err := p.name(); err != nil {
+		return err
+	}
+	p.skip("!")
+	return nil
+}
+
+func (p *gqlParser) selectionSet() ([]gqlSelection, error) {
+	if err := p.expect("{"); err != nil {
+		return nil, err
+	}
+
+	var selections []gqlSelection
+	for !p.skip("}") {
+		if p.is("@") {
+			return nil, fmt.Errorf("directives are not supported")
+		}
+
+		if p.skip("...") {
+			if p.is("{") {
+				// An inline fragment without a type condition
+				inline, err := p.selectionSet()
+				if err != nil {
+					return nil, err
+				}
+				selections = append(selections, gqlSelection{Selections: inline})
+				continue
+			}
+			name, err := p.name()
+			if err != nil {
+				return nil, err
+			}
+			if name != "on" {
+				selections = append(selections, gqlSelection{Fragment: name})
+				continue
+			}
+			if _, err := p.name(); err != nil {
+				return nil, err
+			}
+			inline, err := p.selectionSet()
+			if err != nil {
+				return nil, err
+			}
+			selections = append(selections, gqlSelection{Selections: inline})
+			continue
+		}
+
+		var (
+			sel gqlSelection
+			err error
+		)
+		if sel.Name, err = p.name(); err != nil {
+			return nil, err
+		}
+		if p.skip(":") {
+			sel.Alias = sel.Name
+			if sel.Name, err = p.name(); err != nil {
+				return nil, err
+			}
+		}
+		if p.skip("(") {
+			sel.Args = make(map[string]interface{})
+			for !p.skip(")") {
+				var name string
+				if name, err = p.name(); err != nil {
+					return nil, err
+				}
+				if err = p.expect(":"); err != nil {
+					return nil, err
+				}
+				if sel.Args[name], err = p.value(false); err != nil {
+					return nil, err
+				}
+			}
+		}
+		if p.is("{") {
+			if sel.Selections, err = p.selectionSet(); err != nil {
+				return nil, err
+			}
+		}
+		selections = append(selections, sel)
+	}
+
+	return selections, nil
+}
+
+// value parses an argument value. Constant values (defaults of variables)
+// cannot reference variables.
+func (p *gqlParser) value(constant bool) (interface{}, error) {
+	start := p.pos
+	t := p.next()
+	switch t.kind {
+	case gqlInt:
+		return strconv.Atoi(t.value)
+	case gqlFloat:
+		return strconv.ParseFloat(t.value, 64)
+	case gqlString:
+		return t.value, nil
+	case gqlName:
+		switch t.value {
+		case "true":
+			return true, nil
+		case "false":
+			return false, nil
+		case "null":
+			return nil, nil
+		}
+		// Enum values are passed as strings
+		return t.value, nil
+	case gqlPunct:
+		switch t.value {
+		case "$":
+			if constant {
+				break
+			}
+			name, err := p.name()
+			return gqlVariable(name), err
+		case "[":
+			list := []interface{}{}
+			for !p.skip("]") {
+				v, err := p.value(constant)
+				if err != nil {
+					return nil, err
+				}
+				list = append(list, v)
+			}
+			return list, nil
+		case "{":
+			obj := make(map[string]interface{})
+			for !p.skip("}") {
+				name, err := p.name()
+				if err != nil {
+					return nil, err
+				}
+				if err := p.expect(":"); err != nil {
+					return nil, err
+				}
+				if obj[name], err = p.value(constant); err != nil {
+					return nil, err
+				}
+			}
+			return obj, nil
+		}
+	}
+	p.pos = start
+	return nil, p.unexpected()
+}
+
+// gqlExecutor executes an operation of a document
+type gqlExecutor struct {
+	doc       *gqlDocument
+	variables map[string]interface{}
+	errors    []gqlError
+}
+
+// gqlExecute executes the named operation (which may be empty if the
+// document only has one) of a parsed document against the root object of
+// its kind, i.e: the result of roots("query") or roots("mutation")
+func gqlExecute(doc *gqlDocument, operationName string, variables map[string]interface{}, roots func(kind string) (*gqlObject, error)) gqlResponse {
+	var op *gqlOperation
+	for i := range doc.Operations {
+		if doc.Operations[i].Name == operationName || (operationName == "" && len(doc.Operations) == 1) {
+			op = &doc.Operations[i]
+			break
+		}
+	}
+	if op == nil {
+		msg := fmt.Sprintf("unknown operation %q", operationName)
+		if operationName == "" {
+			msg = "operationName is required for documents with several operations"
+		}
+		return gqlResponse{Errors: []gqlError{{Message: msg}}}
+	}
+
+	root, err := roots(op.Kind)
+	if err != nil {
+		return gqlResponse{Errors: []gqlError{{Message: err.Error()}}}
+	}
+
+	e := &gqlExecutor{doc: doc, variables: make(map[string]interface{})}
+	for name, value := range op.Defaults {
+		e.variables[name] = value
+	}
+	for name, value := range variables {
+		e.variables[name] = value
+	}
+
+	data := e.object(root, op.Selections, nil)
+	return gqlResponse{Data: data, Errors: e.errors}
+}
+
+func (e *gqlExecutor) fail(path []interface{}, format string, args ...interface{}) {
+	e.errors = append(e.errors, gqlError{
+		Message: fmt.Sprintf(format, args...),
+		Path:    append([]interface{}{}, path...),
+	})
+}
+
+// collect flattens fragments into the list of fields selected
+func (e *gqlExecutor) collect(selections []gqlSelection, seen map[string]bool) ([]gqlSelection, error) {
+	var fields []gqlSelection
+	for _, sel := range selections {
+		switch {
+		case sel.Fragment != "":
+			if seen[sel.Fragment] {
+				return nil, fmt.Errorf("fragment %s is recursive", sel.Fragment)
+			}
+			fragment, ok := e.doc.Fragments[sel.Fragment]
+			if !ok {
+				return nil, fmt.Errorf("unknown fragment %s", sel.Fragment)
+			}
+			seen[sel.Fragment] = true
+			more, err := e.collect(fragment, seen)
+			delete(seen, sel.Fragment)
+			if err != nil {
+				return nil, err
+			}
+			fields = append(fields, more...)
+		case sel.Name == "":
+			more, err := e.collect(sel.Selections, seen)
+			if err != nil {
+				return nil, err
+			}
+			fields = append(fields, more...)
+		default:
+			fields = append(fields, sel)
+		}
+	}
+	return fields, nil
+}
+
+// args substitutes variables in the arguments of a field
+func (e *gqlExecutor) args(args map[string]interface{}) gqlArgs {
+	var substitute func(v interface{}) interface{}
+	substitute = func(v interface{}) interface{} {
+		switch v := v.(type) {
+		case gqlVariable:
+			return e.variables[string(v)]
+		case []interface{}:
+			list := make([]interface{}, len(v))
+			for i := range v {
+				list[i] = substitute(v[i])
+			}
+			return list
+		case map[string]interface{}:
+			obj := make(map[string]interface{}, len(v))
+			for k := range v {
+				obj[k] = substitute(v[k])
+			}
+			return obj
+		}
+		return v
+	}
+
+	resolved := make(gqlArgs, len(args))
+	for name, value := range args {
+		resolved[name] = substitute(value)
+	}
+	return resolved
+}
+
+func (e *gqlExecutor) object(obj *gqlObject, selections []gqlSelection, path []interface{}) interface{} {
+	fields, err := e.collect(selections, make(map[string]bool))
+	if err != nil {
+		e.fail(path, "%s", err)
+		return nil
+	}
+
+	result := &gqlMap{}
+	for _, sel := range fields {
+		key := sel.Name
+		if sel.Alias != "" {
+			key = sel.Alias
+		}
+		fieldPath := append(path, key)
+
+		if sel.Name == "__typename" {
+			result.set(key, obj.Type)
+			continue
+		}
+
+		value, ok := obj.Fields[sel.Name]
+		if !ok {
+			e.fail(fieldPath, "unknown field %s on type %s", sel.Name, obj.Type)
+			result.set(key, nil)
+			continue
+		}
+		if resolve, ok := value.(gqlResolver); ok {
+			if value, err = resolve(e.args(sel.Args)); err != nil {
+				e.fail(fieldPath, "%s", err)
+				result.set(key, nil)
+				continue
+			}
+		} else if len(sel.Args) > 0 {
+			e.fail(fieldPath, "field %s on type %s has no arguments", sel.Name, obj.Type)
+			result.set(key, nil)
+			continue
+		}
+
+		result.set(key, e.value(value, sel, fieldPath))
+	}
+	return result
+}
+
+func (e *gqlExecutor) value(value interface{}, sel gqlSelection, path []interface{}) interface{} {
+	switch v := value.(type) {
+	case *gqlObject:
+		if v == nil {
+			return nil
+		}
+		if sel.Selections == nil {
+			e.fail(path, "field %s of type %s must have a selection of subfields", sel.Name, v.Type)
+			return nil
+		}
+		return e.object(v, sel.Selections, path)
+	case []*gqlObject:
+		list := make([]interface{}, len(v))
+		for i := range v {
+			list[i] = e.value(v[i], sel, append(path, i))
+		}
+		return list
+	}
+
+	if sel.Selections != nil {
+		e.fail(path, "field %s is a scalar and cannot have a selection of subfields", sel.Name)
+		return nil
+	}
+	return value
+}
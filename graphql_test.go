@@ -0,0 +1,119 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGraphQLParse(t *testing.T) {
+	assert := assert.New(t)
+
+	doc, err := gqlParse(`
+		# Comments and commas are ignored
+		query Dashboard($n: Int = 10, $tags: [String!]!) {
+			top: bookmarks(first: $n, filter: "wi\"ki") { nodes { ...fields } }
+			... on Query { commands { name } }
+		}
+		fragment fields on Bookmark { name, url }
+	`)
+	assert.NoError(err)
+	assert.Len(doc.Operations, 1)
+
+	op := doc.Operations[0]
+	assert.Equal("query", op.Kind)
+	assert.Equal("Dashboard", op.Name)
+	assert.Equal(map[string]interface{}{"n": 10}, op.Defaults)
+	assert.Len(op.Selections, 2)
+	assert.Equal("top", op.Selections[0].Alias)
+	assert.Equal("bookmarks", op.Selections[0].Name)
+	assert.Equal(gqlVariable("n"), op.Selections[0].Args["first"])
+	assert.Equal(`wi"ki`, op.Selections[0].Args["filter"])
+	assert.Equal("fields", op.Selections[0].Selections[0].Selections[0].Fragment)
+	assert.Len(doc.Fragments["fields"], 2)
+
+	for _, src := range []string{
+		"",
+		"{",
+		"{ a(b: ) }",
+		"{ a @include(if: true) }",
+		`{ a(b: "unterminated) }`,
+		"subscription { a }",
+		"query ($a: ) { a }",
+	} {
+		_, err := gqlParse(src)
+		assert.Error(err, src)
+	}
+}
+
+func TestGraphQLExecute(t *testing.T) {
+	assert := assert.New(t)
+
+	item := func(n int) *gqlObject {
+		return &gqlObject{Type: "Item", Fields: map[string]interface{}{
+			"n": n,
+			"label": func(args gqlArgs) (interface{}, error) {
+				prefix, err := args.String("prefix")
+				return fmt.Sprintf("%s%d", prefix, n), err
+			},
+		}}
+	}
+	roots := func(kind string) (*gqlObject, error) {
+		if kind != "query" {
+			return nil, fmt.Errorf("no %ss", kind)
+		}
+		return &gqlObject{Type: "Query", Fields: map[string]interface{}{
+			"items": func(args gqlArgs) (interface{}, error) {
+				n, err := args.Int("n", 1)
+				var items []*gqlObject
+				for i := 1; i <= n; i++ {
+					items = append(items, item(i))
+				}
+				return items, err
+			},
+			"none": func(gqlArgs) (interface{}, error) {
+				return (*gqlObject)(nil), nil
+			},
+			"fail": func(gqlArgs) (interface{}, error) {
+				return nil, fmt.Errorf("boom")
+			},
+		}}, nil
+	}
+
+	execute := func(src string, variables map[string]interface{}) string {
+		doc, err := gqlParse(src)
+		assert.NoError(err)
+		data, err := json.Marshal(gqlExecute(doc, "", variables, roots))
+		assert.NoError(err)
+		return string(data)
+	}
+
+	// Results are in the order of the selection with variables (decoded
+	// from JSON as float64) substituted
+	assert.Equal(
+		`{"data":{"z":[{"label":"#1","n":1,"__typename":"Item"},{"label":"#2","n":2,"__typename":"Item"}],"none":null}}`,
+		execute(
+			`query($n: Int) { z: items(n: $n) { ...f n __typename } none { n } } fragment f on Item { label(prefix: "#") }`,
+			map[string]interface{}{"n": float64(2)},
+		),
+	)
+
+	// Errors null the field and are reported with its path
+	assert.Equal(
+		`{"data":{"fail":null,"items":[{"missing":null}]},"errors":[{"message":"boom","path":["fail"]},{"message":"unknown field missing on type Item","path":["items",0,"missing"]}]}`,
+		execute(`{ fail items { missing } }`, nil),
+	)
+	assert.Contains(execute(`{ items }`, nil), "must have a selection of subfields")
+	assert.Contains(execute(`{ items { n { x } } }`, nil), "cannot have a selection of subfields")
+	assert.Contains(execute(`{ items(n: "two") { n } }`, nil), "argument n: expected Int")
+	assert.Contains(execute(`{ items { ...f } } fragment f on Item { ...f }`, nil), "fragment f is recursive")
+	assert.Contains(execute(`mutation { items { n } }`, nil), "no mutations")
+
+	doc, err := gqlParse(`query a { items { n } } query b { none { n } }`)
+	assert.NoError(err)
+	assert.Equal("operationName is required for documents with several operations", gqlExecute(doc, "", nil, roots).Errors[0].Message)
+	assert.Equal(`unknown operation "c"`, gqlExecute(doc, "c", nil, roots).Errors[0].Message)
+	assert.Nil(gqlExecute(doc, "b", nil, roots).Errors)
+}
@@ -0,0 +1,438 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log/slog"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+const (
+	// MaxGraphQLRequestBytes is the maximum size of a GraphQL request body
+	MaxGraphQLRequestBytes = 64 * 1024
+
+	// DefaultGraphQLPageSize is the number of bookmarks per page
+	DefaultGraphQLPageSize = 50
+
+	// MaxGraphQLPageSize is the maximum number of bookmarks per page
+	MaxGraphQLPageSize = 500
+)
+
+// GraphQLSchema documents the types, queries and mutations served at
+// /graphql (the endpoint does not support introspection)
+const GraphQLSchema = `type Query {
+  bookmark(name: String!): Bookmark
+  bookmarks(filter: String, target: String, first: Int = 50, after: String): BookmarkConnection!
+  commands(filter: String): [Command!]!
+  history(filter: String, before: String, limit: Int = 50): HistoryPage!
+}
+
+type Mutation {
+  addBookmark(name: String!, url: String!, replace: Boolean = false): Bookmark!
+  updateBookmark(name: String!, url: String!): Bookmark!
+  deleteBookmark(name: String!): Boolean!
+}
+
+type Bookmark {
+  name: String!
+  url: String!
+  modified: String
+  expand(query: String!): String!
+}
+
+type BookmarkConnection {
+  totalCount: Int!
+  nodes: [Bookmark!]!
+  next: String
+}
+
+type Command {
+  name: String!
+  description: String!
+  signature: String!
+  args: [String!]!
+  uses: Int!
+}
+
+type HistoryEntry {
+  id: String!
+  time: String!
+  query: String!
+  name: String
+  url: String
+}
+
+type HistoryPage {
+  entries: [HistoryEntry!]!
+  next: String
+}
+`
+
+// GraphQLRequest is the body of a GraphQL request
+type GraphQLRequest struct {
+	Query         string                 `json:"query"`
+	OperationName string                 `json:"operationName"`
+	Variables     map[string]interface{} `json:"variables"`
+}
+
+// contains reports whether s contains filter ignoring case
+func contains(s, filter string) bool {
+	return strings.Contains(strings.ToLower(s), strings.ToLower(filter))
+}
+
+func gqlBookmark(b Bookmark) *gqlObject {
+	return &gqlObject{Type: "Bookmark", Fields: map[string]interface{}{
+		"name": b.Name(),
+		"url":  b.URL(),
+		"modified": func(gqlArgs) (interface{}, error) {
+			if t, ok := BookmarkModified(b.Name()); ok {
+				return t.UTC().Format(time.RFC3339Nano), nil
+			}
+			return nil, nil
+		},
+		"expand": func(args gqlArgs) (interface{}, error) {
+			q, err := args.String("query")
+			return b.Expand(q), err
+		},
+	}}
+}
+
+func gqlCommand(info CommandInfo) *gqlObject {
+	return &gqlObject{Type: "Command", Fields: map[string]interface{}{
+		"name":        info.Name,
+		"description": info.Description,
+		"signature":   info.Signature,
+		"args":        info.Args,
+		"uses":        info.Uses,
+	}}
+}
+
+func gqlHistoryEntry(entry HistoryEntry) *gqlObject {
+	optional := func(s string) interface{} {
+		if s == "" {
+			return nil
+		}
+		return s
+	}
+	return &gqlObject{Type: "HistoryEntry", Fields: map[string]interface{}{
+		"id":    entry.ID,
+		"time":  entry.Time.UTC().Format(time.RFC3339Nano),
+		"query": entry.Query,
+		"name":  optional(entry.Name),
+		"url":   optional(entry.URL),
+	}}
+}
+
+// queryBookmarks lists bookmarks (optionally only those matching filter or
+// pointing at target) sorted by name, first at a time after the cursor
+func queryBookmarks(args gqlArgs) (interface{}, error) {
+	filter, err := args.String("filter")
+	if err != nil {
+		return nil, err
+	}
+	target, err := args.String("target")
+	if err != nil {
+		return nil, err
+	}
+	after, err := args.String("after")
+	if err != nil {
+		return nil, err
+	}
+	first, err := args.Int("first", DefaultGraphQLPageSize)
+	if err != nil {
+		return nil, err
+	}
+	if first < 0 {
+		return nil, fmt.Errorf("first must not be negative")
+	}
+	if first > MaxGraphQLPageSize {
+		first = MaxGraphQLPageSize
+	}
+
+	var bookmarks []Bookmark
+	if target != "" {
+		if TargetDomain(target) == "" {
+			return nil, fmt.Errorf("invalid target")
+		}
+		bookmarks, err = FindBookmarksByTarget(target)
+		sort.Slice(bookmarks, func(i, j int) bool {
+			return bookmarks[i].Name() < bookmarks[j].Name()
+		})
+	} else {
+		bookmarks, err = ListBookmarks()
+	}
+	if err != nil {
+		slog.Error("error reading bookmarks", "err", err)
+		return nil, fmt.Errorf("error reading bookmarks")
+	}
+
+	total := 0
+	nodes := []*gqlObject{}
+	var next interface{}
+	for _, bookmark := range bookmarks {
+		if filter != "" && !contains(bookmark.Name(), filter) && !contains(bookmark.URL(), filter) {
+			continue
+		}
+		total++
+		if bookmark.Name() <= after {
+			continue
+		}
+		if len(nodes) < first {
+			nodes = append(nodes, gqlBookmark(bookmark))
+		} else if next == nil && len(nodes) > 0 {
+			next = nodes[len(nodes)-1].Fields["name"]
+		}
+	}
+
+	return &gqlObject{Type: "BookmarkConnection", Fields: map[string]interface{}{
+		"totalCount": total,
+		"nodes":      nodes,
+		"next":       next,
+	}}, nil
+}
+
+// queryHistory lists up to limit history entries (optionally only those
+// matching filter) older than the cursor before, newest first
+func (s *Server) queryHistory(args gqlArgs) (interface{}, error) {
+	if s.config.DisableHistory {
+		return nil, fmt.Errorf("history is disabled")
+	}
+
+	filter, err := args.String("filter")
+	if err != nil {
+		return nil, err
+	}
+	before, err := args.String("before")
+	if err != nil {
+		return nil, err
+	}
+	limit, err := args.Int("limit", DefaultHistoryPageSize)
+	if err != nil {
+		return nil, err
+	}
+	if limit <= 0 {
+		return nil, fmt.Errorf("limit must be positive")
+	}
+	if limit > MaxHistoryPageSize {
+		limit = MaxHistoryPageSize
+	}
+
+	entries := []*gqlObject{}
+	var next interface{}
+	for next == nil {
+		page, err := ListHistory(before, limit)
+		if err != nil {
+			slog.Error("error reading history", "err", err)
+			return nil, fmt.Errorf("error reading history")
+		}
+		for i, entry := range page.Entries {
+			if filter != "" && !contains(entry.Query, filter) && !contains(entry.Name, filter) && !contains(entry.URL, filter) {
+				continue
+			}
+			entries = append(entries, gqlHistoryEntry(entry))
+			if len(entries) == limit {
+				if i < len(page.Entries)-1 || page.Next != "" {
+					next = entry.ID
+				}
+				break
+			}
+		}
+		if len(entries) == limit || page.Next == "" {
+			break
+		}
+		before = page.Next
+	}
+
+	return &gqlObject{Type: "HistoryPage", Fields: map[string]interface{}{
+		"entries": entries,
+		"next":    next,
+	}}, nil
+}
+
+// bookmarkArgs returns the (lowercased) name and url arguments of a mutation
+func bookmarkArgs(args gqlArgs) (name, url string, err error) {
+	if name, err = args.String("name"); err != nil {
+		return
+	}
+	if url, err = args.String("url"); err != nil {
+		return
+	}
+	name = strings.ToLower(strings.Trim(name, "/"))
+	err = ValidateBookmark(name, url)
+	return
+}
+
+// graphQLRoot returns the root object of queries or mutations made with the
+// token of the request
+func (s *Server) graphQLRoot(r *http.Request) func(kind string) (*gqlObject, error) {
+	return func(kind string) (*gqlObject, error) {
+		if kind == "query" {
+			return &gqlObject{Type: "Query", Fields: map[string]interface{}{
+				"bookmark": func(args gqlArgs) (interface{}, error) {
+					name, err := args.String("name")
+					if err != nil {
+						return nil, err
+					}
+					if bookmark, ok := LookupBookmark(name); ok {
+						return gqlBookmark(bookmark), nil
+					}
+					return (*gqlObject)(nil), nil
+				},
+				"bookmarks": queryBookmarks,
+				"commands": func(args gqlArgs) (interface{}, error) {
+					filter, err := args.String("filter")
+					if err != nil {
+						return nil, err
+					}
+					commands := []*gqlObject{}
+					for _, command := range s.enabledCommands() {
+						info := s.describeCommand(command)
+						if filter == "" || contains(info.Name, filter) || contains(info.Description, filter) {
+							commands = append(commands, gqlCommand(info))
+						}
+					}
+					return commands, nil
+				},
+				"history": s.queryHistory,
+			}}, nil
+		}
+
+		if r.Method != http.MethodPost {
+			return nil, fmt.Errorf("mutations must be POSTed")
+		}
+		if token, _ := RequestToken(r); !token.Allows(ScopeWrite) {
+			s.counters.Inc("n_api_forbidden")
+			return nil, fmt.Errorf("token does not have the %s scope", ScopeWrite)
+		}
+		if s.config.ReadOnly {
+			return nil, fmt.Errorf("instance is read-only")
+		}
+
+		return &gqlObject{Type: "Mutation", Fields: map[string]interface{}{
+			"addBookmark": func(args gqlArgs) (interface{}, error) {
+				name, url, err := bookmarkArgs(args)
+				if err != nil {
+					return nil, err
+				}
+				replace, err := args.Bool("replace")
+				if err != nil {
+					return nil, err
+				}
+				old, err := bookmarkURL(name)
+				if err != nil {
+					return nil, fmt.Errorf("error reading bookmark")
+				}
+				if !replace && old != "" {
+					return nil, fmt.Errorf("bookmark %s already exists", name)
+				}
+				if err := SaveBookmark(name, url); err != nil {
+					slog.Error("error saving bookmark", "name", name, "err", err)
+					return nil, fmt.Errorf("error saving bookmark")
+				}
+				auditBookmark(r, name, old, url)
+				return gqlBookmark(Bookmark{name: name, url: url}), nil
+			},
+			"updateBookmark": func(args gqlArgs) (interface{}, error) {
+				name, url, err := bookmarkArgs(args)
+				if err != nil {
+					return nil, err
+				}
+				old, err := bookmarkURL(name)
+				if err != nil {
+					return nil, fmt.Errorf("error reading bookmark")
+				}
+				if old == "" {
+					return nil, fmt.Errorf("no bookmark named %s", name)
+				}
+				if err := SaveBookmark(name, url); err != nil {
+					slog.Error("error saving bookmark", "name", name, "err", err)
+					return nil, fmt.Errorf("error saving bookmark")
+				}
+				auditBookmark(r, name, old, url)
+				return gqlBookmark(Bookmark{name: name, url: url}), nil
+			},
+			"deleteBookmark": func(args gqlArgs) (interface{}, error) {
+				name, err := args.String("name")
+				if err != nil {
+					return nil, err
+				}
+				name = strings.ToLower(strings.Trim(name, "/"))
+				old, err := bookmarkURL(name)
+				if err != nil {
+					return nil, fmt.Errorf("error reading bookmark")
+				}
+				if old == "" {
+					return false, nil
+				}
+				if err := DeleteBookmark(name); err != nil {
+					slog.Error("error deleting bookmark", "name", name, "err", err)
+					return nil, fmt.Errorf("error deleting bookmark")
+				}
+				auditBookmark(r, name, old, "")
+				return true, nil
+			},
+		}}, nil
+	}
+}
+
+// GraphQLHandler executes GraphQL queries over bookmarks, commands and
+// history and mutations of bookmarks, POSTed as JSON or passed in the query
+// string, e.g: /graphql?query={bookmarks(filter:"wiki"){nodes{name url}}}
+func (s *Server) GraphQLHandler() httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+		s.counters.Inc("n_graphql")
+
+		var req GraphQLRequest
+		if r.Method == http.MethodPost {
+			body := io.LimitReader(r.Body, MaxGraphQLRequestBytes)
+			if strings.HasPrefix(r.Header.Get("Content-Type"), "application/graphql") {
+				data, err := ioutil.ReadAll(body)
+				if err != nil {
+					WriteJSON(w, http.StatusBadRequest, gqlResponse{Errors: []gqlError{{Message: err.Error()}}})
+					return
+				}
+				req.Query = string(data)
+			} else if err := json.NewDecoder(body).Decode(&req); err != nil {
+				WriteJSON(w, http.StatusBadRequest, gqlResponse{Errors: []gqlError{{Message: "invalid json: " + err.Error()}}})
+				return
+			}
+		} else {
+			req.Query = r.URL.Query().Get("query")
+			req.OperationName = r.URL.Query().Get("operationName")
+			if v := r.URL.Query().Get("variables"); v != "" {
+				if err := json.Unmarshal([]byte(v), &req.Variables); err != nil {
+					WriteJSON(w, http.StatusBadRequest, gqlResponse{Errors: []gqlError{{Message: "invalid variables: " + err.Error()}}})
+					return
+				}
+			}
+		}
+
+		doc, err := gqlParse(req.Query)
+		if err != nil {
+			s.counters.Inc("n_graphql_failed")
+			WriteJSON(w, http.StatusBadRequest, gqlResponse{Errors: []gqlError{{Message: err.Error()}}})
+			return
+		}
+
+		res := gqlExecute(doc, req.OperationName, req.Variables, s.graphQLRoot(r))
+		if len(res.Errors) > 0 {
+			s.counters.Inc("n_graphql_failed")
+		}
+		WriteJSON(w, http.StatusOK, res)
+	}
+}
+
+// GraphQLSchemaHandler serves the GraphQL schema in SDL
+func (s *Server) GraphQLSchemaHandler() httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		io.WriteString(w, GraphQLSchema)
+	}
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGraphQLHandler(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir("", "golinks")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	db, err = OpenStore(filepath.Join(dir, "test.db"))
+	assert.NoError(err)
+	defer db.Close()
+
+	for _, name := range []string{"a", "b", "c", "wiki"} {
+		assert.NoError(SaveBookmark(name, "https://"+name+".example.com/%s"))
+	}
+	for _, query := range []string{"a 1", "wiki go", "b 2", "wiki rust"} {
+		_, err := AddHistory(HistoryEntry{Query: query})
+		assert.NoError(err)
+	}
+
+	s, err := NewServer(":8000", Config{})
+	assert.NoError(err)
+
+	do := func(scope, body string) (int, string) {
+		w := httptest.NewRecorder()
+		r, _ := http.NewRequest("POST", "/graphql", strings.NewReader(body))
+		if scope != "" {
+			authorize(r, scope)
+		}
+		s.router.ServeHTTP(w, r)
+		return w.Code, w.Body.String()
+	}
+	query := func(scope, q string, variables map[string]interface{}) (int, string) {
+		body, _ := json.Marshal(GraphQLRequest{Query: q, Variables: variables})
+		return do(scope, string(body))
+	}
+
+	code, _ := query("", `{ commands { name } }`, nil)
+	assert.Equal(http.StatusUnauthorized, code)
+
+	code, body := query(ScopeRead, `{ bookmarks(first: 2) { totalCount nodes { name } next } }`, nil)
+	assert.Equal(http.StatusOK, code)
+	assert.JSONEq(`{"data": {"bookmarks": {"totalCount": 4, "nodes": [{"name": "a"}, {"name": "b"}], "next": "b"}}}`, body)
+
+	_, body = query(ScopeRead, `query($after: String) { bookmarks(first: 2, after: $after) { nodes { name } next } }`, map[string]interface{}{"after": "b"})
+	assert.JSONEq(`{"data": {"bookmarks": {"nodes": [{"name": "c"}, {"name": "wiki"}], "next": null}}}`, body)
+
+	_, body = query(ScopeRead, `{ bookmarks(filter: "WIKI") { totalCount } bookmark(name: "wiki") { url expand(query: "go") } missing: bookmark(name: "x") { url } }`, nil)
+	assert.JSONEq(`{"data": {"bookmarks": {"totalCount": 1}, "bookmark": {"url": "https://wiki.example.com/%s", "expand": "https://wiki.example.com/go"}, "missing": null}}`, body)
+
+	_, body = query(ScopeRead, `{ commands(filter: "ping") { name signature } }`, nil)
+	assert.JSONEq(`{"data": {"commands": [{"name": "ping", "signature": ""}]}}`, body)
+
+	// History is filtered across pages, newest first
+	_, body = query(ScopeRead, `{ history(filter: "wiki", limit: 1) { entries { query } next } }`, nil)
+	var res struct {
+		Data struct {
+			History struct {
+				Entries []struct{ Query string } `json:"entries"`
+				Next    string                   `json:"next"`
+			} `json:"history"`
+		} `json:"data"`
+	}
+	assert.NoError(json.Unmarshal([]byte(body), &res))
+	assert.Equal("wiki rust", res.Data.History.Entries[0].Query)
+	assert.NotEmpty(res.Data.History.Next)
+
+	_, body = query(ScopeRead, `query($before: String) { history(filter: "wiki", limit: 1, before: $before) { entries { query } next } }`, map[string]interface{}{"before": res.Data.History.Next})
+	assert.Contains(body, `"entries":[{"query":"wiki go"}]`)
+
+	// Mutations require the write scope
+	mutation := `mutation { addBookmark(name: "Jira", url: "https://jira.example.com/browse/%s") { name url } }`
+	_, body = query(ScopeRead, mutation, nil)
+	assert.Contains(body, "token does not have the write scope")
+	_, ok := LookupBookmark("jira")
+	assert.False(ok)
+
+	_, body = query(ScopeWrite, mutation, nil)
+	assert.JSONEq(`{"data": {"addBookmark": {"name": "jira", "url": "https://jira.example.com/browse/%s"}}}`, body)
+
+	_, body = query(ScopeWrite, mutation, nil)
+	assert.Contains(body, "bookmark jira already exists")
+
+	_, body = query(ScopeWrite, `mutation { updateBookmark(name: "jira", url: "https://jira.example.com/issues/%s") { url } deleteBookmark(name: "a") }`, nil)
+	assert.JSONEq(`{"data": {"updateBookmark": {"url": "https://jira.example.com/issues/%s"}, "deleteBookmark": true}}`, body)
+	_, ok = LookupBookmark("a")
+	assert.False(ok)
+
+	_, body = query(ScopeWrite, `mutation { addBookmark(name: "x", url: "javascript:alert(1)") { name } }`, nil)
+	assert.Contains(body, "url must be an absolute http(s) url")
+
+	code, _ = do(ScopeRead, `{"query": "{ bookmarks {"}`)
+	assert.Equal(http.StatusBadRequest, code)
+
+	// Queries can be passed in the query string, mutations can't
+	w := httptest.NewRecorder()
+	r, _ := http.NewRequest("GET", "/graphql?query="+url.QueryEscape(`{ bookmark(name: "b") { name } }`), nil)
+	authorize(r, ScopeWrite)
+	s.router.ServeHTTP(w, r)
+	assert.JSONEq(`{"data": {"bookmark": {"name": "b"}}}`, w.Body.String())
+
+	w = httptest.NewRecorder()
+	r, _ = http.NewRequest("GET", "/graphql?query="+url.QueryEscape(`mutation { deleteBookmark(name: "b") }`), nil)
+	authorize(r, ScopeWrite)
+	s.router.ServeHTTP(w, r)
+	assert.Contains(w.Body.String(), "mutations must be POSTed")
+
+	w = httptest.NewRecorder()
+	r, _ = http.NewRequest("GET", "/graphql/schema", nil)
+	s.router.ServeHTTP(w, r)
+	assert.Equal(http.StatusOK, w.Code)
+	assert.Contains(w.Body.String(), "type Mutation")
+}
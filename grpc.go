@@ -0,0 +1,283 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net"
+	"strings"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+
+	pb "github.com/prologic/golinks/golinkspb"
+)
+
+// grpcScopes are the API token scopes required by gRPC methods. Methods not
+// listed are as open as redirects (see GRPCService.scope).
+var grpcScopes = map[string]string{
+	pb.Golinks_AddBookmark_FullMethodName: ScopeWrite,
+	pb.Golinks_History_FullMethodName:     ScopeRead,
+}
+
+// GRPCService implements the golinks gRPC service so internal tooling can
+// integrate without scraping the web UI
+type GRPCService struct {
+	pb.UnimplementedGolinksServer
+
+	server *Server
+}
+
+// NewGRPCService ...
+func NewGRPCService(server *Server) *GRPCService {
+	return &GRPCService{server: server}
+}
+
+// scope returns the API token scope the method requires, if any. Redirects
+// are only open if the web UI is, else Lookup and Resolve need ScopeRead.
+func (g *GRPCService) scope(method string) (string, bool) {
+	if scope, ok := grpcScopes[method]; ok {
+		return scope, true
+	}
+	if g.server.loginRequired() {
+		return ScopeRead, true
+	}
+	return "", false
+}
+
+// allowed reports whether the client is let in by -allow-ips and
+// -deny-ips, going by the address connecting to golinks
+func (g *GRPCService) allowed(ctx context.Context) bool {
+	if g.server.config.AllowIPs == "" && g.server.config.DenyIPs == "" {
+		return true
+	}
+
+	var ip net.IP
+	if p, ok := peer.FromContext(ctx); ok {
+		host, _, err := net.SplitHostPort(p.Addr.String())
+		if err != nil {
+			host = p.Addr.String()
+		}
+		ip = net.ParseIP(host)
+	}
+	return g.server.ipFilter.Allowed(ip)
+}
+
+// namespaces returns the namespaces bookmarks are looked up and written in
+// (see Namespaces), as API tokens aren't any user: only the global ones
+// in multi-user mode, or nil otherwise
+func (g *GRPCService) namespaces() *Namespaces {
+	if !g.server.config.MultiUser {
+		return nil
+	}
+	return &Namespaces{exists: g.server.teamExists}
+}
+
+// authorize is a unary interceptor keeping out clients outside the allowed
+// networks and requiring an API token (passed as "authorization: Bearer
+// <token>" metadata) with the method's scope
+func (g *GRPCService) authorize(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	g.server.counters.Inc("n_grpc")
+
+	if !g.allowed(ctx) {
+		g.server.counters.Inc("n_ip_denied")
+		return nil, status.Error(codes.PermissionDenied, "address not allowed")
+	}
+
+	scope, ok := g.scope(info.FullMethod)
+	if !ok {
+		return handler(ctx, req)
+	}
+
+	var secret string
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		for _, auth := range md.Get("authorization") {
+			if len(auth) > 7 && strings.EqualFold(auth[:7], "bearer ") {
+				secret = strings.TrimSpace(auth[7:])
+			}
+		}
+	}
+	if secret == "" {
+		g.server.counters.Inc("n_api_unauthorized")
+		return nil, status.Error(codes.Unauthenticated, "missing bearer token")
+	}
+
+	token, ok := LookupToken(secret)
+	if !ok {
+		g.server.counters.Inc("n_api_unauthorized")
+		return nil, status.Error(codes.Unauthenticated, "invalid bearer token")
+	}
+	if !token.Allows(scope) {
+		g.server.counters.Inc("n_api_forbidden")
+		return nil, status.Errorf(codes.PermissionDenied, "token does not have the %s scope", scope)
+	}
+
+	return handler(context.WithValue(ctx, tokenContextKey{}, token), req)
+}
+
+// Lookup ...
+func (g *GRPCService) Lookup(ctx context.Context, req *pb.LookupRequest) (*pb.Link, error) {
+	if req.GetName() == "" {
+		return nil, status.Error(codes.InvalidArgument, "name is required")
+	}
+
+	bookmark, ok := g.namespaces().Lookup(req.GetName())
+	if !ok {
+		return nil, status.Errorf(codes.NotFound, "no bookmark named %s", req.GetName())
+	}
+	return &pb.Link{Name: bookmark.Name(), Url: bookmark.URL()}, nil
+}
+
+// Resolve resolves a query like the web UI would without executing it
+func (g *GRPCService) Resolve(ctx context.Context, req *pb.ResolveRequest) (*pb.Resolution, error) {
+	q := strings.TrimSpace(req.GetQuery())
+	if q == "" {
+		return nil, status.Error(codes.InvalidArgument, "query is required")
+	}
+
+	tokens := strings.Split(q, " ")
+	cmd, args := tokens[0], strings.Join(tokens[1:], " ")
+
+	if command := LookupCommand(cmd); command != nil {
+		return &pb.Resolution{Kind: pb.Resolution_KIND_COMMAND, Name: command.Name()}, nil
+	}
+
+	if bookmark, ok := g.namespaces().Lookup(cmd); ok {
+		return &pb.Resolution{
+			Kind: pb.Resolution_KIND_BOOKMARK,
+			Name: bookmark.Name(),
+			Url:  bookmark.Expand(args),
+		}, nil
+	}
+
+	if res, ok := g.server.resolveRemote(cmd); ok {
+		return &pb.Resolution{
+			Kind: pb.Resolution_KIND_PEER,
+			Name: res.Name,
+			Url:  Bookmark{name: res.Name, url: res.URL}.Expand(args),
+			Peer: res.Peer,
+		}, nil
+	}
+
+	if url := g.server.settings().URL; url != "" {
+		return &pb.Resolution{Kind: pb.Resolution_KIND_DEFAULT, Url: fmt.Sprintf(url, q)}, nil
+	}
+
+	return nil, status.Errorf(codes.NotFound, "nothing matches %s", q)
+}
+
+// AddBookmark ...
+func (g *GRPCService) AddBookmark(ctx context.Context, req *pb.AddBookmarkRequest) (*pb.Link, error) {
+	if g.server.config.ReadOnly {
+		return nil, status.Error(codes.FailedPrecondition, "instance is read-only")
+	}
+
+	name := strings.ToLower(strings.TrimSpace(req.GetName()))
+	if err := ValidateBookmark(name, req.GetUrl()); err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	// Like the add command, but as no user: personal and team bookmarks
+	// can't be written
+	if _, _, _, err := g.namespaces().writable(name); err != nil {
+		code := codes.InvalidArgument
+		if err == ErrNoUser || err == ErrNotMember {
+			code = codes.PermissionDenied
+		}
+		return nil, status.Error(code, err.Error())
+	}
+
+	old, err := bookmarkURL(name)
+	if err != nil {
+		slog.Error("error looking up bookmark", "name", name, "err", err)
+		return nil, status.Error(codes.Internal, "error looking up bookmark")
+	}
+	if old != "" && !req.GetReplace() {
+		return nil, status.Errorf(codes.AlreadyExists, "bookmark %s already exists", name)
+	}
+
+	// Bookmarks are owned by the token that created them
+	var user string
+	if token, ok := ctx.Value(tokenContextKey{}).(Token); ok {
+		user = "token:" + token.ID
+	}
+	err = SaveBookmark(name, req.GetUrl())
+	if err == nil {
+		err = ClaimBookmark(name, user)
+	}
+	if err != nil {
+		slog.Error("error saving bookmark", "name", name, "err", err)
+		return nil, status.Error(codes.Internal, "error saving bookmark")
+	}
+	auditBookmarkAs(user, name, old, req.GetUrl())
+	return &pb.Link{Name: name, Url: req.GetUrl()}, nil
+}
+
+// History ...
+func (g *GRPCService) History(ctx context.Context, req *pb.HistoryRequest) (*pb.HistoryPage, error) {
+	if g.server.config.DisableHistory {
+		return nil, status.Error(codes.FailedPrecondition, "history is disabled")
+	}
+
+	limit := int(req.GetLimit())
+	if limit < 0 {
+		return nil, status.Error(codes.InvalidArgument, "invalid limit")
+	}
+	if limit > MaxHistoryPageSize {
+		limit = MaxHistoryPageSize
+	}
+
+	page, err := ListHistory(req.GetBefore(), limit)
+	if err != nil {
+		slog.Error("error reading history", "err", err)
+		return nil, status.Error(codes.Internal, "error reading history")
+	}
+
+	res := &pb.HistoryPage{Next: page.Next}
+	for _, entry := range page.Entries {
+		res.Entries = append(res.Entries, &pb.HistoryEntry{
+			Id:           entry.ID,
+			TimeUnixNano: entry.Time.UnixNano(),
+			Query:        entry.Query,
+			Name:         entry.Name,
+			Url:          entry.URL,
+		})
+	}
+	return res, nil
+}
+
+// NewGRPCServer returns a gRPC server serving the golinks service, over TLS
+// with the certificate of -tls-cert
+func (s *Server) NewGRPCServer() *grpc.Server {
+	service := NewGRPCService(s)
+	opts := []grpc.ServerOption{grpc.UnaryInterceptor(service.authorize)}
+	if s.server.TLSConfig != nil {
+		opts = append(opts, grpc.Creds(credentials.NewTLS(s.server.TLSConfig)))
+	}
+	server := grpc.NewServer(opts...)
+	pb.RegisterGolinksServer(server, service)
+	return server
+}
+
+// ListenGRPC listens on the configured address and serves the gRPC service
+// in the background
+func (s *Server) ListenGRPC() error {
+	lis, err := net.Listen("tcp", s.config.GRPCBind)
+	if err != nil {
+		return err
+	}
+
+	s.grpcServer = s.NewGRPCServer()
+	go func() {
+		if err := s.grpcServer.Serve(lis); err != nil {
+			slog.Error("error serving gRPC", "err", err)
+		}
+	}()
+	slog.Info("gRPC listening", "addr", lis.Addr().String())
+
+	return nil
+}
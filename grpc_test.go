@@ -0,0 +1,220 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+
+	"github.com/stretchr/testify/assert"
+
+	pb "github.com/prologic/golinks/golinkspb"
+)
+
+func TestGRPCService(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir("", "golinks")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	db, err = OpenStore(filepath.Join(dir, "test.db"))
+	assert.NoError(err)
+	defer db.Close()
+
+	assert.NoError(SaveBookmark("gh", "https://github.com/%s"))
+
+	s, err := NewServer(":8000", Config{URL: DefaultURL})
+	assert.NoError(err)
+
+	lis := bufconn.Listen(1 << 20)
+	server := s.NewGRPCServer()
+	go server.Serve(lis)
+	defer server.Stop()
+
+	conn, err := grpc.NewClient(
+		"passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return lis.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	assert.NoError(err)
+	defer conn.Close()
+
+	client := pb.NewGolinksClient(conn)
+	ctx := context.Background()
+
+	code := func(err error) codes.Code {
+		return status.Code(err)
+	}
+
+	link, err := client.Lookup(ctx, &pb.LookupRequest{Name: "GH"})
+	assert.NoError(err)
+	assert.Equal("https://github.com/%s", link.GetUrl())
+
+	_, err = client.Lookup(ctx, &pb.LookupRequest{Name: "missing"})
+	assert.Equal(codes.NotFound, code(err))
+
+	res, err := client.Resolve(ctx, &pb.ResolveRequest{Query: "gh prologic/golinks"})
+	assert.NoError(err)
+	assert.Equal(pb.Resolution_KIND_BOOKMARK, res.GetKind())
+	assert.Equal("https://github.com/prologic/golinks", res.GetUrl())
+
+	res, err = client.Resolve(ctx, &pb.ResolveRequest{Query: "help"})
+	assert.NoError(err)
+	assert.Equal(pb.Resolution_KIND_COMMAND, res.GetKind())
+
+	res, err = client.Resolve(ctx, &pb.ResolveRequest{Query: "foo bar"})
+	assert.NoError(err)
+	assert.Equal(pb.Resolution_KIND_DEFAULT, res.GetKind())
+	assert.Contains(res.GetUrl(), "foo bar")
+
+	// Management requires a token
+	add := &pb.AddBookmarkRequest{Name: "wiki", Url: "https://wiki.corp/%s"}
+	_, err = client.AddBookmark(ctx, add)
+	assert.Equal(codes.Unauthenticated, code(err))
+
+	_, read, err := CreateToken("read", []string{ScopeRead})
+	assert.NoError(err)
+	_, write, err := CreateToken("write", []string{ScopeWrite})
+	assert.NoError(err)
+
+	withToken := func(secret string) context.Context {
+		return metadata.AppendToOutgoingContext(ctx, "authorization", "Bearer "+secret)
+	}
+
+	_, err = client.AddBookmark(withToken(read), add)
+	assert.Equal(codes.PermissionDenied, code(err))
+
+	link, err = client.AddBookmark(withToken(write), add)
+	assert.NoError(err)
+	assert.Equal("wiki", link.GetName())
+	bookmark, ok := LookupBookmark("wiki")
+	assert.True(ok)
+	assert.Equal("https://wiki.corp/%s", bookmark.URL())
+	audit, err := ListAudit("", 10)
+	assert.NoError(err)
+	assert.Len(audit.Entries, 1)
+	assert.Equal(EventBookmarkCreated, audit.Entries[0].Action)
+	assert.Contains(audit.Entries[0].User, "token:")
+
+	_, err = client.AddBookmark(withToken(write), add)
+	assert.Equal(codes.AlreadyExists, code(err))
+
+	add.Replace = true
+	add.Url = "https://wiki.corp/search?q=%s"
+	_, err = client.AddBookmark(withToken(write), add)
+	assert.NoError(err)
+
+	_, err = client.AddBookmark(withToken(write), &pb.AddBookmarkRequest{Name: "help", Url: "https://example.com"})
+	assert.Equal(codes.InvalidArgument, code(err))
+
+	_, err = AddHistory(HistoryEntry{Query: "gh golinks", Name: "gh", URL: "https://github.com/golinks"})
+	assert.NoError(err)
+
+	_, err = client.History(ctx, &pb.HistoryRequest{})
+	assert.Equal(codes.Unauthenticated, code(err))
+
+	page, err := client.History(withToken(read), &pb.HistoryRequest{Limit: 10})
+	assert.NoError(err)
+	assert.Len(page.GetEntries(), 1)
+	assert.Equal("gh golinks", page.GetEntries()[0].GetQuery())
+	assert.Empty(page.GetNext())
+}
+
+func TestGRPCAccess(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir("", "golinks")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	db, err = OpenStore(filepath.Join(dir, "test.db"))
+	assert.NoError(err)
+	defer db.Close()
+
+	assert.NoError(SaveBookmark("gh", "https://github.com/%s"))
+	assert.NoError(db.Put([]byte(teamPrefix("infra")+"wiki"), []byte("https://wiki.corp/%s")))
+	certFile, keyFile := writeCertificate(t, dir)
+
+	// serve serves the gRPC service of a server on a local port
+	serve := func(config Config, creds credentials.TransportCredentials) (pb.GolinksClient, func()) {
+		s, err := NewServer(":8000", config)
+		assert.NoError(err)
+		lis, err := net.Listen("tcp", "127.0.0.1:0")
+		assert.NoError(err)
+		server := s.NewGRPCServer()
+		go server.Serve(lis)
+
+		conn, err := grpc.NewClient(lis.Addr().String(), grpc.WithTransportCredentials(creds))
+		assert.NoError(err)
+		return pb.NewGolinksClient(conn), func() {
+			conn.Close()
+			server.Stop()
+		}
+	}
+	code := func(err error) codes.Code {
+		return status.Code(err)
+	}
+
+	_, read, err := CreateToken("read", []string{ScopeRead})
+	assert.NoError(err)
+	token, write, err := CreateToken("write", []string{ScopeWrite})
+	assert.NoError(err)
+	withToken := func(secret string) context.Context {
+		return metadata.AppendToOutgoingContext(context.Background(), "authorization", "Bearer "+secret)
+	}
+
+	// Served over TLS with the certificate, to allowed clients that log in
+	client, stop := serve(Config{
+		AuthUser: "admin", AuthPass: "s3cr3t",
+		MultiUser: true, Teams: "alice=infra",
+		AllowIPs: "127.0.0.1",
+		TLSCert:  certFile, TLSKey: keyFile,
+	}, credentials.NewTLS(&tls.Config{InsecureSkipVerify: true}))
+	defer stop()
+
+	_, err = client.Lookup(context.Background(), &pb.LookupRequest{Name: "gh"})
+	assert.Equal(codes.Unauthenticated, code(err))
+	_, err = client.Resolve(context.Background(), &pb.ResolveRequest{Query: "gh golang"})
+	assert.Equal(codes.Unauthenticated, code(err))
+
+	link, err := client.Lookup(withToken(read), &pb.LookupRequest{Name: "gh"})
+	assert.NoError(err)
+	assert.Equal("https://github.com/%s", link.GetUrl())
+
+	// Tokens aren't members of any team
+	_, err = client.Lookup(withToken(read), &pb.LookupRequest{Name: "@infra/wiki"})
+	assert.Equal(codes.NotFound, code(err))
+	_, err = client.Resolve(withToken(read), &pb.ResolveRequest{Query: "infra/wiki oncall"})
+	assert.Equal(codes.NotFound, code(err))
+
+	for _, name := range []string{"infra/wiki", "@infra/wiki", "~wiki"} {
+		_, err = client.AddBookmark(withToken(write), &pb.AddBookmarkRequest{Name: name, Url: "https://evil.example.com/%s"})
+		assert.Equal(codes.PermissionDenied, code(err), name)
+	}
+	assert.False(db.Has([]byte("bookmark_infra/wiki")))
+
+	_, err = client.AddBookmark(withToken(write), &pb.AddBookmarkRequest{Name: "go", Url: "https://go.dev"})
+	assert.NoError(err)
+	assert.Equal("token:"+token.ID, BookmarkOwner("go"))
+
+	// Clients outside the allowed networks are kept out
+	client, stop = serve(Config{DenyIPs: "127.0.0.0/8"}, insecure.NewCredentials())
+	defer stop()
+
+	_, err = client.Lookup(context.Background(), &pb.LookupRequest{Name: "gh"})
+	assert.Equal(codes.PermissionDenied, code(err))
+}
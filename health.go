@@ -0,0 +1,137 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"log/slog"
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
+
+// InstanceHeader is the response header used to identify this instance
+const InstanceHeader = "X-Golinks-Instance"
+
+// NewInstanceID returns a new random instance id
+func NewInstanceID() string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return fmt.Sprintf("%x", time.Now().UnixNano())
+	}
+	return hex.EncodeToString(b)
+}
+
+// FQDNChecker periodically verifies that the configured FQDN resolves and
+// that requests to it are served by this instance. A common misconfiguration
+// is an FQDN (used in opensearch.xml) that points at the wrong host.
+type FQDNChecker struct {
+	sync.RWMutex
+
+	fqdn     string
+	scheme   string
+	instance string
+	counters *Counters
+
+	warning   string
+	lastCheck time.Time
+}
+
+// NewFQDNChecker returns a checker of the FQDN served with scheme (https
+// with -tls-cert, else http)
+func NewFQDNChecker(fqdn, scheme, instance string, counters *Counters) *FQDNChecker {
+	return &FQDNChecker{
+		fqdn:     fqdn,
+		scheme:   scheme,
+		instance: instance,
+		counters: counters,
+	}
+}
+
+// Warning returns the warning from the last check (if any)
+func (c *FQDNChecker) Warning() string {
+	c.RLock()
+	defer c.RUnlock()
+
+	return c.warning
+}
+
+// LastCheck returns the time of the last check
+func (c *FQDNChecker) LastCheck() time.Time {
+	c.RLock()
+	defer c.RUnlock()
+
+	return c.lastCheck
+}
+
+// Check resolves the FQDN and performs a request against it to verify that
+// it is served by this instance.
+func (c *FQDNChecker) Check() error {
+	err := c.check()
+
+	c.Lock()
+	defer c.Unlock()
+
+	c.lastCheck = time.Now()
+	if err != nil {
+		c.warning = err.Error()
+		c.counters.Inc("n_fqdn_check_failed")
+		c.counters.Gauge("fqdn_ok", 0)
+	} else {
+		c.warning = ""
+		c.counters.Gauge("fqdn_ok", 1)
+	}
+
+	return err
+}
+
+func (c *FQDNChecker) check() error {
+	host := c.fqdn
+	if h, _, err := net.SplitHostPort(c.fqdn); err == nil {
+		host = h
+	}
+
+	if _, err := net.LookupHost(host); err != nil {
+		return fmt.Errorf("FQDN %s does not resolve: %s", c.fqdn, err)
+	}
+
+	url := fmt.Sprintf("%s://%s/debug/instance", c.scheme, c.fqdn)
+	res, err := client.Get(url)
+	if err != nil {
+		return fmt.Errorf("FQDN %s is not reachable: %s", c.fqdn, err)
+	}
+	defer res.Body.Close()
+
+	instance := res.Header.Get(InstanceHeader)
+	if instance == "" {
+		body, _ := ioutil.ReadAll(res.Body)
+		instance = strings.TrimSpace(string(body))
+	}
+
+	if instance != c.instance {
+		return fmt.Errorf("FQDN %s does not point at this instance", c.fqdn)
+	}
+
+	return nil
+}
+
+// Run checks the FQDN shortly after startup and then every interval until
+// ctx is cancelled
+func (c *FQDNChecker) Run(ctx context.Context, interval time.Duration) {
+	delay := time.Second
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(delay):
+		}
+
+		if err := c.Check(); err != nil {
+			slog.Warn("FQDN check failed", "err", err)
+		}
+		delay = interval
+	}
+}
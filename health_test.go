@@ -0,0 +1,74 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFQDNChecker(t *testing.T) {
+	assert := assert.New(t)
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set(InstanceHeader, "foo")
+	}))
+	defer ts.Close()
+
+	fqdn := strings.TrimPrefix(ts.URL, "http://")
+
+	checker := NewFQDNChecker(fqdn, "http", "foo", NewCounters())
+	assert.NoError(checker.Check())
+	assert.Equal("", checker.Warning())
+	assert.False(checker.LastCheck().IsZero())
+
+	checker = NewFQDNChecker(fqdn, "http", "bar", NewCounters())
+	assert.Error(checker.Check())
+	assert.Contains(checker.Warning(), "does not point at this instance")
+}
+
+func TestFQDNCheckerTLS(t *testing.T) {
+	assert := assert.New(t)
+
+	ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set(InstanceHeader, "foo")
+	}))
+	defer ts.Close()
+
+	saved := client
+	client = ts.Client()
+	defer func() { client = saved }()
+
+	fqdn := strings.TrimPrefix(ts.URL, "https://")
+
+	checker := NewFQDNChecker(fqdn, "https", "foo", NewCounters())
+	assert.NoError(checker.Check())
+
+	checker = NewFQDNChecker(fqdn, "http", "foo", NewCounters())
+	assert.Error(checker.Check())
+}
+
+func TestFQDNCheckerUnreachable(t *testing.T) {
+	assert := assert.New(t)
+
+	checker := NewFQDNChecker("127.0.0.1:0", "http", "foo", NewCounters())
+	assert.Error(checker.Check())
+	assert.Contains(checker.Warning(), "not reachable")
+}
+
+func TestFQDNWarningBanner(t *testing.T) {
+	assert := assert.New(t)
+
+	s, err := NewServer(":8000", Config{FQDN: "127.0.0.1:0"})
+	assert.NoError(err)
+
+	s.fqdnChecker.Check()
+
+	w := httptest.NewRecorder()
+	s.render("index", w, httptest.NewRequest("GET", "/", nil), nil)
+
+	assert.Equal(w.Code, http.StatusOK)
+	assert.Contains(w.Body.String(), "toast-warning")
+}
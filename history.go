@@ -0,0 +1,299 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/prologic/bitcask"
+)
+
+const (
+	// DefaultHistoryPageSize is the number of history entries per page
+	DefaultHistoryPageSize = 50
+
+	// MaxHistoryPageSize is the maximum number of history entries per page
+	MaxHistoryPageSize = 500
+)
+
+// errStopScan stops a Scan early without it being an error
+var errStopScan = errors.New("stop scan")
+
+// HistoryEntry is a query made through golinks
+type HistoryEntry struct {
+	ID    string    `json:"id"`
+	Time  time.Time `json:"time"`
+	Query string    `json:"query"`
+	Name  string    `json:"name,omitempty"`
+	URL   string    `json:"url,omitempty"`
+	User  string    `json:"user,omitempty"`
+}
+
+// HistoryPage is a page of history entries, newest first. Next is the
+// cursor for the page of older entries (empty if there are none).
+type HistoryPage struct {
+	Entries []HistoryEntry `json:"entries"`
+	Next    string         `json:"next,omitempty"`
+}
+
+var (
+	historyMu     sync.Mutex
+	lastHistoryID int64
+)
+
+// newHistoryID returns a unique, increasing id based on the current time so
+// that history keys sort chronologically
+func newHistoryID(t time.Time) string {
+	historyMu.Lock()
+	defer historyMu.Unlock()
+
+	id := t.UnixNano()
+	if id <= lastHistoryID {
+		id = lastHistoryID + 1
+	}
+	lastHistoryID = id
+
+	return fmt.Sprintf("%020d", id)
+}
+
+func historyKey(id string) []byte {
+	return []byte(fmt.Sprintf("history_%s", id))
+}
+
+// AddHistory records a history entry
+func AddHistory(entry HistoryEntry) (HistoryEntry, error) {
+	if entry.Time.IsZero() {
+		entry.Time = time.Now()
+	}
+	entry.ID = newHistoryID(entry.Time)
+
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return entry, err
+	}
+
+	return entry, db.Put(historyKey(entry.ID), data)
+}
+
+// decodeHistoryEntry decodes a stored history entry. Entries that are not
+// JSON are treated as just the query.
+func decodeHistoryEntry(id string, val []byte) HistoryEntry {
+	var entry HistoryEntry
+	if err := json.Unmarshal(val, &entry); err != nil {
+		entry = HistoryEntry{Query: string(val)}
+	}
+	entry.ID = id
+	return entry
+}
+
+// GetHistoryEntry returns the history entry with the given id
+func GetHistoryEntry(id string) (HistoryEntry, error) {
+	val, err := db.Get(historyKey(id))
+	if err != nil {
+		return HistoryEntry{}, err
+	}
+	return decodeHistoryEntry(id, val), nil
+}
+
+// SaveSearch saves the url a history entry was redirected to (e.g: of
+// "gh prologic/golinks") as a bookmark called name, so a frequent query
+// becomes a one word shortcut. The query is kept as its description.
+func SaveSearch(entry HistoryEntry, name string) error {
+	if err := SaveBookmark(name, entry.URL); err != nil {
+		return err
+	}
+	return db.Put([]byte(fmt.Sprintf("description_%s", name)), []byte(entry.Query))
+}
+
+// SaveSearchHandler saves the url of a history entry as a bookmark from
+// the history page's form (id and name)
+func (s *Server) SaveSearchHandler() httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+		s.counters.Inc("n_history_save")
+
+		if s.config.ReadOnly {
+			http.Error(w, "Forbidden: instance is read-only", http.StatusForbidden)
+			return
+		}
+
+		entry, err := GetHistoryEntry(r.FormValue("id"))
+		if err == bitcask.ErrKeyNotFound {
+			http.Error(w, "Not Found: no such history entry", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			slog.Error("error reading history", "err", err)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+		if entry.URL == "" {
+			http.Error(w, fmt.Sprintf("Bad Request: %q did not redirect anywhere", entry.Query), http.StatusBadRequest)
+			return
+		}
+
+		name := strings.ToLower(strings.TrimSpace(r.FormValue("name")))
+		if err := ValidateBookmark(name, entry.URL); err != nil {
+			http.Error(w, "Bad Request: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		if _, ok := LookupBookmark(name); ok {
+			http.Error(w, fmt.Sprintf("Conflict: bookmark %s already exists", name), http.StatusConflict)
+			return
+		}
+
+		if err := SaveSearch(entry, name); err != nil {
+			slog.Error("error saving search", "name", name, "err", err)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+		if err := ClaimBookmark(name, RequestUser(r)); err != nil {
+			slog.Error("error saving bookmark owner", "name", name, "err", err)
+		}
+		auditBookmark(r, name, "", entry.URL)
+
+		http.Redirect(w, r, "/history?"+url.Values{"saved": {name}}.Encode(), http.StatusSeeOther)
+	}
+}
+
+// ListHistory returns up to limit history entries older than the cursor
+// before (or the newest entries if before is empty). Only the keys are
+// scanned; just the entries on the page are read and decoded.
+func ListHistory(before string, limit int) (page HistoryPage, err error) {
+	if limit <= 0 {
+		limit = DefaultHistoryPageSize
+	}
+
+	// Keys are scanned oldest first so keep a window of the newest
+	// limit+1 ids, the extra one tells whether there are older entries
+	var ids []string
+	err = db.Scan([]byte("history_"), func(key []byte) error {
+		id := strings.TrimPrefix(string(key), "history_")
+		if before != "" && id >= before {
+			return errStopScan
+		}
+		ids = append(ids, id)
+		if len(ids) > limit+1 {
+			ids = ids[1:]
+		}
+		return nil
+	})
+	if err != nil && err != errStopScan {
+		return
+	}
+	err = nil
+
+	if len(ids) > limit {
+		ids = ids[1:]
+		page.Next = ids[0]
+	}
+
+	for i := len(ids) - 1; i >= 0; i-- {
+		var val []byte
+		if val, err = db.Get(historyKey(ids[i])); err != nil {
+			return
+		}
+		page.Entries = append(page.Entries, decodeHistoryEntry(ids[i], val))
+	}
+
+	return
+}
+
+// recordHistory records a query unless running in read-only mode or with
+// history disabled. This is a best-effort write so failing to record never
+// fails the query itself.
+func (s *Server) recordHistory(user, query, name, url string) {
+	if s.config.ReadOnly || s.config.DisableHistory {
+		return
+	}
+
+	s.writePolicy.Do("history", func() error {
+		entry, err := AddHistory(HistoryEntry{Query: query, Name: name, URL: url, User: user})
+		if err != nil {
+			return err
+		}
+		s.publish(Event{
+			ID: entry.ID, Type: EventHistory, Time: entry.Time,
+			Name: entry.Name, URL: entry.URL, Query: entry.Query,
+		})
+		return nil
+	})
+}
+
+// HistoryHandler renders a page of the history, newest first, as HTML,
+// JSON or CSV (see negotiateFormat), e.g:
+// /history?before=<cursor>&limit=50&format=json
+func (s *Server) HistoryHandler() httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+		s.counters.Inc("n_history_view")
+
+		w.Header().Set("Vary", "Accept")
+		format, err := negotiateFormat(r)
+		if err != nil {
+			http.Error(w, "Bad Request: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		limit := DefaultHistoryPageSize
+		if v := r.URL.Query().Get("limit"); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n <= 0 {
+				http.Error(w, "Bad Request: invalid limit", http.StatusBadRequest)
+				return
+			}
+			limit = n
+		}
+		if limit > MaxHistoryPageSize {
+			limit = MaxHistoryPageSize
+		}
+
+		page, err := ListHistory(r.URL.Query().Get("before"), limit)
+		if err != nil {
+			slog.Error("error reading history", "err", err)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+
+		if page.Next != "" {
+			next := r.URL.Query()
+			next.Set("before", page.Next)
+			next.Set("limit", strconv.Itoa(limit))
+			w.Header().Set("Link", fmt.Sprintf(`</history?%s>; rel="next"`, next.Encode()))
+		}
+
+		switch format {
+		case FormatJSON:
+			if page.Entries == nil {
+				page.Entries = []HistoryEntry{}
+			}
+			WriteJSON(w, http.StatusOK, page)
+			return
+		case FormatCSV:
+			var rows [][]string
+			for _, entry := range page.Entries {
+				rows = append(rows, []string{
+					entry.ID, entry.Time.UTC().Format(time.RFC3339Nano),
+					entry.Query, entry.Name, entry.URL, entry.User,
+				})
+			}
+			writeCSV(w, []string{"id", "time", "query", "name", "url", "user"}, rows)
+			return
+		}
+
+		s.render("history", w, r, map[string]interface{}{
+			"Entries":  page.Entries,
+			"Next":     page.Next,
+			"Limit":    limit,
+			"Live":     r.URL.Query().Get("before") == "",
+			"Writable": !s.config.ReadOnly,
+			"Saved":    r.URL.Query().Get("saved"),
+		})
+	}
+}
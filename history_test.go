@@ -0,0 +1,257 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestListHistory(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir("", "golinks")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	db, err = OpenStore(filepath.Join(dir, "test.db"))
+	assert.NoError(err)
+	defer db.Close()
+
+	page, err := ListHistory("", 10)
+	assert.NoError(err)
+	assert.Empty(page.Entries)
+	assert.Empty(page.Next)
+
+	t0 := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	for _, q := range []string{"g foo", "gh golinks", "wp go", "g bar", "help"} {
+		_, err := AddHistory(HistoryEntry{Time: t0, Query: q})
+		assert.NoError(err)
+	}
+
+	queries := func(page HistoryPage) (qs []string) {
+		for _, entry := range page.Entries {
+			qs = append(qs, entry.Query)
+		}
+		return
+	}
+
+	page, err = ListHistory("", 2)
+	assert.NoError(err)
+	assert.Equal([]string{"help", "g bar"}, queries(page))
+	assert.NotEmpty(page.Next)
+	assert.Equal(t0, page.Entries[0].Time)
+
+	page, err = ListHistory(page.Next, 2)
+	assert.NoError(err)
+	assert.Equal([]string{"wp go", "gh golinks"}, queries(page))
+
+	page, err = ListHistory(page.Next, 2)
+	assert.NoError(err)
+	assert.Equal([]string{"g foo"}, queries(page))
+	assert.Empty(page.Next)
+
+	// Entries that aren't JSON are just queries
+	assert.NoError(db.Put(historyKey("00000000000000000001"), []byte("g legacy")))
+	page, err = ListHistory(page.Entries[0].ID, 10)
+	assert.NoError(err)
+	assert.Equal([]string{"g legacy"}, queries(page))
+}
+
+func TestHistoryHandler(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir("", "golinks")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	db, err = OpenStore(filepath.Join(dir, "test.db"))
+	assert.NoError(err)
+	defer db.Close()
+
+	assert.NoError(SaveBookmark("gh", "https://github.com/search?q=%s"))
+
+	s, err := NewServer(":8000", Config{URL: DefaultURL})
+	assert.NoError(err)
+
+	for _, path := range []string{"/?q=gh+golinks", "/?q=unknown", "/ping"} {
+		w := httptest.NewRecorder()
+		r, _ := http.NewRequest("GET", path, nil)
+		s.router.ServeHTTP(w, r)
+	}
+
+	page, err := ListHistory("", 10)
+	assert.NoError(err)
+	assert.Len(page.Entries, 3)
+	assert.Equal("ping", page.Entries[0].Query)
+	assert.Equal("unknown", page.Entries[1].Query)
+	assert.Equal("gh golinks", page.Entries[2].Query)
+	assert.Equal("gh", page.Entries[2].Name)
+	assert.Equal("https://github.com/search?q=golinks", page.Entries[2].URL)
+
+	w := httptest.NewRecorder()
+	r, _ := http.NewRequest("GET", "/history?limit=2", nil)
+	s.router.ServeHTTP(w, r)
+	assert.Equal(http.StatusOK, w.Code)
+	assert.Contains(w.Body.String(), "unknown")
+	assert.NotContains(w.Body.String(), "gh golinks")
+	assert.Contains(w.Body.String(), "/history?before=")
+
+	w = httptest.NewRecorder()
+	r, _ = http.NewRequest("GET", "/history?limit=foo", nil)
+	s.router.ServeHTTP(w, r)
+	assert.Equal(http.StatusBadRequest, w.Code)
+
+	// JSON and CSV for scripts
+	w = httptest.NewRecorder()
+	r, _ = http.NewRequest("GET", "/history?limit=2", nil)
+	r.Header.Set("Accept", "application/json")
+	s.router.ServeHTTP(w, r)
+	assert.Equal(http.StatusOK, w.Code)
+	assert.Equal("Accept", w.Header().Get("Vary"))
+	page = HistoryPage{}
+	assert.NoError(json.Unmarshal(w.Body.Bytes(), &page))
+	assert.Len(page.Entries, 2)
+	assert.Equal("ping", page.Entries[0].Query)
+	assert.Equal(
+		fmt.Sprintf(`</history?before=%s&limit=2>; rel="next"`, page.Next),
+		w.Header().Get("Link"),
+	)
+
+	w = httptest.NewRecorder()
+	r, _ = http.NewRequest("GET", "/history?format=csv&before="+page.Next, nil)
+	s.router.ServeHTTP(w, r)
+	assert.Equal(http.StatusOK, w.Code)
+	assert.Equal("text/csv; charset=utf-8", w.Header().Get("Content-Type"))
+	records, err := csv.NewReader(w.Body).ReadAll()
+	assert.NoError(err)
+	assert.Len(records, 2)
+	assert.Equal([]string{"id", "time", "query", "name", "url", "user"}, records[0])
+	assert.Equal([]string{"gh golinks", "gh", "https://github.com/search?q=golinks", ""}, records[1][2:])
+	assert.Empty(w.Header().Get("Link"))
+
+	w = httptest.NewRecorder()
+	r, _ = http.NewRequest("GET", "/history?format=xml", nil)
+	s.router.ServeHTTP(w, r)
+	assert.Equal(http.StatusBadRequest, w.Code)
+}
+
+func TestDisableHistory(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir("", "golinks")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	db, err = OpenStore(filepath.Join(dir, "test.db"))
+	assert.NoError(err)
+	defer db.Close()
+
+	assert.NoError(SaveBookmark("gh", "https://github.com/search?q=%s"))
+
+	s, err := NewServer(":8000", Config{URL: DefaultURL, DisableHistory: true})
+	assert.NoError(err)
+
+	w := httptest.NewRecorder()
+	r, _ := http.NewRequest("GET", "/?q=gh+golinks", nil)
+	s.router.ServeHTTP(w, r)
+	assert.Equal(http.StatusFound, w.Code)
+
+	page, err := ListHistory("", 10)
+	assert.NoError(err)
+	assert.Empty(page.Entries)
+
+	// /history is just a query
+	w = httptest.NewRecorder()
+	r, _ = http.NewRequest("GET", "/history", nil)
+	s.router.ServeHTTP(w, r)
+	assert.Equal(http.StatusFound, w.Code)
+
+	w = httptest.NewRecorder()
+	r, _ = http.NewRequest("GET", "/help", nil)
+	s.router.ServeHTTP(w, r)
+	assert.Equal(http.StatusOK, w.Code)
+	assert.NotContains(w.Body.String(), `href="/history"`)
+}
+
+func TestSaveSearch(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir("", "golinks")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	db, err = OpenStore(filepath.Join(dir, "test.db"))
+	assert.NoError(err)
+	defer db.Close()
+
+	assert.NoError(SaveBookmark("gh", "https://github.com/search?q=%s"))
+
+	s, err := NewServer(":8000", Config{URL: DefaultURL})
+	assert.NoError(err)
+
+	for _, path := range []string{"/?q=gh+prologic+golinks", "/ping"} {
+		r, _ := http.NewRequest("GET", path, nil)
+		s.router.ServeHTTP(httptest.NewRecorder(), r)
+	}
+	page, err := ListHistory("", 10)
+	assert.NoError(err)
+	ping, search := page.Entries[0], page.Entries[1]
+
+	save := func(s *Server, id, name string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r, _ := http.NewRequest("POST", "/history/save", strings.NewReader(url.Values{"id": {id}, "name": {name}}.Encode()))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		withCSRF(r)
+		s.router.ServeHTTP(w, r)
+		return w
+	}
+
+	// The history page offers to save entries that redirected somewhere
+	w := httptest.NewRecorder()
+	r, _ := http.NewRequest("GET", "/history", nil)
+	s.router.ServeHTTP(w, r)
+	assert.Contains(w.Body.String(), fmt.Sprintf(`name="id" value="%s"`, search.ID))
+	assert.NotContains(w.Body.String(), fmt.Sprintf(`name="id" value="%s"`, ping.ID))
+
+	w = save(s, search.ID, "Golinks")
+	assert.Equal(http.StatusSeeOther, w.Code)
+	assert.Equal("/history?saved=golinks", w.Header().Get("Location"))
+
+	bookmark, ok := LookupBookmark("golinks")
+	assert.True(ok)
+	assert.Equal("https://github.com/search?q=prologic golinks", bookmark.URL())
+	description, err := db.Get([]byte("description_golinks"))
+	assert.NoError(err)
+	assert.Equal("gh prologic golinks", string(description))
+
+	assert.Equal(http.StatusConflict, save(s, search.ID, "golinks").Code)
+	assert.Equal(http.StatusBadRequest, save(s, search.ID, "").Code)
+	assert.Equal(http.StatusBadRequest, save(s, search.ID, "ping").Code)
+	assert.Equal(http.StatusBadRequest, save(s, ping.ID, "p").Code)
+	assert.Equal(http.StatusNotFound, save(s, "nope", "p").Code)
+
+	w = httptest.NewRecorder()
+	r, _ = http.NewRequest("GET", "/history?saved=golinks", nil)
+	s.router.ServeHTTP(w, r)
+	assert.Contains(w.Body.String(), "Saved as <code>golinks</code>")
+
+	s, err = NewServer(":8000", Config{URL: DefaultURL, ReadOnly: true})
+	assert.NoError(err)
+	assert.Equal(http.StatusForbidden, save(s, search.ID, "gl").Code)
+
+	w = httptest.NewRecorder()
+	r, _ = http.NewRequest("GET", "/history", nil)
+	s.router.ServeHTTP(w, r)
+	assert.NotContains(w.Body.String(), "/history/save")
+}
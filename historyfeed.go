@@ -0,0 +1,84 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+
+	"github.com/julienschmidt/httprouter"
+	"golang.org/x/net/websocket"
+)
+
+// sameOrigin rejects WebSocket connections from pages of other origins, so
+// other sites can't follow the history through a visitor's browser
+func sameOrigin(config *websocket.Config, r *http.Request) error {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return nil
+	}
+	u, err := url.Parse(origin)
+	if err != nil || u.Host != r.Host {
+		return fmt.Errorf("cross origin connection from %q", origin)
+	}
+	config.Origin = u
+	return nil
+}
+
+// feedHistory sends the history entries among events to ws until either
+// the client or the broker is closed
+func (s *Server) feedHistory(ws *websocket.Conn, events chan Event) {
+	defer ws.Close()
+
+	// Clients never send anything, reading only detects closes
+	closed := make(chan struct{})
+	go func() {
+		defer close(closed)
+		var msg string
+		for websocket.Message.Receive(ws, &msg) == nil {
+		}
+	}()
+
+	for {
+		select {
+		case event := <-events:
+			if event.Type != EventHistory {
+				continue
+			}
+			entry := HistoryEntry{
+				ID: event.ID, Time: event.Time,
+				Query: event.Query, Name: event.Name, URL: event.URL,
+			}
+			if err := websocket.JSON.Send(ws, entry); err != nil {
+				return
+			}
+		case <-closed:
+			return
+		case <-s.broker.Done():
+			return
+		}
+	}
+}
+
+// HistoryFeedHandler pushes history entries to a WebSocket as they are
+// recorded, as JSON (like /history?format=json), so the history page
+// updates live. Nothing is read from the socket.
+func (s *Server) HistoryFeedHandler() httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+		// Subscribe before upgrading so no entry is missed once connected
+		events, err := s.broker.Subscribe()
+		if err != nil {
+			http.Error(w, "Service Unavailable: "+err.Error(), http.StatusServiceUnavailable)
+			return
+		}
+		defer s.broker.Unsubscribe(events)
+
+		s.counters.Inc("n_history_feeds")
+
+		websocket.Server{
+			Handshake: sameOrigin,
+			Handler: func(ws *websocket.Conn) {
+				s.feedHistory(ws, events)
+			},
+		}.ServeHTTP(w, r)
+	}
+}
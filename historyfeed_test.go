@@ -0,0 +1,67 @@
+package main
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/websocket"
+)
+
+func TestHistoryFeedHandler(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir("", "golinks")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	db, err = OpenStore(filepath.Join(dir, "test.db"))
+	assert.NoError(err)
+	defer db.Close()
+
+	assert.NoError(SaveBookmark("gh", "https://github.com/%s"))
+
+	s, err := NewServer(":8000", Config{})
+	assert.NoError(err)
+
+	ts := httptest.NewServer(s.server.Handler)
+	defer ts.Close()
+
+	feed := "ws" + strings.TrimPrefix(ts.URL, "http") + "/history/ws"
+
+	_, err = websocket.Dial(feed, "", "http://evil.example.com")
+	assert.Error(err)
+
+	ws, err := websocket.Dial(feed, "", ts.URL)
+	assert.NoError(err)
+	defer ws.Close()
+
+	// Only history entries are pushed
+	s.publish(Event{Type: EventBookmarkCreated, Name: "gh"})
+
+	r, _ := http.NewRequest("GET", "/?q=gh+golinks", nil)
+	s.router.ServeHTTP(httptest.NewRecorder(), r)
+
+	var entry HistoryEntry
+	assert.NoError(websocket.JSON.Receive(ws, &entry))
+	assert.NotEmpty(entry.ID)
+	assert.Equal("gh golinks", entry.Query)
+	assert.Equal("gh", entry.Name)
+	assert.Equal("https://github.com/golinks", entry.URL)
+
+	// The page only follows the history live on the first page
+	w := httptest.NewRecorder()
+	r, _ = http.NewRequest("GET", "/history", nil)
+	s.router.ServeHTTP(w, r)
+	assert.Contains(w.Body.String(), "/history/ws")
+
+	w = httptest.NewRecorder()
+	r, _ = http.NewRequest("GET", "/history?before="+entry.ID, nil)
+	s.router.ServeHTTP(w, r)
+	assert.NotContains(w.Body.String(), "/history/ws")
+}
@@ -0,0 +1,186 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+// DefaultHistoryTrashTTL is how long cleared history can be restored for
+const DefaultHistoryTrashTTL = 7 * 24 * time.Hour
+
+// TrashedHistoryEntry is a history entry that has been cleared
+type TrashedHistoryEntry struct {
+	Entry   HistoryEntry `json:"entry"`
+	Deleted time.Time    `json:"deleted"`
+}
+
+func trashedHistoryKey(id string) []byte {
+	return []byte("trash_history_" + id)
+}
+
+// ClearHistory moves all history entries to the trash, where they can be
+// restored from until they expire (see PurgeHistoryTrash). It returns the
+// number of entries cleared.
+func ClearHistory(now time.Time) (n int, err error) {
+	var ids []string
+	err = db.Scan([]byte("history_"), func(key []byte) error {
+		ids = append(ids, strings.TrimPrefix(string(key), "history_"))
+		return nil
+	})
+	if err != nil {
+		return
+	}
+
+	for _, id := range ids {
+		var val, data []byte
+		if val, err = db.Get(historyKey(id)); err != nil {
+			return
+		}
+		trashed := TrashedHistoryEntry{Entry: decodeHistoryEntry(id, val), Deleted: now}
+		if data, err = json.Marshal(trashed); err != nil {
+			return
+		}
+		// The entry is only deleted once it is safely in the trash
+		if err = db.Put(trashedHistoryKey(id), data); err != nil {
+			return
+		}
+		if err = db.Delete(historyKey(id)); err != nil {
+			return
+		}
+		n++
+	}
+	return
+}
+
+// scanHistoryTrash calls fn with every trashed entry, oldest first
+func scanHistoryTrash(fn func(key []byte, trashed TrashedHistoryEntry) error) error {
+	var keys [][]byte
+	err := db.Scan([]byte("trash_history_"), func(key []byte) error {
+		keys = append(keys, key)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, key := range keys {
+		val, err := db.Get(key)
+		if err != nil {
+			return err
+		}
+		var trashed TrashedHistoryEntry
+		if err := json.Unmarshal(val, &trashed); err != nil {
+			return err
+		}
+		if err := fn(key, trashed); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ListHistoryTrash returns the cleared history entries that have not expired
+// by now, oldest first
+func ListHistoryTrash(now time.Time, ttl time.Duration) ([]TrashedHistoryEntry, error) {
+	entries := []TrashedHistoryEntry{}
+	err := scanHistoryTrash(func(_ []byte, trashed TrashedHistoryEntry) error {
+		if now.Sub(trashed.Deleted) < ttl {
+			entries = append(entries, trashed)
+		}
+		return nil
+	})
+	return entries, err
+}
+
+// RestoreHistory moves the cleared history entries that have not expired by
+// now back into the history. It returns the number of entries restored.
+func RestoreHistory(now time.Time, ttl time.Duration) (n int, err error) {
+	err = scanHistoryTrash(func(key []byte, trashed TrashedHistoryEntry) error {
+		if now.Sub(trashed.Deleted) >= ttl {
+			return nil
+		}
+		data, err := json.Marshal(trashed.Entry)
+		if err != nil {
+			return err
+		}
+		if err := db.Put(historyKey(trashed.Entry.ID), data); err != nil {
+			return err
+		}
+		n++
+		return db.Delete(key)
+	})
+	return
+}
+
+// PurgeHistoryTrash permanently deletes the cleared history entries that
+// have been in the trash for longer than ttl. It returns the number of
+// entries deleted.
+func PurgeHistoryTrash(now time.Time, ttl time.Duration) (n int, err error) {
+	err = scanHistoryTrash(func(key []byte, trashed TrashedHistoryEntry) error {
+		if now.Sub(trashed.Deleted) < ttl {
+			return nil
+		}
+		n++
+		return db.Delete(key)
+	})
+	return
+}
+
+// ClearHistoryHandler moves the whole history to the trash
+func (s *Server) ClearHistoryHandler() httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+		s.counters.Inc("n_api_history_clear")
+
+		if !s.writable(w, r) {
+			return
+		}
+
+		n, err := ClearHistory(time.Now())
+		s.counters.IncBy("n_history_cleared", int64(n))
+		if err != nil {
+			WriteAPIError(w, r, http.StatusInternalServerError, ErrCodeInternal, "error clearing history", err.Error())
+			return
+		}
+		WriteJSON(w, http.StatusOK, map[string]interface{}{
+			"cleared": n,
+			"expires": time.Now().Add(s.config.HistoryTrashTTL),
+		})
+	}
+}
+
+// HistoryTrashHandler returns the cleared history that can be restored
+func (s *Server) HistoryTrashHandler() httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+		s.counters.Inc("n_api_history_trash")
+
+		entries, err := ListHistoryTrash(time.Now(), s.config.HistoryTrashTTL)
+		if err != nil {
+			WriteAPIError(w, r, http.StatusInternalServerError, ErrCodeInternal, "error reading history trash", err.Error())
+			return
+		}
+		WriteJSON(w, http.StatusOK, map[string]interface{}{"entries": entries})
+	}
+}
+
+// RestoreHistoryHandler moves the cleared history back from the trash
+func (s *Server) RestoreHistoryHandler() httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+		s.counters.Inc("n_api_history_restore")
+
+		if !s.writable(w, r) {
+			return
+		}
+
+		n, err := RestoreHistory(time.Now(), s.config.HistoryTrashTTL)
+		s.counters.IncBy("n_history_restored", int64(n))
+		if err != nil {
+			WriteAPIError(w, r, http.StatusInternalServerError, ErrCodeInternal, "error restoring history", err.Error())
+			return
+		}
+		WriteJSON(w, http.StatusOK, map[string]interface{}{"restored": n})
+	}
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHistoryTrash(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir("", "golinks")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	db, err = OpenStore(filepath.Join(dir, "test.db"))
+	assert.NoError(err)
+	defer db.Close()
+
+	for _, query := range []string{"gh golinks", "help"} {
+		_, err := AddHistory(HistoryEntry{Query: query})
+		assert.NoError(err)
+	}
+
+	now := time.Now()
+	n, err := ClearHistory(now)
+	assert.NoError(err)
+	assert.Equal(2, n)
+
+	page, err := ListHistory("", 10)
+	assert.NoError(err)
+	assert.Empty(page.Entries)
+
+	trash, err := ListHistoryTrash(now, time.Hour)
+	assert.NoError(err)
+	assert.Len(trash, 2)
+	assert.Equal("gh golinks", trash[0].Entry.Query)
+
+	// Expired entries can't be restored
+	trash, err = ListHistoryTrash(now.Add(time.Hour), time.Hour)
+	assert.NoError(err)
+	assert.Empty(trash)
+	n, err = RestoreHistory(now.Add(time.Hour), time.Hour)
+	assert.NoError(err)
+	assert.Equal(0, n)
+
+	n, err = RestoreHistory(now, time.Hour)
+	assert.NoError(err)
+	assert.Equal(2, n)
+
+	page, err = ListHistory("", 10)
+	assert.NoError(err)
+	assert.Len(page.Entries, 2)
+	assert.Equal("help", page.Entries[0].Query)
+
+	_, err = ClearHistory(now)
+	assert.NoError(err)
+	n, err = PurgeHistoryTrash(now.Add(30*time.Minute), time.Hour)
+	assert.NoError(err)
+	assert.Equal(0, n)
+	n, err = PurgeHistoryTrash(now.Add(time.Hour), time.Hour)
+	assert.NoError(err)
+	assert.Equal(2, n)
+	trash, err = ListHistoryTrash(now, time.Hour)
+	assert.NoError(err)
+	assert.Empty(trash)
+}
+
+func TestHistoryTrashAPI(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir("", "golinks")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	db, err = OpenStore(filepath.Join(dir, "test.db"))
+	assert.NoError(err)
+	defer db.Close()
+
+	_, err = AddHistory(HistoryEntry{Query: "gh golinks", Name: "gh", URL: "https://github.com/golinks"})
+	assert.NoError(err)
+
+	s, err := NewServer(":8000", Config{})
+	assert.NoError(err)
+
+	do := func(method, path, scope string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r, _ := http.NewRequest(method, path, nil)
+		authorize(r, scope)
+		s.router.ServeHTTP(w, r)
+		return w
+	}
+
+	w := do("DELETE", "/api/v1/history", ScopeRead)
+	assert.Equal(http.StatusForbidden, w.Code)
+
+	w = do("DELETE", "/api/v1/history", ScopeWrite)
+	assert.Equal(http.StatusOK, w.Code)
+	var cleared struct {
+		Cleared int       `json:"cleared"`
+		Expires time.Time `json:"expires"`
+	}
+	assert.NoError(json.Unmarshal(w.Body.Bytes(), &cleared))
+	assert.Equal(1, cleared.Cleared)
+	assert.WithinDuration(time.Now().Add(DefaultHistoryTrashTTL), cleared.Expires, time.Minute)
+
+	// Only admins can see and restore cleared history
+	w = do("GET", "/api/v1/history/trash", ScopeWrite)
+	assert.Equal(http.StatusForbidden, w.Code)
+	w = do("POST", "/api/v1/history/trash/restore", ScopeWrite)
+	assert.Equal(http.StatusForbidden, w.Code)
+
+	w = do("GET", "/api/v1/history/trash", ScopeAdmin)
+	assert.Equal(http.StatusOK, w.Code)
+	var trash struct {
+		Entries []TrashedHistoryEntry `json:"entries"`
+	}
+	assert.NoError(json.Unmarshal(w.Body.Bytes(), &trash))
+	assert.Len(trash.Entries, 1)
+	assert.Equal("https://github.com/golinks", trash.Entries[0].Entry.URL)
+
+	w = do("POST", "/api/v1/history/trash/restore", ScopeAdmin)
+	assert.Equal(http.StatusOK, w.Code)
+	assert.JSONEq(`{"restored": 1}`, w.Body.String())
+
+	page, err := ListHistory("", 10)
+	assert.NoError(err)
+	assert.Len(page.Entries, 1)
+	assert.Equal("gh", page.Entries[0].Name)
+}
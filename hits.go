@@ -0,0 +1,325 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/prologic/bitcask"
+)
+
+// Kinds of names hits are recorded for
+const (
+	HitBookmark = "bookmark"
+	HitCommand  = "command"
+	HitPeer     = "peer"
+)
+
+// HitOtherNames is the name label of the hits of the names beyond the top
+// names in the metrics
+const HitOtherNames = "__other__"
+
+// HitStats is how often a bookmark or command was used and how long it
+// took to resolve, persisted across restarts
+type HitStats struct {
+	Kind    string    `json:"kind"`
+	Name    string    `json:"name"`
+	Hits    int64     `json:"hits"`
+	LastHit time.Time `json:"last_hit,omitempty"`
+
+	// Latency is the total time spent resolving (and redirecting) the hits
+	Latency time.Duration `json:"-"`
+}
+
+// MeanLatency returns the mean time it took to resolve a hit
+func (h HitStats) MeanLatency() time.Duration {
+	if h.Hits == 0 {
+		return 0
+	}
+	return h.Latency / time.Duration(h.Hits)
+}
+
+// MarshalJSON adds the mean latency in milliseconds
+func (h HitStats) MarshalJSON() ([]byte, error) {
+	type plain HitStats
+	var lastHit *time.Time
+	if !h.LastHit.IsZero() {
+		lastHit = &h.LastHit
+	}
+	return json.Marshal(struct {
+		plain
+		LastHit       *time.Time `json:"last_hit,omitempty"`
+		MeanLatencyMS float64    `json:"mean_latency_ms"`
+	}{plain(h), lastHit, float64(h.MeanLatency()) / float64(time.Millisecond)})
+}
+
+func hitsKey(kind, name string) []byte {
+	return []byte(fmt.Sprintf("hits_%s_%s", kind, name))
+}
+
+// storedHits is how hit stats are persisted
+type storedHits struct {
+	Hits      int64     `json:"hits"`
+	LastHit   time.Time `json:"last_hit"`
+	LatencyNS int64     `json:"latency_ns"`
+}
+
+// GetHits returns the persisted hit stats of a bookmark or command (no
+// hits if it was never used)
+func GetHits(kind, name string) (HitStats, error) {
+	stats := HitStats{Kind: kind, Name: name}
+
+	data, err := db.Get(hitsKey(kind, name))
+	if err == bitcask.ErrKeyNotFound {
+		return stats, nil
+	}
+	if err != nil {
+		return stats, err
+	}
+	var stored storedHits
+	if err := json.Unmarshal(data, &stored); err != nil {
+		return stats, err
+	}
+	stats.Hits, stats.LastHit, stats.Latency = stored.Hits, stored.LastHit, time.Duration(stored.LatencyNS)
+	return stats, nil
+}
+
+// ListHits returns the persisted hit stats of all names of the kind (or
+// all kinds if empty), most used first
+func ListHits(kind string) ([]HitStats, error) {
+	prefix := "hits_"
+	if kind != "" {
+		prefix += kind + "_"
+	}
+
+	var all []HitStats
+	err := db.Scan([]byte(prefix), func(key []byte) error {
+		parts := strings.SplitN(strings.TrimPrefix(string(key), "hits_"), "_", 2)
+		if len(parts) != 2 {
+			return nil
+		}
+		stats, err := GetHits(parts[0], parts[1])
+		if err != nil {
+			return err
+		}
+		all = append(all, stats)
+		return nil
+	})
+	sortHits(all)
+	return all, err
+}
+
+func sortHits(all []HitStats) {
+	sort.Slice(all, func(i, j int) bool {
+		if all[i].Hits != all[j].Hits {
+			return all[i].Hits > all[j].Hits
+		}
+		if all[i].Kind != all[j].Kind {
+			return all[i].Kind < all[j].Kind
+		}
+		return all[i].Name < all[j].Name
+	})
+}
+
+type hitKey struct {
+	kind, name string
+}
+
+type hitMetric struct {
+	hits    uint64
+	seconds float64
+}
+
+// Hits counts the uses of each bookmark and command along with how long
+// they took to resolve: in memory since startup for metrics, and persisted
+// so usage survives restarts
+type Hits struct {
+	sync.Mutex
+
+	persist     bool
+	topN        int
+	writePolicy *WritePolicy
+	metrics     map[hitKey]*hitMetric
+}
+
+// NewHits returns hits whose metrics are labeled by the topN most used
+// names of each kind (all if 0, none if negative)
+func NewHits(persist bool, topN int, writePolicy *WritePolicy) *Hits {
+	return &Hits{
+		persist:     persist,
+		topN:        topN,
+		writePolicy: writePolicy,
+		metrics:     make(map[hitKey]*hitMetric),
+	}
+}
+
+// Record records a use of a bookmark or command that took d to resolve.
+// Persisting it is a best-effort write that never fails the use itself.
+func (h *Hits) Record(kind, name string, d time.Duration) {
+	h.Lock()
+	defer h.Unlock()
+
+	key := hitKey{kind, name}
+	m, ok := h.metrics[key]
+	if !ok {
+		m = &hitMetric{}
+		h.metrics[key] = m
+	}
+	m.hits++
+	m.seconds += d.Seconds()
+
+	if !h.persist {
+		return
+	}
+	h.writePolicy.Do("hits", func() error {
+		stats, err := GetHits(kind, name)
+		if err != nil {
+			return err
+		}
+		data, err := json.Marshal(storedHits{
+			Hits:      stats.Hits + 1,
+			LastHit:   time.Now().UTC(),
+			LatencyNS: int64(stats.Latency + d),
+		})
+		if err != nil {
+			return err
+		}
+		return db.Put(hitsKey(kind, name), data)
+	})
+}
+
+// writeMetrics writes the hits since startup and the time they took to
+// resolve, labeled by kind and name (see bounded)
+func (h *Hits) writeMetrics(w io.Writer) {
+	h.Lock()
+	metrics := h.bounded()
+	h.Unlock()
+
+	keys := make([]hitKey, 0, len(metrics))
+	for key := range metrics {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].kind != keys[j].kind {
+			return keys[i].kind < keys[j].kind
+		}
+		return keys[i].name < keys[j].name
+	})
+
+	labels := func(key hitKey) string {
+		if h.topN < 0 {
+			return fmt.Sprintf("kind=%q", key.kind)
+		}
+		return fmt.Sprintf("kind=%q,name=%s", key.kind, labelValue(key.name))
+	}
+
+	name := PrometheusNamespace + "_hits_total"
+	writeMetricHeader(w, name, "counter", "Number of uses of each bookmark and command.")
+	for _, key := range keys {
+		fmt.Fprintf(w, "%s{%s} %d\n", name, labels(key), metrics[key].hits)
+	}
+
+	name = PrometheusNamespace + "_hit_duration_seconds"
+	writeMetricHeader(w, name, "summary", "Time spent resolving each bookmark and command.")
+	for _, key := range keys {
+		m := metrics[key]
+		fmt.Fprintf(w, "%s_sum{%s} %s\n", name, labels(key), formatFloat(m.seconds))
+		fmt.Fprintf(w, "%s_count{%s} %d\n", name, labels(key), m.hits)
+	}
+}
+
+// bounded returns the hits to write metrics of, bounding the cardinality
+// of the name label: all names if topN is 0, none (just the kind) if
+// negative, or else the topN most used names of each kind with the rest
+// summed up as HitOtherNames
+func (h *Hits) bounded() map[hitKey]hitMetric {
+	metrics := make(map[hitKey]hitMetric, len(h.metrics))
+	if h.topN == 0 {
+		for key, m := range h.metrics {
+			metrics[key] = *m
+		}
+		return metrics
+	}
+
+	byKind := make(map[string][]hitKey)
+	for key := range h.metrics {
+		byKind[key.kind] = append(byKind[key.kind], key)
+	}
+	for kind, keys := range byKind {
+		sort.Slice(keys, func(i, j int) bool {
+			if h.metrics[keys[i]].hits != h.metrics[keys[j]].hits {
+				return h.metrics[keys[i]].hits > h.metrics[keys[j]].hits
+			}
+			return keys[i].name < keys[j].name
+		})
+		for i, key := range keys {
+			if h.topN > 0 && i < h.topN {
+				metrics[key] = *h.metrics[key]
+				continue
+			}
+			other := hitKey{kind, HitOtherNames}
+			m := metrics[other]
+			m.hits += h.metrics[key].hits
+			m.seconds += h.metrics[key].seconds
+			metrics[other] = m
+		}
+	}
+	return metrics
+}
+
+// HitsHandler returns the persisted hit stats, most used first, e.g:
+// /api/v1/hits?kind=bookmark. Bookmarks that were never used are included
+// (with no hits) so unused links can be found.
+func (s *Server) HitsHandler() httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+		s.counters.Inc("n_api_hits")
+
+		kind := r.URL.Query().Get("kind")
+		switch kind {
+		case "", HitBookmark, HitCommand, HitPeer:
+		default:
+			WriteAPIError(
+				w, r, http.StatusBadRequest, ErrCodeBadRequest,
+				fmt.Sprintf("invalid kind %q (expected bookmark, command or peer)", kind), nil,
+			)
+			return
+		}
+
+		all, err := ListHits(kind)
+		if err != nil {
+			WriteAPIError(w, r, http.StatusInternalServerError, ErrCodeInternal, "error reading hits", err.Error())
+			return
+		}
+
+		if kind == "" || kind == HitBookmark {
+			used := make(map[string]bool)
+			for _, stats := range all {
+				if stats.Kind == HitBookmark {
+					used[stats.Name] = true
+				}
+			}
+			bookmarks, err := ListBookmarks()
+			if err != nil {
+				WriteAPIError(w, r, http.StatusInternalServerError, ErrCodeInternal, "error reading bookmarks", err.Error())
+				return
+			}
+			for _, bookmark := range bookmarks {
+				if !used[bookmark.Name()] {
+					all = append(all, HitStats{Kind: HitBookmark, Name: bookmark.Name()})
+				}
+			}
+			sortHits(all)
+		}
+
+		if all == nil {
+			all = []HitStats{}
+		}
+		WriteJSON(w, http.StatusOK, map[string]interface{}{"hits": all})
+	}
+}
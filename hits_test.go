@@ -0,0 +1,170 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHits(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir("", "golinks")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	db, err = OpenStore(filepath.Join(dir, "test.db"))
+	assert.NoError(err)
+	defer db.Close()
+
+	hits := NewHits(true, 0, NewWritePolicy(0, 0, NewCounters()))
+	hits.Record(HitBookmark, "gh", 2*time.Millisecond)
+	hits.Record(HitBookmark, "gh", 4*time.Millisecond)
+	hits.Record(HitBookmark, "work/jira", time.Millisecond)
+	hits.Record(HitCommand, "ping", time.Millisecond)
+
+	stats, err := GetHits(HitBookmark, "gh")
+	assert.NoError(err)
+	assert.Equal(int64(2), stats.Hits)
+	assert.Equal(3*time.Millisecond, stats.MeanLatency())
+	assert.WithinDuration(time.Now(), stats.LastHit, time.Minute)
+
+	stats, err = GetHits(HitBookmark, "nope")
+	assert.NoError(err)
+	assert.Equal(HitStats{Kind: HitBookmark, Name: "nope"}, stats)
+
+	all, err := ListHits("")
+	assert.NoError(err)
+	assert.Len(all, 3)
+	assert.Equal("gh", all[0].Name)
+	assert.Equal(HitBookmark, all[1].Kind)
+	assert.Equal("work/jira", all[1].Name)
+	assert.Equal(HitCommand, all[2].Kind)
+
+	all, err = ListHits(HitCommand)
+	assert.NoError(err)
+	assert.Len(all, 1)
+
+	var buf bytes.Buffer
+	hits.writeMetrics(&buf)
+	assert.Contains(buf.String(), "golinks_hits_total{kind=\"bookmark\",name=\"gh\"} 2\n")
+	assert.Contains(buf.String(), "golinks_hit_duration_seconds_sum{kind=\"bookmark\",name=\"gh\"} 0.006\n")
+	assert.Contains(buf.String(), "golinks_hit_duration_seconds_count{kind=\"command\",name=\"ping\"} 1\n")
+
+	// Read-only instances only count hits in memory
+	hits = NewHits(false, 0, NewWritePolicy(0, 0, NewCounters()))
+	hits.Record(HitBookmark, "gh", time.Millisecond)
+	stats, err = GetHits(HitBookmark, "gh")
+	assert.NoError(err)
+	assert.Equal(int64(2), stats.Hits)
+}
+
+func TestHitsMetricsTopN(t *testing.T) {
+	assert := assert.New(t)
+
+	record := func(hits *Hits) string {
+		hits.Record(HitBookmark, "gh", time.Millisecond)
+		hits.Record(HitBookmark, "gh", time.Millisecond)
+		hits.Record(HitBookmark, "jira", time.Millisecond)
+		hits.Record(HitBookmark, "wiki", 2*time.Millisecond)
+		hits.Record(HitCommand, "ping", time.Millisecond)
+
+		var buf bytes.Buffer
+		hits.writeMetrics(&buf)
+		return buf.String()
+	}
+
+	// The most used names are labeled and the rest summed up
+	metrics := record(NewHits(false, 1, nil))
+	assert.Contains(metrics, "golinks_hits_total{kind=\"bookmark\",name=\"gh\"} 2\n")
+	assert.Contains(metrics, "golinks_hits_total{kind=\"bookmark\",name=\"__other__\"} 2\n")
+	assert.Contains(metrics, "golinks_hit_duration_seconds_sum{kind=\"bookmark\",name=\"__other__\"} 0.003\n")
+	assert.Contains(metrics, "golinks_hits_total{kind=\"command\",name=\"ping\"} 1\n")
+	assert.NotContains(metrics, "jira")
+
+	// Or names aren't labeled at all
+	metrics = record(NewHits(false, -1, nil))
+	assert.Contains(metrics, "golinks_hits_total{kind=\"bookmark\"} 4\n")
+	assert.Contains(metrics, "golinks_hit_duration_seconds_count{kind=\"command\"} 1\n")
+	assert.NotContains(metrics, "name=")
+}
+
+func TestHitsHandler(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir("", "golinks")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	db, err = OpenStore(filepath.Join(dir, "test.db"))
+	assert.NoError(err)
+	defer db.Close()
+
+	s, err := NewServer(":8000", Config{Title: "Search", DisableHistory: true})
+	assert.NoError(err)
+
+	assert.NoError(SaveBookmark("gh", "https://github.com/%s"))
+	assert.NoError(SaveBookmark("wiki", "https://en.wikipedia.org/wiki/%s"))
+
+	for _, q := range []string{"gh+golinks", "gh", "ping"} {
+		r, _ := http.NewRequest("GET", "/?q="+q, nil)
+		s.router.ServeHTTP(httptest.NewRecorder(), r)
+	}
+
+	list := func(query string) (int, []HitStats) {
+		w := httptest.NewRecorder()
+		r, _ := http.NewRequest("GET", "/api/v1/hits"+query, nil)
+		authorize(r, ScopeRead)
+		s.router.ServeHTTP(w, r)
+
+		var res struct {
+			Hits []HitStats `json:"hits"`
+		}
+		json.Unmarshal(w.Body.Bytes(), &res)
+		return w.Code, res.Hits
+	}
+
+	code, all := list("")
+	assert.Equal(http.StatusOK, code)
+	assert.Len(all, 3)
+	assert.Equal("gh", all[0].Name)
+	assert.Equal(int64(2), all[0].Hits)
+	assert.Equal(HitCommand, all[1].Kind)
+	assert.Equal("ping", all[1].Name)
+	assert.Equal(HitStats{Kind: HitBookmark, Name: "wiki"}, all[2])
+
+	code, all = list("?kind=command")
+	assert.Equal(http.StatusOK, code)
+	assert.Len(all, 1)
+
+	code, _ = list("?kind=nope")
+	assert.Equal(http.StatusBadRequest, code)
+
+	w := httptest.NewRecorder()
+	r, _ := http.NewRequest("GET", "/metrics", nil)
+	s.router.ServeHTTP(w, r)
+	assert.Contains(w.Body.String(), "golinks_hits_total{kind=\"bookmark\",name=\"gh\"} 2\n")
+}
+
+func TestHitStatsJSON(t *testing.T) {
+	assert := assert.New(t)
+
+	data, err := json.Marshal(HitStats{Kind: HitBookmark, Name: "gh"})
+	assert.NoError(err)
+	assert.JSONEq(`{"kind": "bookmark", "name": "gh", "hits": 0, "mean_latency_ms": 0}`, string(data))
+
+	data, err = json.Marshal(HitStats{
+		Kind: HitBookmark, Name: "gh", Hits: 4,
+		LastHit: time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC), Latency: 10 * time.Millisecond,
+	})
+	assert.NoError(err)
+	assert.JSONEq(`{"kind": "bookmark", "name": "gh", "hits": 4, "last_hit": "2024-01-02T03:04:05Z", "mean_latency_ms": 2.5}`, string(data))
+}
@@ -0,0 +1,574 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"io/ioutil"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+const (
+	// MaxSlugLength is the maximum length of a slug generated from a title
+	MaxSlugLength = 32
+
+	// MaxSlugSuffix is the highest numeric suffix tried to resolve conflicts
+	MaxSlugSuffix = 100
+
+	// MaxImportBytes is the maximum size of an uploaded bookmarks file
+	MaxImportBytes = 16 << 20
+
+	// ImportAdded ...
+	ImportAdded = "added"
+
+	// ImportExists ...
+	ImportExists = "exists"
+
+	// ImportSkipped ...
+	ImportSkipped = "skipped"
+
+	// ImportOverwritten ...
+	ImportOverwritten = "overwritten"
+
+	// ImportFailed ...
+	ImportFailed = "failed"
+)
+
+// ErrUnknownBookmarksFormat ...
+var ErrUnknownBookmarksFormat = errors.New("error: unknown bookmarks file format")
+
+var (
+	netscapeToken = regexp.MustCompile(`(?is)<h3[^>]*>(.*?)</h3>|<dl[^>]*>|</dl>|<a\s([^>]*)>(.*?)</a>`)
+	netscapeHref  = regexp.MustCompile(`(?is)\bhref\s*=\s*(?:"([^"]*)"|'([^']*)'|([^\s>]+))`)
+	netscapeTags  = regexp.MustCompile(`<[^>]*>`)
+	slugInvalid   = regexp.MustCompile(`[^a-z0-9]+`)
+)
+
+// ImportedBookmark is a bookmark parsed from a browser's bookmarks export.
+// The Prefix (if any) is prepended to the name generated from the title.
+type ImportedBookmark struct {
+	Title       string   `json:"title"`
+	URL         string   `json:"url"`
+	Folder      []string `json:"folder,omitempty"`
+	Prefix      string   `json:"prefix,omitempty"`
+	Tags        []string `json:"tags,omitempty"`
+	Description string   `json:"description,omitempty"`
+}
+
+// ImportResult is the outcome of importing a single bookmark
+type ImportResult struct {
+	Name   string `json:"name"`
+	Title  string `json:"title"`
+	URL    string `json:"url"`
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+
+	// old is the url of the bookmark before it was overwritten
+	old string
+}
+
+// ImportSummary ...
+type ImportSummary struct {
+	Added       int            `json:"added"`
+	Exists      int            `json:"exists"`
+	Skipped     int            `json:"skipped"`
+	Overwritten int            `json:"overwritten"`
+	Failed      int            `json:"failed"`
+	Results     []ImportResult `json:"results"`
+}
+
+func netscapeText(s string) string {
+	s = netscapeTags.ReplaceAllString(s, "")
+	return strings.TrimSpace(html.UnescapeString(s))
+}
+
+// ParseNetscapeBookmarks parses a bookmarks file in the Netscape bookmark
+// format as exported by Chrome, Firefox, Safari and others. Only http(s)
+// links are returned; bookmarklets, separators and feeds are ignored.
+func ParseNetscapeBookmarks(r io.Reader) ([]ImportedBookmark, error) {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		bookmarks []ImportedBookmark
+		folders   []string
+		heading   string
+		pending   bool
+	)
+
+	for _, m := range netscapeToken.FindAllStringSubmatch(string(data), -1) {
+		token := strings.ToLower(m[0])
+		switch {
+		case strings.HasPrefix(token, "<h3"):
+			heading = netscapeText(m[1])
+			pending = true
+		case strings.HasPrefix(token, "<dl"):
+			if pending {
+				folders = append(folders, heading)
+				pending = false
+			}
+		case token == "</dl>":
+			if len(folders) > 0 {
+				folders = folders[:len(folders)-1]
+			}
+		default:
+			href := netscapeHref.FindStringSubmatch(m[2])
+			if href == nil {
+				continue
+			}
+			link := html.UnescapeString(href[1] + href[2] + href[3])
+
+			u, err := url.Parse(link)
+			if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+				continue
+			}
+
+			bookmarks = append(bookmarks, ImportedBookmark{
+				Title:  netscapeText(m[3]),
+				URL:    link,
+				Folder: append([]string(nil), folders...),
+			})
+		}
+	}
+
+	return bookmarks, nil
+}
+
+// Slugify converts a bookmark title into a bookmark name, e.g:
+// "Go Documentation!" => go-documentation. If the title yields no usable
+// characters the host of the url is used instead.
+func Slugify(title, link string) string {
+	slug := strings.Trim(slugInvalid.ReplaceAllString(strings.ToLower(title), "-"), "-")
+	if slug == "" {
+		if u, err := url.Parse(link); err == nil {
+			host := strings.TrimPrefix(u.Hostname(), "www.")
+			slug = strings.Trim(slugInvalid.ReplaceAllString(strings.ToLower(host), "-"), "-")
+		}
+	}
+	if slug == "" {
+		slug = "bookmark"
+	}
+
+	if len(slug) > MaxSlugLength {
+		slug = strings.TrimRight(slug[:MaxSlugLength], "-")
+	}
+
+	return slug
+}
+
+// saveImportedBookmark saves the bookmark along with its tags and
+// description (if any)
+func saveImportedBookmark(name string, bookmark ImportedBookmark) error {
+	if err := SaveBookmark(name, bookmark.URL); err != nil {
+		return err
+	}
+
+	if len(bookmark.Tags) > 0 {
+		tags := append([]string(nil), bookmark.Tags...)
+		sort.Strings(tags)
+		key := []byte(fmt.Sprintf("tags_%s", name))
+		if err := db.Put(key, []byte(strings.Join(tags, ","))); err != nil {
+			return err
+		}
+	}
+
+	if bookmark.Description != "" {
+		key := []byte(fmt.Sprintf("description_%s", name))
+		if err := db.Put(key, []byte(bookmark.Description)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// ImportBookmarks inserts the given bookmarks into the store after applying
+// the rules to them (see ImportRules). Names are generated from the bookmark
+// titles; if a name is already taken by a different url a numeric suffix is
+// appended (go, go-2, go-3, ...), or the bookmark is skipped or overwritten
+// as the rules say. Links already bookmarked under the candidate name are
+// left alone.
+func ImportBookmarks(bookmarks []ImportedBookmark, rules ImportRules) (summary ImportSummary) {
+	if err := rules.compile(); err != nil {
+		slog.Warn("error compiling import rules (using the defaults)", "err", err)
+		rules = ImportRules{OnConflict: ConflictSuffix}
+	}
+
+	for _, bookmark := range bookmarks {
+		bookmark = rules.Apply(bookmark)
+		result := ImportResult{Title: bookmark.Title, URL: bookmark.URL}
+
+		slug := bookmark.Prefix + Slugify(bookmark.Title, bookmark.URL)
+		name := slug
+		for i := 2; ; i++ {
+			if i > MaxSlugSuffix {
+				result.Status = ImportFailed
+				result.Error = "no free name available"
+				break
+			}
+
+			existing, ok := LookupBookmark(name)
+			if !ok {
+				result.Status = ImportAdded
+				break
+			}
+			if existing.URL() == bookmark.URL {
+				result.Status = ImportExists
+				break
+			}
+			if rules.OnConflict == ConflictSkip {
+				result.Status = ImportSkipped
+				break
+			}
+			if rules.OnConflict == ConflictOverwrite {
+				result.Status, result.old = ImportOverwritten, existing.URL()
+				break
+			}
+			name = fmt.Sprintf("%s-%d", slug, i)
+		}
+		result.Name = name
+
+		if result.Status == ImportAdded || result.Status == ImportOverwritten {
+			if err := saveImportedBookmark(name, bookmark); err != nil {
+				result.Status = ImportFailed
+				result.Error = err.Error()
+			}
+		}
+
+		switch result.Status {
+		case ImportAdded:
+			summary.Added++
+		case ImportExists:
+			summary.Exists++
+		case ImportSkipped:
+			summary.Skipped++
+		case ImportOverwritten:
+			summary.Overwritten++
+		case ImportFailed:
+			summary.Failed++
+		}
+
+		summary.Results = append(summary.Results, result)
+	}
+
+	return
+}
+
+// chromeNode is a bookmark or folder in Chrome's Bookmarks JSON file
+type chromeNode struct {
+	Type     string       `json:"type"`
+	Name     string       `json:"name"`
+	URL      string       `json:"url"`
+	Children []chromeNode `json:"children"`
+}
+
+// chromeRoots are the top level folders of Chrome's Bookmarks JSON file in
+// the order shown by Chrome. They are not used as name prefixes.
+var chromeRoots = []string{"bookmark_bar", "other", "synced"}
+
+// ParseChromeBookmarks parses Chrome's (and other Chromium based browsers')
+// Bookmarks JSON file. The folder structure is preserved by prefixing the
+// bookmarks' names with their folders, e.g: Work > JIRA => work/jira
+func ParseChromeBookmarks(r io.Reader) ([]ImportedBookmark, error) {
+	var file struct {
+		Roots map[string]json.RawMessage `json:"roots"`
+	}
+	if err := json.NewDecoder(r).Decode(&file); err != nil {
+		return nil, err
+	}
+	if file.Roots == nil {
+		return nil, ErrUnknownBookmarksFormat
+	}
+
+	var (
+		bookmarks []ImportedBookmark
+		walk      func(node chromeNode, folders []string)
+	)
+
+	walk = func(node chromeNode, folders []string) {
+		switch node.Type {
+		case "url":
+			u, err := url.Parse(node.URL)
+			if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+				return
+			}
+
+			var prefix string
+			for _, folder := range folders {
+				prefix += Slugify(folder, "") + "/"
+			}
+
+			bookmarks = append(bookmarks, ImportedBookmark{
+				Title:  node.Name,
+				URL:    node.URL,
+				Folder: append([]string(nil), folders...),
+				Prefix: prefix,
+			})
+		case "folder":
+			for _, child := range node.Children {
+				walk(child, append(folders, node.Name))
+			}
+		}
+	}
+
+	for _, name := range chromeRoots {
+		data, ok := file.Roots[name]
+		if !ok {
+			continue
+		}
+
+		var root chromeNode
+		if err := json.Unmarshal(data, &root); err != nil {
+			return nil, err
+		}
+		for _, child := range root.Children {
+			walk(child, nil)
+		}
+	}
+
+	return bookmarks, nil
+}
+
+// pinboardPost is a bookmark in Pinboard's JSON export (or the output of
+// its posts/all API)
+type pinboardPost struct {
+	Href        string `json:"href"`
+	Description string `json:"description"`
+	Extended    string `json:"extended"`
+	Tags        string `json:"tags"`
+}
+
+// ParsePinboardBookmarks parses Pinboard's JSON export. Pinboard's
+// "description" is the bookmark's title and its "extended" description is
+// kept as the bookmark's description. Tags are lowercased and deduplicated.
+func ParsePinboardBookmarks(r io.Reader) ([]ImportedBookmark, error) {
+	var posts []pinboardPost
+	if err := json.NewDecoder(r).Decode(&posts); err != nil {
+		return nil, err
+	}
+
+	var bookmarks []ImportedBookmark
+	for _, post := range posts {
+		u, err := url.Parse(post.Href)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+			continue
+		}
+
+		bookmarks = append(bookmarks, ImportedBookmark{
+			Title:       post.Description,
+			URL:         post.Href,
+			Tags:        parseImportedTags(post.Tags),
+			Description: strings.TrimSpace(post.Extended),
+		})
+	}
+
+	return bookmarks, nil
+}
+
+// parseImportedTags splits tags separated by commas or spaces, lowercasing
+// and deduplicating them
+func parseImportedTags(s string) (tags []string) {
+	seen := make(map[string]bool)
+	for _, tag := range strings.FieldsFunc(s, func(r rune) bool {
+		return r == ',' || unicode.IsSpace(r)
+	}) {
+		tag = strings.ToLower(tag)
+		if !seen[tag] {
+			seen[tag] = true
+			tags = append(tags, tag)
+		}
+	}
+	return
+}
+
+// ParseCSVBookmarks parses bookmarks from a CSV file with a header row. The
+// url column is required; title (or name), folder (folders separated by /),
+// tags and description are optional and other columns are ignored, so e.g.
+// /list?format=csv of another instance can be imported as is.
+func ParseCSVBookmarks(r io.Reader) ([]ImportedBookmark, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	cr.TrimLeadingSpace = true
+
+	header, err := cr.Read()
+	if err != nil {
+		return nil, err
+	}
+	columns := make(map[string]int)
+	for i, column := range header {
+		columns[strings.ToLower(strings.TrimSpace(column))] = i
+	}
+	if _, ok := columns["url"]; !ok {
+		return nil, ErrUnknownBookmarksFormat
+	}
+	field := func(record []string, column string) string {
+		if i, ok := columns[column]; ok && i < len(record) {
+			return strings.TrimSpace(record[i])
+		}
+		return ""
+	}
+
+	var bookmarks []ImportedBookmark
+	for {
+		record, err := cr.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		link := field(record, "url")
+		u, err := url.Parse(link)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+			continue
+		}
+
+		title := field(record, "title")
+		if title == "" {
+			title = field(record, "name")
+		}
+
+		var folders []string
+		for _, folder := range strings.Split(field(record, "folder"), "/") {
+			if folder = strings.TrimSpace(folder); folder != "" {
+				folders = append(folders, folder)
+			}
+		}
+
+		bookmarks = append(bookmarks, ImportedBookmark{
+			Title:       title,
+			URL:         link,
+			Folder:      folders,
+			Tags:        parseImportedTags(field(record, "tags")),
+			Description: field(record, "description"),
+		})
+	}
+
+	return bookmarks, nil
+}
+
+// ParseBookmarks parses a bookmarks export in either the Netscape bookmark
+// HTML format, Chrome's Bookmarks JSON format, Pinboard's JSON format or CSV
+// (see ParseCSVBookmarks).
+func ParseBookmarks(r io.Reader) ([]ImportedBookmark, error) {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	trimmed := bytes.TrimSpace(data)
+	switch {
+	case bytes.HasPrefix(trimmed, []byte("{")):
+		return ParseChromeBookmarks(bytes.NewReader(data))
+	case bytes.HasPrefix(trimmed, []byte("[")):
+		return ParsePinboardBookmarks(bytes.NewReader(data))
+	case bytes.HasPrefix(trimmed, []byte("<")):
+		return ParseNetscapeBookmarks(bytes.NewReader(data))
+	case len(trimmed) > 0:
+		return ParseCSVBookmarks(bytes.NewReader(trimmed))
+	default:
+		return nil, ErrUnknownBookmarksFormat
+	}
+}
+
+// ImportBookmarksFile imports bookmarks from a Netscape bookmark HTML file,
+// a Chrome Bookmarks JSON file, a Pinboard JSON export or a CSV file
+func ImportBookmarksFile(filename string, rules ImportRules) (ImportSummary, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return ImportSummary{}, err
+	}
+	defer f.Close()
+
+	bookmarks, err := ParseBookmarks(f)
+	if err != nil {
+		return ImportSummary{}, err
+	}
+
+	return ImportBookmarks(bookmarks, rules), nil
+}
+
+// ImportHandler imports bookmarks from an uploaded Netscape bookmark HTML,
+// Chrome Bookmarks JSON, Pinboard JSON or CSV file, either as the request
+// body or as the multipart form field "file". Import rules (see ImportRules)
+// are given as JSON in the multipart form field or query parameter "rules".
+func (s *Server) ImportHandler() httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+		if s.config.ReadOnly {
+			WriteAPIError(
+				w, r, http.StatusForbidden, ErrCodeForbidden,
+				"instance is read-only", nil,
+			)
+			return
+		}
+
+		r.Body = http.MaxBytesReader(w, r.Body, MaxImportBytes)
+
+		body := io.Reader(r.Body)
+		rawRules := r.URL.Query().Get("rules")
+		if strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/form-data") {
+			f, _, err := r.FormFile("file")
+			if err != nil {
+				WriteAPIError(
+					w, r, http.StatusBadRequest, ErrCodeBadRequest,
+					"missing bookmarks file", err.Error(),
+				)
+				return
+			}
+			defer f.Close()
+			body = f
+			if v := r.FormValue("rules"); v != "" {
+				rawRules = v
+			}
+		}
+
+		rules, err := ParseImportRules(rawRules)
+		if err != nil {
+			WriteAPIError(
+				w, r, http.StatusBadRequest, ErrCodeBadRequest,
+				"invalid import rules", err.Error(),
+			)
+			return
+		}
+
+		bookmarks, err := ParseBookmarks(body)
+		if err != nil {
+			WriteAPIError(
+				w, r, http.StatusBadRequest, ErrCodeBadRequest,
+				"error reading bookmarks file", err.Error(),
+			)
+			return
+		}
+
+		summary := ImportBookmarks(bookmarks, rules)
+		s.counters.IncBy("n_import_added", int64(summary.Added))
+		for _, result := range summary.Results {
+			if result.Status == ImportAdded || result.Status == ImportOverwritten {
+				auditBookmark(r, result.Name, result.old, result.URL)
+			}
+		}
+		slog.Info(
+			"imported bookmarks",
+			"added", summary.Added, "existing", summary.Exists, "skipped", summary.Skipped,
+			"overwritten", summary.Overwritten, "failed", summary.Failed,
+		)
+
+		WriteJSON(w, http.StatusOK, summary)
+	}
+}
@@ -0,0 +1,326 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const testNetscapeBookmarks = `<!DOCTYPE NETSCAPE-Bookmark-file-1>
+<!-- This is an automatically generated file. -->
+<META HTTP-EQUIV="Content-Type" CONTENT="text/html; charset=UTF-8">
+<TITLE>Bookmarks</TITLE>
+<H1>Bookmarks</H1>
+<DL><p>
+    <DT><H3 ADD_DATE="1588000000" PERSONAL_TOOLBAR_FOLDER="true">Bookmarks bar</H3>
+    <DL><p>
+        <DT><A HREF="https://golang.org/doc/" ADD_DATE="1588000000">Go Documentation</A>
+        <DT><H3>Work &amp; Stuff</H3>
+        <DL><p>
+            <DT><A HREF="https://github.com/prologic/golinks?tab=readme&amp;x=1">GitHub</A>
+            <DT><A HREF="javascript:alert(1)">Bookmarklet</A>
+        </DL><p>
+    </DL><p>
+    <DT><A HREF="https://www.example.com/">&#9733;</A>
+</DL><p>
+`
+
+func TestParseNetscapeBookmarks(t *testing.T) {
+	assert := assert.New(t)
+
+	bookmarks, err := ParseNetscapeBookmarks(strings.NewReader(testNetscapeBookmarks))
+	assert.NoError(err)
+	assert.Equal([]ImportedBookmark{
+		{
+			Title:  "Go Documentation",
+			URL:    "https://golang.org/doc/",
+			Folder: []string{"Bookmarks bar"},
+		},
+		{
+			Title:  "GitHub",
+			URL:    "https://github.com/prologic/golinks?tab=readme&x=1",
+			Folder: []string{"Bookmarks bar", "Work & Stuff"},
+		},
+		{
+			Title: "★",
+			URL:   "https://www.example.com/",
+		},
+	}, bookmarks)
+}
+
+func TestSlugify(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.Equal("go-documentation", Slugify("Go Documentation!", ""))
+	assert.Equal("c-reference", Slugify("  C++ -- Reference  ", ""))
+	assert.Equal("example-com", Slugify("★", "https://www.example.com/"))
+	assert.Equal("bookmark", Slugify("", "https://"))
+	assert.Equal(
+		"a-very-long-title-that-goes-on-a",
+		Slugify("A very long title that goes on and on and on", ""),
+	)
+}
+
+func TestImportBookmarks(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir("", "golinks")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	db, err = OpenStore(filepath.Join(dir, "test.db"))
+	assert.NoError(err)
+	defer db.Close()
+
+	assert.NoError(SaveBookmark("github", "https://github.com"))
+	assert.NoError(SaveBookmark("go", "https://golang.org/"))
+
+	summary := ImportBookmarks([]ImportedBookmark{
+		{Title: "GitHub", URL: "https://github.com/prologic/golinks"},
+		{Title: "GitHub", URL: "https://github.com/prologic"},
+		{Title: "GitHub", URL: "https://github.com/prologic/golinks"},
+		{Title: "Go", URL: "https://golang.org/"},
+	}, ImportRules{})
+
+	assert.Equal(2, summary.Added)
+	assert.Equal(2, summary.Exists)
+	assert.Equal(0, summary.Failed)
+
+	assert.Equal("github-2", summary.Results[0].Name)
+	assert.Equal(ImportAdded, summary.Results[0].Status)
+	assert.Equal("github-3", summary.Results[1].Name)
+	assert.Equal(ImportAdded, summary.Results[1].Status)
+	assert.Equal("github-2", summary.Results[2].Name)
+	assert.Equal(ImportExists, summary.Results[2].Status)
+	assert.Equal("go", summary.Results[3].Name)
+	assert.Equal(ImportExists, summary.Results[3].Status)
+
+	bookmark, ok := LookupBookmark("github-3")
+	assert.True(ok)
+	assert.Equal("https://github.com/prologic", bookmark.URL())
+}
+
+func TestImportHandler(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir("", "golinks")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	db, err = OpenStore(filepath.Join(dir, "test.db"))
+	assert.NoError(err)
+	defer db.Close()
+
+	s, err := NewServer(":8000", Config{})
+	assert.NoError(err)
+
+	body := &bytes.Buffer{}
+	mw := multipart.NewWriter(body)
+	fw, err := mw.CreateFormFile("file", "bookmarks.html")
+	assert.NoError(err)
+	fw.Write([]byte(testNetscapeBookmarks))
+	assert.NoError(mw.Close())
+
+	w := httptest.NewRecorder()
+	r, _ := http.NewRequest("POST", "/api/v1/import", body)
+	authorize(r, ScopeWrite)
+	r.Header.Set("Content-Type", mw.FormDataContentType())
+	s.router.ServeHTTP(w, r)
+	assert.Equal(http.StatusOK, w.Code)
+
+	var summary ImportSummary
+	assert.NoError(json.Unmarshal(w.Body.Bytes(), &summary))
+	assert.Equal(3, summary.Added)
+
+	_, ok := LookupBookmark("go-documentation")
+	assert.True(ok)
+
+	w = httptest.NewRecorder()
+	r, _ = http.NewRequest("POST", "/api/v1/import", strings.NewReader(testNetscapeBookmarks))
+	authorize(r, ScopeWrite)
+	r.Header.Set("Content-Type", "text/html")
+	s.router.ServeHTTP(w, r)
+	assert.Equal(http.StatusOK, w.Code)
+
+	summary = ImportSummary{}
+	assert.NoError(json.Unmarshal(w.Body.Bytes(), &summary))
+	assert.Equal(0, summary.Added)
+	assert.Equal(3, summary.Exists)
+}
+
+const testChromeBookmarks = `{
+   "checksum": "a1b2c3",
+   "roots": {
+      "bookmark_bar": {
+         "children": [ {
+            "name": "Go Documentation",
+            "type": "url",
+            "url": "https://golang.org/doc/"
+         }, {
+            "children": [ {
+               "name": "JIRA",
+               "type": "url",
+               "url": "https://jira.example.com/"
+            }, {
+               "children": [ {
+                  "name": "Build Status",
+                  "type": "url",
+                  "url": "https://ci.example.com/"
+               } ],
+               "name": "CI & CD",
+               "type": "folder"
+            } ],
+            "name": "Work",
+            "type": "folder"
+         } ],
+         "name": "Bookmarks bar",
+         "type": "folder"
+      },
+      "other": {
+         "children": [ {
+            "name": "Bookmarklet",
+            "type": "url",
+            "url": "javascript:alert(1)"
+         } ],
+         "name": "Other bookmarks",
+         "type": "folder"
+      },
+      "synced": {
+         "children": [ ],
+         "name": "Mobile bookmarks",
+         "type": "folder"
+      }
+   },
+   "version": 1
+}
+`
+
+func TestParseChromeBookmarks(t *testing.T) {
+	assert := assert.New(t)
+
+	bookmarks, err := ParseBookmarks(strings.NewReader(testChromeBookmarks))
+	assert.NoError(err)
+	assert.Equal([]ImportedBookmark{
+		{
+			Title: "Go Documentation",
+			URL:   "https://golang.org/doc/",
+		},
+		{
+			Title:  "JIRA",
+			URL:    "https://jira.example.com/",
+			Folder: []string{"Work"},
+			Prefix: "work/",
+		},
+		{
+			Title:  "Build Status",
+			URL:    "https://ci.example.com/",
+			Folder: []string{"Work", "CI & CD"},
+			Prefix: "work/ci-cd/",
+		},
+	}, bookmarks)
+
+	_, err = ParseBookmarks(strings.NewReader(`{"foo": "bar"}`))
+	assert.Equal(ErrUnknownBookmarksFormat, err)
+
+	_, err = ParseBookmarks(strings.NewReader(`foo`))
+	assert.Equal(ErrUnknownBookmarksFormat, err)
+
+	bookmarks, err = ParseBookmarks(strings.NewReader(testNetscapeBookmarks))
+	assert.NoError(err)
+	assert.Len(bookmarks, 3)
+}
+
+func TestImportChromeBookmarks(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir("", "golinks")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	db, err = OpenStore(filepath.Join(dir, "test.db"))
+	assert.NoError(err)
+	defer db.Close()
+
+	filename := filepath.Join(dir, "Bookmarks")
+	assert.NoError(ioutil.WriteFile(filename, []byte(testChromeBookmarks), 0644))
+
+	summary, err := ImportBookmarksFile(filename, ImportRules{})
+	assert.NoError(err)
+	assert.Equal(3, summary.Added)
+	assert.Equal("work/jira", summary.Results[1].Name)
+	assert.Equal("work/ci-cd/build-status", summary.Results[2].Name)
+
+	s, err := NewServer(":8000", Config{})
+	assert.NoError(err)
+
+	w := httptest.NewRecorder()
+	r, _ := http.NewRequest("GET", "/work/jira", nil)
+	s.router.ServeHTTP(w, r)
+	assert.Equal(http.StatusFound, w.Code)
+	assert.Equal("https://jira.example.com/", w.Header().Get("Location"))
+
+	w = httptest.NewRecorder()
+	r, _ = http.NewRequest("GET", "/?q=work/ci-cd/build-status", nil)
+	s.router.ServeHTTP(w, r)
+	assert.Equal(http.StatusFound, w.Code)
+	assert.Equal("https://ci.example.com/", w.Header().Get("Location"))
+}
+
+const testPinboardBookmarks = `[
+  {"href": "https://golang.org/doc/", "description": "Go Documentation", "extended": " The Go docs ", "tags": "go Docs go", "shared": "no", "toread": "no"},
+  {"href": "https://example.com/", "description": "", "extended": "", "tags": ""},
+  {"href": "javascript:alert(1)", "description": "Bookmarklet", "extended": "", "tags": "js"}
+]`
+
+func TestImportPinboardBookmarks(t *testing.T) {
+	assert := assert.New(t)
+
+	bookmarks, err := ParseBookmarks(strings.NewReader(testPinboardBookmarks))
+	assert.NoError(err)
+	assert.Equal([]ImportedBookmark{
+		{
+			Title:       "Go Documentation",
+			URL:         "https://golang.org/doc/",
+			Tags:        []string{"go", "docs"},
+			Description: "The Go docs",
+		},
+		{
+			URL: "https://example.com/",
+		},
+	}, bookmarks)
+
+	dir, err := ioutil.TempDir("", "golinks")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	db, err = OpenStore(filepath.Join(dir, "test.db"))
+	assert.NoError(err)
+	defer db.Close()
+
+	summary := ImportBookmarks(bookmarks, ImportRules{})
+	assert.Equal(2, summary.Added)
+
+	bookmark, ok := LookupBookmark("example-com")
+	assert.True(ok)
+	assert.Equal("https://example.com/", bookmark.URL())
+
+	tags, err := db.Get([]byte("tags_go-documentation"))
+	assert.NoError(err)
+	assert.Equal("docs,go", string(tags))
+
+	description, err := db.Get([]byte("description_go-documentation"))
+	assert.NoError(err)
+	assert.Equal("The Go docs", string(description))
+
+	assert.False(db.Has([]byte("tags_example-com")))
+	assert.False(db.Has([]byte("description_example-com")))
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+const (
+	// MaxTitleTransforms is the maximum number of title transforms of an
+	// import
+	MaxTitleTransforms = 32
+
+	// ConflictSuffix appends a numeric suffix to names already taken by a
+	// different url (go, go-2, go-3, ...)
+	ConflictSuffix = "suffix"
+
+	// ConflictSkip skips bookmarks whose name is already taken by a
+	// different url
+	ConflictSkip = "skip"
+
+	// ConflictOverwrite replaces the url of bookmarks whose name is already
+	// taken by a different url
+	ConflictOverwrite = "overwrite"
+)
+
+// TitleTransform replaces matches of a regular expression in the titles of
+// imported bookmarks (before names are derived from them), e.g:
+// {"pattern": " - Google Docs$", "replace": ""}. Replace may refer to
+// submatches as $1, ${name}, ...
+type TitleTransform struct {
+	Pattern string `json:"pattern"`
+	Replace string `json:"replace"`
+
+	re *regexp.Regexp
+}
+
+// ImportRules map imported bookmarks before they are saved, so large imports
+// don't need cleaning up afterwards. Folders maps folder names (case
+// insensitive) to tags, a folder mapped to "" is not tagged; with FolderTags
+// every other folder becomes a tag too. Titles are transformed in order.
+// OnConflict is what to do with names already taken by a different url:
+// suffix (the default), skip or overwrite.
+type ImportRules struct {
+	FolderTags bool              `json:"folder_tags,omitempty"`
+	Folders    map[string]string `json:"folders,omitempty"`
+	Titles     []TitleTransform  `json:"titles,omitempty"`
+	OnConflict string            `json:"on_conflict,omitempty"`
+}
+
+// ParseImportRules parses and validates import rules encoded as JSON. An
+// empty string yields the default rules.
+func ParseImportRules(s string) (rules ImportRules, err error) {
+	if strings.TrimSpace(s) != "" {
+		dec := json.NewDecoder(strings.NewReader(s))
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(&rules); err != nil {
+			return ImportRules{}, fmt.Errorf("invalid import rules: %s", err)
+		}
+	}
+	if err := rules.compile(); err != nil {
+		return ImportRules{}, err
+	}
+	return rules, nil
+}
+
+// compile validates the rules and compiles the title transforms
+func (rules *ImportRules) compile() error {
+	switch rules.OnConflict {
+	case "":
+		rules.OnConflict = ConflictSuffix
+	case ConflictSuffix, ConflictSkip, ConflictOverwrite:
+	default:
+		return fmt.Errorf(
+			"invalid on_conflict %q (expected %s, %s or %s)",
+			rules.OnConflict, ConflictSuffix, ConflictSkip, ConflictOverwrite,
+		)
+	}
+
+	if len(rules.Titles) > MaxTitleTransforms {
+		return fmt.Errorf("too many title transforms (at most %d)", MaxTitleTransforms)
+	}
+	for i := range rules.Titles {
+		re, err := regexp.Compile(rules.Titles[i].Pattern)
+		if err != nil {
+			return fmt.Errorf("invalid title pattern %q: %s", rules.Titles[i].Pattern, err)
+		}
+		rules.Titles[i].re = re
+	}
+
+	folders := make(map[string]string, len(rules.Folders))
+	for folder, tag := range rules.Folders {
+		folders[strings.ToLower(strings.TrimSpace(folder))] = strings.ToLower(strings.TrimSpace(tag))
+	}
+	rules.Folders = folders
+
+	return nil
+}
+
+// Apply returns the bookmark with its title transformed and its folders
+// mapped to tags
+func (rules ImportRules) Apply(bookmark ImportedBookmark) ImportedBookmark {
+	for _, transform := range rules.Titles {
+		if transform.re == nil {
+			continue
+		}
+		bookmark.Title = strings.TrimSpace(transform.re.ReplaceAllString(bookmark.Title, transform.Replace))
+	}
+
+	tags := append([]string(nil), bookmark.Tags...)
+	for _, folder := range bookmark.Folder {
+		tag, ok := rules.Folders[strings.ToLower(strings.TrimSpace(folder))]
+		if !ok && rules.FolderTags {
+			tag = strings.Trim(slugInvalid.ReplaceAllString(strings.ToLower(folder), "-"), "-")
+		}
+		if tag != "" {
+			tags = append(tags, tag)
+		}
+	}
+	if len(tags) > len(bookmark.Tags) {
+		sort.Strings(tags)
+		bookmark.Tags = nil
+		for i, tag := range tags {
+			if i == 0 || tag != tags[i-1] {
+				bookmark.Tags = append(bookmark.Tags, tag)
+			}
+		}
+	}
+
+	return bookmark
+}
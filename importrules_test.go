@@ -0,0 +1,155 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseImportRules(t *testing.T) {
+	assert := assert.New(t)
+
+	rules, err := ParseImportRules("")
+	assert.NoError(err)
+	assert.Equal(ConflictSuffix, rules.OnConflict)
+
+	rules, err = ParseImportRules(`{"folders": {"Work & Stuff": "Work"}, "on_conflict": "skip"}`)
+	assert.NoError(err)
+	assert.Equal(map[string]string{"work & stuff": "work"}, rules.Folders)
+	assert.Equal(ConflictSkip, rules.OnConflict)
+
+	_, err = ParseImportRules(`{"on_conflict": "merge"}`)
+	assert.Error(err)
+	_, err = ParseImportRules(`{"titles": [{"pattern": "("}]}`)
+	assert.Error(err)
+	_, err = ParseImportRules(`{"folder": {}}`)
+	assert.Error(err)
+}
+
+func TestImportRulesApply(t *testing.T) {
+	assert := assert.New(t)
+
+	rules, err := ParseImportRules(`{
+		"folder_tags": true,
+		"folders": {"Bookmarks bar": "", "Work & Stuff": "work"},
+		"titles": [{"pattern": " - Google Docs$", "replace": ""}, {"pattern": "^(\\w+) Runbook", "replace": "runbook $1"}]
+	}`)
+	assert.NoError(err)
+
+	bookmark := rules.Apply(ImportedBookmark{
+		Title:  "Deploys Runbook - Google Docs",
+		URL:    "https://docs.google.com/document/d/1",
+		Folder: []string{"Bookmarks bar", "Work & Stuff", "On Call"},
+		Tags:   []string{"work"},
+	})
+	assert.Equal("runbook Deploys", bookmark.Title)
+	assert.Equal([]string{"on-call", "work"}, bookmark.Tags)
+}
+
+func TestParseCSVBookmarks(t *testing.T) {
+	assert := assert.New(t)
+
+	bookmarks, err := ParseBookmarks(strings.NewReader(
+		"Title,URL,Folder,Tags,Description\n" +
+			"Go Documentation,https://golang.org/doc/,Dev / Go,\"go, docs\",The docs\n" +
+			"Bookmarklet,javascript:alert(1),,,\n",
+	))
+	assert.NoError(err)
+	assert.Equal([]ImportedBookmark{{
+		Title:       "Go Documentation",
+		URL:         "https://golang.org/doc/",
+		Folder:      []string{"Dev", "Go"},
+		Tags:        []string{"go", "docs"},
+		Description: "The docs",
+	}}, bookmarks)
+
+	// e.g: /list?format=csv of another instance
+	bookmarks, err = ParseCSVBookmarks(strings.NewReader("type,name,url,signature\nbookmark,gh,https://github.com,\n"))
+	assert.NoError(err)
+	assert.Equal([]ImportedBookmark{{Title: "gh", URL: "https://github.com"}}, bookmarks)
+
+	_, err = ParseBookmarks(strings.NewReader("title,link\nfoo,https://example.com\n"))
+	assert.Equal(ErrUnknownBookmarksFormat, err)
+}
+
+func TestImportBookmarksConflicts(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir("", "golinks")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	db, err = OpenStore(filepath.Join(dir, "test.db"))
+	assert.NoError(err)
+	defer db.Close()
+
+	assert.NoError(SaveBookmark("github", "https://github.com"))
+
+	bookmarks := []ImportedBookmark{
+		{Title: "GitHub", URL: "https://github.com/prologic"},
+		{Title: "GitHub", URL: "https://github.com"},
+	}
+
+	summary := ImportBookmarks(bookmarks, ImportRules{OnConflict: ConflictSkip})
+	assert.Equal(1, summary.Skipped)
+	assert.Equal(1, summary.Exists)
+	assert.Equal(ImportSkipped, summary.Results[0].Status)
+	assert.False(db.Has([]byte("bookmark_github-2")))
+
+	summary = ImportBookmarks(bookmarks[:1], ImportRules{OnConflict: ConflictOverwrite, FolderTags: true})
+	assert.Equal(1, summary.Overwritten)
+	assert.Equal("github", summary.Results[0].Name)
+	bookmark, ok := LookupBookmark("github")
+	assert.True(ok)
+	assert.Equal("https://github.com/prologic", bookmark.URL())
+}
+
+func TestImportHandlerRules(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir("", "golinks")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	db, err = OpenStore(filepath.Join(dir, "test.db"))
+	assert.NoError(err)
+	defer db.Close()
+
+	s, err := NewServer(":8000", Config{})
+	assert.NoError(err)
+
+	post := func(rules string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r, _ := http.NewRequest(
+			"POST", "/api/v1/import?rules="+url.QueryEscape(rules),
+			strings.NewReader(testNetscapeBookmarks),
+		)
+		authorize(r, ScopeWrite)
+		r.Header.Set("Content-Type", "text/html")
+		s.router.ServeHTTP(w, r)
+		return w
+	}
+
+	w := post(`{"on_conflict": "merge"}`)
+	assert.Equal(http.StatusBadRequest, w.Code)
+
+	w = post(`{"folders": {"Work & Stuff": "work"}, "titles": [{"pattern": "^Go ", "replace": "Golang "}]}`)
+	assert.Equal(http.StatusOK, w.Code)
+
+	var summary ImportSummary
+	assert.NoError(json.Unmarshal(w.Body.Bytes(), &summary))
+	assert.Equal(3, summary.Added)
+	assert.Equal("golang-documentation", summary.Results[0].Name)
+
+	tags, err := db.Get([]byte("tags_github"))
+	assert.NoError(err)
+	assert.Equal("work", string(tags))
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// IPFilterExemptPaths are served to any address: the instance id the FQDN
+// check fetches (which is random and reveals nothing)
+var IPFilterExemptPaths = []string{"/debug/instance"}
+
+// ParseNetworks parses a comma separated list of ips and CIDRs
+func ParseNetworks(s string) ([]*net.IPNet, error) {
+	var networks []*net.IPNet
+	for _, network := range strings.Split(s, ",") {
+		network = strings.TrimSpace(network)
+		if network == "" {
+			continue
+		}
+		if !strings.Contains(network, "/") {
+			ip := net.ParseIP(network)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid address %q (expected an ip or CIDR)", network)
+			}
+			bits := 8 * net.IPv6len
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 8*net.IPv4len
+			}
+			networks = append(networks, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, ipnet, err := net.ParseCIDR(network)
+		if err != nil {
+			return nil, fmt.Errorf("invalid address %q (expected an ip or CIDR)", network)
+		}
+		networks = append(networks, ipnet)
+	}
+	return networks, nil
+}
+
+// containsIP reports whether ip is in one of networks
+func containsIP(networks []*net.IPNet, ip net.IP) bool {
+	if ip == nil {
+		return false
+	}
+	for _, network := range networks {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// peerIP returns the ip of the address connecting to golinks (the client or
+// a proxy), or nil if it isn't one
+func peerIP(r *http.Request) net.IP {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	return net.ParseIP(host)
+}
+
+// IPFilter only lets clients from some networks in (e.g. a home network
+// and a VPN) and keeps others out, so golinks can be exposed on the
+// internet without being open to it
+type IPFilter struct {
+	allow    []*net.IPNet
+	deny     []*net.IPNet
+	proxies  []*net.IPNet
+	counters *Counters
+}
+
+// NewIPFilter returns an IPFilter letting in clients from allow (or any if
+// empty) unless they are in deny. Behind proxies (e.g. a load balancer)
+// the client is taken from the X-Forwarded-For they set.
+func NewIPFilter(allow, deny, proxies []*net.IPNet, counters *Counters) *IPFilter {
+	return &IPFilter{
+		allow:    allow,
+		deny:     deny,
+		proxies:  proxies,
+		counters: counters,
+	}
+}
+
+// ClientIP returns the ip of the client of a request. X-Forwarded-For is
+// only trusted from the proxies, which append who connected to them, so the
+// client is the last address in it that isn't one of the proxies.
+func (f *IPFilter) ClientIP(r *http.Request) net.IP {
+	ip := peerIP(r)
+	if !containsIP(f.proxies, ip) {
+		return ip
+	}
+
+	hops := strings.Split(strings.Join(r.Header.Values("X-Forwarded-For"), ","), ",")
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop := net.ParseIP(strings.TrimSpace(hops[i]))
+		if hop == nil {
+			break
+		}
+		ip = hop
+		if !containsIP(f.proxies, ip) {
+			break
+		}
+	}
+	return ip
+}
+
+// Allowed reports whether clients with the ip are let in: denied networks
+// win over allowed ones
+func (f *IPFilter) Allowed(ip net.IP) bool {
+	if ip == nil || containsIP(f.deny, ip) {
+		return false
+	}
+	return len(f.allow) == 0 || containsIP(f.allow, ip)
+}
+
+// Handler only serves requests to next from allowed clients (see Allowed)
+// and answers everyone else with a 403
+func (f *IPFilter) Handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for _, path := range IPFilterExemptPaths {
+			if r.URL.Path == path {
+				next.ServeHTTP(w, r)
+				return
+			}
+		}
+
+		if !f.Allowed(f.ClientIP(r)) {
+			f.counters.Inc("n_ip_denied")
+			if strings.HasPrefix(r.URL.Path, "/api/") {
+				WriteAPIError(w, r, http.StatusForbidden, ErrCodeForbidden, "address not allowed", nil)
+			} else {
+				http.Error(w, "Forbidden: your address is not allowed", http.StatusForbidden)
+			}
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/rcrowley/go-metrics"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIPFilter(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir("", "golinks")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	db, err = OpenStore(filepath.Join(dir, "test.db"))
+	assert.NoError(err)
+	defer db.Close()
+
+	assert.NoError(SaveBookmark("gh", "https://github.com/%s"))
+
+	s, err := NewServer(":8000", Config{
+		AllowIPs:  "192.168.0.0/16, 2001:db8::/32",
+		DenyIPs:   "192.168.66.6",
+		IPProxies: "10.0.0.0/8",
+	})
+	assert.NoError(err)
+
+	do := func(path, remoteAddr, xff string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r, _ := http.NewRequest("GET", path, nil)
+		r.RemoteAddr = remoteAddr
+		if xff != "" {
+			r.Header.Set("X-Forwarded-For", xff)
+		}
+		s.server.Handler.ServeHTTP(w, r)
+		return w
+	}
+
+	assert.Equal(http.StatusFound, do("/?q=gh+prologic", "192.168.1.2:1234", "").Code)
+	assert.Equal(http.StatusFound, do("/?q=gh+prologic", "[2001:db8::1]:1234", "").Code)
+	assert.Equal(http.StatusForbidden, do("/?q=gh+prologic", "203.0.113.1:1234", "").Code)
+
+	// Denied addresses win over allowed ones
+	assert.Equal(http.StatusForbidden, do("/?q=gh+prologic", "192.168.66.6:1234", "").Code)
+
+	w := do("/api/v1/bookmarks", "203.0.113.1:1234", "")
+	assert.Equal(http.StatusForbidden, w.Code)
+	assert.Contains(w.Body.String(), `"code":"forbidden"`)
+
+	// X-Forwarded-For is only trusted from the proxies, from the right
+	assert.Equal(http.StatusFound, do("/?q=gh+prologic", "10.0.0.2:1234", "192.168.1.2").Code)
+	assert.Equal(http.StatusFound, do("/?q=gh+prologic", "10.0.0.2:1234", "203.0.113.1, 192.168.1.2, 10.0.0.3").Code)
+	assert.Equal(http.StatusForbidden, do("/?q=gh+prologic", "10.0.0.2:1234", "192.168.1.2, 203.0.113.1").Code)
+	assert.Equal(http.StatusForbidden, do("/?q=gh+prologic", "203.0.113.1:1234", "192.168.1.2").Code)
+	assert.Equal(http.StatusForbidden, do("/?q=gh+prologic", "10.0.0.2:1234", "").Code)
+
+	// The instance id is left open for the FQDN check
+	assert.Equal(http.StatusOK, do("/debug/instance", "203.0.113.1:1234", "").Code)
+
+	counter, ok := s.counters.r.Get("n_ip_denied").(metrics.Counter)
+	assert.True(ok)
+	assert.Equal(int64(6), counter.Count())
+
+	_, err = NewServer(":8000", Config{AllowIPs: "home"})
+	assert.Error(err)
+	_, err = NewServer(":8000", Config{IPProxies: "10.0.0.0/8"})
+	assert.Error(err)
+	_, err = NewServer(":8000", Config{IPProxies: "10.0.0.0/8", RateLimit: 60})
+	assert.NoError(err)
+}
+
+func TestIPFilterClientIP(t *testing.T) {
+	assert := assert.New(t)
+
+	proxies, err := ParseNetworks("10.0.0.0/8")
+	assert.NoError(err)
+	f := NewIPFilter(nil, nil, proxies, NewCounters())
+
+	r, _ := http.NewRequest("GET", "/", nil)
+	r.RemoteAddr = "10.0.0.2:1234"
+	r.Header.Add("X-Forwarded-For", "198.51.100.1, 203.0.113.1")
+	r.Header.Add("X-Forwarded-For", "10.0.0.3")
+	assert.Equal(net.ParseIP("203.0.113.1"), f.ClientIP(r))
+
+	// Only proxies all the way: the first of them
+	r.Header.Set("X-Forwarded-For", "10.0.0.4, 10.0.0.3")
+	assert.Equal(net.ParseIP("10.0.0.4"), f.ClientIP(r))
+
+	// Garbage stops at the last address that could be trusted
+	r.Header.Set("X-Forwarded-For", "bogus, 10.0.0.3")
+	assert.Equal(net.ParseIP("10.0.0.3"), f.ClientIP(r))
+
+	assert.True(f.Allowed(net.ParseIP("203.0.113.1")))
+	assert.False(f.Allowed(nil))
+}
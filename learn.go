@@ -0,0 +1,303 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prologic/bitcask"
+)
+
+// MinLearnedAliasLength is the shortest name learned as an alias, shorter
+// names are one typo away from too many others
+const MinLearnedAliasLength = 3
+
+// typoDistance returns the number of single character insertions,
+// deletions, substitutions and transpositions of adjacent characters
+// between a and b (the optimal string alignment distance)
+func typoDistance(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	d := make([][]int, len(ra)+1)
+	for i := range d {
+		d[i] = make([]int, len(rb)+1)
+		d[i][0] = i
+	}
+	for j := range d[0] {
+		d[0][j] = j
+	}
+
+	for i := 1; i <= len(ra); i++ {
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			d[i][j] = min(d[i-1][j]+1, d[i][j-1]+1, d[i-1][j-1]+cost)
+			if i > 1 && j > 1 && ra[i-1] == rb[j-2] && ra[i-2] == rb[j-1] {
+				d[i][j] = min(d[i][j], d[i-2][j-2]+1)
+			}
+		}
+	}
+	return d[len(ra)][len(rb)]
+}
+
+// BookmarkNames caches the names of the bookmarks by length, the
+// candidates misspellings are compared with, so misses don't scan the
+// store. It is reloaded after bookmarks are created or deleted.
+type BookmarkNames struct {
+	sync.Mutex
+
+	byLength map[int][]string
+}
+
+// NewBookmarkNames ...
+func NewBookmarkNames() *BookmarkNames {
+	return &BookmarkNames{}
+}
+
+// Invalidate reloads the names on the next lookup
+func (n *BookmarkNames) Invalidate() {
+	n.Lock()
+	defer n.Unlock()
+
+	n.byLength = nil
+}
+
+func (n *BookmarkNames) load() error {
+	byLength := make(map[int][]string)
+	err := db.Scan([]byte("bookmark_"), func(key []byte) error {
+		name := strings.TrimPrefix(string(key), "bookmark_")
+		m := len([]rune(name))
+		byLength[m] = append(byLength[m], name)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	n.byLength = byLength
+	return nil
+}
+
+// Closest returns the only bookmark one typo away from name (e.g: gihtub
+// for github), if there is exactly one
+func (n *BookmarkNames) Closest(name string) (string, bool) {
+	n.Lock()
+	defer n.Unlock()
+
+	if n.byLength == nil {
+		if err := n.load(); err != nil {
+			slog.Error("error loading bookmark names", "err", err)
+			return "", false
+		}
+	}
+
+	name = strings.ToLower(name)
+	l := len([]rune(name))
+
+	// Names differing in length by more than one are more than one typo
+	// apart, so only those of about the same length are compared
+	var matches []string
+	for m := l - 1; m <= l+1; m++ {
+		for _, candidate := range n.byLength[m] {
+			if typoDistance(name, candidate) == 1 {
+				matches = append(matches, candidate)
+			}
+		}
+	}
+	if len(matches) != 1 {
+		return "", false
+	}
+	return matches[0], true
+}
+
+// learnedPrefix is the prefix of the tallies and aliases learned from the
+// misspellings of a user (in multi-user mode), or "" for global ones
+func learnedPrefix(user string) string {
+	if user == "" {
+		return ""
+	}
+	return "user/" + url.QueryEscape(user) + "/"
+}
+
+// typoKeysKey marks the typo tallies as keyed by the current hash key
+var typoKeysKey = []byte("meta_typo_keys")
+
+// typoKey is the key of the tally of a misspelling of a user (or "").
+// Misspellings are what users typed, so they are hashed (see keyHash) as
+// values may be encrypted.
+func typoKey(user, name string) []byte {
+	return []byte(learnedPrefix(user) + "typo_" + keyHash(name))
+}
+
+// EnsureTypoKeys drops the tallies of misspellings keyed differently (e.g:
+// in plaintext, or before values were encrypted), which only restarts them
+func EnsureTypoKeys() error {
+	marker := []byte(keyHash(string(typoKeysKey)))
+	if val, err := db.Get(typoKeysKey); err == nil && string(val) == string(marker) {
+		return nil
+	}
+
+	var stale [][]byte
+	err := db.Scan([]byte("typo_"), func(key []byte) error {
+		stale = append(stale, append([]byte{}, key...))
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	err = db.Scan([]byte("user/"), func(key []byte) error {
+		if strings.Contains(string(key), "/typo_") {
+			stale = append(stale, append([]byte{}, key...))
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	for _, key := range stale {
+		if err := db.Delete(key); err != nil {
+			return err
+		}
+	}
+
+	return db.Put(typoKeysKey, marker)
+}
+
+// typoTally is how often a misspelling of a bookmark was typed
+type typoTally struct {
+	Bookmark string    `json:"bookmark"`
+	Count    int       `json:"count"`
+	LastSeen time.Time `json:"last_seen"`
+}
+
+// MaxLearnedNotices is how many notices of learned aliases are kept for a
+// user until they are shown
+const MaxLearnedNotices = 10
+
+// AliasLearner learns the misspellings of bookmarks users keep typing: a
+// name that isn't a command or bookmark but is one typo away from a single
+// bookmark is tallied each time it falls back to the default url, and
+// once typed threshold times it becomes an alias of the bookmark. In
+// multi-user mode misspellings are tallied per user and become personal
+// aliases, only of the user who typed them.
+type AliasLearner struct {
+	sync.Mutex
+
+	threshold   int
+	names       *BookmarkNames
+	notices     map[string][]string
+	writePolicy *WritePolicy
+	counters    *Counters
+	publish     func(Event)
+}
+
+// NewAliasLearner ...
+func NewAliasLearner(threshold int, writePolicy *WritePolicy, counters *Counters, publish func(Event)) *AliasLearner {
+	return &AliasLearner{
+		threshold:   threshold,
+		names:       NewBookmarkNames(),
+		notices:     make(map[string][]string),
+		writePolicy: writePolicy,
+		counters:    counters,
+		publish:     publish,
+	}
+}
+
+// Changed reloads the candidates once bookmarks are created or deleted
+func (l *AliasLearner) Changed(event Event) {
+	if event.Type == EventBookmarkCreated || event.Type == EventBookmarkDeleted {
+		l.names.Invalidate()
+	}
+}
+
+// Notices returns (and forgets) the notices of the aliases learned for a
+// user (or "") since they were last shown
+func (l *AliasLearner) Notices(user string) []string {
+	l.Lock()
+	defer l.Unlock()
+
+	notices := l.notices[user]
+	delete(l.notices, user)
+	return notices
+}
+
+// Miss records that name fell back to the default url, learning it as an
+// alias once it is a frequent misspelling. Misses are the user's in
+// multi-user mode, where those of anonymous users aren't learned. This is
+// a best-effort write that never fails the query itself.
+func (l *AliasLearner) Miss(ns *Namespaces, name string) {
+	var user string
+	if ns != nil {
+		if ns.User == "" {
+			return
+		}
+		user = ns.User
+	}
+
+	name = strings.ToLower(name)
+	if len([]rune(name)) < MinLearnedAliasLength {
+		return
+	}
+	bookmark, ok := l.names.Closest(name)
+	if !ok {
+		return
+	}
+
+	l.Lock()
+	defer l.Unlock()
+
+	l.writePolicy.Do("typos", func() error {
+		var tally typoTally
+		data, err := db.Get(typoKey(user, name))
+		if err != nil && err != bitcask.ErrKeyNotFound {
+			return err
+		}
+		if err == nil {
+			if err := json.Unmarshal(data, &tally); err != nil {
+				return err
+			}
+		}
+		// Count again if the closest bookmark changed
+		if tally.Bookmark != bookmark {
+			tally = typoTally{Bookmark: bookmark}
+		}
+		tally.Count++
+		tally.LastSeen = time.Now().UTC()
+
+		if tally.Count < l.threshold {
+			data, err := json.Marshal(tally)
+			if err != nil {
+				return err
+			}
+			return db.Put(typoKey(user, name), data)
+		}
+
+		alias := learnedPrefix(user) + "alias_" + name
+		if err := db.Put([]byte(alias), []byte(bookmark)); err != nil {
+			return err
+		}
+		if err := db.Delete(typoKey(user, name)); err != nil {
+			return err
+		}
+
+		l.counters.Inc("n_aliases_learned")
+		slog.Info("learned alias", "alias", name, "name", bookmark, "user", user, "count", tally.Count)
+		notice := fmt.Sprintf("%s now goes to %s", name, bookmark)
+		if user != "" {
+			notice += fmt.Sprintf(" (delete ~%s to undo)", name)
+		}
+		if notices := l.notices[user]; len(notices) < MaxLearnedNotices {
+			l.notices[user] = append(notices, notice)
+		}
+		target, _ := LookupBookmark(bookmark)
+		l.publish(Event{
+			Type: EventAliasLearned, Time: time.Now(),
+			Name: bookmark, URL: target.URL(), Query: name, User: user,
+		})
+		return nil
+	})
+}
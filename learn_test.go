@@ -0,0 +1,238 @@
+package main
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTypoDistance(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.Equal(0, typoDistance("github", "github"))
+	assert.Equal(1, typoDistance("gihtub", "github"))
+	assert.Equal(1, typoDistance("githb", "github"))
+	assert.Equal(1, typoDistance("githubb", "github"))
+	assert.Equal(1, typoDistance("gitxub", "github"))
+	assert.Equal(2, typoDistance("gthb", "github"))
+	assert.Equal(3, typoDistance("", "abc"))
+}
+
+func TestClosestBookmark(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir("", "golinks")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	db, err = OpenStore(filepath.Join(dir, "test.db"))
+	assert.NoError(err)
+	defer db.Close()
+
+	assert.NoError(db.Put([]byte("bookmark_github"), []byte("https://github.com")))
+	assert.NoError(db.Put([]byte("bookmark_jira"), []byte("https://jira.example.com")))
+	assert.NoError(db.Put([]byte("bookmark_jora"), []byte("https://jora.example.com")))
+
+	names := NewBookmarkNames()
+	name, ok := names.Closest("Gihtub")
+	assert.True(ok)
+	assert.Equal("github", name)
+
+	// Ambiguous or too far from any bookmark
+	_, ok = names.Closest("jara")
+	assert.False(ok)
+	_, ok = names.Closest("golang")
+	assert.False(ok)
+
+	// Names are cached until invalidated
+	assert.NoError(db.Put([]byte("bookmark_golan"), []byte("https://golang.org")))
+	_, ok = names.Closest("golang")
+	assert.False(ok)
+	names.Invalidate()
+	name, ok = names.Closest("golang")
+	assert.True(ok)
+	assert.Equal("golan", name)
+}
+
+func TestAliasLearner(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir("", "golinks")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	db, err = OpenStore(filepath.Join(dir, "test.db"))
+	assert.NoError(err)
+	defer db.Close()
+
+	assert.NoError(db.Put([]byte("bookmark_github"), []byte("https://github.com/%s")))
+
+	var events []Event
+	counters := NewCounters()
+	learner := NewAliasLearner(3, NewWritePolicy(0, 0, counters), counters, func(e Event) {
+		events = append(events, e)
+	})
+
+	// Misses of anonymous users in multi-user mode aren't learned
+	for i := 0; i < 3; i++ {
+		learner.Miss(&Namespaces{}, "gihtub")
+	}
+	assert.False(db.Has(typoKey("", "gihtub")))
+
+	learner.Miss(nil, "gh")
+	learner.Miss(nil, "gihtub")
+	learner.Miss(nil, "gihtub")
+	_, ok := LookupBookmark("gihtub")
+	assert.False(ok)
+	assert.Empty(events)
+	assert.True(db.Has(typoKey("", "gihtub")))
+	assert.False(db.Has([]byte("typo_gihtub")))
+
+	learner.Miss(nil, "GIHTUB")
+	bookmark, ok := LookupBookmark("gihtub")
+	assert.True(ok)
+	assert.Equal("github", bookmark.Name())
+	assert.False(db.Has(typoKey("", "gihtub")))
+	assert.False(db.Has(typoKey("", "gh")))
+
+	if assert.Len(events, 1) {
+		assert.Equal(EventAliasLearned, events[0].Type)
+		assert.Equal("github", events[0].Name)
+		assert.Equal("https://github.com/%s", events[0].URL)
+		assert.Equal("gihtub", events[0].Query)
+		assert.Equal("", events[0].User)
+	}
+	assert.Equal([]string{"gihtub now goes to github"}, learner.Notices(""))
+	assert.Empty(learner.Notices(""))
+
+	// Tallies keyed in plaintext are dropped
+	assert.NoError(db.Put([]byte("typo_githbu"), []byte(`{"bookmark":"github","count":2}`)))
+	assert.NoError(db.Put([]byte("user/alice/typo_githbu"), []byte(`{"bookmark":"github","count":2}`)))
+	learner.Miss(nil, "githbu")
+	assert.NoError(EnsureTypoKeys())
+	assert.False(db.Has([]byte("typo_githbu")))
+	assert.False(db.Has([]byte("user/alice/typo_githbu")))
+	assert.False(db.Has(typoKey("", "githbu")))
+	learner.Miss(nil, "githbu")
+	assert.True(db.Has(typoKey("", "githbu")))
+	assert.NoError(EnsureTypoKeys())
+	assert.True(db.Has(typoKey("", "githbu")))
+}
+
+func TestLearnAliases(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir("", "golinks")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	db, err = OpenStore(filepath.Join(dir, "test.db"))
+	assert.NoError(err)
+	defer db.Close()
+
+	assert.NoError(db.Put([]byte("bookmark_github"), []byte("https://github.com")))
+
+	s, err := NewServer(":8000", Config{
+		URL:          "https://www.google.com/search?q=%s&btnK",
+		LearnAliases: 2,
+	})
+	assert.NoError(err)
+
+	// Searched for until typed twice, then an alias of the bookmark
+	for _, location := range []string{
+		"https://www.google.com/search?q=githb&btnK",
+		"https://www.google.com/search?q=githb&btnK",
+		"https://github.com",
+	} {
+		r, _ := http.NewRequest("GET", "/?q=githb", nil)
+		w := httptest.NewRecorder()
+		s.server.Handler.ServeHTTP(w, r)
+		assert.Equal(location, w.Header().Get("Location"))
+	}
+}
+
+func TestLearnAliasesMultiUser(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir("", "golinks")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	db, err = OpenStore(filepath.Join(dir, "test.db"))
+	assert.NoError(err)
+	defer db.Close()
+
+	assert.NoError(db.Put([]byte("bookmark_github"), []byte("https://github.com")))
+
+	s, err := NewServer(":8000", Config{
+		URL:          "https://www.google.com/search?q=%s&btnK",
+		LearnAliases: 2,
+		AuthHeader:   "X-Forwarded-User",
+		MultiUser:    true,
+	})
+	assert.NoError(err)
+
+	do := func(user, path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r, _ := http.NewRequest("GET", path, nil)
+		r.RemoteAddr = "127.0.0.1:1234"
+		r.Header.Set("X-Forwarded-User", user)
+		s.server.Handler.ServeHTTP(w, r)
+		return w
+	}
+	search := "https://www.google.com/search?q=githb&btnK"
+
+	// Misses are tallied per user and learned as personal aliases
+	assert.Equal(search, do("alice", "/?q=githb").Header().Get("Location"))
+	assert.Equal(search, do("bob", "/?q=githb").Header().Get("Location"))
+	assert.Equal(search, do("alice", "/?q=githb").Header().Get("Location"))
+	assert.Equal("https://github.com", do("alice", "/?q=githb").Header().Get("Location"))
+	assert.Equal(search, do("carol", "/?q=githb").Header().Get("Location"))
+	assert.False(db.Has([]byte("alias_githb")))
+	_, ok := LookupBookmark("githb")
+	assert.False(ok)
+
+	// Only the user is notified, once
+	assert.NotContains(do("bob", "/").Body.String(), "githb now goes to github")
+	assert.Contains(do("alice", "/").Body.String(), "githb now goes to github (delete ~githb to undo)")
+	assert.NotContains(do("alice", "/").Body.String(), "githb now goes to github")
+
+	// Personal aliases are deleted like personal bookmarks
+	w := httptest.NewRecorder()
+	r := postQuery(url.Values{"q": {"remove ~githb"}})
+	r.RemoteAddr = "127.0.0.1:1234"
+	r.Header.Set("X-Forwarded-User", "alice")
+	s.server.Handler.ServeHTTP(w, r)
+	assert.Equal(http.StatusOK, w.Code)
+	assert.Equal(search, do("alice", "/?q=githb").Header().Get("Location"))
+}
+
+func TestAliasLearnerChanged(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir("", "golinks")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	db, err = OpenStore(filepath.Join(dir, "test.db"))
+	assert.NoError(err)
+	defer db.Close()
+
+	counters := NewCounters()
+	learner := NewAliasLearner(1, NewWritePolicy(0, 0, counters), counters, func(Event) {})
+	db = NewEventsStore(db, learner.Changed)
+
+	// Candidates are reloaded as bookmarks are created (however they are)
+	learner.Miss(nil, "githb")
+	assert.NoError(SaveBookmark("github", "https://github.com"))
+	learner.Miss(nil, "githb")
+	bookmark, ok := LookupBookmark("githb")
+	assert.True(ok)
+	assert.Equal("github", bookmark.Name())
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+)
+
+// SchemaVersion is the version of the key layout of the database
+const SchemaVersion = "1"
+
+var schemaKey = []byte("meta_schema")
+
+// LegacyMigration summarizes the migration of a database created by
+// upstream prologic/golinks
+type LegacyMigration struct {
+	Renamed   int `json:"renamed"`
+	Stamped   int `json:"stamped"`
+	Conflicts int `json:"conflicts"`
+}
+
+func (m LegacyMigration) String() string {
+	return fmt.Sprintf(
+		"%d renamed, %d stamped, %d conflicts",
+		m.Renamed, m.Stamped, m.Conflicts,
+	)
+}
+
+// IsLegacyDB reports whether the database was created by upstream
+// prologic/golinks, i.e: it has no schema version and bookmarks without a
+// modification time
+func IsLegacyDB() bool {
+	if db.Has(schemaKey) {
+		return false
+	}
+
+	legacy := false
+	db.Scan([]byte("bookmark_"), func(key []byte) error {
+		name := strings.TrimPrefix(string(key), "bookmark_")
+		if !db.Has(modifiedKey(name)) {
+			legacy = true
+			return errStopScan
+		}
+		return nil
+	})
+	return legacy
+}
+
+// MigrateLegacyKeys migrates a database created by upstream prologic/golinks
+// to this fork's layout and records the schema version so it only runs once.
+// Upstream stored bookmarks under the name as typed (e.g: bookmark_GH) but
+// looked them up lowercased, so mixed case bookmarks are renamed, unless the
+// lowercase name is taken by a different url. Bookmarks without a
+// modification time (used when syncing) are stamped with the current time.
+func MigrateLegacyKeys() (result LegacyMigration, err error) {
+	if val, err := db.Get(schemaKey); err == nil && string(val) == SchemaVersion {
+		return result, nil
+	}
+
+	bookmarks, err := ListBookmarks()
+	if err != nil {
+		return
+	}
+
+	for _, bookmark := range bookmarks {
+		name := bookmark.Name()
+		lower := strings.ToLower(name)
+
+		if lower != name {
+			var url string
+			if url, err = bookmarkURL(lower); err != nil {
+				return
+			}
+			if url != "" && url != bookmark.URL() {
+				slog.Warn("not renaming bookmark to a name that already exists", "name", name, "to", lower)
+				result.Conflicts++
+			} else {
+				if err = DeleteBookmark(name); err != nil {
+					return
+				}
+				if err = SaveBookmark(lower, bookmark.URL()); err != nil {
+					return
+				}
+				result.Renamed++
+				continue
+			}
+		}
+
+		if db.Has(modifiedKey(name)) {
+			continue
+		}
+		if err = db.Put(modifiedKey(name), []byte(time.Now().UTC().Format(time.RFC3339Nano))); err != nil {
+			return
+		}
+		result.Stamped++
+	}
+
+	err = db.Put(schemaKey, []byte(SchemaVersion))
+	return
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMigrateLegacyKeys(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir("", "golinks")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	db, err = OpenStore(filepath.Join(dir, "test.db"))
+	assert.NoError(err)
+	defer db.Close()
+
+	assert.False(IsLegacyDB())
+
+	// As written by prologic/golinks
+	assert.NoError(db.Put([]byte("bookmark_g"), []byte("https://www.google.com/search?q=%s")))
+	assert.NoError(db.Put([]byte("bookmark_GH"), []byte("https://github.com/%s")))
+	assert.NoError(db.Put([]byte("bookmark_Wiki"), []byte("https://old.wiki/%s")))
+	assert.NoError(db.Put([]byte("bookmark_wiki"), []byte("https://wiki.corp/%s")))
+	assert.True(IsLegacyDB())
+
+	_, ok := LookupBookmark("GH")
+	assert.False(ok, "unreachable before migrating")
+
+	result, err := MigrateLegacyKeys()
+	assert.NoError(err)
+	assert.Equal(LegacyMigration{Renamed: 1, Stamped: 3, Conflicts: 1}, result)
+	assert.False(IsLegacyDB())
+
+	bookmark, ok := LookupBookmark("GH")
+	assert.True(ok)
+	assert.Equal("https://github.com/%s", bookmark.URL())
+	assert.False(db.Has([]byte("bookmark_GH")))
+
+	bookmarks, err := FindBookmarksByTarget("github.com")
+	assert.NoError(err)
+	assert.Len(bookmarks, 1)
+
+	// Conflicting names are kept as they were
+	assert.True(db.Has([]byte("bookmark_Wiki")))
+	bookmark, ok = LookupBookmark("wiki")
+	assert.True(ok)
+	assert.Equal("https://wiki.corp/%s", bookmark.URL())
+
+	_, ok = BookmarkModified("g")
+	assert.True(ok)
+
+	// Only runs once
+	assert.NoError(db.Put([]byte("bookmark_Later"), []byte("https://example.com")))
+	result, err = MigrateLegacyKeys()
+	assert.NoError(err)
+	assert.Equal(LegacyMigration{}, result)
+	assert.True(db.Has([]byte("bookmark_Later")))
+}
+
+func TestNewDBIsNotLegacy(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir("", "golinks")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	db, err = OpenStore(filepath.Join(dir, "test.db"))
+	assert.NoError(err)
+	defer db.Close()
+
+	assert.NoError(EnsureDefaultBookmarks())
+	assert.False(IsLegacyDB())
+
+	result, err := MigrateLegacyKeys()
+	assert.NoError(err)
+	assert.Equal(LegacyMigration{}, result)
+}
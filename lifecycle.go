@@ -0,0 +1,150 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// DefaultStopTimeout is how long a subsystem has to stop before shutdown
+// moves on without it
+const DefaultStopTimeout = 10 * time.Second
+
+// Hook is how a subsystem (the store, a worker, a scheduler, a bot, ...)
+// starts and stops. Either can be nil.
+type Hook struct {
+	Name  string
+	Start func() error
+	Stop  func(ctx context.Context) error
+
+	// Timeout is how long Stop has (DefaultStopTimeout if 0)
+	Timeout time.Duration
+}
+
+// Lifecycle starts subsystems in the order their hooks were appended and
+// stops them in reverse, so subsystems are stopped before what they depend
+// on (e.g: workers before the store). Each start and stop is logged, and
+// stops that time out are counted and skipped so shutdown always finishes.
+type Lifecycle struct {
+	sync.Mutex
+
+	hooks    []Hook
+	started  int
+	counters *Counters
+}
+
+// NewLifecycle ...
+func NewLifecycle(counters *Counters) *Lifecycle {
+	return &Lifecycle{counters: counters}
+}
+
+// Append adds a subsystem, started after and stopped before those already
+// added
+func (l *Lifecycle) Append(hook Hook) {
+	l.Lock()
+	defer l.Unlock()
+
+	l.hooks = append(l.hooks, hook)
+}
+
+// Go adds a subsystem that runs in the background until its context is
+// cancelled on stop, e.g: a scheduler's loop
+func (l *Lifecycle) Go(name string, run func(ctx context.Context)) {
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+
+	l.Append(Hook{
+		Name: name,
+		Start: func() error {
+			go func() {
+				defer close(done)
+				run(ctx)
+			}()
+			return nil
+		},
+		Stop: func(stopCtx context.Context) error {
+			cancel()
+			select {
+			case <-done:
+				return nil
+			case <-stopCtx.Done():
+				return stopCtx.Err()
+			}
+		},
+	})
+}
+
+// Start starts all subsystems not yet started in order. If one fails to
+// start those already started are stopped.
+func (l *Lifecycle) Start() error {
+	l.Lock()
+	defer l.Unlock()
+
+	for l.started < len(l.hooks) {
+		hook := l.hooks[l.started]
+		if hook.Start != nil {
+			if err := hook.Start(); err != nil {
+				slog.Error("error starting", "subsystem", hook.Name, "err", err)
+				l.stopAll(context.Background())
+				return fmt.Errorf("error starting %s: %w", hook.Name, err)
+			}
+		}
+		slog.Debug("started", "subsystem", hook.Name)
+		l.started++
+	}
+	return nil
+}
+
+// Stop stops all started subsystems in reverse order, each within its
+// timeout (or the deadline of ctx if sooner), and returns their errors
+func (l *Lifecycle) Stop(ctx context.Context) error {
+	l.Lock()
+	defer l.Unlock()
+
+	return l.stopAll(ctx)
+}
+
+func (l *Lifecycle) stopAll(ctx context.Context) error {
+	var errs []error
+	for ; l.started > 0; l.started-- {
+		hook := l.hooks[l.started-1]
+		if hook.Stop == nil {
+			continue
+		}
+		if err := l.stop(ctx, hook); err != nil {
+			slog.Error("error stopping", "subsystem", hook.Name, "err", err)
+			errs = append(errs, fmt.Errorf("error stopping %s: %w", hook.Name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (l *Lifecycle) stop(ctx context.Context, hook Hook) error {
+	timeout := hook.Timeout
+	if timeout <= 0 {
+		timeout = DefaultStopTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	t0 := time.Now()
+	done := make(chan error, 1)
+	go func() {
+		done <- hook.Stop(ctx)
+	}()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			return err
+		}
+		slog.Info("stopped", "subsystem", hook.Name, "took", time.Since(t0))
+		return nil
+	case <-ctx.Done():
+		l.counters.Inc("n_stop_timeouts")
+		return ctx.Err()
+	}
+}
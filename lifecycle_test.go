@@ -0,0 +1,126 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/rcrowley/go-metrics"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLifecycle(t *testing.T) {
+	assert := assert.New(t)
+
+	var events []string
+	hook := func(name string) Hook {
+		return Hook{
+			Name:  name,
+			Start: func() error { events = append(events, "start "+name); return nil },
+			Stop:  func(ctx context.Context) error { events = append(events, "stop "+name); return nil },
+		}
+	}
+
+	l := NewLifecycle(NewCounters())
+	l.Append(hook("store"))
+	l.Append(Hook{Name: "access log"})
+	l.Append(hook("http"))
+
+	assert.NoError(l.Start())
+	assert.NoError(l.Stop(context.Background()))
+	assert.Equal([]string{"start store", "start http", "stop http", "stop store"}, events)
+
+	// Stopping twice is a no-op
+	events = nil
+	assert.NoError(l.Stop(context.Background()))
+	assert.Empty(events)
+}
+
+func TestLifecycleStartError(t *testing.T) {
+	assert := assert.New(t)
+
+	var stopped []string
+	l := NewLifecycle(NewCounters())
+	l.Append(Hook{
+		Name: "store",
+		Stop: func(ctx context.Context) error { stopped = append(stopped, "store"); return nil },
+	})
+	l.Append(Hook{
+		Name:  "grpc",
+		Start: func() error { return errors.New("address already in use") },
+		Stop:  func(ctx context.Context) error { stopped = append(stopped, "grpc"); return nil },
+	})
+
+	// Subsystems already started are stopped, but not the one that failed
+	err := l.Start()
+	assert.Error(err)
+	assert.Contains(err.Error(), "error starting grpc")
+	assert.Equal([]string{"store"}, stopped)
+}
+
+func TestLifecycleStopTimeout(t *testing.T) {
+	assert := assert.New(t)
+
+	counters := NewCounters()
+	l := NewLifecycle(counters)
+
+	stopped := false
+	l.Append(Hook{
+		Name: "store",
+		Stop: func(ctx context.Context) error { stopped = true; return nil },
+	})
+	l.Append(Hook{
+		Name:    "stuck",
+		Stop:    func(ctx context.Context) error { time.Sleep(time.Second); return nil },
+		Timeout: 10 * time.Millisecond,
+	})
+	l.Append(Hook{
+		Name: "failing",
+		Stop: func(ctx context.Context) error { return errors.New("boom") },
+	})
+
+	assert.NoError(l.Start())
+	err := l.Stop(context.Background())
+	assert.Error(err)
+	assert.Contains(err.Error(), "error stopping failing: boom")
+	assert.Contains(err.Error(), "error stopping stuck")
+
+	// Shutdown goes on without subsystems that fail or time out
+	assert.True(stopped)
+	counter, ok := counters.r.Get("n_stop_timeouts").(metrics.Counter)
+	assert.True(ok)
+	assert.Equal(int64(1), counter.Count())
+}
+
+func TestLifecycleGo(t *testing.T) {
+	assert := assert.New(t)
+
+	l := NewLifecycle(NewCounters())
+
+	ticks := make(chan struct{}, 100)
+	done := false
+	l.Go("scheduler", func(ctx context.Context) {
+		ticker := time.NewTicker(time.Millisecond)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				done = true
+				return
+			case <-ticker.C:
+				select {
+				case ticks <- struct{}{}:
+				default:
+				}
+			}
+		}
+	})
+
+	assert.NoError(l.Start())
+	<-ticks
+
+	// Stop waits for the scheduler to return
+	assert.NoError(l.Stop(context.Background()))
+	assert.True(done)
+}
@@ -0,0 +1,273 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+// LinkStatus is the outcome of checking a bookmark's link
+type LinkStatus struct {
+	Name    string    `json:"name"`
+	URL     string    `json:"url"`
+	OK      bool      `json:"ok"`
+	Status  int       `json:"status,omitempty"`
+	Error   string    `json:"error,omitempty"`
+	Checked time.Time `json:"checked"`
+
+	// BrokenSince is when the link was first found broken, for as long as
+	// it stays broken, and Archive an archived copy of it once it has been
+	// broken for long (see LinkRot)
+	BrokenSince *time.Time `json:"broken_since,omitempty"`
+	Archive     string     `json:"archive,omitempty"`
+}
+
+// Rotten reports whether the link has been broken for at least d
+func (s LinkStatus) Rotten(d time.Duration) bool {
+	return !s.OK && s.BrokenSince != nil && s.Checked.Sub(*s.BrokenSince) >= d
+}
+
+func linkStatusKey(name string) []byte {
+	return []byte(fmt.Sprintf("linkcheck_%s", name))
+}
+
+// GetLinkStatus returns the last check of a bookmark's link
+func GetLinkStatus(name string) (status LinkStatus, ok bool) {
+	val, err := db.Get(linkStatusKey(name))
+	if err != nil {
+		return
+	}
+	if err := json.Unmarshal(val, &status); err != nil {
+		return
+	}
+	return status, true
+}
+
+func saveLinkStatus(status LinkStatus) error {
+	data, err := json.Marshal(status)
+	if err != nil {
+		return err
+	}
+	return db.Put(linkStatusKey(status.Name), data)
+}
+
+// checkURL returns the url to check for a bookmark url, i.e: with an empty
+// query substituted
+func checkURL(url string) string {
+	if !strings.Contains(url, "%s") {
+		return url
+	}
+	return fmt.Sprintf(url, "")
+}
+
+// CheckLink checks whether the url is reachable. HEAD is tried first,
+// falling back to GET for servers that don't support it.
+func CheckLink(url string) (status int, err error) {
+	for _, method := range []string{"HEAD", "GET"} {
+		var req *http.Request
+		if req, err = http.NewRequest(method, url, nil); err != nil {
+			return
+		}
+		req.Header.Set("User-Agent", "golinks link checker")
+
+		var res *http.Response
+		if res, err = client.Do(req); err != nil {
+			return
+		}
+		res.Body.Close()
+
+		status = res.StatusCode
+		if status != http.StatusMethodNotAllowed && status != http.StatusNotImplemented {
+			break
+		}
+	}
+	return
+}
+
+// LinkChecker periodically checks all bookmarks' links for link rot. Checks
+// run on the shared FetchPool. Links broken for at least rotAfter are
+// looked up in the Wayback Machine for an archived copy.
+type LinkChecker struct {
+	pool     *FetchPool
+	rotAfter time.Duration
+	counters *Counters
+
+	archiveURL string
+}
+
+// NewLinkChecker ...
+func NewLinkChecker(pool *FetchPool, rotAfter time.Duration, counters *Counters) *LinkChecker {
+	return &LinkChecker{
+		pool:     pool,
+		rotAfter: rotAfter,
+		counters: counters,
+
+		archiveURL: WaybackAPIURL,
+	}
+}
+
+func (c *LinkChecker) check(bookmark Bookmark) {
+	url := checkURL(bookmark.URL())
+	status := LinkStatus{Name: bookmark.Name(), URL: bookmark.URL(), Checked: time.Now()}
+	prev, ok := GetLinkStatus(bookmark.Name())
+
+	code, err := CheckLink(url)
+	if err != nil {
+		status.Error = err.Error()
+	} else {
+		status.Status = code
+		status.OK = code < 400
+	}
+
+	if status.OK {
+		c.counters.Inc("n_linkcheck_ok")
+	} else {
+		c.counters.Inc("n_linkcheck_broken")
+
+		// Links are broken since the first of consecutive failed checks
+		// (checks saved before this was tracked count from their time)
+		since := status.Checked
+		if ok && !prev.OK && prev.URL == status.URL {
+			since = prev.Checked
+			if prev.BrokenSince != nil {
+				since = *prev.BrokenSince
+			}
+			status.Archive = prev.Archive
+		}
+		status.BrokenSince = &since
+	}
+
+	if err := saveLinkStatus(status); err != nil {
+		slog.Error("error saving link status", "name", bookmark.Name(), "err", err)
+		return
+	}
+
+	if c.rotAfter > 0 && status.Rotten(c.rotAfter) && status.Archive == "" {
+		if err := c.pool.Submit(WaybackHost, func() { c.findArchive(status) }); err != nil {
+			slog.Warn("error queueing archive lookup", "name", bookmark.Name(), "err", err)
+		}
+	}
+}
+
+// findArchive looks up an archived copy of a rotten link and saves it with
+// the link's status (unless the link has changed or been fixed since)
+func (c *LinkChecker) findArchive(status LinkStatus) {
+	archive, err := FindArchivedCopy(c.archiveURL, status.URL)
+	if err != nil {
+		c.counters.Inc("n_linkrot_archive_error")
+		slog.Error("error looking up archived copy", "name", status.Name, "url", status.URL, "err", err)
+		return
+	}
+	if archive == "" {
+		c.counters.Inc("n_linkrot_unarchived")
+		return
+	}
+	c.counters.Inc("n_linkrot_archived")
+
+	current, ok := GetLinkStatus(status.Name)
+	if !ok || current.OK || current.URL != status.URL {
+		return
+	}
+	current.Archive = archive
+	if err := saveLinkStatus(current); err != nil {
+		slog.Error("error saving link status", "name", status.Name, "err", err)
+	}
+}
+
+// CheckAll queues checks of all bookmarks (except those with templated
+// hosts) and returns how many were queued
+func (c *LinkChecker) CheckAll() (int, error) {
+	bookmarks, err := ListBookmarks()
+	if err != nil {
+		return 0, err
+	}
+
+	n := 0
+	for _, bookmark := range bookmarks {
+		bookmark := bookmark
+		host := TargetDomain(bookmark.URL())
+		if host == "" || !strings.HasPrefix(bookmark.URL(), "http") {
+			continue
+		}
+		// Archived copies substituted for rotten links aren't checked
+		if _, ok := GetArchivedLink(bookmark); ok {
+			continue
+		}
+		if err := c.pool.Submit(host, func() { c.check(bookmark) }); err != nil {
+			return n, err
+		}
+		n++
+	}
+
+	return n, nil
+}
+
+// Run checks all bookmarks now and then every interval until ctx is
+// cancelled
+func (c *LinkChecker) Run(ctx context.Context, interval time.Duration) {
+	for {
+		if _, err := c.CheckAll(); err != nil {
+			slog.Error("error checking links", "err", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(interval):
+		}
+	}
+}
+
+// ListLinkStatuses returns the last check of each bookmark's link. Checks
+// of links that have changed since are skipped.
+func ListLinkStatuses(brokenOnly bool) ([]LinkStatus, error) {
+	statuses := []LinkStatus{}
+
+	bookmarks, err := ListBookmarks()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, bookmark := range bookmarks {
+		val, err := db.Get(linkStatusKey(bookmark.Name()))
+		if err != nil {
+			continue
+		}
+
+		var status LinkStatus
+		if err := json.Unmarshal(val, &status); err != nil || status.URL != bookmark.URL() {
+			continue
+		}
+		if brokenOnly && status.OK {
+			continue
+		}
+		statuses = append(statuses, status)
+	}
+
+	return statuses, nil
+}
+
+// LinksHandler returns the last link check of each bookmark, e.g:
+// /api/v1/links?broken=true
+func (s *Server) LinksHandler() httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+		s.counters.Inc("n_api_links")
+
+		statuses, err := ListLinkStatuses(r.URL.Query().Get("broken") == "true")
+		if err != nil {
+			WriteAPIError(
+				w, r, http.StatusInternalServerError, ErrCodeInternal,
+				"error reading link checks", err.Error(),
+			)
+			return
+		}
+
+		WriteJSON(w, http.StatusOK, map[string]interface{}{"links": statuses})
+	}
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLinkChecker(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir("", "golinks")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	db, err = OpenStore(filepath.Join(dir, "test.db"))
+	assert.NoError(err)
+	defer db.Close()
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/ok":
+			if r.Method == "HEAD" {
+				w.WriteHeader(http.StatusMethodNotAllowed)
+			}
+		case "/search":
+			if r.URL.Query().Get("q") != "" {
+				w.WriteHeader(http.StatusBadRequest)
+			}
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer ts.Close()
+
+	assert.NoError(SaveBookmark("ok", ts.URL+"/ok"))
+	assert.NoError(SaveBookmark("search", ts.URL+"/search?q=%s"))
+	assert.NoError(SaveBookmark("gone", ts.URL+"/gone"))
+	assert.NoError(SaveBookmark("templated", "https://%s.example.com/"))
+
+	pool := NewFetchPool(2, 0, NewCounters())
+	checker := NewLinkChecker(pool, 0, NewCounters())
+	n, err := checker.CheckAll()
+	assert.NoError(err)
+	assert.Equal(3, n)
+
+	// Stop only drops queued fetches so wait for the checks to complete
+	pool.Wait()
+	pool.Stop()
+
+	statuses, err := ListLinkStatuses(false)
+	assert.NoError(err)
+	assert.Len(statuses, 3)
+
+	statuses, err = ListLinkStatuses(true)
+	assert.NoError(err)
+	assert.Len(statuses, 1)
+	assert.Equal("gone", statuses[0].Name)
+	assert.Equal(http.StatusNotFound, statuses[0].Status)
+
+	// Checks of links that changed since are ignored
+	assert.NoError(SaveBookmark("gone", ts.URL+"/ok"))
+
+	s, err := NewServer(":8000", Config{})
+	assert.NoError(err)
+
+	w := httptest.NewRecorder()
+	r, _ := http.NewRequest("GET", "/api/v1/links?broken=true", nil)
+	authorize(r, ScopeRead)
+	s.router.ServeHTTP(w, r)
+	assert.Equal(http.StatusOK, w.Code)
+
+	var res struct {
+		Links []LinkStatus `json:"links"`
+	}
+	assert.NoError(json.Unmarshal(w.Body.Bytes(), &res))
+	assert.Empty(res.Links)
+}
@@ -0,0 +1,275 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+const (
+	// DefaultLinkRotAfter is how long a link must stay broken before an
+	// archived copy is offered in its place
+	DefaultLinkRotAfter = 7 * 24 * time.Hour
+
+	// WaybackAPIURL is the Wayback Machine's availability API
+	WaybackAPIURL = "https://archive.org/wayback/available"
+
+	// WaybackHost is the host archive lookups are spaced out for
+	WaybackHost = "archive.org"
+)
+
+var (
+	// ErrBookmarkNotFound is returned when archiving the link of a bookmark
+	// that doesn't exist
+	ErrBookmarkNotFound = errors.New("error: bookmark not found")
+
+	// ErrNotRotten is returned when substituting an archived copy for a
+	// link that isn't rotten or has no archived copy
+	ErrNotRotten = errors.New("error: link is not broken or has no archived copy")
+)
+
+// waybackAvailability is the response of the Wayback Machine's
+// availability API
+type waybackAvailability struct {
+	ArchivedSnapshots struct {
+		Closest struct {
+			Available bool   `json:"available"`
+			URL       string `json:"url"`
+			Timestamp string `json:"timestamp"`
+			Status    string `json:"status"`
+		} `json:"closest"`
+	} `json:"archived_snapshots"`
+}
+
+// FindArchivedCopy returns the url of the closest archived copy of a link
+// in the Wayback Machine (at api), or "" if it was never archived. Links
+// with a query placeholder keep it, so searches go to the archived copies
+// of their results.
+func FindArchivedCopy(api, link string) (string, error) {
+	res, err := client.Get(api + "?" + url.Values{"url": {checkURL(link)}}.Encode())
+	if err != nil {
+		return "", err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("unexpected status %s", res.Status)
+	}
+
+	var availability waybackAvailability
+	if err := json.NewDecoder(res.Body).Decode(&availability); err != nil {
+		return "", err
+	}
+
+	closest := availability.ArchivedSnapshots.Closest
+	if !closest.Available || !strings.HasPrefix(closest.Status, "2") {
+		return "", nil
+	}
+
+	// Snapshot urls are the archive's prefix followed by the archived url
+	// (e.g: http://web.archive.org/web/20130919044612/http://example.com/)
+	archive := closest.URL
+	prefix := "/web/" + closest.Timestamp + "/"
+	if i := strings.Index(archive, prefix); closest.Timestamp != "" && i >= 0 {
+		archive = archive[:i+len(prefix)] + link
+	}
+	if strings.HasPrefix(archive, "http://web.archive.org/") {
+		archive = "https://" + strings.TrimPrefix(archive, "http://")
+	}
+	return archive, nil
+}
+
+// ArchivedLink is a bookmark whose rotten link was substituted with an
+// archived copy
+type ArchivedLink struct {
+	Name     string    `json:"name"`
+	URL      string    `json:"url"`
+	Archive  string    `json:"archive"`
+	Archived time.Time `json:"archived"`
+}
+
+func archivedLinkKey(name string) []byte {
+	return []byte(fmt.Sprintf("archived_%s", name))
+}
+
+// GetArchivedLink returns the archived link of a bookmark, if it still
+// points at the archived copy
+func GetArchivedLink(bookmark Bookmark) (link ArchivedLink, ok bool) {
+	val, err := db.Get(archivedLinkKey(bookmark.Name()))
+	if err != nil {
+		return
+	}
+	if err := json.Unmarshal(val, &link); err != nil || link.Archive != bookmark.URL() {
+		return
+	}
+	return link, true
+}
+
+// ListArchivedLinks returns the bookmarks substituted with archived copies
+func ListArchivedLinks() ([]ArchivedLink, error) {
+	links := []ArchivedLink{}
+
+	bookmarks, err := ListBookmarks()
+	if err != nil {
+		return nil, err
+	}
+	for _, bookmark := range bookmarks {
+		if link, ok := GetArchivedLink(bookmark); ok {
+			links = append(links, link)
+		}
+	}
+	return links, nil
+}
+
+// ListRottenLinks returns the links broken for at least d, some with an
+// archived copy
+func ListRottenLinks(d time.Duration) ([]LinkStatus, error) {
+	statuses, err := ListLinkStatuses(true)
+	if err != nil {
+		return nil, err
+	}
+
+	rotten := []LinkStatus{}
+	for _, status := range statuses {
+		if status.Rotten(d) {
+			rotten = append(rotten, status)
+		}
+	}
+	return rotten, nil
+}
+
+// ArchiveLink substitutes the archived copy of a link broken for at least
+// d for the bookmark's url, and marks the bookmark as archived
+func ArchiveLink(name string, d time.Duration) (ArchivedLink, error) {
+	status, ok := GetLinkStatus(name)
+	target, err := bookmarkURL(name)
+	if err != nil {
+		return ArchivedLink{}, err
+	}
+	if target == "" {
+		return ArchivedLink{}, ErrBookmarkNotFound
+	}
+	if !ok || status.URL != target || !status.Rotten(d) || status.Archive == "" {
+		return ArchivedLink{}, ErrNotRotten
+	}
+
+	link := ArchivedLink{
+		Name:     name,
+		URL:      target,
+		Archive:  status.Archive,
+		Archived: time.Now().UTC(),
+	}
+	data, err := json.Marshal(link)
+	if err != nil {
+		return ArchivedLink{}, err
+	}
+	if err := db.Put(archivedLinkKey(name), data); err != nil {
+		return ArchivedLink{}, err
+	}
+	if err := SaveBookmark(name, link.Archive); err != nil {
+		return ArchivedLink{}, err
+	}
+	return link, nil
+}
+
+// LinkRotHandler reports the links broken for long, with a button to
+// substitute their archived copies, and the bookmarks already archived
+func (s *Server) LinkRotHandler() httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+		s.counters.Inc("n_linkrot_view")
+
+		rotten, err := ListRottenLinks(s.config.LinkRotAfter)
+		if err != nil {
+			slog.Error("error reading link checks", "err", err)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+		archived, err := ListArchivedLinks()
+		if err != nil {
+			slog.Error("error reading archived links", "err", err)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+
+		s.render("linkrot", w, r, map[string]interface{}{
+			"Rotten":   rotten,
+			"Archived": archived,
+			"Days":     int(s.config.LinkRotAfter.Hours() / 24),
+			"Writable": !s.config.ReadOnly,
+			"Saved":    r.URL.Query().Get("archived"),
+		})
+	}
+}
+
+// ArchiveLinkHandler substitutes the archived copy of a rotten link from
+// the link rot page's form (name)
+func (s *Server) ArchiveLinkHandler() httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+		s.counters.Inc("n_linkrot_substitute")
+
+		if s.config.ReadOnly {
+			http.Error(w, "Forbidden: instance is read-only", http.StatusForbidden)
+			return
+		}
+
+		name := strings.ToLower(strings.TrimSpace(r.FormValue("name")))
+		link, err := ArchiveLink(name, s.config.LinkRotAfter)
+		if err != nil {
+			switch err {
+			case ErrBookmarkNotFound:
+				http.Error(w, fmt.Sprintf("Not Found: no bookmark named %s", name), http.StatusNotFound)
+			case ErrNotRotten:
+				http.Error(w, fmt.Sprintf("Conflict: link of %s is not broken or has no archived copy", name), http.StatusConflict)
+			default:
+				slog.Error("error archiving link", "name", name, "err", err)
+				http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			}
+			return
+		}
+		auditBookmark(r, name, link.URL, link.Archive)
+
+		http.Redirect(w, r, "/linkrot?"+url.Values{"archived": {name}}.Encode(), http.StatusSeeOther)
+	}
+}
+
+// ArchiveLinkAPIHandler substitutes the archived copy of a rotten link,
+// e.g: POST /api/v1/links/archive/work/wiki
+func (s *Server) ArchiveLinkAPIHandler() httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		s.counters.Inc("n_api_links_archive")
+
+		if !s.writable(w, r) {
+			return
+		}
+
+		name := bookmarkName(p)
+		link, err := ArchiveLink(name, s.config.LinkRotAfter)
+		switch err {
+		case nil:
+			auditBookmark(r, name, link.URL, link.Archive)
+			WriteJSON(w, http.StatusOK, link)
+		case ErrBookmarkNotFound:
+			WriteAPIError(
+				w, r, http.StatusNotFound, ErrCodeNotFound,
+				fmt.Sprintf("no bookmark named %s", name), nil,
+			)
+		case ErrNotRotten:
+			WriteAPIError(
+				w, r, http.StatusConflict, ErrCodeConflict,
+				fmt.Sprintf("link of %s is not broken or has no archived copy", name), nil,
+			)
+		default:
+			WriteAPIError(
+				w, r, http.StatusInternalServerError, ErrCodeInternal,
+				"error archiving link", err.Error(),
+			)
+		}
+	}
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFindArchivedCopy(t *testing.T) {
+	assert := assert.New(t)
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Query().Get("url") {
+		case "https://example.com/wiki":
+			w.Write([]byte(`{"archived_snapshots":{"closest":{"available":true,"status":"200","timestamp":"20240101000000","url":"http://web.archive.org/web/20240101000000/https://example.com/wiki"}}}`))
+		case "https://example.com/search?q=":
+			w.Write([]byte(`{"archived_snapshots":{"closest":{"available":true,"status":"200","timestamp":"20240101000000","url":"http://web.archive.org/web/20240101000000/https://example.com/search?q="}}}`))
+		case "https://example.com/error":
+			w.Write([]byte(`{"archived_snapshots":{"closest":{"available":true,"status":"404","timestamp":"20240101000000","url":"http://web.archive.org/web/20240101000000/https://example.com/error"}}}`))
+		default:
+			w.Write([]byte(`{"archived_snapshots":{}}`))
+		}
+	}))
+	defer ts.Close()
+
+	archive, err := FindArchivedCopy(ts.URL, "https://example.com/wiki")
+	assert.NoError(err)
+	assert.Equal("https://web.archive.org/web/20240101000000/https://example.com/wiki", archive)
+
+	// Searches go to archived results
+	archive, err = FindArchivedCopy(ts.URL, "https://example.com/search?q=%s")
+	assert.NoError(err)
+	assert.Equal("https://web.archive.org/web/20240101000000/https://example.com/search?q=%s", archive)
+
+	// Archived errors and links never archived have no archived copy
+	archive, err = FindArchivedCopy(ts.URL, "https://example.com/error")
+	assert.NoError(err)
+	assert.Equal("", archive)
+	archive, err = FindArchivedCopy(ts.URL, "https://example.com/never")
+	assert.NoError(err)
+	assert.Equal("", archive)
+}
+
+func TestLinkRot(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir("", "golinks")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	db, err = OpenStore(filepath.Join(dir, "test.db"))
+	assert.NoError(err)
+	defer db.Close()
+
+	var lookups []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/wayback" {
+			lookups = append(lookups, r.URL.Query().Get("url"))
+			w.Write([]byte(`{"archived_snapshots":{"closest":{"available":true,"status":"200","timestamp":"20240101000000","url":"https://web.archive.org/web/20240101000000/` + r.URL.Query().Get("url") + `"}}}`))
+			return
+		}
+		http.NotFound(w, r)
+	}))
+	defer ts.Close()
+
+	assert.NoError(SaveBookmark("wiki", ts.URL+"/wiki"))
+	assert.NoError(SaveBookmark("docs", ts.URL+"/docs"))
+
+	// Broken for a week already, and broken just now
+	since := time.Now().Add(-8 * 24 * time.Hour)
+	old := LinkStatus{Name: "wiki", URL: ts.URL + "/wiki", Status: 404, Checked: since, BrokenSince: &since}
+	assert.NoError(saveLinkStatus(old))
+
+	pool := NewFetchPool(1, 0, NewCounters())
+	defer pool.Stop()
+	checker := NewLinkChecker(pool, DefaultLinkRotAfter, NewCounters())
+	checker.archiveURL = ts.URL + "/wayback"
+	checker.check(Bookmark{name: "wiki", url: ts.URL + "/wiki"})
+	checker.check(Bookmark{name: "docs", url: ts.URL + "/docs"})
+
+	for i := 0; i < 100; i++ {
+		if status, _ := GetLinkStatus("wiki"); status.Archive != "" {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	archive := "https://web.archive.org/web/20240101000000/" + ts.URL + "/wiki"
+	status, ok := GetLinkStatus("wiki")
+	assert.True(ok)
+	assert.Equal(since.Unix(), status.BrokenSince.Unix())
+	assert.Equal(archive, status.Archive)
+	assert.Equal([]string{ts.URL + "/wiki"}, lookups)
+
+	rotten, err := ListRottenLinks(DefaultLinkRotAfter)
+	assert.NoError(err)
+	if assert.Len(rotten, 1) {
+		assert.Equal("wiki", rotten[0].Name)
+	}
+
+	s, err := NewServer(":8000", Config{LinkRotAfter: DefaultLinkRotAfter})
+	assert.NoError(err)
+
+	w := httptest.NewRecorder()
+	r, _ := http.NewRequest("GET", "/linkrot", nil)
+	s.server.Handler.ServeHTTP(w, r)
+	assert.Equal(http.StatusOK, w.Code)
+	assert.Contains(w.Body.String(), "Use archived copy")
+
+	// Links not broken for long can't be substituted
+	w = httptest.NewRecorder()
+	r, _ = http.NewRequest("POST", "/linkrot/archive", strings.NewReader(url.Values{"name": {"docs"}}.Encode()))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	withCSRF(r)
+	s.server.Handler.ServeHTTP(w, r)
+	assert.Equal(http.StatusConflict, w.Code)
+
+	w = httptest.NewRecorder()
+	r, _ = http.NewRequest("POST", "/linkrot/archive", strings.NewReader(url.Values{"name": {"wiki"}}.Encode()))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	withCSRF(r)
+	s.server.Handler.ServeHTTP(w, r)
+	assert.Equal(http.StatusSeeOther, w.Code)
+	assert.Equal("/linkrot?archived=wiki", w.Header().Get("Location"))
+
+	bookmark, ok := LookupBookmark("wiki")
+	assert.True(ok)
+	assert.Equal(archive, bookmark.URL())
+
+	archived, err := ListArchivedLinks()
+	assert.NoError(err)
+	if assert.Len(archived, 1) {
+		assert.Equal(ts.URL+"/wiki", archived[0].URL)
+	}
+
+	// Archived copies are no longer reported or checked
+	rotten, err = ListRottenLinks(DefaultLinkRotAfter)
+	assert.NoError(err)
+	assert.Empty(rotten)
+	n, err := checker.CheckAll()
+	assert.NoError(err)
+	assert.Equal(1, n)
+
+	w = httptest.NewRecorder()
+	r, _ = http.NewRequest("POST", "/api/v1/links/archive/wiki", nil)
+	authorize(r, ScopeWrite)
+	s.server.Handler.ServeHTTP(w, r)
+	assert.Equal(http.StatusConflict, w.Code)
+
+	w = httptest.NewRecorder()
+	r, _ = http.NewRequest("POST", "/api/v1/links/archive/nope", nil)
+	authorize(r, ScopeWrite)
+	s.server.Handler.ServeHTTP(w, r)
+	assert.Equal(http.StatusNotFound, w.Code)
+
+	var res APIErrorResponse
+	assert.NoError(json.Unmarshal(w.Body.Bytes(), &res))
+	assert.Equal(ErrCodeNotFound, res.Error.Code)
+}
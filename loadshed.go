@@ -0,0 +1,95 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// LoadShedRetryAfter is how long clients of shed requests are asked to
+// wait before retrying
+const LoadShedRetryAfter = time.Second
+
+// SheddablePaths are the (prefixes of the) paths of the suggestions and
+// analytics, shed first when the server is overloaded
+var SheddablePaths = []string{
+	"/suggest",
+	"/widgets/",
+	"/history",
+	"/linkrot",
+	"/metrics",
+	"/debug/",
+	"/graphql",
+	"/api/v1/hits",
+	"/api/v1/feedback",
+	"/api/v1/usage",
+	"/api/v1/history",
+	"/api/v1/links",
+}
+
+// sheddable reports whether a request is for suggestions or analytics
+// (reads only, so writes are never shed)
+func sheddable(r *http.Request) bool {
+	if r.Method != "GET" && r.Method != "HEAD" {
+		return false
+	}
+	for _, path := range SheddablePaths {
+		if strings.HasPrefix(r.URL.Path, path) {
+			return true
+		}
+	}
+	return false
+}
+
+// LoadShedder limits how many requests are handled concurrently. Once max
+// requests are in flight, suggestion and analytics requests are shed with
+// a 503 and Retry-After, so traffic spikes can't starve redirects (which,
+// like all other requests, are never shed).
+type LoadShedder struct {
+	max      int64
+	inflight int64
+	counters *Counters
+}
+
+// NewLoadShedder ...
+func NewLoadShedder(max int, counters *Counters) *LoadShedder {
+	return &LoadShedder{max: int64(max), counters: counters}
+}
+
+// InFlight returns how many requests are being handled
+func (l *LoadShedder) InFlight() int64 {
+	return atomic.LoadInt64(&l.inflight)
+}
+
+// Handler sheds requests to next when overloaded. Streams (e.g: /events)
+// at the given paths are long-lived so they aren't counted as in flight.
+func (l *LoadShedder) Handler(next http.Handler, streams ...string) http.Handler {
+	retryAfter := strconv.Itoa(int(LoadShedRetryAfter.Seconds()))
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for _, path := range streams {
+			if r.URL.Path == path {
+				next.ServeHTTP(w, r)
+				return
+			}
+		}
+
+		n := atomic.AddInt64(&l.inflight, 1)
+		defer atomic.AddInt64(&l.inflight, -1)
+
+		if n > l.max && sheddable(r) {
+			l.counters.Inc("n_shed")
+			w.Header().Set("Retry-After", retryAfter)
+			if strings.HasPrefix(r.URL.Path, "/api/") {
+				WriteAPIError(w, r, http.StatusServiceUnavailable, ErrCodeUnavailable, "server is overloaded", nil)
+			} else {
+				http.Error(w, "Service Unavailable: server is overloaded", http.StatusServiceUnavailable)
+			}
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoadShedder(t *testing.T) {
+	assert := assert.New(t)
+
+	release := make(chan struct{})
+	shedder := NewLoadShedder(2, NewCounters())
+	h := shedder.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("block") != "" {
+			<-release
+		}
+	}), "/events")
+
+	// Saturate the server with slow requests
+	var wg sync.WaitGroup
+	for i := 0; i < 2; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			r, _ := http.NewRequest("GET", "/?q=slow&block=1", nil)
+			h.ServeHTTP(httptest.NewRecorder(), r)
+		}()
+	}
+	for i := 0; i < 100 && shedder.InFlight() < 2; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	assert.Equal(int64(2), shedder.InFlight())
+
+	do := func(method, path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r, _ := http.NewRequest(method, path, nil)
+		h.ServeHTTP(w, r)
+		return w
+	}
+
+	// Suggestions and analytics are shed
+	w := do("GET", "/suggest?q=g")
+	assert.Equal(http.StatusServiceUnavailable, w.Code)
+	assert.Equal("1", w.Header().Get("Retry-After"))
+
+	w = do("GET", "/api/v1/hits")
+	assert.Equal(http.StatusServiceUnavailable, w.Code)
+	assert.Contains(w.Body.String(), `"code":"unavailable"`)
+
+	// Redirects, writes and streams are not
+	assert.Equal(http.StatusOK, do("GET", "/?q=gh").Code)
+	assert.Equal(http.StatusOK, do("GET", "/gh").Code)
+	assert.Equal(http.StatusOK, do("POST", "/history/save").Code)
+	assert.Equal(http.StatusOK, do("GET", "/events").Code)
+
+	close(release)
+	wg.Wait()
+	assert.Equal(int64(0), shedder.InFlight())
+	assert.Equal(http.StatusOK, do("GET", "/suggest?q=g").Code)
+}
@@ -0,0 +1,228 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	// Time zones are embedded as the Docker image has none
+	_ "time/tzdata"
+)
+
+// DefaultLanguage is the language commands answer in unless the request
+// asks for another supported one
+const DefaultLanguage = "en"
+
+// commandContextKey is the request context key of the CommandContext
+const commandContextKey contextKey = "command"
+
+// gmt is the zone dates are written in without a time zone, as in HTTP
+var gmt = time.FixedZone("GMT", 0)
+
+// locale is how dates and times are written in a language. Layouts are Go
+// time layouts where %a is the (short) weekday and %b the (short) month.
+type locale struct {
+	days   [7]string
+	months [12]string
+	date   string
+	time   string
+}
+
+// format formats t with a layout of the locale
+func (l locale) format(t time.Time, layout string) string {
+	var b strings.Builder
+	for layout != "" {
+		i := strings.Index(layout, "%")
+		if i < 0 || i == len(layout)-1 {
+			b.WriteString(t.Format(layout))
+			break
+		}
+		b.WriteString(t.Format(layout[:i]))
+		switch layout[i+1] {
+		case 'a':
+			b.WriteString(l.days[t.Weekday()])
+		case 'b':
+			b.WriteString(l.months[t.Month()-1])
+		default:
+			b.WriteString(layout[i : i+2])
+		}
+		layout = layout[i+2:]
+	}
+	return b.String()
+}
+
+// locales are the supported languages (by base language, e.g: de for
+// de-CH), English being how commands always answered
+var locales = map[string]locale{
+	"en": {
+		days:   [7]string{"Sun", "Mon", "Tue", "Wed", "Thu", "Fri", "Sat"},
+		months: [12]string{"Jan", "Feb", "Mar", "Apr", "May", "Jun", "Jul", "Aug", "Sep", "Oct", "Nov", "Dec"},
+		date:   "%a, 02 %b 2006 15:04:05 MST",
+		time:   "15:04:05",
+	},
+	"de": {
+		days:   [7]string{"So", "Mo", "Di", "Mi", "Do", "Fr", "Sa"},
+		months: [12]string{"Jan", "Feb", "Mär", "Apr", "Mai", "Jun", "Jul", "Aug", "Sep", "Okt", "Nov", "Dez"},
+		date:   "%a, 2. %b 2006 15:04:05 MST",
+		time:   "15:04:05",
+	},
+	"es": {
+		days:   [7]string{"dom", "lun", "mar", "mié", "jue", "vie", "sáb"},
+		months: [12]string{"ene", "feb", "mar", "abr", "may", "jun", "jul", "ago", "sept", "oct", "nov", "dic"},
+		date:   "%a, 2 %b 2006 15:04:05 MST",
+		time:   "15:04:05",
+	},
+	"fr": {
+		days:   [7]string{"dim.", "lun.", "mar.", "mer.", "jeu.", "ven.", "sam."},
+		months: [12]string{"janv.", "févr.", "mars", "avr.", "mai", "juin", "juil.", "août", "sept.", "oct.", "nov.", "déc."},
+		date:   "%a 2 %b 2006 15:04:05 MST",
+		time:   "15:04:05",
+	},
+	"it": {
+		days:   [7]string{"dom", "lun", "mar", "mer", "gio", "ven", "sab"},
+		months: [12]string{"gen", "feb", "mar", "apr", "mag", "giu", "lug", "ago", "set", "ott", "nov", "dic"},
+		date:   "%a 2 %b 2006 15:04:05 MST",
+		time:   "15:04:05",
+	},
+	"nl": {
+		days:   [7]string{"zo", "ma", "di", "wo", "do", "vr", "za"},
+		months: [12]string{"jan", "feb", "mrt", "apr", "mei", "jun", "jul", "aug", "sep", "okt", "nov", "dec"},
+		date:   "%a 2 %b 2006 15:04:05 MST",
+		time:   "15:04:05",
+	},
+	"pt": {
+		days:   [7]string{"dom", "seg", "ter", "qua", "qui", "sex", "sáb"},
+		months: [12]string{"jan", "fev", "mar", "abr", "mai", "jun", "jul", "ago", "set", "out", "nov", "dez"},
+		date:   "%a, 2 de %b de 2006 15:04:05 MST",
+		time:   "15:04:05",
+	},
+}
+
+// parseAcceptLanguage returns the languages of an Accept-Language header
+// (in lower case), most preferred first
+func parseAcceptLanguage(header string) []string {
+	type weighted struct {
+		tag string
+		q   float64
+	}
+
+	var tags []weighted
+	for _, part := range strings.Split(header, ",") {
+		tag, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		if tag == "" {
+			continue
+		}
+		q := 1.0
+		if v, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			var err error
+			if q, err = strconv.ParseFloat(v, 64); err != nil {
+				continue
+			}
+		}
+		if q > 0 {
+			tags = append(tags, weighted{tag, q})
+		}
+	}
+	sort.SliceStable(tags, func(i, j int) bool { return tags[i].q > tags[j].q })
+
+	languages := make([]string, len(tags))
+	for i, tag := range tags {
+		languages[i] = tag.tag
+	}
+	return languages
+}
+
+// matchLanguage returns the first supported language of the (most
+// preferred first) languages, e.g: de for de-CH, or the default language
+func matchLanguage(languages ...string) string {
+	for _, language := range languages {
+		base, _, _ := strings.Cut(strings.ToLower(language), "-")
+		if _, ok := locales[base]; ok {
+			return base
+		}
+	}
+	return DefaultLanguage
+}
+
+// CommandContext is what commands know of the request they answer besides
+// its arguments: who made it, and the language and time zone (if any) to
+// answer in
+type CommandContext struct {
+	User     string
+	Language string
+	Location *time.Location
+}
+
+// NewCommandContext returns the context of a request: its language is the
+// lang parameter (e.g: /?q=date&lang=de) or else the most preferred
+// supported language of Accept-Language, and its time zone the tz
+// parameter (e.g: Europe/Berlin) if any
+func NewCommandContext(r *http.Request) CommandContext {
+	ctx := CommandContext{
+		User:     RequestUser(r),
+		Language: DefaultLanguage,
+	}
+	if r == nil {
+		return ctx
+	}
+
+	if lang := queryParam(r.URL.RawQuery, "lang"); lang != "" {
+		ctx.Language = matchLanguage(lang)
+	} else {
+		ctx.Language = matchLanguage(parseAcceptLanguage(r.Header.Get("Accept-Language"))...)
+	}
+	if tz := queryParam(r.URL.RawQuery, "tz"); tz != "" {
+		if location, err := time.LoadLocation(tz); err == nil {
+			ctx.Location = location
+		}
+	}
+	return ctx
+}
+
+// RequestCommandContext returns the context commands execute a request in
+// (see NewCommandContext)
+func RequestCommandContext(r *http.Request) CommandContext {
+	if r != nil {
+		if ctx, ok := r.Context().Value(commandContextKey).(CommandContext); ok {
+			return ctx
+		}
+	}
+	return NewCommandContext(r)
+}
+
+// withCommandContext returns the request with its command context
+func withCommandContext(r *http.Request) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), commandContextKey, NewCommandContext(r)))
+}
+
+// FormatDate formats t as a date and time in the language and time zone,
+// or GMT (e.g: Mon, 02 Jan 2006 15:04:05 GMT in English)
+func (ctx CommandContext) FormatDate(t time.Time) string {
+	l, location := locales[ctx.Language], ctx.Location
+	if location == nil {
+		location = gmt
+	}
+	return l.format(t.In(location), l.date)
+}
+
+// FormatTime formats t as a time of day in the language and time zone, or
+// the server's
+func (ctx CommandContext) FormatTime(t time.Time) string {
+	l, location := locales[ctx.Language], ctx.Location
+	if location == nil {
+		location = time.Local
+	}
+	return l.format(t.In(location), l.time)
+}
+
+// writeLocalized writes the output of a command in the language of its
+// context, so caches keep the output of each language apart
+func writeLocalized(w http.ResponseWriter, ctx CommandContext, output string) {
+	w.Header().Set("Content-Language", ctx.Language)
+	w.Header().Add("Vary", "Accept-Language")
+	w.Write([]byte(output))
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseAcceptLanguage(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.Equal([]string{"fr-ch", "fr", "en", "de"}, parseAcceptLanguage("fr-CH, fr;q=0.9, en;q=0.8, de;q=0.7, *;q=0"))
+	assert.Equal([]string{"de", "en"}, parseAcceptLanguage("en;q=0.5,de"))
+	assert.Equal([]string{}, parseAcceptLanguage(""))
+
+	assert.Equal("fr", matchLanguage("fr-CH", "fr"))
+	assert.Equal("de", matchLanguage("tlh", "de-AT"))
+	assert.Equal(DefaultLanguage, matchLanguage("tlh"))
+	assert.Equal(DefaultLanguage, matchLanguage())
+}
+
+func TestCommandContext(t *testing.T) {
+	assert := assert.New(t)
+
+	ts := time.Date(2024, time.March, 5, 13, 4, 5, 0, time.UTC)
+
+	r, _ := http.NewRequest("GET", "/?q=date", nil)
+	ctx := RequestCommandContext(r)
+	assert.Equal("en", ctx.Language)
+	assert.Equal("Tue, 05 Mar 2024 13:04:05 GMT", ctx.FormatDate(ts))
+	assert.Equal(ts.Format(http.TimeFormat), ctx.FormatDate(ts))
+
+	r.Header.Set("Accept-Language", "de-CH,de;q=0.9,en;q=0.8")
+	ctx = RequestCommandContext(r)
+	assert.Equal("de", ctx.Language)
+	assert.Equal("Di, 5. Mär 2024 13:04:05 GMT", ctx.FormatDate(ts))
+
+	// The parameters win over the browser's language
+	r, _ = http.NewRequest("GET", "/?q=date&lang=fr&tz=Europe/Paris", nil)
+	r.Header.Set("Accept-Language", "de")
+	ctx = RequestCommandContext(r)
+	assert.Equal("fr", ctx.Language)
+	assert.Equal("mar. 5 mars 2024 14:04:05 CET", ctx.FormatDate(ts))
+	assert.Equal("14:04:05", ctx.FormatTime(ts))
+
+	r, _ = http.NewRequest("GET", "/?q=time&tz=Nowhere/Special", nil)
+	ctx = RequestCommandContext(r)
+	assert.Nil(ctx.Location)
+}
+
+func TestDateCommandLocalized(t *testing.T) {
+	assert := assert.New(t)
+
+	w := httptest.NewRecorder()
+	r, _ := http.NewRequest("GET", "?q=date&lang=pt-BR", nil)
+	assert.NoError(Date{}.Exec(w, withCommandContext(r), nil))
+
+	assert.Equal("pt", w.Header().Get("Content-Language"))
+	assert.Equal("Accept-Language", w.Header().Get("Vary"))
+	assert.Contains(w.Body.String(), " de ")
+	assert.Contains(w.Body.String(), "GMT")
+}
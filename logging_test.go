@@ -0,0 +1,92 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"log"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewLogger(t *testing.T) {
+	assert := assert.New(t)
+
+	var buf bytes.Buffer
+	logger, err := NewLogger(&buf, LogFormatJSON, "warn")
+	assert.NoError(err)
+	logger.Info("hidden")
+	logger.Warn("shown", "name", "gh")
+
+	var record map[string]interface{}
+	assert.NoError(json.Unmarshal(buf.Bytes(), &record))
+	assert.Equal("WARN", record["level"])
+	assert.Equal("shown", record["msg"])
+	assert.Equal("gh", record["name"])
+
+	buf.Reset()
+	logger, err = NewLogger(&buf, LogFormatText, "debug")
+	assert.NoError(err)
+	logger.Debug("shown", "name", "gh")
+	assert.Contains(buf.String(), "level=DEBUG msg=shown name=gh")
+
+	_, err = NewLogger(&buf, "xml", "info")
+	assert.Error(err)
+	_, err = NewLogger(&buf, LogFormatText, "loud")
+	assert.Error(err)
+}
+
+func TestAccessLog(t *testing.T) {
+	assert := assert.New(t)
+
+	var buf bytes.Buffer
+	logger, err := NewLogger(&buf, LogFormatJSON, "info")
+	assert.NoError(err)
+	// Setting the default redirects the log package which must be restored
+	defer func(l *slog.Logger, w io.Writer, flags int) {
+		slog.SetDefault(l)
+		log.SetOutput(w)
+		log.SetFlags(flags)
+	}(slog.Default(), log.Writer(), log.Flags())
+	slog.SetDefault(logger)
+
+	handler := AccessLog(nil, RequestIDs(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/oops" {
+			http.Error(w, "oops", http.StatusInternalServerError)
+			return
+		}
+		w.Write([]byte("ok"))
+	})))
+
+	r, _ := http.NewRequest("GET", "/list?q=1", nil)
+	r.RemoteAddr = "10.0.0.1:1234"
+	r.Header.Set(RequestIDHeader, "abc123")
+	handler.ServeHTTP(httptest.NewRecorder(), r)
+
+	var record map[string]interface{}
+	assert.NoError(json.Unmarshal(buf.Bytes(), &record))
+	assert.Equal("INFO", record["level"])
+	assert.Equal("request", record["msg"])
+	assert.Equal("GET", record["method"])
+	assert.Equal("/list", record["path"])
+	assert.Equal(float64(http.StatusOK), record["status"])
+	assert.Equal("10.0.0.1", record["remote_ip"])
+	assert.Equal("abc123", record["request_id"])
+	assert.Contains(record, "latency")
+
+	buf.Reset()
+	r, _ = http.NewRequest("POST", "/oops", nil)
+	r.RemoteAddr = "10.0.0.1:1234"
+	r.Header.Set("X-Forwarded-For", "192.168.1.2, 10.0.0.1")
+	handler.ServeHTTP(httptest.NewRecorder(), r)
+
+	record = nil
+	assert.NoError(json.Unmarshal(buf.Bytes(), &record))
+	assert.Equal("ERROR", record["level"])
+	assert.Equal(float64(http.StatusInternalServerError), record["status"])
+	assert.Equal("192.168.1.2", record["remote_ip"])
+}
@@ -2,74 +2,747 @@ package main
 
 import (
 	"fmt"
-	"log"
+	"log/slog"
 	"os"
+	"strings"
+	"time"
 
 	"github.com/namsral/flag"
-	"github.com/prologic/bitcask"
 )
 
 var (
-	db  *bitcask.Bitcask
+	db  Store
 	cfg Config
 )
 
+var usage = `usage: golinks [command] [options]
+
+commands:
+  serve          run the server (the default if no command is given)
+  add            add a bookmark to the database
+  rm             remove bookmarks from the database
+  list           list the bookmarks in the database
+  dump           dump the database to stdout
+  load           load a dump into the database
+  migrate        copy a database to another store
+  export-site    write the catalog as a static HTML site
+  tokens         manage API tokens
+  bangs          import DuckDuckGo bangs
+  client         manage a running server via its REST API
+  verify-assets  check the embedded templates and assets
+  help           show this help
+
+Run golinks <command> -h for the options of a command.`
+
+// Subcommands are the names of the subcommands of golinks
+var Subcommands = []string{
+	"serve", "add", "rm", "list", "dump", "load", "migrate",
+	"export-site", "tokens", "bangs", "client", "verify-assets", "help",
+}
+
+// subcommand returns the subcommand with the given name (or nil)
+func subcommand(name string) func(args []string) error {
+	switch name {
+	case "serve":
+		return runServe
+	case "add":
+		return runAdd
+	case "rm":
+		return runRm
+	case "list":
+		return runList
+	case "migrate":
+		return runMigrate
+	case "dump":
+		return runDump
+	case "load":
+		return runLoad
+	case "export-site":
+		return runExportSite
+	case "bangs":
+		return runBangs
+	case "tokens":
+		return runTokens
+	case "client":
+		return runClient
+	case "verify-assets":
+		return runVerifyAssets
+	case "help":
+		return func([]string) error {
+			fmt.Println(usage)
+			return nil
+		}
+	}
+	return nil
+}
+
 func main() {
+	// Flags without a command run the server as before subcommands existed
+	args := os.Args[1:]
+	run := runServe
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		if run = subcommand(args[0]); run == nil {
+			fmt.Fprintln(os.Stderr, usage)
+			os.Exit(2)
+		}
+		args = args[1:]
+	}
+
+	if err := run(args); err != nil {
+		fatal(err.Error())
+	}
+}
+
+// runServe runs the server until it is shut down
+func runServe(args []string) error {
 	var (
 		version    bool
+		readonly   bool
+		offline    bool
+		history    bool
+		learn      int
 		config     string
+		profile    string
 		dbpath     string
 		title      string
 		fqdn       string
 		bind       string
 		url        string
 		suggestURL string
+		assetsDir  string
+
+		suggestMaxBytes int64
+		dictionary      string
+
+		encryptionKeyFile string
+
+		backupURL       string
+		backupAccessKey string
+		backupSecretKey string
+		backupInterval  time.Duration
+		backupRetain    int
+		restoreFrom     string
+
+		importBookmarks string
+		importRules     string
+		bookmarksFile   string
+
+		bookmarksURL      string
+		bookmarksInterval time.Duration
+
+		defaults         string
+		defaultsInterval time.Duration
+
+		peers       string
+		peerTimeout time.Duration
+		catalog     string
+		catalogTTL  time.Duration
+
+		eventBus       string
+		eventBusPrefix string
+
+		metricsExport         string
+		metricsExportInterval time.Duration
+		metricsTopN           int
+
+		webhooks      string
+		webhookSecret string
+		webhookHits   bool
+
+		raindropToken      string
+		raindropCollection int64
+		raindropInterval   time.Duration
+
+		xbrowsersyncURL      string
+		xbrowsersyncID       string
+		xbrowsersyncPassword string
+		browserNamespace     string
+		browserSyncInterval  time.Duration
+
+		readLater         string
+		readLaterURL      string
+		readLaterKey      string
+		readLaterUser     string
+		readLaterPassword string
+
+		telegramToken string
+		matrixURL     string
+		matrixToken   string
+		botUsers      string
+
+		gitRepo     string
+		gitBranch   string
+		gitPath     string
+		gitInterval time.Duration
+
+		replicateTo       string
+		replicationSecret string
+
+		authUser string
+		authPass string
+		authFile string
+
+		oidcIssuer       string
+		oidcClientID     string
+		oidcClientSecret string
+		oidcRedirectURL  string
+		oidcDomains      string
+
+		githubClientID     string
+		githubClientSecret string
+		githubRedirectURL  string
+		githubOrgs         string
+
+		sessionSecret string
+		sessionTTL    time.Duration
+
+		authHeader  string
+		authProxies string
+
+		allowIPs  string
+		denyIPs   string
+		ipProxies string
+
+		multiUser bool
+		teams     string
+
+		emailSecret  string
+		emailSenders string
+
+		publishTag         string
+		publicCacheControl string
+
+		frameAncestors string
+
+		fqdnCheckInterval time.Duration
+		linkCheckInterval time.Duration
+		linkRotAfter      time.Duration
+		fetchConcurrency  int
+		maxConcurrent     int
+		rateLimit         int
+		rateLimitBurst    int
+		fetchHostDelay    time.Duration
+		mergeInterval     time.Duration
+
+		grpcBind string
+
+		tlsCert string
+		tlsKey  string
+
+		fallbackStatus       int
+		fallbackCacheControl string
+
+		writeFailureThreshold int
+		writeFailureBackoff   time.Duration
+
+		rollupInterval   time.Duration
+		historyRetention time.Duration
+		historyTrashTTL  time.Duration
+
+		selfTest bool
+
+		logFormat string
+		logLevel  string
+
+		accessLog           string
+		accessLogMaxSize    int64
+		accessLogRotate     time.Duration
+		accessLogMaxBackups int
+		accessLogCompress   bool
 	)
 
 	flag.BoolVar(&version, "v", false, "display version information")
+	flag.BoolVar(&readonly, "readonly", false,
+		"serve from the database but reject any modifications")
+
+	flag.BoolVar(&offline, "offline", false,
+		"disable all outbound requests (e.g: for air-gapped networks)")
+
+	flag.BoolVar(&history, "history", true,
+		"record the history of queries and serve it at /history")
+
+	flag.IntVar(&learn, "learn-aliases", 0,
+		"learn a misspelling of a bookmark as an alias after typing it this many times (0 to disable)")
+
+	flag.BoolVar(&selfTest, "self-test", true,
+		"load bookmarks, resolve a few and render every page before listening (exits on failure)")
+
+	flag.StringVar(&logFormat, "log-format", LogFormatText,
+		"format of the logs: text (logfmt) or json")
+	flag.StringVar(&logLevel, "log-level", "info",
+		"minimum level of the logs: debug, info, warn or error")
+
+	flag.StringVar(&accessLog, "accesslog", "",
+		"file to log requests to instead of the logs (e.g: /var/log/golinks/access.log)")
+	flag.Int64Var(&accessLogMaxSize, "accesslog-max-size", 100<<20,
+		"rotate the access log once larger than this many bytes (0 to disable)")
+	flag.DurationVar(&accessLogRotate, "accesslog-rotate", 24*time.Hour,
+		"rotate the access log at the start of every interval (0 to disable)")
+	flag.IntVar(&accessLogMaxBackups, "accesslog-max-backups", 7,
+		"number of rotated access logs to keep (0 keeps all)")
+	flag.BoolVar(&accessLogCompress, "accesslog-compress", true,
+		"gzip rotated access logs")
+
+	flag.DurationVar(&rollupInterval, "rollup-interval", time.Hour,
+		"interval to roll up the history into daily usage (0 to disable)")
+	flag.DurationVar(&historyRetention, "history-retention", 0,
+		"delete history older than this once rolled up into daily usage (0 keeps all)")
+	flag.DurationVar(&historyTrashTTL, "history-trash-ttl", DefaultHistoryTrashTTL,
+		"how long cleared history can be restored for")
 
 	flag.StringVar(&config, "config", "", "config file")
-	flag.StringVar(&dbpath, "dbpath", "search.db", "database path")
+	flag.StringVar(&profile, "profile", "", "config file profile to use (e.g: dev, staging, prod)")
+	flag.StringVar(&dbpath, "dbpath", "search.db", "database path or uri (e.g: bitcask://search.db)")
+	flag.StringVar(&encryptionKeyFile, "encryption-key-file", "",
+		"file containing a 32 byte key to encrypt stored values with")
+	flag.DurationVar(&mergeInterval, "merge-interval", 24*time.Hour,
+		"interval to merge/compact the database (0 to disable)")
+	flag.StringVar(&backupURL, "backup-url", "",
+		"s3 compatible url to upload backups to (e.g: s3://s3.amazonaws.com/bucket/prefix)")
+	flag.StringVar(&backupAccessKey, "backup-access-key", "", "access key for backup storage")
+	flag.StringVar(&backupSecretKey, "backup-secret-key", "", "secret key for backup storage")
+	flag.DurationVar(&backupInterval, "backup-interval", 24*time.Hour,
+		"interval to backup the database (0 to disable)")
+	flag.IntVar(&backupRetain, "backup-retain", 7, "number of backups to keep (0 keeps all)")
+	flag.StringVar(&restoreFrom, "restore-from", "",
+		"restore the database on startup from a snapshot file or backup (or latest)")
+	flag.StringVar(&bookmarksFile, "bookmarks-file", "",
+		"YAML manifest of bookmarks to sync on startup and SIGHUP")
+	flag.StringVar(&defaults, "defaults", "",
+		"url (or file) of a YAML catalog of default bookmarks to apply periodically")
+	flag.DurationVar(&defaultsInterval, "defaults-interval", time.Hour,
+		"interval to check the defaults catalog for changes (0 to disable)")
+	flag.StringVar(&peers, "peers", "",
+		"comma separated urls of instances to resolve names not found locally from")
+	flag.DurationVar(&peerTimeout, "peer-timeout", DefaultPeerTimeout,
+		"time each peer (and the catalog) has to resolve a name")
+	flag.StringVar(&catalog, "catalog", "",
+		"url of a read-only instance to resolve names not found locally or by peers from")
+	flag.DurationVar(&catalogTTL, "catalog-ttl", DefaultCatalogTTL,
+		"how long names resolved from the catalog (or not found in it) are cached for")
+	flag.StringVar(&eventBus, "event-bus", "",
+		"URL of a NATS (nats://) or MQTT (mqtt://) server to publish events to")
+	flag.StringVar(&eventBusPrefix, "event-bus-prefix", DefaultEventBusPrefix,
+		"prefix of the subjects (or topics) events are published to")
+	flag.StringVar(&metricsExport, "metrics-export", "",
+		"URL of a StatsD server (statsd://) or InfluxDB database (influx://host:8086/db) to flush metrics to")
+	flag.DurationVar(&metricsExportInterval, "metrics-export-interval", DefaultMetricsExportInterval,
+		"interval to flush metrics to StatsD or InfluxDB")
+	flag.IntVar(&metricsTopN, "metrics-top-n", 0,
+		"label the metrics of only the N most used bookmarks and commands by name, summing the rest (0 for all, -1 for none)")
+	flag.StringVar(&webhooks, "webhooks", "",
+		"comma separated urls to POST bookmark events to")
+	flag.StringVar(&webhookSecret, "webhook-secret", "",
+		"secret to sign webhook requests with (HMAC-SHA256)")
+	flag.BoolVar(&webhookHits, "webhook-hits", false,
+		"also POST an event to the webhooks for every redirect")
+	flag.StringVar(&raindropToken, "raindrop-token", "",
+		"Raindrop.io API token to sync bookmarks with a Raindrop collection")
+	flag.Int64Var(&raindropCollection, "raindrop-collection", -1,
+		"id of the Raindrop collection to sync with (default: Unsorted)")
+	flag.DurationVar(&raindropInterval, "raindrop-interval", 15*time.Minute,
+		"interval to sync with Raindrop.io (0 to disable)")
+	flag.StringVar(&xbrowsersyncURL, "xbrowsersync-url", XBrowserSyncURL,
+		"URL of the xBrowserSync service to pull bookmarks from")
+	flag.StringVar(&xbrowsersyncID, "xbrowsersync-id", "",
+		"xBrowserSync sync id to pull bookmarks from")
+	flag.StringVar(&xbrowsersyncPassword, "xbrowsersync-password", "",
+		"password to decrypt the xBrowserSync bookmarks with")
+	flag.StringVar(&browserNamespace, "browser-namespace", DefaultBrowserNamespace,
+		"namespace (name prefix) to pull browser bookmarks into")
+	flag.DurationVar(&browserSyncInterval, "browser-sync-interval", 15*time.Minute,
+		"interval to pull browser bookmarks (0 to disable)")
+	flag.StringVar(&readLater, "read-later", "",
+		"read-later service to save pages to with the save command (pocket, instapaper or wallabag)")
+	flag.StringVar(&readLaterURL, "read-later-url", "",
+		"URL of the Wallabag instance (or API) to save pages to")
+	flag.StringVar(&readLaterKey, "read-later-key", "",
+		"Pocket <consumer key>:<access token> or Wallabag <client id>:<client secret>")
+	flag.StringVar(&readLaterUser, "read-later-user", "",
+		"Instapaper or Wallabag username")
+	flag.StringVar(&readLaterPassword, "read-later-password", "",
+		"Instapaper or Wallabag password")
+	flag.StringVar(&telegramToken, "telegram-token", "",
+		"Telegram bot token to answer go <name> messages with")
+	flag.StringVar(&matrixURL, "matrix-url", "",
+		"URL of the Matrix homeserver to answer go <name> messages on")
+	flag.StringVar(&matrixToken, "matrix-token", "",
+		"access token of the Matrix bot user")
+	flag.StringVar(&botUsers, "bot-users", "",
+		"chat users allowed to add and remove bookmarks through the bots, e.g: alice=write,@bob:example.org=write")
+	flag.StringVar(&gitRepo, "git-repo", "",
+		"git repository containing a YAML manifest of bookmarks to sync periodically")
+	flag.StringVar(&gitBranch, "git-branch", "", "git branch to sync (default: the remote's HEAD)")
+	flag.StringVar(&gitPath, "git-path", DefaultGitPath, "path of the bookmarks manifest in the git repository")
+	flag.DurationVar(&gitInterval, "git-interval", 5*time.Minute,
+		"interval to pull the git repository for changes (0 to disable)")
+	flag.StringVar(&bookmarksURL, "bookmarks-url", "",
+		"url of a YAML manifest of bookmarks to mirror periodically")
+	flag.DurationVar(&bookmarksInterval, "bookmarks-interval", 15*time.Minute,
+		"interval to refresh the bookmarks manifest from -bookmarks-url (0 to disable)")
+	flag.StringVar(&importBookmarks, "import-bookmarks", "",
+		"import bookmarks on startup from a browser's bookmarks export, Pinboard's JSON export or a CSV file")
+	flag.StringVar(&importRules, "import-rules", "",
+		"mapping rules (JSON) applied to -import-bookmarks (folder tags, title transforms, on_conflict)")
+	flag.StringVar(&replicateTo, "replicate-to", "",
+		"URL of a standby instance to replicate all writes to (with -replication-secret)")
+	flag.StringVar(&emailSecret, "email-secret", "",
+		"secret inbound emails (or email service requests) to /inbound/email are signed with")
+	flag.StringVar(&emailSenders, "email-senders", "",
+		"comma separated list of email addresses allowed to create bookmarks by email (default: any)")
+	flag.StringVar(&publishTag, "publish-tag", "",
+		"publish bookmarks with this tag as an RSS feed (/links.rss), ActivityStreams outbox (/outbox) and public API (/api/public/v1/bookmarks)")
+	flag.StringVar(&publicCacheControl, "public-cache-control", DefaultPublicCacheControl,
+		"Cache-Control header of the public API (/api/public/v1/bookmarks, empty for none)")
+	flag.StringVar(&frameAncestors, "frame-ancestors", "",
+		"space or comma separated list of origins allowed to embed the widgets (/widgets/*) in frames, e.g: https://grafana.example.com")
+	flag.StringVar(&replicationSecret, "replication-secret", "",
+		"shared secret used to send (primary) or accept (standby) replicated writes")
+	flag.StringVar(&authUser, "auth-user", "",
+		"user required to access golinks with HTTP Basic auth (with -auth-pass)")
+	flag.StringVar(&authPass, "auth-pass", "",
+		"password of -auth-user")
+	flag.StringVar(&authFile, "auth-file", "",
+		"htpasswd file (bcrypt or SHA-1) of the users allowed to access golinks with HTTP Basic auth")
+	flag.StringVar(&oidcIssuer, "oidc-issuer", "",
+		"URL of the OpenID Connect provider users must log in with, e.g: https://accounts.google.com")
+	flag.StringVar(&oidcClientID, "oidc-client-id", "",
+		"client id of golinks at the OpenID Connect provider")
+	flag.StringVar(&oidcClientSecret, "oidc-client-secret", "",
+		"client secret of golinks at the OpenID Connect provider")
+	flag.StringVar(&oidcRedirectURL, "oidc-redirect-url", "",
+		"URL the provider redirects users back to (default: /auth/callback on the host users go to)")
+	flag.StringVar(&oidcDomains, "oidc-domains", "",
+		"comma separated email domains allowed to log in with OpenID Connect (default: any)")
+	flag.StringVar(&githubClientID, "github-client-id", "",
+		"client id of golinks' GitHub OAuth app, so only members of -github-orgs can add or edit bookmarks")
+	flag.StringVar(&githubClientSecret, "github-client-secret", "",
+		"client secret of golinks' GitHub OAuth app")
+	flag.StringVar(&githubRedirectURL, "github-redirect-url", "",
+		"URL GitHub redirects users back to (default: /auth/github/callback on the host users go to)")
+	flag.StringVar(&githubOrgs, "github-orgs", "",
+		"comma separated GitHub orgs or org/team whose members can add or edit bookmarks")
+	flag.StringVar(&sessionSecret, "session-secret", "",
+		"secret session cookies are signed with (default: the OpenID Connect or GitHub client secret, else random)")
+	flag.DurationVar(&sessionTTL, "session-ttl", 0,
+		"how long users stay logged in for (default: 168h, or 24h with GitHub login)")
+	flag.StringVar(&authHeader, "auth-header", "",
+		"header a reverse proxy authenticating users sets to their user, e.g: X-Forwarded-User")
+	flag.StringVar(&authProxies, "auth-proxies", "",
+		"comma separated ips or CIDRs of the proxies trusted to set -auth-header (default: 127.0.0.0/8,::1)")
+	flag.StringVar(&allowIPs, "allow-ips", "",
+		"comma separated ips or CIDRs of the only clients let in, e.g: 192.168.0.0/16,10.8.0.0/24 (default: any)")
+	flag.StringVar(&denyIPs, "deny-ips", "",
+		"comma separated ips or CIDRs of clients kept out, even if in -allow-ips")
+	flag.StringVar(&ipProxies, "ip-proxies", "",
+		"comma separated ips or CIDRs of the proxies trusted to set X-Forwarded-For for -allow-ips, -deny-ips and -rate-limit")
+	flag.BoolVar(&multiUser, "multi-user", false,
+		"give logged in users personal bookmarks (~name) looked up before their teams' and the global ones")
+	flag.StringVar(&teams, "teams", "",
+		"comma separated users and the team they are a member of with -multi-user, e.g: alice=infra,bob=infra,bob=web")
 	flag.StringVar(&title, "title", "Search", "OpenSearch title")
 	flag.StringVar(&bind, "bind", "0.0.0.0:8000", "[int]:<port> to bind to")
+	flag.StringVar(&tlsCert, "tls-cert", "",
+		"PEM file of the certificate (chain) to serve HTTPS with (with -tls-key)")
+	flag.StringVar(&tlsKey, "tls-key", "",
+		"PEM file of the private key of -tls-cert")
+	flag.StringVar(&grpcBind, "grpc-bind", "",
+		"[int]:<port> to serve the gRPC API on (disabled if empty)")
 	flag.StringVar(&fqdn, "fqdn", "localhost:8000", "FQDN for public access")
+	flag.DurationVar(&fqdnCheckInterval, "fqdn-check-interval", 10*time.Minute,
+		"interval to verify the FQDN points at this instance (0 to disable)")
+	flag.DurationVar(&linkCheckInterval, "link-check-interval", 0,
+		"interval to check all bookmarks for broken links (0 to disable)")
+	flag.DurationVar(&linkRotAfter, "link-rot-after", DefaultLinkRotAfter,
+		"how long a link must stay broken before offering its archived copy (0 to never look up archived copies)")
+	flag.IntVar(&fetchConcurrency, "fetch-concurrency", DefaultFetchConcurrency,
+		"maximum number of concurrent background fetches (e.g: link checks)")
+	flag.DurationVar(&fetchHostDelay, "fetch-host-delay", DefaultFetchHostDelay,
+		"minimum delay between background fetches from the same host")
+	flag.IntVar(&maxConcurrent, "max-concurrent", 0,
+		"concurrent requests beyond which suggestions and analytics are shed with a 503 (0 to never shed)")
+	flag.IntVar(&rateLimit, "rate-limit", 0,
+		"queries and suggestions allowed per client ip a minute (0 for no limit)")
+	flag.IntVar(&rateLimitBurst, "rate-limit-burst", 0,
+		"queries and suggestions a client ip can make at once (0 for the rate limit)")
+	flag.IntVar(&writeFailureThreshold, "write-failure-threshold", DefaultWriteFailureThreshold,
+		"consecutive failed history writes after which they are suspended (0 to never suspend)")
+	flag.DurationVar(&writeFailureBackoff, "write-failure-backoff", DefaultWriteFailureBackoff,
+		"how long to suspend history writes for after too many failures")
 	flag.StringVar(&url, "url", DefaultURL, "default URL to redirect to")
+	flag.IntVar(&fallbackStatus, "fallback-status", DefaultFallbackStatus,
+		"status of redirects to the default URL (301, 302, 303, 307 or 308)")
+	flag.StringVar(&fallbackCacheControl, "fallback-cache-control", DefaultFallbackCacheControl,
+		"Cache-Control header of redirects to the default URL (empty for none)")
 	flag.StringVar(&suggestURL, "suggest", DefaultSuggestURL,
 		"default URL to retrieve search suggestions from")
+	flag.Int64Var(&suggestMaxBytes, "suggest-max-bytes", DefaultSuggestMaxBytes,
+		"maximum size of upstream search suggestion responses")
+	flag.StringVar(&dictionary, "dictionary", "",
+		"word list for offline search suggestions (builtin or a file)")
+	flag.StringVar(&assetsDir, "assets", "",
+		"directory of static assets (e.g: favicon.ico) overriding the built-in ones")
+
+	// The config file is parsed below to support profiles
+	flag.DefaultConfigFlagname = ""
+	if err := flag.CommandLine.Parse(args); err != nil {
+		return err
+	}
 
-	flag.Parse()
+	if config != "" {
+		if err := ParseConfigFile(flag.CommandLine, config, profile); err != nil {
+			fatal("error parsing config file", "err", err)
+		}
+	} else if profile != "" {
+		fatal("-profile requires a config file (-config)")
+	}
+
+	if err := SetupLogging(logFormat, logLevel); err != nil {
+		return err
+	}
 
 	if version {
 		fmt.Println(FullVersion())
-		os.Exit(0)
+		return nil
 	}
 
 	cfg.Title = title
 	cfg.FQDN = fqdn
+	cfg.GRPCBind = grpcBind
+	cfg.TLSCert = tlsCert
+	cfg.TLSKey = tlsKey
 	cfg.URL = url
 	cfg.SuggestURL = suggestURL
+	cfg.FallbackStatus = fallbackStatus
+	cfg.FallbackCacheControl = fallbackCacheControl
+	cfg.SuggestMaxBytes = suggestMaxBytes
+	cfg.Dictionary = dictionary
+	cfg.DBPath = dbpath
+	cfg.AssetsDir = assetsDir
+	cfg.ReadOnly = readonly
+	cfg.Offline = offline
+	cfg.DisableHistory = !history
+	cfg.RollupInterval = rollupInterval
+	cfg.HistoryRetention = historyRetention
+	cfg.HistoryTrashTTL = historyTrashTTL
+	cfg.LearnAliases = learn
+	cfg.BookmarksFile = bookmarksFile
+	cfg.BookmarksURL = bookmarksURL
+	cfg.BookmarksInterval = bookmarksInterval
+	cfg.Defaults = defaults
+	cfg.DefaultsInterval = defaultsInterval
+	cfg.PeerTimeout = peerTimeout
+	cfg.CatalogTTL = catalogTTL
+	cfg.EventBus = eventBus
+	cfg.EventBusPrefix = eventBusPrefix
+	cfg.MetricsExport = metricsExport
+	cfg.MetricsExportInterval = metricsExportInterval
+	cfg.MetricsTopN = metricsTopN
+	cfg.WebhookSecret = webhookSecret
+	cfg.WebhookHits = webhookHits
+	cfg.RaindropToken = raindropToken
+	cfg.RaindropCollection = raindropCollection
+	cfg.RaindropInterval = raindropInterval
+	cfg.XBrowserSyncURL = xbrowsersyncURL
+	cfg.XBrowserSyncID = xbrowsersyncID
+	cfg.XBrowserSyncPassword = xbrowsersyncPassword
+	cfg.BrowserNamespace = browserNamespace
+	cfg.BrowserSyncInterval = browserSyncInterval
+	cfg.ReadLater = readLater
+	cfg.ReadLaterURL = readLaterURL
+	cfg.ReadLaterKey = readLaterKey
+	cfg.ReadLaterUser = readLaterUser
+	cfg.ReadLaterPassword = readLaterPassword
+	cfg.TelegramToken = telegramToken
+	cfg.MatrixURL = matrixURL
+	cfg.MatrixToken = matrixToken
+	cfg.BotUsers = botUsers
+	cfg.GitRepo = gitRepo
+	cfg.GitBranch = gitBranch
+	cfg.GitPath = gitPath
+	cfg.GitInterval = gitInterval
+	cfg.FQDNCheckInterval = fqdnCheckInterval
+	cfg.LinkCheckInterval = linkCheckInterval
+	cfg.LinkRotAfter = linkRotAfter
+	cfg.FetchConcurrency = fetchConcurrency
+	cfg.MaxConcurrent = maxConcurrent
+	cfg.RateLimit = rateLimit
+	cfg.RateLimitBurst = rateLimitBurst
+	cfg.FetchHostDelay = fetchHostDelay
+	cfg.MergeInterval = mergeInterval
+	cfg.WriteFailureThreshold = writeFailureThreshold
+	cfg.WriteFailureBackoff = writeFailureBackoff
+	cfg.BackupURL = backupURL
+	cfg.BackupAccessKey = backupAccessKey
+	cfg.BackupSecretKey = backupSecretKey
+	cfg.BackupInterval = backupInterval
+	cfg.BackupRetain = backupRetain
+	cfg.ReplicateTo = replicateTo
+	cfg.ReplicationSecret = replicationSecret
+	cfg.AuthUser = authUser
+	cfg.AuthPass = authPass
+	cfg.AuthFile = authFile
+	cfg.OIDCIssuer = oidcIssuer
+	cfg.OIDCClientID = oidcClientID
+	cfg.OIDCClientSecret = oidcClientSecret
+	cfg.OIDCRedirectURL = oidcRedirectURL
+	cfg.OIDCDomains = oidcDomains
+	cfg.GitHubClientID = githubClientID
+	cfg.GitHubClientSecret = githubClientSecret
+	cfg.GitHubRedirectURL = githubRedirectURL
+	cfg.GitHubOrgs = githubOrgs
+	cfg.SessionSecret = sessionSecret
+	cfg.SessionTTL = sessionTTL
+	cfg.AuthHeader = authHeader
+	cfg.AuthProxies = authProxies
+	cfg.AllowIPs = allowIPs
+	cfg.DenyIPs = denyIPs
+	cfg.IPProxies = ipProxies
+	cfg.MultiUser = multiUser
+	cfg.Teams = teams
+	cfg.EmailSecret = emailSecret
+	cfg.EmailSenders = emailSenders
+	cfg.PublishTag = publishTag
+	cfg.PublicCacheControl = publicCacheControl
+	cfg.FrameAncestors = frameAncestors
+	cfg.LogFormat = logFormat
+	cfg.AccessLog = accessLog
+	cfg.AccessLogMaxSize = accessLogMaxSize
+	cfg.AccessLogRotate = accessLogRotate
+	cfg.AccessLogMaxBackups = accessLogMaxBackups
+	cfg.AccessLogCompress = accessLogCompress
 
 	var err error
-	db, err = bitcask.Open(dbpath)
+	cfg.Peers, err = ParsePeers(peers)
 	if err != nil {
-		log.Fatal(err)
+		fatal("error parsing -peers", "err", err)
+	}
+	cfg.Webhooks, err = ParseWebhooks(webhooks)
+	if err != nil {
+		fatal("error parsing -webhooks", "err", err)
+	}
+	if catalog != "" {
+		cfg.Catalog, err = ParseCatalogURL(catalog)
+		if err != nil {
+			fatal("error parsing -catalog", "err", err)
+		}
+	}
+
+	if offline {
+		DisableOutboundHTTP()
+	}
+
+	db, err = OpenDB(dbpath, encryptionKeyFile)
+	if err != nil {
+		fatal("error opening database", "db", dbpath, "err", err)
 	}
 	defer db.Close()
 
-	if db.Len() == 0 {
+	if readonly {
+		db = NewReadOnlyStore(db)
+	}
+
+	svr, err := NewServer(bind, cfg)
+	if err != nil {
+		fatal("error creating server", "err", err)
+	}
+
+	db = NewInstrumentedStore(db, svr.counters)
+	svr.ReplicateStore()
+
+	if restoreFrom != "" {
+		n, err := RestoreFrom(restoreFrom, svr.backuper)
+		if err != nil {
+			fatal("error restoring", "from", restoreFrom, "err", err)
+		}
+		slog.Info("restored keys", "keys", n, "from", restoreFrom)
+	}
+
+	if err := svr.LoadSettings(); err != nil {
+		fatal("error loading settings", "err", err)
+	}
+
+	if importBookmarks != "" {
+		rules, err := ParseImportRules(importRules)
+		if err != nil {
+			fatal("error parsing -import-rules", "err", err)
+		}
+		summary, err := ImportBookmarksFile(importBookmarks, rules)
+		if err != nil {
+			fatal("error importing bookmarks", "file", importBookmarks, "err", err)
+		}
+		slog.Info(
+			"imported bookmarks", "file", importBookmarks,
+			"added", summary.Added, "existing", summary.Exists, "skipped", summary.Skipped,
+			"overwritten", summary.Overwritten, "failed", summary.Failed,
+		)
+	}
+
+	if err := svr.SyncBookmarksFile(); err != nil {
+		fatal("error syncing bookmarks", "file", bookmarksFile, "err", err)
+	}
+
+	if err := svr.SyncBookmarksURL(); err != nil {
+		slog.Error("error syncing bookmarks", "url", bookmarksURL, "err", err)
+	}
+
+	if err := svr.SyncGitRepo(); err != nil {
+		slog.Error("error syncing bookmarks", "repo", gitRepo, "err", err)
+	}
+
+	if err := svr.SyncDefaults(); err != nil {
+		slog.Error("error syncing defaults", "source", defaults, "err", err)
+	}
+
+	if err := svr.SyncRaindrop(); err != nil {
+		slog.Error("error syncing bookmarks with raindrop", "err", err)
+	}
+
+	if err := svr.SyncBrowser(); err != nil {
+		slog.Error("error syncing browser bookmarks", "err", err)
+	}
+
+	if db.Len() == 0 && !readonly {
 		err = EnsureDefaultBookmarks()
 		if err != nil {
-			log.Fatal(err)
+			fatal("error creating default bookmarks", "err", err)
 		}
 	}
 
-	svr, err := NewServer(bind, cfg)
-	if err != nil {
-		log.Fatalf("error creating server: %s", err)
+	if !readonly {
+		legacy := IsLegacyDB()
+		result, err := MigrateLegacyKeys()
+		if err != nil {
+			fatal("error migrating database created by prologic/golinks", "err", err)
+		}
+		if legacy {
+			slog.Info("migrated database created by prologic/golinks", "result", result)
+		}
+
+		if err := EnsureTargetIndex(); err != nil {
+			fatal("error indexing bookmark targets", "err", err)
+		}
+
+		if err := EnsureTypoKeys(); err != nil {
+			fatal("error rekeying misspellings", "err", err)
+		}
 	}
 
-	log.Printf("%s listening on http://%s", FullVersion(), bind)
+	if selfTest {
+		result, err := svr.SelfTest(DefaultSelfTestSamples)
+		if err != nil {
+			fatal("self-test failed", "err", err)
+		}
+		slog.Info("ready", "self_test", result)
+	}
+
+	scheme := "http://"
+	if tlsCert != "" {
+		scheme = "https://"
+	}
+	slog.Info("listening", "version", FullVersion(), "addr", scheme+bind)
 	if err := svr.Run(); err != nil {
-		log.Fatalf("error running or shutting down server: %s", err)
+		return fmt.Errorf("error running or shutting down server: %s", err)
 	}
+	return nil
 }
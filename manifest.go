@@ -0,0 +1,359 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log/slog"
+	"os"
+	"os/signal"
+	"sort"
+	"strings"
+	"syscall"
+
+	"github.com/prologic/bitcask"
+	"gopkg.in/yaml.v2"
+)
+
+// ManifestBookmark is a bookmark declared in a bookmarks manifest
+type ManifestBookmark struct {
+	URL     string   `yaml:"url" json:"url"`
+	Aliases []string `yaml:"aliases" json:"aliases,omitempty"`
+	Tags    []string `yaml:"tags" json:"tags,omitempty"`
+}
+
+// UnmarshalYAML allows bookmarks to be declared as just their url
+func (b *ManifestBookmark) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var url string
+	if err := unmarshal(&url); err == nil {
+		*b = ManifestBookmark{URL: url}
+		return nil
+	}
+
+	type plain ManifestBookmark
+	return unmarshal((*plain)(b))
+}
+
+// Manifest declares bookmarks managed by golinks and optionally some of
+// the runtime settings, e.g:
+//
+//	bookmarks:
+//	  jira: https://jira.example.com/browse/%s
+//	  gh:
+//	    url: https://github.com/search?q=%s
+//	    aliases: [github]
+//	    tags: [dev]
+//	settings:
+//	  url: https://duckduckgo.com/?q=%s
+type Manifest struct {
+	Bookmarks map[string]ManifestBookmark `yaml:"bookmarks"`
+	Settings  *SettingsUpdate             `yaml:"settings"`
+}
+
+// SyncResult ...
+type SyncResult struct {
+	Created   int  `json:"created"`
+	Updated   int  `json:"updated"`
+	Removed   int  `json:"removed"`
+	Unchanged int  `json:"unchanged"`
+	Settings  bool `json:"settings"`
+}
+
+func (r SyncResult) String() string {
+	s := fmt.Sprintf(
+		"%d created, %d updated, %d removed, %d unchanged",
+		r.Created, r.Updated, r.Removed, r.Unchanged,
+	)
+	if r.Settings {
+		s += ", settings updated"
+	}
+	return s
+}
+
+// ParseManifest parses and validates a YAML bookmarks manifest
+func ParseManifest(r io.Reader) (*Manifest, error) {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var manifest Manifest
+	if err := yaml.UnmarshalStrict(data, &manifest); err != nil {
+		return nil, err
+	}
+
+	if manifest.Settings != nil {
+		if _, err := manifest.Settings.Apply(Settings{}); err != nil {
+			return nil, fmt.Errorf("settings: %s", err)
+		}
+	}
+
+	names := make(map[string]bool)
+	for name, bookmark := range manifest.Bookmarks {
+		names[strings.ToLower(name)] = true
+		if bookmark.URL == "" {
+			return nil, fmt.Errorf("bookmark %q has no url", name)
+		}
+	}
+	for name, bookmark := range manifest.Bookmarks {
+		for _, alias := range bookmark.Aliases {
+			if names[strings.ToLower(alias)] {
+				return nil, fmt.Errorf("alias %q of %q is already declared", alias, name)
+			}
+			names[strings.ToLower(alias)] = true
+		}
+	}
+
+	return &manifest, nil
+}
+
+// LoadManifest ...
+func LoadManifest(filename string) (*Manifest, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return ParseManifest(f)
+}
+
+// managedKey records a bookmark (and its aliases) as managed by a manifest
+func managedKey(name string) []byte {
+	return []byte(fmt.Sprintf("managed_%s", name))
+}
+
+// removeManaged removes a managed bookmark along with its aliases and tags
+func removeManaged(name string, managed ManifestBookmark) error {
+	for _, alias := range managed.Aliases {
+		if err := db.Delete([]byte(fmt.Sprintf("alias_%s", alias))); err != nil {
+			return err
+		}
+	}
+	if err := db.Delete([]byte(fmt.Sprintf("tags_%s", name))); err != nil {
+		return err
+	}
+	if err := DeleteBookmark(name); err != nil {
+		return err
+	}
+	return db.Delete(managedKey(name))
+}
+
+// SyncManifest reconciles the store with the manifest: declared bookmarks
+// are created or updated and bookmarks previously created from a manifest
+// but no longer declared are removed. Bookmarks created by other means are
+// left alone unless the manifest declares a bookmark with the same name.
+func SyncManifest(manifest *Manifest) (result SyncResult, err error) {
+	previous := make(map[string]ManifestBookmark)
+	err = db.Scan([]byte("managed_"), func(key []byte) error {
+		val, err := db.Get(key)
+		if err != nil {
+			return err
+		}
+		var managed ManifestBookmark
+		if err := json.Unmarshal(val, &managed); err != nil {
+			return err
+		}
+		previous[strings.TrimPrefix(string(key), "managed_")] = managed
+		return nil
+	})
+	if err != nil {
+		return
+	}
+
+	declared := make(map[string]ManifestBookmark)
+	for name, bookmark := range manifest.Bookmarks {
+		bookmark.Tags = append([]string(nil), bookmark.Tags...)
+		sort.Strings(bookmark.Tags)
+
+		var aliases []string
+		for _, alias := range bookmark.Aliases {
+			aliases = append(aliases, strings.ToLower(alias))
+		}
+		bookmark.Aliases = aliases
+
+		declared[strings.ToLower(name)] = bookmark
+	}
+
+	for name, managed := range previous {
+		if _, ok := declared[name]; ok {
+			continue
+		}
+		if err = removeManaged(name, managed); err != nil {
+			return
+		}
+		result.Removed++
+	}
+
+	var names []string
+	for name := range declared {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		bookmark := declared[name]
+
+		var current []byte
+		current, err = db.Get([]byte(fmt.Sprintf("bookmark_%s", name)))
+		if err != nil && err != bitcask.ErrKeyNotFound {
+			return
+		}
+		exists := err == nil
+		err = nil
+
+		managed, wasManaged := previous[name]
+		changed := !exists || string(current) != bookmark.URL ||
+			!wasManaged || !equalStrings(managed.Aliases, bookmark.Aliases) ||
+			!equalStrings(managed.Tags, bookmark.Tags)
+
+		if !changed {
+			result.Unchanged++
+			continue
+		}
+
+		for _, alias := range managed.Aliases {
+			if err = db.Delete([]byte(fmt.Sprintf("alias_%s", alias))); err != nil {
+				return
+			}
+		}
+
+		if err = SaveBookmark(name, bookmark.URL); err != nil {
+			return
+		}
+		for _, alias := range bookmark.Aliases {
+			if db.Has([]byte(fmt.Sprintf("bookmark_%s", alias))) {
+				slog.Warn("alias is shadowed by a bookmark", "alias", alias, "name", name)
+			}
+			if err = db.Put([]byte(fmt.Sprintf("alias_%s", alias)), []byte(name)); err != nil {
+				return
+			}
+		}
+
+		tagsKey := []byte(fmt.Sprintf("tags_%s", name))
+		if len(bookmark.Tags) > 0 {
+			err = db.Put(tagsKey, []byte(strings.Join(bookmark.Tags, ",")))
+		} else {
+			err = db.Delete(tagsKey)
+		}
+		if err != nil {
+			return
+		}
+
+		var data []byte
+		if data, err = json.Marshal(bookmark); err != nil {
+			return
+		}
+		if err = db.Put(managedKey(name), data); err != nil {
+			return
+		}
+
+		if exists {
+			result.Updated++
+		} else {
+			result.Created++
+		}
+	}
+
+	return
+}
+
+// syncManifest syncs the bookmarks of the manifest and changes the
+// settings it declares (if any)
+func (s *Server) syncManifest(manifest *Manifest) (SyncResult, error) {
+	result, err := SyncManifest(manifest)
+	if err != nil || manifest.Settings == nil {
+		return result, err
+	}
+
+	previous := s.settings()
+	settings, err := s.UpdateSettings(*manifest.Settings)
+	if err != nil {
+		return result, err
+	}
+	result.Settings = settings != previous
+	return result, nil
+}
+
+// syncManifestFile loads the manifest from the given file and syncs it
+func (s *Server) syncManifestFile(filename string) (SyncResult, error) {
+	manifest, err := LoadManifest(filename)
+	if err != nil {
+		return SyncResult{}, err
+	}
+	return s.syncManifest(manifest)
+}
+
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// checkManifestSources returns an error if more than one source of the
+// bookmarks manifest is configured as they would remove each other's bookmarks
+func checkManifestSources(config Config) error {
+	n := 0
+	for _, source := range []string{config.BookmarksFile, config.BookmarksURL, config.GitRepo} {
+		if source != "" {
+			n++
+		}
+	}
+	if n > 1 {
+		return errors.New("only one of -bookmarks-file, -bookmarks-url and -git-repo may be used")
+	}
+	return nil
+}
+
+// SyncBookmarksFile syncs the configured bookmarks manifest (if any)
+func (s *Server) SyncBookmarksFile() error {
+	if s.config.BookmarksFile == "" {
+		return nil
+	}
+
+	if s.config.ReadOnly {
+		slog.Warn("not syncing bookmarks in read-only mode", "file", s.config.BookmarksFile)
+		return nil
+	}
+
+	result, err := s.syncManifestFile(s.config.BookmarksFile)
+	if err != nil {
+		s.counters.Inc("n_manifest_sync_failed")
+		return err
+	}
+	s.counters.Inc("n_manifest_sync")
+
+	slog.Info("synced bookmarks", "file", s.config.BookmarksFile, "result", result)
+
+	return nil
+}
+
+// syncOnSIGHUP re-syncs the bookmarks manifest whenever SIGHUP is received
+// until ctx is cancelled
+func (s *Server) syncOnSIGHUP(ctx context.Context) {
+	sigch := make(chan os.Signal, 1)
+	signal.Notify(sigch, syscall.SIGHUP)
+	defer signal.Stop(sigch)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-sigch:
+		}
+
+		slog.Info("received SIGHUP, syncing bookmarks", "file", s.config.BookmarksFile)
+		if err := s.SyncBookmarksFile(); err != nil {
+			slog.Error("error syncing bookmarks", "file", s.config.BookmarksFile, "err", err)
+		}
+	}
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const testManifest = `
+bookmarks:
+  jira: https://jira.example.com/browse/%s
+  gh:
+    url: https://github.com/search?q=%s
+    aliases: [GitHub, hub]
+    tags: [dev, code]
+`
+
+func TestParseManifest(t *testing.T) {
+	assert := assert.New(t)
+
+	manifest, err := ParseManifest(strings.NewReader(testManifest))
+	assert.NoError(err)
+	assert.Equal(&Manifest{
+		Bookmarks: map[string]ManifestBookmark{
+			"jira": {URL: "https://jira.example.com/browse/%s"},
+			"gh": {
+				URL:     "https://github.com/search?q=%s",
+				Aliases: []string{"GitHub", "hub"},
+				Tags:    []string{"dev", "code"},
+			},
+		},
+	}, manifest)
+
+	_, err = ParseManifest(strings.NewReader("bookmarks:\n  foo:\n    tags: [bar]\n"))
+	assert.Error(err)
+
+	_, err = ParseManifest(strings.NewReader("bookmarks:\n  foo: https://foo\n  bar:\n    url: https://bar\n    aliases: [foo]\n"))
+	assert.Error(err)
+
+	_, err = ParseManifest(strings.NewReader("links:\n  foo: https://foo\n"))
+	assert.Error(err)
+
+	manifest, err = ParseManifest(strings.NewReader("settings:\n  title: Go\n"))
+	assert.NoError(err)
+	assert.Equal("Go", *manifest.Settings.Title)
+	assert.Nil(manifest.Settings.URL)
+
+	_, err = ParseManifest(strings.NewReader("settings:\n  url: duckduckgo.com\n"))
+	assert.Error(err)
+}
+
+func TestSyncManifest(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir("", "golinks")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	db, err = OpenStore(filepath.Join(dir, "test.db"))
+	assert.NoError(err)
+	defer db.Close()
+
+	assert.NoError(SaveBookmark("g", "https://www.google.com/search?q=%s"))
+	assert.NoError(SaveBookmark("jira", "https://old-jira.example.com/"))
+
+	manifest, err := ParseManifest(strings.NewReader(testManifest))
+	assert.NoError(err)
+
+	result, err := SyncManifest(manifest)
+	assert.NoError(err)
+	assert.Equal(SyncResult{Created: 1, Updated: 1}, result)
+
+	bookmark, ok := LookupBookmark("jira")
+	assert.True(ok)
+	assert.Equal("https://jira.example.com/browse/%s", bookmark.URL())
+
+	bookmark, ok = LookupBookmark("GitHub")
+	assert.True(ok)
+	assert.Equal("gh", bookmark.Name())
+	assert.Equal("https://github.com/search?q=%s", bookmark.URL())
+
+	tags, err := db.Get([]byte("tags_gh"))
+	assert.NoError(err)
+	assert.Equal("code,dev", string(tags))
+
+	result, err = SyncManifest(manifest)
+	assert.NoError(err)
+	assert.Equal(SyncResult{Unchanged: 2}, result)
+
+	manifest, err = ParseManifest(strings.NewReader("bookmarks:\n  gh:\n    url: https://github.com\n    aliases: [hub]\n"))
+	assert.NoError(err)
+
+	result, err = SyncManifest(manifest)
+	assert.NoError(err)
+	assert.Equal(SyncResult{Updated: 1, Removed: 1}, result)
+
+	_, ok = LookupBookmark("jira")
+	assert.False(ok)
+	_, ok = LookupBookmark("github")
+	assert.False(ok)
+	bookmark, ok = LookupBookmark("hub")
+	assert.True(ok)
+	assert.Equal("https://github.com", bookmark.URL())
+	assert.False(db.Has([]byte("tags_gh")))
+
+	// Bookmarks not managed by the manifest are left alone
+	_, ok = LookupBookmark("g")
+	assert.True(ok)
+}
+
+func TestSyncBookmarksFile(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir("", "golinks")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	db, err = OpenStore(filepath.Join(dir, "test.db"))
+	assert.NoError(err)
+	defer db.Close()
+
+	filename := filepath.Join(dir, "bookmarks.yaml")
+	assert.NoError(ioutil.WriteFile(filename, []byte(testManifest), 0644))
+
+	s, err := NewServer(":8000", Config{BookmarksFile: filename, Title: "Search"})
+	assert.NoError(err)
+	assert.NoError(s.SyncBookmarksFile())
+
+	_, ok := LookupBookmark("hub")
+	assert.True(ok)
+
+	// Only the settings declared are changed
+	assert.NoError(ioutil.WriteFile(filename, []byte(testManifest+"settings:\n  url: https://duckduckgo.com/?q=%s\n"), 0644))
+	assert.NoError(s.SyncBookmarksFile())
+	assert.Equal(Settings{URL: "https://duckduckgo.com/?q=%s", Title: "Search"}, s.settings())
+
+	assert.NoError(ioutil.WriteFile(filename, []byte("bookmarks: [\n"), 0644))
+	assert.Error(s.SyncBookmarksFile())
+
+	s, err = NewServer(":8000", Config{})
+	assert.NoError(err)
+	assert.NoError(s.SyncBookmarksFile())
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// Matrix is a Matrix bot long-polling a homeserver with /sync, as the user
+// of the access token. Invites to rooms are accepted; messages sent before
+// the bot started are ignored.
+type Matrix struct {
+	baseURL string
+	token   string
+	client  *http.Client
+
+	userID string
+	since  string
+	txn    int64
+}
+
+// NewMatrix ...
+func NewMatrix(baseURL, token string) *Matrix {
+	return &Matrix{
+		baseURL: strings.TrimRight(baseURL, "/") + "/_matrix/client/v3",
+		token:   token,
+		client:  &http.Client{Timeout: BotPollTimeout + client.Timeout},
+	}
+}
+
+// Name ...
+func (m *Matrix) Name() string {
+	return "matrix"
+}
+
+func (m *Matrix) do(method, path string, body, v interface{}) error {
+	var r io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		r = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequest(method, m.baseURL+path, r)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+m.token)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	res, err := m.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	data, err := ioutil.ReadAll(io.LimitReader(res.Body, MaxBotResponseBytes))
+	if err != nil {
+		return err
+	}
+	if res.StatusCode != http.StatusOK {
+		var merr struct {
+			Error string `json:"error"`
+		}
+		if json.Unmarshal(data, &merr) == nil && merr.Error != "" {
+			return fmt.Errorf("matrix: %s %s: %s", method, req.URL.Path, merr.Error)
+		}
+		return fmt.Errorf("matrix: %s %s: %s", method, req.URL.Path, res.Status)
+	}
+
+	if v == nil {
+		return nil
+	}
+	return json.Unmarshal(data, v)
+}
+
+type matrixSync struct {
+	NextBatch string `json:"next_batch"`
+	Rooms     struct {
+		Join map[string]struct {
+			Timeline struct {
+				Events []struct {
+					Type    string `json:"type"`
+					EventID string `json:"event_id"`
+					Sender  string `json:"sender"`
+					Content struct {
+						MsgType string `json:"msgtype"`
+						Body    string `json:"body"`
+					} `json:"content"`
+				} `json:"events"`
+			} `json:"timeline"`
+		} `json:"join"`
+		Invite map[string]json.RawMessage `json:"invite"`
+	} `json:"rooms"`
+}
+
+// Poll ...
+func (m *Matrix) Poll() ([]BotMessage, error) {
+	if m.userID == "" {
+		var whoami struct {
+			UserID string `json:"user_id"`
+		}
+		if err := m.do("GET", "/account/whoami", nil, &whoami); err != nil {
+			return nil, err
+		}
+		m.userID = whoami.UserID
+	}
+
+	// The first sync returns immediately and only catches up
+	params := url.Values{"timeout": {"0"}}
+	if m.since != "" {
+		params.Set("since", m.since)
+		params.Set("timeout", strconv.FormatInt(int64(BotPollTimeout/time.Millisecond), 10))
+	}
+
+	var sync matrixSync
+	if err := m.do("GET", "/sync?"+params.Encode(), nil, &sync); err != nil {
+		return nil, err
+	}
+	first := m.since == ""
+	m.since = sync.NextBatch
+
+	for room := range sync.Rooms.Invite {
+		if err := m.do("POST", "/join/"+url.PathEscape(room), struct{}{}, nil); err != nil {
+			return nil, err
+		}
+	}
+
+	if first {
+		return nil, nil
+	}
+
+	var msgs []BotMessage
+	for room, joined := range sync.Rooms.Join {
+		for _, event := range joined.Timeline.Events {
+			if event.Type != "m.room.message" || event.Content.MsgType != "m.text" || event.Sender == m.userID {
+				continue
+			}
+			msgs = append(msgs, BotMessage{
+				ID:   event.EventID,
+				Chat: room,
+				From: []string{event.Sender},
+				Text: event.Content.Body,
+			})
+		}
+	}
+
+	return msgs, nil
+}
+
+// Reply sends the reply as a notice, which bots (including this one)
+// don't answer
+func (m *Matrix) Reply(msg BotMessage, text string) error {
+	txn := fmt.Sprintf("golinks%d.%d", time.Now().UnixNano(), atomic.AddInt64(&m.txn, 1))
+	path := fmt.Sprintf("/rooms/%s/send/m.room.message/%s", url.PathEscape(msg.Chat), txn)
+	return m.do("PUT", path, map[string]string{"msgtype": "m.notice", "body": text}, nil)
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMatrix(t *testing.T) {
+	assert := assert.New(t)
+
+	var (
+		joined []string
+		sent   []string
+	)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer s3cr3t" {
+			w.WriteHeader(http.StatusUnauthorized)
+			w.Write([]byte(`{"errcode": "M_UNKNOWN_TOKEN", "error": "Invalid access token"}`))
+			return
+		}
+
+		switch {
+		case r.URL.Path == "/_matrix/client/v3/account/whoami":
+			w.Write([]byte(`{"user_id": "@golinks:example.org"}`))
+		case r.URL.Path == "/_matrix/client/v3/sync" && r.URL.Query().Get("since") == "":
+			assert.Equal("0", r.URL.Query().Get("timeout"))
+			w.Write([]byte(`{"next_batch": "s1", "rooms": {
+				"join": {"!old:example.org": {"timeline": {"events": [
+					{"type": "m.room.message", "event_id": "$0", "sender": "@alice:example.org", "content": {"msgtype": "m.text", "body": "go old"}}
+				]}}},
+				"invite": {"!new:example.org": {}}
+			}}`))
+		case r.URL.Path == "/_matrix/client/v3/sync":
+			assert.Equal("s1", r.URL.Query().Get("since"))
+			w.Write([]byte(`{"next_batch": "s2", "rooms": {"join": {"!new:example.org": {"timeline": {"events": [
+				{"type": "m.room.message", "event_id": "$1", "sender": "@alice:example.org", "content": {"msgtype": "m.text", "body": "go gh"}},
+				{"type": "m.room.message", "event_id": "$2", "sender": "@golinks:example.org", "content": {"msgtype": "m.notice", "body": "https://github.com/"}},
+				{"type": "m.room.member", "event_id": "$3", "sender": "@bob:example.org", "content": {}}
+			]}}}}}`))
+		case strings.HasPrefix(r.URL.Path, "/_matrix/client/v3/join/"):
+			joined = append(joined, strings.TrimPrefix(r.URL.Path, "/_matrix/client/v3/join/"))
+			w.Write([]byte(`{}`))
+		case strings.HasPrefix(r.URL.Path, "/_matrix/client/v3/rooms/!new:example.org/send/m.room.message/"):
+			assert.Equal("PUT", r.Method)
+			var content map[string]string
+			json.NewDecoder(r.Body).Decode(&content)
+			assert.Equal("m.notice", content["msgtype"])
+			sent = append(sent, content["body"])
+			w.Write([]byte(`{"event_id": "$4"}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer ts.Close()
+
+	matrix := NewMatrix(ts.URL, "s3cr3t")
+
+	// Catching up only joins invited rooms
+	msgs, err := matrix.Poll()
+	assert.NoError(err)
+	assert.Empty(msgs)
+	assert.Equal([]string{"!new:example.org"}, joined)
+
+	msgs, err = matrix.Poll()
+	assert.NoError(err)
+	assert.Equal([]BotMessage{{ID: "$1", Chat: "!new:example.org", From: []string{"@alice:example.org"}, Text: "go gh"}}, msgs)
+
+	assert.NoError(matrix.Reply(msgs[0], "https://github.com/"))
+	assert.Equal([]string{"https://github.com/"}, sent)
+
+	_, err = NewMatrix(ts.URL, "bad").Poll()
+	assert.Error(err)
+	assert.Contains(err.Error(), "Invalid access token")
+}
@@ -0,0 +1,290 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rcrowley/go-metrics"
+)
+
+const (
+	// DefaultMetricsExportInterval is how often metrics are flushed to
+	// StatsD or InfluxDB
+	DefaultMetricsExportInterval = 10 * time.Second
+
+	// DefaultStatsDPort is the port StatsD listens on by default
+	DefaultStatsDPort = "8125"
+
+	// statsdPacketSize is the largest StatsD packet sent, so packets are
+	// not fragmented on common networks
+	statsdPacketSize = 1432
+)
+
+// ParseMetricsExportURL parses the url of a StatsD server (statsd://host),
+// or an InfluxDB database (influx://host:8086/db, or influxs:// for https)
+// to flush metrics to
+func ParseMetricsExportURL(s string) (*url.URL, error) {
+	u, err := url.Parse(strings.TrimSpace(s))
+	if err != nil {
+		return nil, err
+	}
+	if u.Hostname() == "" {
+		return nil, fmt.Errorf("invalid metrics export url %q (missing host)", s)
+	}
+
+	switch u.Scheme {
+	case "statsd":
+		if u.Port() == "" {
+			u.Host = net.JoinHostPort(u.Hostname(), DefaultStatsDPort)
+		}
+	case "influx", "influxs":
+		if strings.Trim(u.Path, "/") == "" {
+			return nil, fmt.Errorf("invalid metrics export url %q (missing database)", s)
+		}
+	default:
+		return nil, fmt.Errorf("unsupported metrics export %q (expected statsd://, influx:// or influxs://)", s)
+	}
+	return u, nil
+}
+
+// statsdName returns the StatsD bucket of a metric, e.g:
+// golinks.n_api_links
+func statsdName(name string) string {
+	return PrometheusNamespace + "." + strings.NewReplacer(":", "_", "|", "_", "@", "_", " ", "_").Replace(name)
+}
+
+// MetricsExporter periodically flushes the counters, gauges and timers to
+// StatsD or InfluxDB (line protocol), for those who don't run Prometheus.
+// StatsD is sent how much counters increased since the last flush, and
+// InfluxDB their totals. Flushes that fail are logged and counted, and
+// never retried.
+type MetricsExporter struct {
+	url      *url.URL
+	registry metrics.Registry
+	counters *Counters
+
+	// last is the count of each counter at the last StatsD flush
+	last map[string]int64
+
+	quit chan struct{}
+	wg   sync.WaitGroup
+}
+
+// NewMetricsExporter ...
+func NewMetricsExporter(u *url.URL, counters *Counters) *MetricsExporter {
+	return &MetricsExporter{
+		url:      u,
+		registry: counters.r,
+		counters: counters,
+
+		last: make(map[string]int64),
+		quit: make(chan struct{}),
+	}
+}
+
+// snapshot returns the metrics of the registry sorted by name
+func (e *MetricsExporter) snapshot() ([]string, map[string]interface{}) {
+	all := make(map[string]interface{})
+	e.registry.Each(func(name string, metric interface{}) {
+		all[name] = metric
+	})
+	names := make([]string, 0, len(all))
+	for name := range all {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names, all
+}
+
+// statsdLines returns the StatsD lines of the metrics: counters as counts
+// of how much they increased, gauges as gauges and timers as the gauges of
+// their mean and percentiles in milliseconds
+func (e *MetricsExporter) statsdLines() []string {
+	names, all := e.snapshot()
+
+	var lines []string
+	for _, name := range names {
+		bucket := statsdName(name)
+		switch metric := all[name].(type) {
+		case metrics.Counter:
+			count := metric.Count()
+			if delta := count - e.last[name]; delta != 0 {
+				lines = append(lines, fmt.Sprintf("%s:%d|c", bucket, delta))
+			}
+			e.last[name] = count
+		case metrics.Gauge:
+			lines = append(lines, fmt.Sprintf("%s:%d|g", bucket, metric.Value()))
+		case metrics.Timer:
+			t := metric.Snapshot()
+			if t.Count() == 0 {
+				continue
+			}
+			ps := t.Percentiles([]float64{0.5, 0.9, 0.99})
+			lines = append(
+				lines,
+				fmt.Sprintf("%s.mean:%s|g", bucket, formatFloat(t.Mean()/1e6)),
+				fmt.Sprintf("%s.p50:%s|g", bucket, formatFloat(ps[0]/1e6)),
+				fmt.Sprintf("%s.p90:%s|g", bucket, formatFloat(ps[1]/1e6)),
+				fmt.Sprintf("%s.p99:%s|g", bucket, formatFloat(ps[2]/1e6)),
+			)
+		}
+	}
+	return lines
+}
+
+// influxLines returns the InfluxDB line protocol of the metrics at t:
+// counters and gauges as a value and timers as their count, mean and
+// percentiles in seconds
+func (e *MetricsExporter) influxLines(t time.Time) []string {
+	names, all := e.snapshot()
+	ts := strconv.FormatInt(t.UnixNano(), 10)
+
+	var lines []string
+	for _, name := range names {
+		// Measurements are named as for Prometheus, e.g: golinks_n_api_links
+		measurement := prometheusName(name)
+		switch metric := all[name].(type) {
+		case metrics.Counter:
+			lines = append(lines, fmt.Sprintf("%s value=%di %s", measurement, metric.Count(), ts))
+		case metrics.Gauge:
+			lines = append(lines, fmt.Sprintf("%s value=%di %s", measurement, metric.Value(), ts))
+		case metrics.Timer:
+			s := metric.Snapshot()
+			ps := s.Percentiles([]float64{0.5, 0.9, 0.99})
+			lines = append(lines, fmt.Sprintf(
+				"%s count=%di,mean=%s,p50=%s,p90=%s,p99=%s %s",
+				measurement, s.Count(), formatFloat(s.Mean()/1e9),
+				formatFloat(ps[0]/1e9), formatFloat(ps[1]/1e9), formatFloat(ps[2]/1e9), ts,
+			))
+		}
+	}
+	return lines
+}
+
+// sendStatsD sends lines to StatsD over UDP, as few packets as possible
+func (e *MetricsExporter) sendStatsD(lines []string) error {
+	conn, err := net.Dial("udp", e.url.Host)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	var packet bytes.Buffer
+	flush := func() error {
+		if packet.Len() == 0 {
+			return nil
+		}
+		_, err := conn.Write(packet.Bytes())
+		packet.Reset()
+		return err
+	}
+	for _, line := range lines {
+		if packet.Len() > 0 && packet.Len()+1+len(line) > statsdPacketSize {
+			if err := flush(); err != nil {
+				return err
+			}
+		}
+		if packet.Len() > 0 {
+			packet.WriteByte('\n')
+		}
+		packet.WriteString(line)
+	}
+	return flush()
+}
+
+// sendInflux writes lines to the InfluxDB database with the v1 write API
+func (e *MetricsExporter) sendInflux(lines []string) error {
+	scheme := "http"
+	if e.url.Scheme == "influxs" {
+		scheme = "https"
+	}
+	params := url.Values{"db": {strings.Trim(e.url.Path, "/")}, "precision": {"ns"}}
+	endpoint := fmt.Sprintf("%s://%s/write?%s", scheme, e.url.Host, params.Encode())
+
+	req, err := http.NewRequest("POST", endpoint, strings.NewReader(strings.Join(lines, "\n")+"\n"))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "text/plain; charset=utf-8")
+	if e.url.User != nil {
+		password, _ := e.url.User.Password()
+		req.SetBasicAuth(e.url.User.Username(), password)
+	}
+
+	res, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	res.Body.Close()
+
+	if res.StatusCode/100 != 2 {
+		return fmt.Errorf("unexpected status %s", res.Status)
+	}
+	return nil
+}
+
+// Flush sends the metrics now
+func (e *MetricsExporter) Flush() error {
+	var err error
+	if e.url.Scheme == "statsd" {
+		lines := e.statsdLines()
+		if len(lines) == 0 {
+			return nil
+		}
+		err = e.sendStatsD(lines)
+	} else {
+		lines := e.influxLines(time.Now())
+		if len(lines) == 0 {
+			return nil
+		}
+		err = e.sendInflux(lines)
+	}
+
+	if err != nil {
+		e.counters.Inc("n_metrics_export_error")
+		return err
+	}
+	e.counters.Inc("n_metrics_export")
+	return nil
+}
+
+// Start flushes the metrics every interval until stopped
+func (e *MetricsExporter) Start(interval time.Duration) {
+	e.wg.Add(1)
+	go func() {
+		defer e.wg.Done()
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				if err := e.Flush(); err != nil {
+					slog.Error("error exporting metrics", "url", e.url.Redacted(), "err", err)
+				}
+			case <-e.quit:
+				return
+			}
+		}
+	}()
+}
+
+// Stop stops flushing after a last flush, so the final counts are sent
+func (e *MetricsExporter) Stop() {
+	close(e.quit)
+	e.wg.Wait()
+
+	if err := e.Flush(); err != nil {
+		slog.Error("error exporting metrics", "url", e.url.Redacted(), "err", err)
+	}
+}
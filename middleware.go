@@ -0,0 +1,159 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"runtime/debug"
+	"strings"
+
+	"github.com/NYTimes/gziphandler"
+)
+
+// RequestIDHeader is the header carrying the request id
+const RequestIDHeader = "X-Request-Id"
+
+type contextKey string
+
+const requestIDKey contextKey = "request_id"
+
+// RequestID returns the id of the request (if any)
+func RequestID(r *http.Request) string {
+	if r == nil {
+		return ""
+	}
+	if id, ok := r.Context().Value(requestIDKey).(string); ok {
+		return id
+	}
+	return ""
+}
+
+// validRequestID reports whether an incoming request id is safe to reuse
+func validRequestID(id string) bool {
+	if id == "" || len(id) > 64 {
+		return false
+	}
+	for _, c := range id {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9',
+			c == '-', c == '_', c == '.':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// RequestIDs assigns each request an id (reusing a valid incoming
+// X-Request-Id) and returns it in the X-Request-Id response header.
+func RequestIDs(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(RequestIDHeader)
+		if !validRequestID(id) {
+			id = NewInstanceID()
+		}
+
+		w.Header().Set(RequestIDHeader, id)
+		ctx := context.WithValue(r.Context(), requestIDKey, id)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// MethodOverrideHeader allows constrained clients to tunnel other methods
+// through POST requests.
+const MethodOverrideHeader = "X-HTTP-Method-Override"
+
+var overridableMethods = map[string]bool{
+	"GET":    true,
+	"HEAD":   true,
+	"PUT":    true,
+	"PATCH":  true,
+	"DELETE": true,
+}
+
+// MethodOverride rewrites the method of POST requests with a valid
+// X-HTTP-Method-Override header to the method given in the header.
+func MethodOverride(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == "POST" {
+			method := strings.ToUpper(strings.TrimSpace(r.Header.Get(MethodOverrideHeader)))
+			if overridableMethods[method] {
+				r.Method = method
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// GzipExcept compresses responses except for requests to the given paths,
+// e.g: streams (/events), which gzip would buffer
+func GzipExcept(next http.Handler, paths ...string) http.Handler {
+	gzipped := gziphandler.GzipHandler(next)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for _, path := range paths {
+			if r.URL.Path == path {
+				next.ServeHTTP(w, r)
+				return
+			}
+		}
+		gzipped.ServeHTTP(w, r)
+	})
+}
+
+// Recover recovers from panics handling requests: the panic is logged with
+// its stack trace and counted, and the client gets a 500 (an error page, or
+// a JSON error from the API) instead of a dropped connection. Responses
+// already under way when the panic happened can't be replaced and are cut
+// short.
+func Recover(next http.Handler, counters *Counters, templates *Templates) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rec := &statusRecorder{ResponseWriter: w}
+		defer func() {
+			v := recover()
+			if v == nil {
+				return
+			}
+			// Handlers abort responses on purpose with ErrAbortHandler
+			if v == http.ErrAbortHandler {
+				panic(v)
+			}
+
+			counters.Inc("n_panics")
+			slog.Error(
+				"panic handling request",
+				"method", r.Method,
+				"path", r.URL.Path,
+				"request_id", RequestID(r),
+				"err", fmt.Sprint(v),
+				"stack", string(debug.Stack()),
+			)
+
+			if rec.code != 0 {
+				return
+			}
+			if strings.HasPrefix(r.URL.Path, "/api/") {
+				WriteAPIError(w, r, http.StatusInternalServerError, ErrCodeInternal, "internal server error", nil)
+				return
+			}
+
+			writeErrorPage(w, r, templates, http.StatusInternalServerError)
+		}()
+		next.ServeHTTP(rec, r)
+	})
+}
+
+// writeErrorPage answers with the error page (with the request id to quote
+// when reporting it) and status, or a plain error if even that fails
+func writeErrorPage(w http.ResponseWriter, r *http.Request, templates *Templates, status int) {
+	buf, err := templates.Exec("error", map[string]interface{}{"RequestID": RequestID(r)})
+	if err != nil {
+		slog.Error("error rendering error page", "request_id", RequestID(r), "err", err)
+		http.Error(w, http.StatusText(status), status)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	buf.WriteTo(w)
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/rcrowley/go-metrics"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMethodOverride(t *testing.T) {
+	assert := assert.New(t)
+
+	var method string
+	h := MethodOverride(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		method = r.Method
+	}))
+
+	r, _ := http.NewRequest("POST", "/", nil)
+	r.Header.Set(MethodOverrideHeader, "delete")
+	h.ServeHTTP(httptest.NewRecorder(), r)
+	assert.Equal("DELETE", method)
+
+	r, _ = http.NewRequest("POST", "/", nil)
+	r.Header.Set(MethodOverrideHeader, "CONNECT")
+	h.ServeHTTP(httptest.NewRecorder(), r)
+	assert.Equal("POST", method)
+
+	r, _ = http.NewRequest("GET", "/", nil)
+	r.Header.Set(MethodOverrideHeader, "DELETE")
+	h.ServeHTTP(httptest.NewRecorder(), r)
+	assert.Equal("GET", method)
+}
+
+func TestRecover(t *testing.T) {
+	assert := assert.New(t)
+
+	s, err := NewServer(":8000", Config{})
+	assert.NoError(err)
+
+	h := RequestIDs(Recover(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/partial" {
+			w.Write([]byte("partial"))
+		}
+		panic("boom")
+	}), s.counters, s.templates))
+
+	w := httptest.NewRecorder()
+	r, _ := http.NewRequest("GET", "/list", nil)
+	r.Header.Set(RequestIDHeader, "req-1")
+	h.ServeHTTP(w, r)
+	assert.Equal(http.StatusInternalServerError, w.Code)
+	assert.Contains(w.Header().Get("Content-Type"), "text/html")
+	assert.Contains(w.Body.String(), "Something went wrong")
+	assert.Contains(w.Body.String(), "req-1")
+
+	w = httptest.NewRecorder()
+	r, _ = http.NewRequest("GET", "/api/v1/bookmarks", nil)
+	h.ServeHTTP(w, r)
+	assert.Equal(http.StatusInternalServerError, w.Code)
+	assert.Contains(w.Body.String(), `"code":"internal_error"`)
+
+	// Responses under way are cut short
+	w = httptest.NewRecorder()
+	r, _ = http.NewRequest("GET", "/partial", nil)
+	h.ServeHTTP(w, r)
+	assert.Equal(http.StatusOK, w.Code)
+	assert.Equal("partial", w.Body.String())
+
+	counter, ok := s.counters.r.Get("n_panics").(metrics.Counter)
+	assert.True(ok)
+	assert.Equal(int64(3), counter.Count())
+
+	assert.Panics(func() {
+		Recover(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			panic(http.ErrAbortHandler)
+		}), s.counters, s.templates).ServeHTTP(httptest.NewRecorder(), r)
+	})
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"sort"
+
+	"github.com/namsral/flag"
+)
+
+// MigrateReport ...
+type MigrateReport struct {
+	Copied   map[string]int
+	Verified map[string]int
+}
+
+// Total returns the total number of keys copied
+func (r *MigrateReport) Total() (n int) {
+	for _, c := range r.Copied {
+		n += c
+	}
+	return
+}
+
+// WriteTo writes a human readable summary of the migration
+func (r *MigrateReport) WriteTo(w io.Writer) (int64, error) {
+	var types []string
+	for t := range r.Copied {
+		types = append(types, t)
+	}
+	sort.Strings(types)
+
+	buf := &bytes.Buffer{}
+	fmt.Fprintf(buf, "%-12s %8s %8s\n", "TYPE", "COPIED", "VERIFIED")
+	for _, t := range types {
+		fmt.Fprintf(buf, "%-12s %8d %8d\n", t, r.Copied[t], r.Verified[t])
+	}
+	fmt.Fprintf(buf, "%-12s %8d\n", "total", r.Total())
+
+	return buf.WriteTo(w)
+}
+
+// Migrate copies every key from the src store to the dst store and then
+// verifies that each copied key is present in dst with the same value.
+func Migrate(src, dst Store) (*MigrateReport, error) {
+	report := &MigrateReport{
+		Copied:   make(map[string]int),
+		Verified: make(map[string]int),
+	}
+
+	var keys [][]byte
+	err := src.Scan([]byte{}, func(key []byte) error {
+		val, err := src.Get(key)
+		if err != nil {
+			return fmt.Errorf("error reading key %s: %s", key, err)
+		}
+		if err := dst.Put(key, val); err != nil {
+			return fmt.Errorf("error writing key %s: %s", key, err)
+		}
+		keys = append(keys, key)
+		report.Copied[KeyType(key)]++
+		return nil
+	})
+	if err != nil {
+		return report, err
+	}
+
+	for _, key := range keys {
+		expected, err := src.Get(key)
+		if err != nil {
+			return report, fmt.Errorf("error reading key %s: %s", key, err)
+		}
+		actual, err := dst.Get(key)
+		if err != nil {
+			return report, fmt.Errorf("error verifying key %s: %s", key, err)
+		}
+		if !bytes.Equal(expected, actual) {
+			return report, fmt.Errorf("error verifying key %s: value mismatch", key)
+		}
+		report.Verified[KeyType(key)]++
+	}
+
+	if n := src.Len(); n != len(keys) {
+		return report, fmt.Errorf(
+			"error verifying counts: source has %d keys but copied %d",
+			n, len(keys),
+		)
+	}
+
+	return report, nil
+}
+
+func runMigrate(args []string) error {
+	var from, to string
+
+	fs := flag.NewFlagSet("migrate", flag.ExitOnError)
+	fs.StringVar(&from, "from", "", "source store uri (e.g: bitcask://search.db)")
+	fs.StringVar(&to, "to", "", "destination store uri (e.g: sqlite://golinks.db)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if from == "" || to == "" {
+		fs.Usage()
+		return fmt.Errorf("both -from and -to are required")
+	}
+
+	src, err := OpenStore(from)
+	if err != nil {
+		return fmt.Errorf("error opening source store: %s", err)
+	}
+	defer src.Close()
+
+	dst, err := OpenStore(to)
+	if err != nil {
+		return fmt.Errorf("error opening destination store: %s", err)
+	}
+	defer dst.Close()
+
+	slog.Info("migrating", "from", from, "to", to)
+
+	report, err := Migrate(src, dst)
+	if err != nil {
+		return err
+	}
+
+	report.WriteTo(os.Stdout)
+
+	return nil
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMigrate(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir("", "golinks")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	src, err := OpenStore(filepath.Join(dir, "src.db"))
+	assert.NoError(err)
+	defer src.Close()
+
+	dst, err := OpenStore(filepath.Join(dir, "dst.db"))
+	assert.NoError(err)
+	defer dst.Close()
+
+	assert.NoError(src.Put([]byte("bookmark_g"), []byte("https://google.com")))
+	assert.NoError(src.Put([]byte("bookmark_gh"), []byte("https://github.com")))
+	assert.NoError(src.Put([]byte("history_1"), []byte("g foo")))
+
+	report, err := Migrate(src, dst)
+	assert.NoError(err)
+	assert.Equal(3, report.Total())
+	assert.Equal(2, report.Copied["bookmark"])
+	assert.Equal(2, report.Verified["bookmark"])
+	assert.Equal(1, report.Copied["history"])
+	assert.Equal(1, report.Verified["history"])
+
+	val, err := dst.Get([]byte("bookmark_gh"))
+	assert.NoError(err)
+	assert.Equal("https://github.com", string(val))
+
+	buf := &bytes.Buffer{}
+	_, err = report.WriteTo(buf)
+	assert.NoError(err)
+	assert.Contains(buf.String(), "bookmark")
+	assert.Contains(buf.String(), "history")
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"net"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMQTTPacket(t *testing.T) {
+	assert := assert.New(t)
+
+	body := bytes.Repeat([]byte("x"), 200)
+	packet := mqttPacket(mqttPublish, body)
+	assert.Equal([]byte{mqttPublish, 200, 1}, packet[:3])
+
+	kind, got, err := readMQTTPacket(bufio.NewReader(bytes.NewReader(packet)))
+	assert.NoError(err)
+	assert.Equal(byte(mqttPublish), kind)
+	assert.Equal(body, got)
+}
+
+func TestMQTTConn(t *testing.T) {
+	assert := assert.New(t)
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(err)
+	defer l.Close()
+
+	type packet struct {
+		kind byte
+		body []byte
+	}
+	packets := make(chan packet, 10)
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		r := bufio.NewReader(conn)
+		for {
+			kind, body, err := readMQTTPacket(r)
+			if err != nil {
+				close(packets)
+				return
+			}
+			packets <- packet{kind, body}
+			if kind == mqttConnect {
+				conn.Write([]byte{mqttConnAck, 2, 0, 0})
+			}
+		}
+	}()
+
+	u, err := url.Parse("mqtt://user:pass@" + l.Addr().String())
+	assert.NoError(err)
+
+	conn, err := DialMQTT(u, time.Second)
+	assert.NoError(err)
+
+	assert.NoError(conn.Publish("golinks/redirect", []byte(`{"name":"gh"}`)))
+	assert.NoError(conn.Close())
+
+	connect := <-packets
+	assert.Equal(byte(mqttConnect), connect.kind)
+	assert.Equal(append(mqttString("MQTT"), 4, 0xc2), connect.body[:8])
+	assert.True(bytes.HasSuffix(connect.body, append(mqttString("user"), mqttString("pass")...)))
+
+	publish := <-packets
+	assert.Equal(byte(mqttPublish), publish.kind)
+	assert.Equal(append(mqttString("golinks/redirect"), `{"name":"gh"}`...), publish.body)
+
+	assert.Equal(byte(mqttDisconnect), (<-packets).kind)
+}
+
+func TestDialMQTTRefused(t *testing.T) {
+	assert := assert.New(t)
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(err)
+	defer l.Close()
+
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		readMQTTPacket(bufio.NewReader(conn))
+		conn.Write([]byte{mqttConnAck, 2, 0, 5})
+	}()
+
+	u, err := url.Parse("mqtt://" + l.Addr().String())
+	assert.NoError(err)
+
+	_, err = DialMQTT(u, time.Second)
+	assert.Error(err)
+}
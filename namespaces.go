@@ -0,0 +1,246 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/prologic/bitcask"
+)
+
+const (
+	// PersonalPrefix marks the name of a personal bookmark, e.g: ~gh
+	PersonalPrefix = "~"
+
+	// TeamPrefix marks the name of a team's bookmark, e.g: @infra/gh
+	TeamPrefix = "@"
+)
+
+var (
+	// ErrNoUser is returned when writing personal or team bookmarks without
+	// being logged in (or in multi-user mode)
+	ErrNoUser = errors.New("error: personal and team bookmarks require a logged in user")
+
+	// ErrNotMember is returned when writing bookmarks of a team the user
+	// isn't a member of
+	ErrNotMember = errors.New("error: not a member of the team")
+)
+
+// namespacesKey is the request context key of the namespaces of the user
+// making the request
+const namespacesKey contextKey = "namespaces"
+
+// Namespaces are the bookmarks a user sees in multi-user mode: their
+// personal bookmarks, then those of their teams, then the global ones.
+// Anonymous users (without a User) only see the global bookmarks.
+type Namespaces struct {
+	User  string
+	Teams []string
+
+	// exists reports whether a team has any members
+	exists func(team string) bool
+}
+
+// RequestNamespaces returns the namespaces of the user making the request
+// (without a user if unknown), or nil if not in multi-user mode
+func RequestNamespaces(r *http.Request) *Namespaces {
+	if r == nil {
+		return nil
+	}
+	ns, _ := r.Context().Value(namespacesKey).(*Namespaces)
+	return ns
+}
+
+// withNamespaces returns the request of a user with the namespaces in
+// multi-user mode (unless it already has them)
+func (s *Server) withNamespaces(r *http.Request) *http.Request {
+	if !s.config.MultiUser || RequestNamespaces(r) != nil {
+		return r
+	}
+	ns := &Namespaces{exists: s.teamExists}
+	if user := RequestUser(r); user != "" {
+		ns.User, ns.Teams = user, s.userTeams(user)
+	}
+	return r.WithContext(context.WithValue(r.Context(), namespacesKey, ns))
+}
+
+// ParseTeams parses a comma separated list of users and the team they are
+// a member of, e.g: alice=infra,bob=infra,bob=web
+func ParseTeams(s string) (map[string][]string, error) {
+	teams := make(map[string][]string)
+	for _, member := range strings.Split(s, ",") {
+		member = strings.TrimSpace(member)
+		if member == "" {
+			continue
+		}
+		i := strings.LastIndex(member, "=")
+		team := strings.ToLower(strings.TrimSpace(member[i+1:]))
+		if i <= 0 || team == "" || strings.ContainsAny(team, "/ ") {
+			return nil, fmt.Errorf("invalid team member %q (expected <user>=<team>)", member)
+		}
+		user := strings.TrimSpace(member[:i])
+		teams[user] = append(teams[user], team)
+	}
+	return teams, nil
+}
+
+func personalPrefix(user string) string {
+	return "user/" + url.QueryEscape(user) + "/bookmark_"
+}
+
+func teamPrefix(team string) string {
+	return "team/" + url.QueryEscape(team) + "/bookmark_"
+}
+
+// member reports whether the user is a member of the team
+func (ns *Namespaces) member(team string) bool {
+	return containsString(ns.Teams, team)
+}
+
+// known reports whether the team is one of the user's or has any members,
+// i.e: whether infra/gh names a bookmark of the infra team
+func (ns *Namespaces) known(team string) bool {
+	return ns.member(team) || (ns.exists != nil && ns.exists(team))
+}
+
+// split splits a personal (~gh) or team (@infra/gh or infra/gh for a known
+// team) name into the key prefix it is stored under, its team (if any) and
+// its name without ~ or the team, or returns ok false for global names
+func (ns *Namespaces) split(name string) (prefix, team, bare string, ok bool) {
+	if strings.HasPrefix(name, PersonalPrefix) {
+		return personalPrefix(ns.User), "", strings.TrimPrefix(name, PersonalPrefix), true
+	}
+	if strings.HasPrefix(name, TeamPrefix) {
+		if team, bare, found := strings.Cut(strings.TrimPrefix(name, TeamPrefix), "/"); found {
+			return teamPrefix(team), team, bare, true
+		}
+	}
+	if team, bare, found := strings.Cut(name, "/"); found && ns.known(team) {
+		return teamPrefix(team), team, bare, true
+	}
+	return "", "", name, false
+}
+
+// Lookup looks up a bookmark by name in the personal bookmarks, then those
+// of the teams, then the global ones. Names can also be explicitly
+// personal (~gh) or of a team the user is a member of (@infra/gh or
+// infra/gh).
+func (ns *Namespaces) Lookup(name string) (Bookmark, bool) {
+	if ns == nil || ns.User == "" {
+		return LookupBookmark(name)
+	}
+
+	name = strings.ToLower(name)
+	if prefix, team, bare, ok := ns.split(name); ok {
+		if team != "" && !ns.member(team) {
+			return LookupBookmark(name)
+		}
+		if val, err := getKey(prefix, bare); err == nil {
+			return Bookmark{name: bare, url: string(val)}, true
+		}
+		return Bookmark{}, false
+	}
+
+	prefixes := []string{personalPrefix(ns.User)}
+	for _, team := range ns.Teams {
+		prefixes = append(prefixes, teamPrefix(team))
+	}
+	for _, prefix := range prefixes {
+		if val, err := getKey(prefix, name); err == nil {
+			return Bookmark{name: name, url: string(val)}, true
+		}
+	}
+	if bookmark, ok := LookupBookmark(name); ok {
+		return bookmark, true
+	}
+
+	// Aliases learned from the user's misspellings (see AliasLearner)
+	if target, err := getKey(learnedPrefix(ns.User)+"alias_", name); err == nil {
+		return LookupBookmark(string(target))
+	}
+	return Bookmark{}, false
+}
+
+// writable returns the key prefix a personal (~gh) or team (@infra/gh or
+// infra/gh) bookmark is stored under and its name, or ok false for global names (or
+// any name if not in multi-user mode)
+func (ns *Namespaces) writable(name string) (prefix, bare string, ok bool, err error) {
+	if ns == nil {
+		return "", name, false, nil
+	}
+	if !strings.HasPrefix(name, PersonalPrefix) && !strings.HasPrefix(name, TeamPrefix) {
+		team, _, found := strings.Cut(strings.ToLower(name), "/")
+		if !found || !ns.known(team) {
+			return "", name, false, nil
+		}
+	}
+	if ns.User == "" {
+		return "", "", false, ErrNoUser
+	}
+
+	prefix, team, bare, ok := ns.split(strings.ToLower(name))
+	if !ok || bare == "" || strings.ContainsAny(bare, " \t\r\n") {
+		return "", "", false, fmt.Errorf("invalid name %q (expected ~<name> or @<team>/<name>)", name)
+	}
+	if team != "" && !ns.member(team) {
+		return "", "", false, ErrNotMember
+	}
+	return prefix, bare, true, nil
+}
+
+// List returns the personal bookmarks (named ~<name>) and then those of the
+// teams (named @<team>/<name>)
+func (ns *Namespaces) List() ([]Bookmark, error) {
+	if ns == nil || ns.User == "" {
+		return nil, nil
+	}
+
+	bookmarks, err := listBookmarks(personalPrefix(ns.User), PersonalPrefix)
+	if err != nil {
+		return nil, err
+	}
+	for _, team := range ns.Teams {
+		team, err := listBookmarks(teamPrefix(team), TeamPrefix+team+"/")
+		if err != nil {
+			return nil, err
+		}
+		bookmarks = append(bookmarks, team...)
+	}
+	return bookmarks, nil
+}
+
+// SaveScopedBookmark saves a bookmark, as a personal (~gh) or team
+// (@infra/gh) bookmark of the user if so named. It reports whether it was
+// saved as one, else the caller saves it as a global bookmark.
+func SaveScopedBookmark(r *http.Request, name, url string) (bool, error) {
+	prefix, bare, ok, err := RequestNamespaces(r).writable(name)
+	if !ok || err != nil {
+		return false, err
+	}
+	return true, db.Put([]byte(prefix+bare), []byte(url))
+}
+
+// DeleteScopedBookmark deletes a personal (~gh) or team (@infra/gh)
+// bookmark of the user, or a personal alias learned from their typos. It
+// reports whether the name was of one, else the caller deletes the global
+// bookmark.
+func DeleteScopedBookmark(r *http.Request, name string) (bool, error) {
+	ns := RequestNamespaces(r)
+	prefix, bare, ok, err := ns.writable(name)
+	if !ok || err != nil {
+		return false, err
+	}
+	if err := db.Delete([]byte(prefix + bare)); err != nil && err != bitcask.ErrKeyNotFound {
+		return true, err
+	}
+	if prefix == personalPrefix(ns.User) {
+		alias := []byte(learnedPrefix(ns.User) + "alias_" + bare)
+		if err := db.Delete(alias); err != nil && err != bitcask.ErrKeyNotFound {
+			return true, err
+		}
+	}
+	return true, nil
+}
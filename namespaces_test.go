@@ -0,0 +1,148 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNamespaces(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir("", "golinks")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	db, err = OpenStore(filepath.Join(dir, "test.db"))
+	assert.NoError(err)
+	defer db.Close()
+
+	assert.NoError(SaveBookmark("gh", "https://github.com/%s"))
+	assert.NoError(SaveBookmark("wiki", "https://en.wikipedia.org/wiki/%s"))
+
+	s, err := NewServer(":8000", Config{
+		AuthHeader: "X-Forwarded-User",
+		MultiUser:  true,
+		Teams:      "alice=infra,bob=infra,bob=web",
+	})
+	assert.NoError(err)
+
+	do := func(user, path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r, _ := http.NewRequest("GET", path, nil)
+		r.RemoteAddr = "127.0.0.1:1234"
+		r.Header.Set("X-Forwarded-User", user)
+		s.server.Handler.ServeHTTP(w, r)
+		return w
+	}
+	command := func(user, q string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r := postQuery(url.Values{"q": {q}})
+		r.RemoteAddr = "127.0.0.1:1234"
+		r.Header.Set("X-Forwarded-User", user)
+		s.server.Handler.ServeHTTP(w, r)
+		return w
+	}
+	resolves := func(user, query, location string) {
+		w := do(user, "/?q="+query)
+		assert.Equal(http.StatusFound, w.Code, "%s: %s", user, query)
+		assert.Equal(location, w.Header().Get("Location"), "%s: %s", user, query)
+	}
+
+	assert.Equal(http.StatusOK, command("alice", "add ~gh https://gitlab.com/%s").Code)
+	assert.Equal(http.StatusOK, command("bob", "add @infra/wiki https://wiki.corp/%s").Code)
+	assert.False(db.Has([]byte("bookmark_~gh")))
+
+	// Personal bookmarks come first, then the teams', then the global ones
+	resolves("alice", "gh+golang", "https://gitlab.com/golang")
+	resolves("bob", "gh+golang", "https://github.com/golang")
+	resolves("carol", "gh+golang", "https://github.com/golang")
+	resolves("alice", "wiki+oncall", "https://wiki.corp/oncall")
+	resolves("bob", "wiki+oncall", "https://wiki.corp/oncall")
+	resolves("carol", "wiki+oncall", "https://en.wikipedia.org/wiki/oncall")
+
+	// Names can be explicit, but only for members of the team
+	resolves("bob", "@infra/wiki+oncall", "https://wiki.corp/oncall")
+	resolves("alice", "~gh+golang", "https://gitlab.com/golang")
+	w := do("alice", "/~gh/golang")
+	assert.Equal(http.StatusFound, w.Code)
+	assert.Equal("https://gitlab.com/golang", w.Header().Get("Location"))
+	w = do("carol", "/?q=@infra/wiki+oncall")
+	assert.Equal(http.StatusBadRequest, w.Code)
+
+	// Only members write the bookmarks of a team
+	w = command("carol", "add @infra/gh https://evil.example.com/%s")
+	assert.Equal(http.StatusForbidden, w.Code)
+
+	w = do("bob", "/list?format=json")
+	assert.Equal(http.StatusOK, w.Code)
+	var list struct {
+		Bookmarks []map[string]string `json:"bookmarks"`
+	}
+	assert.NoError(json.Unmarshal(w.Body.Bytes(), &list))
+	assert.Len(list.Bookmarks, 3)
+	assert.Equal("@infra/wiki", list.Bookmarks[0]["name"])
+	assert.Equal("gh", list.Bookmarks[1]["name"])
+
+	assert.Equal(http.StatusOK, command("alice", "remove ~gh").Code)
+	resolves("alice", "gh+golang", "https://github.com/golang")
+	_, ok := LookupBookmark("gh")
+	assert.True(ok)
+}
+
+func TestNamespacesAnonymous(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir("", "golinks")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	db, err = OpenStore(filepath.Join(dir, "test.db"))
+	assert.NoError(err)
+	defer db.Close()
+
+	// Anonymous users only have the global bookmarks
+	s, err := NewServer(":8000", Config{MultiUser: true})
+	assert.NoError(err)
+	add := url.Values{"q": {"add ~gh https://github.com"}}
+	w := httptest.NewRecorder()
+	s.server.Handler.ServeHTTP(w, postQuery(add))
+	assert.Equal(http.StatusUnauthorized, w.Code)
+
+	// Without multi-user mode ~ is just part of the name
+	s, err = NewServer(":8000", Config{})
+	assert.NoError(err)
+	w = httptest.NewRecorder()
+	s.server.Handler.ServeHTTP(w, postQuery(add))
+	assert.Equal(http.StatusOK, w.Code)
+	_, ok := LookupBookmark("~gh")
+	assert.True(ok)
+
+	_, err = NewServer(":8000", Config{Teams: "alice=infra"})
+	assert.Error(err)
+}
+
+func TestParseTeams(t *testing.T) {
+	assert := assert.New(t)
+
+	teams, err := ParseTeams("alice=infra, bob=Infra,bob=web,")
+	assert.NoError(err)
+	assert.Equal(map[string][]string{
+		"alice": {"infra"},
+		"bob":   {"infra", "web"},
+	}, teams)
+
+	_, err = ParseTeams("alice")
+	assert.Error(err)
+	_, err = ParseTeams("alice=")
+	assert.Error(err)
+	_, err = ParseTeams("alice=infra/core")
+	assert.Error(err)
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"bufio"
+	"net"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNATSConn(t *testing.T) {
+	assert := assert.New(t)
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(err)
+	defer l.Close()
+
+	lines := make(chan string, 10)
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		conn.Write([]byte("INFO {\"server_id\":\"test\"}\r\n"))
+		r := bufio.NewReader(conn)
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				close(lines)
+				return
+			}
+			line = strings.TrimSpace(line)
+			lines <- line
+			if line == "PING" {
+				conn.Write([]byte("PONG\r\n"))
+			}
+		}
+	}()
+
+	u, err := url.Parse("nats://secret@" + l.Addr().String())
+	assert.NoError(err)
+
+	conn, err := DialNATS(u, time.Second)
+	assert.NoError(err)
+	defer conn.Close()
+
+	assert.NoError(conn.Publish("golinks.redirect", []byte(`{"name":"gh"}`)))
+	assert.Error(conn.Publish("golinks redirect", nil))
+
+	connect := <-lines
+	assert.True(strings.HasPrefix(connect, "CONNECT "))
+	assert.Contains(connect, `"auth_token":"secret"`)
+	assert.Equal("PING", <-lines)
+	assert.Equal("PUB golinks.redirect 13", <-lines)
+	assert.Equal(`{"name":"gh"}`, <-lines)
+}
+
+func TestDialNATSError(t *testing.T) {
+	assert := assert.New(t)
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(err)
+	defer l.Close()
+
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		conn.Write([]byte("INFO {}\r\n"))
+		bufio.NewReader(conn).ReadString('\n')
+		conn.Write([]byte("-ERR 'Authorization Violation'\r\n"))
+	}()
+
+	u, err := url.Parse("nats://" + l.Addr().String())
+	assert.NoError(err)
+
+	_, err = DialNATS(u, time.Second)
+	assert.Error(err)
+	assert.Contains(err.Error(), "Authorization Violation")
+}
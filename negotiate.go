@@ -0,0 +1,66 @@
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// Formats pages like /list and /history can be served in
+const (
+	FormatHTML = "html"
+	FormatJSON = "json"
+	FormatCSV  = "csv"
+)
+
+var formatMediaTypes = map[string]string{
+	"text/html":        FormatHTML,
+	"application/json": FormatJSON,
+	"text/csv":         FormatCSV,
+}
+
+// negotiateFormat returns the format requested with ?format= or else the
+// one most preferred by the Accept header (HTML if none is acceptable)
+func negotiateFormat(r *http.Request) (string, error) {
+	if format := r.URL.Query().Get("format"); format != "" {
+		switch format = strings.ToLower(format); format {
+		case FormatHTML, FormatJSON, FormatCSV:
+			return format, nil
+		}
+		return "", fmt.Errorf("invalid format %q (expected html, json or csv)", format)
+	}
+
+	best, bestQ := FormatHTML, 0.0
+	for _, accept := range strings.Split(r.Header.Get("Accept"), ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(accept))
+		if err != nil {
+			continue
+		}
+		format, ok := formatMediaTypes[mediaType]
+		if !ok {
+			continue
+		}
+		q := 1.0
+		if v, ok := params["q"]; ok {
+			if q, err = strconv.ParseFloat(v, 64); err != nil {
+				continue
+			}
+		}
+		if q > bestQ {
+			best, bestQ = format, q
+		}
+	}
+	return best, nil
+}
+
+// writeCSV writes a CSV document with a header row
+func writeCSV(w http.ResponseWriter, header []string, rows [][]string) {
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+
+	cw := csv.NewWriter(w)
+	cw.Write(header)
+	cw.WriteAll(rows)
+}
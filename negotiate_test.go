@@ -0,0 +1,89 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNegotiateFormat(t *testing.T) {
+	assert := assert.New(t)
+
+	for _, test := range []struct {
+		url, accept, format string
+	}{
+		{"/list", "", FormatHTML},
+		{"/list", "*/*", FormatHTML},
+		{"/list", "text/html,application/xhtml+xml,*/*;q=0.8", FormatHTML},
+		{"/list", "application/json", FormatJSON},
+		{"/list", "text/html;q=0.5, text/csv", FormatCSV},
+		{"/list", "text/csv;q=0.2, application/json;q=0.9", FormatJSON},
+		{"/list", "application/xml", FormatHTML},
+		{"/list?format=JSON", "text/csv", FormatJSON},
+		{"/list?format=html", "application/json", FormatHTML},
+	} {
+		r, _ := http.NewRequest("GET", test.url, nil)
+		r.Header.Set("Accept", test.accept)
+		format, err := negotiateFormat(r)
+		assert.NoError(err)
+		assert.Equal(test.format, format, "%s %s", test.url, test.accept)
+	}
+
+	r, _ := http.NewRequest("GET", "/list?format=yaml", nil)
+	_, err := negotiateFormat(r)
+	assert.Error(err)
+}
+
+func TestListFormats(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir("", "golinks")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	db, err = OpenStore(filepath.Join(dir, "test.db"))
+	assert.NoError(err)
+	defer db.Close()
+
+	assert.NoError(SaveBookmark("gh", "https://github.com/search?q=%s"))
+
+	s, err := NewServer(":8000", Config{})
+	assert.NoError(err)
+
+	w := httptest.NewRecorder()
+	r, _ := http.NewRequest("GET", "/list?format=json", nil)
+	s.router.ServeHTTP(w, r)
+	assert.Equal(http.StatusOK, w.Code)
+	var res struct {
+		Bookmarks []map[string]string `json:"bookmarks"`
+		Commands  []CommandInfo       `json:"commands"`
+	}
+	assert.NoError(json.Unmarshal(w.Body.Bytes(), &res))
+	assert.Equal([]map[string]string{{"name": "gh", "url": "https://github.com/search?q=%s"}}, res.Bookmarks)
+	assert.Len(res.Commands, len(commands))
+
+	w = httptest.NewRecorder()
+	r, _ = http.NewRequest("GET", "/list", nil)
+	r.Header.Set("Accept", "text/csv")
+	s.router.ServeHTTP(w, r)
+	assert.Equal(http.StatusOK, w.Code)
+	records, err := csv.NewReader(w.Body).ReadAll()
+	assert.NoError(err)
+	assert.Equal([]string{"type", "name", "url", "signature"}, records[0])
+	assert.Equal([]string{"bookmark", "gh", "https://github.com/search?q=%s", ""}, records[1])
+	assert.Equal("command", records[2][0])
+	assert.Len(records, 2+len(commands))
+
+	w = httptest.NewRecorder()
+	r, _ = http.NewRequest("GET", "/list", nil)
+	s.router.ServeHTTP(w, r)
+	assert.Equal(http.StatusOK, w.Code)
+	assert.Contains(w.Body.String(), "<code>gh</code>")
+}
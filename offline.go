@@ -0,0 +1,80 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+)
+
+// ErrOffline is returned for outbound requests attempted in offline mode
+var ErrOffline = errors.New("error: outbound requests are disabled in offline mode")
+
+// offlineTransport fails every request without touching the network
+type offlineTransport struct{}
+
+func (offlineTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	return nil, ErrOffline
+}
+
+// DisableOutboundHTTP makes all requests using the shared http client fail
+// with ErrOffline. This guards against any outbound request slipping through
+// in offline mode (features should check Config.Offline and not try).
+func DisableOutboundHTTP() {
+	client.Transport = offlineTransport{}
+}
+
+// checkOffline returns an error if the configuration requires outbound
+// requests which are not allowed in offline mode.
+func checkOffline(config Config) error {
+	if !config.Offline {
+		return nil
+	}
+	if config.BackupURL != "" {
+		return errors.New("backups (-backup-url) cannot be used in offline mode")
+	}
+	if config.ReplicateTo != "" {
+		return errors.New("replication (-replicate-to) cannot be used in offline mode")
+	}
+	if config.BookmarksURL != "" {
+		return errors.New("remote bookmarks (-bookmarks-url) cannot be used in offline mode")
+	}
+	if config.RaindropToken != "" {
+		return errors.New("raindrop sync (-raindrop-token) cannot be used in offline mode")
+	}
+	if len(config.Peers) > 0 {
+		return errors.New("federation (-peers) cannot be used in offline mode")
+	}
+	if config.XBrowserSyncID != "" {
+		return errors.New("browser sync (-xbrowsersync-id) cannot be used in offline mode")
+	}
+	if config.TelegramToken != "" || config.MatrixURL != "" {
+		return errors.New("bots (-telegram-token and -matrix-url) cannot be used in offline mode")
+	}
+	if config.ReadLater != "" {
+		return errors.New("read-later services (-read-later) cannot be used in offline mode")
+	}
+	if config.EventBus != "" {
+		return errors.New("the event bus (-event-bus) cannot be used in offline mode")
+	}
+	if config.MetricsExport != "" {
+		return errors.New("metrics export (-metrics-export) cannot be used in offline mode")
+	}
+	if len(config.Webhooks) > 0 {
+		return errors.New("webhooks (-webhooks) cannot be used in offline mode")
+	}
+	if config.Catalog != "" {
+		return errors.New("the catalog (-catalog) cannot be used in offline mode")
+	}
+	if isURL(config.Defaults) {
+		return errors.New("remote defaults (-defaults) cannot be used in offline mode")
+	}
+	if config.OIDCIssuer != "" {
+		return errors.New("OpenID Connect logins (-oidc-issuer) cannot be used in offline mode")
+	}
+	if config.GitHubClientID != "" {
+		return errors.New("GitHub logins (-github-client-id) cannot be used in offline mode")
+	}
+	if isRemoteRepo(config.GitRepo) {
+		return errors.New("remote git repositories (-git-repo) cannot be used in offline mode")
+	}
+	return nil
+}
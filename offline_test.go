@@ -0,0 +1,86 @@
+package main
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOfflineTransport(t *testing.T) {
+	assert := assert.New(t)
+
+	c := &http.Client{Transport: offlineTransport{}}
+	_, err := c.Get("http://example.com")
+	assert.Error(err)
+	assert.Contains(err.Error(), ErrOffline.Error())
+}
+
+func TestOfflineConfig(t *testing.T) {
+	assert := assert.New(t)
+
+	_, err := NewServer(":8000", Config{Offline: true, BackupURL: "s3://minio/golinks"})
+	assert.Error(err)
+
+	_, err = NewServer(":8000", Config{Offline: true, ReplicateTo: "http://standby"})
+	assert.Error(err)
+
+	_, err = NewServer(":8000", Config{Offline: true})
+	assert.NoError(err)
+}
+
+func TestOfflineSuggestionsHandler(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir("", "golinks")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	db, err = OpenStore(filepath.Join(dir, "test.db"))
+	assert.NoError(err)
+	defer db.Close()
+
+	assert.NoError(SaveBookmark("go", "https://golang.org"))
+
+	requested := false
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requested = true
+		w.Write([]byte(`["g",["google"]]`))
+	}))
+	defer upstream.Close()
+
+	s, err := NewServer(":8000", Config{Offline: true, SuggestURL: upstream.URL + "/?q=%s"})
+	assert.NoError(err)
+
+	w := httptest.NewRecorder()
+	r, _ := http.NewRequest("GET", "/suggest?q=g", nil)
+	s.SuggestionsHandler()(w, r, httprouter.Params{})
+	assert.Equal(http.StatusOK, w.Code)
+	assert.Equal(`["g",["go"],["https://golang.org"],["https://golang.org"]]`, w.Body.String())
+	assert.False(requested)
+}
+
+func TestOfflineTemplates(t *testing.T) {
+	assert := assert.New(t)
+
+	s, err := NewServer(":8000", Config{Offline: true})
+	assert.NoError(err)
+
+	w := httptest.NewRecorder()
+	r, _ := http.NewRequest("GET", "/help", nil)
+	s.router.ServeHTTP(w, r)
+	assert.Equal(http.StatusOK, w.Code)
+	assert.NotContains(w.Body.String(), "unpkg.com")
+
+	s, err = NewServer(":8000", Config{})
+	assert.NoError(err)
+
+	w = httptest.NewRecorder()
+	s.router.ServeHTTP(w, r)
+	assert.Contains(w.Body.String(), "unpkg.com")
+}
@@ -0,0 +1,379 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+const (
+	// oidcLoginTTL is how long users have to log in with the provider
+	oidcLoginTTL = 10 * time.Minute
+
+	// oidcStateCookie is the cookie of a login in progress
+	oidcStateCookie = "golinks_oidc"
+
+	// OIDCCallbackPath is where the provider redirects users back to
+	OIDCCallbackPath = "/auth/callback"
+)
+
+var (
+	// ErrInvalidIDToken is returned for ID tokens not issued by the
+	// provider for this client and login
+	ErrInvalidIDToken = errors.New("error: invalid id token")
+)
+
+// oidcProvider is the part of the discovery document of an OpenID Connect
+// provider needed to log users in
+type oidcProvider struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+}
+
+// oidcLogin is a login in progress, signed into the state cookie
+type oidcLogin struct {
+	State    string `json:"state"`
+	Nonce    string `json:"nonce"`
+	Verifier string `json:"verifier"`
+	Next     string `json:"next"`
+	Expires  int64  `json:"exp"`
+}
+
+// idTokenClaims are the claims of an ID token checked on login
+type idTokenClaims struct {
+	Issuer        string          `json:"iss"`
+	Subject       string          `json:"sub"`
+	Audience      json.RawMessage `json:"aud"`
+	AuthorizedBy  string          `json:"azp"`
+	Expires       int64           `json:"exp"`
+	Nonce         string          `json:"nonce"`
+	Email         string          `json:"email"`
+	EmailVerified *bool           `json:"email_verified"`
+}
+
+// audiences returns the audience of the token, a string or a list
+func (c idTokenClaims) audiences() []string {
+	var aud string
+	if err := json.Unmarshal(c.Audience, &aud); err == nil {
+		return []string{aud}
+	}
+	var auds []string
+	json.Unmarshal(c.Audience, &auds)
+	return auds
+}
+
+// OIDC logs users in with an OpenID Connect provider (the authorization
+// code flow with PKCE), and sessions keep them logged in, so golinks can be
+// put behind a company's SSO.
+type OIDC struct {
+	sync.Mutex
+
+	issuer       string
+	clientID     string
+	clientSecret string
+	redirectURL  string
+	domains      []string
+	counters     *Counters
+
+	// signer signs the state cookie with a key derived from the client
+	// secret
+	signer
+
+	provider *oidcProvider
+
+	now func() time.Time
+}
+
+// NewOIDC returns an OIDC login with the provider at issuer, optionally
+// only allowing users with a verified email in one of domains
+func NewOIDC(issuer, clientID, clientSecret, redirectURL string, domains []string, counters *Counters) *OIDC {
+	return &OIDC{
+		issuer:       strings.TrimRight(issuer, "/"),
+		clientID:     clientID,
+		clientSecret: clientSecret,
+		redirectURL:  redirectURL,
+		domains:      domains,
+		counters:     counters,
+		signer:       newSigner(clientSecret),
+		now:          time.Now,
+	}
+}
+
+// ParseDomains parses a comma separated list of email domains
+func ParseDomains(s string) []string {
+	var domains []string
+	for _, domain := range strings.Split(s, ",") {
+		domain = strings.ToLower(strings.TrimPrefix(strings.TrimSpace(domain), "@"))
+		if domain != "" {
+			domains = append(domains, domain)
+		}
+	}
+	return domains
+}
+
+// discover fetches the discovery document of the provider (once it has
+// been fetched successfully)
+func (o *OIDC) discover() (*oidcProvider, error) {
+	o.Lock()
+	defer o.Unlock()
+
+	if o.provider != nil {
+		return o.provider, nil
+	}
+
+	res, err := client.Get(o.issuer + "/.well-known/openid-configuration")
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("error discovering %s: unexpected status %s", o.issuer, res.Status)
+	}
+
+	var provider oidcProvider
+	if err := json.NewDecoder(res.Body).Decode(&provider); err != nil {
+		return nil, fmt.Errorf("error discovering %s: %s", o.issuer, err)
+	}
+	if strings.TrimRight(provider.Issuer, "/") != o.issuer {
+		return nil, fmt.Errorf("error discovering %s: issuer mismatch (%s)", o.issuer, provider.Issuer)
+	}
+	if provider.AuthorizationEndpoint == "" || provider.TokenEndpoint == "" {
+		return nil, fmt.Errorf("error discovering %s: missing endpoints", o.issuer)
+	}
+
+	o.provider = &provider
+	return o.provider, nil
+}
+
+// allowed reports whether users with the email can log in
+func (o *OIDC) allowed(claims idTokenClaims) bool {
+	if len(o.domains) == 0 {
+		return true
+	}
+	if claims.EmailVerified != nil && !*claims.EmailVerified {
+		return false
+	}
+	_, domain, ok := strings.Cut(strings.ToLower(claims.Email), "@")
+	if !ok {
+		return false
+	}
+	for _, allowed := range o.domains {
+		if domain == allowed {
+			return true
+		}
+	}
+	return false
+}
+
+// exchange exchanges the code of a login for the claims of the ID token.
+// The ID token comes straight from the token endpoint of the provider over
+// TLS, which authenticates it in place of its signature (OpenID Connect
+// Core 3.1.3.7), so only its claims are checked.
+func (o *OIDC) exchange(provider *oidcProvider, login oidcLogin, code, redirectURL string) (idTokenClaims, error) {
+	var claims idTokenClaims
+
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {redirectURL},
+		"code_verifier": {login.Verifier},
+	}
+	req, err := http.NewRequest("POST", provider.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return claims, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	req.SetBasicAuth(url.QueryEscape(o.clientID), url.QueryEscape(o.clientSecret))
+
+	res, err := client.Do(req)
+	if err != nil {
+		return claims, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return claims, fmt.Errorf("error exchanging code: unexpected status %s", res.Status)
+	}
+
+	var token struct {
+		IDToken string `json:"id_token"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&token); err != nil {
+		return claims, fmt.Errorf("error exchanging code: %s", err)
+	}
+
+	parts := strings.Split(token.IDToken, ".")
+	if len(parts) != 3 {
+		return claims, ErrInvalidIDToken
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return claims, ErrInvalidIDToken
+	}
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return claims, ErrInvalidIDToken
+	}
+
+	audience := false
+	for _, aud := range claims.audiences() {
+		audience = audience || aud == o.clientID
+	}
+	switch {
+	case strings.TrimRight(claims.Issuer, "/") != o.issuer,
+		!audience,
+		claims.AuthorizedBy != "" && claims.AuthorizedBy != o.clientID,
+		claims.Subject == "",
+		claims.Nonce != login.Nonce,
+		o.now().Unix() >= claims.Expires:
+		return claims, ErrInvalidIDToken
+	}
+	return claims, nil
+}
+
+// callbackURL returns the url a provider redirects users back to:
+// redirectURL if set or else the path on the host of the request
+func callbackURL(r *http.Request, redirectURL, path string) string {
+	if redirectURL != "" {
+		return redirectURL
+	}
+	scheme := "http"
+	if secureRequest(r) {
+		scheme = "https"
+	}
+	return fmt.Sprintf("%s://%s%s", scheme, r.Host, path)
+}
+
+// Handler only serves requests to next from logged in users, unless they
+// need no credentials (see authenticated). Pages redirect users to log in
+// and everything else (APIs, writes) is answered with a 401.
+func (o *OIDC) Handler(next http.Handler, sessions *Sessions, replicationSecret string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if authenticated(r, replicationSecret) || loginPage(r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if session, err := sessions.Session(r); err == nil {
+			next.ServeHTTP(w, withUser(r, session.User()))
+			return
+		}
+
+		switch {
+		case strings.HasPrefix(r.URL.Path, "/api/"):
+			WriteAPIError(w, r, http.StatusUnauthorized, ErrCodeUnauthorized, "login required", nil)
+		case r.Method != "GET" && r.Method != "HEAD":
+			http.Error(w, "Unauthorized: login required", http.StatusUnauthorized)
+		default:
+			http.Redirect(w, r, "/auth/login?next="+url.QueryEscape(r.URL.RequestURI()), http.StatusFound)
+		}
+	})
+}
+
+// LoginHandler redirects users to log in with the provider, e.g:
+// /auth/login?next=/?q=gh
+func (s *Server) LoginHandler() httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+		provider, err := s.oidc.discover()
+		if err != nil {
+			slog.Error("error discovering oidc provider", "issuer", s.oidc.issuer, "err", err)
+			http.Error(w, "Bad Gateway: error contacting the login provider", http.StatusBadGateway)
+			return
+		}
+
+		login := oidcLogin{
+			State:    randomString(),
+			Nonce:    randomString(),
+			Verifier: randomString(),
+			Next:     localPath(queryParam(r.URL.RawQuery, "next")),
+			Expires:  s.oidc.now().Add(oidcLoginTTL).Unix(),
+		}
+		value, err := s.oidc.sign(login)
+		if err != nil {
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+		setCookie(w, r, oidcStateCookie, "/auth/", value, oidcLoginTTL)
+
+		challenge := sha256.Sum256([]byte(login.Verifier))
+		params := url.Values{
+			"response_type":         {"code"},
+			"client_id":             {s.oidc.clientID},
+			"redirect_uri":          {callbackURL(r, s.oidc.redirectURL, OIDCCallbackPath)},
+			"scope":                 {"openid email profile"},
+			"state":                 {login.State},
+			"nonce":                 {login.Nonce},
+			"code_challenge":        {base64.RawURLEncoding.EncodeToString(challenge[:])},
+			"code_challenge_method": {"S256"},
+		}
+		sep := "?"
+		if strings.Contains(provider.AuthorizationEndpoint, "?") {
+			sep = "&"
+		}
+		http.Redirect(w, r, provider.AuthorizationEndpoint+sep+params.Encode(), http.StatusFound)
+	}
+}
+
+// CallbackHandler logs users in once the provider redirects them back with
+// a code, and redirects them to where they were going
+func (s *Server) CallbackHandler() httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+		fail := func(status int, msg string) {
+			s.counters.Inc("n_auth_failed")
+			http.Error(w, fmt.Sprintf("%s: %s", http.StatusText(status), msg), status)
+		}
+
+		var login oidcLogin
+		cookie, err := r.Cookie(oidcStateCookie)
+		if err != nil || s.oidc.verify(cookie.Value, &login) != nil || s.oidc.now().Unix() >= login.Expires {
+			fail(http.StatusBadRequest, "login expired, try again")
+			return
+		}
+		setCookie(w, r, oidcStateCookie, "/auth/", "", -time.Second)
+
+		query := r.URL.Query()
+		if query.Get("state") != login.State {
+			fail(http.StatusBadRequest, "invalid login state")
+			return
+		}
+		if msg := query.Get("error"); msg != "" {
+			fail(http.StatusUnauthorized, fmt.Sprintf("login failed (%s)", msg))
+			return
+		}
+
+		provider, err := s.oidc.discover()
+		if err != nil {
+			slog.Error("error discovering oidc provider", "issuer", s.oidc.issuer, "err", err)
+			http.Error(w, "Bad Gateway: error contacting the login provider", http.StatusBadGateway)
+			return
+		}
+
+		claims, err := s.oidc.exchange(provider, login, query.Get("code"), callbackURL(r, s.oidc.redirectURL, OIDCCallbackPath))
+		if err != nil {
+			slog.Warn("error logging in with oidc", "issuer", s.oidc.issuer, "err", err)
+			fail(http.StatusUnauthorized, "login failed")
+			return
+		}
+		if !s.oidc.allowed(claims) {
+			slog.Warn("oidc user not allowed", "sub", claims.Subject, "email", claims.Email)
+			fail(http.StatusForbidden, "your account is not allowed to use golinks")
+			return
+		}
+
+		s.counters.Inc("n_oidc_logins")
+		slog.Info("logged in with oidc", "sub", claims.Subject, "email", claims.Email)
+		s.loginSession(w, r, Session{Subject: claims.Subject, Email: claims.Email}, login.Next)
+	}
+}
@@ -0,0 +1,215 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeIDToken returns an (unsigned) ID token with the claims
+func fakeIDToken(claims map[string]interface{}) string {
+	data, _ := json.Marshal(claims)
+	return "eyJhbGciOiJSUzI1NiJ9." + base64.RawURLEncoding.EncodeToString(data) + ".c2ln"
+}
+
+func TestOIDC(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir("", "golinks")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	db, err = OpenStore(filepath.Join(dir, "test.db"))
+	assert.NoError(err)
+	defer db.Close()
+
+	assert.NoError(SaveBookmark("gh", "https://github.com/%s"))
+	assert.NoError(SaveBookmark("auth", "https://secret.example.com/%s"))
+
+	// A fake provider that logs in whoever asks as alice@example.com
+	var (
+		issuer    string
+		challenge string
+		nonce     string
+	)
+	provider := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/.well-known/openid-configuration":
+			WriteJSON(w, http.StatusOK, map[string]string{
+				"issuer":                 issuer,
+				"authorization_endpoint": issuer + "/authorize",
+				"token_endpoint":         issuer + "/token",
+			})
+		case "/token":
+			id, secret, _ := r.BasicAuth()
+			assert.Equal("golinks", id)
+			assert.Equal("s3cr3t", secret)
+			assert.Equal("c0de", r.FormValue("code"))
+			sum := sha256.Sum256([]byte(r.FormValue("code_verifier")))
+			assert.Equal(challenge, base64.RawURLEncoding.EncodeToString(sum[:]))
+
+			WriteJSON(w, http.StatusOK, map[string]string{
+				"access_token": "access",
+				"id_token": fakeIDToken(map[string]interface{}{
+					"iss":            issuer,
+					"sub":            "1234",
+					"aud":            "golinks",
+					"exp":            time.Now().Add(time.Hour).Unix(),
+					"nonce":          nonce,
+					"email":          "alice@example.com",
+					"email_verified": true,
+				}),
+			})
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer provider.Close()
+	issuer = provider.URL
+
+	s, err := NewServer(":8000", Config{
+		OIDCIssuer:       issuer,
+		OIDCClientID:     "golinks",
+		OIDCClientSecret: "s3cr3t",
+		OIDCDomains:      "example.com",
+	})
+	assert.NoError(err)
+
+	do := func(method, path string, cookies ...*http.Cookie) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r, _ := http.NewRequest(method, path, nil)
+		r.Host = "go.example.com"
+		for _, cookie := range cookies {
+			r.AddCookie(cookie)
+		}
+		s.server.Handler.ServeHTTP(w, r)
+		return w
+	}
+	cookie := func(w *httptest.ResponseRecorder, name string) *http.Cookie {
+		for _, cookie := range w.Result().Cookies() {
+			if cookie.Name == name {
+				return cookie
+			}
+		}
+		return nil
+	}
+
+	// Users are sent to log in, then back to where they were going
+	w := do("GET", "/?q=gh+prologic")
+	assert.Equal(http.StatusFound, w.Code)
+	assert.Equal("/auth/login?next=%2F%3Fq%3Dgh%2Bprologic", w.Header().Get("Location"))
+
+	// Only the login pages are served without logging in, not every
+	// query starting with auth
+	for _, path := range []string{"/auth/foo", "/auth/x/y", "/auth/login/x"} {
+		w = do("GET", path)
+		assert.Equal(http.StatusFound, w.Code, path)
+		assert.True(strings.HasPrefix(w.Header().Get("Location"), "/auth/login?next="), path)
+	}
+
+	w = do("GET", "/auth/login?next=%2F%3Fq%3Dgh%2Bprologic")
+	assert.Equal(http.StatusFound, w.Code)
+	u, err := url.Parse(w.Header().Get("Location"))
+	assert.NoError(err)
+	assert.Equal(issuer+"/authorize", u.Scheme+"://"+u.Host+u.Path)
+	params := u.Query()
+	assert.Equal("golinks", params.Get("client_id"))
+	assert.Equal("http://go.example.com/auth/callback", params.Get("redirect_uri"))
+	assert.Equal("S256", params.Get("code_challenge_method"))
+	challenge, nonce = params.Get("code_challenge"), params.Get("nonce")
+	state := cookie(w, oidcStateCookie)
+	assert.NotNil(state)
+
+	// Forged states are rejected
+	w = do("GET", "/auth/callback?code=c0de&state=forged", state)
+	assert.Equal(http.StatusBadRequest, w.Code)
+
+	w = do("GET", "/auth/callback?code=c0de&state="+params.Get("state"), state)
+	assert.Equal(http.StatusFound, w.Code)
+	assert.Equal("/?q=gh+prologic", w.Header().Get("Location"))
+	session := cookie(w, SessionCookie)
+	assert.NotNil(session)
+	assert.True(session.HttpOnly)
+
+	w = do("GET", "/?q=gh+prologic", session)
+	assert.Equal(http.StatusFound, w.Code)
+	assert.Equal("https://github.com/prologic", w.Header().Get("Location"))
+
+	// Sessions can't be tampered with
+	forged := *session
+	forged.Value = "eyJzdWIiOiJldmUiLCJleHAiOjk5OTk5OTk5OTl9." + session.Value[len(session.Value)-43:]
+	w = do("GET", "/?q=gh", &forged)
+	assert.Equal(http.StatusFound, w.Code)
+	assert.Contains(w.Header().Get("Location"), "/auth/login")
+
+	// APIs answer with a 401 rather than a redirect, but accept tokens
+	w = do("GET", "/api/v1/bookmarks")
+	assert.Equal(http.StatusUnauthorized, w.Code)
+
+	w = httptest.NewRecorder()
+	r, _ := http.NewRequest("GET", "/api/v1/bookmarks", nil)
+	authorize(r, ScopeRead)
+	s.server.Handler.ServeHTTP(w, r)
+	assert.Equal(http.StatusOK, w.Code)
+
+	// Logging out is a form, so other sites can't log users out
+	w = do("POST", "/auth/logout", session)
+	assert.Equal(http.StatusForbidden, w.Code)
+
+	w = httptest.NewRecorder()
+	r, _ = http.NewRequest("POST", "/auth/logout", nil)
+	r.AddCookie(session)
+	withCSRF(r)
+	s.server.Handler.ServeHTTP(w, r)
+	assert.Equal(http.StatusOK, w.Code)
+	assert.Equal(-1, cookie(w, SessionCookie).MaxAge)
+}
+
+func TestOIDCAllowed(t *testing.T) {
+	assert := assert.New(t)
+
+	verified, unverified := true, false
+	o := NewOIDC("https://accounts.example.com", "golinks", "s3cr3t", "", ParseDomains("Example.com, @corp.example.com"), NewCounters())
+
+	assert.True(o.allowed(idTokenClaims{Email: "alice@example.com", EmailVerified: &verified}))
+	assert.True(o.allowed(idTokenClaims{Email: "bob@corp.example.com"}))
+	assert.False(o.allowed(idTokenClaims{Email: "eve@example.com", EmailVerified: &unverified}))
+	assert.False(o.allowed(idTokenClaims{Email: "eve@evil.com", EmailVerified: &verified}))
+	assert.False(o.allowed(idTokenClaims{Subject: "1234"}))
+
+	// Without domains anyone the provider logs in is allowed
+	o = NewOIDC("https://accounts.example.com", "golinks", "s3cr3t", "", nil, NewCounters())
+	assert.True(o.allowed(idTokenClaims{Subject: "1234"}))
+}
+
+func TestOIDCOffline(t *testing.T) {
+	assert := assert.New(t)
+
+	// Logins need the provider, which can't be reached offline
+	_, err := NewServer(":8000", Config{
+		Offline:    true,
+		OIDCIssuer: "https://accounts.example.com", OIDCClientID: "golinks", OIDCClientSecret: "s3cr3t",
+	})
+	assert.EqualError(err, "OpenID Connect logins (-oidc-issuer) cannot be used in offline mode")
+}
+
+func TestLocalPath(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.Equal("/?q=gh", localPath("/?q=gh"))
+	assert.Equal("/", localPath("https://evil.com"))
+	assert.Equal("/", localPath("//evil.com"))
+	assert.Equal("/", localPath("/\\evil.com"))
+	assert.Equal("/", localPath(""))
+}
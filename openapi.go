@@ -0,0 +1,823 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+// OpenAPIVersion is the version of the OpenAPI specification served
+const OpenAPIVersion = "3.0.3"
+
+// object is a JSON object of the OpenAPI specification
+type object map[string]interface{}
+
+func ref(schema string) object {
+	return object{"$ref": "#/components/schemas/" + schema}
+}
+
+func arrayOf(schema object) object {
+	return object{"type": "array", "items": schema}
+}
+
+func jsonContent(schema object) object {
+	return object{"application/json": object{"schema": schema}}
+}
+
+func response(description string, schema object) object {
+	res := object{"description": description}
+	if schema != nil {
+		res["content"] = jsonContent(schema)
+	}
+	return res
+}
+
+// documentPath describes the bookmarks document served as JSON or YAML
+func documentPath(format, mediaType string) object {
+	content := object{mediaType: object{"schema": ref("BookmarksDocument")}}
+	ifMatch := parameter("If-Match", "header", "ETag of the document the update is based on", false, stringSchema)
+	dryRun := parameter("dry_run", "query", "Report what would change without saving anything", false, booleanSchema)
+
+	get := operation(
+		"getBookmarksDocument"+format, "Get all bookmarks as a "+format+" document", ScopeRead,
+		[]object{parameter("If-None-Match", "header", "ETag of a previously read document", false, stringSchema)}, nil,
+		object{
+			"200": object{"description": "The bookmarks document (with its ETag)", "content": content},
+			"304": object{"description": "The document has not changed"},
+		},
+	)
+	put := operation(
+		"replaceBookmarksDocument"+format, "Replace all bookmarks with a "+format+" document", ScopeWrite,
+		[]object{ifMatch, dryRun}, ref("BookmarksDocument"),
+		object{
+			"200": response("What changed", ref("DocumentResult")),
+			"400": errorResponse("Invalid document"),
+			"412": errorResponse("The bookmarks have changed since the document was read"),
+		},
+	)
+	put["responses"].(object)["403"] = errorResponse("Token does not have the write scope (or the admin scope to change settings)")
+	put["requestBody"] = object{"required": true, "content": content}
+
+	return object{"get": get, "put": put}
+}
+
+func errorResponse(description string) object {
+	return response(description, ref("Error"))
+}
+
+func parameter(name, in, description string, required bool, schema object) object {
+	return object{
+		"name":        name,
+		"in":          in,
+		"description": description,
+		"required":    required,
+		"schema":      schema,
+	}
+}
+
+var (
+	stringSchema  = object{"type": "string"}
+	integerSchema = object{"type": "integer"}
+	booleanSchema = object{"type": "boolean"}
+	timeSchema    = object{"type": "string", "format": "date-time"}
+)
+
+// operation describes an endpoint requiring a token with the given scope
+// (or none if the scope is empty)
+func operation(id, summary, scope string, params []object, body object, responses object) object {
+	op := object{
+		"operationId": id,
+		"summary":     summary,
+		"responses":   responses,
+	}
+	if len(params) > 0 {
+		op["parameters"] = params
+	}
+	if body != nil {
+		op["requestBody"] = object{"required": true, "content": jsonContent(body)}
+	}
+	if scope == "" {
+		op["security"] = []object{}
+	} else {
+		op["description"] = fmt.Sprintf("Requires a token with the `%s` scope.", scope)
+		responses["401"] = errorResponse("Missing or invalid token")
+		responses["403"] = errorResponse(fmt.Sprintf("Token does not have the %s scope", scope))
+	}
+	return op
+}
+
+// OpenAPISpec returns the OpenAPI specification of the REST API
+func (s *Server) OpenAPISpec() object {
+	name := parameter("name", "path", "Name of the bookmark (may contain slashes)", true, stringSchema)
+
+	spec := object{
+		"openapi": OpenAPIVersion,
+		"info": object{
+			"title":       fmt.Sprintf("%s API", s.settings().Title),
+			"description": "REST API of golinks, a smart bookmarks and search engine.",
+			"version":     Version,
+		},
+		"security": []object{{"bearer": []string{}}},
+		"paths": object{
+			"/api/v1/resolve": object{
+				"get": operation(
+					"resolveBookmark", "Resolve a bookmark by name or alias", "",
+					[]object{parameter("name", "query", "Name or alias of the bookmark", true, stringSchema)},
+					nil,
+					object{
+						"200": response("The resolved bookmark", ref("Resolution")),
+						"400": errorResponse("Missing name"),
+						"404": errorResponse("No such bookmark"),
+					},
+				),
+			},
+			"/api/v1/version": object{
+				"get": operation(
+					"getVersion", "Get the version, build and enabled features of the server", "",
+					nil,
+					nil,
+					object{"200": response("The version of the server", ref("Version"))},
+				),
+			},
+			PublicBookmarksPath: object{
+				"get": operation(
+					"listPublicBookmarks", "List the public bookmarks (those tagged with the publish tag)", "",
+					[]object{parameter("If-None-Match", "header", "ETag of a previously read catalog", false, stringSchema)},
+					nil,
+					object{
+						"200": response("The public bookmarks (with their ETag), sorted by name", ref("PublicCatalog")),
+						"304": object{"description": "The public bookmarks have not changed"},
+						"404": errorResponse("No bookmarks are published"),
+					},
+				),
+			},
+			"/api/v1/bookmarks": object{
+				"get": operation(
+					"listBookmarks", "List bookmarks", ScopeRead,
+					[]object{parameter(
+						"target", "query",
+						"Only list bookmarks pointing at this domain (or its subdomains)",
+						false, stringSchema,
+					)},
+					nil,
+					object{
+						"200": response("The bookmarks", object{
+							"type": "object",
+							"properties": object{
+								"bookmarks": arrayOf(ref("Bookmark")),
+							},
+						}),
+						"400": errorResponse("Invalid target"),
+					},
+				),
+				"post": operation(
+					"createBookmark", "Create a bookmark", ScopeWrite,
+					nil, ref("Bookmark"),
+					object{
+						"201": response("The created bookmark", ref("Bookmark")),
+						"400": errorResponse("Invalid bookmark"),
+						"409": errorResponse("Bookmark already exists"),
+					},
+				),
+			},
+			"/api/v1/bookmarks.json": documentPath("JSON", "application/json"),
+			"/api/v1/bookmarks.yaml": documentPath("YAML", "application/yaml"),
+			"/api/v1/bookmarks/bulk": object{
+				"post": operation(
+					"bulkSaveBookmarks", "Create or update many bookmarks at once", ScopeWrite,
+					nil, ref("BulkRequest"),
+					object{
+						"200": response("The outcome of each bookmark", ref("BulkSummary")),
+						"400": errorResponse("Invalid request or too many bookmarks"),
+					},
+				),
+			},
+			"/api/v1/bookmarks/{name}": object{
+				"get": operation(
+					"getBookmark", "Get a bookmark", ScopeRead,
+					[]object{name}, nil,
+					object{
+						"200": response("The bookmark", ref("Bookmark")),
+						"404": errorResponse("No such bookmark"),
+					},
+				),
+				"put": operation(
+					"updateBookmark", "Update a bookmark's url", ScopeWrite,
+					[]object{name}, ref("Bookmark"),
+					object{
+						"200": response("The updated bookmark", ref("Bookmark")),
+						"400": errorResponse("Invalid bookmark"),
+						"404": errorResponse("No such bookmark"),
+					},
+				),
+				"delete": operation(
+					"deleteBookmark", "Delete a bookmark", ScopeWrite,
+					[]object{name}, nil,
+					object{
+						"204": response("Deleted", nil),
+						"404": errorResponse("No such bookmark"),
+					},
+				),
+			},
+			"/api/v1/commands": object{
+				"get": operation(
+					"listCommands", "List commands", ScopeRead, nil, nil,
+					object{
+						"200": response("The commands", object{
+							"type": "object",
+							"properties": object{
+								"commands": arrayOf(ref("Command")),
+							},
+						}),
+					},
+				),
+			},
+			"/api/v1/links": object{
+				"get": operation(
+					"listLinks", "List the results of the last link check", ScopeRead,
+					[]object{parameter("broken", "query", "Only list broken links", false, booleanSchema)},
+					nil,
+					object{
+						"200": response("The link statuses", object{
+							"type": "object",
+							"properties": object{
+								"links": arrayOf(ref("LinkStatus")),
+							},
+						}),
+					},
+				),
+			},
+			"/api/v1/links/archive/{name}": object{
+				"post": operation(
+					"archiveLink", "Substitute the archived copy of a bookmark's rotten link", ScopeWrite,
+					[]object{name}, nil,
+					object{
+						"200": response("The archived link", ref("ArchivedLink")),
+						"404": errorResponse("No such bookmark"),
+						"409": errorResponse("Link is not broken for long or has no archived copy"),
+					},
+				),
+			},
+			"/api/v1/hits": object{
+				"get": operation(
+					"listHits", "List how often each bookmark and command was used, most used first", ScopeRead,
+					[]object{parameter("kind", "query", "Only list bookmarks, commands or peers", false, object{
+						"type": "string", "enum": []string{HitBookmark, HitCommand, HitPeer},
+					})},
+					nil,
+					object{
+						"200": response("The hits (including unused bookmarks)", object{
+							"type":       "object",
+							"properties": object{"hits": arrayOf(ref("HitStats"))},
+						}),
+						"400": errorResponse("Invalid kind"),
+					},
+				),
+			},
+			"/api/v1/feedback": object{
+				"get": operation(
+					"listFeedback", "List whether each bookmark took people to the right place, most misleading first", ScopeRead,
+					nil, nil,
+					object{
+						"200": response("The feedback", object{
+							"type":       "object",
+							"properties": object{"feedback": arrayOf(ref("Feedback"))},
+						}),
+					},
+				),
+			},
+			"/api/v1/usage": object{
+				"get": object{
+					"operationId": "listUsage",
+					"summary":     "List the daily usage of commands and bookmarks",
+					"description": "Requires a token with the `read` scope. Days are rolled up from the history after they end (UTC).",
+					"parameters": []object{
+						parameter("from", "query", "First day (YYYY-MM-DD)", false, object{"type": "string", "format": "date"}),
+						parameter("to", "query", "Last day (YYYY-MM-DD)", false, object{"type": "string", "format": "date"}),
+						parameter("format", "query", "json (default) or csv", false, object{"type": "string", "enum": []string{FormatJSON, FormatCSV}}),
+					},
+					"responses": object{
+						"200": object{
+							"description": "The daily usage, oldest first",
+							"content": object{
+								"application/json": object{"schema": object{
+									"type": "object",
+									"properties": object{
+										"days": arrayOf(ref("DailyUsage")),
+									},
+								}},
+								"text/csv": object{"schema": stringSchema},
+							},
+						},
+						"400": errorResponse("Invalid date"),
+						"401": errorResponse("Missing or invalid token"),
+						"403": errorResponse("Token does not have the read scope"),
+					},
+				},
+			},
+			"/api/v1/history": object{
+				"delete": object{
+					"operationId": "clearHistory",
+					"summary":     "Clear the history",
+					"description": "Requires a token with the `write` scope. Cleared entries are moved to the trash and can be restored by an admin until they expire.",
+					"responses": object{
+						"200": response("The number of entries cleared", object{
+							"type": "object",
+							"properties": object{
+								"cleared": integerSchema,
+								"expires": timeSchema,
+							},
+						}),
+						"401": errorResponse("Missing or invalid token"),
+						"403": errorResponse("Token does not have the write scope or the instance is read-only"),
+					},
+				},
+			},
+			"/api/v1/history/trash": object{
+				"get": object{
+					"operationId": "listHistoryTrash",
+					"summary":     "List the cleared history that can be restored",
+					"description": "Requires a token with the `admin` scope.",
+					"responses": object{
+						"200": response("The cleared entries, oldest first", object{
+							"type": "object",
+							"properties": object{
+								"entries": arrayOf(ref("TrashedHistoryEntry")),
+							},
+						}),
+						"401": errorResponse("Missing or invalid token"),
+						"403": errorResponse("Token does not have the admin scope"),
+					},
+				},
+			},
+			"/api/v1/history/trash/restore": object{
+				"post": object{
+					"operationId": "restoreHistory",
+					"summary":     "Restore the cleared history that has not expired",
+					"description": "Requires a token with the `admin` scope.",
+					"responses": object{
+						"200": response("The number of entries restored", object{
+							"type": "object",
+							"properties": object{
+								"restored": integerSchema,
+							},
+						}),
+						"401": errorResponse("Missing or invalid token"),
+						"403": errorResponse("Token does not have the admin scope or the instance is read-only"),
+					},
+				},
+			},
+			"/api/v1/import": object{
+				"post": object{
+					"operationId": "importBookmarks",
+					"summary":     "Import bookmarks from a browser, Pinboard or CSV export",
+					"description": "Requires a token with the `write` scope.",
+					"parameters": []object{
+						parameter("rules", "query", "Import rules as JSON: folder_tags, folders, titles and on_conflict (suffix, skip or overwrite)", false, stringSchema),
+					},
+					"requestBody": object{
+						"required": true,
+						"content": object{
+							"multipart/form-data": object{"schema": object{
+								"type": "object",
+								"properties": object{
+									"file":  object{"type": "string", "format": "binary"},
+									"rules": object{"type": "string", "description": "Import rules as JSON, as the rules parameter"},
+								},
+							}},
+							"text/html":        object{"schema": stringSchema},
+							"text/csv":         object{"schema": stringSchema},
+							"application/json": object{"schema": object{}},
+						},
+					},
+					"responses": object{
+						"200": response("What was imported", ref("ImportSummary")),
+						"400": errorResponse("Invalid bookmarks file or import rules"),
+						"401": errorResponse("Missing or invalid token"),
+						"403": errorResponse("Token does not have the write scope"),
+					},
+				},
+			},
+			"/api/v1/reading": object{
+				"get": operation(
+					"listReading", "List the pages saved for later, newest first", ScopeRead,
+					[]object{parameter("limit", "query", "Maximum number of pages (default 50, at most 500)", false, integerSchema)},
+					nil,
+					object{
+						"200": response("The saved pages", object{
+							"type": "object",
+							"properties": object{
+								"items": arrayOf(ref("ReadingItem")),
+							},
+						}),
+						"400": errorResponse("Invalid limit"),
+					},
+				),
+				"post": operation(
+					"saveReading", "Save a page to the read-later service", ScopeWrite,
+					nil, ref("ReadingRequest"),
+					object{
+						"201": response("The saved page", ref("ReadingItem")),
+						"400": errorResponse("Invalid url"),
+						"404": errorResponse("No read-later service is configured"),
+						"502": errorResponse("The read-later service failed"),
+					},
+				),
+			},
+			"/api/v1/admin/config": object{
+				"get": operation(
+					"getSettings", "Get the runtime settings", ScopeAdmin, nil, nil,
+					object{
+						"200": response("The settings", ref("Settings")),
+					},
+				),
+				"patch": operation(
+					"updateSettings", "Change runtime settings, persisted to the store", ScopeAdmin,
+					nil, ref("Settings"),
+					object{
+						"200": response("The settings", ref("Settings")),
+						"400": errorResponse("Invalid settings"),
+					},
+				),
+			},
+			"/api/v1/admin/teams": object{
+				"get": operation(
+					"listTeams", "List the teams and their members (in multi-user mode)", ScopeAdmin, nil, nil,
+					object{
+						"200": response("The teams", object{
+							"type": "object",
+							"properties": object{
+								"teams": arrayOf(ref("Team")),
+							},
+						}),
+					},
+				),
+			},
+			"/api/v1/admin/teams/{team}/members/{user}": object{
+				"put": operation(
+					"addTeamMember", "Make a user a member of a team", ScopeAdmin,
+					[]object{
+						parameter("team", "path", "Name of the team", true, stringSchema),
+						parameter("user", "path", "The user", true, stringSchema),
+					},
+					nil,
+					object{
+						"204": response("Added", nil),
+						"400": errorResponse("Invalid team name"),
+					},
+				),
+				"delete": operation(
+					"removeTeamMember", "Remove a user from a team", ScopeAdmin,
+					[]object{
+						parameter("team", "path", "Name of the team", true, stringSchema),
+						parameter("user", "path", "The user", true, stringSchema),
+					},
+					nil,
+					object{
+						"204": response("Removed", nil),
+						"404": errorResponse("No such team member"),
+						"409": errorResponse("Member of the team from -teams"),
+					},
+				),
+			},
+			"/api/v1/tokens": object{
+				"get": operation(
+					"listTokens", "List API tokens", ScopeAdmin, nil, nil,
+					object{
+						"200": response("The tokens", object{
+							"type": "object",
+							"properties": object{
+								"tokens": arrayOf(ref("Token")),
+							},
+						}),
+					},
+				),
+				"post": operation(
+					"createToken", "Create an API token", ScopeAdmin,
+					nil, ref("TokenRequest"),
+					object{
+						"201": response("The token and its secret (only shown once)", object{
+							"type": "object",
+							"properties": object{
+								"token":  ref("Token"),
+								"secret": stringSchema,
+							},
+						}),
+						"400": errorResponse("Invalid scopes"),
+					},
+				),
+			},
+			"/api/v1/tokens/{id}": object{
+				"delete": operation(
+					"revokeToken", "Revoke an API token", ScopeAdmin,
+					[]object{parameter("id", "path", "Id of the token", true, stringSchema)},
+					nil,
+					object{
+						"204": response("Revoked", nil),
+						"404": errorResponse("No such token"),
+					},
+				),
+			},
+		},
+		"components": object{
+			"securitySchemes": object{
+				"bearer": object{
+					"type":        "http",
+					"scheme":      "bearer",
+					"description": "API token with the read, write or admin scope",
+				},
+			},
+			"schemas": object{
+				"Error": object{
+					"type":     "object",
+					"required": []string{"error"},
+					"properties": object{
+						"error": object{
+							"type":     "object",
+							"required": []string{"code", "message"},
+							"properties": object{
+								"code": object{"type": "string", "enum": []string{
+									ErrCodeBadRequest, ErrCodeUnauthorized, ErrCodeForbidden,
+									ErrCodeNotFound, ErrCodeConflict, ErrCodeUpstream, ErrCodeInternal,
+								}},
+								"message":    stringSchema,
+								"details":    object{},
+								"request_id": stringSchema,
+							},
+						},
+					},
+				},
+				"Bookmark": object{
+					"type":     "object",
+					"required": []string{"url"},
+					"properties": object{
+						"name":  stringSchema,
+						"url":   object{"type": "string", "description": "URL with %s substituted by the query"},
+						"owner": object{"type": "string", "description": "User who created the bookmark (if known)"},
+					},
+				},
+				"BookmarksDocument": object{
+					"type":     "object",
+					"required": []string{"bookmarks"},
+					"properties": object{
+						"bookmarks": object{
+							"type": "object",
+							"additionalProperties": object{
+								"type":     "object",
+								"required": []string{"url"},
+								"properties": object{
+									"url":         stringSchema,
+									"aliases":     arrayOf(stringSchema),
+									"tags":        arrayOf(stringSchema),
+									"description": stringSchema,
+								},
+							},
+						},
+						"settings": ref("Settings"),
+					},
+				},
+				"DocumentResult": object{
+					"type": "object",
+					"properties": object{
+						"dry_run":   booleanSchema,
+						"etag":      stringSchema,
+						"created":   arrayOf(stringSchema),
+						"updated":   arrayOf(stringSchema),
+						"removed":   arrayOf(stringSchema),
+						"unchanged": integerSchema,
+						"settings":  booleanSchema,
+					},
+				},
+				"HitStats": object{
+					"type": "object",
+					"properties": object{
+						"kind":            object{"type": "string", "enum": []string{HitBookmark, HitCommand, HitPeer}},
+						"name":            stringSchema,
+						"hits":            integerSchema,
+						"last_hit":        timeSchema,
+						"mean_latency_ms": object{"type": "number"},
+					},
+				},
+				"BulkRequest": object{
+					"type":     "object",
+					"required": []string{"bookmarks"},
+					"properties": object{
+						"bookmarks": arrayOf(ref("Bookmark")),
+						"replace":   object{"type": "boolean", "description": "Update existing bookmarks instead of reporting a conflict"},
+						"dry_run":   object{"type": "boolean", "description": "Report what would happen without saving anything"},
+					},
+				},
+				"BulkSummary": object{
+					"type": "object",
+					"properties": object{
+						"dry_run":   booleanSchema,
+						"created":   integerSchema,
+						"updated":   integerSchema,
+						"unchanged": integerSchema,
+						"failed":    integerSchema,
+						"results": arrayOf(object{
+							"type": "object",
+							"properties": object{
+								"index": integerSchema,
+								"name":  stringSchema,
+								"url":   stringSchema,
+								"status": object{"type": "string", "enum": []string{
+									BulkCreated, BulkUpdated, BulkUnchanged, BulkConflict, BulkInvalid, BulkFailed,
+								}},
+								"error": stringSchema,
+							},
+						}),
+					},
+				},
+				"Resolution": object{
+					"type": "object",
+					"properties": object{
+						"name": stringSchema,
+						"url":  stringSchema,
+						"peer": object{"type": "string", "description": "Peer the name was resolved by (if any)"},
+					},
+				},
+				"Version": object{
+					"type": "object",
+					"properties": object{
+						"version":    stringSchema,
+						"commit":     stringSchema,
+						"build_date": stringSchema,
+						"go_version": stringSchema,
+						"features":   arrayOf(stringSchema),
+					},
+				},
+				"Command": object{
+					"type": "object",
+					"properties": object{
+						"name":        stringSchema,
+						"description": stringSchema,
+						"signature":   stringSchema,
+						"args":        arrayOf(stringSchema),
+						"uses":        integerSchema,
+					},
+				},
+				"LinkStatus": object{
+					"type": "object",
+					"properties": object{
+						"name":         stringSchema,
+						"url":          stringSchema,
+						"ok":           booleanSchema,
+						"status":       integerSchema,
+						"error":        stringSchema,
+						"checked":      timeSchema,
+						"broken_since": timeSchema,
+						"archive":      stringSchema,
+					},
+				},
+				"ArchivedLink": object{
+					"type": "object",
+					"properties": object{
+						"name":     stringSchema,
+						"url":      stringSchema,
+						"archive":  stringSchema,
+						"archived": timeSchema,
+					},
+				},
+				"Feedback": object{
+					"type": "object",
+					"properties": object{
+						"name":      stringSchema,
+						"yes":       integerSchema,
+						"no":        integerSchema,
+						"last_vote": timeSchema,
+					},
+				},
+				"DailyUsage": object{
+					"type": "object",
+					"properties": object{
+						"date":      object{"type": "string", "format": "date"},
+						"total":     integerSchema,
+						"commands":  object{"type": "object", "additionalProperties": integerSchema},
+						"bookmarks": object{"type": "object", "additionalProperties": integerSchema},
+						"fallback":  integerSchema,
+					},
+				},
+				"PublicCatalog": object{
+					"type": "object",
+					"properties": object{
+						"bookmarks": arrayOf(object{
+							"type": "object",
+							"properties": object{
+								"name":        stringSchema,
+								"url":         stringSchema,
+								"description": stringSchema,
+								"tags":        arrayOf(stringSchema),
+								"modified":    timeSchema,
+							},
+						}),
+					},
+				},
+				"TrashedHistoryEntry": object{
+					"type": "object",
+					"properties": object{
+						"entry": object{
+							"type": "object",
+							"properties": object{
+								"id":    stringSchema,
+								"time":  timeSchema,
+								"query": stringSchema,
+								"name":  stringSchema,
+								"url":   stringSchema,
+								"user":  stringSchema,
+							},
+						},
+						"deleted": timeSchema,
+					},
+				},
+				"ImportSummary": object{
+					"type": "object",
+					"properties": object{
+						"added":       integerSchema,
+						"exists":      integerSchema,
+						"skipped":     integerSchema,
+						"overwritten": integerSchema,
+						"failed":      integerSchema,
+						"results": arrayOf(object{
+							"type": "object",
+							"properties": object{
+								"name":   stringSchema,
+								"title":  stringSchema,
+								"url":    stringSchema,
+								"status": object{"type": "string", "enum": []string{ImportAdded, ImportExists, ImportSkipped, ImportOverwritten, ImportFailed}},
+								"error":  stringSchema,
+							},
+						}),
+					},
+				},
+				"ReadingItem": object{
+					"type": "object",
+					"properties": object{
+						"id":      stringSchema,
+						"time":    timeSchema,
+						"url":     stringSchema,
+						"title":   stringSchema,
+						"service": object{"type": "string", "enum": []string{"pocket", "instapaper", "wallabag"}},
+					},
+				},
+				"ReadingRequest": object{
+					"type":     "object",
+					"required": []string{"url"},
+					"properties": object{
+						"url":   stringSchema,
+						"title": stringSchema,
+					},
+				},
+				"Settings": object{
+					"type": "object",
+					"properties": object{
+						"url":         object{"type": "string", "description": "Default url queries matching no bookmark go to, with %s for the query"},
+						"suggest_url": object{"type": "string", "description": "Url of the suggestions service, with %s for the query"},
+						"title":       stringSchema,
+					},
+				},
+				"Team": object{
+					"type": "object",
+					"properties": object{
+						"name":    stringSchema,
+						"members": arrayOf(stringSchema),
+					},
+				},
+				"Token": object{
+					"type": "object",
+					"properties": object{
+						"id":      stringSchema,
+						"name":    stringSchema,
+						"scopes":  arrayOf(object{"type": "string", "enum": []string{ScopeRead, ScopeWrite, ScopeAdmin}}),
+						"created": timeSchema,
+					},
+				},
+				"TokenRequest": object{
+					"type":     "object",
+					"required": []string{"scopes"},
+					"properties": object{
+						"name":   stringSchema,
+						"scopes": arrayOf(object{"type": "string", "enum": []string{ScopeRead, ScopeWrite, ScopeAdmin}}),
+					},
+				},
+			},
+		},
+	}
+
+	if s.config.FQDN != "" {
+		spec["servers"] = []object{{"url": fmt.Sprintf("http://%s", s.config.FQDN)}}
+	}
+
+	return spec
+}
+
+// OpenAPIHandler serves the OpenAPI specification of the REST API
+func (s *Server) OpenAPIHandler() httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+		s.counters.Inc("n_openapi")
+
+		w.Header().Set("Access-Control-Allow-Origin", "*")
+		WriteJSON(w, http.StatusOK, s.OpenAPISpec())
+	}
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOpenAPIHandler(t *testing.T) {
+	assert := assert.New(t)
+
+	s, err := NewServer(":8000", Config{Title: "Search", FQDN: "go.corp"})
+	assert.NoError(err)
+
+	w := httptest.NewRecorder()
+	r, _ := http.NewRequest("GET", "/api/v1/openapi.json", nil)
+	s.router.ServeHTTP(w, r)
+	assert.Equal(http.StatusOK, w.Code)
+	assert.Contains(w.Header().Get("Content-Type"), "application/json")
+
+	var spec struct {
+		OpenAPI string `json:"openapi"`
+		Servers []struct {
+			URL string `json:"url"`
+		} `json:"servers"`
+		Paths      map[string]map[string]json.RawMessage `json:"paths"`
+		Components struct {
+			Schemas map[string]json.RawMessage `json:"schemas"`
+		} `json:"components"`
+	}
+	assert.NoError(json.Unmarshal(w.Body.Bytes(), &spec))
+	assert.Equal(OpenAPIVersion, spec.OpenAPI)
+	assert.Equal("http://go.corp", spec.Servers[0].URL)
+
+	// Every API route is described
+	for path, methods := range map[string][]string{
+		"/api/v1/resolve":               {"get"},
+		"/api/v1/version":               {"get"},
+		"/api/v1/bookmarks":             {"get", "post"},
+		"/api/v1/bookmarks.json":        {"get", "put"},
+		"/api/v1/bookmarks.yaml":        {"get", "put"},
+		"/api/v1/bookmarks/bulk":        {"post"},
+		"/api/v1/bookmarks/{name}":      {"get", "put", "delete"},
+		"/api/v1/commands":              {"get"},
+		"/api/v1/links":                 {"get"},
+		"/api/v1/links/archive/{name}":  {"post"},
+		"/api/v1/hits":                  {"get"},
+		"/api/v1/usage":                 {"get"},
+		"/api/v1/history":               {"delete"},
+		"/api/v1/history/trash":         {"get"},
+		"/api/v1/history/trash/restore": {"post"},
+		"/api/v1/import":                {"post"},
+		"/api/v1/reading":               {"get", "post"},
+		"/api/v1/admin/config":          {"get", "patch"},
+		"/api/v1/tokens":                {"get", "post"},
+		"/api/v1/tokens/{id}":           {"delete"},
+	} {
+		for _, method := range methods {
+			_, ok := spec.Paths[path][method]
+			assert.True(ok, "%s %s", method, path)
+		}
+	}
+
+	// Every referenced schema exists
+	body := w.Body.String()
+	prefix := `"$ref":"#/components/schemas/`
+	for _, part := range strings.Split(body, prefix)[1:] {
+		name := part[:strings.Index(part, `"`)]
+		_, ok := spec.Components.Schemas[name]
+		assert.True(ok, name)
+	}
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/namsral/flag"
+)
+
+type configLine struct {
+	line  int
+	name  string
+	value string
+	bare  bool
+}
+
+// ParseConfigFile parses a configuration file of "key value" (or
+// key=value) lines into the flag set. Settings can be grouped into named
+// profiles with [name] headers; settings before the first header apply to
+// all profiles and the given profile's settings take precedence over them:
+//
+//	title Search
+//
+//	[dev]
+//	fqdn localhost:8000
+//
+//	[prod]
+//	fqdn go.example.com
+//
+// Flags already set (on the command line or from the environment) are never
+// overridden. It is an error to select a profile that does not exist.
+func ParseConfigFile(fs *flag.FlagSet, path, profile string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	var (
+		common   []configLine
+		sections = make(map[string][]configLine)
+		section  string
+		n        int
+	)
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		n++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+			section = strings.TrimSpace(line[1 : len(line)-1])
+			if section == "" {
+				return fmt.Errorf("%s:%d: empty profile name", path, n)
+			}
+			if _, ok := sections[section]; !ok {
+				sections[section] = nil
+			}
+			continue
+		}
+
+		cl := configLine{line: n, name: line, bare: true}
+		if i := strings.IndexAny(line, "= "); i >= 0 {
+			cl.name, cl.value, cl.bare = line[:i], strings.TrimSpace(line[i+1:]), false
+		}
+
+		if section == "" {
+			common = append(common, cl)
+		} else {
+			sections[section] = append(sections[section], cl)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+
+	var lines []configLine
+	if profile != "" {
+		selected, ok := sections[profile]
+		if !ok {
+			return fmt.Errorf("%s: no such profile %q", path, profile)
+		}
+		lines = append(lines, selected...)
+	}
+	lines = append(lines, common...)
+
+	set := make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) {
+		set[f.Name] = true
+	})
+
+	for _, cl := range lines {
+		if set[cl.name] {
+			continue
+		}
+
+		f := fs.Lookup(cl.name)
+		if f == nil {
+			return fmt.Errorf("%s:%d: configuration variable provided but not defined: %s", path, cl.line, cl.name)
+		}
+
+		value := cl.value
+		if cl.bare {
+			value = "true"
+		}
+		if err := fs.Set(cl.name, value); err != nil {
+			return fmt.Errorf("%s:%d: invalid value %q for %s: %s", path, cl.line, value, cl.name, err)
+		}
+		set[cl.name] = true
+	}
+
+	return nil
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/namsral/flag"
+	"github.com/stretchr/testify/assert"
+)
+
+const testConfigFile = `# common settings
+title Search
+readonly
+
+[dev]
+fqdn localhost:8000
+dbpath=dev.db
+
+[prod]
+fqdn go.example.com
+title Company Search
+`
+
+type testFlags struct {
+	title    string
+	fqdn     string
+	dbpath   string
+	readonly bool
+}
+
+func newTestFlagSet(flags *testFlags) *flag.FlagSet {
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	fs.StringVar(&flags.title, "title", "", "")
+	fs.StringVar(&flags.fqdn, "fqdn", "", "")
+	fs.StringVar(&flags.dbpath, "dbpath", "search.db", "")
+	fs.BoolVar(&flags.readonly, "readonly", false, "")
+	return fs
+}
+
+func TestParseConfigFile(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir("", "golinks")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "golinks.conf")
+	assert.NoError(ioutil.WriteFile(path, []byte(testConfigFile), 0644))
+
+	var flags testFlags
+
+	fs := newTestFlagSet(&flags)
+	assert.NoError(fs.Parse(nil))
+	assert.NoError(ParseConfigFile(fs, path, ""))
+	assert.Equal(testFlags{"Search", "", "search.db", true}, flags)
+
+	flags = testFlags{}
+	fs = newTestFlagSet(&flags)
+	assert.NoError(fs.Parse(nil))
+	assert.NoError(ParseConfigFile(fs, path, "dev"))
+	assert.Equal(testFlags{"Search", "localhost:8000", "dev.db", true}, flags)
+
+	flags = testFlags{}
+	fs = newTestFlagSet(&flags)
+	assert.NoError(fs.Parse([]string{"-fqdn", "go.local"}))
+	assert.NoError(ParseConfigFile(fs, path, "prod"))
+	assert.Equal(testFlags{"Company Search", "go.local", "search.db", true}, flags)
+
+	flags = testFlags{}
+	fs = newTestFlagSet(&flags)
+	assert.NoError(fs.Parse(nil))
+	assert.Error(ParseConfigFile(fs, path, "staging"))
+}
+
+func TestParseConfigFileErrors(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir("", "golinks")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	var flags testFlags
+
+	path := filepath.Join(dir, "unknown.conf")
+	assert.NoError(ioutil.WriteFile(path, []byte("foo bar\n"), 0644))
+	fs := newTestFlagSet(&flags)
+	assert.NoError(fs.Parse(nil))
+	assert.Error(ParseConfigFile(fs, path, ""))
+
+	path = filepath.Join(dir, "invalid.conf")
+	assert.NoError(ioutil.WriteFile(path, []byte("readonly maybe\n"), 0644))
+	fs = newTestFlagSet(&flags)
+	assert.NoError(fs.Parse(nil))
+	assert.Error(ParseConfigFile(fs, path, ""))
+
+	path = filepath.Join(dir, "empty.conf")
+	assert.NoError(ioutil.WriteFile(path, []byte("[]\n"), 0644))
+	fs = newTestFlagSet(&flags)
+	assert.NoError(fs.Parse(nil))
+	assert.Error(ParseConfigFile(fs, path, ""))
+
+	fs = newTestFlagSet(&flags)
+	assert.NoError(fs.Parse(nil))
+	assert.Error(ParseConfigFile(fs, filepath.Join(dir, "missing.conf"), ""))
+}
@@ -0,0 +1,294 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rcrowley/go-metrics"
+)
+
+// PrometheusNamespace prefixes the names of the metrics of golinks
+const PrometheusNamespace = "golinks"
+
+// PrometheusContentType is the content type of the text exposition format
+const PrometheusContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// RequestDurationBuckets are the upper bounds (in seconds) of the buckets
+// of the request duration histograms
+var RequestDurationBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// requestMethods are the methods requests are counted by, any other method
+// is counted as "other" so clients can't create unbounded series
+var requestMethods = map[string]bool{
+	"GET": true, "HEAD": true, "POST": true, "PUT": true,
+	"PATCH": true, "DELETE": true, "OPTIONS": true,
+}
+
+type requestKey struct {
+	method string
+	code   int
+}
+
+type requestHistogram struct {
+	buckets []uint64
+	sum     float64
+	count   uint64
+}
+
+// RequestMetrics counts HTTP requests by method and status code and
+// observes their durations by method
+type RequestMetrics struct {
+	sync.Mutex
+
+	started   time.Time
+	requests  map[requestKey]uint64
+	durations map[string]*requestHistogram
+}
+
+// NewRequestMetrics ...
+func NewRequestMetrics() *RequestMetrics {
+	return &RequestMetrics{
+		started:   time.Now(),
+		requests:  make(map[requestKey]uint64),
+		durations: make(map[string]*requestHistogram),
+	}
+}
+
+// Observe records a request
+func (m *RequestMetrics) Observe(method string, code int, d time.Duration) {
+	if !requestMethods[method] {
+		method = "other"
+	}
+
+	m.Lock()
+	defer m.Unlock()
+
+	m.requests[requestKey{method, code}]++
+
+	h, ok := m.durations[method]
+	if !ok {
+		h = &requestHistogram{buckets: make([]uint64, len(RequestDurationBuckets))}
+		m.durations[method] = h
+	}
+	seconds := d.Seconds()
+	for i, le := range RequestDurationBuckets {
+		if seconds <= le {
+			h.buckets[i]++
+		}
+	}
+	h.sum += seconds
+	h.count++
+}
+
+// statusRecorder records the status code of a response, passing flushes
+// and hijacks (e.g: of streams and websockets) through
+type statusRecorder struct {
+	http.ResponseWriter
+	code int
+}
+
+func (w *statusRecorder) WriteHeader(code int) {
+	if w.code == 0 {
+		w.code = code
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *statusRecorder) Write(data []byte) (int, error) {
+	if w.code == 0 {
+		w.code = http.StatusOK
+	}
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *statusRecorder) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (w *statusRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	if h, ok := w.ResponseWriter.(http.Hijacker); ok {
+		if w.code == 0 {
+			w.code = http.StatusSwitchingProtocols
+		}
+		return h.Hijack()
+	}
+	return nil, nil, errors.New("hijacking not supported")
+}
+
+// Handler records the requests handled by next
+func (m *RequestMetrics) Handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t0 := time.Now()
+		rec := &statusRecorder{ResponseWriter: w}
+		next.ServeHTTP(rec, r)
+		if rec.code == 0 {
+			rec.code = http.StatusOK
+		}
+		m.Observe(r.Method, rec.code, time.Since(t0))
+	})
+}
+
+// prometheusName returns name as a valid Prometheus metric name
+func prometheusName(name string) string {
+	return PrometheusNamespace + "_" + strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '_' || r == ':' {
+			return r
+		}
+		return '_'
+	}, name)
+}
+
+// labelEscaper escapes label values as the text exposition format expects
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// labelValue returns s quoted as a label value
+func labelValue(s string) string {
+	return `"` + labelEscaper.Replace(s) + `"`
+}
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
+
+func writeMetricHeader(w io.Writer, name, kind, help string) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+}
+
+// writeRequests writes the request counts and duration histograms
+func (m *RequestMetrics) writeRequests(w io.Writer) {
+	m.Lock()
+	defer m.Unlock()
+
+	keys := make([]requestKey, 0, len(m.requests))
+	for key := range m.requests {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].method != keys[j].method {
+			return keys[i].method < keys[j].method
+		}
+		return keys[i].code < keys[j].code
+	})
+
+	name := PrometheusNamespace + "_http_requests_total"
+	writeMetricHeader(w, name, "counter", "Number of HTTP requests by method and status code.")
+	for _, key := range keys {
+		fmt.Fprintf(w, "%s{method=%q,code=\"%d\"} %d\n", name, key.method, key.code, m.requests[key])
+	}
+
+	methods := make([]string, 0, len(m.durations))
+	for method := range m.durations {
+		methods = append(methods, method)
+	}
+	sort.Strings(methods)
+
+	name = PrometheusNamespace + "_http_request_duration_seconds"
+	writeMetricHeader(w, name, "histogram", "Duration of HTTP requests by method.")
+	for _, method := range methods {
+		h := m.durations[method]
+		for i, le := range RequestDurationBuckets {
+			fmt.Fprintf(w, "%s_bucket{method=%q,le=%q} %d\n", name, method, formatFloat(le), h.buckets[i])
+		}
+		fmt.Fprintf(w, "%s_bucket{method=%q,le=\"+Inf\"} %d\n", name, method, h.count)
+		fmt.Fprintf(w, "%s_sum{method=%q} %s\n", name, method, formatFloat(h.sum))
+		fmt.Fprintf(w, "%s_count{method=%q} %d\n", name, method, h.count)
+	}
+}
+
+// writeProcess writes process and Go runtime metrics. Resident memory and
+// open file descriptors are only available where /proc is.
+func (m *RequestMetrics) writeProcess(w io.Writer) {
+	writeMetricHeader(w, "process_start_time_seconds", "gauge", "Start time of the process since unix epoch in seconds.")
+	fmt.Fprintf(w, "process_start_time_seconds %s\n", formatFloat(float64(m.started.UnixNano())/1e9))
+
+	if fds, err := ioutil.ReadDir("/proc/self/fd"); err == nil {
+		writeMetricHeader(w, "process_open_fds", "gauge", "Number of open file descriptors.")
+		fmt.Fprintf(w, "process_open_fds %d\n", len(fds))
+	}
+	if statm, err := ioutil.ReadFile("/proc/self/statm"); err == nil {
+		if fields := strings.Fields(string(statm)); len(fields) > 1 {
+			if pages, err := strconv.ParseInt(fields[1], 10, 64); err == nil {
+				writeMetricHeader(w, "process_resident_memory_bytes", "gauge", "Resident memory size in bytes.")
+				fmt.Fprintf(w, "process_resident_memory_bytes %d\n", pages*int64(os.Getpagesize()))
+			}
+		}
+	}
+
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+
+	writeMetricHeader(w, "go_goroutines", "gauge", "Number of goroutines that currently exist.")
+	fmt.Fprintf(w, "go_goroutines %d\n", runtime.NumGoroutine())
+	writeMetricHeader(w, "go_memstats_alloc_bytes", "gauge", "Number of bytes allocated and still in use.")
+	fmt.Fprintf(w, "go_memstats_alloc_bytes %d\n", mem.Alloc)
+	writeMetricHeader(w, "go_memstats_sys_bytes", "gauge", "Number of bytes obtained from the system.")
+	fmt.Fprintf(w, "go_memstats_sys_bytes %d\n", mem.Sys)
+	writeMetricHeader(w, "go_memstats_heap_objects", "gauge", "Number of allocated objects.")
+	fmt.Fprintf(w, "go_memstats_heap_objects %d\n", mem.HeapObjects)
+	writeMetricHeader(w, "go_gc_cycles_total", "counter", "Number of completed GC cycles.")
+	fmt.Fprintf(w, "go_gc_cycles_total %d\n", mem.NumGC)
+	writeMetricHeader(w, "go_info", "gauge", "Information about the Go environment.")
+	fmt.Fprintf(w, "go_info{version=%q} 1\n", runtime.Version())
+}
+
+// writeRegistry writes the counters, gauges and timers of the registry;
+// timers as summaries in seconds
+func writeRegistry(w io.Writer, r metrics.Registry) {
+	all := make(map[string]interface{})
+	r.Each(func(name string, metric interface{}) {
+		all[name] = metric
+	})
+	names := make([]string, 0, len(all))
+	for name := range all {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	quantiles := []float64{0.5, 0.9, 0.99}
+	for _, name := range names {
+		promName := prometheusName(name)
+		switch metric := all[name].(type) {
+		case metrics.Counter:
+			writeMetricHeader(w, promName, "counter", name)
+			fmt.Fprintf(w, "%s %d\n", promName, metric.Count())
+		case metrics.Gauge:
+			writeMetricHeader(w, promName, "gauge", name)
+			fmt.Fprintf(w, "%s %d\n", promName, metric.Value())
+		case metrics.Timer:
+			t := metric.Snapshot()
+			writeMetricHeader(w, promName+"_seconds", "summary", name)
+			for i, value := range t.Percentiles(quantiles) {
+				fmt.Fprintf(w, "%s_seconds{quantile=%q} %s\n", promName, formatFloat(quantiles[i]), formatFloat(value/1e9))
+			}
+			fmt.Fprintf(w, "%s_seconds_sum %s\n", promName, formatFloat(float64(t.Sum())/1e9))
+			fmt.Fprintf(w, "%s_seconds_count %d\n", promName, t.Count())
+		}
+	}
+}
+
+// PrometheusHandler serves the metrics in the Prometheus text exposition
+// format: requests, hits, process and runtime metrics and all counters
+func (s *Server) PrometheusHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", PrometheusContentType)
+
+		s.requests.writeRequests(w)
+		s.hits.writeMetrics(w)
+		s.requests.writeProcess(w)
+		writeRegistry(w, s.counters.r)
+	})
+}
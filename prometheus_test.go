@@ -0,0 +1,95 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPrometheusName(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.Equal("golinks_n_api_version", prometheusName("n_api_version"))
+	assert.Equal("golinks_store_get_bookmark", prometheusName("store_get_bookmark"))
+	assert.Equal("golinks_n_bot_matrix_org", prometheusName("n_bot_matrix.org"))
+}
+
+func TestRequestMetrics(t *testing.T) {
+	assert := assert.New(t)
+
+	m := NewRequestMetrics()
+	h := m.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/missing" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte("ok"))
+	}))
+
+	for _, req := range []struct{ method, path string }{
+		{"GET", "/"}, {"GET", "/"}, {"GET", "/missing"}, {"BREW", "/"},
+	} {
+		r, _ := http.NewRequest(req.method, req.path, nil)
+		h.ServeHTTP(httptest.NewRecorder(), r)
+	}
+	m.Observe("POST", http.StatusCreated, 3*time.Second)
+
+	var buf bytes.Buffer
+	m.writeRequests(&buf)
+	out := buf.String()
+
+	assert.Contains(out, "# TYPE golinks_http_requests_total counter\n")
+	assert.Contains(out, "golinks_http_requests_total{method=\"GET\",code=\"200\"} 2\n")
+	assert.Contains(out, "golinks_http_requests_total{method=\"GET\",code=\"404\"} 1\n")
+	assert.Contains(out, "golinks_http_requests_total{method=\"other\",code=\"200\"} 1\n")
+	assert.Contains(out, "golinks_http_request_duration_seconds_bucket{method=\"GET\",le=\"+Inf\"} 3\n")
+	assert.Contains(out, "golinks_http_request_duration_seconds_bucket{method=\"POST\",le=\"2.5\"} 0\n")
+	assert.Contains(out, "golinks_http_request_duration_seconds_bucket{method=\"POST\",le=\"5\"} 1\n")
+	assert.Contains(out, "golinks_http_request_duration_seconds_sum{method=\"POST\"} 3\n")
+	assert.Contains(out, "golinks_http_request_duration_seconds_count{method=\"POST\"} 1\n")
+}
+
+func TestPrometheusHandler(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir("", "golinks")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	db, err = OpenStore(filepath.Join(dir, "test.db"))
+	assert.NoError(err)
+	defer db.Close()
+
+	s, err := NewServer(":8000", Config{Title: "Search"})
+	assert.NoError(err)
+
+	s.counters.IncBy("n_redirects", 3)
+	s.counters.Gauge("bookmarks", 7)
+	s.counters.Time("store_get_bookmark", 2*time.Second)
+
+	// Requests are recorded by the middleware of the server
+	r, _ := http.NewRequest("GET", "/api/v1/version", nil)
+	s.server.Handler.ServeHTTP(httptest.NewRecorder(), r)
+
+	w := httptest.NewRecorder()
+	r, _ = http.NewRequest("GET", "/metrics", nil)
+	s.router.ServeHTTP(w, r)
+	assert.Equal(http.StatusOK, w.Code)
+	assert.Equal(PrometheusContentType, w.Header().Get("Content-Type"))
+
+	out := w.Body.String()
+	assert.Contains(out, "golinks_http_requests_total{method=\"GET\",code=\"200\"} 1\n")
+	assert.Contains(out, "# TYPE golinks_n_redirects counter\ngolinks_n_redirects 3\n")
+	assert.Contains(out, "# TYPE golinks_bookmarks gauge\ngolinks_bookmarks 7\n")
+	assert.Contains(out, "golinks_store_get_bookmark_seconds{quantile=\"0.5\"} 2\n")
+	assert.Contains(out, "golinks_store_get_bookmark_seconds_count 1\n")
+	assert.Contains(out, "process_start_time_seconds ")
+	assert.Contains(out, "go_goroutines ")
+}
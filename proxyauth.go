@@ -0,0 +1,86 @@
+package main
+
+import (
+	"net"
+	"net/http"
+	"net/textproto"
+	"strings"
+)
+
+// DefaultAuthProxies are the proxies trusted to set the header without
+// -auth-proxies: only one on the same host
+const DefaultAuthProxies = "127.0.0.0/8,::1"
+
+// ProxyAuth trusts a reverse proxy that authenticates users (e.g.
+// oauth2-proxy or Authelia) to tell who they are in a header
+type ProxyAuth struct {
+	header   string
+	proxies  []*net.IPNet
+	counters *Counters
+}
+
+// NewProxyAuth returns a ProxyAuth trusting the header (e.g.
+// X-Forwarded-User) from proxies, or from DefaultAuthProxies if there are
+// none
+func NewProxyAuth(header string, proxies []*net.IPNet, counters *Counters) *ProxyAuth {
+	if len(proxies) == 0 {
+		proxies, _ = ParseNetworks(DefaultAuthProxies)
+	}
+	return &ProxyAuth{
+		header:   textproto.CanonicalMIMEHeaderKey(header),
+		proxies:  proxies,
+		counters: counters,
+	}
+}
+
+// ParseProxies parses a comma separated list of ips and CIDRs
+func ParseProxies(s string) ([]*net.IPNet, error) {
+	return ParseNetworks(s)
+}
+
+// trusted reports whether a request comes from a trusted proxy. Only the
+// address connecting to golinks counts, not X-Forwarded-For (which the
+// client can set).
+func (p *ProxyAuth) trusted(r *http.Request) bool {
+	return containsIP(p.proxies, peerIP(r))
+}
+
+// User returns the user the proxy authenticated the request as, or an
+// empty string if it didn't or the request isn't from a trusted proxy
+func (p *ProxyAuth) User(r *http.Request) string {
+	user := strings.TrimSpace(r.Header.Get(p.header))
+	if user == "" || !p.trusted(r) {
+		return ""
+	}
+	return user
+}
+
+// Handler only serves requests to next the proxy authenticated, unless
+// they need no credentials (see authenticated). The header is removed so
+// it can't be mistaken for the user further on.
+func (p *ProxyAuth) Handler(next http.Handler, replicationSecret string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user := p.User(r)
+		if user == "" && r.Header.Get(p.header) != "" {
+			p.counters.Inc("n_auth_untrusted")
+		}
+		r.Header.Del(p.header)
+
+		if user != "" {
+			next.ServeHTTP(w, withUser(r, user))
+			return
+		}
+
+		if authenticated(r, replicationSecret) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		p.counters.Inc("n_auth_failed")
+		if strings.HasPrefix(r.URL.Path, "/api/") {
+			WriteAPIError(w, r, http.StatusUnauthorized, ErrCodeUnauthorized, "authentication required", nil)
+		} else {
+			http.Error(w, "Unauthorized: authentication required", http.StatusUnauthorized)
+		}
+	})
+}
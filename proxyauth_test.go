@@ -0,0 +1,158 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProxyAuth(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir("", "golinks")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	db, err = OpenStore(filepath.Join(dir, "test.db"))
+	assert.NoError(err)
+	defer db.Close()
+
+	assert.NoError(SaveBookmark("gh", "https://github.com/%s"))
+
+	s, err := NewServer(":8000", Config{
+		AuthHeader:  "x-forwarded-user",
+		AuthProxies: "10.0.0.0/8",
+	})
+	assert.NoError(err)
+
+	do := func(method, path, remoteAddr, user string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r, _ := http.NewRequest(method, path, nil)
+		r.RemoteAddr = remoteAddr
+		if user != "" {
+			r.Header.Set("X-Forwarded-User", user)
+		}
+		s.server.Handler.ServeHTTP(w, r)
+		return w
+	}
+
+	// Requests must be authenticated by the proxy
+	w := do("GET", "/?q=gh+prologic", "10.0.0.2:1234", "")
+	assert.Equal(http.StatusUnauthorized, w.Code)
+
+	w = do("GET", "/api/v1/bookmarks/gh", "10.0.0.2:1234", "")
+	assert.Equal(http.StatusUnauthorized, w.Code)
+	assert.Contains(w.Header().Get("Content-Type"), "application/json")
+
+	// The header is ignored from anyone but the proxies
+	w = do("GET", "/?q=gh+prologic", "192.0.2.1:1234", "mallory")
+	assert.Equal(http.StatusUnauthorized, w.Code)
+
+	w = do("GET", "/?q=gh+prologic", "10.0.0.2:1234", "alice")
+	assert.Equal(http.StatusFound, w.Code)
+	assert.Equal("https://github.com/prologic", w.Header().Get("Location"))
+
+	page, err := ListHistory("", 10)
+	assert.NoError(err)
+	assert.Len(page.Entries, 1)
+	assert.Equal("alice", page.Entries[0].User)
+
+	command := func(q, user string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r := postQuery(url.Values{"q": {q}})
+		r.RemoteAddr = "10.0.0.2:1234"
+		r.Header.Set("X-Forwarded-User", user)
+		s.server.Handler.ServeHTTP(w, r)
+		return w
+	}
+
+	// Bookmarks are owned by whoever created them
+	w = command("add go https://golang.org", "bob")
+	assert.Equal(http.StatusOK, w.Code)
+	w = command("add go https://go.dev", "alice")
+	assert.Equal(http.StatusOK, w.Code)
+	assert.Equal("bob", BookmarkOwner("go"))
+	assert.Equal("", BookmarkOwner("gh"))
+
+	// API tokens don't need the proxy
+	_, secret, err := CreateToken("cli", []string{ScopeRead})
+	assert.NoError(err)
+	w = httptest.NewRecorder()
+	r, _ := http.NewRequest("GET", "/api/v1/bookmarks/go", nil)
+	r.Header.Set("Authorization", "Bearer "+secret)
+	s.server.Handler.ServeHTTP(w, r)
+	assert.Equal(http.StatusOK, w.Code)
+	var bookmark map[string]string
+	assert.NoError(json.Unmarshal(w.Body.Bytes(), &bookmark))
+	assert.Equal("https://go.dev", bookmark["url"])
+	assert.Equal("bob", bookmark["owner"])
+
+	w = command("remove go", "alice")
+	assert.Equal(http.StatusOK, w.Code)
+	assert.Equal("", BookmarkOwner("go"))
+
+	// The proxy can't be combined with other logins
+	_, err = NewServer(":8000", Config{AuthHeader: "X-Forwarded-User", AuthUser: "admin", AuthPass: "admin"})
+	assert.Error(err)
+	_, err = NewServer(":8000", Config{AuthProxies: "10.0.0.0/8"})
+	assert.Error(err)
+}
+
+func TestProxyAuthDefaultProxies(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir("", "golinks")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	db, err = OpenStore(filepath.Join(dir, "test.db"))
+	assert.NoError(err)
+	defer db.Close()
+
+	assert.NoError(SaveBookmark("gh", "https://github.com/%s"))
+
+	// Without -auth-proxies only a proxy on the same host is trusted
+	s, err := NewServer(":8000", Config{AuthHeader: "X-Forwarded-User"})
+	assert.NoError(err)
+
+	do := func(remoteAddr string) int {
+		w := httptest.NewRecorder()
+		r, _ := http.NewRequest("GET", "/?q=gh+prologic", nil)
+		r.RemoteAddr = remoteAddr
+		r.Header.Set("X-Forwarded-User", "mallory")
+		s.server.Handler.ServeHTTP(w, r)
+		return w.Code
+	}
+
+	assert.Equal(http.StatusUnauthorized, do("192.0.2.1:1234"))
+	assert.Equal(http.StatusUnauthorized, do("10.0.0.2:1234"))
+	assert.Equal(http.StatusFound, do("127.0.0.1:1234"))
+	assert.Equal(http.StatusFound, do("[::1]:1234"))
+}
+
+func TestParseProxies(t *testing.T) {
+	assert := assert.New(t)
+
+	proxies, err := ParseProxies("10.0.0.0/8, 127.0.0.1,::1,")
+	assert.NoError(err)
+	assert.Len(proxies, 3)
+	assert.Equal("10.0.0.0/8", proxies[0].String())
+	assert.Equal("127.0.0.1/32", proxies[1].String())
+	assert.Equal("::1/128", proxies[2].String())
+
+	proxies, err = ParseProxies("")
+	assert.NoError(err)
+	assert.Empty(proxies)
+
+	_, err = ParseProxies("proxy.example.com")
+	assert.Error(err)
+	_, err = ParseProxies("10.0.0.0/33")
+	assert.Error(err)
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+const (
+	// PublicBookmarksPath is where the public bookmarks are served without
+	// a token, e.g: for status pages and docs sites
+	PublicBookmarksPath = "/api/public/v1/bookmarks"
+
+	// DefaultPublicCacheControl lets browsers cache the public bookmarks for
+	// a few minutes and CDNs for an hour, serving stale copies for a day
+	// while they revalidate (or golinks is down)
+	DefaultPublicCacheControl = "public, max-age=300, s-maxage=3600, stale-while-revalidate=86400, stale-if-error=86400"
+)
+
+// PublicCatalogBookmark is a public bookmark of the catalog
+type PublicCatalogBookmark struct {
+	Name        string     `json:"name"`
+	URL         string     `json:"url"`
+	Description string     `json:"description,omitempty"`
+	Tags        []string   `json:"tags,omitempty"`
+	Modified    *time.Time `json:"modified,omitempty"`
+}
+
+// PublicCatalog is the catalog of public bookmarks, sorted by name
+type PublicCatalog struct {
+	Bookmarks []PublicCatalogBookmark `json:"bookmarks"`
+}
+
+// publicCatalog returns the catalog of all public bookmarks (those tagged
+// with the publish tag) and when the most recent one was modified
+func (s *Server) publicCatalog() (PublicCatalog, time.Time, error) {
+	catalog := PublicCatalog{Bookmarks: []PublicCatalogBookmark{}}
+
+	bookmarks, err := ListPublicBookmarks(s.config.PublishTag, 0)
+	if err != nil {
+		return catalog, time.Time{}, err
+	}
+	sort.Slice(bookmarks, func(i, j int) bool { return bookmarks[i].Name < bookmarks[j].Name })
+
+	var updated time.Time
+	for _, bookmark := range bookmarks {
+		b := PublicCatalogBookmark{
+			Name:        bookmark.Name,
+			URL:         bookmark.URL,
+			Description: bookmark.Description,
+			Tags:        s.publicTags(bookmark),
+		}
+		if !bookmark.Modified.IsZero() {
+			modified := bookmark.Modified.UTC()
+			b.Modified = &modified
+			if modified.After(updated) {
+				updated = modified
+			}
+		}
+		catalog.Bookmarks = append(catalog.Bookmarks, b)
+	}
+	return catalog, updated, nil
+}
+
+// etagMatches reports whether an If-None-Match header matches the etag,
+// comparing weakly as CDNs may weaken the etags of compressed responses
+func etagMatches(header, etag string) bool {
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimPrefix(strings.TrimSpace(tag), "W/")
+		if tag == "*" || tag == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// PublicBookmarksHandler serves the public bookmarks as JSON to anyone,
+// with cache headers and an ETag so CDNs and browsers can cache and
+// revalidate them. Nothing is public without a publish tag.
+func (s *Server) PublicBookmarksHandler() httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+		s.counters.Inc("n_api_public_bookmarks")
+
+		if s.config.PublishTag == "" {
+			WriteAPIError(w, r, http.StatusNotFound, ErrCodeNotFound, "no bookmarks are published", nil)
+			return
+		}
+
+		catalog, updated, err := s.publicCatalog()
+		if err != nil {
+			WriteAPIError(w, r, http.StatusInternalServerError, ErrCodeInternal, "error reading bookmarks", err.Error())
+			return
+		}
+		data, err := json.Marshal(catalog)
+		if err != nil {
+			WriteAPIError(w, r, http.StatusInternalServerError, ErrCodeInternal, "error encoding bookmarks", err.Error())
+			return
+		}
+		sum := sha256.Sum256(data)
+		etag := `"` + hex.EncodeToString(sum[:16]) + `"`
+
+		w.Header().Set("ETag", etag)
+		if s.config.PublicCacheControl != "" {
+			w.Header().Set("Cache-Control", s.config.PublicCacheControl)
+		}
+		if !updated.IsZero() {
+			w.Header().Set("Last-Modified", updated.Format(http.TimeFormat))
+		}
+		w.Header().Set("Access-Control-Allow-Origin", "*")
+		w.Header().Set("Vary", "Accept-Encoding")
+		if etagMatches(r.Header.Get("If-None-Match"), etag) {
+			s.counters.Inc("n_api_public_bookmarks_not_modified")
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		w.Write(data)
+	}
+}
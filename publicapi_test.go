@@ -0,0 +1,89 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPublicBookmarksHandler(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir("", "golinks")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	db, err = OpenStore(filepath.Join(dir, "test.db"))
+	assert.NoError(err)
+	defer db.Close()
+
+	assert.NoError(SaveBookmark("go", "https://golang.org"))
+	assert.NoError(SaveBookmark("gh", "https://github.com/%s"))
+	assert.NoError(SaveBookmark("intranet", "https://intranet.corp"))
+	assert.NoError(db.Put([]byte("tags_gh"), []byte("code,public")))
+	assert.NoError(db.Put([]byte("tags_go"), []byte("public")))
+	assert.NoError(db.Put([]byte("tags_intranet"), []byte("code")))
+	assert.NoError(db.Put([]byte("description_go"), []byte("The Go website")))
+	assert.NoError(db.Put(modifiedKey("gh"), []byte("2024-01-02T00:00:00Z")))
+	assert.NoError(db.Put(modifiedKey("go"), []byte("2024-01-03T00:00:00Z")))
+
+	// Public bookmarks are served even when everything else needs a login
+	s, err := NewServer(":8000", Config{
+		PublishTag:         "public",
+		PublicCacheControl: DefaultPublicCacheControl,
+		AuthUser:           "admin",
+		AuthPass:           "s3cr3t",
+	})
+	assert.NoError(err)
+
+	get := func(etag string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r, _ := http.NewRequest("GET", PublicBookmarksPath, nil)
+		if etag != "" {
+			r.Header.Set("If-None-Match", etag)
+		}
+		s.server.Handler.ServeHTTP(w, r)
+		return w
+	}
+
+	w := get("")
+	assert.Equal(http.StatusOK, w.Code)
+	assert.Equal(DefaultPublicCacheControl, w.Header().Get("Cache-Control"))
+	assert.Equal("Wed, 03 Jan 2024 00:00:00 GMT", w.Header().Get("Last-Modified"))
+	assert.Equal("*", w.Header().Get("Access-Control-Allow-Origin"))
+	etag := w.Header().Get("ETag")
+	assert.NotEmpty(etag)
+
+	var catalog PublicCatalog
+	assert.NoError(json.Unmarshal(w.Body.Bytes(), &catalog))
+	assert.Len(catalog.Bookmarks, 2)
+	assert.Equal("gh", catalog.Bookmarks[0].Name)
+	assert.Equal([]string{"code"}, catalog.Bookmarks[0].Tags)
+	assert.Equal("go", catalog.Bookmarks[1].Name)
+	assert.Equal("The Go website", catalog.Bookmarks[1].Description)
+	assert.Empty(catalog.Bookmarks[1].Tags)
+
+	// Unchanged catalogs are revalidated, even with weakened etags
+	w = get(etag)
+	assert.Equal(http.StatusNotModified, w.Code)
+	assert.Empty(w.Body.String())
+	w = get(`"other", W/` + etag)
+	assert.Equal(http.StatusNotModified, w.Code)
+
+	assert.NoError(db.Put([]byte("tags_intranet"), []byte("code,public")))
+	w = get(etag)
+	assert.Equal(http.StatusOK, w.Code)
+	assert.NotEqual(etag, w.Header().Get("ETag"))
+
+	// Nothing is public without a publish tag
+	s, err = NewServer(":8000", Config{})
+	assert.NoError(err)
+	w = get("")
+	assert.Equal(http.StatusNotFound, w.Code)
+}
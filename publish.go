@@ -0,0 +1,225 @@
+package main
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"html"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+// MaxPublishedLinks is how many of the most recent public links are
+// published in the feed and outbox
+const MaxPublishedLinks = 50
+
+// ActivityStreamsContext is the JSON-LD context of ActivityStreams documents
+const ActivityStreamsContext = "https://www.w3.org/ns/activitystreams"
+
+// PublicBookmark is a bookmark published to followers of the instance
+type PublicBookmark struct {
+	SiteBookmark
+	Modified time.Time
+}
+
+// Link returns the url the published bookmark links to: its url without the
+// query placeholder for searches
+func (b PublicBookmark) Link() string {
+	return strings.Replace(b.URL, "%s", "", -1)
+}
+
+// ListPublicBookmarks returns the bookmarks tagged with tag, most recently
+// added (or changed) first
+func ListPublicBookmarks(tag string, limit int) ([]PublicBookmark, error) {
+	bookmarks, err := ListSiteBookmarks()
+	if err != nil {
+		return nil, err
+	}
+
+	var public []PublicBookmark
+	for _, bookmark := range bookmarks {
+		for _, t := range bookmark.Tags {
+			if t == tag {
+				modified, _ := BookmarkModified(bookmark.Name)
+				public = append(public, PublicBookmark{SiteBookmark: bookmark, Modified: modified})
+				break
+			}
+		}
+	}
+	sort.SliceStable(public, func(i, j int) bool { return public[i].Modified.After(public[j].Modified) })
+
+	if limit > 0 && len(public) > limit {
+		public = public[:limit]
+	}
+	return public, nil
+}
+
+type rssFeed struct {
+	XMLName xml.Name   `xml:"rss"`
+	Version string     `xml:"version,attr"`
+	Channel rssChannel `xml:"channel"`
+}
+
+type rssChannel struct {
+	Title       string    `xml:"title"`
+	Link        string    `xml:"link"`
+	Description string    `xml:"description"`
+	Generator   string    `xml:"generator"`
+	Items       []rssItem `xml:"item"`
+}
+
+type rssItem struct {
+	Title       string   `xml:"title"`
+	Link        string   `xml:"link"`
+	Description string   `xml:"description,omitempty"`
+	Categories  []string `xml:"category"`
+	GUID        rssGUID  `xml:"guid"`
+	PubDate     string   `xml:"pubDate,omitempty"`
+}
+
+type rssGUID struct {
+	IsPermaLink bool   `xml:"isPermaLink,attr"`
+	Value       string `xml:",chardata"`
+}
+
+// publicID returns a stable id of the published version of a bookmark, so
+// changing a public bookmark publishes it again
+func (s *Server) publicID(bookmark PublicBookmark) string {
+	return fmt.Sprintf("http://%s/outbox/%s/%d", s.config.FQDN, bookmark.Name, bookmark.Modified.Unix())
+}
+
+// publicTags returns the tags of a published bookmark, without the tag
+// that made it public
+func (s *Server) publicTags(bookmark PublicBookmark) []string {
+	var tags []string
+	for _, tag := range bookmark.Tags {
+		if tag != s.config.PublishTag {
+			tags = append(tags, tag)
+		}
+	}
+	return tags
+}
+
+// publicBookmarks writes an error and returns false if the public bookmarks
+// can't be listed
+func (s *Server) publicBookmarks(w http.ResponseWriter, r *http.Request) ([]PublicBookmark, bool) {
+	bookmarks, err := ListPublicBookmarks(s.config.PublishTag, MaxPublishedLinks)
+	if err != nil {
+		WriteAPIError(w, r, http.StatusInternalServerError, ErrCodeInternal, "error reading bookmarks", err.Error())
+		return nil, false
+	}
+	return bookmarks, true
+}
+
+// PublicFeedHandler serves the most recent public bookmarks (those tagged
+// with the publish tag) as an RSS feed, e.g: for RSS-to-fediverse bridges
+func (s *Server) PublicFeedHandler() httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+		s.counters.Inc("n_public_feed")
+
+		bookmarks, ok := s.publicBookmarks(w, r)
+		if !ok {
+			return
+		}
+
+		title := s.settings().Title
+		feed := rssFeed{
+			Version: "2.0",
+			Channel: rssChannel{
+				Title:       title,
+				Link:        fmt.Sprintf("http://%s/", s.config.FQDN),
+				Description: fmt.Sprintf("Links added to %s", title),
+				Generator:   FullVersion(),
+				Items:       []rssItem{},
+			},
+		}
+		for _, bookmark := range bookmarks {
+			item := rssItem{
+				Title:       bookmark.Name,
+				Link:        bookmark.Link(),
+				Description: bookmark.Description,
+				Categories:  s.publicTags(bookmark),
+				GUID:        rssGUID{Value: s.publicID(bookmark)},
+			}
+			if !bookmark.Modified.IsZero() {
+				item.PubDate = bookmark.Modified.UTC().Format(time.RFC1123Z)
+			}
+			feed.Channel.Items = append(feed.Channel.Items, item)
+		}
+
+		w.Header().Set("Content-Type", "application/rss+xml; charset=utf-8")
+		w.Write([]byte(xml.Header))
+		enc := xml.NewEncoder(w)
+		enc.Indent("", "  ")
+		if err := enc.Encode(feed); err != nil {
+			s.counters.Inc("n_public_feed_failed")
+		}
+	}
+}
+
+// PublicOutboxHandler serves the most recent public bookmarks as an
+// ActivityStreams outbox of notes, e.g: for ActivityPub relays and bridges
+func (s *Server) PublicOutboxHandler() httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+		s.counters.Inc("n_public_outbox")
+
+		bookmarks, ok := s.publicBookmarks(w, r)
+		if !ok {
+			return
+		}
+
+		items := []map[string]interface{}{}
+		for _, bookmark := range bookmarks {
+			content := fmt.Sprintf(`<a href="%s">%s</a>`, html.EscapeString(bookmark.Link()), html.EscapeString(bookmark.Name))
+			if bookmark.Description != "" {
+				content += ": " + html.EscapeString(bookmark.Description)
+			}
+
+			var hashtags []map[string]interface{}
+			for _, tag := range s.publicTags(bookmark) {
+				hashtags = append(hashtags, map[string]interface{}{"type": "Hashtag", "name": "#" + tag})
+			}
+
+			note := map[string]interface{}{
+				"type":    "Note",
+				"id":      s.publicID(bookmark),
+				"name":    bookmark.Name,
+				"url":     bookmark.Link(),
+				"content": content,
+				"to":      []string{"https://www.w3.org/ns/activitystreams#Public"},
+			}
+			if len(hashtags) > 0 {
+				note["tag"] = hashtags
+			}
+			activity := map[string]interface{}{
+				"type":   "Create",
+				"id":     s.publicID(bookmark) + "/create",
+				"object": note,
+			}
+			if !bookmark.Modified.IsZero() {
+				published := bookmark.Modified.UTC().Format(time.RFC3339)
+				note["published"], activity["published"] = published, published
+			}
+			items = append(items, activity)
+		}
+
+		data, err := json.Marshal(map[string]interface{}{
+			"@context":     ActivityStreamsContext,
+			"id":           fmt.Sprintf("http://%s/outbox", s.config.FQDN),
+			"type":         "OrderedCollection",
+			"summary":      fmt.Sprintf("Links added to %s", s.settings().Title),
+			"totalItems":   len(items),
+			"orderedItems": items,
+		})
+		if err != nil {
+			WriteAPIError(w, r, http.StatusInternalServerError, ErrCodeInternal, "error encoding outbox", err.Error())
+			return
+		}
+		w.Header().Set("Content-Type", "application/activity+json")
+		w.Write(data)
+	}
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestListPublicBookmarks(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir("", "golinks")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	db, err = OpenStore(filepath.Join(dir, "test.db"))
+	assert.NoError(err)
+	defer db.Close()
+
+	assert.NoError(SaveBookmark("gh", "https://github.com/%s"))
+	assert.NoError(SaveBookmark("go", "https://golang.org"))
+	assert.NoError(SaveBookmark("intranet", "https://intranet.corp"))
+	assert.NoError(db.Put([]byte("tags_gh"), []byte("code,public")))
+	assert.NoError(db.Put([]byte("tags_go"), []byte("public")))
+	assert.NoError(db.Put([]byte("tags_intranet"), []byte("code")))
+	assert.NoError(db.Put(modifiedKey("gh"), []byte("2024-01-02T00:00:00Z")))
+	assert.NoError(db.Put(modifiedKey("go"), []byte("2024-01-03T00:00:00Z")))
+
+	public, err := ListPublicBookmarks("public", 0)
+	assert.NoError(err)
+	assert.Len(public, 2)
+	assert.Equal("go", public[0].Name)
+	assert.Equal("gh", public[1].Name)
+	assert.Equal("https://github.com/", public[1].Link())
+
+	public, err = ListPublicBookmarks("public", 1)
+	assert.NoError(err)
+	assert.Len(public, 1)
+
+	public, err = ListPublicBookmarks("nope", 0)
+	assert.NoError(err)
+	assert.Empty(public)
+}
+
+func TestPublicFeedAndOutbox(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir("", "golinks")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	db, err = OpenStore(filepath.Join(dir, "test.db"))
+	assert.NoError(err)
+	defer db.Close()
+
+	assert.NoError(SaveBookmark("gh", "https://github.com/%s"))
+	assert.NoError(SaveBookmark("intranet", "https://intranet.corp"))
+	assert.NoError(db.Put([]byte("tags_gh"), []byte("code,public")))
+	assert.NoError(db.Put([]byte("description_gh"), []byte("Code & more")))
+	modified, _ := BookmarkModified("gh")
+
+	get := func(s *Server, path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r, _ := http.NewRequest("GET", path, nil)
+		s.router.ServeHTTP(w, r)
+		return w
+	}
+
+	// Nothing is published unless opted in
+	s, err := NewServer(":8000", Config{Title: "Search", FQDN: "go.example.com"})
+	assert.NoError(err)
+	assert.NotEqual("application/activity+json", get(s, "/outbox").Header().Get("Content-Type"))
+	assert.NotContains(get(s, "/links.rss").Body.String(), "<rss")
+
+	s, err = NewServer(":8000", Config{Title: "Search", FQDN: "go.example.com", PublishTag: "public"})
+	assert.NoError(err)
+
+	w := get(s, "/links.rss")
+	assert.Equal(http.StatusOK, w.Code)
+	assert.Equal("application/rss+xml; charset=utf-8", w.Header().Get("Content-Type"))
+	var feed rssFeed
+	assert.NoError(xml.Unmarshal(w.Body.Bytes(), &feed))
+	assert.Equal("Search", feed.Channel.Title)
+	assert.Equal("http://go.example.com/", feed.Channel.Link)
+	assert.Len(feed.Channel.Items, 1)
+	item := feed.Channel.Items[0]
+	assert.Equal("gh", item.Title)
+	assert.Equal("https://github.com/", item.Link)
+	assert.Equal("Code & more", item.Description)
+	assert.Equal([]string{"code"}, item.Categories)
+	assert.Equal(modified.UTC().Format(time.RFC1123Z), item.PubDate)
+	assert.False(item.GUID.IsPermaLink)
+
+	w = get(s, "/outbox")
+	assert.Equal(http.StatusOK, w.Code)
+	assert.Equal("application/activity+json", w.Header().Get("Content-Type"))
+	var outbox struct {
+		Context      string `json:"@context"`
+		Type         string `json:"type"`
+		TotalItems   int    `json:"totalItems"`
+		OrderedItems []struct {
+			Type   string `json:"type"`
+			ID     string `json:"id"`
+			Object struct {
+				Type    string `json:"type"`
+				ID      string `json:"id"`
+				URL     string `json:"url"`
+				Content string `json:"content"`
+				Tag     []struct {
+					Name string `json:"name"`
+				} `json:"tag"`
+			} `json:"object"`
+		} `json:"orderedItems"`
+	}
+	assert.NoError(json.Unmarshal(w.Body.Bytes(), &outbox))
+	assert.Equal(ActivityStreamsContext, outbox.Context)
+	assert.Equal("OrderedCollection", outbox.Type)
+	assert.Equal(1, outbox.TotalItems)
+	activity := outbox.OrderedItems[0]
+	assert.Equal("Create", activity.Type)
+	assert.Equal(activity.Object.ID+"/create", activity.ID)
+	assert.Equal("Note", activity.Object.Type)
+	assert.Equal("https://github.com/", activity.Object.URL)
+	assert.Equal(`<a href="https://github.com/">gh</a>: Code &amp; more`, activity.Object.Content)
+	assert.Equal("#code", activity.Object.Tag[0].Name)
+}
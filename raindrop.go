@@ -0,0 +1,422 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log/slog"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// RaindropAPIURL is the base url of the Raindrop.io REST API
+	RaindropAPIURL = "https://api.raindrop.io/rest/v1"
+
+	// raindropPageSize is the maximum number of raindrops per page
+	raindropPageSize = 50
+
+	// MaxRaindropBytes is the maximum size of a Raindrop API response
+	MaxRaindropBytes = 4 << 20
+
+	// raindropUser is who pulled changes are audited as
+	raindropUser = "sync:raindrop"
+)
+
+// Raindrop is a bookmark in a Raindrop.io collection. The golinks name of
+// the bookmark is kept as its title.
+type Raindrop struct {
+	ID         int64     `json:"_id"`
+	Link       string    `json:"link"`
+	Title      string    `json:"title"`
+	LastUpdate time.Time `json:"lastUpdate"`
+}
+
+// RaindropClient is a minimal client of the Raindrop.io REST API
+type RaindropClient struct {
+	baseURL    string
+	token      string
+	collection int64
+}
+
+// NewRaindropClient ...
+func NewRaindropClient(baseURL, token string, collection int64) *RaindropClient {
+	return &RaindropClient{
+		baseURL:    strings.TrimRight(baseURL, "/"),
+		token:      token,
+		collection: collection,
+	}
+}
+
+func (c *RaindropClient) do(method, path string, body, v interface{}) error {
+	var r io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		r = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequest(method, c.baseURL+path, r)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+c.token)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	res, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	data, err := ioutil.ReadAll(io.LimitReader(res.Body, MaxRaindropBytes))
+	if err != nil {
+		return err
+	}
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("raindrop: %s %s: %s", method, path, res.Status)
+	}
+
+	if v == nil {
+		return nil
+	}
+	return json.Unmarshal(data, v)
+}
+
+// List returns all raindrops in the collection
+func (c *RaindropClient) List() ([]Raindrop, error) {
+	var raindrops []Raindrop
+	for page := 0; ; page++ {
+		var res struct {
+			Items []Raindrop `json:"items"`
+		}
+		path := fmt.Sprintf("/raindrops/%d?perpage=%d&page=%d", c.collection, raindropPageSize, page)
+		if err := c.do("GET", path, nil, &res); err != nil {
+			return nil, err
+		}
+		raindrops = append(raindrops, res.Items...)
+		if len(res.Items) < raindropPageSize {
+			return raindrops, nil
+		}
+	}
+}
+
+type raindropRequest struct {
+	Link       string `json:"link"`
+	Title      string `json:"title"`
+	Collection struct {
+		ID int64 `json:"$id"`
+	} `json:"collection"`
+}
+
+func (c *RaindropClient) request(name, url string) raindropRequest {
+	req := raindropRequest{Link: url, Title: name}
+	req.Collection.ID = c.collection
+	return req
+}
+
+// Create creates a raindrop for the bookmark and returns it
+func (c *RaindropClient) Create(name, url string) (Raindrop, error) {
+	var res struct {
+		Item Raindrop `json:"item"`
+	}
+	err := c.do("POST", "/raindrop", c.request(name, url), &res)
+	return res.Item, err
+}
+
+// Update updates the raindrop's link and returns it
+func (c *RaindropClient) Update(id int64, name, url string) (Raindrop, error) {
+	var res struct {
+		Item Raindrop `json:"item"`
+	}
+	err := c.do("PUT", fmt.Sprintf("/raindrop/%d", id), c.request(name, url), &res)
+	return res.Item, err
+}
+
+// Delete deletes (moves to the trash) the raindrop
+func (c *RaindropClient) Delete(id int64) error {
+	return c.do("DELETE", fmt.Sprintf("/raindrop/%d", id), nil, nil)
+}
+
+// raindropState is what was last synced for a bookmark
+type raindropState struct {
+	ID         int64     `json:"id"`
+	URL        string    `json:"url"`
+	LastUpdate time.Time `json:"last_update"`
+}
+
+func raindropKey(name string) []byte {
+	return []byte(fmt.Sprintf("raindrop_%s", name))
+}
+
+func putRaindropState(name string, raindrop Raindrop) error {
+	data, err := json.Marshal(raindropState{
+		ID: raindrop.ID, URL: raindrop.Link, LastUpdate: raindrop.LastUpdate,
+	})
+	if err != nil {
+		return err
+	}
+	return db.Put(raindropKey(name), data)
+}
+
+// RaindropSyncResult ...
+type RaindropSyncResult struct {
+	Pulled    int `json:"pulled"`
+	Pushed    int `json:"pushed"`
+	Removed   int `json:"removed"`
+	Conflicts int `json:"conflicts"`
+}
+
+func (r RaindropSyncResult) String() string {
+	return fmt.Sprintf(
+		"%d pulled, %d pushed, %d removed, %d conflicts",
+		r.Pulled, r.Pushed, r.Removed, r.Conflicts,
+	)
+}
+
+// RaindropSyncer syncs bookmarks to and from a Raindrop.io collection. For
+// bookmarks changed on both sides since the last sync (a conflict) the most
+// recently modified side wins.
+type RaindropSyncer struct {
+	sync.Mutex
+
+	client   *RaindropClient
+	counters *Counters
+}
+
+// NewRaindropSyncer ...
+func NewRaindropSyncer(client *RaindropClient, counters *Counters) *RaindropSyncer {
+	return &RaindropSyncer{client: client, counters: counters}
+}
+
+// freeName returns name or name-2, name-3, ... whichever isn't taken
+func freeName(name string) (string, bool) {
+	candidate := name
+	for i := 2; i <= MaxSlugSuffix; i++ {
+		if !db.Has([]byte(fmt.Sprintf("bookmark_%s", candidate))) &&
+			!db.Has(raindropKey(candidate)) {
+			return candidate, true
+		}
+		candidate = fmt.Sprintf("%s-%d", name, i)
+	}
+	return "", false
+}
+
+// Sync performs a two-way sync with the collection
+func (s *RaindropSyncer) Sync() (result RaindropSyncResult, err error) {
+	s.Lock()
+	defer s.Unlock()
+
+	result, err = s.sync()
+	if err != nil {
+		s.counters.Inc("n_raindrop_failed")
+		return
+	}
+	s.counters.Inc("n_raindrop_sync")
+	s.counters.IncBy("n_raindrop_conflicts", int64(result.Conflicts))
+	return
+}
+
+func (s *RaindropSyncer) sync() (result RaindropSyncResult, err error) {
+	raindrops, err := s.client.List()
+	if err != nil {
+		return
+	}
+	remote := make(map[int64]Raindrop)
+	for _, raindrop := range raindrops {
+		if raindrop.Link != "" {
+			remote[raindrop.ID] = raindrop
+		}
+	}
+
+	states := make(map[string]raindropState)
+	err = db.Scan([]byte("raindrop_"), func(key []byte) error {
+		val, err := db.Get(key)
+		if err != nil {
+			return err
+		}
+		var state raindropState
+		if err := json.Unmarshal(val, &state); err != nil {
+			return err
+		}
+		states[strings.TrimPrefix(string(key), "raindrop_")] = state
+		return nil
+	})
+	if err != nil {
+		return
+	}
+
+	linked := make(map[int64]bool)
+
+	// Bookmarks synced before
+	for name, state := range states {
+		linked[state.ID] = true
+		raindrop, present := remote[state.ID]
+		bookmark, exists := LookupBookmark(name)
+		exists = exists && bookmark.Name() == name
+
+		localChanged := exists && bookmark.URL() != state.URL
+		remoteChanged := present && raindrop.Link != state.URL
+
+		if localChanged && remoteChanged && bookmark.URL() == raindrop.Link {
+			localChanged = false
+		}
+		if localChanged && remoteChanged {
+			result.Conflicts++
+			if modified, ok := BookmarkModified(name); ok && modified.After(raindrop.LastUpdate) {
+				remoteChanged = false
+			} else {
+				localChanged = false
+			}
+		}
+
+		switch {
+		case !present && !exists:
+			err = db.Delete(raindropKey(name))
+		case !present && localChanged:
+			// Deleted remotely but changed locally since
+			if raindrop, err = s.client.Create(name, bookmark.URL()); err == nil {
+				err = putRaindropState(name, raindrop)
+				result.Pushed++
+			}
+		case !present:
+			if err = DeleteBookmark(name); err == nil {
+				auditBookmarkAs(raindropUser, name, bookmark.URL(), "")
+				err = db.Delete(raindropKey(name))
+				result.Removed++
+			}
+		case !exists && remoteChanged:
+			// Deleted locally but changed remotely since
+			if err = SaveBookmark(name, raindrop.Link); err == nil {
+				auditBookmarkAs(raindropUser, name, "", raindrop.Link)
+				err = putRaindropState(name, raindrop)
+				result.Pulled++
+			}
+		case !exists:
+			if err = s.client.Delete(raindrop.ID); err == nil {
+				err = db.Delete(raindropKey(name))
+				result.Removed++
+			}
+		case localChanged:
+			if raindrop, err = s.client.Update(raindrop.ID, name, bookmark.URL()); err == nil {
+				err = putRaindropState(name, raindrop)
+				result.Pushed++
+			}
+		case remoteChanged:
+			if err = SaveBookmark(name, raindrop.Link); err == nil {
+				auditBookmarkAs(raindropUser, name, bookmark.URL(), raindrop.Link)
+				err = putRaindropState(name, raindrop)
+				result.Pulled++
+			}
+		}
+		if err != nil {
+			return
+		}
+	}
+
+	// New raindrops
+	for _, raindrop := range raindrops {
+		if raindrop.Link == "" || linked[raindrop.ID] {
+			continue
+		}
+
+		slug := Slugify(raindrop.Title, raindrop.Link)
+		if bookmark, ok := LookupBookmark(slug); ok && bookmark.Name() == slug &&
+			bookmark.URL() == raindrop.Link && !db.Has(raindropKey(slug)) {
+			// Already bookmarked, just link them
+			if err = putRaindropState(slug, raindrop); err != nil {
+				return
+			}
+			continue
+		}
+
+		name, ok := freeName(slug)
+		if !ok {
+			slog.Warn("no free name for raindrop", "id", raindrop.ID, "title", raindrop.Title)
+			continue
+		}
+		if err = SaveBookmark(name, raindrop.Link); err != nil {
+			return
+		}
+		auditBookmarkAs(raindropUser, name, "", raindrop.Link)
+		if err = putRaindropState(name, raindrop); err != nil {
+			return
+		}
+		result.Pulled++
+	}
+
+	// New bookmarks
+	bookmarks, err := ListBookmarks()
+	if err != nil {
+		return
+	}
+	for _, bookmark := range bookmarks {
+		if db.Has(raindropKey(bookmark.Name())) {
+			continue
+		}
+
+		var raindrop Raindrop
+		if raindrop, err = s.client.Create(bookmark.Name(), bookmark.URL()); err != nil {
+			return
+		}
+		if err = putRaindropState(bookmark.Name(), raindrop); err != nil {
+			return
+		}
+		result.Pushed++
+	}
+
+	return
+}
+
+// SyncAndLog syncs with the collection and logs what changed (if anything)
+func (s *RaindropSyncer) SyncAndLog() error {
+	result, err := s.Sync()
+	if err != nil {
+		return err
+	}
+	if result != (RaindropSyncResult{}) {
+		slog.Info("synced bookmarks with raindrop", "result", result)
+	}
+	return nil
+}
+
+// Run syncs with the collection every interval until ctx is cancelled
+func (s *RaindropSyncer) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		if err := s.SyncAndLog(); err != nil {
+			slog.Error("error syncing bookmarks with raindrop", "err", err)
+		}
+	}
+}
+
+// SyncRaindrop syncs with the configured Raindrop.io collection (if any)
+func (s *Server) SyncRaindrop() error {
+	if s.raindrop == nil {
+		return nil
+	}
+
+	if s.config.ReadOnly {
+		slog.Warn("not syncing bookmarks with raindrop in read-only mode")
+		return nil
+	}
+
+	return s.raindrop.SyncAndLog()
+}
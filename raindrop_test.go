@@ -0,0 +1,199 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeRaindrop is an in-memory Raindrop.io collection
+type fakeRaindrop struct {
+	sync.Mutex
+
+	nextID    int64
+	raindrops map[int64]Raindrop
+}
+
+func (f *fakeRaindrop) put(raindrop Raindrop) Raindrop {
+	if raindrop.ID == 0 {
+		f.nextID++
+		raindrop.ID = f.nextID
+	}
+	raindrop.LastUpdate = time.Now().UTC()
+	f.raindrops[raindrop.ID] = raindrop
+	return raindrop
+}
+
+func (f *fakeRaindrop) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.Lock()
+	defer f.Unlock()
+
+	if r.Header.Get("Authorization") != "Bearer token" {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	switch {
+	case r.Method == "GET" && strings.HasPrefix(r.URL.Path, "/raindrops/"):
+		var ids []int64
+		for id := range f.raindrops {
+			ids = append(ids, id)
+		}
+		sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+
+		page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+		perpage, _ := strconv.Atoi(r.URL.Query().Get("perpage"))
+		items := []Raindrop{}
+		for i := page * perpage; i < len(ids) && i < (page+1)*perpage; i++ {
+			items = append(items, f.raindrops[ids[i]])
+		}
+		WriteJSON(w, http.StatusOK, map[string]interface{}{"items": items})
+	case r.Method == "POST" && r.URL.Path == "/raindrop":
+		var req raindropRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		item := f.put(Raindrop{Link: req.Link, Title: req.Title})
+		WriteJSON(w, http.StatusOK, map[string]interface{}{"item": item})
+	case strings.HasPrefix(r.URL.Path, "/raindrop/"):
+		id, _ := strconv.ParseInt(strings.TrimPrefix(r.URL.Path, "/raindrop/"), 10, 64)
+		raindrop, ok := f.raindrops[id]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		if r.Method == "DELETE" {
+			delete(f.raindrops, id)
+			WriteJSON(w, http.StatusOK, map[string]interface{}{"result": true})
+			return
+		}
+		var req raindropRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		raindrop.Link, raindrop.Title = req.Link, req.Title
+		WriteJSON(w, http.StatusOK, map[string]interface{}{"item": f.put(raindrop)})
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (f *fakeRaindrop) links() map[string]string {
+	f.Lock()
+	defer f.Unlock()
+
+	links := make(map[string]string)
+	for _, raindrop := range f.raindrops {
+		links[raindrop.Title] = raindrop.Link
+	}
+	return links
+}
+
+func TestRaindropSync(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir("", "golinks")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	db, err = OpenStore(filepath.Join(dir, "test.db"))
+	assert.NoError(err)
+	defer db.Close()
+
+	fake := &fakeRaindrop{raindrops: make(map[int64]Raindrop)}
+	for i := 0; i < raindropPageSize; i++ {
+		fake.put(Raindrop{Title: fmt.Sprintf("Link %d", i), Link: fmt.Sprintf("https://example.com/%d", i)})
+	}
+	gh := fake.put(Raindrop{Title: "GitHub", Link: "https://github.com"})
+	ts := httptest.NewServer(fake)
+	defer ts.Close()
+
+	assert.NoError(SaveBookmark("g", "https://www.google.com/search?q=%s"))
+
+	syncer := NewRaindropSyncer(NewRaindropClient(ts.URL, "token", 1), NewCounters())
+
+	result, err := syncer.Sync()
+	assert.NoError(err)
+	assert.Equal(RaindropSyncResult{Pulled: raindropPageSize + 1, Pushed: 1}, result)
+
+	bookmark, ok := LookupBookmark("github")
+	assert.True(ok)
+	assert.Equal("https://github.com", bookmark.URL())
+	_, ok = LookupBookmark("link-42")
+	assert.True(ok)
+	assert.Equal("https://www.google.com/search?q=%s", fake.links()["g"])
+
+	// Nothing changed
+	result, err = syncer.Sync()
+	assert.NoError(err)
+	assert.Equal(RaindropSyncResult{}, result)
+
+	// Changes are synced both ways
+	assert.NoError(SaveBookmark("g", "https://duckduckgo.com/?q=%s"))
+	fake.Lock()
+	fake.put(Raindrop{ID: gh.ID, Title: "GitHub", Link: "https://github.com/explore"})
+	delete(fake.raindrops, 1)
+	fake.Unlock()
+	assert.NoError(DeleteBookmark("link-1"))
+
+	result, err = syncer.Sync()
+	assert.NoError(err)
+	assert.Equal(RaindropSyncResult{Pulled: 1, Pushed: 1, Removed: 2}, result)
+
+	bookmark, ok = LookupBookmark("github")
+	assert.True(ok)
+	assert.Equal("https://github.com/explore", bookmark.URL())
+	assert.Equal("https://duckduckgo.com/?q=%s", fake.links()["g"])
+	_, ok = LookupBookmark("link-0")
+	assert.False(ok)
+	_, ok = fake.links()["Link 1"]
+	assert.False(ok)
+
+	// Conflicts are resolved in favour of the most recent change
+	fake.Lock()
+	fake.put(Raindrop{ID: gh.ID, Title: "GitHub", Link: "https://github.com/remote"})
+	fake.Unlock()
+	time.Sleep(10 * time.Millisecond)
+	assert.NoError(SaveBookmark("github", "https://github.com/local"))
+
+	result, err = syncer.Sync()
+	assert.NoError(err)
+	assert.Equal(RaindropSyncResult{Pushed: 1, Conflicts: 1}, result)
+	assert.Equal("https://github.com/local", fake.links()["github"])
+
+	assert.NoError(SaveBookmark("github", "https://github.com/local2"))
+	time.Sleep(10 * time.Millisecond)
+	fake.Lock()
+	fake.put(Raindrop{ID: gh.ID, Title: "github", Link: "https://github.com/remote2"})
+	fake.Unlock()
+
+	result, err = syncer.Sync()
+	assert.NoError(err)
+	assert.Equal(RaindropSyncResult{Pulled: 1, Conflicts: 1}, result)
+	bookmark, ok = LookupBookmark("github")
+	assert.True(ok)
+	assert.Equal("https://github.com/remote2", bookmark.URL())
+
+	// Changes pulled are audited as the sync
+	audit, err := ListAudit("", 1)
+	assert.NoError(err)
+	assert.Equal(AuditEntry{
+		ID: audit.Entries[0].ID, Time: audit.Entries[0].Time, User: "sync:raindrop",
+		Action: EventBookmarkUpdated, Name: "github",
+		URL: "https://github.com/remote2", OldURL: "https://github.com/local2",
+	}, audit.Entries[0])
+
+	_, err = NewRaindropSyncer(NewRaindropClient(ts.URL, "wrong", 1), NewCounters()).Sync()
+	assert.Error(err)
+
+	_, err = NewServer(":8000", Config{Offline: true, RaindropToken: "token"})
+	assert.Error(err)
+}
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"container/list"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+const (
+	// rateLimitSweepInterval is how often the buckets of clients that have
+	// stopped making requests are forgotten
+	rateLimitSweepInterval = time.Minute
+
+	// maxRateLimitClients is how many clients are tracked at most, the
+	// longest idle are forgotten to make room for new ones
+	maxRateLimitClients = 100000
+)
+
+type tokenBucket struct {
+	client string
+	tokens float64
+	last   time.Time
+}
+
+// RateLimiter limits the requests of each client ip with a token bucket:
+// every client can make burst requests at once, then perMinute requests a
+// minute. Buckets are kept most recently used first, so the idle ones are
+// found without looking at the others.
+type RateLimiter struct {
+	sync.Mutex
+
+	rate  float64 // tokens per second
+	burst float64
+
+	buckets   map[string]*list.Element
+	lru       *list.List
+	lastSweep time.Time
+
+	now func() time.Time
+}
+
+// NewRateLimiter returns a limiter of perMinute requests a minute per
+// client, in bursts of up to burst requests (perMinute if burst is 0)
+func NewRateLimiter(perMinute, burst int) *RateLimiter {
+	if burst <= 0 {
+		burst = perMinute
+	}
+	return &RateLimiter{
+		rate:      float64(perMinute) / 60,
+		burst:     float64(burst),
+		buckets:   make(map[string]*list.Element),
+		lru:       list.New(),
+		lastSweep: time.Now(),
+		now:       time.Now,
+	}
+}
+
+// Allow takes a token from the client's bucket, returning false and how
+// long until the next token if the bucket is empty
+func (l *RateLimiter) Allow(client string) (bool, time.Duration) {
+	l.Lock()
+	defer l.Unlock()
+
+	now := l.now()
+	l.sweep(now)
+
+	var b *tokenBucket
+	if e, ok := l.buckets[client]; ok {
+		b = e.Value.(*tokenBucket)
+		b.tokens = math.Min(l.burst, b.tokens+now.Sub(b.last).Seconds()*l.rate)
+		b.last = now
+		l.lru.MoveToFront(e)
+	} else {
+		if len(l.buckets) >= maxRateLimitClients {
+			l.evict()
+		}
+		b = &tokenBucket{client: client, tokens: l.burst, last: now}
+		l.buckets[client] = l.lru.PushFront(b)
+	}
+
+	if b.tokens < 1 {
+		return false, time.Duration((1 - b.tokens) / l.rate * float64(time.Second))
+	}
+	b.tokens--
+	return true, 0
+}
+
+// sweep forgets the buckets idle long enough to have refilled, which are
+// no different from new ones, longest idle first
+func (l *RateLimiter) sweep(now time.Time) {
+	if now.Sub(l.lastSweep) < rateLimitSweepInterval {
+		return
+	}
+	l.lastSweep = now
+
+	refill := time.Duration(l.burst / l.rate * float64(time.Second))
+	for e := l.lru.Back(); e != nil && now.Sub(e.Value.(*tokenBucket).last) >= refill; e = l.lru.Back() {
+		l.remove(e)
+	}
+}
+
+// evict forgets the longest idle bucket to make room for a new client
+func (l *RateLimiter) evict() {
+	if e := l.lru.Back(); e != nil {
+		l.remove(e)
+	}
+}
+
+func (l *RateLimiter) remove(e *list.Element) {
+	l.lru.Remove(e)
+	delete(l.buckets, e.Value.(*tokenBucket).client)
+}
+
+// rateLimitKey is the client a rate limit applies to: an IPv4 address or
+// the /64 prefix of an IPv6 address, as clients are usually given a whole
+// /64 to pick addresses from
+func rateLimitKey(ip net.IP) string {
+	if ip.To4() == nil && len(ip) == net.IPv6len {
+		return (&net.IPNet{IP: ip.Mask(net.CIDRMask(64, 128)), Mask: net.CIDRMask(64, 128)}).String()
+	}
+	return ip.String()
+}
+
+// Clients returns how many clients are being tracked
+func (l *RateLimiter) Clients() int {
+	l.Lock()
+	defer l.Unlock()
+
+	return len(l.buckets)
+}
+
+// rateLimited writes a 429 Too Many Requests with Retry-After and returns
+// true if the client of the request has made too many requests (never if
+// rate limiting is disabled)
+func (s *Server) rateLimited(w http.ResponseWriter, r *http.Request) bool {
+	if s.rateLimiter == nil {
+		return false
+	}
+
+	// Clients are told apart by the address they connect from, or behind
+	// -ip-proxies the address those forwarded for
+	ip := peerIP(r)
+	if s.ipFilter != nil {
+		ip = s.ipFilter.ClientIP(r)
+	}
+	client := r.RemoteAddr
+	if ip != nil {
+		client = rateLimitKey(ip)
+	}
+
+	ok, wait := s.rateLimiter.Allow(client)
+	if ok {
+		return false
+	}
+
+	s.counters.Inc("n_rate_limited")
+	w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+	http.Error(w, "Too Many Requests: slow down", http.StatusTooManyRequests)
+	return true
+}
+
+// rateLimit limits the requests of each client ip to h
+func (s *Server) rateLimit(h httprouter.Handle) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		if !s.rateLimited(w, r) {
+			h(w, r, p)
+		}
+	}
+}
+
+// rateLimitHandler limits the requests of each client ip to h, e.g: to
+// bookmarks as paths (/gh) handled by the router's NotFound handler
+func (s *Server) rateLimitHandler(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !s.rateLimited(w, r) {
+			h.ServeHTTP(w, r)
+		}
+	})
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/rcrowley/go-metrics"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRateLimiter(t *testing.T) {
+	assert := assert.New(t)
+
+	now := time.Now()
+	limiter := NewRateLimiter(60, 2)
+	limiter.now = func() time.Time { return now }
+
+	// Bursts are allowed
+	ok, _ := limiter.Allow("10.0.0.1")
+	assert.True(ok)
+	ok, _ = limiter.Allow("10.0.0.1")
+	assert.True(ok)
+	ok, wait := limiter.Allow("10.0.0.1")
+	assert.False(ok)
+	assert.Equal(time.Second, wait)
+
+	// Clients are limited independently
+	ok, _ = limiter.Allow("10.0.0.2")
+	assert.True(ok)
+
+	// Buckets refill over time
+	now = now.Add(500 * time.Millisecond)
+	ok, wait = limiter.Allow("10.0.0.1")
+	assert.False(ok)
+	assert.Equal(500*time.Millisecond, wait)
+
+	now = now.Add(500 * time.Millisecond)
+	ok, _ = limiter.Allow("10.0.0.1")
+	assert.True(ok)
+
+	// Refilled buckets are forgotten
+	assert.Equal(2, limiter.Clients())
+	now = now.Add(rateLimitSweepInterval)
+	ok, _ = limiter.Allow("10.0.0.3")
+	assert.True(ok)
+	assert.Equal(1, limiter.Clients())
+}
+
+func TestRateLimiterEvicts(t *testing.T) {
+	assert := assert.New(t)
+
+	now := time.Now()
+	limiter := NewRateLimiter(1, 1)
+	limiter.now = func() time.Time { return now }
+
+	for i := 0; i < maxRateLimitClients; i++ {
+		limiter.Allow(strconv.Itoa(i))
+		now = now.Add(time.Microsecond)
+	}
+	assert.Equal(maxRateLimitClients, limiter.Clients())
+
+	// The longest idle client makes room for new ones
+	ok, _ := limiter.Allow("new")
+	assert.True(ok)
+	assert.Equal(maxRateLimitClients, limiter.Clients())
+	ok, _ = limiter.Allow("0")
+	assert.True(ok)
+	ok, _ = limiter.Allow("new")
+	assert.False(ok)
+
+	// Clients making requests aren't idle
+	now = now.Add(time.Microsecond)
+	ok, _ = limiter.Allow("2")
+	assert.False(ok)
+	limiter.Allow("other")
+	ok, _ = limiter.Allow("2")
+	assert.False(ok)
+	ok, _ = limiter.Allow("3")
+	assert.True(ok)
+}
+
+func TestRateLimitKey(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.Equal("192.0.2.1", rateLimitKey(net.ParseIP("192.0.2.1")))
+	assert.Equal("192.0.2.1", rateLimitKey(net.ParseIP("::ffff:192.0.2.1")))
+	assert.Equal("2001:db8:1:2::/64", rateLimitKey(net.ParseIP("2001:db8:1:2:a:b:c:d")))
+	assert.Equal("2001:db8:1:2::/64", rateLimitKey(net.ParseIP("2001:db8:1:2::1")))
+}
+
+func TestRateLimit(t *testing.T) {
+	assert := assert.New(t)
+
+	counters := NewCounters()
+	s := &Server{counters: counters, rateLimiter: NewRateLimiter(1, 1)}
+	h := s.rateLimit(func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {})
+
+	do := func(xff string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r, _ := http.NewRequest("GET", "/?q=gh", nil)
+		r.RemoteAddr = "192.0.2.1:1234"
+		if xff != "" {
+			r.Header.Set("X-Forwarded-For", xff)
+		}
+		h(w, r, nil)
+		return w
+	}
+
+	assert.Equal(http.StatusOK, do("").Code)
+	w := do("")
+	assert.Equal(http.StatusTooManyRequests, w.Code)
+	assert.Equal("60", w.Header().Get("Retry-After"))
+
+	// Clients can't pick their own address
+	assert.Equal(http.StatusTooManyRequests, do("203.0.113.7").Code)
+
+	// Clients behind the proxies are told apart by X-Forwarded-For
+	proxies, err := ParseNetworks("192.0.2.0/24")
+	assert.NoError(err)
+	s.ipFilter = NewIPFilter(nil, nil, proxies, counters)
+	assert.Equal(http.StatusOK, do("198.51.100.1, 203.0.113.7").Code)
+	assert.Equal(http.StatusTooManyRequests, do("203.0.113.7").Code)
+
+	counter, ok := counters.r.Get("n_rate_limited").(metrics.Counter)
+	assert.True(ok)
+	assert.Equal(int64(3), counter.Count())
+
+	// IPv6 clients are limited by their /64
+	s.ipFilter = nil
+	r, _ := http.NewRequest("GET", "/?q=gh", nil)
+	r.RemoteAddr = "[2001:db8::1]:1234"
+	w = httptest.NewRecorder()
+	h(w, r, nil)
+	assert.Equal(http.StatusOK, w.Code)
+	r.RemoteAddr = "[2001:db8::2]:1234"
+	w = httptest.NewRecorder()
+	h(w, r, nil)
+	assert.Equal(http.StatusTooManyRequests, w.Code)
+	r.RemoteAddr = "[2001:db8:0:1::1]:1234"
+	w = httptest.NewRecorder()
+	h(w, r, nil)
+	assert.Equal(http.StatusOK, w.Code)
+
+	// Without a limiter nothing is limited
+	s.rateLimiter = nil
+	assert.Equal(http.StatusOK, do("").Code)
+}
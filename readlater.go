@@ -0,0 +1,506 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+const (
+	// PocketAPIURL is the base url of the Pocket API
+	PocketAPIURL = "https://getpocket.com/v3"
+
+	// InstapaperAPIURL is the base url of the Instapaper Simple API
+	InstapaperAPIURL = "https://www.instapaper.com/api"
+
+	// MaxReadLaterBytes is the maximum size of a read-later service response
+	MaxReadLaterBytes = 1 << 20
+
+	// MaxReadingRequestBytes is the maximum size of a save request body
+	MaxReadingRequestBytes = 64 * 1024
+)
+
+// ErrNoReadLater is returned when saving without a read-later service
+var ErrNoReadLater = errors.New("no read-later service is configured (-read-later)")
+
+// readLater is the read-later service pages are saved to (if any), set up
+// by NewServer from the configuration
+var readLater ReadLater
+
+// ReadLater is a read-later service pages can be saved to
+type ReadLater interface {
+	Name() string
+	Save(url, title string) error
+}
+
+// NewReadLater returns the read-later service of the configuration, or nil
+// if none is configured. The key is the Pocket consumer key and access
+// token, or the Wallabag client id and secret, separated by a colon.
+func NewReadLater(config Config) (ReadLater, error) {
+	id, secret := splitReadLaterKey(config.ReadLaterKey)
+
+	switch strings.ToLower(config.ReadLater) {
+	case "":
+		return nil, nil
+	case "pocket":
+		if id == "" || secret == "" {
+			return nil, errors.New("pocket requires -read-later-key <consumer key>:<access token>")
+		}
+		baseURL := config.ReadLaterURL
+		if baseURL == "" {
+			baseURL = PocketAPIURL
+		}
+		return &Pocket{baseURL: strings.TrimRight(baseURL, "/"), consumerKey: id, accessToken: secret}, nil
+	case "instapaper":
+		if config.ReadLaterUser == "" {
+			return nil, errors.New("instapaper requires -read-later-user")
+		}
+		baseURL := config.ReadLaterURL
+		if baseURL == "" {
+			baseURL = InstapaperAPIURL
+		}
+		return &Instapaper{
+			baseURL:  strings.TrimRight(baseURL, "/"),
+			username: config.ReadLaterUser,
+			password: config.ReadLaterPassword,
+		}, nil
+	case "wallabag":
+		if config.ReadLaterURL == "" {
+			return nil, errors.New("wallabag requires -read-later-url")
+		}
+		if id == "" || secret == "" || config.ReadLaterUser == "" || config.ReadLaterPassword == "" {
+			return nil, errors.New("wallabag requires -read-later-key <client id>:<client secret>, -read-later-user and -read-later-password")
+		}
+		return &Wallabag{
+			baseURL:      strings.TrimRight(config.ReadLaterURL, "/"),
+			clientID:     id,
+			clientSecret: secret,
+			username:     config.ReadLaterUser,
+			password:     config.ReadLaterPassword,
+		}, nil
+	default:
+		return nil, fmt.Errorf("unsupported read-later service %q (expected pocket, instapaper or wallabag)", config.ReadLater)
+	}
+}
+
+func splitReadLaterKey(key string) (string, string) {
+	if i := strings.Index(key, ":"); i >= 0 {
+		return key[:i], key[i+1:]
+	}
+	return key, ""
+}
+
+// readLaterDo sends a request to a read-later service, decoding the JSON
+// response into v (if not nil)
+func readLaterDo(service string, req *http.Request, v interface{}) error {
+	res, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	data, err := ioutil.ReadAll(io.LimitReader(res.Body, MaxReadLaterBytes))
+	if err != nil {
+		return err
+	}
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return fmt.Errorf("%s: %s %s: %s", service, req.Method, req.URL.Path, res.Status)
+	}
+
+	if v == nil {
+		return nil
+	}
+	return json.Unmarshal(data, v)
+}
+
+// Pocket saves pages to Pocket with an application's consumer key and a
+// user's access token
+type Pocket struct {
+	baseURL     string
+	consumerKey string
+	accessToken string
+}
+
+// Name ...
+func (p *Pocket) Name() string {
+	return "pocket"
+}
+
+// Save ...
+func (p *Pocket) Save(url, title string) error {
+	data, err := json.Marshal(map[string]string{
+		"url":          url,
+		"title":        title,
+		"consumer_key": p.consumerKey,
+		"access_token": p.accessToken,
+	})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest("POST", p.baseURL+"/add", bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json; charset=UTF-8")
+	req.Header.Set("X-Accept", "application/json")
+
+	return readLaterDo(p.Name(), req, nil)
+}
+
+// Instapaper saves pages to Instapaper with its Simple API
+type Instapaper struct {
+	baseURL  string
+	username string
+	password string
+}
+
+// Name ...
+func (i *Instapaper) Name() string {
+	return "instapaper"
+}
+
+// Save ...
+func (i *Instapaper) Save(u, title string) error {
+	form := url.Values{"url": {u}}
+	if title != "" {
+		form.Set("title", title)
+	}
+
+	req, err := http.NewRequest("POST", i.baseURL+"/add", strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.SetBasicAuth(i.username, i.password)
+
+	return readLaterDo(i.Name(), req, nil)
+}
+
+// Wallabag saves pages to a Wallabag instance, requesting (and renewing)
+// an OAuth access token with the user's password
+type Wallabag struct {
+	baseURL      string
+	clientID     string
+	clientSecret string
+	username     string
+	password     string
+
+	mu      sync.Mutex
+	token   string
+	expires time.Time
+}
+
+// Name ...
+func (wb *Wallabag) Name() string {
+	return "wallabag"
+}
+
+func (wb *Wallabag) accessToken() (string, error) {
+	wb.mu.Lock()
+	defer wb.mu.Unlock()
+
+	if wb.token != "" && time.Now().Before(wb.expires) {
+		return wb.token, nil
+	}
+
+	form := url.Values{
+		"grant_type":    {"password"},
+		"client_id":     {wb.clientID},
+		"client_secret": {wb.clientSecret},
+		"username":      {wb.username},
+		"password":      {wb.password},
+	}
+	req, err := http.NewRequest("POST", wb.baseURL+"/oauth/v2/token", strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	var res struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int64  `json:"expires_in"`
+	}
+	if err := readLaterDo(wb.Name(), req, &res); err != nil {
+		return "", err
+	}
+	if res.AccessToken == "" {
+		return "", errors.New("wallabag: no access token granted")
+	}
+
+	// Renew a minute early so the token doesn't expire mid request
+	wb.token = res.AccessToken
+	wb.expires = time.Now().Add(time.Duration(res.ExpiresIn)*time.Second - time.Minute)
+
+	return wb.token, nil
+}
+
+// Save ...
+func (wb *Wallabag) Save(url, title string) error {
+	token, err := wb.accessToken()
+	if err != nil {
+		return err
+	}
+
+	entry := map[string]string{"url": url}
+	if title != "" {
+		entry["title"] = title
+	}
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest("POST", wb.baseURL+"/api/entries.json", bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Content-Type", "application/json")
+
+	return readLaterDo(wb.Name(), req, nil)
+}
+
+// ReadingItem is a page saved to the read-later service
+type ReadingItem struct {
+	ID      string    `json:"id"`
+	Time    time.Time `json:"time"`
+	URL     string    `json:"url"`
+	Title   string    `json:"title,omitempty"`
+	Service string    `json:"service"`
+}
+
+func readingKey(id string) []byte {
+	return []byte(fmt.Sprintf("reading_%s", id))
+}
+
+// SaveForLater saves the page at url to the read-later service and records
+// it so it is listed by ListReading. The page is recorded first so nothing
+// is pushed to the service when the store is read-only.
+func SaveForLater(service ReadLater, u, title string) (ReadingItem, error) {
+	if service == nil {
+		return ReadingItem{}, ErrNoReadLater
+	}
+	if !strings.HasPrefix(u, "http://") && !strings.HasPrefix(u, "https://") {
+		return ReadingItem{}, fmt.Errorf("url must be an absolute http(s) url")
+	}
+
+	item := ReadingItem{Time: time.Now(), URL: u, Title: title, Service: service.Name()}
+	item.ID = newHistoryID(item.Time)
+
+	data, err := json.Marshal(item)
+	if err != nil {
+		return item, err
+	}
+	if err := db.Put(readingKey(item.ID), data); err != nil {
+		return item, err
+	}
+
+	if err := service.Save(u, title); err != nil {
+		db.Delete(readingKey(item.ID))
+		return item, err
+	}
+
+	return item, nil
+}
+
+// ListReading returns up to limit of the saved pages, newest first
+func ListReading(limit int) ([]ReadingItem, error) {
+	if limit <= 0 {
+		limit = DefaultHistoryPageSize
+	}
+
+	var ids []string
+	err := db.Scan([]byte("reading_"), func(key []byte) error {
+		ids = append(ids, strings.TrimPrefix(string(key), "reading_"))
+		if len(ids) > limit {
+			ids = ids[1:]
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	items := []ReadingItem{}
+	for i := len(ids) - 1; i >= 0; i-- {
+		val, err := db.Get(readingKey(ids[i]))
+		if err != nil {
+			return nil, err
+		}
+		var item ReadingItem
+		if err := json.Unmarshal(val, &item); err != nil {
+			return nil, err
+		}
+		item.ID = ids[i]
+		items = append(items, item)
+	}
+
+	return items, nil
+}
+
+// Save ...
+type Save struct{}
+
+// Name ...
+func (p Save) Name() string {
+	return "save"
+}
+
+// Desc ...
+func (p Save) Desc() string {
+	return `save [url]
+
+	Saves the url to the configured read-later service (Pocket, Instapaper
+	or Wallabag). Without a url the page you came from (or the url and title
+	parameters sent by a browser extension) is saved. For example:
+
+	save https://go.dev/blog/go1.13-errors
+
+	Saved pages are listed by 'reading'.
+	`
+}
+
+// Exec ...
+func (p Save) Exec(w http.ResponseWriter, r *http.Request, args []string) error {
+	var u string
+
+	switch len(args) {
+	case 0:
+		if u = r.FormValue("url"); u == "" {
+			u = r.Referer()
+		}
+		if u == "" {
+			return fmt.Errorf("no url to save")
+		}
+	case 1:
+		u = args[0]
+	default:
+		return fmt.Errorf("expected at most 1 argument got %d", len(args))
+	}
+
+	if _, err := SaveForLater(readLater, u, r.FormValue("title")); err != nil {
+		return err
+	}
+
+	w.Write([]byte("OK"))
+
+	return nil
+}
+
+// Reading ...
+type Reading struct{}
+
+// Name ...
+func (p Reading) Name() string {
+	return "reading"
+}
+
+// Desc ...
+func (p Reading) Desc() string {
+	return `reading
+
+	Lists the pages saved with 'save', newest first.
+	`
+}
+
+// Exec ...
+func (p Reading) Exec(w http.ResponseWriter, r *http.Request, args []string) error {
+	items, err := ListReading(DefaultHistoryPageSize)
+	if err != nil {
+		return err
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	for _, item := range items {
+		line := fmt.Sprintf("%s %s", item.Time.Format("2006-01-02 15:04"), item.URL)
+		if item.Title != "" {
+			line += " " + item.Title
+		}
+		fmt.Fprintln(w, line)
+	}
+
+	return nil
+}
+
+// ReadingRequest is the body of requests saving a page for later
+type ReadingRequest struct {
+	URL   string `json:"url"`
+	Title string `json:"title"`
+}
+
+// ReadingHandler lists the pages saved for later, newest first
+func (s *Server) ReadingHandler() httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+		s.counters.Inc("n_api_reading")
+
+		limit := DefaultHistoryPageSize
+		if v := r.URL.Query().Get("limit"); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n <= 0 || n > MaxHistoryPageSize {
+				WriteAPIError(w, r, http.StatusBadRequest, ErrCodeBadRequest, "invalid limit", nil)
+				return
+			}
+			limit = n
+		}
+
+		items, err := ListReading(limit)
+		if err != nil {
+			WriteAPIError(
+				w, r, http.StatusInternalServerError, ErrCodeInternal,
+				"error reading saved pages", err.Error(),
+			)
+			return
+		}
+
+		WriteJSON(w, http.StatusOK, map[string]interface{}{"items": items})
+	}
+}
+
+// SaveReadingHandler saves a page to the read-later service from a JSON
+// body, e.g: {"url": "https://go.dev/blog", "title": "The Go Blog"}
+func (s *Server) SaveReadingHandler() httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+		s.counters.Inc("n_api_reading_save")
+
+		if !s.writable(w, r) {
+			return
+		}
+		if readLater == nil {
+			WriteAPIError(w, r, http.StatusNotFound, ErrCodeNotFound, ErrNoReadLater.Error(), nil)
+			return
+		}
+
+		var req ReadingRequest
+		if err := json.NewDecoder(io.LimitReader(r.Body, MaxReadingRequestBytes)).Decode(&req); err != nil {
+			WriteAPIError(w, r, http.StatusBadRequest, ErrCodeBadRequest, "invalid json", err.Error())
+			return
+		}
+		if !strings.HasPrefix(req.URL, "http://") && !strings.HasPrefix(req.URL, "https://") {
+			WriteAPIError(w, r, http.StatusBadRequest, ErrCodeBadRequest, "url must be an absolute http(s) url", nil)
+			return
+		}
+
+		item, err := SaveForLater(readLater, req.URL, req.Title)
+		if err != nil {
+			WriteAPIError(
+				w, r, http.StatusBadGateway, ErrCodeUpstream,
+				fmt.Sprintf("error saving to %s", readLater.Name()), err.Error(),
+			)
+			return
+		}
+
+		WriteJSON(w, http.StatusCreated, item)
+	}
+}
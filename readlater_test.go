@@ -0,0 +1,244 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewReadLater(t *testing.T) {
+	assert := assert.New(t)
+
+	service, err := NewReadLater(Config{})
+	assert.NoError(err)
+	assert.Nil(service)
+
+	service, err = NewReadLater(Config{ReadLater: "Pocket", ReadLaterKey: "key:token"})
+	assert.NoError(err)
+	assert.Equal("pocket", service.Name())
+
+	service, err = NewReadLater(Config{ReadLater: "instapaper", ReadLaterUser: "me"})
+	assert.NoError(err)
+	assert.Equal("instapaper", service.Name())
+
+	for _, config := range []Config{
+		{ReadLater: "pocket", ReadLaterKey: "key"},
+		{ReadLater: "instapaper"},
+		{ReadLater: "wallabag", ReadLaterKey: "id:secret", ReadLaterUser: "me", ReadLaterPassword: "pass"},
+		{ReadLater: "wallabag", ReadLaterURL: "https://wallabag.example.com", ReadLaterUser: "me", ReadLaterPassword: "pass"},
+		{ReadLater: "delicious"},
+	} {
+		_, err = NewReadLater(config)
+		assert.Error(err, config.ReadLater)
+	}
+}
+
+func TestPocket(t *testing.T) {
+	assert := assert.New(t)
+
+	var got map[string]string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal("/v3/add", r.URL.Path)
+		json.NewDecoder(r.Body).Decode(&got)
+		w.Write([]byte(`{"status": 1}`))
+	}))
+	defer ts.Close()
+
+	service, err := NewReadLater(Config{ReadLater: "pocket", ReadLaterURL: ts.URL + "/v3", ReadLaterKey: "key:token"})
+	assert.NoError(err)
+	assert.NoError(service.Save("https://go.dev/blog", "The Go Blog"))
+	assert.Equal(map[string]string{
+		"url": "https://go.dev/blog", "title": "The Go Blog",
+		"consumer_key": "key", "access_token": "token",
+	}, got)
+}
+
+func TestInstapaper(t *testing.T) {
+	assert := assert.New(t)
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, pass, _ := r.BasicAuth()
+		if user != "me" || pass != "pass" {
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+		assert.Equal("/api/add", r.URL.Path)
+		assert.Equal("https://go.dev/blog", r.FormValue("url"))
+		w.WriteHeader(http.StatusCreated)
+	}))
+	defer ts.Close()
+
+	service, err := NewReadLater(Config{ReadLater: "instapaper", ReadLaterURL: ts.URL + "/api", ReadLaterUser: "me", ReadLaterPassword: "pass"})
+	assert.NoError(err)
+	assert.NoError(service.Save("https://go.dev/blog", ""))
+
+	service, err = NewReadLater(Config{ReadLater: "instapaper", ReadLaterURL: ts.URL + "/api", ReadLaterUser: "me"})
+	assert.NoError(err)
+	assert.Error(service.Save("https://go.dev/blog", ""))
+}
+
+func TestWallabag(t *testing.T) {
+	assert := assert.New(t)
+
+	tokens, entries := 0, 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/oauth/v2/token":
+			tokens++
+			assert.Equal("password", r.FormValue("grant_type"))
+			assert.Equal("id", r.FormValue("client_id"))
+			assert.Equal("me", r.FormValue("username"))
+			w.Write([]byte(`{"access_token": "t0k3n", "expires_in": 3600}`))
+		case "/api/entries.json":
+			entries++
+			assert.Equal("Bearer t0k3n", r.Header.Get("Authorization"))
+			w.Write([]byte(`{"id": 1}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer ts.Close()
+
+	service, err := NewReadLater(Config{
+		ReadLater: "wallabag", ReadLaterURL: ts.URL, ReadLaterKey: "id:secret",
+		ReadLaterUser: "me", ReadLaterPassword: "pass",
+	})
+	assert.NoError(err)
+	assert.NoError(service.Save("https://go.dev/blog", ""))
+	assert.NoError(service.Save("https://go.dev/doc", "Documentation"))
+	assert.Equal(1, tokens)
+	assert.Equal(2, entries)
+}
+
+func TestSaveAndReading(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir("", "golinks")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	db, err = OpenStore(filepath.Join(dir, "test.db"))
+	assert.NoError(err)
+	defer db.Close()
+
+	var saved []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req map[string]string
+		json.NewDecoder(r.Body).Decode(&req)
+		if strings.Contains(req["url"], "fail") {
+			http.Error(w, "Bad Request", http.StatusBadRequest)
+			return
+		}
+		saved = append(saved, req["url"])
+	}))
+	defer ts.Close()
+
+	s, err := NewServer(":8000", Config{ReadLater: "pocket", ReadLaterURL: ts.URL, ReadLaterKey: "key:token"})
+	assert.NoError(err)
+	defer func() { readLater = nil }()
+
+	w := httptest.NewRecorder()
+	s.router.ServeHTTP(w, postQuery(url.Values{"q": {"save https://go.dev/blog"}}))
+	assert.Equal(http.StatusOK, w.Code)
+	assert.Equal("OK", w.Body.String())
+
+	// The current page of a browser extension is confirmed first
+	w = httptest.NewRecorder()
+	r, _ := http.NewRequest("GET", "/?q=save&url=https://go.dev/doc&title=Documentation", nil)
+	s.router.ServeHTTP(w, r)
+	assert.Equal(http.StatusOK, w.Code)
+	assert.Contains(w.Body.String(), `name="url" value="https://go.dev/doc"`)
+	assert.Contains(w.Body.String(), `name="title" value="Documentation"`)
+	assert.Equal([]string{"https://go.dev/blog"}, saved)
+
+	w = httptest.NewRecorder()
+	s.router.ServeHTTP(w, postQuery(url.Values{"q": {"save"}, "url": {"https://go.dev/doc"}, "title": {"Documentation"}}))
+	assert.Equal(http.StatusOK, w.Code)
+
+	w = httptest.NewRecorder()
+	s.router.ServeHTTP(w, postQuery(url.Values{"q": {"save"}}))
+	assert.Equal(http.StatusInternalServerError, w.Code)
+
+	// Failures aren't listed
+	w = httptest.NewRecorder()
+	s.router.ServeHTTP(w, postQuery(url.Values{"q": {"save https://fail.example.com"}}))
+	assert.Equal(http.StatusInternalServerError, w.Code)
+
+	assert.Equal([]string{"https://go.dev/blog", "https://go.dev/doc"}, saved)
+
+	w = httptest.NewRecorder()
+	r, _ = http.NewRequest("GET", "/?q=reading", nil)
+	s.router.ServeHTTP(w, r)
+	assert.Equal(http.StatusOK, w.Code)
+	lines := strings.Split(strings.TrimSpace(w.Body.String()), "\n")
+	assert.Len(lines, 2)
+	assert.True(strings.HasSuffix(lines[0], " https://go.dev/doc Documentation"))
+	assert.True(strings.HasSuffix(lines[1], " https://go.dev/blog"))
+
+	// API
+	w = httptest.NewRecorder()
+	r, _ = http.NewRequest("POST", "/api/v1/reading", strings.NewReader(`{"url": "https://go.dev/play", "title": "Playground"}`))
+	authorize(r, ScopeWrite)
+	s.router.ServeHTTP(w, r)
+	assert.Equal(http.StatusCreated, w.Code)
+
+	w = httptest.NewRecorder()
+	r, _ = http.NewRequest("POST", "/api/v1/reading", strings.NewReader(`{"url": "https://fail.example.com"}`))
+	authorize(r, ScopeWrite)
+	s.router.ServeHTTP(w, r)
+	assert.Equal(http.StatusBadGateway, w.Code)
+
+	w = httptest.NewRecorder()
+	r, _ = http.NewRequest("POST", "/api/v1/reading", strings.NewReader(`{"url": "ftp://go.dev"}`))
+	authorize(r, ScopeWrite)
+	s.router.ServeHTTP(w, r)
+	assert.Equal(http.StatusBadRequest, w.Code)
+
+	w = httptest.NewRecorder()
+	r, _ = http.NewRequest("GET", "/api/v1/reading?limit=2", nil)
+	authorize(r, ScopeRead)
+	s.router.ServeHTTP(w, r)
+	assert.Equal(http.StatusOK, w.Code)
+
+	var res struct {
+		Items []ReadingItem `json:"items"`
+	}
+	assert.NoError(json.Unmarshal(w.Body.Bytes(), &res))
+	assert.Len(res.Items, 2)
+	assert.Equal("https://go.dev/play", res.Items[0].URL)
+	assert.Equal("Playground", res.Items[0].Title)
+	assert.Equal("pocket", res.Items[0].Service)
+	assert.Equal("https://go.dev/doc", res.Items[1].URL)
+}
+
+func TestSaveWithoutReadLater(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir("", "golinks")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	db, err = OpenStore(filepath.Join(dir, "test.db"))
+	assert.NoError(err)
+	defer db.Close()
+
+	s, err := NewServer(":8000", Config{})
+	assert.NoError(err)
+
+	w := httptest.NewRecorder()
+	r, _ := http.NewRequest("POST", "/api/v1/reading", strings.NewReader(`{"url": "https://go.dev"}`))
+	authorize(r, ScopeWrite)
+	s.router.ServeHTTP(w, r)
+	assert.Equal(http.StatusNotFound, w.Code)
+
+	_, err = SaveForLater(readLater, "https://go.dev", "")
+	assert.Equal(ErrNoReadLater, err)
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"errors"
+)
+
+// writingCommands are the commands disabled in read-only mode
+var writingCommands = map[string]bool{
+	"add":    true,
+	"remove": true,
+}
+
+// ErrReadOnly is returned for any mutating operation in read-only mode
+var ErrReadOnly = errors.New("error: read-only mode")
+
+// ReadOnlyStore wraps a Store and rejects all mutating operations. This is
+// useful for staging replicas pointed at a backup copy of the database.
+type ReadOnlyStore struct {
+	Store
+}
+
+// NewReadOnlyStore ...
+func NewReadOnlyStore(store Store) *ReadOnlyStore {
+	return &ReadOnlyStore{Store: store}
+}
+
+// Unwrap returns the wrapped store
+func (s *ReadOnlyStore) Unwrap() Store {
+	return s.Store
+}
+
+// Put ...
+func (s *ReadOnlyStore) Put(key, value []byte) error {
+	return ErrReadOnly
+}
+
+// Delete ...
+func (s *ReadOnlyStore) Delete(key []byte) error {
+	return ErrReadOnly
+}
+
+// Merge ...
+func (s *ReadOnlyStore) Merge() error {
+	return ErrReadOnly
+}
+
+// commandEnabled reports whether the command can be used, i.e: unless it
+// writes bookmarks and the instance is read-only
+func (s *Server) commandEnabled(command Command) bool {
+	return !s.config.ReadOnly || !writingCommands[command.Name()]
+}
+
+// enabledCommands returns the commands that can be used (see
+// commandEnabled), sorted by name
+func (s *Server) enabledCommands() []Command {
+	var commands []Command
+	for _, command := range SortedCommands() {
+		if s.commandEnabled(command) {
+			commands = append(commands, command)
+		}
+	}
+	return commands
+}
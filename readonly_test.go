@@ -0,0 +1,108 @@
+package main
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReadOnlyStore(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir("", "golinks")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	store, err := OpenStore(filepath.Join(dir, "test.db"))
+	assert.NoError(err)
+	defer store.Close()
+
+	assert.NoError(store.Put([]byte("bookmark_g"), []byte("https://google.com")))
+
+	ro := NewReadOnlyStore(store)
+
+	val, err := ro.Get([]byte("bookmark_g"))
+	assert.NoError(err)
+	assert.Equal("https://google.com", string(val))
+
+	assert.Equal(ErrReadOnly, ro.Put([]byte("bookmark_g"), []byte("foo")))
+	assert.Equal(ErrReadOnly, ro.Delete([]byte("bookmark_g")))
+	assert.Equal(ErrReadOnly, ro.Merge())
+}
+
+func TestReadOnlyCommands(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir("", "golinks")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	store, err := OpenStore(filepath.Join(dir, "test.db"))
+	assert.NoError(err)
+	defer store.Close()
+
+	assert.NoError(store.Put([]byte("bookmark_g"), []byte("https://google.com/search?q=%s")))
+
+	db = NewReadOnlyStore(store)
+
+	s, err := NewServer(":8000", Config{ReadOnly: true, ReplicationSecret: "secret"})
+	assert.NoError(err)
+
+	w := httptest.NewRecorder()
+	s.router.ServeHTTP(w, postQuery(url.Values{"q": {"add foo https://foo.com"}}))
+	assert.Equal(http.StatusForbidden, w.Code)
+	assert.False(store.Has([]byte("bookmark_foo")))
+
+	w = httptest.NewRecorder()
+	r, _ := http.NewRequest("GET", "/?q=g%20foo", nil)
+	s.router.ServeHTTP(w, r)
+	assert.Equal(http.StatusFound, w.Code)
+
+	w = httptest.NewRecorder()
+	r, _ = http.NewRequest("POST", "/replication", strings.NewReader(`{"ops":[]}`))
+	r.Header.Set("Authorization", "Bearer secret")
+	s.router.ServeHTTP(w, r)
+	assert.Equal(http.StatusForbidden, w.Code)
+}
+
+func TestReadOnlyDisablesCommands(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir("", "golinks")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	db, err = OpenStore(filepath.Join(dir, "test.db"))
+	assert.NoError(err)
+	defer db.Close()
+
+	assert.NoError(SaveBookmark("g", "https://google.com/search?q=%s"))
+
+	// The commands are disabled, even if the store itself is writable
+	s, err := NewServer(":8000", Config{ReadOnly: true})
+	assert.NoError(err)
+
+	w := httptest.NewRecorder()
+	s.router.ServeHTTP(w, postQuery(url.Values{"q": {"remove g"}}))
+	assert.Equal(http.StatusForbidden, w.Code)
+	assert.True(db.Has([]byte("bookmark_g")))
+
+	w = httptest.NewRecorder()
+	r, _ := http.NewRequest("GET", "/list?format=json", nil)
+	s.router.ServeHTTP(w, r)
+	assert.NotContains(w.Body.String(), `"name":"add"`)
+	assert.NotContains(w.Body.String(), `"name":"remove"`)
+	assert.Contains(w.Body.String(), `"name":"help"`)
+
+	w = httptest.NewRecorder()
+	r, _ = http.NewRequest("GET", "/help", nil)
+	s.router.ServeHTTP(w, r)
+	assert.NotContains(w.Body.String(), "add [name] [url]")
+}
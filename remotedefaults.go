@@ -0,0 +1,248 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prologic/bitcask"
+)
+
+// MaxManifestBytes is the maximum size of a manifest fetched from a url
+const MaxManifestBytes = 4 << 20
+
+// isURL reports whether the source is a http(s) url rather than a file
+func isURL(source string) bool {
+	return strings.HasPrefix(source, "http://") || strings.HasPrefix(source, "https://")
+}
+
+// fetchSource reads a http(s) url or local file of up to maxBytes
+func fetchSource(source string, maxBytes int64) ([]byte, error) {
+	if !isURL(source) {
+		return ioutil.ReadFile(source)
+	}
+
+	res, err := client.Get(source)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != 200 {
+		return nil, fmt.Errorf("error fetching %s: %s", source, res.Status)
+	}
+
+	data, err := ioutil.ReadAll(io.LimitReader(res.Body, maxBytes+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) > maxBytes {
+		return nil, fmt.Errorf("error fetching %s: larger than %d bytes", source, maxBytes)
+	}
+
+	return data, nil
+}
+
+func defaultKey(name string) []byte {
+	return []byte(fmt.Sprintf("default_%s", name))
+}
+
+// ApplyDefaults applies a catalog of default bookmarks. Unlike a synced
+// manifest, defaults never override local changes: bookmarks are only
+// created if they don't exist and only updated or removed if they still
+// have the url last applied from the catalog. Bookmarks deleted locally are
+// not recreated.
+func ApplyDefaults(manifest *Manifest) (result SyncResult, err error) {
+	previous := make(map[string]string)
+	err = db.Scan([]byte("default_"), func(key []byte) error {
+		val, err := db.Get(key)
+		if err != nil {
+			return err
+		}
+		previous[strings.TrimPrefix(string(key), "default_")] = string(val)
+		return nil
+	})
+	if err != nil {
+		return
+	}
+
+	current := func(name string) (string, bool, error) {
+		val, err := db.Get([]byte(fmt.Sprintf("bookmark_%s", name)))
+		if err == bitcask.ErrKeyNotFound {
+			return "", false, nil
+		}
+		return string(val), err == nil, err
+	}
+
+	declared := make(map[string]string)
+	for name, bookmark := range manifest.Bookmarks {
+		declared[strings.ToLower(name)] = bookmark.URL
+	}
+
+	for name, prev := range previous {
+		if _, ok := declared[name]; ok {
+			continue
+		}
+
+		var (
+			url    string
+			exists bool
+		)
+		if url, exists, err = current(name); err != nil {
+			return
+		}
+		if exists && url == prev {
+			if err = DeleteBookmark(name); err != nil {
+				return
+			}
+			result.Removed++
+		}
+		if err = db.Delete(defaultKey(name)); err != nil {
+			return
+		}
+	}
+
+	for name, url := range declared {
+		var (
+			cur    string
+			exists bool
+		)
+		if cur, exists, err = current(name); err != nil {
+			return
+		}
+		prev, applied := previous[name]
+
+		switch {
+		case !exists && !applied:
+			err = SaveBookmark(name, url)
+			result.Created++
+		case exists && cur != url && applied && cur == prev:
+			err = SaveBookmark(name, url)
+			result.Updated++
+		default:
+			// Unchanged, customized or deleted locally
+			result.Unchanged++
+		}
+		if err != nil {
+			return
+		}
+
+		if err = db.Put(defaultKey(name), []byte(url)); err != nil {
+			return
+		}
+	}
+
+	return
+}
+
+// DefaultsLoader periodically fetches a catalog of default bookmarks from a
+// url (or file) and applies it whenever its checksum changes, so a centrally
+// maintained catalog can feed many independently run instances.
+type DefaultsLoader struct {
+	sync.RWMutex
+
+	source   string
+	counters *Counters
+
+	checksum string
+}
+
+// NewDefaultsLoader ...
+func NewDefaultsLoader(source string, counters *Counters) *DefaultsLoader {
+	return &DefaultsLoader{source: source, counters: counters}
+}
+
+// Checksum returns the checksum of the last applied catalog
+func (l *DefaultsLoader) Checksum() string {
+	l.RLock()
+	defer l.RUnlock()
+
+	return l.checksum
+}
+
+// Sync fetches the catalog and applies it if it changed since the last sync
+func (l *DefaultsLoader) Sync() (changed bool, result SyncResult, err error) {
+	data, err := fetchSource(l.source, MaxManifestBytes)
+	if err != nil {
+		l.counters.Inc("n_defaults_failed")
+		return
+	}
+
+	sum := sha256.Sum256(data)
+	checksum := hex.EncodeToString(sum[:])
+
+	l.Lock()
+	defer l.Unlock()
+
+	if checksum == l.checksum {
+		return
+	}
+
+	manifest, err := ParseManifest(bytes.NewReader(data))
+	if err != nil {
+		l.counters.Inc("n_defaults_failed")
+		return
+	}
+
+	if result, err = ApplyDefaults(manifest); err != nil {
+		l.counters.Inc("n_defaults_failed")
+		return
+	}
+
+	l.checksum = checksum
+	l.counters.Inc("n_defaults_applied")
+
+	return true, result, nil
+}
+
+// Run syncs the catalog every interval until ctx is cancelled
+func (l *DefaultsLoader) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		if err := l.SyncAndLog(); err != nil {
+			slog.Error("error syncing defaults", "source", l.source, "err", err)
+		}
+	}
+}
+
+// SyncAndLog syncs the catalog and logs what changed (if anything)
+func (l *DefaultsLoader) SyncAndLog() error {
+	changed, result, err := l.Sync()
+	if err != nil {
+		return err
+	}
+	if changed {
+		slog.Info("applied defaults", "source", l.source, "result", result)
+	}
+	return nil
+}
+
+// SyncDefaults syncs the configured catalog of default bookmarks (if any)
+func (s *Server) SyncDefaults() error {
+	if s.defaults == nil {
+		return nil
+	}
+
+	if s.config.ReadOnly {
+		slog.Warn("not syncing defaults in read-only mode", "source", s.config.Defaults)
+		return nil
+	}
+
+	return s.defaults.SyncAndLog()
+}
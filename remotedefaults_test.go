@@ -0,0 +1,135 @@
+package main
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestApplyDefaults(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir("", "golinks")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	db, err = OpenStore(filepath.Join(dir, "test.db"))
+	assert.NoError(err)
+	defer db.Close()
+
+	assert.NoError(SaveBookmark("g", "https://www.google.com/search?q=%s"))
+
+	manifest, err := ParseManifest(strings.NewReader(
+		"bookmarks:\n  g: https://www.bing.com/search?q=%s\n  gh: https://github.com\n  wiki: https://wiki.example.com\n",
+	))
+	assert.NoError(err)
+
+	result, err := ApplyDefaults(manifest)
+	assert.NoError(err)
+	assert.Equal(SyncResult{Created: 2, Unchanged: 1}, result)
+
+	// Existing bookmarks are never overridden
+	bookmark, ok := LookupBookmark("g")
+	assert.True(ok)
+	assert.Equal("https://www.google.com/search?q=%s", bookmark.URL())
+
+	// Customized and deleted bookmarks are left alone
+	assert.NoError(SaveBookmark("gh", "https://github.example.com"))
+	assert.NoError(DeleteBookmark("wiki"))
+
+	manifest, err = ParseManifest(strings.NewReader(
+		"bookmarks:\n  gh: https://github.com/explore\n  wiki: https://wiki.example.com/new\n  jira: https://jira.example.com\n",
+	))
+	assert.NoError(err)
+
+	result, err = ApplyDefaults(manifest)
+	assert.NoError(err)
+	assert.Equal(SyncResult{Created: 1, Unchanged: 2}, result)
+
+	bookmark, ok = LookupBookmark("gh")
+	assert.True(ok)
+	assert.Equal("https://github.example.com", bookmark.URL())
+	_, ok = LookupBookmark("wiki")
+	assert.False(ok)
+
+	// Uncustomized bookmarks are updated and removed with the catalog
+	manifest, err = ParseManifest(strings.NewReader(
+		"bookmarks:\n  g: https://duckduckgo.com/?q=%s\n",
+	))
+	assert.NoError(err)
+	assert.NoError(SaveBookmark("gh", "https://github.com/explore"))
+
+	result, err = ApplyDefaults(manifest)
+	assert.NoError(err)
+	assert.Equal(SyncResult{Removed: 2, Unchanged: 1}, result)
+
+	_, ok = LookupBookmark("gh")
+	assert.False(ok)
+	_, ok = LookupBookmark("jira")
+	assert.False(ok)
+	bookmark, ok = LookupBookmark("g")
+	assert.True(ok)
+	assert.Equal("https://www.google.com/search?q=%s", bookmark.URL())
+}
+
+func TestDefaultsLoader(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir("", "golinks")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	db, err = OpenStore(filepath.Join(dir, "test.db"))
+	assert.NoError(err)
+	defer db.Close()
+
+	catalog := "bookmarks:\n  gh: https://github.com\n"
+	requests := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if catalog == "" {
+			http.Error(w, "Not Found", http.StatusNotFound)
+			return
+		}
+		w.Write([]byte(catalog))
+	}))
+	defer ts.Close()
+
+	s, err := NewServer(":8000", Config{Defaults: ts.URL + "/bookmarks.yaml"})
+	assert.NoError(err)
+	assert.NoError(s.SyncDefaults())
+
+	bookmark, ok := LookupBookmark("gh")
+	assert.True(ok)
+	assert.Equal("https://github.com", bookmark.URL())
+	checksum := s.defaults.Checksum()
+	assert.NotEmpty(checksum)
+
+	// An unchanged catalog is not applied again
+	changed, _, err := s.defaults.Sync()
+	assert.NoError(err)
+	assert.False(changed)
+	assert.Equal(2, requests)
+
+	catalog = "bookmarks:\n  gh: https://github.com/explore\n"
+	changed, result, err := s.defaults.Sync()
+	assert.NoError(err)
+	assert.True(changed)
+	assert.Equal(SyncResult{Updated: 1}, result)
+	assert.NotEqual(checksum, s.defaults.Checksum())
+
+	catalog = ""
+	assert.Error(s.SyncDefaults())
+	bookmark, ok = LookupBookmark("gh")
+	assert.True(ok)
+	assert.Equal("https://github.com/explore", bookmark.URL())
+
+	_, err = NewServer(":8000", Config{Offline: true, Defaults: ts.URL})
+	assert.Error(err)
+}
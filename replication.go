@@ -0,0 +1,287 @@
+package main
+
+import (
+	"bytes"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log/slog"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+const (
+	// ReplicationQueueSize is the maximum number of pending operations
+	ReplicationQueueSize = 1024
+
+	// ReplicationBatchSize is the maximum number of operations per request
+	ReplicationBatchSize = 100
+
+	// MaxReplicationRequestBytes is the maximum size of a replication batch
+	MaxReplicationRequestBytes = 16 << 20
+
+	replicationMaxBackoff = time.Minute
+)
+
+// ReplicationOp is a single write operation replicated to a standby
+type ReplicationOp struct {
+	Op    string `json:"op"`
+	Key   string `json:"key"`
+	Value string `json:"value,omitempty"`
+}
+
+// ReplicationBatch ...
+type ReplicationBatch struct {
+	Ops []ReplicationOp `json:"ops"`
+}
+
+// Replicator asynchronously streams write operations to a standby golinks
+// instance over HTTP. Operations are queued in memory and retried with
+// backoff; if the queue fills up (standby down for a long time) operations
+// are dropped and counted, so replication never blocks or fails writes.
+type Replicator struct {
+	url      string
+	secret   string
+	counters *Counters
+	client   *http.Client
+
+	queue chan ReplicationOp
+	done  chan struct{}
+	wg    sync.WaitGroup
+}
+
+// NewReplicator ...
+func NewReplicator(url, secret string, counters *Counters) *Replicator {
+	return &Replicator{
+		url:      strings.TrimSuffix(url, "/") + "/replication",
+		secret:   secret,
+		counters: counters,
+		client:   &http.Client{Timeout: 10 * time.Second},
+
+		queue: make(chan ReplicationOp, ReplicationQueueSize),
+		done:  make(chan struct{}),
+	}
+}
+
+// Enqueue queues an operation for replication without blocking
+func (r *Replicator) Enqueue(op ReplicationOp) {
+	select {
+	case r.queue <- op:
+		r.counters.Inc("n_replication_queued")
+	default:
+		r.counters.Inc("n_replication_dropped")
+		slog.Warn("replication queue full, dropping op", "op", op.Op, "key", op.Key)
+	}
+}
+
+func (r *Replicator) send(batch ReplicationBatch) error {
+	body, err := json.Marshal(batch)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest("POST", r.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+r.secret)
+
+	res, err := r.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	io.Copy(ioutil.Discard, res.Body)
+
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return fmt.Errorf("standby responded with %s", res.Status)
+	}
+
+	return nil
+}
+
+// sendWithRetry sends the batch retrying with exponential backoff until it
+// succeeds or the replicator is stopped.
+func (r *Replicator) sendWithRetry(batch ReplicationBatch) {
+	backoff := time.Second
+	for {
+		err := r.send(batch)
+		if err == nil {
+			r.counters.IncBy("n_replication_sent", int64(len(batch.Ops)))
+			return
+		}
+
+		r.counters.Inc("n_replication_failed")
+		slog.Warn("error replicating ops", "ops", len(batch.Ops), "err", err, "retry_in", backoff)
+
+		select {
+		case <-r.done:
+			r.counters.IncBy("n_replication_dropped", int64(len(batch.Ops)))
+			return
+		case <-time.After(backoff):
+		}
+
+		backoff *= 2
+		if backoff > replicationMaxBackoff {
+			backoff = replicationMaxBackoff
+		}
+	}
+}
+
+// Start starts sending queued operations in the background
+func (r *Replicator) Start() {
+	r.wg.Add(1)
+	go r.run()
+}
+
+func (r *Replicator) run() {
+	defer r.wg.Done()
+
+	for {
+		var batch ReplicationBatch
+
+		select {
+		case op := <-r.queue:
+			batch.Ops = append(batch.Ops, op)
+		case <-r.done:
+			return
+		}
+
+	collect:
+		for len(batch.Ops) < ReplicationBatchSize {
+			select {
+			case op := <-r.queue:
+				batch.Ops = append(batch.Ops, op)
+			default:
+				break collect
+			}
+		}
+
+		r.sendWithRetry(batch)
+	}
+}
+
+// Stop stops replication, making a final attempt to send pending operations
+func (r *Replicator) Stop() {
+	close(r.done)
+	r.wg.Wait()
+
+	var batch ReplicationBatch
+	for len(r.queue) > 0 {
+		batch.Ops = append(batch.Ops, <-r.queue)
+	}
+
+	if len(batch.Ops) > 0 {
+		if err := r.send(batch); err != nil {
+			r.counters.IncBy("n_replication_dropped", int64(len(batch.Ops)))
+			slog.Error("error replicating pending ops", "ops", len(batch.Ops), "err", err)
+		}
+	}
+}
+
+// ReplicatingStore wraps a Store and replicates every successful write
+type ReplicatingStore struct {
+	Store
+
+	replicator *Replicator
+}
+
+// NewReplicatingStore ...
+func NewReplicatingStore(store Store, replicator *Replicator) *ReplicatingStore {
+	return &ReplicatingStore{Store: store, replicator: replicator}
+}
+
+// Unwrap returns the wrapped store
+func (s *ReplicatingStore) Unwrap() Store {
+	return s.Store
+}
+
+// Put ...
+func (s *ReplicatingStore) Put(key, value []byte) error {
+	if err := s.Store.Put(key, value); err != nil {
+		return err
+	}
+	s.replicator.Enqueue(ReplicationOp{Op: "put", Key: string(key), Value: string(value)})
+	return nil
+}
+
+// Delete ...
+func (s *ReplicatingStore) Delete(key []byte) error {
+	if err := s.Store.Delete(key); err != nil {
+		return err
+	}
+	s.replicator.Enqueue(ReplicationOp{Op: "delete", Key: string(key)})
+	return nil
+}
+
+// ApplyReplicationBatch applies replicated operations to the store
+func ApplyReplicationBatch(store Store, batch ReplicationBatch) error {
+	for _, op := range batch.Ops {
+		var err error
+		switch op.Op {
+		case "put":
+			err = store.Put([]byte(op.Key), []byte(op.Value))
+		case "delete":
+			err = store.Delete([]byte(op.Key))
+		default:
+			err = fmt.Errorf("unknown op %q", op.Op)
+		}
+		if err != nil {
+			return fmt.Errorf("error applying %s %s: %s", op.Op, op.Key, err)
+		}
+	}
+	return nil
+}
+
+// ReplicationHandler accepts replicated writes from a primary instance
+func (s *Server) ReplicationHandler() httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+		secret := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if s.config.ReplicationSecret == "" ||
+			subtle.ConstantTimeCompare([]byte(secret), []byte(s.config.ReplicationSecret)) != 1 {
+			WriteAPIError(
+				w, r, http.StatusUnauthorized, ErrCodeUnauthorized,
+				"invalid or missing replication secret", nil,
+			)
+			return
+		}
+
+		var batch ReplicationBatch
+		r.Body = http.MaxBytesReader(w, r.Body, MaxReplicationRequestBytes)
+		if err := json.NewDecoder(r.Body).Decode(&batch); err != nil {
+			WriteAPIError(
+				w, r, http.StatusBadRequest, ErrCodeBadRequest,
+				"invalid replication batch", err.Error(),
+			)
+			return
+		}
+
+		if s.config.ReadOnly {
+			WriteAPIError(
+				w, r, http.StatusForbidden, ErrCodeForbidden,
+				"instance is read-only", nil,
+			)
+			return
+		}
+
+		if err := ApplyReplicationBatch(db, batch); err != nil {
+			slog.Error("error applying replication batch", "err", err)
+			WriteAPIError(
+				w, r, http.StatusInternalServerError, ErrCodeInternal,
+				"error applying replication batch", err.Error(),
+			)
+			return
+		}
+
+		s.counters.IncBy("n_replication_applied", int64(len(batch.Ops)))
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
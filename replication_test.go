@@ -0,0 +1,137 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReplication(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir("", "golinks")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	// Standby
+	db, err = OpenStore(filepath.Join(dir, "standby.db"))
+	assert.NoError(err)
+	defer db.Close()
+
+	standby, err := NewServer(":8000", Config{ReplicationSecret: "secret"})
+	assert.NoError(err)
+
+	ts := httptest.NewServer(standby.router)
+	defer ts.Close()
+
+	// Primary
+	primary, err := OpenStore(filepath.Join(dir, "primary.db"))
+	assert.NoError(err)
+	defer primary.Close()
+
+	replicator := NewReplicator(ts.URL, "secret", NewCounters())
+	replicator.Start()
+
+	store := NewReplicatingStore(primary, replicator)
+	assert.NoError(store.Put([]byte("bookmark_g"), []byte("https://google.com")))
+	assert.NoError(store.Put([]byte("bookmark_gh"), []byte("https://github.com")))
+	assert.NoError(store.Delete([]byte("bookmark_g")))
+
+	// Stop waits for in-flight ops and sends any pending ops
+	replicator.Stop()
+
+	assert.True(db.Has([]byte("bookmark_gh")))
+	assert.False(db.Has([]byte("bookmark_g")))
+
+	val, err := db.Get([]byte("bookmark_gh"))
+	assert.NoError(err)
+	assert.Equal("https://github.com", string(val))
+}
+
+func TestReplicationUnauthorized(t *testing.T) {
+	assert := assert.New(t)
+
+	s, err := NewServer(":8000", Config{})
+	assert.NoError(err)
+
+	w := httptest.NewRecorder()
+	r, _ := http.NewRequest("POST", "/replication", strings.NewReader(`{"ops":[]}`))
+	r.Header.Set("Authorization", "Bearer ")
+
+	s.router.ServeHTTP(w, r)
+	assert.Equal(http.StatusUnauthorized, w.Code)
+
+	s, err = NewServer(":8000", Config{ReplicationSecret: "secret"})
+	assert.NoError(err)
+
+	w = httptest.NewRecorder()
+	r, _ = http.NewRequest("POST", "/replication", strings.NewReader(`{"ops":[]}`))
+	r.Header.Set("Authorization", "Bearer foo")
+
+	s.router.ServeHTTP(w, r)
+	assert.Equal(http.StatusUnauthorized, w.Code)
+
+	// Batches are limited in size
+	body := `{"ops":[{"op":"put","key":"bookmark_g","value":"` + strings.Repeat("x", MaxReplicationRequestBytes) + `"}]}`
+	w = httptest.NewRecorder()
+	r, _ = http.NewRequest("POST", "/replication", strings.NewReader(body))
+	r.Header.Set("Authorization", "Bearer secret")
+
+	s.router.ServeHTTP(w, r)
+	assert.Equal(http.StatusBadRequest, w.Code)
+
+	// and primaries can't replicate without a secret
+	_, err = NewServer(":8000", Config{ReplicateTo: "http://standby:8000"})
+	assert.EqualError(err, "-replicate-to requires -replication-secret")
+}
+
+func TestReplicateStore(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir("", "golinks")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	db, err = OpenStore(filepath.Join(dir, "test.db"))
+	assert.NoError(err)
+	defer db.Close()
+
+	var batches []ReplicationBatch
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var batch ReplicationBatch
+		assert.NoError(json.NewDecoder(r.Body).Decode(&batch))
+		batches = append(batches, batch)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer ts.Close()
+
+	s, err := NewServer(":8000", Config{ReplicateTo: ts.URL, ReplicationSecret: "secret"})
+	assert.NoError(err)
+
+	// Writes made on startup, before the server runs, are replicated too
+	s.ReplicateStore()
+	assert.NoError(EnsureDefaultBookmarks())
+	s.replicator.Stop()
+
+	var keys []string
+	for _, batch := range batches {
+		for _, op := range batch.Ops {
+			keys = append(keys, op.Key)
+		}
+	}
+	assert.Contains(keys, "bookmark_gh")
+}
+
+func TestApplyReplicationBatchUnknownOp(t *testing.T) {
+	assert := assert.New(t)
+
+	err := ApplyReplicationBatch(nil, ReplicationBatch{Ops: []ReplicationOp{{Op: "foo"}}})
+	assert.Error(err)
+}
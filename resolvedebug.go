@@ -0,0 +1,215 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+// Kinds of resolution of a query
+const (
+	ResolvedCommand  = "command"
+	ResolvedBookmark = "bookmark"
+	ResolvedPeer     = "peer"
+	ResolvedCatalog  = "catalog"
+	ResolvedDefault  = "default"
+	ResolvedNone     = "none"
+)
+
+// ResolveStep is a step taken while resolving a query
+type ResolveStep struct {
+	Step   string `json:"step"`
+	Detail string `json:"detail"`
+	Match  bool   `json:"match"`
+}
+
+// ResolveTrace explains how a query is resolved, step by step
+type ResolveTrace struct {
+	Query  string        `json:"query"`
+	Name   string        `json:"name"`
+	Args   []string      `json:"args"`
+	Steps  []ResolveStep `json:"steps"`
+	Kind   string        `json:"kind"`
+	Target string        `json:"target,omitempty"`
+	URL    string        `json:"url,omitempty"`
+}
+
+func (t *ResolveTrace) step(step string, match bool, format string, args ...interface{}) {
+	t.Steps = append(t.Steps, ResolveStep{Step: step, Detail: fmt.Sprintf(format, args...), Match: match})
+}
+
+// expand substitutes the arguments into the url the same way bookmarks are
+// expanded and explains how
+func (t *ResolveTrace) expand(name, target string) {
+	t.Target = target
+	q := strings.Join(t.Args, " ")
+	t.URL = Bookmark{name: name, url: target}.Expand(q)
+
+	switch {
+	case q == "":
+		t.step("expand", true, "no arguments, the url is used as is")
+	case !strings.Contains(target, "%s"):
+		t.step("expand", false, "the url has no %%s placeholder for the arguments %q", q)
+	default:
+		t.step("expand", true, "substituted %q for %%s verbatim (it is not URL-encoded)", q)
+	}
+	if u, err := url.Parse(t.URL); err != nil || !u.IsAbs() {
+		t.step("url", false, "%q is not an absolute url", t.URL)
+	} else {
+		t.step("url", true, "redirects to %s", u)
+	}
+}
+
+// TraceResolution resolves a query the way it would be dispatched (see
+// IndexHandler and NotFoundHandler for paths) without running commands or
+// recording history, explaining each step
+func (s *Server) TraceResolution(q, path string) ResolveTrace {
+	trace := ResolveTrace{Query: q}
+
+	if path != "" {
+		var tokens []string
+		for _, token := range strings.Split(path, "/") {
+			if token != "" {
+				tokens = append(tokens, token)
+			}
+		}
+		trace.Query = strings.Join(tokens, " ")
+		if len(tokens) > 0 {
+			trace.Name, trace.Args = tokens[0], tokens[1:]
+		}
+		for i := len(tokens); i > 1; i-- {
+			name := strings.Join(tokens[:i], "/")
+			if _, ok := LookupBookmark(name); ok {
+				trace.Name, trace.Args = name, tokens[i:]
+				trace.step("folder", true, "the path matches the bookmark %s", name)
+				break
+			}
+		}
+		trace.step("tokenize", true, "path %q split on / into name %q and arguments %q", path, trace.Name, trace.Args)
+	} else {
+		tokens := strings.Split(q, " ")
+		trace.Name, trace.Args = tokens[0], tokens[1:]
+		trace.step("tokenize", true, "query %q split on spaces into name %q and arguments %q", q, trace.Name, trace.Args)
+	}
+
+	if trace.Name == "" {
+		trace.Kind = ResolvedNone
+		trace.step("empty", false, "nothing to resolve, the index page is shown")
+		return trace
+	}
+
+	if command := LookupCommand(trace.Name); command != nil {
+		trace.Kind = ResolvedCommand
+		trace.step("command", true, "%s is a built-in command (%s)", command.Name(), command.Desc())
+		return trace
+	}
+	trace.step("command", false, "%s is not a command", trace.Name)
+
+	name := strings.ToLower(trace.Name)
+	if name != trace.Name {
+		trace.step("normalize", true, "names are case insensitive, looking up %s", name)
+	}
+	target, err := bookmarkURL(name)
+	if err != nil {
+		trace.step("bookmark", false, "error reading bookmark %s: %s", name, err)
+	} else if target != "" {
+		trace.Kind = ResolvedBookmark
+		trace.step("bookmark", true, "%s is a bookmark for %s", name, target)
+		trace.expand(name, target)
+		return trace
+	} else {
+		trace.step("bookmark", false, "no bookmark named %s", name)
+	}
+
+	if alias, err := db.Get([]byte(fmt.Sprintf("alias_%s", name))); err == nil {
+		trace.step("alias", true, "%s is an alias of %s", name, alias)
+		if target, err := bookmarkURL(string(alias)); err == nil && target != "" {
+			trace.Kind = ResolvedBookmark
+			trace.step("bookmark", true, "%s is a bookmark for %s", alias, target)
+			trace.expand(string(alias), target)
+			return trace
+		}
+		trace.step("bookmark", false, "the alias refers to a missing bookmark %s", alias)
+	} else {
+		trace.step("alias", false, "%s is not an alias", name)
+	}
+
+	if s.federation != nil {
+		for _, peer := range s.federation.Peers() {
+			res, ok, err := resolveRemote(s.federation.client, peer, trace.Name)
+			switch {
+			case err != nil:
+				trace.step("peer", false, "error resolving %s from %s: %s", trace.Name, peer, err)
+			case ok:
+				trace.Kind = ResolvedPeer
+				trace.step("peer", true, "%s resolved %s to %s", peer, res.Name, res.URL)
+				trace.expand(res.Name, res.URL)
+				return trace
+			default:
+				trace.step("peer", false, "%s has no bookmark named %s", peer, trace.Name)
+			}
+		}
+	}
+
+	if s.catalog != nil {
+		_, cached := s.catalog.cached(name, time.Now())
+		res, ok := s.catalog.Resolve(trace.Name)
+		source := s.catalog.URL()
+		if cached {
+			source += " (cached)"
+		}
+		if ok {
+			trace.Kind = ResolvedCatalog
+			trace.step("catalog", true, "%s resolved %s to %s", source, res.Name, res.URL)
+			trace.expand(res.Name, res.URL)
+			return trace
+		}
+		trace.step("catalog", false, "%s has no bookmark named %s (or could not be reached)", source, trace.Name)
+	}
+
+	defaultURL := s.settings().URL
+	if defaultURL == "" {
+		trace.Kind = ResolvedNone
+		trace.step("default", false, "no default url is configured, the query is rejected")
+		return trace
+	}
+
+	// The default url is given the whole query rather than the arguments
+	trace.Kind = ResolvedDefault
+	trace.step("default", true, "nothing matched, the whole query goes to the default url")
+	trace.Args = strings.Split(trace.Query, " ")
+	trace.expand("", defaultURL)
+	return trace
+}
+
+// DebugResolveHandler explains how a query (?q=) or path (?path=) is
+// resolved, as an HTML page or JSON (see negotiateFormat)
+func (s *Server) DebugResolveHandler() httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+		s.counters.Inc("n_debug_resolve")
+
+		w.Header().Set("Vary", "Accept")
+		format, err := negotiateFormat(r)
+		if err != nil || format == FormatCSV {
+			WriteAPIError(w, r, http.StatusBadRequest, ErrCodeBadRequest, "format must be html or json", nil)
+			return
+		}
+
+		q, path := r.URL.Query().Get("q"), r.URL.Query().Get("path")
+		if q == "" && path == "" {
+			WriteAPIError(w, r, http.StatusBadRequest, ErrCodeBadRequest, "q or path is required", nil)
+			return
+		}
+
+		trace := s.TraceResolution(q, path)
+		if format == FormatJSON {
+			WriteJSON(w, http.StatusOK, trace)
+			return
+		}
+		s.render("resolve", w, r, trace)
+	}
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTraceResolution(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir("", "golinks")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	db, err = OpenStore(filepath.Join(dir, "test.db"))
+	assert.NoError(err)
+	defer db.Close()
+
+	assert.NoError(SaveBookmark("gh", "https://github.com/%s"))
+	assert.NoError(SaveBookmark("work/jira", "https://jira.example.com/browse/%s"))
+	assert.NoError(SaveBookmark("home", "https://example.com"))
+	assert.NoError(db.Put([]byte("alias_github"), []byte("gh")))
+
+	s, err := NewServer(":8000", Config{URL: DefaultURL})
+	assert.NoError(err)
+
+	steps := func(trace ResolveTrace) (steps []string) {
+		for _, step := range trace.Steps {
+			steps = append(steps, step.Step)
+		}
+		return
+	}
+
+	trace := s.TraceResolution("help", "")
+	assert.Equal(ResolvedCommand, trace.Kind)
+	assert.Equal([]string{"tokenize", "command"}, steps(trace))
+
+	trace = s.TraceResolution("GH prologic/golinks", "")
+	assert.Equal(ResolvedBookmark, trace.Kind)
+	assert.Equal([]string{"tokenize", "command", "normalize", "bookmark", "expand", "url"}, steps(trace))
+	assert.Equal("https://github.com/%s", trace.Target)
+	assert.Equal("https://github.com/prologic/golinks", trace.URL)
+
+	trace = s.TraceResolution("github golinks", "")
+	assert.Equal(ResolvedBookmark, trace.Kind)
+	assert.Equal([]string{"tokenize", "command", "bookmark", "alias", "bookmark", "expand", "url"}, steps(trace))
+	assert.Equal("https://github.com/golinks", trace.URL)
+
+	trace = s.TraceResolution("", "/work/jira/GL-1")
+	assert.Equal(ResolvedBookmark, trace.Kind)
+	assert.Equal("work/jira", trace.Name)
+	assert.Equal("https://jira.example.com/browse/GL-1", trace.URL)
+
+	// Arguments without a placeholder are flagged
+	trace = s.TraceResolution("home extra", "")
+	assert.False(trace.Steps[len(trace.Steps)-2].Match)
+
+	trace = s.TraceResolution("unknown things", "")
+	assert.Equal(ResolvedDefault, trace.Kind)
+	assert.Equal("https://www.google.com/search?q=unknown things&btnK", trace.URL)
+
+	s.config.URL = ""
+	trace = s.TraceResolution("unknown", "")
+	assert.Equal(ResolvedNone, trace.Kind)
+}
+
+func TestDebugResolveHandler(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir("", "golinks")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	db, err = OpenStore(filepath.Join(dir, "test.db"))
+	assert.NoError(err)
+	defer db.Close()
+
+	assert.NoError(SaveBookmark("gh", "https://github.com/%s"))
+
+	s, err := NewServer(":8000", Config{})
+	assert.NoError(err)
+
+	get := func(path, scope, accept string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r, _ := http.NewRequest("GET", path, nil)
+		r.Header.Set("Accept", accept)
+		authorize(r, scope)
+		s.router.ServeHTTP(w, r)
+		return w
+	}
+
+	w := get("/debug/resolve?q=gh", ScopeWrite, "")
+	assert.Equal(http.StatusForbidden, w.Code)
+
+	w = get("/debug/resolve?q=gh+golinks", ScopeAdmin, "application/json")
+	assert.Equal(http.StatusOK, w.Code)
+	var trace ResolveTrace
+	assert.NoError(json.Unmarshal(w.Body.Bytes(), &trace))
+	assert.Equal(ResolvedBookmark, trace.Kind)
+	assert.Equal("https://github.com/golinks", trace.URL)
+
+	w = get("/debug/resolve?q=gh+golinks", ScopeAdmin, "text/html")
+	assert.Equal(http.StatusOK, w.Code)
+	assert.Contains(w.Body.String(), "<code>https://github.com/golinks</code>")
+
+	w = get("/debug/resolve", ScopeAdmin, "")
+	assert.Equal(http.StatusBadRequest, w.Code)
+	w = get("/debug/resolve?q=gh&format=csv", ScopeAdmin, "")
+	assert.Equal(http.StatusBadRequest, w.Code)
+}
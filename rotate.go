@@ -0,0 +1,237 @@
+package main
+
+import (
+	"compress/gzip"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// rotatedTimeFormat is the timestamp rotated files are suffixed with
+const rotatedTimeFormat = "20060102T150405.000"
+
+// RotatingFile is a log file rotated once it grows over a maximum size or
+// at the start of every interval (e.g: daily). Rotated files are renamed
+// with a timestamp (e.g: access-20240102T030405.000.log), optionally gzipped,
+// and only the most recent backups are kept.
+type RotatingFile struct {
+	sync.Mutex
+
+	path       string
+	maxSize    int64
+	interval   time.Duration
+	maxBackups int
+	compress   bool
+
+	file   *os.File
+	size   int64
+	opened time.Time
+
+	wg          sync.WaitGroup
+	maintenance sync.Mutex
+
+	now func() time.Time
+}
+
+// OpenRotatingFile opens (or creates) the log file at path for appending.
+// A maxSize or interval of 0 disables rotation by size or time and a
+// maxBackups of 0 keeps all rotated files.
+func OpenRotatingFile(path string, maxSize int64, interval time.Duration, maxBackups int, compress bool) (*RotatingFile, error) {
+	f := &RotatingFile{
+		path:       path,
+		maxSize:    maxSize,
+		interval:   interval,
+		maxBackups: maxBackups,
+		compress:   compress,
+		now:        time.Now,
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, err
+	}
+	if err := f.open(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+func (f *RotatingFile) open() error {
+	file, err := os.OpenFile(f.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+
+	// An existing file is as old as its last write, so a file left over
+	// from a previous interval is rotated on the first write after restart
+	f.file, f.size, f.opened = file, info.Size(), f.now()
+	if info.Size() > 0 {
+		f.opened = info.ModTime()
+	}
+	return nil
+}
+
+// due reports whether the file must be rotated before writing n bytes
+func (f *RotatingFile) due(n int) bool {
+	if f.size == 0 {
+		return false
+	}
+	if f.maxSize > 0 && f.size+int64(n) > f.maxSize {
+		return true
+	}
+	if f.interval > 0 && !f.now().Truncate(f.interval).Equal(f.opened.Truncate(f.interval)) {
+		return true
+	}
+	return false
+}
+
+// Write writes p to the file, rotating it first if it is due
+func (f *RotatingFile) Write(p []byte) (int, error) {
+	f.Lock()
+	defer f.Unlock()
+
+	if f.due(len(p)) {
+		if err := f.rotate(); err != nil {
+			return 0, err
+		}
+	}
+	n, err := f.file.Write(p)
+	f.size += int64(n)
+	return n, err
+}
+
+// Rotate rotates the file now
+func (f *RotatingFile) Rotate() error {
+	f.Lock()
+	defer f.Unlock()
+
+	return f.rotate()
+}
+
+// backupName returns the name of the file rotated at t
+func (f *RotatingFile) backupName(t time.Time) string {
+	ext := filepath.Ext(f.path)
+	return strings.TrimSuffix(f.path, ext) + "-" + t.UTC().Format(rotatedTimeFormat) + ext
+}
+
+func (f *RotatingFile) rotate() error {
+	if err := f.file.Close(); err != nil {
+		return err
+	}
+
+	backup := f.backupName(f.now())
+	if err := os.Rename(f.path, backup); err != nil {
+		return err
+	}
+	if err := f.open(); err != nil {
+		return err
+	}
+
+	f.wg.Add(1)
+	go func() {
+		defer f.wg.Done()
+
+		// One rotated file at a time, so pruning never races compression
+		f.maintenance.Lock()
+		defer f.maintenance.Unlock()
+
+		if f.compress {
+			if err := gzipFile(backup); err != nil {
+				slog.Error("error compressing rotated log", "file", backup, "err", err)
+			}
+		}
+		if err := f.prune(); err != nil {
+			slog.Error("error removing old rotated logs", "file", f.path, "err", err)
+		}
+	}()
+	return nil
+}
+
+// Backups returns the rotated files, oldest first
+func (f *RotatingFile) Backups() ([]string, error) {
+	ext := filepath.Ext(f.path)
+	matches, err := filepath.Glob(strings.TrimSuffix(f.path, ext) + "-*" + ext + "*")
+	if err != nil {
+		return nil, err
+	}
+	var backups []string
+	for _, match := range matches {
+		if !strings.HasSuffix(match, ".tmp") {
+			backups = append(backups, match)
+		}
+	}
+	// Timestamps sort in the order the files were rotated
+	sort.Strings(backups)
+	return backups, nil
+}
+
+// prune removes the oldest rotated files beyond the backups to keep
+func (f *RotatingFile) prune() error {
+	if f.maxBackups <= 0 {
+		return nil
+	}
+
+	backups, err := f.Backups()
+	if err != nil {
+		return err
+	}
+	for len(backups) > f.maxBackups {
+		if err := os.Remove(backups[0]); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		backups = backups[1:]
+	}
+	return nil
+}
+
+// gzipFile compresses a file to <name>.gz and removes it
+func gzipFile(name string) error {
+	src, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	tmp := name + ".gz.tmp"
+	dst, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	zw := gzip.NewWriter(dst)
+	if _, err := io.Copy(zw, src); err != nil {
+		dst.Close()
+		os.Remove(tmp)
+		return err
+	}
+	if err := zw.Close(); err != nil {
+		dst.Close()
+		os.Remove(tmp)
+		return err
+	}
+	if err := dst.Close(); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	if err := os.Rename(tmp, name+".gz"); err != nil {
+		return err
+	}
+	return os.Remove(name)
+}
+
+// Close waits for rotated files to be compressed and closes the file
+func (f *RotatingFile) Close() error {
+	f.wg.Wait()
+
+	f.Lock()
+	defer f.Unlock()
+
+	return f.file.Close()
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"compress/gzip"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRotatingFileBySize(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir("", "golinks")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "logs", "access.log")
+	f, err := OpenRotatingFile(path, 10, 0, 2, false)
+	assert.NoError(err)
+
+	now := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	f.now = func() time.Time {
+		now = now.Add(time.Second)
+		return now
+	}
+
+	for _, line := range []string{"first\n", "second\n", "third\n", "fourth\n"} {
+		_, err := f.Write([]byte(line))
+		assert.NoError(err)
+	}
+	assert.NoError(f.Close())
+
+	data, err := ioutil.ReadFile(path)
+	assert.NoError(err)
+	assert.Equal("fourth\n", string(data))
+
+	// Only the two most recent rotated files are kept
+	backups, err := f.Backups()
+	assert.NoError(err)
+	assert.Len(backups, 2)
+	assert.Equal(filepath.Join(dir, "logs", "access-20240102T030408.000.log"), backups[0])
+	data, err = ioutil.ReadFile(backups[0])
+	assert.NoError(err)
+	assert.Equal("second\n", string(data))
+	data, err = ioutil.ReadFile(backups[1])
+	assert.NoError(err)
+	assert.Equal("third\n", string(data))
+}
+
+func TestRotatingFileByTime(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir("", "golinks")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "access.log")
+	f, err := OpenRotatingFile(path, 0, 24*time.Hour, 0, true)
+	assert.NoError(err)
+
+	now := time.Date(2024, 1, 2, 23, 0, 0, 0, time.UTC)
+	f.now = func() time.Time { return now }
+	f.opened = now
+
+	_, err = f.Write([]byte("monday\n"))
+	assert.NoError(err)
+	now = now.Add(30 * time.Minute)
+	_, err = f.Write([]byte("still monday\n"))
+	assert.NoError(err)
+	now = now.Add(time.Hour)
+	_, err = f.Write([]byte("tuesday\n"))
+	assert.NoError(err)
+	assert.NoError(f.Close())
+
+	data, err := ioutil.ReadFile(path)
+	assert.NoError(err)
+	assert.Equal("tuesday\n", string(data))
+
+	// Rotated files are compressed
+	backups, err := f.Backups()
+	assert.NoError(err)
+	assert.Equal([]string{filepath.Join(dir, "access-20240103T003000.000.log.gz")}, backups)
+
+	gz, err := os.Open(backups[0])
+	assert.NoError(err)
+	defer gz.Close()
+	zr, err := gzip.NewReader(gz)
+	assert.NoError(err)
+	data, err = ioutil.ReadAll(zr)
+	assert.NoError(err)
+	assert.Equal("monday\nstill monday\n", string(data))
+}
+
+func TestAccessLogFile(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir("", "golinks")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	db, err = OpenStore(filepath.Join(dir, "test.db"))
+	assert.NoError(err)
+
+	path := filepath.Join(dir, "access.log")
+	s, err := NewServer(":8000", Config{AccessLog: path, LogFormat: LogFormatJSON})
+	assert.NoError(err)
+
+	r, _ := http.NewRequest("GET", "/help", nil)
+	s.server.Handler.ServeHTTP(httptest.NewRecorder(), r)
+	assert.NoError(s.accessLog.Close())
+	db.Close()
+
+	data, err := ioutil.ReadFile(path)
+	assert.NoError(err)
+	assert.Contains(string(data), `"msg":"request","method":"GET","path":"/help","status":200`)
+}
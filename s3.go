@@ -0,0 +1,310 @@
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	s3Algorithm   = "AWS4-HMAC-SHA256"
+	s3TimeFormat  = "20060102T150405Z"
+	s3DateFormat  = "20060102"
+	s3EmptySHA256 = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+)
+
+// S3Object ...
+type S3Object struct {
+	Key          string    `xml:"Key"`
+	LastModified time.Time `xml:"LastModified"`
+	Size         int64     `xml:"Size"`
+}
+
+// S3Client is a minimal client for S3 compatible object storage (AWS S3,
+// MinIO, Wasabi, ...) using path-style requests and AWS Signature V4.
+type S3Client struct {
+	Endpoint  string
+	Bucket    string
+	Region    string
+	AccessKey string
+	SecretKey string
+
+	client *http.Client
+}
+
+// NewS3Client ...
+func NewS3Client(endpoint, bucket, region, accessKey, secretKey string) *S3Client {
+	if region == "" {
+		region = "us-east-1"
+	}
+
+	return &S3Client{
+		Endpoint:  strings.TrimSuffix(endpoint, "/"),
+		Bucket:    bucket,
+		Region:    region,
+		AccessKey: accessKey,
+		SecretKey: secretKey,
+
+		client: &http.Client{Timeout: time.Minute},
+	}
+}
+
+// ParseS3URL parses a URL of the form s3://host[:port]/bucket[/prefix] into
+// an endpoint, bucket and prefix. The endpoint uses https unless the query
+// parameter insecure=true is given. The region can be given via region=...
+func ParseS3URL(s string) (endpoint, bucket, prefix, region string, err error) {
+	u, err := url.Parse(s)
+	if err != nil {
+		return
+	}
+	if u.Scheme != "s3" || u.Host == "" {
+		err = fmt.Errorf("invalid s3 url %q: expected s3://host/bucket[/prefix]", s)
+		return
+	}
+
+	parts := strings.SplitN(strings.TrimPrefix(u.Path, "/"), "/", 2)
+	if parts[0] == "" {
+		err = fmt.Errorf("invalid s3 url %q: missing bucket", s)
+		return
+	}
+	bucket = parts[0]
+	if len(parts) > 1 {
+		prefix = parts[1]
+	}
+
+	scheme := "https"
+	if u.Query().Get("insecure") == "true" {
+		scheme = "http"
+	}
+	endpoint = fmt.Sprintf("%s://%s", scheme, u.Host)
+	region = u.Query().Get("region")
+
+	return
+}
+
+func (c *S3Client) objectURL(key string) string {
+	return fmt.Sprintf("%s/%s/%s", c.Endpoint, c.Bucket, key)
+}
+
+func (c *S3Client) do(method, rawurl string, body []byte) (*http.Response, error) {
+	req, err := http.NewRequest(method, rawurl, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+
+	hash := s3EmptySHA256
+	if len(body) > 0 {
+		sum := sha256.Sum256(body)
+		hash = hex.EncodeToString(sum[:])
+	}
+
+	signV4(req, hash, c.AccessKey, c.SecretKey, c.Region, time.Now())
+
+	res, err := c.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		defer res.Body.Close()
+		msg, _ := ioutil.ReadAll(io.LimitReader(res.Body, 1024))
+		return nil, fmt.Errorf(
+			"s3 %s %s failed: %s: %s",
+			method, req.URL.Path, res.Status, bytes.TrimSpace(msg),
+		)
+	}
+
+	return res, nil
+}
+
+// Put uploads an object
+func (c *S3Client) Put(key string, data []byte) error {
+	res, err := c.do("PUT", c.objectURL(key), data)
+	if err != nil {
+		return err
+	}
+	res.Body.Close()
+	return nil
+}
+
+// Get downloads an object
+func (c *S3Client) Get(key string) ([]byte, error) {
+	res, err := c.do("GET", c.objectURL(key), nil)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	return ioutil.ReadAll(res.Body)
+}
+
+// Delete deletes an object
+func (c *S3Client) Delete(key string) error {
+	res, err := c.do("DELETE", c.objectURL(key), nil)
+	if err != nil {
+		return err
+	}
+	res.Body.Close()
+	return nil
+}
+
+// List lists all objects with the given prefix sorted by key
+func (c *S3Client) List(prefix string) ([]S3Object, error) {
+	var (
+		objects []S3Object
+		token   string
+	)
+
+	for {
+		q := url.Values{}
+		q.Set("list-type", "2")
+		q.Set("prefix", prefix)
+		if token != "" {
+			q.Set("continuation-token", token)
+		}
+
+		rawurl := fmt.Sprintf("%s/%s?%s", c.Endpoint, c.Bucket, q.Encode())
+		res, err := c.do("GET", rawurl, nil)
+		if err != nil {
+			return nil, err
+		}
+
+		var result struct {
+			Contents              []S3Object `xml:"Contents"`
+			IsTruncated           bool       `xml:"IsTruncated"`
+			NextContinuationToken string     `xml:"NextContinuationToken"`
+		}
+		err = xml.NewDecoder(res.Body).Decode(&result)
+		res.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+
+		objects = append(objects, result.Contents...)
+
+		if !result.IsTruncated || result.NextContinuationToken == "" {
+			break
+		}
+		token = result.NextContinuationToken
+	}
+
+	sort.Slice(objects, func(i, j int) bool {
+		return objects[i].Key < objects[j].Key
+	})
+
+	return objects, nil
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+// s3Escape escapes a string as per the AWS Signature V4 URI encoding rules
+func s3Escape(s string, encodeSlash bool) string {
+	var buf strings.Builder
+	for _, b := range []byte(s) {
+		switch {
+		case b >= 'A' && b <= 'Z', b >= 'a' && b <= 'z', b >= '0' && b <= '9',
+			b == '-', b == '_', b == '.', b == '~':
+			buf.WriteByte(b)
+		case b == '/' && !encodeSlash:
+			buf.WriteByte(b)
+		default:
+			fmt.Fprintf(&buf, "%%%02X", b)
+		}
+	}
+	return buf.String()
+}
+
+// signV4 signs the request with AWS Signature Version 4. All x-amz-* headers
+// as well as the Host, Content-Type, Content-MD5 and Range headers are
+// included in the signature.
+func signV4(req *http.Request, payloadHash, accessKey, secretKey, region string, t time.Time) {
+	t = t.UTC()
+	amzdate := t.Format(s3TimeFormat)
+	date := t.Format(s3DateFormat)
+
+	req.Header.Set("X-Amz-Date", amzdate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	headers := map[string]string{"host": req.URL.Host}
+	for name, values := range req.Header {
+		name = strings.ToLower(name)
+		switch {
+		case strings.HasPrefix(name, "x-amz-"),
+			name == "content-type", name == "content-md5", name == "range":
+			headers[name] = strings.TrimSpace(strings.Join(values, ","))
+		}
+	}
+
+	var names []string
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	query := req.URL.Query()
+	var keys []string
+	for key := range query {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var params []string
+	for _, key := range keys {
+		for _, val := range query[key] {
+			params = append(params, s3Escape(key, true)+"="+s3Escape(val, true))
+		}
+	}
+
+	path := req.URL.Path
+	if path == "" {
+		path = "/"
+	}
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		s3Escape(path, false),
+		strings.Join(params, "&"),
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	scope := strings.Join([]string{date, region, "s3", "aws4_request"}, "/")
+	sum := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := strings.Join([]string{
+		s3Algorithm,
+		amzdate,
+		scope,
+		hex.EncodeToString(sum[:]),
+	}, "\n")
+
+	key := hmacSHA256([]byte("AWS4"+secretKey), date)
+	key = hmacSHA256(key, region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf(
+		"%s Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		s3Algorithm, accessKey, scope, signedHeaders, signature,
+	))
+}
@@ -0,0 +1,324 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"text/template"
+	"text/template/parse"
+	"time"
+)
+
+const (
+	// DefaultTemplateTimeout is how long a user template may run for
+	DefaultTemplateTimeout = 100 * time.Millisecond
+
+	// MaxTemplateBytes is the maximum size of a user template
+	MaxTemplateBytes = 4 << 10
+
+	// MaxTemplateOutputBytes is the maximum size of a user template's output
+	MaxTemplateOutputBytes = 8 << 10
+
+	// MaxTemplateRangeDepth is how deeply range actions may be nested
+	MaxTemplateRangeDepth = 2
+
+	// MaxTemplateRangeItems is how many items range actions may range over
+	MaxTemplateRangeItems = 256
+
+	// MaxTemplateValueBytes is the maximum size of what any function of a
+	// user template returns, so intermediate values are limited too
+	MaxTemplateValueBytes = MaxTemplateOutputBytes
+
+	// MaxTemplateQueryBytes is the maximum size of the query a user
+	// template is rendered for
+	MaxTemplateQueryBytes = 1 << 10
+
+	// MaxTemplateFormatWidth is the widest printf widths and precisions
+	// may be
+	MaxTemplateFormatWidth = 64
+)
+
+var (
+	// ErrTemplateTimeout is returned by user templates that run for too long
+	ErrTemplateTimeout = errors.New("template took too long")
+
+	// ErrTemplateOutputTooLarge is returned by user templates whose output
+	// is too large
+	ErrTemplateOutputTooLarge = errors.New("template output is too large")
+
+	// ErrTemplateValueTooLarge is returned by user templates building
+	// values that are too large
+	ErrTemplateValueTooLarge = errors.New("template value is too large")
+
+	// ErrTemplateQueryTooLarge is returned for queries too large to render
+	// user templates for
+	ErrTemplateQueryTooLarge = errors.New("query is too large for templates")
+)
+
+// UserTemplateData is all a user template can see: the query it is
+// rendered for and nothing about the server
+type UserTemplateData struct {
+	Name  string
+	Query string
+	Args  []string
+}
+
+// rangeFunc is appended to the pipeline of every range action (see
+// checkUserTemplate) to check what is ranged over
+const rangeFunc = "_range"
+
+// rangeItems only lets range actions range over short lists of strings
+// (e.g: .Args), not over integers, maps or funcs: execution can't be
+// cancelled, so {{ range 1000000000000 }}{{ end }} would run until it ends
+// even after the timeout.
+func rangeItems(v interface{}) ([]string, error) {
+	items, ok := v.([]string)
+	if !ok {
+		return nil, fmt.Errorf("can only range over lists, not %T", v)
+	}
+	if len(items) > MaxTemplateRangeItems {
+		return nil, fmt.Errorf("can only range over at most %d items", MaxTemplateRangeItems)
+	}
+	return items, nil
+}
+
+// limitValue returns s if it isn't larger than MaxTemplateValueBytes.
+// Functions growing their arguments at most a few times can build their
+// result first, as their arguments are limited too.
+func limitValue(s string) (string, error) {
+	if len(s) > MaxTemplateValueBytes {
+		return "", ErrTemplateValueTooLarge
+	}
+	return s, nil
+}
+
+// limited returns f with its result limited by limitValue
+func limited(f func(string) string) func(string) (string, error) {
+	return func(s string) (string, error) {
+		return limitValue(f(s))
+	}
+}
+
+// replaceValue replaces every old in s with new, checking the size of the
+// result before building it
+func replaceValue(s, old, new string) (string, error) {
+	if old == "" {
+		return "", errors.New("replace needs a string to replace")
+	}
+	if len(s)+strings.Count(s, old)*(len(new)-len(old)) > MaxTemplateValueBytes {
+		return "", ErrTemplateValueTooLarge
+	}
+	return strings.Replace(s, old, new, -1), nil
+}
+
+// joinValue joins s with sep, checking the size of the result before
+// building it
+func joinValue(sep string, s []string) (string, error) {
+	n := len(sep) * (len(s) - 1)
+	for _, v := range s {
+		n += len(v)
+	}
+	if n > MaxTemplateValueBytes {
+		return "", ErrTemplateValueTooLarge
+	}
+	return strings.Join(s, sep), nil
+}
+
+// checkFormat rejects printf formats with widths or precisions larger than
+// MaxTemplateFormatWidth (or taken from arguments), which would pad values
+// to any size
+func checkFormat(format string) error {
+	for i := 0; i < len(format); i++ {
+		if format[i] != '%' {
+			continue
+		}
+		n := 0
+		for i++; i < len(format) && strings.IndexByte("+-# 0123456789.*[]", format[i]) >= 0; i++ {
+			switch c := format[i]; {
+			case c == '*':
+				return errors.New("printf widths may not be arguments")
+			case c >= '0' && c <= '9':
+				n = n*10 + int(c-'0')
+				if n > MaxTemplateFormatWidth {
+					return fmt.Errorf("printf widths may be at most %d", MaxTemplateFormatWidth)
+				}
+			default:
+				n = 0
+			}
+		}
+	}
+	return nil
+}
+
+// userTemplateFuncs are the only functions available to user templates.
+// Builtins that could reach outside the data (call) are overridden, as are
+// those building strings (printf, html, ...) so their results are limited.
+var userTemplateFuncs = template.FuncMap{
+	"call": func(...interface{}) (string, error) {
+		return "", errors.New("call is not allowed")
+	},
+	"print": func(args ...interface{}) (string, error) {
+		return limitValue(fmt.Sprint(args...))
+	},
+	"println": func(args ...interface{}) (string, error) {
+		return limitValue(fmt.Sprintln(args...))
+	},
+	"printf": func(format string, args ...interface{}) (string, error) {
+		if err := checkFormat(format); err != nil {
+			return "", err
+		}
+		return limitValue(fmt.Sprintf(format, args...))
+	},
+	"html": func(args ...interface{}) (string, error) {
+		return limitValue(template.HTMLEscaper(args...))
+	},
+	"js": func(args ...interface{}) (string, error) {
+		return limitValue(template.JSEscaper(args...))
+	},
+	"urlquery": func(args ...interface{}) (string, error) {
+		return limitValue(template.URLQueryEscaper(args...))
+	},
+	rangeFunc:     rangeItems,
+	"lower":       limited(strings.ToLower),
+	"upper":       limited(strings.ToUpper),
+	"trim":        strings.TrimSpace,
+	"replace":     replaceValue,
+	"join":        joinValue,
+	"split":       func(sep, s string) []string { return strings.Split(s, sep) },
+	"pathescape":  limited(url.PathEscape),
+	"queryescape": limited(url.QueryEscape),
+	"default": func(def, s string) string {
+		if s == "" {
+			return def
+		}
+		return s
+	},
+}
+
+// UserTemplate is a template defined by users (e.g: stored in the database)
+// executed in a sandbox: only a restricted set of functions is available,
+// it may not define or invoke other templates, range actions may only range
+// over MaxTemplateRangeItems strings and be nested MaxTemplateRangeDepth
+// deep, and its query, the values it builds, its output and how long it
+// runs for are all limited.
+type UserTemplate struct {
+	tmpl    *template.Template
+	timeout time.Duration
+}
+
+// checkUserTemplate walks the parse tree rejecting what could run unbounded
+// and bounding what range actions range over (see rangeItems)
+func checkUserTemplate(node parse.Node, depth int) error {
+	switch n := node.(type) {
+	case *parse.ListNode:
+		if n == nil {
+			return nil
+		}
+		for _, child := range n.Nodes {
+			if err := checkUserTemplate(child, depth); err != nil {
+				return err
+			}
+		}
+	case *parse.TemplateNode:
+		return fmt.Errorf("template actions are not allowed")
+	case *parse.RangeNode:
+		if depth >= MaxTemplateRangeDepth {
+			return fmt.Errorf("range actions may only be nested %d deep", MaxTemplateRangeDepth)
+		}
+		n.Pipe.Cmds = append(n.Pipe.Cmds, &parse.CommandNode{
+			NodeType: parse.NodeCommand,
+			Pos:      n.Pipe.Pos,
+			Args:     []parse.Node{parse.NewIdentifier(rangeFunc).SetPos(n.Pipe.Pos)},
+		})
+		if err := checkUserTemplate(n.List, depth+1); err != nil {
+			return err
+		}
+		return checkUserTemplate(n.ElseList, depth)
+	case *parse.IfNode:
+		if err := checkUserTemplate(n.List, depth); err != nil {
+			return err
+		}
+		return checkUserTemplate(n.ElseList, depth)
+	case *parse.WithNode:
+		if err := checkUserTemplate(n.List, depth); err != nil {
+			return err
+		}
+		return checkUserTemplate(n.ElseList, depth)
+	}
+	return nil
+}
+
+// ParseUserTemplate parses and checks a user template. A timeout of zero
+// uses DefaultTemplateTimeout.
+func ParseUserTemplate(name, text string, timeout time.Duration) (*UserTemplate, error) {
+	if len(text) > MaxTemplateBytes {
+		return nil, fmt.Errorf("template is too large (at most %d bytes)", MaxTemplateBytes)
+	}
+	if timeout <= 0 {
+		timeout = DefaultTemplateTimeout
+	}
+
+	tmpl, err := template.New(name).Funcs(userTemplateFuncs).Option("missingkey=error").Parse(text)
+	if err != nil {
+		return nil, err
+	}
+	if len(tmpl.Templates()) > 1 {
+		return nil, fmt.Errorf("defining templates is not allowed")
+	}
+	if err := checkUserTemplate(tmpl.Tree.Root, 0); err != nil {
+		return nil, err
+	}
+
+	return &UserTemplate{tmpl: tmpl, timeout: timeout}, nil
+}
+
+// limitedBuffer fails writes once it is full or its deadline has passed,
+// which aborts the template writing to it
+type limitedBuffer struct {
+	bytes.Buffer
+	deadline time.Time
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	if time.Now().After(b.deadline) {
+		return 0, ErrTemplateTimeout
+	}
+	if b.Len()+len(p) > MaxTemplateOutputBytes {
+		return 0, ErrTemplateOutputTooLarge
+	}
+	return b.Buffer.Write(p)
+}
+
+// Execute renders the template with data, whose query (and args) may be
+// at most MaxTemplateQueryBytes
+func (t *UserTemplate) Execute(data UserTemplateData) (string, error) {
+	n := 0
+	for _, arg := range data.Args {
+		n += len(arg)
+	}
+	if len(data.Query) > MaxTemplateQueryBytes || n > MaxTemplateQueryBytes {
+		return "", ErrTemplateQueryTooLarge
+	}
+
+	buf := &limitedBuffer{deadline: time.Now().Add(t.timeout)}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- t.tmpl.Execute(buf, data)
+	}()
+
+	timer := time.NewTimer(t.timeout)
+	defer timer.Stop()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			return "", err
+		}
+		return buf.String(), nil
+	case <-timer.C:
+		return "", ErrTemplateTimeout
+	}
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUserTemplate(t *testing.T) {
+	assert := assert.New(t)
+
+	data := UserTemplateData{Name: "jira", Query: "jira GL 1", Args: []string{"GL", "1"}}
+
+	tmpl, err := ParseUserTemplate(
+		"jira",
+		`https://jira.example.com/browse/{{ join "-" .Args | upper }}?q={{ queryescape .Query }}`,
+		0,
+	)
+	assert.NoError(err)
+	out, err := tmpl.Execute(data)
+	assert.NoError(err)
+	assert.Equal("https://jira.example.com/browse/GL-1?q=jira+GL+1", out)
+
+	tmpl, err = ParseUserTemplate("default", `{{ default "none" (index .Args 5 | printf "%s") }}`, 0)
+	assert.NoError(err)
+	_, err = tmpl.Execute(data)
+	assert.Error(err)
+
+	for _, text := range []string{
+		`{{ define "x" }}x{{ end }}`,
+		`{{ template "jira" . }}`,
+		`{{ range .Args }}{{ range $.Args }}{{ range $.Args }}{{ end }}{{ end }}{{ end }}`,
+		`{{ env "HOME" }}`,
+		`{{ .Server }}`,
+		strings.Repeat("x", MaxTemplateBytes+1),
+	} {
+		tmpl, err = ParseUserTemplate("bad", text, 0)
+		if err == nil {
+			_, err = tmpl.Execute(data)
+		}
+		assert.Error(err, text)
+	}
+
+	// call can't reach outside the data
+	tmpl, err = ParseUserTemplate("call", `{{ call .Name }}`, 0)
+	assert.NoError(err)
+	_, err = tmpl.Execute(data)
+	assert.Error(err)
+
+	// Output is limited
+	many := UserTemplateData{Args: strings.Split(strings.Repeat("x ", 200), " ")}
+	tmpl, err = ParseUserTemplate("big", `{{ range .Args }}{{ range $.Args }}{{ . }}{{ . }}{{ end }}{{ end }}`, 0)
+	assert.NoError(err)
+	_, err = tmpl.Execute(many)
+	assert.Equal(ErrTemplateOutputTooLarge, err)
+
+	// Range actions can't range over what would run for longer than the
+	// timeout, which can't stop them
+	for _, text := range []string{
+		`{{ range 1000000000000 }}{{ end }}`,
+		`{{ $n := 1000000000000 }}{{ range $n }}{{ end }}`,
+		`{{ range $i, $a := 1000000000000 }}{{ end }}`,
+	} {
+		tmpl, err = ParseUserTemplate("range", text, 0)
+		assert.NoError(err)
+		_, err = tmpl.Execute(data)
+		assert.Error(err, text)
+	}
+	tmpl, err = ParseUserTemplate("range", `{{ range $i, $a := .Args }}{{ $i }}{{ $a }}{{ end }}`, 0)
+	assert.NoError(err)
+	out, err = tmpl.Execute(data)
+	assert.NoError(err)
+	assert.Equal("0GL11", out)
+	_, err = tmpl.Execute(UserTemplateData{Args: make([]string, MaxTemplateRangeItems+1)})
+	assert.Error(err)
+
+	// So are the values templates build, not only their output
+	long := UserTemplateData{Query: strings.Repeat("x", 60)}
+	for _, text := range []string{
+		`{{ $a := replace .Query "" .Query }}{{ $b := replace $a "" $a }}{{ len $b }}`,
+		`{{ $a := replace .Query "x" .Query }}{{ $b := replace $a "x" $a }}{{ len $b }}`,
+		`{{ $a := printf "%s%s%s%s" .Query .Query .Query .Query }}{{ $b := printf "%s%s%s%s" $a $a $a $a }}{{ $c := printf "%s%s%s%s" $b $b $b $b }}{{ len (printf "%s%s%s%s" $c $c $c $c) }}`,
+		`{{ len (printf "%0100000000d" 1) }}`,
+		`{{ len (printf "%.*d" 100000000 1) }}`,
+		`{{ $a := replace .Query "x" "&&&&&&&&&&" }}{{ $b := html $a }}{{ $c := replace $b "&" $b }}{{ len $c }}`,
+	} {
+		tmpl, err = ParseUserTemplate("grow", text, 0)
+		assert.NoError(err)
+		_, err = tmpl.Execute(long)
+		assert.Error(err, text)
+	}
+	tmpl, err = ParseUserTemplate("printf", `{{ printf "%03d-%s" 7 (replace .Query "x" "y") }}`, 0)
+	assert.NoError(err)
+	out, err = tmpl.Execute(UserTemplateData{Query: "xx"})
+	assert.NoError(err)
+	assert.Equal("007-yy", out)
+
+	// and so are queries
+	_, err = tmpl.Execute(UserTemplateData{Query: strings.Repeat("x", MaxTemplateQueryBytes+1)})
+	assert.Equal(ErrTemplateQueryTooLarge, err)
+
+	// and so is how long templates run for
+	tmpl, err = ParseUserTemplate("slow", `{{ range .Args }}{{ range $.Args }}{{ end }}{{ end }}x`, time.Nanosecond)
+	assert.NoError(err)
+	_, err = tmpl.Execute(many)
+	assert.Equal(ErrTemplateTimeout, err)
+}
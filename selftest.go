@@ -0,0 +1,72 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"time"
+)
+
+// DefaultSelfTestSamples is the number of bookmarks resolved by the startup
+// self-test
+const DefaultSelfTestSamples = 3
+
+// SelfTestResult summarizes the startup self-test
+type SelfTestResult struct {
+	Bookmarks int
+	Resolved  int
+	Templates int
+	Took      time.Duration
+}
+
+func (r SelfTestResult) String() string {
+	return fmt.Sprintf(
+		"%d bookmarks loaded, %d resolved, %d templates rendered in %s",
+		r.Bookmarks, r.Resolved, r.Templates, r.Took,
+	)
+}
+
+// SelfTest checks the instance can serve requests before it starts
+// listening so that broken deploys fail fast instead of on the first user
+// request. It reads every bookmark (warming the store's caches), resolves up
+// to samples of them (spread across the list) like a query would and renders
+// every page's template with representative data.
+func (s *Server) SelfTest(samples int) (result SelfTestResult, err error) {
+	start := time.Now()
+	defer func() { result.Took = time.Since(start) }()
+
+	bookmarks, err := ListBookmarks()
+	if err != nil {
+		return result, fmt.Errorf("error loading bookmarks: %s", err)
+	}
+	result.Bookmarks = len(bookmarks)
+
+	var sample []Bookmark
+	if samples > len(bookmarks) {
+		samples = len(bookmarks)
+	}
+	for i := 0; i < samples; i++ {
+		sample = append(sample, bookmarks[i*len(bookmarks)/samples])
+	}
+
+	for _, bookmark := range sample {
+		resolved, ok := LookupBookmark(bookmark.Name())
+		if !ok || resolved.URL() != bookmark.URL() {
+			return result, fmt.Errorf("error resolving bookmark %s", bookmark.Name())
+		}
+		u, err := url.Parse(resolved.Expand("golinks"))
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+			return result, fmt.Errorf("bookmark %s expands to an invalid url", bookmark.Name())
+		}
+		result.Resolved++
+	}
+
+	if LookupCommand("help") == nil {
+		return result, fmt.Errorf("builtin commands are not registered")
+	}
+
+	if result.Templates, err = s.renderPages(samplePages(sample)); err != nil {
+		return result, err
+	}
+
+	return result, nil
+}
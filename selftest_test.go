@@ -0,0 +1,50 @@
+package main
+
+import (
+	"html/template"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSelfTest(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir("", "golinks")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	db, err = OpenStore(filepath.Join(dir, "test.db"))
+	assert.NoError(err)
+	defer db.Close()
+
+	s, err := NewServer(":8000", Config{})
+	assert.NoError(err)
+
+	// An empty database still renders every page
+	result, err := s.SelfTest(DefaultSelfTestSamples)
+	assert.NoError(err)
+	assert.Equal(0, result.Bookmarks)
+	assert.Equal(len(Pages)+len(Widgets), result.Templates)
+
+	assert.NoError(EnsureDefaultBookmarks())
+	result, err = s.SelfTest(DefaultSelfTestSamples)
+	assert.NoError(err)
+	assert.True(result.Bookmarks > DefaultSelfTestSamples)
+	assert.Equal(DefaultSelfTestSamples, result.Resolved)
+
+	assert.NoError(db.Put([]byte("bookmark_zzz"), []byte("javascript:alert(1)")))
+	_, err = s.SelfTest(result.Bookmarks + 1)
+	assert.EqualError(err, "bookmark zzz expands to an invalid url")
+	assert.NoError(DeleteBookmark("zzz"))
+
+	// A template failing to render fails the self-test
+	broken := template.Must(template.New("list").Parse(`{{define "base"}}{{.Bookmarks.Missing}}{{end}}`))
+	s.templates.Add("list", broken)
+	_, err = s.SelfTest(DefaultSelfTestSamples)
+	assert.Error(err)
+	assert.Contains(err.Error(), "error rendering template list")
+}
@@ -2,31 +2,29 @@ package main
 
 import (
 	"context"
-	"encoding/json"
+	"crypto/tls"
+	"errors"
 	"fmt"
 	"html/template"
-	"io"
-	"log"
+	"log/slog"
+	"net"
 	"net/http"
 	"net/url"
 	"os"
 	"os/signal"
-	"sort"
 	"strings"
+	"sync"
 	"syscall"
 	"time"
 
-	// Logging
-	"github.com/unrolled/logger"
-
 	// Stats/Metrics
 	"github.com/rcrowley/go-metrics"
 	"github.com/rcrowley/go-metrics/exp"
 	"github.com/thoas/stats"
 
 	rice "github.com/GeertJohan/go.rice"
-	"github.com/NYTimes/gziphandler"
 	"github.com/julienschmidt/httprouter"
+	"google.golang.org/grpc"
 )
 
 var (
@@ -63,32 +61,209 @@ func (c *Counters) DecBy(name string, n int64) {
 	metrics.GetOrRegisterCounter(name, c.r).Dec(n)
 }
 
+func (c *Counters) Gauge(name string, n int64) {
+	metrics.GetOrRegisterGauge(name, c.r).Update(n)
+}
+
+func (c *Counters) Time(name string, d time.Duration) {
+	metrics.GetOrRegisterTimer(name, c.r).Update(d)
+}
+
 // Server ...
 type Server struct {
 	bind      string
 	config    Config
+	configMu  sync.RWMutex
 	templates *Templates
-	router    *httprouter.Router
-	server    *http.Server
+	assets    *rice.Box
+
+	dictionary *Dictionary
+	federation *Federation
+	catalog    *Catalog
+	webhooks   *Webhooks
+	eventBus   *EventBus
+	bots       []*Bot
+	broker     *Broker
+	router     *httprouter.Router
+	server     *http.Server
+	grpcServer *grpc.Server
+	instance   string
+
+	// Email Gateway
+	emailSenders []string
+	emailTokens  *SeenTokens
+
+	// Sessions of logged in users, and the users allowed with Basic auth
+	sessions *Sessions
+	creds    *Credentials
+
+	// OpenID Connect login
+	oidc *OIDC
+
+	// GitHub login of the members allowed to edit
+	github *GitHub
 
-	// Logger
-	logger *logger.Logger
+	// teams of each user in multi-user mode
+	teams map[string][]string
+
+	// lifecycle starts and stops all subsystems
+	lifecycle *Lifecycle
+
+	// documentMu serializes replacing the bookmarks document
+	documentMu sync.Mutex
+
+	// Health
+	fqdnChecker *FQDNChecker
+
+	// Background Fetches
+	fetchPool   *FetchPool
+	linkChecker *LinkChecker
+
+	// Store
+	writePolicy *WritePolicy
+	compactor   *Compactor
+	usage       *UsageRollup
+	backuper    *Backuper
+	replicator  *Replicator
+	defaults    *DefaultsLoader
+	gitSyncer   *GitSyncer
+
+	manifestFetcher *ManifestFetcher
+	raindrop        *RaindropSyncer
+	browserSync     *BrowserSyncer
+
+	// Access log
+	accessLog *RotatingFile
 
 	// Stats/Metrics
 	counters *Counters
+	requests *RequestMetrics
+	hits     *Hits
+	learner  *AliasLearner
 	stats    *stats.Stats
+	exporter *MetricsExporter
+
+	// Rate limiting
+	rateLimiter *RateLimiter
+
+	// ipFilter tells clients apart (see IPFilter.ClientIP)
+	ipFilter *IPFilter
 }
 
-func (s *Server) render(name string, w http.ResponseWriter, ctx interface{}) {
-	buf, err := s.templates.Exec(name, ctx)
+// render renders the page name with ctx. Pages are rendered in full before
+// anything is written, so a failing template answers with the error page
+// and a 500 rather than half a page with a 200.
+func (s *Server) render(name string, w http.ResponseWriter, r *http.Request, ctx interface{}) {
+	buf, err := s.templates.ExecWith(name, ctx, template.FuncMap{
+		"csrf":    func() string { return csrfToken(w, r) },
+		"notices": func() []string { return s.notices(r) },
+	})
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		s.counters.Inc("n_render_failed")
+		slog.Error("error rendering page", "template", name, "request_id", RequestID(r), "err", err)
+		writeErrorPage(w, r, s.templates, http.StatusInternalServerError)
+		return
 	}
 
-	if buf != nil {
-		_, err = buf.WriteTo(w)
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	// The client going away is all that can go wrong writing the page
+	buf.WriteTo(w)
+}
+
+// queryParam returns the first value of the parameter key of a raw query
+// (like url.Values.Get) without parsing the whole query into a map
+func queryParam(rawQuery, key string) string {
+	for rawQuery != "" {
+		var param string
+		param, rawQuery, _ = strings.Cut(rawQuery, "&")
+		if strings.Contains(param, ";") {
+			continue
+		}
+		k, v, _ := strings.Cut(param, "=")
+		if strings.ContainsAny(k, "%+") {
+			var err error
+			if k, err = url.QueryUnescape(k); err != nil {
+				continue
+			}
+		}
+		if k != key {
+			continue
+		}
+		if v, err := url.QueryUnescape(v); err == nil {
+			return v
+		}
+	}
+	return ""
+}
+
+// dispatch executes the command or bookmark cmd with the given args. If no
+// command or bookmark matches, the query q is redirected to the default URL.
+func (s *Server) dispatch(w http.ResponseWriter, r *http.Request, q, cmd string, args []string) {
+	query := cmd
+	if len(args) > 0 {
+		query = strings.Join(append([]string{cmd}, args...), " ")
+	}
+	query = strings.TrimSpace(query)
+	t0 := time.Now()
+	r = s.withNamespaces(r)
+
+	if command := LookupCommand(cmd); command != nil {
+		if !s.confirmCommand(w, r, command.Name(), query) {
+			return
+		}
+		s.counters.Inc(commandCounter(command.Name()))
+		s.recordHistory(RequestUser(r), query, command.Name(), "")
+		err := ErrReadOnly
+		if s.commandEnabled(command) {
+			err = command.Exec(w, withCommandContext(r), args)
+		}
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			status := http.StatusInternalServerError
+			switch err {
+			case ErrReadOnly, ErrNotMember:
+				status = http.StatusForbidden
+			case ErrNoUser:
+				status = http.StatusUnauthorized
+			}
+			http.Error(
+				w,
+				fmt.Sprintf(
+					"Error processing command %s: %s",
+					command.Name(), err,
+				),
+				status,
+			)
+		}
+		s.hits.Record(HitCommand, command.Name(), time.Since(t0))
+	} else if bookmark, ok := RequestNamespaces(r).Lookup(cmd); ok {
+		target := bookmark.Expand(strings.Join(args, " "))
+		s.recordHistory(RequestUser(r), query, bookmark.Name(), target)
+		s.publishRedirect(query, bookmark.Name(), target)
+		redirect(w, r, target)
+		s.hits.Record(HitBookmark, bookmark.Name(), time.Since(t0))
+	} else if bookmark, ok := s.resolvePeers(cmd); ok {
+		target := bookmark.Expand(strings.Join(args, " "))
+		s.recordHistory(RequestUser(r), query, bookmark.Name(), target)
+		s.publishRedirect(query, bookmark.Name(), target)
+		redirect(w, r, target)
+		s.hits.Record(HitPeer, bookmark.Name(), time.Since(t0))
+	} else {
+		if s.learner != nil {
+			s.learner.Miss(RequestNamespaces(r), cmd)
+		}
+		if url := s.settings().URL; url != "" {
+			if q != "" {
+				url = fmt.Sprintf(url, q)
+			}
+			s.recordHistory(RequestUser(r), query, "", url)
+			s.publishRedirect(query, "", url)
+			s.fallback(w, r, url)
+		} else {
+			http.Error(
+				w,
+				fmt.Sprintf("Invalid Command: %v", cmd),
+				http.StatusBadRequest,
+			)
 		}
 	}
 }
@@ -105,7 +280,7 @@ func (s *Server) IndexHandler() httprouter.Handle {
 		s.counters.Inc("n_index")
 
 		// Query ?q=
-		q = r.URL.Query().Get("q")
+		q = queryParam(r.URL.RawQuery, "q")
 
 		// Form name=q
 		if q == "" {
@@ -113,9 +288,11 @@ func (s *Server) IndexHandler() httprouter.Handle {
 		}
 
 		if q != "" {
-			tokens := strings.Split(q, " ")
-			if len(tokens) > 0 {
-				cmd, args = tokens[0], tokens[1:]
+			// Queries without arguments are tokenized without allocating
+			var rest string
+			var found bool
+			if cmd, rest, found = strings.Cut(q, " "); found {
+				args = strings.Split(rest, " ")
 			}
 		} else {
 			cmd = p.ByName("command")
@@ -123,39 +300,57 @@ func (s *Server) IndexHandler() httprouter.Handle {
 		}
 
 		if cmd == "" {
-			s.render("index", w, nil)
+			s.render("index", w, r, nil)
 		} else {
-			if command := LookupCommand(cmd); command != nil {
-				err := command.Exec(w, r, args)
-				if err != nil {
-					http.Error(
-						w,
-						fmt.Sprintf(
-							"Error processing command %s: %s",
-							command.Name(), err,
-						),
-						http.StatusInternalServerError,
-					)
-				}
-			} else if bookmark, ok := LookupBookmark(cmd); ok {
-				q := strings.Join(args, " ")
-				bookmark.Exec(w, r, q)
-			} else {
-				if s.config.URL != "" {
-					url := s.config.URL
-					if q != "" {
-						url = fmt.Sprintf(url, q)
-					}
-					http.Redirect(w, r, url, http.StatusFound)
-				} else {
-					http.Error(
-						w,
-						fmt.Sprintf("Invalid Command: %v", cmd),
-						http.StatusBadRequest,
-					)
-				}
+			s.dispatch(w, r, q, cmd, args)
+		}
+	}
+}
+
+// NotFoundHandler treats unknown paths as queries so that e.g: /gh/golang
+// typed directly into the address bar behaves like the query "gh golang".
+func (s *Server) NotFoundHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "GET" && r.Method != "HEAD" {
+			http.NotFound(w, r)
+			return
+		}
+
+		var tokens []string
+		for _, token := range strings.Split(r.URL.Path, "/") {
+			if token != "" {
+				tokens = append(tokens, token)
 			}
 		}
+
+		if len(tokens) == 0 {
+			http.NotFound(w, r)
+			return
+		}
+
+		s.counters.Inc("n_notfound")
+
+		// Prefer bookmarks named after folders, e.g: /work/jira => work/jira
+		r = s.withNamespaces(r)
+		cmd, args := tokens[0], tokens[1:]
+		for i := len(tokens); i > 1; i-- {
+			name := strings.Join(tokens[:i], "/")
+			if _, ok := RequestNamespaces(r).Lookup(name); ok {
+				cmd, args = name, tokens[i:]
+				break
+			}
+		}
+
+		q := strings.Join(tokens, " ")
+		s.dispatch(w, r, q, cmd, args)
+	})
+}
+
+// InstanceHandler ...
+func (s *Server) InstanceHandler() httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+		w.Header().Set(InstanceHeader, s.instance)
+		w.Write([]byte(s.instance))
 	}
 }
 
@@ -164,48 +359,69 @@ func (s *Server) HelpHandler() httprouter.Handle {
 	return func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
 		s.counters.Inc("n_help")
 
-		s.render("help", w, nil)
+		s.render("help", w, r, map[string]interface{}{
+			"Writable": !s.config.ReadOnly,
+		})
 	}
 }
 
-// ListHandler ...
+// ListHandler lists bookmarks and commands as HTML, JSON or CSV (see
+// negotiateFormat), e.g: /list?format=csv
 func (s *Server) ListHandler() httprouter.Handle {
 	return func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
 		s.counters.Inc("n_list")
 
-		var (
-			bk  []Bookmark
-			cmd []Command
-		)
-
-		prefix := []byte("bookmark_")
-		err := db.Scan(prefix, func(key []byte) error {
-			val, err := db.Get(key)
-			if err != nil {
-				return err
-			}
-			name := strings.TrimPrefix(string(key), "bookmark_")
-			bk = append(bk, Bookmark{name, string(val)})
-			return nil
-		})
+		w.Header().Set("Vary", "Accept")
+		format, err := negotiateFormat(r)
 		if err != nil {
-			log.Printf("error reading list of bookmarks: %s", err)
+			http.Error(w, "Bad Request: "+err.Error(), http.StatusBadRequest)
+			return
 		}
 
-		var names []string
-		for k := range commands {
-			names = append(names, k)
+		bk, err := ListBookmarks()
+		if err != nil {
+			slog.Error("error reading list of bookmarks", "err", err)
 		}
-		sort.Sort(sort.StringSlice(names))
-		for _, name := range names {
-			cmd = append(cmd, commands[name])
+		// Personal and team bookmarks are listed first, as they are
+		// looked up first
+		if scoped, err := RequestNamespaces(s.withNamespaces(r)).List(); err != nil {
+			slog.Error("error reading list of personal bookmarks", "err", err)
+		} else {
+			bk = append(scoped, bk...)
+		}
+
+		switch format {
+		case FormatJSON:
+			if bk == nil {
+				bk = []Bookmark{}
+			}
+			commands := []CommandInfo{}
+			for _, command := range s.enabledCommands() {
+				commands = append(commands, s.describeCommand(command))
+			}
+			WriteJSON(w, http.StatusOK, map[string]interface{}{
+				"bookmarks": bk,
+				"commands":  commands,
+			})
+			return
+		case FormatCSV:
+			var rows [][]string
+			for _, bookmark := range bk {
+				rows = append(rows, []string{"bookmark", bookmark.Name(), bookmark.URL(), ""})
+			}
+			for _, command := range s.enabledCommands() {
+				info := DescribeCommand(command)
+				rows = append(rows, []string{"command", info.Name, "", info.Signature})
+			}
+			writeCSV(w, []string{"type", "name", "url", "signature"}, rows)
+			return
 		}
 
 		data := map[string]interface{}{
 			"Bookmarks": bk,
-			"Commands":  cmd,
+			"Commands":  s.enabledCommands(),
 		}
-		s.render("list", w, data)
+		s.render("list", w, r, data)
 	}
 }
 
@@ -214,12 +430,18 @@ func (s *Server) OpenSearchHandler() httprouter.Handle {
 	return func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
 		s.counters.Inc("n_opensearch")
 
+		// Served over https natively or by a proxy
+		scheme := "http"
+		if s.server.TLSConfig != nil || secureRequest(r) {
+			scheme = "https"
+		}
+
 		w.Header().Set("Content-Type", "text/xml")
 		w.Write(
 			[]byte(fmt.Sprintf(
 				OpenSearchTemplate,
-				s.config.Title,
-				s.config.FQDN,
+				s.settings().Title,
+				scheme,
 				s.config.FQDN,
 			)),
 		)
@@ -231,150 +453,791 @@ func (s *Server) SuggestionsHandler() httprouter.Handle {
 	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
 		// Query ?q=
 		q := r.URL.Query().Get("q")
-		resp, err := client.Get(fmt.Sprintf(s.config.SuggestURL, url.QueryEscape(q)))
-		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
-			return
-		}
-		defer resp.Body.Close()
-		if resp.StatusCode > 200 {
-			http.Error(w, "request failed", resp.StatusCode)
+
+		if s.config.Offline || (s.settings().SuggestURL == "" && s.dictionary != nil) {
+			WriteJSON(w, http.StatusOK, describeSuggestions(OfflineSuggestions(q, s.dictionary)))
 			return
 		}
 
-		w.Header().Set("Content-Type", "application/json; charset=utf-8")
-		if _, err := io.Copy(w, resp.Body); err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+		suggestions, err := s.fetchSuggestions(q)
+		if err != nil {
+			if s.dictionary != nil {
+				slog.Warn("error retrieving suggestions (using dictionary)", "err", err)
+				s.counters.Inc("n_suggest_offline")
+				WriteJSON(w, http.StatusOK, describeSuggestions(OfflineSuggestions(q, s.dictionary)))
+				return
+			}
+
+			writeSuggestionsError(w, r, err)
 			return
 		}
+
+		WriteJSON(w, http.StatusOK, describeSuggestions(suggestions))
 	}
 }
 
+// writeSuggestionsError answers with the error retrieving suggestions from
+// upstream, or a generic one for any other error
+func writeSuggestionsError(w http.ResponseWriter, r *http.Request, err error) {
+	var e *UpstreamError
+	if !errors.As(err, &e) {
+		slog.Error("error retrieving suggestions", "err", err)
+		e = &UpstreamError{Message: "error retrieving suggestions"}
+	}
+	WriteAPIError(
+		w, r, http.StatusBadGateway, ErrCodeUpstream,
+		e.Message, e.Details,
+	)
+}
+
 // StatsHandler ...
 func (s *Server) StatsHandler() httprouter.Handle {
 	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
-		w.Header().Set("Content-Type", "application/json; charset=utf-8")
-		bs, err := json.Marshal(s.stats.Data())
+		WriteJSON(w, http.StatusOK, s.stats.Data())
+	}
+}
+
+// DBHandler ...
+func (s *Server) DBHandler() httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		stats, err := s.compactor.Stats()
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			WriteAPIError(
+				w, r, http.StatusInternalServerError, ErrCodeInternal,
+				"error reading database stats", err.Error(),
+			)
+			return
 		}
-		w.Write(bs)
+
+		WriteJSON(w, http.StatusOK, stats)
 	}
 }
 
-// Shutdown ...
+// Shutdown stops all subsystems, the HTTP server first and the store last
 func (s *Server) Shutdown(ctx context.Context) error {
-	if err := s.server.Shutdown(ctx); err != nil {
-		log.Printf("error shutting down server: %s", err)
-		return err
-	}
+	return s.lifecycle.Stop(ctx)
+}
+
+// Run starts all subsystems and serves until SIGINT or SIGTERM is received,
+// then shuts down
+func (s *Server) Run() error {
+	s.register()
 
-	if err := db.Close(); err != nil {
-		log.Printf("error closing store: %s", err)
+	if err := s.lifecycle.Start(); err != nil {
 		return err
 	}
 
-	return nil
+	sigch := make(chan os.Signal, 1)
+	signal.Notify(sigch, syscall.SIGINT, syscall.SIGTERM)
+	sig := <-sigch
+	slog.Info("received signal", "signal", sig.String())
+
+	slog.Info("shutting down")
+	return s.Shutdown(context.Background())
 }
 
-// Run ...
-func (s *Server) Run() (err error) {
-	idleConnsClosed := make(chan struct{})
-	go func() {
-		sigch := make(chan os.Signal, 1)
-		signal.Notify(sigch, syscall.SIGINT, syscall.SIGTERM)
-		sig := <-sigch
-		log.Printf("Received signal %s", sig)
+// ReplicateStore wraps the store so every write is replicated to the
+// standby of -replicate-to (if any) and starts replicating, before writes
+// made on startup (e.g: restores and imports) so they are replicated too
+func (s *Server) ReplicateStore() {
+	if s.replicator == nil {
+		return
+	}
+	db = NewReplicatingStore(db, s.replicator)
+	s.replicator.Start()
+}
 
-		log.Printf("Shutting down...")
+// register adds the hooks of all enabled subsystems to the lifecycle, in
+// the order they are started: what others depend on (e.g: the store) first
+// and the HTTP server last, so it is the first to stop
+func (s *Server) register() {
+	s.lifecycle.Append(Hook{
+		Name: "store",
+		Stop: func(ctx context.Context) error { return db.Close() },
+	})
 
-		// We received an interrupt signal, shut down.
-		if err = s.Shutdown(context.Background()); err != nil {
-			// Error from closing listeners, or context timeout:
-			log.Fatalf("Error shutting down HTTP server: %s", err)
+	if s.accessLog != nil {
+		s.lifecycle.Append(Hook{
+			Name: "access log",
+			Stop: func(ctx context.Context) error { return s.accessLog.Close() },
+		})
+	}
+
+	// Started by ReplicateStore
+	if s.replicator != nil {
+		s.lifecycle.Append(Hook{
+			Name: "replication",
+			Stop: func(ctx context.Context) error { s.replicator.Stop(); return nil },
+		})
+	}
+
+	db = NewEventsStore(db, s.publish)
+	if s.webhooks != nil {
+		s.lifecycle.Append(Hook{
+			Name:  "webhooks",
+			Start: func() error { s.webhooks.Start(); return nil },
+			Stop:  func(ctx context.Context) error { s.webhooks.Stop(); return nil },
+		})
+	}
+	if s.eventBus != nil {
+		s.lifecycle.Append(Hook{
+			Name:  "event bus",
+			Start: func() error { s.eventBus.Start(); return nil },
+			Stop:  func(ctx context.Context) error { s.eventBus.Stop(); return nil },
+		})
+	}
+	if s.exporter != nil {
+		interval := s.config.MetricsExportInterval
+		if interval <= 0 {
+			interval = DefaultMetricsExportInterval
 		}
-		close(idleConnsClosed)
-	}()
+		s.lifecycle.Append(Hook{
+			Name:  "metrics export",
+			Start: func() error { s.exporter.Start(interval); return nil },
+			Stop:  func(ctx context.Context) error { s.exporter.Stop(); return nil },
+		})
+	}
+
+	if s.config.FQDN != "" && s.config.FQDNCheckInterval > 0 && !s.config.Offline {
+		s.lifecycle.Go("fqdn check", func(ctx context.Context) {
+			s.fqdnChecker.Run(ctx, s.config.FQDNCheckInterval)
+		})
+	}
+
+	// Background fetches are never made in offline mode
+	if s.config.LinkCheckInterval > 0 && !s.config.Offline && !s.config.ReadOnly {
+		s.fetchPool = NewFetchPool(s.config.FetchConcurrency, s.config.FetchHostDelay, s.counters)
+		s.linkChecker = NewLinkChecker(s.fetchPool, s.config.LinkRotAfter, s.counters)
+		s.lifecycle.Append(Hook{
+			Name: "fetch pool",
+			Stop: func(ctx context.Context) error { s.fetchPool.Stop(); return nil },
+		})
+		s.lifecycle.Go("link check", func(ctx context.Context) {
+			s.linkChecker.Run(ctx, s.config.LinkCheckInterval)
+		})
+	}
+
+	if s.config.MergeInterval > 0 && !s.config.ReadOnly {
+		s.lifecycle.Go("compaction", func(ctx context.Context) {
+			s.compactor.Run(ctx, s.config.MergeInterval)
+		})
+	}
+
+	if s.config.RollupInterval > 0 && !s.config.ReadOnly && !s.config.DisableHistory {
+		s.lifecycle.Go("usage rollup", func(ctx context.Context) {
+			s.usage.Run(ctx, s.config.RollupInterval)
+		})
+	}
+
+	if s.backuper != nil && s.config.BackupInterval > 0 {
+		s.lifecycle.Go("backups", func(ctx context.Context) {
+			s.backuper.Run(ctx, s.config.BackupInterval)
+		})
+	}
+
+	if s.config.BookmarksFile != "" {
+		s.lifecycle.Go("bookmarks file sync", s.syncOnSIGHUP)
+	}
+
+	if s.defaults != nil && s.config.DefaultsInterval > 0 && !s.config.ReadOnly {
+		s.lifecycle.Go("defaults sync", func(ctx context.Context) {
+			s.defaults.Run(ctx, s.config.DefaultsInterval)
+		})
+	}
+
+	if s.manifestFetcher != nil && s.config.BookmarksInterval > 0 && !s.config.ReadOnly {
+		s.lifecycle.Go("bookmarks url sync", func(ctx context.Context) {
+			s.manifestFetcher.Run(ctx, s.config.BookmarksInterval)
+		})
+	}
 
-	if err = s.ListenAndServe(); err != http.ErrServerClosed {
-		// Error starting or closing listener:
-		log.Fatalf("HTTP server ListenAndServe: %s", err)
+	if s.raindrop != nil && s.config.RaindropInterval > 0 && !s.config.ReadOnly {
+		s.lifecycle.Go("raindrop sync", func(ctx context.Context) {
+			s.raindrop.Run(ctx, s.config.RaindropInterval)
+		})
 	}
 
-	<-idleConnsClosed
+	if s.browserSync != nil && s.config.BrowserSyncInterval > 0 && !s.config.ReadOnly {
+		s.lifecycle.Go("browser sync", func(ctx context.Context) {
+			s.browserSync.Run(ctx, s.config.BrowserSyncInterval)
+		})
+	}
 
-	return
+	if s.gitSyncer != nil {
+		s.lifecycle.Append(Hook{
+			Name: "git clone",
+			Stop: func(ctx context.Context) error { return s.gitSyncer.Close() },
+		})
+		if s.config.GitInterval > 0 && !s.config.ReadOnly {
+			s.lifecycle.Go("git sync", func(ctx context.Context) {
+				s.gitSyncer.Run(ctx, s.config.GitInterval)
+			})
+		}
+	}
+
+	for _, bot := range s.bots {
+		s.lifecycle.Go("bot "+bot.client.Name(), func(ctx context.Context) {
+			go func() {
+				<-ctx.Done()
+				bot.Stop()
+			}()
+			bot.Run()
+		})
+	}
+
+	if s.config.GRPCBind != "" {
+		s.lifecycle.Append(Hook{
+			Name:  "grpc",
+			Start: s.ListenGRPC,
+			Stop:  func(ctx context.Context) error { s.grpcServer.GracefulStop(); return nil },
+		})
+	}
+
+	s.lifecycle.Append(Hook{
+		Name:  "http",
+		Start: s.Listen,
+		Stop:  s.server.Shutdown,
+	})
+}
+
+// Listen listens on the bind address and serves HTTP (or HTTPS with a
+// certificate) in the background
+func (s *Server) Listen() error {
+	lis, err := net.Listen("tcp", s.server.Addr)
+	if err != nil {
+		return err
+	}
+
+	go func() {
+		var err error
+		if s.server.TLSConfig != nil {
+			// The certificate is already loaded into the TLS config
+			err = s.server.ServeTLS(lis, "", "")
+		} else {
+			err = s.server.Serve(lis)
+		}
+		if err != http.ErrServerClosed {
+			fatal("error serving HTTP", "err", err)
+		}
+	}()
+	return nil
+}
+
+// warnings returns any configuration warnings to be displayed
+func (s *Server) warnings() []string {
+	var warnings []string
+	if warning := s.fqdnChecker.Warning(); warning != "" {
+		warnings = append(warnings, warning)
+	}
+	return warnings
 }
 
-// ListenAndServe ...
-func (s *Server) ListenAndServe() error {
-	return s.server.ListenAndServe()
+func (s *Server) funcs() template.FuncMap {
+	return template.FuncMap{
+		"warnings": s.warnings,
+		"offline":  func() bool { return s.config.Offline },
+		"history":  func() bool { return !s.config.DisableHistory },
+		"linkrot":  func() bool { return s.config.LinkCheckInterval > 0 && !s.config.Offline },
+		"feedback": func() bool { return !s.config.ReadOnly },
+		"csrf":     func() string { return "" },
+		"notices":  func() []string { return nil },
+	}
+}
+
+// notices returns the notices for the user of the request, e.g: of the
+// aliases learned from their typos
+func (s *Server) notices(r *http.Request) []string {
+	if s.learner == nil {
+		return nil
+	}
+	var user string
+	if s.config.MultiUser {
+		if user = RequestUser(r); user == "" {
+			return nil
+		}
+	}
+	return s.learner.Notices(user)
 }
 
 func (s *Server) initRoutes() {
+	s.router.NotFound = s.rateLimitHandler(s.NotFoundHandler())
+
 	s.router.Handler("GET", "/debug/metrics", exp.ExpHandler(s.counters.r))
+	s.router.Handler("GET", "/metrics", s.PrometheusHandler())
 	s.router.GET("/debug/stats", s.StatsHandler())
+	s.router.GET("/debug/instance", s.InstanceHandler())
+	s.router.GET("/debug/db", s.DBHandler())
+	s.router.GET("/debug/resolve", s.requireScope(ScopeAdmin, s.DebugResolveHandler()))
 
-	s.router.GET("/", s.IndexHandler())
-	s.router.POST("/", s.IndexHandler())
+	s.router.GET("/", s.rateLimit(s.IndexHandler()))
+	s.router.HEAD("/", s.rateLimit(s.IndexHandler()))
+	s.router.POST("/", s.rateLimit(s.IndexHandler()))
 	s.router.GET("/help", s.HelpHandler())
 	s.router.GET("/list", s.ListHandler())
+	s.router.GET("/linkrot", s.LinkRotHandler())
+	s.router.GET("/audit", s.AuditHandler())
+	s.router.POST("/linkrot/archive", s.csrf(s.ArchiveLinkHandler()))
+	s.router.POST("/feedback", s.rateLimit(s.csrf(s.FeedbackHandler())))
+	if !s.config.DisableHistory {
+		s.router.GET("/history", s.HistoryHandler())
+		s.router.GET("/history/ws", s.HistoryFeedHandler())
+		s.router.POST("/history/save", s.csrf(s.SaveSearchHandler()))
+	}
+	s.router.GET("/events", s.EventsHandler())
 	s.router.GET("/opensearch.xml", s.OpenSearchHandler())
-	s.router.GET("/suggest", s.SuggestionsHandler())
+	s.router.GET("/suggest", s.rateLimit(s.SuggestionsHandler()))
+
+	s.router.POST("/replication", s.ReplicationHandler())
+	if s.config.EmailSecret != "" {
+		s.router.POST("/inbound/email", s.InboundEmailHandler())
+	}
+	if s.creds != nil {
+		s.router.GET("/auth/login", s.PasswordLoginHandler())
+		s.router.POST("/auth/login", s.csrf(s.PasswordLoginHandler()))
+	}
+	if s.oidc != nil {
+		s.router.GET("/auth/login", s.LoginHandler())
+		s.router.GET(OIDCCallbackPath, s.CallbackHandler())
+	}
+	if s.github != nil {
+		s.router.GET("/auth/login", s.GitHubLoginHandler())
+		s.router.GET(GitHubCallbackPath, s.GitHubCallbackHandler())
+	}
+	if s.creds != nil || s.oidc != nil || s.github != nil {
+		s.router.GET("/auth/logout", s.LogoutHandler())
+		s.router.POST("/auth/logout", s.csrf(s.LogoutHandler()))
+	}
+	s.router.GET("/widgets/search", s.WidgetSearchHandler())
+	s.router.GET("/widgets/top", s.WidgetTopHandler())
+
+	if s.config.PublishTag != "" {
+		s.router.GET("/links.rss", s.PublicFeedHandler())
+		s.router.GET("/outbox", s.PublicOutboxHandler())
+	}
+	// Always routed as it is exempt from authentication, so it isn't taken
+	// for a query (see NotFoundHandler)
+	s.router.GET(PublicBookmarksPath, s.PublicBookmarksHandler())
+
+	// Resolving a name is as open as redirecting to it (and used by peers)
+	s.router.GET("/api/v1/resolve", s.ResolveHandler())
+	s.router.GET("/api/v1/openapi.json", s.OpenAPIHandler())
+	s.router.GET("/api/v1/version", s.VersionHandler())
+	s.router.GET("/graphql/schema", s.GraphQLSchemaHandler())
+	s.router.GET("/graphql", s.requireScope(ScopeRead, s.GraphQLHandler()))
+	s.router.POST("/graphql", s.requireScope(ScopeRead, s.GraphQLHandler()))
+
+	s.router.GET("/api/v1/bookmarks", s.requireScope(ScopeRead, s.BookmarksHandler()))
+	s.router.GET("/api/v1/bookmarks.json", s.requireScope(ScopeRead, s.DocumentHandler("json")))
+	s.router.PUT("/api/v1/bookmarks.json", s.requireScope(ScopeWrite, s.UpdateDocumentHandler("json")))
+	s.router.GET("/api/v1/bookmarks.yaml", s.requireScope(ScopeRead, s.DocumentHandler("yaml")))
+	s.router.PUT("/api/v1/bookmarks.yaml", s.requireScope(ScopeWrite, s.UpdateDocumentHandler("yaml")))
+	s.router.POST("/api/v1/bookmarks", s.requireScope(ScopeWrite, s.CreateBookmarkHandler()))
+	s.router.POST("/api/v1/bookmarks/bulk", s.requireScope(ScopeWrite, s.BulkBookmarksHandler()))
+	s.router.GET("/api/v1/bookmarks/*name", s.requireScope(ScopeRead, s.GetBookmarkHandler()))
+	s.router.PUT("/api/v1/bookmarks/*name", s.requireScope(ScopeWrite, s.UpdateBookmarkHandler()))
+	s.router.DELETE("/api/v1/bookmarks/*name", s.requireScope(ScopeWrite, s.DeleteBookmarkHandler()))
+	s.router.GET("/api/v1/commands", s.requireScope(ScopeRead, s.CommandsHandler()))
+	s.router.GET("/api/v1/links", s.requireScope(ScopeRead, s.LinksHandler()))
+	s.router.POST("/api/v1/links/archive/*name", s.requireScope(ScopeWrite, s.ArchiveLinkAPIHandler()))
+	s.router.GET("/api/v1/usage", s.requireScope(ScopeRead, s.UsageHandler()))
+	s.router.GET("/api/v1/hits", s.requireScope(ScopeRead, s.HitsHandler()))
+	s.router.GET("/api/v1/feedback", s.requireScope(ScopeRead, s.FeedbackAPIHandler()))
+	s.router.DELETE("/api/v1/history", s.requireScope(ScopeWrite, s.ClearHistoryHandler()))
+	s.router.GET("/api/v1/history/trash", s.requireScope(ScopeAdmin, s.HistoryTrashHandler()))
+	s.router.POST("/api/v1/history/trash/restore", s.requireScope(ScopeAdmin, s.RestoreHistoryHandler()))
+	s.router.POST("/api/v1/import", s.requireScope(ScopeWrite, s.ImportHandler()))
+	s.router.GET("/api/v1/reading", s.requireScope(ScopeRead, s.ReadingHandler()))
+	s.router.POST("/api/v1/reading", s.requireScope(ScopeWrite, s.SaveReadingHandler()))
+	s.router.GET("/api/v1/admin/config", s.requireScope(ScopeAdmin, s.SettingsHandler()))
+	s.router.PATCH("/api/v1/admin/config", s.requireScope(ScopeAdmin, s.UpdateSettingsHandler()))
+	if s.config.MultiUser {
+		s.router.GET("/api/v1/admin/teams", s.requireScope(ScopeAdmin, s.TeamsHandler()))
+		s.router.PUT("/api/v1/admin/teams/:team/members/:user", s.requireScope(ScopeAdmin, s.AddTeamMemberHandler()))
+		s.router.DELETE("/api/v1/admin/teams/:team/members/:user", s.requireScope(ScopeAdmin, s.RemoveTeamMemberHandler()))
+	}
+	s.router.GET("/api/v1/tokens", s.requireScope(ScopeAdmin, s.TokensHandler()))
+	s.router.POST("/api/v1/tokens", s.requireScope(ScopeAdmin, s.CreateTokenHandler()))
+	s.router.DELETE("/api/v1/tokens/:id", s.requireScope(ScopeAdmin, s.RevokeTokenHandler()))
+	s.router.GET("/export/bookmarks.html", s.ExportBookmarksHandler())
+
+	s.router.GET("/favicon.ico", s.AssetsHandler("favicon.ico"))
+	s.router.GET("/apple-touch-icon.png", s.AssetsHandler("apple-touch-icon.png"))
+	s.router.GET("/apple-touch-icon-precomposed.png", s.AssetsHandler("apple-touch-icon.png"))
 }
 
 // NewServer ...
 func NewServer(bind string, config Config) (*Server, error) {
 	router := httprouter.New()
+	counters := NewCounters()
+	requests := NewRequestMetrics()
+	instance := NewInstanceID()
+
+	if config.HistoryTrashTTL <= 0 {
+		config.HistoryTrashTTL = DefaultHistoryTrashTTL
+	}
+
+	// Access log (a rotated file, separate from the application logs)
+	var (
+		accessLog    *RotatingFile
+		accessLogger *slog.Logger
+	)
+	if config.AccessLog != "" {
+		f, err := OpenRotatingFile(
+			config.AccessLog, config.AccessLogMaxSize, config.AccessLogRotate,
+			config.AccessLogMaxBackups, config.AccessLogCompress,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("error opening access log: %s", err)
+		}
+		format := config.LogFormat
+		if format == "" {
+			format = LogFormatText
+		}
+		if accessLogger, err = NewLogger(f, format, "info"); err != nil {
+			f.Close()
+			return nil, err
+		}
+		accessLog = f
+	}
+
+	templates := NewTemplates("base")
+
+	// Access control (HTTP Basic auth, OpenID Connect, GitHub or a trusted
+	// proxy) comes first, but within request ids and recovery so its errors
+	// are logged as others
+	var authed http.Handler = MethodOverride(router)
+	sessions := newSessions(config)
+	basicAuth := config.AuthFile != "" || config.AuthUser != "" || config.AuthPass != ""
+	var creds *Credentials
+	if basicAuth {
+		var err error
+		if creds, err = loadCredentials(config); err != nil {
+			return nil, err
+		}
+		authed = BasicAuth(authed, creds, sessions, config.ReplicationSecret, counters)
+	}
+	var oidc *OIDC
+	if config.OIDCIssuer != "" {
+		if basicAuth {
+			return nil, fmt.Errorf("-oidc-issuer can't be used with -auth-user or -auth-file")
+		}
+		if config.OIDCClientID == "" || config.OIDCClientSecret == "" {
+			return nil, fmt.Errorf("-oidc-client-id and -oidc-client-secret are required to log in with -oidc-issuer")
+		}
+		oidc = NewOIDC(
+			config.OIDCIssuer, config.OIDCClientID, config.OIDCClientSecret,
+			config.OIDCRedirectURL, ParseDomains(config.OIDCDomains), counters,
+		)
+		authed = oidc.Handler(authed, sessions, config.ReplicationSecret)
+	}
+	var github *GitHub
+	if config.GitHubClientID != "" {
+		if oidc != nil {
+			return nil, fmt.Errorf("-github-client-id can't be used with -oidc-issuer")
+		}
+		if config.GitHubClientSecret == "" {
+			return nil, fmt.Errorf("-github-client-secret is required to log in with -github-client-id")
+		}
+		orgs := ParseOrgs(config.GitHubOrgs)
+		if len(orgs) == 0 {
+			return nil, fmt.Errorf("-github-orgs is required to log in with -github-client-id")
+		}
+		github = NewGitHub(
+			config.GitHubClientID, config.GitHubClientSecret,
+			config.GitHubRedirectURL, orgs, counters,
+		)
+		authed = github.Handler(authed, sessions, config.ReplicationSecret)
+	}
+	if config.AuthHeader != "" {
+		if basicAuth || oidc != nil || github != nil {
+			return nil, fmt.Errorf("-auth-header can't be used with -auth-user, -auth-file, -oidc-issuer or -github-client-id")
+		}
+		proxies, err := ParseProxies(config.AuthProxies)
+		if err != nil {
+			return nil, err
+		}
+		authed = NewProxyAuth(config.AuthHeader, proxies, counters).Handler(authed, config.ReplicationSecret)
+	} else if config.AuthProxies != "" {
+		return nil, fmt.Errorf("-auth-proxies requires -auth-header")
+	}
+
+	// Clients outside the allowed networks are kept out before anything else
+	allow, err := ParseNetworks(config.AllowIPs)
+	if err != nil {
+		return nil, fmt.Errorf("-allow-ips: %s", err)
+	}
+	deny, err := ParseNetworks(config.DenyIPs)
+	if err != nil {
+		return nil, fmt.Errorf("-deny-ips: %s", err)
+	}
+	proxies, err := ParseNetworks(config.IPProxies)
+	if err != nil {
+		return nil, fmt.Errorf("-ip-proxies: %s", err)
+	}
+	ipFilter := NewIPFilter(allow, deny, proxies, counters)
+	if config.AllowIPs != "" || config.DenyIPs != "" {
+		authed = ipFilter.Handler(authed)
+	} else if config.IPProxies != "" && config.RateLimit <= 0 {
+		return nil, fmt.Errorf("-ip-proxies requires -allow-ips, -deny-ips or -rate-limit")
+	}
+
+	// Streams are neither compressed nor counted as in flight
+	streams := []string{"/events", "/history/ws"}
+	handler := GzipExcept(
+		RequestIDs(Recover(authed, counters, templates)),
+		streams...,
+	)
+	if config.MaxConcurrent > 0 {
+		handler = NewLoadShedder(config.MaxConcurrent, counters).Handler(handler, streams...)
+	}
+
+	var tlsConfig *tls.Config
+	if config.TLSCert != "" || config.TLSKey != "" {
+		if config.TLSCert == "" || config.TLSKey == "" {
+			return nil, fmt.Errorf("-tls-cert and -tls-key must be used together")
+		}
+		var err error
+		if tlsConfig, err = NewTLSConfig(config.TLSCert, config.TLSKey); err != nil {
+			return nil, err
+		}
+	}
+	scheme := "http"
+	if tlsConfig != nil {
+		scheme = "https"
+	}
 
 	server := &Server{
 		bind:      bind,
 		config:    config,
 		router:    router,
-		templates: NewTemplates("base"),
+		templates: templates,
+		instance:  instance,
+		sessions:  sessions,
+		creds:     creds,
+		oidc:      oidc,
+		github:    github,
+		lifecycle: NewLifecycle(counters),
+
+		// Health
+		fqdnChecker: NewFQDNChecker(config.FQDN, scheme, instance, counters),
+
+		// Store
+		writePolicy: NewWritePolicy(config.WriteFailureThreshold, config.WriteFailureBackoff, counters),
+		compactor:   NewCompactor(config.DBPath, counters),
+		usage:       NewUsageRollup(config.HistoryRetention, config.HistoryTrashTTL, counters),
 
 		server: &http.Server{
-			Addr: bind,
-			Handler: logger.New(logger.Options{
-				Prefix:               "golinks",
-				RemoteAddressHeaders: []string{"X-Forwarded-For"},
-			}).Handler(
-				gziphandler.GzipHandler(
-					router,
-				),
-			),
+			Addr:      bind,
+			Handler:   AccessLog(accessLogger, requests.Handler(handler)),
+			TLSConfig: tlsConfig,
 		},
 
-		// Logger
-		logger: logger.New(logger.Options{
-			Prefix:               "golinks",
-			RemoteAddressHeaders: []string{"X-Forwarded-For"},
-			OutputFlags:          log.LstdFlags,
-		}),
+		// Access log
+		accessLog: accessLog,
 
 		// Stats/Metrics
-		counters: NewCounters(),
+		counters: counters,
+		requests: requests,
 		stats:    stats.New(),
+
+		ipFilter: ipFilter,
 	}
 
 	// Templates
-	box := rice.MustFindBox("templates")
+	if err := server.loadTemplates(rice.MustFindBox("templates")); err != nil {
+		return nil, err
+	}
+
+	// Static Assets
+	server.assets = rice.MustFindBox("static")
+
+	// Usage of each bookmark and command (only persisted if writable). Hits
+	// have their own write policy so they don't mask failing history writes.
+	server.hits = NewHits(
+		!config.ReadOnly, config.MetricsTopN,
+		NewWritePolicy(config.WriteFailureThreshold, config.WriteFailureBackoff, counters),
+	)
+
+	// Misspellings of bookmarks typed often enough become aliases
+	if config.LearnAliases > 0 && !config.ReadOnly {
+		server.learner = NewAliasLearner(
+			config.LearnAliases,
+			NewWritePolicy(config.WriteFailureThreshold, config.WriteFailureBackoff, counters),
+			counters, server.publish,
+		)
+	}
+
+	// Offline Suggestions
+	if config.Dictionary != "" {
+		dictionary, err := LoadDictionary(config.Dictionary, server.assets)
+		if err != nil {
+			return nil, fmt.Errorf("error loading dictionary: %s", err)
+		}
+		server.dictionary = dictionary
+	}
+
+	if err := checkOffline(config); err != nil {
+		return nil, err
+	}
+
+	if err := checkFallback(config); err != nil {
+		return nil, err
+	}
+
+	if err := checkFrameAncestors(config); err != nil {
+		return nil, err
+	}
+
+	// Backups
+	backuper, err := NewBackuperFromConfig(config, counters)
+	if err != nil {
+		return nil, fmt.Errorf("error configuring backups: %s", err)
+	}
+	server.backuper = backuper
+
+	// Replication
+	if config.ReplicateTo != "" {
+		if config.ReplicationSecret == "" {
+			return nil, fmt.Errorf("-replicate-to requires -replication-secret")
+		}
+		server.replicator = NewReplicator(
+			config.ReplicateTo, config.ReplicationSecret, counters,
+		)
+	}
+
+	// Remote Defaults
+	if config.Defaults != "" {
+		server.defaults = NewDefaultsLoader(config.Defaults, counters)
+	}
+
+	// Federation
+	if len(config.Peers) > 0 {
+		timeout := config.PeerTimeout
+		if timeout <= 0 {
+			timeout = DefaultPeerTimeout
+		}
+		server.federation = NewFederation(config.Peers, timeout, counters)
+	}
+
+	// Events
+	server.broker = NewBroker(counters)
+	server.server.RegisterOnShutdown(server.broker.Close)
+
+	// Webhooks
+	if len(config.Webhooks) > 0 {
+		server.webhooks = NewWebhooks(config.Webhooks, config.WebhookSecret, config.WebhookHits, counters)
+	}
+
+	// Event Bus
+	if config.EventBus != "" {
+		u, err := ParseEventBusURL(config.EventBus)
+		if err != nil {
+			return nil, err
+		}
+		server.eventBus = NewEventBus(u, config.EventBusPrefix, counters)
+	}
+
+	// Metrics Export
+	if config.MetricsExport != "" {
+		u, err := ParseMetricsExportURL(config.MetricsExport)
+		if err != nil {
+			return nil, err
+		}
+		server.exporter = NewMetricsExporter(u, counters)
+	}
+
+	// Rate limiting
+	if config.RateLimit > 0 {
+		server.rateLimiter = NewRateLimiter(config.RateLimit, config.RateLimitBurst)
+	}
+
+	// Catalog
+	if config.Catalog != "" {
+		timeout := config.PeerTimeout
+		if timeout <= 0 {
+			timeout = DefaultPeerTimeout
+		}
+		ttl := config.CatalogTTL
+		if ttl <= 0 {
+			ttl = DefaultCatalogTTL
+		}
+		server.catalog = NewCatalog(config.Catalog, ttl, timeout, counters)
+	}
+
+	// Bookmarks Manifest
+	if err := checkManifestSources(config); err != nil {
+		return nil, err
+	}
+	if config.BookmarksURL != "" {
+		server.manifestFetcher = NewManifestFetcher(config.BookmarksURL, counters, server.syncManifest)
+	}
+
+	// Raindrop.io Sync
+	if config.RaindropToken != "" {
+		server.raindrop = NewRaindropSyncer(
+			NewRaindropClient(RaindropAPIURL, config.RaindropToken, config.RaindropCollection),
+			counters,
+		)
+	}
+
+	// Browser Sync
+	if config.XBrowserSyncID != "" {
+		if config.XBrowserSyncPassword == "" {
+			return nil, fmt.Errorf("-xbrowsersync-password is required to pull bookmarks from xbrowsersync")
+		}
+		server.browserSync = NewBrowserSyncer(
+			NewXBrowserSync(config.XBrowserSyncURL, config.XBrowserSyncID, config.XBrowserSyncPassword),
+			config.BrowserNamespace, counters,
+		)
+	}
 
-	indexTemplate := template.New("index")
-	template.Must(indexTemplate.Parse(box.MustString("index.html")))
-	template.Must(indexTemplate.Parse(box.MustString("base.html")))
+	// Read Later
+	service, err := NewReadLater(config)
+	if err != nil {
+		return nil, err
+	}
+	readLater = service
 
-	helpTemplate := template.New("help")
-	template.Must(helpTemplate.Parse(box.MustString("help.html")))
-	template.Must(helpTemplate.Parse(box.MustString("base.html")))
+	// Email Gateway
+	server.emailSenders, err = ParseEmailSenders(config.EmailSenders)
+	if err != nil {
+		return nil, err
+	}
+	server.emailTokens = NewSeenTokens()
 
-	listTemplate := template.New("list")
-	template.Must(listTemplate.Parse(box.MustString("list.html")))
-	template.Must(listTemplate.Parse(box.MustString("base.html")))
+	// Multi-user mode
+	if config.Teams != "" && !config.MultiUser {
+		return nil, fmt.Errorf("-teams requires -multi-user")
+	}
+	server.teams, err = ParseTeams(config.Teams)
+	if err != nil {
+		return nil, err
+	}
 
-	server.templates.Add("index", indexTemplate)
-	server.templates.Add("help", helpTemplate)
-	server.templates.Add("list", listTemplate)
+	// Bots
+	users, err := ParseBotUsers(config.BotUsers)
+	if err != nil {
+		return nil, err
+	}
+	if config.TelegramToken != "" {
+		server.bots = append(server.bots, NewBot(server, NewTelegram(TelegramAPIURL, config.TelegramToken), users))
+	}
+	if config.MatrixURL != "" {
+		if config.MatrixToken == "" {
+			return nil, fmt.Errorf("-matrix-token is required to answer messages on matrix")
+		}
+		server.bots = append(server.bots, NewBot(server, NewMatrix(config.MatrixURL, config.MatrixToken), users))
+	}
+
+	// Git Sync
+	if err := checkGitSync(config); err != nil {
+		return nil, err
+	}
+	if config.GitRepo != "" {
+		server.gitSyncer = NewGitSyncer(
+			config.GitRepo, config.GitBranch, config.GitPath, counters, server.syncManifest,
+		)
+	}
 
 	server.initRoutes()
 
@@ -2,8 +2,11 @@ package main
 
 import (
 	"errors"
+	"html/template"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
+	"path/filepath"
 	"strconv"
 	"strings"
 	"testing"
@@ -39,10 +42,11 @@ func TestRender(t *testing.T) {
 
 	w := httptest.NewRecorder()
 
-	s.render("index", w, nil)
+	s.render("index", w, httptest.NewRequest("GET", "/", nil), nil)
 
 	assert.Equal(w.Code, http.StatusOK)
 	assert.Contains(w.Body.String(), `name="q"`)
+	assert.Contains(w.Body.String(), `name="csrf"`)
 }
 
 func TestRenderError(t *testing.T) {
@@ -53,11 +57,35 @@ func TestRenderError(t *testing.T) {
 
 	w := httptest.NewRecorder()
 
-	s.render("asdf", w, nil)
+	s.render("asdf", w, nil, nil)
 
 	assert.Equal(w.Code, http.StatusInternalServerError)
 }
 
+func TestRenderPartialOutput(t *testing.T) {
+	assert := assert.New(t)
+
+	s, err := NewServer(":8000", Config{})
+	assert.NoError(err)
+
+	// A template failing halfway through writes none of its output
+	s.templates.Add("broken", template.Must(template.New("broken").Parse(
+		`{{define "base"}}<p>partial</p>{{index . 5}}{{end}}`,
+	)))
+
+	w := httptest.NewRecorder()
+	r, _ := http.NewRequest("GET", "/broken", nil)
+	RequestIDs(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.render("broken", w, r, []int{})
+	})).ServeHTTP(w, r)
+
+	assert.Equal(http.StatusInternalServerError, w.Code)
+	assert.Equal("text/html; charset=utf-8", w.Header().Get("Content-Type"))
+	assert.NotContains(w.Body.String(), "partial")
+	assert.Contains(w.Body.String(), "Something went wrong")
+	assert.Contains(w.Body.String(), w.Header().Get(RequestIDHeader))
+}
+
 func TestIndex(t *testing.T) {
 	assert := assert.New(t)
 
@@ -86,6 +114,14 @@ func TestOpenSearch(t *testing.T) {
 	s.OpenSearchHandler()(w, r, p)
 	assert.Equal(w.Code, http.StatusOK)
 	assert.Contains(w.Body.String(), "<OpenSearchDescription")
+	assert.Contains(w.Body.String(), `template="http://`)
+	assert.NotContains(w.Body.String(), `https://`)
+
+	w = httptest.NewRecorder()
+	r.Header.Set("X-Forwarded-Proto", "https")
+	s.OpenSearchHandler()(w, r, p)
+	assert.Contains(w.Body.String(), `template="https://`)
+	assert.NotContains(w.Body.String(), `template="http://`)
 }
 
 func TestCommand(t *testing.T) {
@@ -228,3 +264,173 @@ func TestCommandBookmark(t *testing.T) {
 		"https://www.google.com/search?q=foo bar&btnK",
 	)
 }
+
+func TestNotFoundQuery(t *testing.T) {
+	assert := assert.New(t)
+
+	db, _ = bitcask.Open("test.db")
+	defer db.Close()
+
+	err := EnsureDefaultBookmarks()
+	assert.Nil(err)
+
+	s, err := NewServer(":8000", Config{})
+	assert.NoError(err)
+
+	w := httptest.NewRecorder()
+	r, _ := http.NewRequest("GET", "/gh/golang", nil)
+
+	s.router.ServeHTTP(w, r)
+	assert.Equal(w.Code, http.StatusFound)
+	assert.Equal(
+		w.Header().Get("Location"),
+		"https://github.com/search?q=golang&ref=opensearch",
+	)
+}
+
+func TestNotFoundQueryDefaultURL(t *testing.T) {
+	assert := assert.New(t)
+
+	db, _ = bitcask.Open("test.db")
+	defer db.Close()
+
+	s, err := NewServer(":8000", Config{URL: DefaultURL})
+	assert.NoError(err)
+
+	w := httptest.NewRecorder()
+	r, _ := http.NewRequest("GET", "/asdf/foo", nil)
+
+	s.router.ServeHTTP(w, r)
+	assert.Equal(w.Code, http.StatusFound)
+	assert.Equal(
+		w.Header().Get("Location"),
+		"https://www.google.com/search?q=asdf foo&btnK",
+	)
+}
+
+func TestNotFoundMethod(t *testing.T) {
+	assert := assert.New(t)
+
+	s, err := NewServer(":8000", Config{})
+	assert.NoError(err)
+
+	w := httptest.NewRecorder()
+	r, _ := http.NewRequest("DELETE", "/gh/golang", nil)
+
+	s.router.ServeHTTP(w, r)
+	assert.Equal(w.Code, http.StatusNotFound)
+}
+
+func TestHeadBookmark(t *testing.T) {
+	assert := assert.New(t)
+
+	db, _ = bitcask.Open("test.db")
+	defer db.Close()
+
+	err := EnsureDefaultBookmarks()
+	assert.Nil(err)
+
+	s, err := NewServer(":8000", Config{})
+	assert.NoError(err)
+
+	w := httptest.NewRecorder()
+	r, _ := http.NewRequest("HEAD", "/?q=gh%20golang", nil)
+
+	s.router.ServeHTTP(w, r)
+	assert.Equal(w.Code, http.StatusFound)
+	assert.Equal(
+		w.Header().Get("Location"),
+		"https://github.com/search?q=golang&ref=opensearch",
+	)
+}
+
+func TestMethodOverrideHead(t *testing.T) {
+	assert := assert.New(t)
+
+	db, _ = bitcask.Open("test.db")
+	defer db.Close()
+
+	s, err := NewServer(":8000", Config{})
+	assert.NoError(err)
+
+	w := httptest.NewRecorder()
+	r, _ := http.NewRequest("POST", "/gh/golang", nil)
+	r.Header.Set(MethodOverrideHeader, "HEAD")
+
+	MethodOverride(s.router).ServeHTTP(w, r)
+	assert.Equal(w.Code, http.StatusFound)
+}
+
+// discardResponseWriter is a ResponseWriter that allocates nothing, so
+// benchmarks only count the allocations of handlers
+type discardResponseWriter struct {
+	header http.Header
+	code   int
+}
+
+func (w *discardResponseWriter) Header() http.Header         { return w.header }
+func (w *discardResponseWriter) Write(b []byte) (int, error) { return len(b), nil }
+func (w *discardResponseWriter) WriteHeader(code int)        { w.code = code }
+
+func BenchmarkRedirect(b *testing.B) {
+	dir := b.TempDir()
+
+	var err error
+	db, err = OpenDB(filepath.Join(dir, "test.db"), "")
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer db.Close()
+
+	if err := SaveBookmark("gh", "https://github.com/%s"); err != nil {
+		b.Fatal(err)
+	}
+
+	// Wrapped like main does
+	db = NewReadOnlyStore(db)
+	s, err := NewServer(":8000", Config{ReadOnly: true, DisableHistory: true})
+	if err != nil {
+		b.Fatal(err)
+	}
+	db = NewInstrumentedStore(db, s.counters)
+	s.ReplicateStore()
+	s.register()
+
+	for _, query := range []string{"gh", "gh prologic/golinks"} {
+		b.Run(query, func(b *testing.B) {
+			r, _ := http.NewRequest("GET", "/?"+url.Values{"q": {query}}.Encode(), nil)
+			w := &discardResponseWriter{header: make(http.Header)}
+
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				for k := range w.header {
+					delete(w.header, k)
+				}
+				s.router.ServeHTTP(w, r)
+			}
+			if w.code != http.StatusFound {
+				b.Fatalf("expected a redirect, got %d", w.code)
+			}
+		})
+	}
+}
+
+func TestQueryParam(t *testing.T) {
+	assert := assert.New(t)
+
+	for _, rawQuery := range []string{
+		"q=gh+prologic%2Fgolinks",
+		"format=json&q=gh%20prologic/golinks&q=other",
+		"%71=gh+prologic/golinks",
+		"x=%zz&q=gh+prologic/golinks",
+		"x;y=1&q=gh+prologic/golinks",
+		"q=%zz&q=gh+prologic/golinks",
+	} {
+		values, _ := url.ParseQuery(rawQuery)
+		assert.Equal(values.Get("q"), queryParam(rawQuery, "q"), rawQuery)
+		assert.Equal("gh prologic/golinks", queryParam(rawQuery, "q"), rawQuery)
+	}
+	assert.Equal("", queryParam("", "q"))
+	assert.Equal("", queryParam("query=gh", "q"))
+}
@@ -0,0 +1,342 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+const (
+	// SessionCookie is the cookie of the session of a logged in user
+	SessionCookie = "golinks_session"
+
+	// DefaultSessionTTL is how long users stay logged in for by default
+	DefaultSessionTTL = 7 * 24 * time.Hour
+
+	// csrfCookie is the cookie of the token forms are posted with
+	csrfCookie = "golinks_csrf"
+
+	// CSRFField is the form field of the csrf token of a form
+	CSRFField = "csrf"
+
+	// CSRFHeader is the header scripts can send the csrf token in instead
+	CSRFHeader = "X-CSRF-Token"
+)
+
+var (
+	// ErrInvalidSession is returned for missing, forged or expired cookies
+	ErrInvalidSession = errors.New("error: invalid or expired session")
+)
+
+// Session is a logged in user, signed into the session cookie
+type Session struct {
+	Subject string `json:"sub"`
+	Email   string `json:"email,omitempty"`
+	Expires int64  `json:"exp"`
+}
+
+// User returns the user of the session: their email if known, else the
+// subject (e.g. their GitHub login)
+func (s Session) User() string {
+	if s.Email != "" {
+		return s.Email
+	}
+	return s.Subject
+}
+
+// signer signs values into cookies. Its key is derived from a secret so
+// sessions survive restarts and are shared by all instances.
+type signer struct {
+	key []byte
+}
+
+// newSigner returns a signer with a key derived from secret
+func newSigner(secret string) signer {
+	key := sha256.Sum256([]byte("golinks session " + secret))
+	return signer{key: key[:]}
+}
+
+// sign returns v signed as a cookie value
+func (s signer) sign(v interface{}) (string, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+	mac := hmac.New(sha256.New, s.key)
+	mac.Write(data)
+	return base64.RawURLEncoding.EncodeToString(data) + "." +
+		base64.RawURLEncoding.EncodeToString(mac.Sum(nil)), nil
+}
+
+// verify decodes a cookie value signed by sign into v
+func (s signer) verify(value string, v interface{}) error {
+	payload, signature, ok := strings.Cut(value, ".")
+	if !ok {
+		return ErrInvalidSession
+	}
+	data, err := base64.RawURLEncoding.DecodeString(payload)
+	if err != nil {
+		return ErrInvalidSession
+	}
+	sum, err := base64.RawURLEncoding.DecodeString(signature)
+	if err != nil {
+		return ErrInvalidSession
+	}
+	mac := hmac.New(sha256.New, s.key)
+	mac.Write(data)
+	if !hmac.Equal(sum, mac.Sum(nil)) {
+		return ErrInvalidSession
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return ErrInvalidSession
+	}
+	return nil
+}
+
+// Sessions keep users logged in (with Basic auth, OpenID Connect or GitHub)
+// with a signed, HTTP-only session cookie. Nothing is stored server side,
+// so sessions survive restarts and are valid on every instance with the
+// same secret.
+type Sessions struct {
+	signer
+
+	ttl time.Duration
+	now func() time.Time
+}
+
+// NewSessions returns sessions signed with a key derived from secret that
+// last for ttl
+func NewSessions(secret string, ttl time.Duration) *Sessions {
+	return &Sessions{
+		signer: newSigner(secret),
+		ttl:    ttl,
+		now:    time.Now,
+	}
+}
+
+// Session returns the session of the user logged in by the request
+func (s *Sessions) Session(r *http.Request) (Session, error) {
+	cookie, err := r.Cookie(SessionCookie)
+	if err != nil {
+		return Session{}, ErrInvalidSession
+	}
+	var session Session
+	if err := s.verify(cookie.Value, &session); err != nil {
+		return Session{}, err
+	}
+	if s.now().Unix() >= session.Expires {
+		return Session{}, ErrInvalidSession
+	}
+	return session, nil
+}
+
+// Login starts the session of a user who just logged in
+func (s *Sessions) Login(w http.ResponseWriter, r *http.Request, session Session) error {
+	session.Expires = s.now().Add(s.ttl).Unix()
+	value, err := s.sign(session)
+	if err != nil {
+		return err
+	}
+	setCookie(w, r, SessionCookie, "/", value, s.ttl)
+	return nil
+}
+
+// Logout ends the session of the request
+func (s *Sessions) Logout(w http.ResponseWriter, r *http.Request) {
+	setCookie(w, r, SessionCookie, "/", "", -time.Second)
+}
+
+// newSessions returns the sessions of the configuration, signed with
+// SessionSecret or else the client secret of OpenID Connect or GitHub. A
+// random secret is used without any, so sessions end on restart.
+func newSessions(config Config) *Sessions {
+	secret := config.SessionSecret
+	switch {
+	case secret != "":
+	case config.OIDCClientSecret != "":
+		secret = config.OIDCClientSecret
+	case config.GitHubClientSecret != "":
+		secret = config.GitHubClientSecret
+	default:
+		secret = randomString()
+	}
+
+	ttl := config.SessionTTL
+	if ttl <= 0 {
+		ttl = DefaultSessionTTL
+		if config.GitHubClientID != "" {
+			ttl = GitHubSessionTTL
+		}
+	}
+	return NewSessions(secret, ttl)
+}
+
+// randomString returns a random url safe string
+func randomString() string {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// secureRequest reports whether the request was made over https (directly
+// or to a reverse proxy), so cookies can be marked secure
+func secureRequest(r *http.Request) bool {
+	return r.TLS != nil || strings.EqualFold(r.Header.Get("X-Forwarded-Proto"), "https")
+}
+
+// localPath returns next if it is a path on this instance, so logins can't
+// redirect users elsewhere
+func localPath(next string) string {
+	if !strings.HasPrefix(next, "/") || strings.HasPrefix(next, "//") || strings.HasPrefix(next, "/\\") {
+		return "/"
+	}
+	return next
+}
+
+// setCookie sets (or with a negative ttl clears) a login cookie
+func setCookie(w http.ResponseWriter, r *http.Request, name, path, value string, ttl time.Duration) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     name,
+		Value:    value,
+		Path:     path,
+		MaxAge:   int(ttl.Seconds()),
+		HttpOnly: true,
+		Secure:   secureRequest(r),
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+// csrfToken returns the csrf token forms of the request are posted with,
+// setting a new one if the browser has none yet (double submit: other
+// sites can't read the cookie to post it along)
+func csrfToken(w http.ResponseWriter, r *http.Request) string {
+	if cookie, err := r.Cookie(csrfCookie); err == nil && cookie.Value != "" {
+		return cookie.Value
+	}
+	token := randomString()
+	// A session cookie, as a token is only needed while pages are open
+	setCookie(w, r, csrfCookie, "/", token, 0)
+	r.AddCookie(&http.Cookie{Name: csrfCookie, Value: token})
+	return token
+}
+
+// validCSRF reports whether the request was posted with the csrf token of
+// the browser, as a form field or header
+func validCSRF(r *http.Request) bool {
+	cookie, err := r.Cookie(csrfCookie)
+	if err != nil || cookie.Value == "" {
+		return false
+	}
+	token := r.Header.Get(CSRFHeader)
+	if token == "" {
+		token = r.PostFormValue(CSRFField)
+	}
+	return subtle.ConstantTimeCompare([]byte(token), []byte(cookie.Value)) == 1
+}
+
+// tokenRequest reports whether the request has a valid API token, which
+// browsers never send by themselves
+func tokenRequest(r *http.Request) bool {
+	if secret := bearerToken(r); secret != "" {
+		_, ok := LookupToken(secret)
+		return ok
+	}
+	return false
+}
+
+// csrfFailed answers forms posted without the csrf token of the browser
+func (s *Server) csrfFailed(w http.ResponseWriter) {
+	s.counters.Inc("n_csrf_failed")
+	http.Error(w, "Forbidden: invalid or missing csrf token, reload the page and try again", http.StatusForbidden)
+}
+
+// csrf only serves forms posted with the csrf token of the browser, so
+// other sites can't make logged in users post them. Requests with an API
+// token are let through as browsers never send those by themselves.
+func (s *Server) csrf(h httprouter.Handle) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		if !tokenRequest(r) && !validCSRF(r) {
+			s.csrfFailed(w)
+			return
+		}
+		h(w, r, p)
+	}
+}
+
+// formCommands are the commands that change bookmarks or saved pages, so
+// they only run when posted as a form (see confirmCommand)
+var formCommands = map[string]bool{
+	"add":    true,
+	"remove": true,
+	"save":   true,
+}
+
+// confirmCommand reports whether the command cmd of the request can run:
+// commands that change something (see formCommands) must be posted with
+// the csrf token of the browser or an API token. Otherwise users are asked
+// to confirm the query (GET), so a link on another site can't run it, or
+// the form is rejected (POST).
+func (s *Server) confirmCommand(w http.ResponseWriter, r *http.Request, cmd, query string) bool {
+	if !formCommands[cmd] {
+		return true
+	}
+	if r.Method == "POST" {
+		if tokenRequest(r) || validCSRF(r) {
+			return true
+		}
+		s.csrfFailed(w)
+		return false
+	}
+
+	// save saves the page users came from without a url, so keep it
+	u := r.FormValue("url")
+	if u == "" && cmd == "save" {
+		u = r.Referer()
+	}
+	s.render("confirm", w, r, map[string]interface{}{
+		"Query": query,
+		"URL":   u,
+		"Title": r.FormValue("title"),
+	})
+	return false
+}
+
+// LogoutHandler asks users to confirm logging out (GET) and logs them out
+// by clearing their session cookie (POST)
+func (s *Server) LogoutHandler() httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+		if r.Method == "GET" {
+			s.render("logout", w, r, nil)
+			return
+		}
+
+		s.sessions.Logout(w, r)
+		s.counters.Inc("n_logouts")
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		fmt.Fprintln(w, "Logged out")
+	}
+}
+
+// loginSession starts the session of a user who just logged in and
+// redirects them to next
+func (s *Server) loginSession(w http.ResponseWriter, r *http.Request, session Session, next string) {
+	if err := s.sessions.Login(w, r, session); err != nil {
+		slog.Error("error starting session", "user", session.User(), "err", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	http.Redirect(w, r, next, http.StatusFound)
+}
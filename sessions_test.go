@@ -0,0 +1,266 @@
+package main
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/stretchr/testify/assert"
+)
+
+// withCSRF posts the request with a csrf token, as forms do
+func withCSRF(r *http.Request) {
+	r.AddCookie(&http.Cookie{Name: csrfCookie, Value: "t0ken"})
+	r.Header.Set(CSRFHeader, "t0ken")
+}
+
+// postQuery returns a request posting the form of a query (e.g: q=add ...)
+// as the search form does
+func postQuery(form url.Values) *http.Request {
+	r := httptest.NewRequest("POST", "/", strings.NewReader(form.Encode()))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	withCSRF(r)
+	return r
+}
+
+func TestSessions(t *testing.T) {
+	assert := assert.New(t)
+
+	now := time.Now()
+	sessions := NewSessions("s3cr3t", time.Hour)
+	sessions.now = func() time.Time { return now }
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("GET", "https://go.example.com/auth/login", nil)
+	assert.NoError(sessions.Login(w, r, Session{Subject: "alice"}))
+	cookie := w.Result().Cookies()[0]
+	assert.Equal(SessionCookie, cookie.Name)
+	assert.Equal(3600, cookie.MaxAge)
+	assert.True(cookie.HttpOnly)
+	assert.True(cookie.Secure)
+
+	r = httptest.NewRequest("GET", "/", nil)
+	r.AddCookie(cookie)
+	session, err := sessions.Session(r)
+	assert.NoError(err)
+	assert.Equal("alice", session.User())
+
+	// Sessions are only valid with the same secret, and until they expire
+	_, err = NewSessions("other", time.Hour).Session(r)
+	assert.Equal(ErrInvalidSession, err)
+
+	now = now.Add(time.Hour)
+	_, err = sessions.Session(r)
+	assert.Equal(ErrInvalidSession, err)
+
+	_, err = sessions.Session(httptest.NewRequest("GET", "/", nil))
+	assert.Equal(ErrInvalidSession, err)
+
+	w = httptest.NewRecorder()
+	sessions.Logout(w, r)
+	assert.Equal(-1, w.Result().Cookies()[0].MaxAge)
+
+	// Sessions last a week by default, a day with GitHub login
+	assert.Equal(DefaultSessionTTL, newSessions(Config{}).ttl)
+	assert.Equal(GitHubSessionTTL, newSessions(Config{GitHubClientID: "golinks"}).ttl)
+	assert.Equal(time.Minute, newSessions(Config{GitHubClientID: "golinks", SessionTTL: time.Minute}).ttl)
+}
+
+func TestCSRF(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir("", "golinks")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	db, err = OpenStore(filepath.Join(dir, "test.db"))
+	assert.NoError(err)
+	defer db.Close()
+
+	s, err := NewServer(":8000", Config{})
+	assert.NoError(err)
+	h := s.csrf(func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {})
+
+	post := func(form url.Values, prepare func(r *http.Request)) int {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest("POST", "/history/save", strings.NewReader(form.Encode()))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		if prepare != nil {
+			prepare(r)
+		}
+		h(w, r, nil)
+		return w.Code
+	}
+	cookie := func(r *http.Request) {
+		r.AddCookie(&http.Cookie{Name: csrfCookie, Value: "t0ken"})
+	}
+
+	assert.Equal(http.StatusForbidden, post(nil, nil))
+	assert.Equal(http.StatusForbidden, post(url.Values{CSRFField: {"t0ken"}}, nil))
+	assert.Equal(http.StatusForbidden, post(url.Values{CSRFField: {"forged"}}, cookie))
+	assert.Equal(http.StatusOK, post(url.Values{CSRFField: {"t0ken"}}, cookie))
+	assert.Equal(http.StatusOK, post(nil, withCSRF))
+
+	// API tokens need none, but not any bearer token
+	assert.Equal(http.StatusOK, post(nil, func(r *http.Request) { authorize(r, ScopeWrite) }))
+	assert.Equal(http.StatusForbidden, post(nil, func(r *http.Request) {
+		r.Header.Set("Authorization", "Bearer "+TokenPrefix+"bogus")
+	}))
+
+	// Pages with forms set the token they are posted with
+	assert.NoError(SaveBookmark("gh", "https://github.com/%s"))
+	s.router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/?q=gh+prologic", nil))
+	w := httptest.NewRecorder()
+	s.router.ServeHTTP(w, httptest.NewRequest("GET", "/history", nil))
+	assert.Equal(http.StatusOK, w.Code)
+	cookies := w.Result().Cookies()
+	assert.Len(cookies, 1)
+	assert.Equal(csrfCookie, cookies[0].Name)
+	assert.Contains(w.Body.String(), `name="csrf" value="`+cookies[0].Value+`"`)
+}
+
+func TestFormCommands(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir("", "golinks")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	db, err = OpenStore(filepath.Join(dir, "test.db"))
+	assert.NoError(err)
+	defer db.Close()
+
+	assert.NoError(SaveBookmark("gh", "https://github.com/%s"))
+
+	s, err := NewServer(":8000", Config{})
+	assert.NoError(err)
+
+	do := func(r *http.Request) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		s.server.Handler.ServeHTTP(w, r)
+		return w
+	}
+
+	// Links (e.g: on other sites) only ask users to confirm
+	for _, path := range []string{"/?q=add+go+https://golang.org", "/add/go/golang.org", "/?q=remove+gh"} {
+		w := do(httptest.NewRequest("GET", path, nil))
+		assert.Equal(http.StatusOK, w.Code, path)
+		assert.Contains(w.Body.String(), `action="/" method="POST"`, path)
+	}
+	_, ok := LookupBookmark("go")
+	assert.False(ok)
+	_, ok = LookupBookmark("gh")
+	assert.True(ok)
+
+	// Forms posted by other sites are rejected
+	r := httptest.NewRequest("POST", "/", strings.NewReader("q=add+go+https://golang.org"))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	assert.Equal(http.StatusForbidden, do(r).Code)
+	_, ok = LookupBookmark("go")
+	assert.False(ok)
+
+	// The confirmation posts the query with the csrf token of the browser
+	w := do(httptest.NewRequest("GET", "/?q=add+go+https://golang.org", nil))
+	csrf := w.Result().Cookies()[0]
+	token := regexp.MustCompile(`name="csrf" value="([^"]+)"`).FindStringSubmatch(w.Body.String())[1]
+	form := url.Values{"q": {"add go https://golang.org"}, CSRFField: {token}}
+	r = httptest.NewRequest("POST", "/", strings.NewReader(form.Encode()))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	r.AddCookie(csrf)
+	assert.Equal(http.StatusOK, do(r).Code)
+	_, ok = LookupBookmark("go")
+	assert.True(ok)
+
+	// API tokens need no csrf token
+	r = httptest.NewRequest("POST", "/", strings.NewReader("q=remove+gh"))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	authorize(r, ScopeWrite)
+	assert.Equal(http.StatusOK, do(r).Code)
+	_, ok = LookupBookmark("gh")
+	assert.False(ok)
+
+	// Other commands run as before
+	assert.Equal(http.StatusFound, do(httptest.NewRequest("GET", "/?q=help", nil)).Code)
+}
+
+func TestPasswordLogin(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir("", "golinks")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	db, err = OpenStore(filepath.Join(dir, "test.db"))
+	assert.NoError(err)
+	defer db.Close()
+
+	assert.NoError(SaveBookmark("gh", "https://github.com/%s"))
+
+	s, err := NewServer(":8000", Config{AuthUser: "admin", AuthPass: "s3cr3t"})
+	assert.NoError(err)
+
+	do := func(r *http.Request, cookies ...*http.Cookie) *httptest.ResponseRecorder {
+		for _, cookie := range cookies {
+			r.AddCookie(cookie)
+		}
+		w := httptest.NewRecorder()
+		s.server.Handler.ServeHTTP(w, r)
+		return w
+	}
+	login := func(user, pass string, csrf *http.Cookie, token string) *httptest.ResponseRecorder {
+		form := url.Values{"user": {user}, "pass": {pass}, "next": {"/?q=gh+prologic"}, CSRFField: {token}}
+		r := httptest.NewRequest("POST", "/auth/login", strings.NewReader(form.Encode()))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		return do(r, csrf)
+	}
+
+	// Only the login pages are served without logging in, not every query
+	// starting with auth
+	assert.NoError(SaveBookmark("auth", "https://secret.example.com/%s"))
+	for _, path := range []string{"/auth/foo", "/auth/x/y"} {
+		w := do(httptest.NewRequest("GET", path, nil))
+		assert.Equal(http.StatusUnauthorized, w.Code, path)
+		assert.Empty(w.Header().Get("Location"), path)
+	}
+
+	w := do(httptest.NewRequest("GET", "/auth/login?next=%2F%3Fq%3Dgh%2Bprologic", nil))
+	assert.Equal(http.StatusOK, w.Code)
+	csrf := w.Result().Cookies()[0]
+	token := regexp.MustCompile(`name="csrf" value="([^"]+)"`).FindStringSubmatch(w.Body.String())[1]
+	assert.Equal(csrf.Value, token)
+
+	// Logins are forms too
+	w = login("admin", "s3cr3t", csrf, "forged")
+	assert.Equal(http.StatusForbidden, w.Code)
+
+	w = login("admin", "password", csrf, token)
+	assert.Equal(http.StatusOK, w.Code)
+	assert.Contains(w.Body.String(), "Invalid user or password")
+
+	w = login("admin", "s3cr3t", csrf, token)
+	assert.Equal(http.StatusFound, w.Code)
+	assert.Equal("/?q=gh+prologic", w.Header().Get("Location"))
+	var session *http.Cookie
+	for _, cookie := range w.Result().Cookies() {
+		if cookie.Name == SessionCookie {
+			session = cookie
+		}
+	}
+	assert.NotNil(session)
+
+	w = do(httptest.NewRequest("GET", "/?q=gh+prologic", nil), session)
+	assert.Equal(http.StatusFound, w.Code)
+	assert.Equal("https://github.com/prologic", w.Header().Get("Location"))
+
+	w = do(httptest.NewRequest("GET", "/auth/logout", nil), session)
+	assert.Equal(http.StatusOK, w.Code)
+	assert.Contains(w.Body.String(), `action="/auth/logout"`)
+}
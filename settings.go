@@ -0,0 +1,189 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+// MaxSettingsRequestBytes is the maximum size of a settings request body
+const MaxSettingsRequestBytes = 64 * 1024
+
+// settingsKey is the key settings changed at runtime are persisted under
+var settingsKey = []byte("settings")
+
+// Settings are the settings that can be changed at runtime through the
+// admin API, without restarting
+type Settings struct {
+	URL        string `json:"url" yaml:"url"`
+	SuggestURL string `json:"suggest_url" yaml:"suggest_url"`
+	Title      string `json:"title" yaml:"title"`
+}
+
+// Update returns the update changing all settings to these
+func (settings Settings) Update() SettingsUpdate {
+	return SettingsUpdate{URL: &settings.URL, SuggestURL: &settings.SuggestURL, Title: &settings.Title}
+}
+
+// SettingsUpdate changes some settings, those left out are unchanged
+type SettingsUpdate struct {
+	URL        *string `json:"url,omitempty" yaml:"url"`
+	SuggestURL *string `json:"suggest_url,omitempty" yaml:"suggest_url"`
+	Title      *string `json:"title,omitempty" yaml:"title"`
+}
+
+// validateTemplateURL returns an error if url is neither empty nor an
+// absolute http(s) url the query is substituted into as %s
+func validateTemplateURL(name, url string) error {
+	if url == "" {
+		return nil
+	}
+	if !strings.HasPrefix(url, "http://") && !strings.HasPrefix(url, "https://") {
+		return fmt.Errorf("%s must be an absolute http(s) url", name)
+	}
+	if strings.Count(url, "%") != strings.Count(url, "%s") || strings.Count(url, "%s") > 1 {
+		return fmt.Errorf("%s must contain at most one %%s (and no other %%)", name)
+	}
+	return nil
+}
+
+// settings returns the current runtime settings
+func (s *Server) settings() Settings {
+	s.configMu.RLock()
+	defer s.configMu.RUnlock()
+
+	return s.currentSettings()
+}
+
+// currentSettings must be called with configMu held
+func (s *Server) currentSettings() Settings {
+	return Settings{URL: s.config.URL, SuggestURL: s.config.SuggestURL, Title: s.config.Title}
+}
+
+// applySettings must be called with configMu held
+func (s *Server) applySettings(settings Settings) {
+	s.config.URL = settings.URL
+	s.config.SuggestURL = settings.SuggestURL
+	s.config.Title = settings.Title
+}
+
+// LoadSettings applies the settings persisted by UpdateSettings (if any),
+// which take precedence over those of the command line
+func (s *Server) LoadSettings() error {
+	if !db.Has(settingsKey) {
+		return nil
+	}
+
+	data, err := db.Get(settingsKey)
+	if err != nil {
+		return err
+	}
+	var settings Settings
+	if err := json.Unmarshal(data, &settings); err != nil {
+		return err
+	}
+
+	s.configMu.Lock()
+	defer s.configMu.Unlock()
+
+	s.applySettings(settings)
+	return nil
+}
+
+// Apply returns the settings changed by the update, or an error if any
+// of the changes is not valid
+func (update SettingsUpdate) Apply(settings Settings) (Settings, error) {
+	if update.URL != nil {
+		settings.URL = strings.TrimSpace(*update.URL)
+		if err := validateTemplateURL("url", settings.URL); err != nil {
+			return settings, err
+		}
+	}
+	if update.SuggestURL != nil {
+		settings.SuggestURL = strings.TrimSpace(*update.SuggestURL)
+		if err := validateTemplateURL("suggest_url", settings.SuggestURL); err != nil {
+			return settings, err
+		}
+	}
+	if update.Title != nil {
+		settings.Title = strings.TrimSpace(*update.Title)
+		if settings.Title == "" {
+			return settings, fmt.Errorf("title must not be empty")
+		}
+	}
+	return settings, nil
+}
+
+// UpdateSettings changes and persists the settings of the update
+func (s *Server) UpdateSettings(update SettingsUpdate) (Settings, error) {
+	s.configMu.Lock()
+	defer s.configMu.Unlock()
+
+	settings, err := update.Apply(s.currentSettings())
+	if err != nil {
+		return settings, err
+	}
+
+	data, err := json.Marshal(settings)
+	if err != nil {
+		return settings, err
+	}
+	if err := db.Put(settingsKey, data); err != nil {
+		return settings, err
+	}
+
+	s.applySettings(settings)
+	return settings, nil
+}
+
+// SettingsHandler returns the runtime settings
+func (s *Server) SettingsHandler() httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+		s.counters.Inc("n_api_settings")
+
+		WriteJSON(w, http.StatusOK, s.settings())
+	}
+}
+
+// UpdateSettingsHandler changes runtime settings from a JSON body, e.g:
+// {"url": "https://duckduckgo.com/?q=%s"}, returning all settings
+func (s *Server) UpdateSettingsHandler() httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+		s.counters.Inc("n_api_settings_update")
+
+		if !s.writable(w, r) {
+			return
+		}
+
+		var update SettingsUpdate
+		dec := json.NewDecoder(io.LimitReader(r.Body, MaxSettingsRequestBytes))
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(&update); err != nil {
+			WriteAPIError(w, r, http.StatusBadRequest, ErrCodeBadRequest, "invalid json", err.Error())
+			return
+		}
+
+		if _, err := update.Apply(s.settings()); err != nil {
+			WriteAPIError(w, r, http.StatusBadRequest, ErrCodeBadRequest, err.Error(), nil)
+			return
+		}
+
+		settings, err := s.UpdateSettings(update)
+		if err != nil {
+			slog.Error("error updating settings", "err", err)
+			WriteAPIError(
+				w, r, http.StatusInternalServerError, ErrCodeInternal,
+				"error updating settings", err.Error(),
+			)
+			return
+		}
+		auditSettings(r, update)
+
+		WriteJSON(w, http.StatusOK, settings)
+	}
+}
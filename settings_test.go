@@ -0,0 +1,96 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSettingsUpdate(t *testing.T) {
+	assert := assert.New(t)
+
+	url, title := " https://duckduckgo.com/?q=%s ", "Go"
+	settings, err := SettingsUpdate{URL: &url, Title: &title}.Apply(Settings{SuggestURL: "https://suggest.example.com/?q=%s"})
+	assert.NoError(err)
+	assert.Equal(Settings{
+		URL:        "https://duckduckgo.com/?q=%s",
+		SuggestURL: "https://suggest.example.com/?q=%s",
+		Title:      "Go",
+	}, settings)
+
+	empty := ""
+	settings, err = SettingsUpdate{URL: &empty}.Apply(settings)
+	assert.NoError(err)
+	assert.Equal("", settings.URL)
+
+	for _, url := range []string{"duckduckgo.com/?q=%s", "https://duckduckgo.com/?q=%s&p=%d", "https://duckduckgo.com/?q=%s%s"} {
+		_, err = SettingsUpdate{URL: &url}.Apply(settings)
+		assert.Error(err, url)
+	}
+	_, err = SettingsUpdate{Title: &empty}.Apply(settings)
+	assert.Error(err)
+}
+
+func TestSettingsAPI(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir("", "golinks")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	db, err = OpenStore(filepath.Join(dir, "test.db"))
+	assert.NoError(err)
+	defer db.Close()
+
+	config := Config{Title: "Search", URL: "https://www.google.com/search?q=%s"}
+	s, err := NewServer(":8000", config)
+	assert.NoError(err)
+	assert.NoError(s.LoadSettings())
+
+	do := func(method, path, body, scope string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r, _ := http.NewRequest(method, path, strings.NewReader(body))
+		if scope != "" {
+			authorize(r, scope)
+		}
+		s.router.ServeHTTP(w, r)
+		return w
+	}
+
+	w := do("GET", "/api/v1/admin/config", "", ScopeAdmin)
+	assert.Equal(http.StatusOK, w.Code)
+	assert.JSONEq(`{"url": "https://www.google.com/search?q=%s", "suggest_url": "", "title": "Search"}`, w.Body.String())
+
+	assert.Equal(http.StatusForbidden, do("GET", "/api/v1/admin/config", "", ScopeWrite).Code)
+	assert.Equal(http.StatusBadRequest, do("PATCH", "/api/v1/admin/config", `{"url": "ftp://example.com"}`, ScopeAdmin).Code)
+	assert.Equal(http.StatusBadRequest, do("PATCH", "/api/v1/admin/config", `{"default_url": "https://example.com"}`, ScopeAdmin).Code)
+
+	w = do("PATCH", "/api/v1/admin/config", `{"url": "https://duckduckgo.com/?q=%s", "title": "Go"}`, ScopeAdmin)
+	assert.Equal(http.StatusOK, w.Code)
+	assert.JSONEq(`{"url": "https://duckduckgo.com/?q=%s", "suggest_url": "", "title": "Go"}`, w.Body.String())
+
+	// Applied without restarting
+	w = do("GET", "/?q=golang+generics", "", "")
+	assert.Equal(http.StatusFound, w.Code)
+	assert.Equal("https://duckduckgo.com/?q=golang generics", w.Header().Get("Location"))
+
+	w = do("GET", "/opensearch.xml", "", "")
+	assert.Contains(w.Body.String(), "<ShortName>Go</ShortName>")
+
+	// Persisted over the command line settings
+	s, err = NewServer(":8000", config)
+	assert.NoError(err)
+	assert.NoError(s.LoadSettings())
+
+	w = do("GET", "/api/v1/admin/config", "", ScopeAdmin)
+	var settings Settings
+	assert.NoError(json.Unmarshal(w.Body.Bytes(), &settings))
+	assert.Equal(Settings{URL: "https://duckduckgo.com/?q=%s", Title: "Go"}, settings)
+}
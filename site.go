@@ -0,0 +1,307 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"html/template"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/namsral/flag"
+)
+
+// siteTemplates render the static catalog written by Site.Write. They are
+// self-contained (no scripts or external stylesheets) so the catalog can
+// be published to any static host.
+const siteTemplates = `
+{{define "base"}}<!DOCTYPE html>
+<html lang="en">
+<head>
+  <meta charset="utf-8">
+  <meta name="viewport" content="width=device-width, initial-scale=1">
+  <meta name="generator" content="golinks {{ .Site.Version }}">
+  <title>{{ .Title }} - {{ .Site.Title }}</title>
+  <style>
+    body { font-family: -apple-system, system-ui, sans-serif; margin: 2em auto; max-width: 60em; padding: 0 1em; color: #333; }
+    nav a { margin-right: 1em; }
+    table { border-collapse: collapse; width: 100%; }
+    th, td { text-align: left; padding: .3em .5em; border-bottom: 1px solid #eee; vertical-align: top; }
+    code { background: #f5f5f5; padding: 0 .2em; }
+    .tag { font-size: .85em; margin-right: .5em; }
+    .muted { color: #888; font-size: .85em; }
+    .cheatsheet { columns: 3 18em; }
+    .cheatsheet div { break-inside: avoid; margin-bottom: .3em; }
+    @media print { nav, footer { display: none; } }
+  </style>
+</head>
+<body>
+  <nav>
+    <strong>{{ .Site.Title }}</strong>
+    <a href="{{ .Root }}index.html">All links</a>
+    <a href="{{ .Root }}tags/index.html">Tags</a>
+    <a href="{{ .Root }}cheatsheet.html">Cheatsheet</a>
+  </nav>
+  <h1>{{ .Title }}</h1>
+  {{ template "content" . }}
+  <footer class="muted">
+    Read-only mirror of the link catalog generated {{ .Site.Generated.Format "2006-01-02 15:04 MST" }}.
+  </footer>
+</body>
+</html>
+{{end}}
+
+{{define "bookmarks"}}
+<table>
+  <thead><tr><th>Name</th><th>URL</th><th>Tags</th></tr></thead>
+  <tbody>
+  {{ range .Bookmarks }}
+    <tr id="{{ .Name }}">
+      <th><code>{{ .Name }}</code></th>
+      <td>
+        {{ if .Search }}{{ .URL }}{{ else }}<a href="{{ .URL }}">{{ .URL }}</a>{{ end }}
+        {{ with .Description }}<div class="muted">{{ . }}</div>{{ end }}
+      </td>
+      <td>{{ range .Tags }}<a class="tag" href="{{ $.Root }}tags/{{ index $.Site.TagFiles . }}">{{ . }}</a>{{ end }}</td>
+    </tr>
+  {{ end }}
+  </tbody>
+</table>
+{{end}}
+
+{{define "index"}}{{ template "base" . }}{{end}}
+{{define "tag"}}{{ template "base" . }}{{end}}
+{{define "tags"}}{{ template "base" . }}{{end}}
+{{define "cheatsheet"}}{{ template "base" . }}{{end}}
+`
+
+const siteIndexContent = `{{define "content"}}
+<p class="muted">{{ len .Bookmarks }} links</p>
+{{ template "bookmarks" . }}
+{{end}}`
+
+const siteTagsContent = `{{define "content"}}
+<ul>
+{{ range .Site.Tags }}
+  <li><a href="{{ index $.Site.TagFiles .Name }}">{{ .Name }}</a> <span class="muted">({{ .Count }})</span></li>
+{{ else }}
+  <li class="muted">No bookmarks are tagged</li>
+{{ end }}
+</ul>
+{{end}}`
+
+const siteCheatsheetContent = `{{define "content"}}
+<div class="cheatsheet">
+{{ range .Bookmarks }}
+  <div><code>{{ .Name }}{{ if .Search }} &lt;query&gt;{{ end }}</code> <span class="muted">{{ .Host }}</span></div>
+{{ end }}
+</div>
+{{end}}`
+
+// SiteBookmark is a bookmark of the static catalog
+type SiteBookmark struct {
+	Name        string
+	URL         string
+	Tags        []string
+	Description string
+}
+
+// Search reports whether the bookmark takes a query (has a %s)
+func (b SiteBookmark) Search() bool {
+	return strings.Contains(b.URL, "%s")
+}
+
+// Host returns the host the bookmark points at, e.g: github.com
+func (b SiteBookmark) Host() string {
+	return TargetDomain(b.URL)
+}
+
+// SiteTag is a tag with the number of bookmarks tagged with it
+type SiteTag struct {
+	Name  string
+	Count int
+}
+
+// Site is the static catalog of all bookmarks
+type Site struct {
+	Title     string
+	Version   string
+	Generated time.Time
+
+	Bookmarks []SiteBookmark
+	Tags      []SiteTag
+
+	// TagFiles are the file names of the tag pages
+	TagFiles map[string]string
+}
+
+type sitePage struct {
+	Site      *Site
+	Title     string
+	Root      string
+	Bookmarks []SiteBookmark
+}
+
+// ListSiteBookmarks returns all bookmarks along with their tags and
+// description (if any), sorted by name
+func ListSiteBookmarks() ([]SiteBookmark, error) {
+	bookmarks, err := ListBookmarks()
+	if err != nil {
+		return nil, err
+	}
+
+	var sited []SiteBookmark
+	for _, bookmark := range bookmarks {
+		b := SiteBookmark{Name: bookmark.Name(), URL: bookmark.URL()}
+		if val, err := db.Get([]byte(fmt.Sprintf("tags_%s", b.Name))); err == nil && len(val) > 0 {
+			b.Tags = strings.Split(string(val), ",")
+		}
+		if val, err := db.Get([]byte(fmt.Sprintf("description_%s", b.Name))); err == nil {
+			b.Description = string(val)
+		}
+		sited = append(sited, b)
+	}
+	sort.Slice(sited, func(i, j int) bool { return sited[i].Name < sited[j].Name })
+
+	return sited, nil
+}
+
+// NewSite builds the static catalog of the bookmarks
+func NewSite(title string, bookmarks []SiteBookmark) *Site {
+	site := &Site{
+		Title:     title,
+		Version:   FullVersion(),
+		Generated: time.Now(),
+		Bookmarks: bookmarks,
+		TagFiles:  make(map[string]string),
+	}
+
+	counts := make(map[string]int)
+	for _, bookmark := range bookmarks {
+		for _, tag := range bookmark.Tags {
+			counts[tag]++
+		}
+	}
+	for tag, count := range counts {
+		site.Tags = append(site.Tags, SiteTag{Name: tag, Count: count})
+	}
+	sort.Slice(site.Tags, func(i, j int) bool { return site.Tags[i].Name < site.Tags[j].Name })
+
+	// Tags are slugified into file names, numbered if two slugify the same
+	taken := make(map[string]bool)
+	for _, tag := range site.Tags {
+		slug := Slugify(tag.Name, "")
+		file := slug + ".html"
+		for i := 2; taken[file]; i++ {
+			file = fmt.Sprintf("%s-%d.html", slug, i)
+		}
+		taken[file] = true
+		site.TagFiles[tag.Name] = file
+	}
+
+	return site
+}
+
+// Tagged returns the bookmarks tagged with tag
+func (site *Site) Tagged(tag string) []SiteBookmark {
+	var tagged []SiteBookmark
+	for _, bookmark := range site.Bookmarks {
+		for _, t := range bookmark.Tags {
+			if t == tag {
+				tagged = append(tagged, bookmark)
+				break
+			}
+		}
+	}
+	return tagged
+}
+
+func (site *Site) render(dir, file, name, content string, page sitePage) error {
+	t, err := template.New("site").Parse(siteTemplates)
+	if err == nil {
+		_, err = t.Parse(content)
+	}
+	if err != nil {
+		return err
+	}
+
+	f, err := os.Create(filepath.Join(dir, file))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	page.Site = site
+	if err := t.ExecuteTemplate(f, name, page); err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+// Write writes the catalog to dir: index.html listing all bookmarks,
+// cheatsheet.html with just their names, tags/index.html listing the tags
+// and a page per tag in tags/. It returns the number of pages written.
+func (site *Site) Write(dir string) (int, error) {
+	if err := os.MkdirAll(filepath.Join(dir, "tags"), 0755); err != nil {
+		return 0, err
+	}
+
+	pages := []struct {
+		file, name, content string
+		page                sitePage
+	}{
+		{"index.html", "index", siteIndexContent, sitePage{Title: "All links", Bookmarks: site.Bookmarks}},
+		{"cheatsheet.html", "cheatsheet", siteCheatsheetContent, sitePage{Title: "Cheatsheet", Bookmarks: site.Bookmarks}},
+		{filepath.Join("tags", "index.html"), "tags", siteTagsContent, sitePage{Title: "Tags", Root: "../"}},
+	}
+	for _, tag := range site.Tags {
+		pages = append(pages, struct {
+			file, name, content string
+			page                sitePage
+		}{
+			filepath.Join("tags", site.TagFiles[tag.Name]), "tag", siteIndexContent,
+			sitePage{Title: tag.Name, Root: "../", Bookmarks: site.Tagged(tag.Name)},
+		})
+	}
+
+	for i, p := range pages {
+		if err := site.render(dir, p.file, p.name, p.content, p.page); err != nil {
+			return i, fmt.Errorf("error writing %s: %s", p.file, err)
+		}
+	}
+
+	return len(pages), nil
+}
+
+func runExportSite(args []string) error {
+	var title string
+
+	fs := flag.NewFlagSet("export-site", flag.ExitOnError)
+	open := openDBFlags(fs)
+	fs.StringVar(&title, "title", "golinks", "title of the catalog")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		return errors.New("usage: golinks export-site [options] <dir>")
+	}
+
+	if err := open(); err != nil {
+		return err
+	}
+	defer db.Close()
+
+	bookmarks, err := ListSiteBookmarks()
+	if err != nil {
+		return err
+	}
+
+	n, err := NewSite(title, bookmarks).Write(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	fmt.Printf("wrote %d pages (%d links) to %s\n", n, len(bookmarks), fs.Arg(0))
+	return nil
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewSite(t *testing.T) {
+	assert := assert.New(t)
+
+	site := NewSite("golinks", []SiteBookmark{
+		{Name: "gh", URL: "https://github.com/%s", Tags: []string{"code", "c++"}},
+		{Name: "go", URL: "https://golang.org", Tags: []string{"code"}},
+		{Name: "wiki", URL: "https://en.wikipedia.org/wiki/%s", Tags: []string{"c"}},
+	})
+
+	assert.Equal([]SiteTag{{"c", 1}, {"c++", 1}, {"code", 2}}, site.Tags)
+	assert.Equal(map[string]string{"c": "c.html", "c++": "c-2.html", "code": "code.html"}, site.TagFiles)
+
+	tagged := site.Tagged("code")
+	assert.Len(tagged, 2)
+	assert.Equal("gh", tagged[0].Name)
+	assert.Equal("go", tagged[1].Name)
+	assert.Empty(site.Tagged("nope"))
+
+	assert.True(tagged[0].Search())
+	assert.False(tagged[1].Search())
+	assert.Equal("golang.org", tagged[1].Host())
+}
+
+func TestExportSite(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir("", "golinks")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	db, err = OpenStore(filepath.Join(dir, "test.db"))
+	assert.NoError(err)
+	defer db.Close()
+
+	assert.NoError(SaveBookmark("gh", "https://github.com/%s"))
+	assert.NoError(SaveBookmark("go", "https://golang.org/?a=1&b=2"))
+	assert.NoError(db.Put([]byte("tags_gh"), []byte("code,git")))
+	assert.NoError(db.Put([]byte("description_go"), []byte("<The Go website>")))
+
+	bookmarks, err := ListSiteBookmarks()
+	assert.NoError(err)
+	assert.Equal([]SiteBookmark{
+		{Name: "gh", URL: "https://github.com/%s", Tags: []string{"code", "git"}},
+		{Name: "go", URL: "https://golang.org/?a=1&b=2", Description: "<The Go website>"},
+	}, bookmarks)
+
+	out := filepath.Join(dir, "out")
+	n, err := NewSite("Acme links", bookmarks).Write(out)
+	assert.NoError(err)
+	assert.Equal(5, n)
+
+	read := func(name string) string {
+		data, err := ioutil.ReadFile(filepath.Join(out, name))
+		assert.NoError(err)
+		return string(data)
+	}
+
+	index := read("index.html")
+	assert.Contains(index, "<title>All links - Acme links</title>")
+	assert.Contains(index, `<a href="https://golang.org/?a=1&amp;b=2">`)
+	assert.Contains(index, "&lt;The Go website&gt;")
+	assert.Contains(index, `<a class="tag" href="tags/code.html">code</a>`)
+
+	assert.Contains(read("cheatsheet.html"), "<code>gh &lt;query&gt;</code>")
+
+	tags := read(filepath.Join("tags", "index.html"))
+	assert.Contains(tags, `<a href="git.html">git</a>`)
+	assert.Contains(tags, `<a href="../index.html">All links</a>`)
+
+	tag := read(filepath.Join("tags", "git.html"))
+	assert.Contains(tag, "<code>gh</code>")
+	assert.NotContains(tag, "<code>go</code>")
+	assert.Contains(tag, `<a class="tag" href="../tags/code.html">code</a>`)
+
+	assert.Error(runExportSite(nil))
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+)
+
+// SnapshotVersion is the current version of the snapshot format
+const SnapshotVersion = 1
+
+// Snapshot is a serialized copy of every key and value in the store
+type Snapshot struct {
+	Version int               `json:"version"`
+	Created time.Time         `json:"created"`
+	Data    map[string]string `json:"data"`
+}
+
+// TakeSnapshot ...
+func TakeSnapshot(store Store) (*Snapshot, error) {
+	snapshot := &Snapshot{
+		Version: SnapshotVersion,
+		Created: time.Now().UTC(),
+		Data:    make(map[string]string),
+	}
+
+	err := store.Scan([]byte{}, func(key []byte) error {
+		val, err := store.Get(key)
+		if err != nil {
+			return fmt.Errorf("error reading key %s: %s", key, err)
+		}
+		snapshot.Data[string(key)] = string(val)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return snapshot, nil
+}
+
+// Restore writes every key and value in the snapshot to the store and
+// returns the number of keys restored.
+func (s *Snapshot) Restore(store Store) (int, error) {
+	if s.Version > SnapshotVersion {
+		return 0, fmt.Errorf("unsupported snapshot version %d", s.Version)
+	}
+
+	n := 0
+	for key, val := range s.Data {
+		if err := store.Put([]byte(key), []byte(val)); err != nil {
+			return n, fmt.Errorf("error writing key %s: %s", key, err)
+		}
+		n++
+	}
+
+	return n, nil
+}
+
+// WriteJSON writes the snapshot as indented JSON. Keys are sorted so that
+// dumps of the same data are identical and diff nicely.
+func (s *Snapshot) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(s)
+}
+
+// ReadSnapshot reads a JSON snapshot
+func ReadSnapshot(r io.Reader) (*Snapshot, error) {
+	var snapshot Snapshot
+	if err := json.NewDecoder(r).Decode(&snapshot); err != nil {
+		return nil, err
+	}
+	if snapshot.Data == nil {
+		return nil, fmt.Errorf("invalid snapshot: missing data")
+	}
+	return &snapshot, nil
+}
+
+// WriteCompressed writes the snapshot as gzip compressed JSON
+func (s *Snapshot) WriteCompressed(w io.Writer) error {
+	gz := gzip.NewWriter(w)
+	if err := json.NewEncoder(gz).Encode(s); err != nil {
+		return err
+	}
+	return gz.Close()
+}
+
+// ReadCompressedSnapshot reads a gzip compressed JSON snapshot
+func ReadCompressedSnapshot(r io.Reader) (*Snapshot, error) {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, err
+	}
+	defer gz.Close()
+
+	var snapshot Snapshot
+	if err := json.NewDecoder(gz).Decode(&snapshot); err != nil {
+		return nil, err
+	}
+
+	return &snapshot, nil
+}
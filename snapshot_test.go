@@ -0,0 +1,58 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSnapshot(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir("", "golinks")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	store, err := OpenStore(filepath.Join(dir, "test.db"))
+	assert.NoError(err)
+	defer store.Close()
+
+	assert.NoError(store.Put([]byte("bookmark_g"), []byte("https://google.com")))
+	assert.NoError(store.Put([]byte("bookmark_gh"), []byte("https://github.com")))
+
+	snapshot, err := TakeSnapshot(store)
+	assert.NoError(err)
+	assert.Equal(SnapshotVersion, snapshot.Version)
+	assert.Len(snapshot.Data, 2)
+
+	buf := &bytes.Buffer{}
+	assert.NoError(snapshot.WriteCompressed(buf))
+
+	restored, err := ReadCompressedSnapshot(buf)
+	assert.NoError(err)
+	assert.Equal(snapshot.Data, restored.Data)
+
+	other, err := OpenStore(filepath.Join(dir, "other.db"))
+	assert.NoError(err)
+	defer other.Close()
+
+	n, err := restored.Restore(other)
+	assert.NoError(err)
+	assert.Equal(2, n)
+
+	val, err := other.Get([]byte("bookmark_gh"))
+	assert.NoError(err)
+	assert.Equal("https://github.com", string(val))
+}
+
+func TestSnapshotUnsupportedVersion(t *testing.T) {
+	assert := assert.New(t)
+
+	snapshot := &Snapshot{Version: SnapshotVersion + 1}
+	_, err := snapshot.Restore(nil)
+	assert.Error(err)
+}
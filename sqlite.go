@@ -0,0 +1,7 @@
+//go:build sqlite
+
+package main
+
+// Registers the pure Go "sqlite" driver of the sqlite store, fetch it with
+// `go get modernc.org/sqlite` and build with -tags sqlite
+import _ "modernc.org/sqlite"
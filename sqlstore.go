@@ -0,0 +1,155 @@
+package main
+
+import (
+	"bytes"
+	"database/sql"
+	"fmt"
+
+	"github.com/prologic/bitcask"
+)
+
+// SQLiteDrivers are the database/sql drivers the sqlite store uses, the
+// first one registered wins (see sqlite.go, built with -tags sqlite)
+var SQLiteDrivers = []string{"sqlite", "sqlite3"}
+
+func init() {
+	RegisterStore("sqlite", OpenSQLiteStore)
+}
+
+// SQLStore is a Store of keys and values in a single table of a SQL
+// database, e.g: SQLite
+type SQLStore struct {
+	db *sql.DB
+}
+
+// OpenSQLiteStore opens (or creates) the SQLite database at path
+func OpenSQLiteStore(path string) (Store, error) {
+	driver := sqliteDriver()
+	if driver == "" {
+		return nil, fmt.Errorf("sqlite store not supported: golinks was built without -tags sqlite")
+	}
+
+	db, err := sql.Open(driver, path)
+	if err != nil {
+		return nil, err
+	}
+	// SQLite allows a single writer and a connection per scan would
+	// deadlock against writes from within the scan.
+	db.SetMaxOpenConns(1)
+
+	return NewSQLStore(db)
+}
+
+func sqliteDriver() string {
+	registered := make(map[string]bool)
+	for _, driver := range sql.Drivers() {
+		registered[driver] = true
+	}
+	for _, driver := range SQLiteDrivers {
+		if registered[driver] {
+			return driver
+		}
+	}
+	return ""
+}
+
+// NewSQLStore creates the table of keys and values in db if it is missing
+func NewSQLStore(db *sql.DB) (*SQLStore, error) {
+	_, err := db.Exec(
+		`CREATE TABLE IF NOT EXISTS kv (key BLOB PRIMARY KEY, value BLOB NOT NULL)`,
+	)
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("error creating table: %s", err)
+	}
+	return &SQLStore{db: db}, nil
+}
+
+// Get returns bitcask.ErrKeyNotFound for missing keys like bitcask does
+func (s *SQLStore) Get(key []byte) ([]byte, error) {
+	var value []byte
+	err := s.db.QueryRow(`SELECT value FROM kv WHERE key = ?`, key).Scan(&value)
+	if err == sql.ErrNoRows {
+		return nil, bitcask.ErrKeyNotFound
+	}
+	return value, err
+}
+
+// Has ...
+func (s *SQLStore) Has(key []byte) bool {
+	_, err := s.Get(key)
+	return err == nil
+}
+
+// Put ...
+func (s *SQLStore) Put(key, value []byte) error {
+	_, err := s.db.Exec(
+		`INSERT INTO kv (key, value) VALUES (?, ?)
+		ON CONFLICT (key) DO UPDATE SET value = excluded.value`,
+		key, value,
+	)
+	return err
+}
+
+// Delete returns bitcask.ErrKeyNotFound for missing keys like bitcask does
+func (s *SQLStore) Delete(key []byte) error {
+	res, err := s.db.Exec(`DELETE FROM kv WHERE key = ?`, key)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return bitcask.ErrKeyNotFound
+	}
+	return nil
+}
+
+// Scan calls f with the keys starting with prefix in order. The keys are
+// read first, so f may read and write the store.
+func (s *SQLStore) Scan(prefix []byte, f func(key []byte) error) error {
+	query, args := `SELECT key FROM kv ORDER BY key`, []interface{}{}
+	if len(prefix) > 0 {
+		query, args = `SELECT key FROM kv WHERE key >= ? ORDER BY key`, []interface{}{prefix}
+	}
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return err
+	}
+
+	var keys [][]byte
+	for rows.Next() {
+		var key []byte
+		if err := rows.Scan(&key); err != nil {
+			rows.Close()
+			return err
+		}
+		if !bytes.HasPrefix(key, prefix) {
+			break
+		}
+		keys = append(keys, key)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, key := range keys {
+		if err := f(key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Len ...
+func (s *SQLStore) Len() int {
+	var n int
+	if err := s.db.QueryRow(`SELECT COUNT(*) FROM kv`).Scan(&n); err != nil {
+		return 0
+	}
+	return n
+}
+
+// Close ...
+func (s *SQLStore) Close() error {
+	return s.db.Close()
+}
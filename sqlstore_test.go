@@ -0,0 +1,59 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/prologic/bitcask"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSQLiteStore(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir("", "golinks")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	if sqliteDriver() == "" {
+		_, err := OpenStore("sqlite://" + filepath.Join(dir, "test.db"))
+		assert.EqualError(err, "sqlite store not supported: golinks was built without -tags sqlite")
+		t.Skip("built without -tags sqlite")
+	}
+
+	src, err := OpenStore(filepath.Join(dir, "src.db"))
+	assert.NoError(err)
+	defer src.Close()
+
+	dst, err := OpenStore("sqlite://" + filepath.Join(dir, "dst.db"))
+	assert.NoError(err)
+	defer dst.Close()
+
+	assert.NoError(src.Put([]byte("bookmark_g"), []byte("https://google.com")))
+	assert.NoError(src.Put([]byte("bookmark_gh"), []byte("https://github.com")))
+	assert.NoError(src.Put([]byte("history_1"), []byte("g foo")))
+
+	report, err := Migrate(src, dst)
+	assert.NoError(err)
+	assert.Equal(3, report.Total())
+	assert.Equal(3, dst.Len())
+
+	var keys []string
+	assert.NoError(dst.Scan([]byte("bookmark_"), func(key []byte) error {
+		keys = append(keys, string(key))
+		return dst.Put(key, []byte("https://example.com"))
+	}))
+	assert.Equal([]string{"bookmark_g", "bookmark_gh"}, keys)
+
+	val, err := dst.Get([]byte("bookmark_gh"))
+	assert.NoError(err)
+	assert.Equal("https://example.com", string(val))
+
+	assert.NoError(dst.Delete([]byte("history_1")))
+	assert.False(dst.Has([]byte("history_1")))
+	_, err = dst.Get([]byte("history_1"))
+	assert.Equal(bitcask.ErrKeyNotFound, err)
+	assert.Equal(bitcask.ErrKeyNotFound, dst.Delete([]byte("history_1")))
+}
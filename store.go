@@ -0,0 +1,218 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/prologic/bitcask"
+)
+
+// DefaultStoreScheme is used for store URIs without an explicit scheme
+const DefaultStoreScheme = "bitcask"
+
+// MaxKeySize is the maximum size of keys in bitcask stores. Bitcask only
+// allows 64 bytes by default, less than the keys of API tokens (a prefix
+// and a SHA-256 hash) or of long bookmark names.
+const MaxKeySize = 1024
+
+// Store ...
+type Store interface {
+	Get(key []byte) ([]byte, error)
+	Has(key []byte) bool
+	Put(key, value []byte) error
+	Delete(key []byte) error
+	Scan(prefix []byte, f func(key []byte) error) error
+	Len() int
+	Close() error
+}
+
+// StoreOpener ...
+type StoreOpener func(path string) (Store, error)
+
+var stores = make(map[string]StoreOpener)
+
+func init() {
+	RegisterStore("bitcask", func(path string) (Store, error) {
+		store, err := bitcask.Open(path, bitcask.WithMaxKeySize(MaxKeySize))
+		if err != nil {
+			return nil, err
+		}
+		return NewLockingStore(store), nil
+	})
+}
+
+// LockingStore wraps a Store whose scans (and index updates) aren't safe
+// against concurrent writes, e.g: bitcask, which scans its index without a
+// lock and updates it after releasing its own. Reads and scans share a
+// lock that writes take exclusively. Scans collect the keys first and call
+// back without the lock, so callbacks may read and write the store.
+type LockingStore struct {
+	Store
+
+	mu sync.RWMutex
+}
+
+// NewLockingStore ...
+func NewLockingStore(store Store) *LockingStore {
+	return &LockingStore{Store: store}
+}
+
+// Unwrap returns the wrapped store
+func (s *LockingStore) Unwrap() Store {
+	return s.Store
+}
+
+// Get ...
+func (s *LockingStore) Get(key []byte) ([]byte, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.Store.Get(key)
+}
+
+// Has ...
+func (s *LockingStore) Has(key []byte) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.Store.Has(key)
+}
+
+// Len ...
+func (s *LockingStore) Len() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.Store.Len()
+}
+
+// Put ...
+func (s *LockingStore) Put(key, value []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.Store.Put(key, value)
+}
+
+// Delete ...
+func (s *LockingStore) Delete(key []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.Store.Delete(key)
+}
+
+// Scan ...
+func (s *LockingStore) Scan(prefix []byte, f func(key []byte) error) error {
+	var keys [][]byte
+	s.mu.RLock()
+	err := s.Store.Scan(prefix, func(key []byte) error {
+		keys = append(keys, append([]byte{}, key...))
+		return nil
+	})
+	s.mu.RUnlock()
+	if err != nil {
+		return err
+	}
+
+	for _, key := range keys {
+		if err := f(key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Merge ...
+func (s *LockingStore) Merge() error {
+	merger, ok := s.Store.(Merger)
+	if !ok {
+		return ErrMergeNotSupported
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return merger.Merge()
+}
+
+// Close ...
+func (s *LockingStore) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.Store.Close()
+}
+
+// RegisterStore ...
+func RegisterStore(scheme string, opener StoreOpener) {
+	stores[scheme] = opener
+}
+
+// StoreSchemes returns the schemes of the registered stores
+func StoreSchemes() []string {
+	var schemes []string
+	for scheme := range stores {
+		schemes = append(schemes, scheme)
+	}
+	sort.Strings(schemes)
+	return schemes
+}
+
+// ParseStoreURI splits a store URI of the form scheme://path into its
+// scheme and path. A bare path uses the DefaultStoreScheme.
+func ParseStoreURI(uri string) (scheme, path string) {
+	if i := strings.Index(uri, "://"); i >= 0 {
+		return strings.ToLower(uri[:i]), uri[i+3:]
+	}
+	return DefaultStoreScheme, uri
+}
+
+// OpenStore ...
+func OpenStore(uri string) (Store, error) {
+	scheme, path := ParseStoreURI(uri)
+	if path == "" {
+		return nil, fmt.Errorf("invalid store uri %q: missing path", uri)
+	}
+
+	opener, ok := stores[scheme]
+	if !ok {
+		return nil, fmt.Errorf(
+			"unsupported store %q in %q (supported: %s)",
+			scheme, uri, strings.Join(StoreSchemes(), ", "),
+		)
+	}
+
+	return opener(path)
+}
+
+// OpenDB opens the store at the given uri and enables encryption of values
+// if an encryption key file is given.
+func OpenDB(uri, encryptionKeyFile string) (Store, error) {
+	store, err := OpenStore(uri)
+	if err != nil {
+		return nil, err
+	}
+
+	if encryptionKeyFile == "" {
+		return store, nil
+	}
+
+	key, err := LoadEncryptionKey(encryptionKeyFile)
+	if err != nil {
+		store.Close()
+		return nil, fmt.Errorf("error loading encryption key: %s", err)
+	}
+
+	es, err := NewEncryptedStore(store, key)
+	if err != nil {
+		store.Close()
+		return nil, err
+	}
+
+	return es, nil
+}
+
+// KeyType returns the type of a key which is the prefix before the first
+// underscore, e.g: bookmark_g => bookmark
+func KeyType(key []byte) string {
+	s := string(key)
+	if i := strings.Index(s, "_"); i > 0 {
+		return s[:i]
+	}
+	return s
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseStoreURI(t *testing.T) {
+	assert := assert.New(t)
+
+	scheme, path := ParseStoreURI("search.db")
+	assert.Equal("bitcask", scheme)
+	assert.Equal("search.db", path)
+
+	scheme, path = ParseStoreURI("bitcask:///var/lib/golinks/search.db")
+	assert.Equal("bitcask", scheme)
+	assert.Equal("/var/lib/golinks/search.db", path)
+
+	scheme, path = ParseStoreURI("SQLite://golinks.db")
+	assert.Equal("sqlite", scheme)
+	assert.Equal("golinks.db", path)
+}
+
+func TestOpenStore(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir("", "golinks")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	store, err := OpenStore("bitcask://" + filepath.Join(dir, "test.db"))
+	assert.NoError(err)
+	defer store.Close()
+
+	assert.NoError(store.Put([]byte("bookmark_g"), []byte("https://google.com")))
+	assert.True(store.Has([]byte("bookmark_g")))
+
+	// Keys of API tokens are longer than bitcask allows by default
+	assert.NoError(store.Put(tokenKey(hashToken("s3cr3t")), []byte("{}")))
+}
+
+func TestLockingStore(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir("", "golinks")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	store, err := OpenStore(filepath.Join(dir, "test.db"))
+	assert.NoError(err)
+	defer store.Close()
+
+	// Scans run safely while others write (see go test -race)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 100; i++ {
+			store.Put([]byte(fmt.Sprintf("bookmark_%d", i)), []byte("https://example.com"))
+		}
+	}()
+	for i := 0; i < 100; i++ {
+		assert.NoError(store.Scan([]byte("bookmark_"), func(key []byte) error { return nil }))
+	}
+	<-done
+
+	// and callbacks may write to the store they scan
+	n := 0
+	assert.NoError(store.Scan([]byte("bookmark_"), func(key []byte) error {
+		n++
+		return store.Delete(key)
+	}))
+	assert.Equal(100, n)
+	assert.Equal(0, store.Len())
+}
+
+func TestOpenStoreUnsupported(t *testing.T) {
+	assert := assert.New(t)
+
+	_, err := OpenStore("foo://test.db")
+	assert.EqualError(err, `unsupported store "foo" in "foo://test.db" (supported: bitcask, sqlite)`)
+
+	_, err = OpenStore("bitcask://")
+	assert.Error(err)
+}
+
+func TestKeyType(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.Equal("bookmark", KeyType([]byte("bookmark_g")))
+	assert.Equal("bookmark", KeyType([]byte("bookmark_foo_bar")))
+	assert.Equal("foo", KeyType([]byte("foo")))
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"strings"
+	"time"
+)
+
+// InstrumentedStore wraps a Store and records the latency of every
+// operation by operation and key type (e.g: store_get_bookmark) so backends
+// and regressions can be compared in production.
+type InstrumentedStore struct {
+	Store
+
+	counters *Counters
+}
+
+// NewInstrumentedStore ...
+func NewInstrumentedStore(store Store, counters *Counters) *InstrumentedStore {
+	return &InstrumentedStore{Store: store, counters: counters}
+}
+
+// storeKeyType returns the key type used in metric names. Keys without a
+// type prefix are grouped together to keep the number of metrics bounded,
+// and keys of users and teams are grouped by type regardless of the user
+// or team, e.g: user/alice/bookmark_g => user_bookmark.
+func storeKeyType(key []byte) string {
+	s := string(key)
+	for _, namespace := range []string{"user", "team"} {
+		if rest, ok := strings.CutPrefix(s, namespace+"/"); ok {
+			if i := strings.Index(rest, "/"); i >= 0 {
+				return namespace + "_" + metricKeyType(rest[i+1:])
+			}
+			return namespace + "_other"
+		}
+	}
+	return metricKeyType(s)
+}
+
+func metricKeyType(s string) string {
+	if strings.Index(s, "_") <= 0 || strings.Contains(KeyType([]byte(s)), "/") {
+		return "other"
+	}
+	return KeyType([]byte(s))
+}
+
+// Unwrap returns the wrapped store
+func (s *InstrumentedStore) Unwrap() Store {
+	return s.Store
+}
+
+func (s *InstrumentedStore) observe(op string, key []byte, t0 time.Time) {
+	s.counters.Time("store_"+op+"_"+storeKeyType(key), time.Since(t0))
+}
+
+// Get ...
+func (s *InstrumentedStore) Get(key []byte) ([]byte, error) {
+	defer s.observe("get", key, time.Now())
+	return s.Store.Get(key)
+}
+
+// Has ...
+func (s *InstrumentedStore) Has(key []byte) bool {
+	defer s.observe("has", key, time.Now())
+	return s.Store.Has(key)
+}
+
+// Put ...
+func (s *InstrumentedStore) Put(key, value []byte) error {
+	defer s.observe("put", key, time.Now())
+	return s.Store.Put(key, value)
+}
+
+// Delete ...
+func (s *InstrumentedStore) Delete(key []byte) error {
+	defer s.observe("delete", key, time.Now())
+	return s.Store.Delete(key)
+}
+
+// Scan records the latency of the whole scan including the time spent in f
+func (s *InstrumentedStore) Scan(prefix []byte, f func(key []byte) error) error {
+	defer s.observe("scan", prefix, time.Now())
+	return s.Store.Scan(prefix, f)
+}
+
+// Merge ...
+func (s *InstrumentedStore) Merge() error {
+	merger, ok := s.Store.(Merger)
+	if !ok {
+		return ErrMergeNotSupported
+	}
+	return merger.Merge()
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/rcrowley/go-metrics"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestInstrumentedStore(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir("", "golinks")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	store, err := OpenStore(filepath.Join(dir, "test.db"))
+	assert.NoError(err)
+	defer store.Close()
+
+	counters := NewCounters()
+	is := NewInstrumentedStore(store, counters)
+
+	assert.NoError(is.Put([]byte("bookmark_g"), []byte("https://google.com")))
+	val, err := is.Get([]byte("bookmark_g"))
+	assert.NoError(err)
+	assert.Equal("https://google.com", string(val))
+	_, err = is.Get([]byte("bookmark_missing"))
+	assert.Error(err)
+	assert.False(is.Has([]byte("alias_g")))
+	assert.NoError(is.Scan([]byte("bookmark_"), func(key []byte) error { return nil }))
+	assert.NoError(is.Delete([]byte("foo")))
+
+	count := func(name string) int64 {
+		timer, ok := counters.r.Get(name).(metrics.Timer)
+		if !ok {
+			return 0
+		}
+		return timer.Count()
+	}
+
+	assert.Equal(int64(1), count("store_put_bookmark"))
+	assert.Equal(int64(2), count("store_get_bookmark"))
+	assert.Equal(int64(1), count("store_has_alias"))
+	assert.Equal(int64(1), count("store_scan_bookmark"))
+	assert.Equal(int64(1), count("store_delete_other"))
+	assert.Equal(int64(0), count("store_get_alias"))
+}
+
+func TestStoreKeyType(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.Equal("bookmark", storeKeyType([]byte("bookmark_g")))
+	assert.Equal("alias", storeKeyType([]byte("alias_")))
+	assert.Equal("other", storeKeyType([]byte("foo")))
+	assert.Equal("other", storeKeyType([]byte("_foo")))
+	assert.Equal("other", storeKeyType(nil))
+
+	// Not one per user or team
+	assert.Equal("user_bookmark", storeKeyType([]byte(personalPrefix("alice_b")+"g")))
+	assert.Equal("user_team", storeKeyType([]byte(userTeamPrefix("alice")+"eng")))
+	assert.Equal("team_bookmark", storeKeyType([]byte(teamPrefix("eng")+"g")))
+	assert.Equal("team_member", storeKeyType([]byte(teamMemberPrefix("eng")+"alice")))
+	assert.Equal("team_other", storeKeyType([]byte("team/")))
+	assert.Equal("user_other", storeKeyType([]byte("user/alice/")))
+	assert.Equal("other", storeKeyType([]byte("foo/bar_baz")))
+	assert.Equal("user_other", storeKeyType([]byte("user/alice/team/eng/member_bob")))
+}
@@ -0,0 +1,288 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/url"
+	"strings"
+)
+
+var (
+	// ErrSuggestionsInvalidJSON ...
+	ErrSuggestionsInvalidJSON = errors.New("suggestions response is not valid JSON")
+
+	// ErrSuggestionsUnrecognized ...
+	ErrSuggestionsUnrecognized = errors.New("suggestions response format not recognized")
+
+	// xssiPrefix is prepended by some providers (e.g: Google) to JSON
+	// responses to prevent them from being evaluated as scripts.
+	xssiPrefix = []byte(")]}'")
+
+	// suggestionFields are the object fields providers use for the text of
+	// a suggestion, in order of preference.
+	suggestionFields = []string{"phrase", "suggestion", "value", "text", "term", "query", "title"}
+
+	// suggestionListFields are the object fields providers use for the list
+	// of suggestions, in order of preference.
+	suggestionListFields = []string{"suggestions", "results", "items", "completions", "data"}
+)
+
+// Suggestions are search suggestions in the OpenSearch suggestions format:
+// [query, [completions], [descriptions], [urls]]. Descriptions and urls are
+// optional and only emitted if given for every completion.
+type Suggestions struct {
+	Query        string
+	Completions  []string
+	Descriptions []string
+	URLs         []string
+}
+
+// MarshalJSON ...
+func (s Suggestions) MarshalJSON() ([]byte, error) {
+	completions := s.Completions
+	if completions == nil {
+		completions = []string{}
+	}
+
+	v := []interface{}{s.Query, completions}
+	if len(s.Descriptions) == len(completions) && len(completions) > 0 {
+		v = append(v, s.Descriptions)
+		if len(s.URLs) == len(completions) {
+			v = append(v, s.URLs)
+		}
+	}
+
+	return json.Marshal(v)
+}
+
+// stripJSONP removes JSONP callback wrappers (e.g: cb([...]);) and XSSI
+// prefixes from a response body.
+func stripJSONP(body []byte) []byte {
+	body = bytes.TrimSpace(body)
+	body = bytes.TrimSpace(bytes.TrimPrefix(body, xssiPrefix))
+
+	if len(body) == 0 || body[0] == '[' || body[0] == '{' || body[0] == '"' {
+		return body
+	}
+
+	start := bytes.IndexByte(body, '(')
+	end := bytes.LastIndexByte(body, ')')
+	if start < 0 || end < start {
+		return body
+	}
+
+	return bytes.TrimSpace(body[start+1 : end])
+}
+
+// suggestionText returns the text of a single suggestion which is either a
+// string, an array whose first element is the text (e.g: ["foo", 0]) or an
+// object with a well known text field (e.g: {"phrase": "foo"}).
+func suggestionText(v interface{}) (string, bool) {
+	switch v := v.(type) {
+	case string:
+		return v, true
+	case []interface{}:
+		if len(v) > 0 {
+			return suggestionText(v[0])
+		}
+	case map[string]interface{}:
+		for _, field := range suggestionFields {
+			if s, ok := v[field].(string); ok {
+				return s, true
+			}
+		}
+	}
+	return "", false
+}
+
+func stringList(v interface{}) []string {
+	items, ok := v.([]interface{})
+	if !ok {
+		return nil
+	}
+
+	var list []string
+	for _, item := range items {
+		s, _ := item.(string)
+		list = append(list, s)
+	}
+	return list
+}
+
+func completionList(v interface{}) ([]string, bool) {
+	items, ok := v.([]interface{})
+	if !ok {
+		return nil, false
+	}
+
+	completions := []string{}
+	for _, item := range items {
+		if s, ok := suggestionText(item); ok && s != "" {
+			completions = append(completions, s)
+		}
+	}
+	return completions, true
+}
+
+// NormalizeSuggestions parses a suggestions response from an upstream
+// provider and returns it in the canonical OpenSearch format. Besides the
+// OpenSearch format it understands JSONP wrapped responses, arrays of
+// suggestion objects (e.g: DuckDuckGo's [{"phrase": ...}]) and objects with
+// a list of suggestions (e.g: {"query": ..., "suggestions": [...]}).
+func NormalizeSuggestions(q string, body []byte) (Suggestions, error) {
+	body = stripJSONP(body)
+
+	var v interface{}
+	if err := json.Unmarshal(body, &v); err != nil {
+		return Suggestions{}, ErrSuggestionsInvalidJSON
+	}
+
+	suggestions := Suggestions{Query: q}
+
+	switch v := v.(type) {
+	case []interface{}:
+		// OpenSearch: [query, [completions], [descriptions], [urls]]
+		if len(v) >= 2 {
+			if query, ok := v[0].(string); ok {
+				completions, ok := completionList(v[1])
+				if !ok {
+					return Suggestions{}, ErrSuggestionsUnrecognized
+				}
+				suggestions.Query = query
+				suggestions.Completions = completions
+				if len(v) > 2 && len(completions) == len(stringList(v[1])) {
+					suggestions.Descriptions = stringList(v[2])
+					if len(v) > 3 {
+						suggestions.URLs = stringList(v[3])
+					}
+				}
+				return suggestions, nil
+			}
+		}
+
+		// A bare list of suggestions: ["foo", ...] or [{"phrase": "foo"}, ...]
+		completions, _ := completionList(v)
+		suggestions.Completions = completions
+		return suggestions, nil
+
+	case map[string]interface{}:
+		if query, ok := v["query"].(string); ok {
+			suggestions.Query = query
+		}
+		for _, field := range suggestionListFields {
+			if completions, ok := completionList(v[field]); ok {
+				suggestions.Completions = completions
+				return suggestions, nil
+			}
+		}
+	}
+
+	return Suggestions{}, ErrSuggestionsUnrecognized
+}
+
+// describeSuggestions describes the completions that start with a bookmark
+// with the bookmark's description (or its target if it has none) and links
+// them to where they lead, so browsers that render rich suggestions show
+// it. Other completions keep the description and url of the provider, if
+// any. Suggestions without bookmarks are returned as is.
+func describeSuggestions(suggestions Suggestions) Suggestions {
+	n := len(suggestions.Completions)
+	descriptions, urls := make([]string, n), make([]string, n)
+	if len(suggestions.Descriptions) == n {
+		copy(descriptions, suggestions.Descriptions)
+	}
+	if len(suggestions.URLs) == n {
+		copy(urls, suggestions.URLs)
+	}
+
+	described := false
+	for i, completion := range suggestions.Completions {
+		fields := strings.Fields(completion)
+		if len(fields) == 0 {
+			continue
+		}
+		bookmark, ok := LookupBookmark(fields[0])
+		if !ok {
+			continue
+		}
+
+		target := strings.Replace(bookmark.URL(), "%s", "", -1)
+		if len(fields) > 1 {
+			target = bookmark.Expand(strings.Join(fields[1:], " "))
+		}
+		description := target
+		if val, err := db.Get([]byte(fmt.Sprintf("description_%s", bookmark.Name()))); err == nil && len(val) > 0 {
+			description = string(val)
+		}
+		descriptions[i], urls[i] = description, target
+		described = true
+	}
+
+	if !described {
+		return suggestions
+	}
+	suggestions.Descriptions, suggestions.URLs = descriptions, urls
+	return suggestions
+}
+
+// UpstreamError is returned when suggestions cannot be retrieved from the
+// upstream suggestions service.
+type UpstreamError struct {
+	Message string
+	Details interface{}
+}
+
+func (e *UpstreamError) Error() string {
+	if e.Details != nil {
+		return fmt.Sprintf("%s: %v", e.Message, e.Details)
+	}
+	return e.Message
+}
+
+// fetchSuggestions retrieves and normalizes suggestions for the query from
+// the configured upstream suggestions service.
+func (s *Server) fetchSuggestions(q string) (Suggestions, error) {
+	resp, err := client.Get(fmt.Sprintf(s.settings().SuggestURL, url.QueryEscape(q)))
+	if err != nil {
+		return Suggestions{}, &UpstreamError{"error retrieving suggestions", err.Error()}
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode > 200 {
+		return Suggestions{}, &UpstreamError{
+			"error retrieving suggestions",
+			map[string]int{"upstream_status": resp.StatusCode},
+		}
+	}
+
+	max := s.config.SuggestMaxBytes
+	if max <= 0 {
+		max = DefaultSuggestMaxBytes
+	}
+	tooLarge := &UpstreamError{
+		"suggestions response too large",
+		map[string]int64{"max_bytes": max},
+	}
+
+	if resp.ContentLength > max {
+		return Suggestions{}, tooLarge
+	}
+
+	body, err := ioutil.ReadAll(io.LimitReader(resp.Body, max+1))
+	if err != nil {
+		return Suggestions{}, &UpstreamError{"error reading suggestions", err.Error()}
+	}
+	if int64(len(body)) > max {
+		return Suggestions{}, tooLarge
+	}
+
+	suggestions, err := NormalizeSuggestions(q, body)
+	if err != nil {
+		return Suggestions{}, &UpstreamError{Message: err.Error()}
+	}
+
+	return suggestions, nil
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNormalizeSuggestions(t *testing.T) {
+	assert := assert.New(t)
+
+	testCases := []struct {
+		name     string
+		body     string
+		expected string
+	}{
+		{
+			"opensearch",
+			`["foo",["foo bar","foo baz"]]`,
+			`["foo",["foo bar","foo baz"]]`,
+		},
+		{
+			"opensearch with descriptions and urls",
+			`["foo",["foo bar"],["Foo Bar"],["https://foo.bar"]]`,
+			`["foo",["foo bar"],["Foo Bar"],["https://foo.bar"]]`,
+		},
+		{
+			"mismatched descriptions",
+			`["foo",["foo bar","foo baz"],["Foo Bar"]]`,
+			`["foo",["foo bar","foo baz"]]`,
+		},
+		{
+			"jsonp",
+			`/**/ window.cb && cb(["foo",["foo bar"]]);`,
+			`["foo",["foo bar"]]`,
+		},
+		{
+			"xssi prefix",
+			")]}'\n[\"foo\",[\"foo bar\"]]",
+			`["foo",["foo bar"]]`,
+		},
+		{
+			"nested arrays",
+			`["foo",[["foo bar",0,[512]],["foo baz",0]],{"q":"x"}]`,
+			`["foo",["foo bar","foo baz"]]`,
+		},
+		{
+			"duckduckgo",
+			`[{"phrase":"foo bar"},{"phrase":"foo baz"}]`,
+			`["foo",["foo bar","foo baz"]]`,
+		},
+		{
+			"object",
+			`{"suggestions":[{"value":"foo bar"}],"query":"Foo"}`,
+			`["Foo",["foo bar"]]`,
+		},
+		{
+			"empty",
+			`[]`,
+			`["foo",[]]`,
+		},
+	}
+
+	for _, testCase := range testCases {
+		suggestions, err := NormalizeSuggestions("foo", []byte(testCase.body))
+		assert.NoError(err, testCase.name)
+
+		actual, err := json.Marshal(suggestions)
+		assert.NoError(err, testCase.name)
+		assert.Equal(testCase.expected, string(actual), testCase.name)
+	}
+}
+
+func TestNormalizeSuggestionsErrors(t *testing.T) {
+	assert := assert.New(t)
+
+	_, err := NormalizeSuggestions("foo", []byte(`<html>Not Found</html>`))
+	assert.Equal(ErrSuggestionsInvalidJSON, err)
+
+	_, err = NormalizeSuggestions("foo", []byte(`{"error":"rate limited"}`))
+	assert.Equal(ErrSuggestionsUnrecognized, err)
+
+	_, err = NormalizeSuggestions("foo", []byte(`"foo"`))
+	assert.Equal(ErrSuggestionsUnrecognized, err)
+}
+
+func TestDescribeSuggestions(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir("", "golinks")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	db, err = OpenStore(filepath.Join(dir, "test.db"))
+	assert.NoError(err)
+	defer db.Close()
+
+	assert.NoError(SaveBookmark("gh", "https://github.com/%s"))
+	assert.NoError(SaveBookmark("go", "https://golang.org"))
+	assert.NoError(db.Put([]byte("description_go"), []byte("The Go website")))
+
+	testCases := []struct {
+		name        string
+		suggestions Suggestions
+		expected    string
+	}{
+		{
+			"no bookmarks",
+			Suggestions{Query: "foo", Completions: []string{"foo bar"}},
+			`["foo",["foo bar"]]`,
+		},
+		{
+			"bookmarks",
+			Suggestions{Query: "g", Completions: []string{"go", "gh", "gh golinks", "google"}},
+			`["g",["go","gh","gh golinks","google"],` +
+				`["The Go website","https://github.com/","https://github.com/golinks",""],` +
+				`["https://golang.org","https://github.com/","https://github.com/golinks",""]]`,
+		},
+		{
+			"provider descriptions",
+			Suggestions{
+				Query:        "g",
+				Completions:  []string{"google", "go"},
+				Descriptions: []string{"Search engine", ""},
+				URLs:         []string{"https://www.google.com", ""},
+			},
+			`["g",["google","go"],["Search engine","The Go website"],["https://www.google.com","https://golang.org"]]`,
+		},
+	}
+
+	for _, testCase := range testCases {
+		actual, err := json.Marshal(describeSuggestions(testCase.suggestions))
+		assert.NoError(err, testCase.name)
+		assert.Equal(testCase.expected, string(actual), testCase.name)
+	}
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"sort"
+	"strings"
+
+	"github.com/prologic/bitcask"
+)
+
+// targetIndexVersion marks the target index as built so existing databases
+// are indexed once (and again when the keys are hashed with another key,
+// see targetIndexMarker)
+const targetIndexVersion = "2"
+
+var targetIndexKey = []byte("meta_target_index")
+
+// TargetDomain returns the lowercased host of a bookmark url (or of a bare
+// host), e.g: https://service-x.corp/foo => service-x.corp. Hosts that are
+// templated (contain %s) have no target domain.
+func TargetDomain(s string) string {
+	if i := strings.Index(s, "://"); i >= 0 {
+		s = s[i+3:]
+	}
+	if i := strings.IndexAny(s, "/?#"); i >= 0 {
+		s = s[:i]
+	}
+	if i := strings.LastIndex(s, "@"); i >= 0 {
+		s = s[i+1:]
+	}
+	if i := strings.LastIndex(s, ":"); i >= 0 && !strings.Contains(s[i:], "]") {
+		s = s[:i]
+	}
+	s = strings.Trim(strings.ToLower(s), ".")
+	if s == "" || strings.ContainsAny(s, "% ") {
+		return ""
+	}
+	return s
+}
+
+// parentDomains returns the domain and the domains it is a subdomain of,
+// e.g: api.service-x.corp => api.service-x.corp, service-x.corp, corp
+func parentDomains(domain string) []string {
+	domains := []string{domain}
+	for i := strings.Index(domain, "."); i >= 0; i = strings.Index(domain, ".") {
+		domain = domain[i+1:]
+		domains = append(domains, domain)
+	}
+	return domains
+}
+
+// targetPrefix is the prefix of the keys of the bookmarks pointing at the
+// domain or its subdomains. Domains are hashed (see keyHash) as values may
+// be encrypted.
+func targetPrefix(domain string) string {
+	return "target_" + keyHash(domain) + " "
+}
+
+// targetIndexMarker is the value marking the target index as built, which
+// changes with the key domains are hashed with
+func targetIndexMarker() []byte {
+	return []byte(targetIndexVersion + " " + keyHash(string(targetIndexKey)))
+}
+
+// indexTarget updates the target index for the bookmark name whose url
+// changes from old (empty if new) to url (empty if deleted). Bookmarks are
+// indexed under their domain and its parents so subdomains are found too.
+func indexTarget(name, old, url string) error {
+	from, to := TargetDomain(old), TargetDomain(url)
+	if from == to && old != "" && url != "" {
+		return nil
+	}
+	if from != "" {
+		for _, domain := range parentDomains(from) {
+			if err := db.Delete([]byte(targetPrefix(domain) + name)); err != nil {
+				return err
+			}
+		}
+	}
+	if to != "" {
+		for _, domain := range parentDomains(to) {
+			if err := db.Put([]byte(targetPrefix(domain)+name), nil); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// bookmarkURL returns the url of the bookmark name (not following aliases)
+func bookmarkURL(name string) (string, error) {
+	val, err := db.Get([]byte(fmt.Sprintf("bookmark_%s", name)))
+	if err == bitcask.ErrKeyNotFound {
+		return "", nil
+	}
+	return string(val), err
+}
+
+// FindBookmarksByTarget returns the bookmarks pointing at the domain or any
+// of its subdomains sorted by name
+func FindBookmarksByTarget(target string) ([]Bookmark, error) {
+	domain := TargetDomain(target)
+	if domain == "" {
+		return nil, nil
+	}
+	prefix := targetPrefix(domain)
+
+	var names []string
+	err := db.Scan([]byte(prefix), func(key []byte) error {
+		names = append(names, strings.TrimPrefix(string(key), prefix))
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(names)
+
+	var bookmarks []Bookmark
+	for _, name := range names {
+		url, err := bookmarkURL(name)
+		if err != nil {
+			return nil, err
+		}
+		// Skip stale entries (e.g: bookmarks written around the index)
+		if url == "" || !strings.HasSuffix("."+TargetDomain(url), "."+domain) {
+			continue
+		}
+		bookmarks = append(bookmarks, Bookmark{name: name, url: url})
+	}
+
+	return bookmarks, nil
+}
+
+// EnsureTargetIndex builds the target index for bookmarks saved before it
+// existed (once), or rebuilds it if it was built differently
+func EnsureTargetIndex() error {
+	marker := targetIndexMarker()
+	if val, err := db.Get(targetIndexKey); err == nil && string(val) == string(marker) {
+		return nil
+	}
+
+	var stale [][]byte
+	err := db.Scan([]byte("target_"), func(key []byte) error {
+		stale = append(stale, append([]byte{}, key...))
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	for _, key := range stale {
+		if err := db.Delete(key); err != nil {
+			return err
+		}
+	}
+
+	bookmarks, err := ListBookmarks()
+	if err != nil {
+		return err
+	}
+	for _, bookmark := range bookmarks {
+		if err := indexTarget(bookmark.Name(), "", bookmark.URL()); err != nil {
+			return err
+		}
+	}
+	slog.Info("indexed bookmark targets", "bookmarks", len(bookmarks))
+
+	return db.Put(targetIndexKey, marker)
+}
@@ -0,0 +1,226 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/prologic/bitcask"
+)
+
+// ErrConfiguredMember is returned when removing a member of a team given
+// by -teams, which only the configuration can change
+var ErrConfiguredMember = errors.New("error: member of the team from -teams")
+
+// Team is a team and its members, both from -teams and those added via the
+// admin API
+type Team struct {
+	Name    string   `json:"name"`
+	Members []string `json:"members"`
+}
+
+// teamName normalizes the name of a team, or returns an error if it isn't a
+// valid one
+func teamName(team string) (string, error) {
+	team = strings.ToLower(strings.TrimSpace(team))
+	if team == "" || strings.ContainsAny(team, "/ ") {
+		return "", fmt.Errorf("invalid team name %q", team)
+	}
+	return team, nil
+}
+
+// containsString reports whether s is one of ss
+func containsString(ss []string, s string) bool {
+	for _, v := range ss {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// Memberships are stored twice, under the user to find their teams and
+// under the team to list its members
+func userTeamPrefix(user string) string {
+	return "user/" + url.QueryEscape(user) + "/team_"
+}
+
+func teamMemberPrefix(team string) string {
+	return "team/" + url.QueryEscape(team) + "/member_"
+}
+
+// AddTeamMember makes the user a member of the team
+func AddTeamMember(team, user string) error {
+	if err := db.Put([]byte(userTeamPrefix(user)+team), []byte{}); err != nil {
+		return err
+	}
+	return db.Put([]byte(teamMemberPrefix(team)+url.QueryEscape(user)), []byte{})
+}
+
+// RemoveTeamMember removes the user from the team, reporting whether they
+// were a member
+func RemoveTeamMember(team, user string) (bool, error) {
+	key := []byte(teamMemberPrefix(team) + url.QueryEscape(user))
+	if !db.Has(key) {
+		return false, nil
+	}
+	if err := db.Delete([]byte(userTeamPrefix(user) + team)); err != nil && err != bitcask.ErrKeyNotFound {
+		return true, err
+	}
+	return true, db.Delete(key)
+}
+
+// storedTeams returns the teams the user was made a member of via the admin
+// API
+func storedTeams(user string) ([]string, error) {
+	var teams []string
+	prefix := userTeamPrefix(user)
+	err := db.Scan([]byte(prefix), func(key []byte) error {
+		teams = append(teams, strings.TrimPrefix(string(key), prefix))
+		return nil
+	})
+	sort.Strings(teams)
+	return teams, err
+}
+
+// userTeams returns the teams of the user: those from -teams (in order) and
+// then those added via the admin API
+func (s *Server) userTeams(user string) []string {
+	teams := append([]string(nil), s.teams[user]...)
+	stored, err := storedTeams(user)
+	if err != nil {
+		slog.Error("error listing teams", "user", user, "err", err)
+	}
+	for _, team := range stored {
+		if !containsString(teams, team) {
+			teams = append(teams, team)
+		}
+	}
+	return teams
+}
+
+// teamExists reports whether the team has any members
+func (s *Server) teamExists(team string) bool {
+	for _, teams := range s.teams {
+		if containsString(teams, team) {
+			return true
+		}
+	}
+
+	exists := false
+	err := db.Scan([]byte(teamMemberPrefix(team)), func(key []byte) error {
+		exists = true
+		return errStopScan
+	})
+	if err != nil && err != errStopScan {
+		slog.Error("error looking up team", "team", team, "err", err)
+	}
+	return exists
+}
+
+// ListTeams returns every team with its members, sorted by name
+func (s *Server) ListTeams() ([]Team, error) {
+	members := make(map[string][]string)
+	for user, teams := range s.teams {
+		for _, team := range teams {
+			members[team] = append(members[team], user)
+		}
+	}
+
+	err := db.Scan([]byte("team/"), func(key []byte) error {
+		team, user, found := strings.Cut(strings.TrimPrefix(string(key), "team/"), "/member_")
+		if !found {
+			return nil
+		}
+		if team, err := url.QueryUnescape(team); err == nil {
+			if user, err := url.QueryUnescape(user); err == nil && !containsString(members[team], user) {
+				members[team] = append(members[team], user)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	teams := make([]Team, 0, len(members))
+	for name, users := range members {
+		sort.Strings(users)
+		teams = append(teams, Team{Name: name, Members: users})
+	}
+	sort.Slice(teams, func(i, j int) bool { return teams[i].Name < teams[j].Name })
+	return teams, nil
+}
+
+// TeamsHandler lists the teams and their members
+func (s *Server) TeamsHandler() httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+		teams, err := s.ListTeams()
+		if err != nil {
+			WriteAPIError(w, r, http.StatusInternalServerError, ErrCodeInternal, "error listing teams", nil)
+			return
+		}
+		WriteJSON(w, http.StatusOK, map[string]interface{}{"teams": teams})
+	}
+}
+
+// AddTeamMemberHandler makes a user a member of a team, creating the team
+// if it has no members yet
+func (s *Server) AddTeamMemberHandler() httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		if !s.writable(w, r) {
+			return
+		}
+
+		team, err := teamName(p.ByName("team"))
+		if err != nil {
+			WriteAPIError(w, r, http.StatusBadRequest, ErrCodeBadRequest, err.Error(), nil)
+			return
+		}
+		user := strings.TrimSpace(p.ByName("user"))
+		if user == "" {
+			WriteAPIError(w, r, http.StatusBadRequest, ErrCodeBadRequest, "missing user", nil)
+			return
+		}
+
+		if err := AddTeamMember(team, user); err != nil {
+			WriteAPIError(w, r, http.StatusInternalServerError, ErrCodeInternal, "error adding team member", nil)
+			return
+		}
+		s.counters.Inc("n_team_members_added")
+		audit(r, AuditEntry{Action: AuditTeamMemberAdded, Name: team, Detail: user})
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// RemoveTeamMemberHandler removes a user from a team
+func (s *Server) RemoveTeamMemberHandler() httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		if !s.writable(w, r) {
+			return
+		}
+
+		team, user := strings.ToLower(p.ByName("team")), p.ByName("user")
+		if containsString(s.teams[user], team) {
+			WriteAPIError(w, r, http.StatusConflict, ErrCodeConflict, ErrConfiguredMember.Error(), nil)
+			return
+		}
+
+		ok, err := RemoveTeamMember(team, user)
+		switch {
+		case err != nil:
+			WriteAPIError(w, r, http.StatusInternalServerError, ErrCodeInternal, "error removing team member", nil)
+		case !ok:
+			WriteAPIError(w, r, http.StatusNotFound, ErrCodeNotFound, "no such team member", nil)
+		default:
+			s.counters.Inc("n_team_members_removed")
+			audit(r, AuditEntry{Action: AuditTeamMemberRemoved, Name: team, Detail: user})
+			w.WriteHeader(http.StatusNoContent)
+		}
+	}
+}
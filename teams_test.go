@@ -0,0 +1,98 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTeams(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir("", "golinks")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	db, err = OpenStore(filepath.Join(dir, "test.db"))
+	assert.NoError(err)
+	defer db.Close()
+
+	assert.NoError(SaveBookmark("standup", "https://meet.example.com/all-hands"))
+
+	s, err := NewServer(":8000", Config{
+		AuthHeader: "X-Forwarded-User",
+		MultiUser:  true,
+		Teams:      "alice=infra",
+	})
+	assert.NoError(err)
+
+	_, secret, err := CreateToken("admin", []string{ScopeAdmin})
+	assert.NoError(err)
+
+	do := func(method, user, path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r, _ := http.NewRequest(method, path, nil)
+		r.RemoteAddr = "127.0.0.1:1234"
+		r.Header.Set("X-Forwarded-User", user)
+		if user == "" {
+			r.Header.Set("Authorization", "Bearer "+secret)
+		}
+		s.server.Handler.ServeHTTP(w, r)
+		return w
+	}
+
+	// Members are added (and removed) via the admin API
+	assert.Equal(http.StatusNoContent, do("PUT", "", "/api/v1/admin/teams/Web/members/bob").Code)
+	assert.Equal(http.StatusNoContent, do("PUT", "", "/api/v1/admin/teams/infra/members/bob").Code)
+	assert.Equal(http.StatusBadRequest, do("PUT", "", "/api/v1/admin/teams/a%20b/members/bob").Code)
+
+	w := do("GET", "", "/api/v1/admin/teams")
+	assert.Equal(http.StatusOK, w.Code)
+	var list struct {
+		Teams []Team `json:"teams"`
+	}
+	assert.NoError(json.Unmarshal(w.Body.Bytes(), &list))
+	assert.Equal([]Team{
+		{Name: "infra", Members: []string{"alice", "bob"}},
+		{Name: "web", Members: []string{"bob"}},
+	}, list.Teams)
+
+	// Members share the team's bookmarks, named team/name
+	add := func(user, q string) int {
+		w := httptest.NewRecorder()
+		r := postQuery(url.Values{"q": {q}})
+		r.RemoteAddr = "127.0.0.1:1234"
+		r.Header.Set("X-Forwarded-User", user)
+		s.server.Handler.ServeHTTP(w, r)
+		return w.Code
+	}
+	assert.Equal(http.StatusOK, add("bob", "add infra/standup https://meet.example.com/infra"))
+	assert.False(db.Has([]byte("bookmark_infra/standup")))
+	for _, user := range []string{"alice", "bob"} {
+		w = do("GET", user, "/?q=infra/standup")
+		assert.Equal(http.StatusFound, w.Code, user)
+		assert.Equal("https://meet.example.com/infra", w.Header().Get("Location"), user)
+		w = do("GET", user, "/?q=standup")
+		assert.Equal("https://meet.example.com/infra", w.Header().Get("Location"), user)
+	}
+	w = do("GET", "carol", "/?q=standup")
+	assert.Equal("https://meet.example.com/all-hands", w.Header().Get("Location"))
+	assert.Equal(http.StatusForbidden, add("carol", "add infra/standup https://evil.example.com"))
+
+	// Members from -teams can't be removed via the API
+	assert.Equal(http.StatusConflict, do("DELETE", "", "/api/v1/admin/teams/infra/members/alice").Code)
+	assert.Equal(http.StatusNoContent, do("DELETE", "", "/api/v1/admin/teams/infra/members/bob").Code)
+	assert.Equal(http.StatusNotFound, do("DELETE", "", "/api/v1/admin/teams/infra/members/bob").Code)
+	w = do("GET", "bob", "/?q=standup")
+	assert.Equal("https://meet.example.com/all-hands", w.Header().Get("Location"))
+
+	// Only admins manage teams
+	assert.Equal(http.StatusUnauthorized, do("GET", "bob", "/api/v1/admin/teams").Code)
+}
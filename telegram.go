@@ -0,0 +1,149 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+const (
+	// TelegramAPIURL is the base url of the Telegram Bot API
+	TelegramAPIURL = "https://api.telegram.org"
+
+	// MaxBotResponseBytes is the maximum size of a chat service response
+	MaxBotResponseBytes = 4 << 20
+)
+
+// Telegram is a Telegram bot long-polling for updates with getUpdates. The
+// bot must be added to group chats (with privacy mode disabled, or messages
+// sent as /go) or messaged directly.
+type Telegram struct {
+	baseURL string
+	client  *http.Client
+	offset  int64
+}
+
+// NewTelegram ...
+func NewTelegram(baseURL, token string) *Telegram {
+	return &Telegram{
+		baseURL: fmt.Sprintf("%s/bot%s", strings.TrimRight(baseURL, "/"), token),
+		client:  &http.Client{Timeout: BotPollTimeout + client.Timeout},
+	}
+}
+
+// Name ...
+func (t *Telegram) Name() string {
+	return "telegram"
+}
+
+func (t *Telegram) call(req *http.Request, v interface{}) error {
+	res, err := t.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	data, err := ioutil.ReadAll(io.LimitReader(res.Body, MaxBotResponseBytes))
+	if err != nil {
+		return err
+	}
+
+	// The token is part of the url so only the method is ever reported
+	method := req.URL.Path[strings.LastIndex(req.URL.Path, "/")+1:]
+
+	var result struct {
+		OK          bool            `json:"ok"`
+		Description string          `json:"description"`
+		Result      json.RawMessage `json:"result"`
+	}
+	if err := json.Unmarshal(data, &result); err != nil {
+		return fmt.Errorf("telegram: %s: %s", method, res.Status)
+	}
+	if !result.OK {
+		return fmt.Errorf("telegram: %s: %s", method, result.Description)
+	}
+
+	if v == nil {
+		return nil
+	}
+	return json.Unmarshal(result.Result, v)
+}
+
+// Poll ...
+func (t *Telegram) Poll() ([]BotMessage, error) {
+	params := url.Values{
+		"timeout":         {strconv.Itoa(int(BotPollTimeout.Seconds()))},
+		"offset":          {strconv.FormatInt(t.offset, 10)},
+		"allowed_updates": {`["message"]`},
+	}
+	req, err := http.NewRequest("GET", t.baseURL+"/getUpdates?"+params.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var updates []struct {
+		UpdateID int64 `json:"update_id"`
+		Message  *struct {
+			MessageID int64 `json:"message_id"`
+			From      struct {
+				ID       int64  `json:"id"`
+				Username string `json:"username"`
+			} `json:"from"`
+			Chat struct {
+				ID int64 `json:"id"`
+			} `json:"chat"`
+			Text string `json:"text"`
+		} `json:"message"`
+	}
+	if err := t.call(req, &updates); err != nil {
+		return nil, err
+	}
+
+	var msgs []BotMessage
+	for _, update := range updates {
+		t.offset = update.UpdateID + 1
+		if update.Message == nil || update.Message.Text == "" {
+			continue
+		}
+		msg := BotMessage{
+			ID:   strconv.FormatInt(update.Message.MessageID, 10),
+			Chat: strconv.FormatInt(update.Message.Chat.ID, 10),
+			From: []string{strconv.FormatInt(update.Message.From.ID, 10)},
+			Text: update.Message.Text,
+		}
+		if update.Message.From.Username != "" {
+			msg.From = append(msg.From, update.Message.From.Username)
+		}
+		msgs = append(msgs, msg)
+	}
+
+	return msgs, nil
+}
+
+// Reply ...
+func (t *Telegram) Reply(msg BotMessage, text string) error {
+	id, _ := strconv.ParseInt(msg.ID, 10, 64)
+	data, err := json.Marshal(map[string]interface{}{
+		"chat_id":                  msg.Chat,
+		"text":                     text,
+		"reply_to_message_id":      id,
+		"disable_web_page_preview": true,
+	})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest("POST", t.baseURL+"/sendMessage", bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	return t.call(req, nil)
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTelegram(t *testing.T) {
+	assert := assert.New(t)
+
+	var (
+		offsets []string
+		sent    map[string]interface{}
+	)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/bot123:abc/getUpdates":
+			offsets = append(offsets, r.URL.Query().Get("offset"))
+			w.Write([]byte(`{"ok": true, "result": [
+				{"update_id": 7, "message": {"message_id": 1, "from": {"id": 42, "username": "alice"}, "chat": {"id": -100}, "text": "go gh"}},
+				{"update_id": 8, "message": {"message_id": 2, "from": {"id": 43}, "chat": {"id": -100}}},
+				{"update_id": 9, "edited_message": {}}
+			]}`))
+		case "/bot123:abc/sendMessage":
+			json.NewDecoder(r.Body).Decode(&sent)
+			w.Write([]byte(`{"ok": true, "result": {}}`))
+		default:
+			w.WriteHeader(http.StatusUnauthorized)
+			w.Write([]byte(`{"ok": false, "description": "Unauthorized"}`))
+		}
+	}))
+	defer ts.Close()
+
+	telegram := NewTelegram(ts.URL, "123:abc")
+	msgs, err := telegram.Poll()
+	assert.NoError(err)
+	assert.Equal([]BotMessage{{ID: "1", Chat: "-100", From: []string{"42", "alice"}, Text: "go gh"}}, msgs)
+
+	_, err = telegram.Poll()
+	assert.NoError(err)
+	assert.Equal([]string{"0", "10"}, offsets)
+
+	assert.NoError(telegram.Reply(msgs[0], "https://github.com/"))
+	assert.Equal("-100", sent["chat_id"])
+	assert.Equal(float64(1), sent["reply_to_message_id"])
+	assert.Equal("https://github.com/", sent["text"])
+
+	_, err = NewTelegram(ts.URL, "bad").Poll()
+	assert.EqualError(err, "telegram: getUpdates: Unauthorized")
+}
@@ -5,21 +5,26 @@ import (
 	"fmt"
 	"html/template"
 	"io"
-	"log"
 	"sync"
+
+	rice "github.com/GeertJohan/go.rice"
 )
 
 const OpenSearchTemplate string = `<?xml version="1.0" encoding="UTF-8"?>
 <OpenSearchDescription xmlns="http://a9.com/-/spec/opensearch/1.1/">
-  <ShortName>%s</ShortName>
+  <ShortName>%[1]s</ShortName>
   <Description>Smart bookmarks</Description>
   <Tags>search</Tags>
   <Contact>admin@localhost</Contact>
-  <Url type="text/html" method="get" template="http://%s/?q={searchTerms}"/>
-  <Url type="application/x-suggestions+json" method="get" template="http://%s/suggest?q={searchTerms}"/>
+  <Url type="text/html" method="get" template="%[2]s://%[3]s/?q={searchTerms}"/>
+  <Url type="application/x-suggestions+json" method="get" template="%[2]s://%[3]s/suggest?q={searchTerms}"/>
 </OpenSearchDescription>
 `
 
+// Pages are the pages of the web UI. Each has a template (e.g: list.html)
+// rendered within base.html.
+var Pages = []string{"index", "help", "list", "history", "resolve", "linkrot", "audit", "login", "logout", "confirm", "error"}
+
 type TemplateMap map[string]*template.Template
 
 type Templates struct {
@@ -27,6 +32,10 @@ type Templates struct {
 
 	base      string
 	templates TemplateMap
+
+	// funcs are the functions templates are parsed with, restored after
+	// ExecWith replaces some for a request
+	funcs template.FuncMap
 }
 
 func NewTemplates(base string) *Templates {
@@ -44,21 +53,66 @@ func (t *Templates) Add(name string, template *template.Template) {
 }
 
 func (t *Templates) Exec(name string, ctx interface{}) (io.WriterTo, error) {
+	return t.ExecWith(name, ctx, nil)
+}
+
+// ExecWith executes a template with funcs in place of the functions it was
+// parsed with (e.g: the csrf token of the request) for this time only
+func (t *Templates) ExecWith(name string, ctx interface{}, funcs template.FuncMap) (io.WriterTo, error) {
 	t.Lock()
 	defer t.Unlock()
 
 	template, ok := t.templates[name]
 	if !ok {
-		log.Printf("template %s not found", name)
 		return nil, fmt.Errorf("no such template: %s", name)
 	}
+	if funcs != nil {
+		template.Funcs(funcs)
+		defer template.Funcs(t.funcs)
+	}
 
+	// Rendered into a buffer so callers write nothing of a failed page
 	buf := bytes.NewBuffer([]byte{})
 	err := template.ExecuteTemplate(buf, t.base, ctx)
 	if err != nil {
-		log.Printf("error parsing template %s: %s", name, err)
 		return nil, err
 	}
 
 	return buf, nil
 }
+
+// loadTemplates parses the template of every page and widget from box
+func (s *Server) loadTemplates(box *rice.Box) error {
+	s.templates.funcs = s.funcs()
+	if err := s.loadLayout(box, "base.html", Pages); err != nil {
+		return err
+	}
+	return s.loadLayout(box, "widget.html", Widgets)
+}
+
+// loadLayout parses the template of each of pages within the layout
+func (s *Server) loadLayout(box *rice.Box, layout string, pages []string) error {
+	base, err := box.String(layout)
+	if err != nil {
+		return fmt.Errorf("error loading template %s: %s", layout, err)
+	}
+
+	for _, page := range pages {
+		filename := page + ".html"
+		text, err := box.String(filename)
+		if err != nil {
+			return fmt.Errorf("error loading template %s: %s", filename, err)
+		}
+
+		t := template.New(page).Funcs(s.templates.funcs)
+		if _, err := t.Parse(text); err != nil {
+			return fmt.Errorf("error parsing template %s: %s", filename, err)
+		}
+		if _, err := t.Parse(base); err != nil {
+			return fmt.Errorf("error parsing template %s: %s", layout, err)
+		}
+		s.templates.Add(page, t)
+	}
+
+	return nil
+}
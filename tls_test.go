@@ -0,0 +1,96 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// writeCertificate writes a self-signed certificate for 127.0.0.1 and its
+// key to dir
+func writeCertificate(t *testing.T, dir string) (certFile, keyFile string) {
+	assert := assert.New(t)
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "golinks"},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	assert.NoError(err)
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	assert.NoError(err)
+
+	certFile, keyFile = filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	assert.NoError(ioutil.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0644))
+	assert.NoError(ioutil.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600))
+	return certFile, keyFile
+}
+
+func TestTLS(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir("", "golinks")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	db, err = OpenStore(filepath.Join(dir, "test.db"))
+	assert.NoError(err)
+	defer db.Close()
+
+	assert.NoError(SaveBookmark("gh", "https://github.com/%s"))
+	certFile, keyFile := writeCertificate(t, dir)
+
+	// Pick a free port to serve on
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(err)
+	addr := l.Addr().String()
+	l.Close()
+
+	s, err := NewServer(addr, Config{TLSCert: certFile, TLSKey: keyFile})
+	assert.NoError(err)
+	assert.NoError(s.Listen())
+	defer s.server.Close()
+
+	client := &http.Client{
+		Transport: &http.Transport{
+			TLSClientConfig:   &tls.Config{InsecureSkipVerify: true},
+			ForceAttemptHTTP2: true,
+		},
+		CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse },
+	}
+	res, err := client.Get("https://" + addr + "/?q=gh+prologic")
+	assert.NoError(err)
+	defer res.Body.Close()
+	assert.Equal(http.StatusFound, res.StatusCode)
+	assert.Equal("https://github.com/prologic", res.Header.Get("Location"))
+	assert.Equal(2, res.ProtoMajor)
+	assert.Equal(uint16(tls.VersionTLS13), res.TLS.Version)
+
+	// Outdated versions of TLS are refused
+	_, err = tls.Dial("tcp", addr, &tls.Config{InsecureSkipVerify: true, MaxVersion: tls.VersionTLS11})
+	assert.Error(err)
+
+	_, err = NewServer(":8000", Config{TLSCert: certFile})
+	assert.Error(err)
+	_, err = NewServer(":8000", Config{TLSCert: keyFile, TLSKey: certFile})
+	assert.Error(err)
+}
@@ -0,0 +1,401 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/namsral/flag"
+	"github.com/prologic/bitcask"
+)
+
+// API token scopes. Each scope includes the ones before it, i.e: admin
+// tokens can also write and write tokens can also read.
+const (
+	ScopeRead  = "read"
+	ScopeWrite = "write"
+	ScopeAdmin = "admin"
+)
+
+var scopeLevels = map[string]int{
+	ScopeRead:  1,
+	ScopeWrite: 2,
+	ScopeAdmin: 3,
+}
+
+const (
+	// TokenPrefix prefixes all API tokens so they are easy to recognize
+	TokenPrefix = "glk_"
+
+	// tokenIDLength is the length of the public id of a token
+	tokenIDLength = 12
+)
+
+var (
+	// ErrTokenNotFound is returned when revoking an unknown token
+	ErrTokenNotFound = errors.New("error: token not found")
+
+	// ErrInvalidScope is returned for scopes other than read, write or admin
+	ErrInvalidScope = errors.New("error: invalid scope (expected read, write or admin)")
+)
+
+// Token is an API token. Only a hash of the secret is stored, the first
+// characters of which are the token's public id.
+type Token struct {
+	ID      string    `json:"id"`
+	Name    string    `json:"name"`
+	Scopes  []string  `json:"scopes"`
+	Created time.Time `json:"created"`
+}
+
+// Allows reports whether the token grants the scope
+func (t Token) Allows(scope string) bool {
+	for _, s := range t.Scopes {
+		if scopeLevels[s] >= scopeLevels[scope] {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseScopes parses a comma separated list of scopes
+func ParseScopes(s string) ([]string, error) {
+	var scopes []string
+	seen := make(map[string]bool)
+	for _, scope := range strings.Split(s, ",") {
+		scope = strings.ToLower(strings.TrimSpace(scope))
+		if scope == "" || seen[scope] {
+			continue
+		}
+		if _, ok := scopeLevels[scope]; !ok {
+			return nil, ErrInvalidScope
+		}
+		seen[scope] = true
+		scopes = append(scopes, scope)
+	}
+	if len(scopes) == 0 {
+		return nil, ErrInvalidScope
+	}
+	sort.Strings(scopes)
+	return scopes, nil
+}
+
+func hashToken(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+func tokenKey(hash string) []byte {
+	return []byte(fmt.Sprintf("token_%s", hash))
+}
+
+// CreateToken creates a token and returns it with its secret. The secret
+// can't be recovered later.
+func CreateToken(name string, scopes []string) (token Token, secret string, err error) {
+	b := make([]byte, 32)
+	if _, err = rand.Read(b); err != nil {
+		return
+	}
+	secret = TokenPrefix + hex.EncodeToString(b)
+	hash := hashToken(secret)
+
+	token = Token{
+		ID:      hash[:tokenIDLength],
+		Name:    name,
+		Scopes:  scopes,
+		Created: time.Now().UTC(),
+	}
+	data, err := json.Marshal(token)
+	if err != nil {
+		return
+	}
+	err = db.Put(tokenKey(hash), data)
+	return
+}
+
+// LookupToken returns the token with the given secret (if any)
+func LookupToken(secret string) (Token, bool) {
+	if !strings.HasPrefix(secret, TokenPrefix) {
+		return Token{}, false
+	}
+
+	data, err := db.Get(tokenKey(hashToken(secret)))
+	if err != nil {
+		return Token{}, false
+	}
+	var token Token
+	if err := json.Unmarshal(data, &token); err != nil {
+		return Token{}, false
+	}
+	return token, true
+}
+
+// ListTokens returns all tokens sorted by creation time
+func ListTokens() ([]Token, error) {
+	tokens := []Token{}
+	err := db.Scan([]byte("token_"), func(key []byte) error {
+		data, err := db.Get(key)
+		if err != nil {
+			return err
+		}
+		var token Token
+		if err := json.Unmarshal(data, &token); err != nil {
+			return err
+		}
+		tokens = append(tokens, token)
+		return nil
+	})
+	sort.Slice(tokens, func(i, j int) bool {
+		return tokens[i].Created.Before(tokens[j].Created)
+	})
+	return tokens, err
+}
+
+// RevokeToken deletes the token with the given id
+func RevokeToken(id string) error {
+	if len(id) != tokenIDLength {
+		return ErrTokenNotFound
+	}
+
+	var keys [][]byte
+	err := db.Scan(tokenKey(strings.ToLower(id)), func(key []byte) error {
+		keys = append(keys, key)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if len(keys) == 0 {
+		return ErrTokenNotFound
+	}
+	for _, key := range keys {
+		if err := db.Delete(key); err != nil && err != bitcask.ErrKeyNotFound {
+			return err
+		}
+	}
+	return nil
+}
+
+type tokenContextKey struct{}
+
+// RequestToken returns the API token a request was authenticated with
+func RequestToken(r *http.Request) (Token, bool) {
+	token, ok := r.Context().Value(tokenContextKey{}).(Token)
+	return token, ok
+}
+
+// bearerToken returns the Bearer token of the Authorization header
+func bearerToken(r *http.Request) string {
+	auth := r.Header.Get("Authorization")
+	if len(auth) < 7 || !strings.EqualFold(auth[:7], "bearer ") {
+		return ""
+	}
+	return strings.TrimSpace(auth[7:])
+}
+
+// requireScope only serves requests with a Bearer token granting scope
+func (s *Server) requireScope(scope string, h httprouter.Handle) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		secret := bearerToken(r)
+		if secret == "" {
+			s.counters.Inc("n_api_unauthorized")
+			w.Header().Set("WWW-Authenticate", `Bearer realm="golinks"`)
+			WriteAPIError(w, r, http.StatusUnauthorized, ErrCodeUnauthorized, "missing bearer token", nil)
+			return
+		}
+
+		token, ok := LookupToken(secret)
+		if !ok {
+			s.counters.Inc("n_api_unauthorized")
+			w.Header().Set("WWW-Authenticate", `Bearer realm="golinks", error="invalid_token"`)
+			WriteAPIError(w, r, http.StatusUnauthorized, ErrCodeUnauthorized, "invalid bearer token", nil)
+			return
+		}
+
+		if !token.Allows(scope) {
+			s.counters.Inc("n_api_forbidden")
+			WriteAPIError(
+				w, r, http.StatusForbidden, ErrCodeForbidden,
+				fmt.Sprintf("token does not have the %s scope", scope), nil,
+			)
+			return
+		}
+
+		h(w, r.WithContext(context.WithValue(r.Context(), tokenContextKey{}, token)), p)
+	}
+}
+
+// TokenRequest is the body of a request to create a token
+type TokenRequest struct {
+	Name   string   `json:"name"`
+	Scopes []string `json:"scopes"`
+}
+
+// TokensHandler lists all tokens (without their secrets)
+func (s *Server) TokensHandler() httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+		tokens, err := ListTokens()
+		if err != nil {
+			WriteAPIError(w, r, http.StatusInternalServerError, ErrCodeInternal, "error listing tokens", nil)
+			return
+		}
+		WriteJSON(w, http.StatusOK, map[string]interface{}{"tokens": tokens})
+	}
+}
+
+// CreateTokenHandler creates a token and returns it with its secret
+func (s *Server) CreateTokenHandler() httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+		if !s.writable(w, r) {
+			return
+		}
+
+		var req TokenRequest
+		r.Body = http.MaxBytesReader(w, r.Body, MaxBookmarkRequestBytes)
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			WriteAPIError(w, r, http.StatusBadRequest, ErrCodeBadRequest, "invalid request body", err.Error())
+			return
+		}
+
+		scopes, err := ParseScopes(strings.Join(req.Scopes, ","))
+		if err != nil {
+			WriteAPIError(w, r, http.StatusBadRequest, ErrCodeBadRequest, err.Error(), nil)
+			return
+		}
+
+		token, secret, err := CreateToken(strings.TrimSpace(req.Name), scopes)
+		if err != nil {
+			WriteAPIError(w, r, http.StatusInternalServerError, ErrCodeInternal, "error creating token", nil)
+			return
+		}
+
+		s.counters.Inc("n_tokens_created")
+		audit(r, AuditEntry{Action: AuditTokenCreated, Name: token.ID, Detail: strings.Join(token.Scopes, ",")})
+		WriteJSON(w, http.StatusCreated, map[string]interface{}{
+			"token":  token,
+			"secret": secret,
+		})
+	}
+}
+
+// RevokeTokenHandler revokes the token with the given id
+func (s *Server) RevokeTokenHandler() httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		if !s.writable(w, r) {
+			return
+		}
+
+		switch err := RevokeToken(p.ByName("id")); err {
+		case nil:
+			s.counters.Inc("n_tokens_revoked")
+			audit(r, AuditEntry{Action: AuditTokenRevoked, Name: p.ByName("id")})
+			w.WriteHeader(http.StatusNoContent)
+		case ErrTokenNotFound:
+			WriteAPIError(w, r, http.StatusNotFound, ErrCodeNotFound, "no such token", nil)
+		default:
+			WriteAPIError(w, r, http.StatusInternalServerError, ErrCodeInternal, "error revoking token", nil)
+		}
+	}
+}
+
+// runTokens manages API tokens, e.g:
+//
+//	golinks tokens create -name ci -scopes read,write
+//	golinks tokens list
+//	golinks tokens revoke <id>
+func runTokens(args []string) error {
+	var (
+		dbpath, encryptionKeyFile string
+		name, scopes              string
+	)
+
+	usage := errors.New("usage: golinks tokens create|list|revoke [options]")
+	if len(args) == 0 {
+		return usage
+	}
+
+	fs := flag.NewFlagSet("tokens "+args[0], flag.ExitOnError)
+	fs.StringVar(&dbpath, "dbpath", "search.db", "database path or uri")
+	fs.StringVar(&encryptionKeyFile, "encryption-key-file", "",
+		"file containing the key the database is encrypted with")
+	if args[0] == "create" {
+		fs.StringVar(&name, "name", "", "name describing what the token is for")
+		fs.StringVar(&scopes, "scopes", ScopeRead, "comma separated scopes (read, write or admin)")
+	}
+	if err := fs.Parse(args[1:]); err != nil {
+		return err
+	}
+
+	open := func() error {
+		var err error
+		db, err = OpenDB(dbpath, encryptionKeyFile)
+		return err
+	}
+
+	switch args[0] {
+	case "create":
+		parsed, err := ParseScopes(scopes)
+		if err != nil {
+			return err
+		}
+		if err := open(); err != nil {
+			return err
+		}
+		defer db.Close()
+
+		token, secret, err := CreateToken(name, parsed)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(os.Stderr, "created token %s (%s)\n", token.ID, strings.Join(token.Scopes, ","))
+		fmt.Println(secret)
+	case "list":
+		if err := open(); err != nil {
+			return err
+		}
+		defer db.Close()
+
+		tokens, err := ListTokens()
+		if err != nil {
+			return err
+		}
+		tw := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+		fmt.Fprintln(tw, "ID\tNAME\tSCOPES\tCREATED")
+		for _, token := range tokens {
+			fmt.Fprintf(
+				tw, "%s\t%s\t%s\t%s\n",
+				token.ID, token.Name, strings.Join(token.Scopes, ","),
+				token.Created.Format(time.RFC3339),
+			)
+		}
+		return tw.Flush()
+	case "revoke":
+		if fs.NArg() != 1 {
+			return errors.New("usage: golinks tokens revoke <id>")
+		}
+		if err := open(); err != nil {
+			return err
+		}
+		defer db.Close()
+
+		if err := RevokeToken(fs.Arg(0)); err != nil {
+			return err
+		}
+		fmt.Fprintf(os.Stderr, "revoked token %s\n", fs.Arg(0))
+	default:
+		return usage
+	}
+
+	return nil
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// authorize creates a token with the given scope and authenticates the
+// request with it
+func authorize(r *http.Request, scope string) {
+	_, secret, err := CreateToken("test", []string{scope})
+	if err != nil {
+		panic(err)
+	}
+	r.Header.Set("Authorization", "Bearer "+secret)
+}
+
+func TestParseScopes(t *testing.T) {
+	assert := assert.New(t)
+
+	scopes, err := ParseScopes("write, read,write")
+	assert.NoError(err)
+	assert.Equal([]string{"read", "write"}, scopes)
+
+	_, err = ParseScopes("")
+	assert.Equal(ErrInvalidScope, err)
+
+	_, err = ParseScopes("read,root")
+	assert.Equal(ErrInvalidScope, err)
+
+	assert.True(Token{Scopes: []string{ScopeAdmin}}.Allows(ScopeWrite))
+	assert.True(Token{Scopes: []string{ScopeWrite}}.Allows(ScopeRead))
+	assert.False(Token{Scopes: []string{ScopeWrite}}.Allows(ScopeAdmin))
+	assert.False(Token{}.Allows(ScopeRead))
+}
+
+func TestTokens(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir("", "golinks")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	db, err = OpenStore(filepath.Join(dir, "test.db"))
+	assert.NoError(err)
+	defer db.Close()
+
+	token, secret, err := CreateToken("ci", []string{ScopeRead})
+	assert.NoError(err)
+	assert.True(strings.HasPrefix(secret, TokenPrefix))
+	assert.Len(token.ID, tokenIDLength)
+	assert.False(db.Has(tokenKey(secret)), "secrets are not stored")
+
+	found, ok := LookupToken(secret)
+	assert.True(ok)
+	assert.Equal(token.ID, found.ID)
+	assert.Equal("ci", found.Name)
+
+	_, ok = LookupToken(secret + "x")
+	assert.False(ok)
+	_, ok = LookupToken(token.ID)
+	assert.False(ok)
+
+	tokens, err := ListTokens()
+	assert.NoError(err)
+	assert.Len(tokens, 1)
+
+	assert.Equal(ErrTokenNotFound, RevokeToken("abc"))
+	assert.NoError(RevokeToken(token.ID))
+	assert.Equal(ErrTokenNotFound, RevokeToken(token.ID))
+
+	_, ok = LookupToken(secret)
+	assert.False(ok)
+}
+
+func TestRequireScope(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir("", "golinks")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	db, err = OpenStore(filepath.Join(dir, "test.db"))
+	assert.NoError(err)
+	defer db.Close()
+
+	assert.NoError(SaveBookmark("g", "https://www.google.com/search?q=%s"))
+
+	s, err := NewServer(":8000", Config{})
+	assert.NoError(err)
+
+	do := func(method, path, body, scope string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r, _ := http.NewRequest(method, path, strings.NewReader(body))
+		if scope != "" {
+			authorize(r, scope)
+		}
+		s.router.ServeHTTP(w, r)
+		return w
+	}
+
+	// Redirects stay open
+	w := do("GET", "/?q=g+golinks", "", "")
+	assert.Equal(http.StatusFound, w.Code)
+	w = do("GET", "/api/v1/resolve?name=g", "", "")
+	assert.Equal(http.StatusOK, w.Code)
+
+	w = do("GET", "/api/v1/bookmarks", "", "")
+	assert.Equal(http.StatusUnauthorized, w.Code)
+	assert.Contains(w.Header().Get("WWW-Authenticate"), "Bearer")
+
+	w = httptest.NewRecorder()
+	r, _ := http.NewRequest("GET", "/api/v1/bookmarks", nil)
+	r.Header.Set("Authorization", "Bearer "+TokenPrefix+"bogus")
+	s.router.ServeHTTP(w, r)
+	assert.Equal(http.StatusUnauthorized, w.Code)
+
+	w = do("GET", "/api/v1/bookmarks", "", ScopeRead)
+	assert.Equal(http.StatusOK, w.Code)
+
+	w = do("POST", "/api/v1/bookmarks", `{"name": "gh", "url": "https://github.com/%s"}`, ScopeRead)
+	assert.Equal(http.StatusForbidden, w.Code)
+	w = do("POST", "/api/v1/bookmarks", `{"name": "gh", "url": "https://github.com/%s"}`, ScopeWrite)
+	assert.Equal(http.StatusCreated, w.Code)
+
+	w = do("GET", "/api/v1/tokens", "", ScopeWrite)
+	assert.Equal(http.StatusForbidden, w.Code)
+
+	w = do("POST", "/api/v1/tokens", `{"name": "bot", "scopes": ["write"]}`, ScopeAdmin)
+	assert.Equal(http.StatusCreated, w.Code)
+	var res struct {
+		Token  Token  `json:"token"`
+		Secret string `json:"secret"`
+	}
+	assert.NoError(json.Unmarshal(w.Body.Bytes(), &res))
+	assert.Equal([]string{ScopeWrite}, res.Token.Scopes)
+	_, ok := LookupToken(res.Secret)
+	assert.True(ok)
+
+	w = do("POST", "/api/v1/tokens", `{"name": "bot", "scopes": ["root"]}`, ScopeAdmin)
+	assert.Equal(http.StatusBadRequest, w.Code)
+
+	w = do("GET", "/api/v1/tokens", "", ScopeAdmin)
+	assert.Equal(http.StatusOK, w.Code)
+	assert.NotContains(w.Body.String(), res.Secret)
+
+	w = do("DELETE", "/api/v1/tokens/"+res.Token.ID, "", ScopeAdmin)
+	assert.Equal(http.StatusNoContent, w.Code)
+	_, ok = LookupToken(res.Secret)
+	assert.False(ok)
+
+	w = do("DELETE", "/api/v1/tokens/"+res.Token.ID, "", ScopeAdmin)
+	assert.Equal(http.StatusNotFound, w.Code)
+}
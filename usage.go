@@ -0,0 +1,321 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/prologic/bitcask"
+)
+
+// UsageDateLayout is the layout of the dates of daily usage (in UTC)
+const UsageDateLayout = "2006-01-02"
+
+// usageCursorKey stores the id of the last history entry rolled up
+var usageCursorKey = []byte("meta_usage_cursor")
+
+// DailyUsage is the number of queries made in a day (UTC), per command and
+// bookmark. Queries redirected to the default URL are counted as fallback.
+type DailyUsage struct {
+	Date      string           `json:"date"`
+	Total     int64            `json:"total"`
+	Commands  map[string]int64 `json:"commands"`
+	Bookmarks map[string]int64 `json:"bookmarks"`
+	Fallback  int64            `json:"fallback"`
+}
+
+// RollupResult summarizes a rollup of the history
+type RollupResult struct {
+	Entries int `json:"entries"`
+	Days    int `json:"days"`
+	Pruned  int `json:"pruned"`
+	Purged  int `json:"purged"`
+}
+
+func (r RollupResult) String() string {
+	return fmt.Sprintf(
+		"%d entries rolled up into %d days, %d pruned, %d purged from the trash",
+		r.Entries, r.Days, r.Pruned, r.Purged,
+	)
+}
+
+func usageKey(date string) []byte {
+	return []byte(fmt.Sprintf("usage_%s", date))
+}
+
+// add counts a history entry. Entries with a name and no url are commands.
+func (u *DailyUsage) add(entry HistoryEntry) {
+	u.Total++
+	switch {
+	case entry.Name == "":
+		u.Fallback++
+	case entry.URL == "":
+		u.Commands[entry.Name]++
+	default:
+		u.Bookmarks[entry.Name]++
+	}
+}
+
+// GetDailyUsage returns the usage of a day (empty if there was none)
+func GetDailyUsage(date string) (usage DailyUsage, err error) {
+	usage = DailyUsage{
+		Date:      date,
+		Commands:  make(map[string]int64),
+		Bookmarks: make(map[string]int64),
+	}
+
+	data, err := db.Get(usageKey(date))
+	if err == bitcask.ErrKeyNotFound {
+		return usage, nil
+	}
+	if err != nil {
+		return
+	}
+	err = json.Unmarshal(data, &usage)
+	return
+}
+
+// ListDailyUsage returns the usage of the days from and to (inclusive, in
+// the layout 2006-01-02 and either may be empty) that have been rolled up,
+// oldest first
+func ListDailyUsage(from, to string) ([]DailyUsage, error) {
+	var dates []string
+	err := db.Scan([]byte("usage_"), func(key []byte) error {
+		date := strings.TrimPrefix(string(key), "usage_")
+		if (from == "" || date >= from) && (to == "" || date <= to) {
+			dates = append(dates, date)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(dates)
+
+	days := []DailyUsage{}
+	for _, date := range dates {
+		usage, err := GetDailyUsage(date)
+		if err != nil {
+			return nil, err
+		}
+		days = append(days, usage)
+	}
+	return days, nil
+}
+
+// RollupHistory aggregates the history of the days before now (UTC) that
+// hasn't been rolled up yet into compact daily usage. If retention is
+// positive, history entries older than it that have been rolled up are then
+// deleted.
+func RollupHistory(now time.Time, retention time.Duration) (result RollupResult, err error) {
+	var cursor string
+	if data, err := db.Get(usageCursorKey); err == nil {
+		cursor = string(data)
+	}
+
+	// Only whole days are rolled up so each day is only written once
+	end := fmt.Sprintf("%020d", now.UTC().Truncate(24*time.Hour).UnixNano())
+
+	var ids []string
+	err = db.Scan([]byte("history_"), func(key []byte) error {
+		id := strings.TrimPrefix(string(key), "history_")
+		if id >= end {
+			return errStopScan
+		}
+		if id > cursor {
+			ids = append(ids, id)
+		}
+		return nil
+	})
+	if err != nil && err != errStopScan {
+		return
+	}
+	err = nil
+
+	days := make(map[string]*DailyUsage)
+	for _, id := range ids {
+		var val []byte
+		if val, err = db.Get(historyKey(id)); err != nil {
+			return
+		}
+		entry := decodeHistoryEntry(id, val)
+		if entry.Time.IsZero() {
+			if n, err := strconv.ParseInt(id, 10, 64); err == nil {
+				entry.Time = time.Unix(0, n)
+			}
+		}
+
+		date := entry.Time.UTC().Format(UsageDateLayout)
+		usage, ok := days[date]
+		if !ok {
+			day, err := GetDailyUsage(date)
+			if err != nil {
+				return result, err
+			}
+			usage = &day
+			days[date] = usage
+		}
+		usage.add(entry)
+		result.Entries++
+	}
+
+	for date, usage := range days {
+		var data []byte
+		if data, err = json.Marshal(usage); err != nil {
+			return
+		}
+		if err = db.Put(usageKey(date), data); err != nil {
+			return
+		}
+		result.Days++
+	}
+	if len(ids) > 0 {
+		cursor = ids[len(ids)-1]
+		if err = db.Put(usageCursorKey, []byte(cursor)); err != nil {
+			return
+		}
+	}
+
+	if retention <= 0 || cursor == "" {
+		return
+	}
+
+	prune := fmt.Sprintf("%020d", now.Add(-retention).UnixNano())
+	var keys [][]byte
+	err = db.Scan([]byte("history_"), func(key []byte) error {
+		id := strings.TrimPrefix(string(key), "history_")
+		if id > cursor || id >= prune {
+			return errStopScan
+		}
+		keys = append(keys, key)
+		return nil
+	})
+	if err != nil && err != errStopScan {
+		return
+	}
+	err = nil
+	for _, key := range keys {
+		if err = db.Delete(key); err != nil {
+			return
+		}
+		result.Pruned++
+	}
+
+	return
+}
+
+// UsageRollup periodically rolls up the history into daily usage
+// and purges cleared history that has expired
+type UsageRollup struct {
+	retention time.Duration
+	trashTTL  time.Duration
+	counters  *Counters
+}
+
+// NewUsageRollup ...
+func NewUsageRollup(retention, trashTTL time.Duration, counters *Counters) *UsageRollup {
+	return &UsageRollup{retention: retention, trashTTL: trashTTL, counters: counters}
+}
+
+// Rollup rolls up the history of the days before today
+func (u *UsageRollup) Rollup() (RollupResult, error) {
+	now := time.Now()
+	result, err := RollupHistory(now, u.retention)
+	if err == nil {
+		result.Purged, err = PurgeHistoryTrash(now, u.trashTTL)
+	}
+	if err != nil {
+		u.counters.Inc("n_rollup_failed")
+		return result, err
+	}
+	u.counters.Inc("n_rollup")
+	u.counters.IncBy("n_history_pruned", int64(result.Pruned))
+	u.counters.IncBy("n_history_purged", int64(result.Purged))
+	return result, nil
+}
+
+// Run rolls up the history now and then every interval until ctx is
+// cancelled
+func (u *UsageRollup) Run(ctx context.Context, interval time.Duration) {
+	for {
+		result, err := u.Rollup()
+		if err != nil {
+			slog.Error("error rolling up history", "err", err)
+		} else if result.Entries > 0 || result.Pruned > 0 || result.Purged > 0 {
+			slog.Info("rolled up history", "result", result)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(interval):
+		}
+	}
+}
+
+// UsageHandler returns the daily usage of commands and bookmarks as JSON
+// or CSV (see negotiateFormat), e.g: /api/v1/usage?from=2024-01-01&to=2024-01-31
+func (s *Server) UsageHandler() httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+		s.counters.Inc("n_api_usage")
+
+		from, to := r.URL.Query().Get("from"), r.URL.Query().Get("to")
+		for _, date := range []string{from, to} {
+			if _, err := time.Parse(UsageDateLayout, date); date != "" && err != nil {
+				WriteAPIError(
+					w, r, http.StatusBadRequest, ErrCodeBadRequest,
+					fmt.Sprintf("invalid date %q (expected YYYY-MM-DD)", date), nil,
+				)
+				return
+			}
+		}
+
+		w.Header().Set("Vary", "Accept")
+		format, err := negotiateFormat(r)
+		if err != nil {
+			WriteAPIError(w, r, http.StatusBadRequest, ErrCodeBadRequest, err.Error(), nil)
+			return
+		}
+
+		days, err := ListDailyUsage(from, to)
+		if err != nil {
+			WriteAPIError(w, r, http.StatusInternalServerError, ErrCodeInternal, "error reading usage", err.Error())
+			return
+		}
+
+		if format != FormatCSV {
+			WriteJSON(w, http.StatusOK, map[string]interface{}{"days": days})
+			return
+		}
+
+		var rows [][]string
+		row := func(date, kind, name string, n int64) {
+			rows = append(rows, []string{date, kind, name, strconv.FormatInt(n, 10)})
+		}
+		sorted := func(counts map[string]int64) (names []string) {
+			for name := range counts {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+			return
+		}
+		for _, day := range days {
+			row(day.Date, "total", "", day.Total)
+			for _, name := range sorted(day.Commands) {
+				row(day.Date, "command", name, day.Commands[name])
+			}
+			for _, name := range sorted(day.Bookmarks) {
+				row(day.Date, "bookmark", name, day.Bookmarks[name])
+			}
+			row(day.Date, "fallback", "", day.Fallback)
+		}
+		writeCSV(w, []string{"date", "kind", "name", "count"}, rows)
+	}
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// resetHistoryIDs allows adding history in the past (ids always increase)
+func resetHistoryIDs() {
+	historyMu.Lock()
+	defer historyMu.Unlock()
+	lastHistoryID = 0
+}
+
+func TestRollupHistory(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir("", "golinks")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	db, err = OpenStore(filepath.Join(dir, "test.db"))
+	assert.NoError(err)
+	defer db.Close()
+	resetHistoryIDs()
+
+	day1 := time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC)
+	day2 := day1.Add(24 * time.Hour)
+	for _, entry := range []HistoryEntry{
+		{Time: day1, Query: "gh golinks", Name: "gh", URL: "https://github.com/golinks"},
+		{Time: day1.Add(time.Hour), Query: "gh", Name: "gh", URL: "https://github.com"},
+		{Time: day1.Add(2 * time.Hour), Query: "help", Name: "help"},
+		{Time: day2, Query: "unknown", URL: "https://www.google.com/search?q=unknown"},
+	} {
+		_, err := AddHistory(entry)
+		assert.NoError(err)
+	}
+
+	// Only the days before now are rolled up
+	result, err := RollupHistory(day2.Add(time.Hour), 0)
+	assert.NoError(err)
+	assert.Equal(RollupResult{Entries: 3, Days: 1}, result)
+
+	usage, err := GetDailyUsage("2024-03-01")
+	assert.NoError(err)
+	assert.Equal(DailyUsage{
+		Date:      "2024-03-01",
+		Total:     3,
+		Commands:  map[string]int64{"help": 1},
+		Bookmarks: map[string]int64{"gh": 2},
+	}, usage)
+
+	// Entries are only rolled up once
+	result, err = RollupHistory(day2.Add(time.Hour), 0)
+	assert.NoError(err)
+	assert.Equal(RollupResult{}, result)
+
+	_, err = AddHistory(HistoryEntry{Time: day2.Add(time.Hour), Query: "help", Name: "help"})
+	assert.NoError(err)
+
+	// History older than the retention is deleted once rolled up
+	result, err = RollupHistory(day2.Add(24*time.Hour), 36*time.Hour)
+	assert.NoError(err)
+	assert.Equal(RollupResult{Entries: 2, Days: 1, Pruned: 3}, result)
+
+	page, err := ListHistory("", 10)
+	assert.NoError(err)
+	assert.Len(page.Entries, 2)
+
+	days, err := ListDailyUsage("2024-03-02", "")
+	assert.NoError(err)
+	assert.Len(days, 1)
+	assert.Equal(int64(2), days[0].Total)
+	assert.Equal(int64(1), days[0].Fallback)
+
+	days, err = ListDailyUsage("", "")
+	assert.NoError(err)
+	assert.Len(days, 2)
+	assert.Equal("2024-03-01", days[0].Date)
+}
+
+func TestUsageHandler(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir("", "golinks")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	db, err = OpenStore(filepath.Join(dir, "test.db"))
+	assert.NoError(err)
+	defer db.Close()
+	resetHistoryIDs()
+
+	day := time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC)
+	for _, entry := range []HistoryEntry{
+		{Time: day, Query: "gh", Name: "gh", URL: "https://github.com"},
+		{Time: day, Query: "help", Name: "help"},
+	} {
+		_, err := AddHistory(entry)
+		assert.NoError(err)
+	}
+	_, err = RollupHistory(day.Add(24*time.Hour), 0)
+	assert.NoError(err)
+
+	s, err := NewServer(":8000", Config{})
+	assert.NoError(err)
+
+	get := func(path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r, _ := http.NewRequest("GET", path, nil)
+		authorize(r, ScopeRead)
+		s.router.ServeHTTP(w, r)
+		return w
+	}
+
+	w := get("/api/v1/usage?from=2024-03-01")
+	assert.Equal(http.StatusOK, w.Code)
+	var res struct {
+		Days []DailyUsage `json:"days"`
+	}
+	assert.NoError(json.Unmarshal(w.Body.Bytes(), &res))
+	assert.Len(res.Days, 1)
+	assert.Equal(int64(1), res.Days[0].Bookmarks["gh"])
+
+	w = get("/api/v1/usage?to=2024-02-29")
+	assert.JSONEq(`{"days": []}`, w.Body.String())
+
+	w = get("/api/v1/usage?format=csv")
+	assert.Equal(http.StatusOK, w.Code)
+	records, err := csv.NewReader(w.Body).ReadAll()
+	assert.NoError(err)
+	assert.Equal([][]string{
+		{"date", "kind", "name", "count"},
+		{"2024-03-01", "total", "", "2"},
+		{"2024-03-01", "command", "help", "1"},
+		{"2024-03-01", "bookmark", "gh", "1"},
+		{"2024-03-01", "fallback", "", "0"},
+	}, records)
+
+	w = get("/api/v1/usage?from=March")
+	assert.Equal(http.StatusBadRequest, w.Code)
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"time"
+)
+
+// StaticAssets are the static assets served by the web UI or used by
+// builtin features
+var StaticAssets = []string{"favicon.ico", "apple-touch-icon.png", dictionaryFile}
+
+// samplePages returns representative data to render each page with
+func samplePages(bookmarks []Bookmark) map[string]interface{} {
+	since := time.Now().Add(-DefaultLinkRotAfter)
+	return map[string]interface{}{
+		"index": nil,
+		"help":  map[string]interface{}{"Writable": true},
+		"list": map[string]interface{}{
+			"Bookmarks": bookmarks,
+			"Commands":  SortedCommands(),
+		},
+		"history": map[string]interface{}{
+			"Entries":  []HistoryEntry{{ID: "0", Time: time.Now(), Query: "g golinks", URL: "https://www.google.com/search?q=golinks"}},
+			"Next":     "0",
+			"Limit":    DefaultHistoryPageSize,
+			"Live":     true,
+			"Writable": true,
+			"Saved":    "golinks",
+		},
+		"resolve": ResolveTrace{
+			Query: "g golinks",
+			Steps: []ResolveStep{{Step: "bookmark", Detail: "g is a bookmark", Match: true}},
+			Kind:  ResolvedBookmark,
+			URL:   "https://www.google.com/search?q=golinks",
+		},
+		"linkrot": map[string]interface{}{
+			"Rotten": []LinkStatus{{
+				Name: "g", URL: "https://www.google.com/search?q=%s", Status: 404,
+				Checked: time.Now(), BrokenSince: &since,
+				Archive: "https://web.archive.org/web/20240101000000/https://www.google.com/search?q=%s",
+			}},
+			"Archived": []ArchivedLink{{
+				Name: "g", URL: "https://www.google.com/search?q=%s",
+				Archive:  "https://web.archive.org/web/20240101000000/https://www.google.com/search?q=%s",
+				Archived: time.Now(),
+			}},
+			"Days":     7,
+			"Writable": true,
+			"Saved":    "g",
+		},
+		"audit": map[string]interface{}{
+			"Entries": []AuditEntry{{
+				ID: "0", Time: time.Now(), User: "alice", Action: EventBookmarkUpdated,
+				Name: "g", URL: "https://duckduckgo.com/?q=%s", OldURL: "https://www.google.com/search?q=%s",
+			}},
+			"Next":  "0",
+			"Limit": DefaultAuditPageSize,
+		},
+		"login": map[string]interface{}{
+			"Next":  "/?q=g+golinks",
+			"User":  "alice",
+			"Error": "Invalid user or password",
+		},
+		"logout": nil,
+		"confirm": map[string]interface{}{
+			"Query": "save",
+			"URL":   "https://go.dev/blog",
+			"Title": "The Go Blog",
+		},
+		"error": map[string]interface{}{
+			"RequestID": "0",
+		},
+		"widget_search": map[string]interface{}{
+			"Placeholder": "Search",
+		},
+		"widget_top": map[string]interface{}{
+			"Links": []WidgetLink{{Name: "g", URL: "https://www.google.com/search?q=%s", Hits: 1}},
+		},
+	}
+}
+
+// renderPages renders every page and widget with the given data and
+// returns how many were rendered
+func (s *Server) renderPages(pages map[string]interface{}) (int, error) {
+	names := append(append([]string{}, Pages...), Widgets...)
+	for i, name := range names {
+		buf, err := s.templates.Exec(name, pages[name])
+		if err != nil {
+			return i, fmt.Errorf("error rendering template %s: %s", name, err)
+		}
+		buf.WriteTo(ioutil.Discard)
+	}
+	return len(names), nil
+}
+
+// VerifyAssets verifies the templates of every page (embedded in release
+// binaries) parse and render in every mode and that all static assets are
+// present, so a broken template never ships
+func VerifyAssets() error {
+	sample := []Bookmark{{name: "g", url: "https://www.google.com/search?q=%s"}}
+
+	for _, config := range []Config{{}, {Offline: true, DisableHistory: true}} {
+		s, err := NewServer(":0", config)
+		if err != nil {
+			return err
+		}
+		if _, err := s.renderPages(samplePages(sample)); err != nil {
+			return err
+		}
+
+		for _, name := range StaticAssets {
+			data, err := s.assets.Bytes(name)
+			if err != nil {
+				return fmt.Errorf("error loading static asset %s: %s", name, err)
+			}
+			if len(data) == 0 {
+				return fmt.Errorf("static asset %s is empty", name)
+			}
+		}
+	}
+
+	return nil
+}
+
+// runVerifyAssets verifies the assets embedded in the binary, e.g:
+//
+//	golinks verify-assets
+func runVerifyAssets(args []string) error {
+	if len(args) > 0 {
+		return errors.New("usage: golinks verify-assets")
+	}
+	if err := VerifyAssets(); err != nil {
+		return err
+	}
+	fmt.Printf("verified %d templates and %d static assets\n", len(Pages)+len(Widgets), len(StaticAssets))
+	return nil
+}
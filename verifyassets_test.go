@@ -0,0 +1,66 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	rice "github.com/GeertJohan/go.rice"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestVerifyAssets(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.NoError(VerifyAssets())
+	assert.NoError(runVerifyAssets(nil))
+	assert.Error(runVerifyAssets([]string{"extra"}))
+}
+
+func TestLoadTemplates(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir("", "golinks")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	s, err := NewServer(":8000", Config{})
+	assert.NoError(err)
+
+	write := func(name, text string) {
+		assert.NoError(ioutil.WriteFile(filepath.Join(dir, name), []byte(text), 0644))
+	}
+	load := func() error {
+		// Boxes can't be found by absolute path
+		cwd, err := os.Getwd()
+		assert.NoError(err)
+		rel, err := filepath.Rel(cwd, dir)
+		assert.NoError(err)
+		config := &rice.Config{LocateOrder: []rice.LocateMethod{rice.LocateWorkingDirectory}}
+		box, err := config.FindBox(rel)
+		assert.NoError(err)
+		return s.loadTemplates(box)
+	}
+
+	write("base.html", `{{define "base"}}{{template "content" .}}{{end}}`)
+	write("widget.html", `{{define "base"}}{{template "content" .}}{{end}}`)
+	for _, page := range append(append([]string{}, Pages...), Widgets...) {
+		write(page+".html", `{{define "content"}}`+page+`{{end}}`)
+	}
+	assert.NoError(load())
+
+	assert.NoError(os.Remove(filepath.Join(dir, "widget.html")))
+	err = load()
+	assert.Error(err)
+	assert.Contains(err.Error(), "error loading template widget.html")
+	write("widget.html", `{{define "base"}}{{template "content" .}}{{end}}`)
+
+	write("list.html", `{{define "content"}}{{ range .Bookmarks }}{{end}}`)
+	assert.EqualError(load(), "error parsing template list.html: template: list:1: unexpected EOF")
+
+	assert.NoError(os.Remove(filepath.Join(dir, "list.html")))
+	err = load()
+	assert.Error(err)
+	assert.Contains(err.Error(), "error loading template list.html")
+}
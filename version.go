@@ -2,6 +2,11 @@ package main
 
 import (
 	"fmt"
+	"net/http"
+	"runtime"
+	"sort"
+
+	"github.com/julienschmidt/httprouter"
 )
 
 var (
@@ -13,9 +18,72 @@ var (
 
 	// Commit will be overwritten automatically by the build system
 	Commit = "HEAD"
+
+	// BuildDate will be overwritten automatically by the build system
+	BuildDate = ""
 )
 
 // FullVersion display the full version and build
 func FullVersion() string {
 	return fmt.Sprintf("%s-%s@%s", Package, Version, Commit)
 }
+
+// VersionInfo is the version and build of a running server
+type VersionInfo struct {
+	Version   string   `json:"version"`
+	Commit    string   `json:"commit"`
+	BuildDate string   `json:"build_date,omitempty"`
+	GoVersion string   `json:"go_version"`
+	Features  []string `json:"features"`
+}
+
+// Features returns the names of the optional features enabled by the
+// configuration of the server, sorted
+func (s *Server) Features() []string {
+	enabled := map[string]bool{
+		"readonly":     s.config.ReadOnly,
+		"offline":      s.config.Offline,
+		"history":      !s.config.DisableHistory,
+		"peers":        len(s.config.Peers) > 0,
+		"catalog":      s.config.Catalog != "",
+		"webhooks":     len(s.config.Webhooks) > 0,
+		"event_bus":    s.config.EventBus != "",
+		"raindrop":     s.config.RaindropToken != "",
+		"xbrowsersync": s.config.XBrowserSyncID != "",
+		"read_later":   s.config.ReadLater != "",
+		"telegram":     s.config.TelegramToken != "",
+		"matrix":       s.config.MatrixURL != "" && s.config.MatrixToken != "",
+		"git":          s.config.GitRepo != "",
+		"grpc":         s.config.GRPCBind != "",
+		"dictionary":   s.config.Dictionary != "",
+		"backup":       s.config.BackupURL != "",
+		"replication":  s.config.ReplicateTo != "",
+		"email":        s.config.EmailSecret != "",
+		"publish":      s.config.PublishTag != "",
+	}
+
+	features := []string{}
+	for feature, ok := range enabled {
+		if ok {
+			features = append(features, feature)
+		}
+	}
+	sort.Strings(features)
+	return features
+}
+
+// VersionHandler returns the version and build of the server along with
+// the features it has enabled, e.g: for monitoring a fleet of instances
+func (s *Server) VersionHandler() httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+		s.counters.Inc("n_api_version")
+
+		WriteJSON(w, http.StatusOK, VersionInfo{
+			Version:   Version,
+			Commit:    Commit,
+			BuildDate: BuildDate,
+			GoVersion: runtime.Version(),
+			Features:  s.Features(),
+		})
+	}
+}
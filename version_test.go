@@ -0,0 +1,53 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestVersionHandler(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir("", "golinks")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	db, err = OpenStore(filepath.Join(dir, "test.db"))
+	assert.NoError(err)
+	defer db.Close()
+
+	config := Config{
+		Title:          "Search",
+		ReadOnly:       true,
+		DisableHistory: true,
+		Peers:          []string{"http://peer.corp"},
+		EmailSecret:    "secret",
+
+		// Always set by main, without syncing unless an id is given
+		XBrowserSyncURL: XBrowserSyncURL,
+	}
+	s, err := NewServer(":8000", config)
+	assert.NoError(err)
+
+	// Served without a token
+	w := httptest.NewRecorder()
+	r, _ := http.NewRequest("GET", "/api/v1/version", nil)
+	s.router.ServeHTTP(w, r)
+	assert.Equal(http.StatusOK, w.Code)
+
+	var info VersionInfo
+	assert.NoError(json.Unmarshal(w.Body.Bytes(), &info))
+	assert.Equal(Version, info.Version)
+	assert.Equal(Commit, info.Commit)
+	assert.Equal(runtime.Version(), info.GoVersion)
+	assert.Equal([]string{"email", "peers", "readonly"}, info.Features)
+	assert.Equal(int64(1), count(s.counters, "n_api_version"))
+}
@@ -0,0 +1,307 @@
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log/slog"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// WebhookQueueSize is the maximum number of pending webhook events
+	WebhookQueueSize = 1024
+
+	// WebhookMaxAttempts is how many times an event is sent to a webhook
+	// before giving up on it
+	WebhookMaxAttempts = 5
+
+	// SignatureHeader is the hex encoded HMAC-SHA256 of the body of webhook
+	// requests, keyed with the webhook secret
+	SignatureHeader = "X-Golinks-Signature"
+
+	// EventHeader is the type of event of webhook requests
+	EventHeader = "X-Golinks-Event"
+)
+
+// Types of events
+const (
+	EventBookmarkCreated = "bookmark.created"
+	EventBookmarkUpdated = "bookmark.updated"
+	EventBookmarkDeleted = "bookmark.deleted"
+	EventRedirect        = "redirect"
+	EventHistory         = "history"
+	EventAliasLearned    = "alias.learned"
+)
+
+// Event is something that happened to a bookmark, a redirect, a history
+// entry (with the ID of the entry) or a learned alias (with the misspelling
+// as the query)
+type Event struct {
+	ID     string    `json:"id,omitempty"`
+	Type   string    `json:"type"`
+	Time   time.Time `json:"time"`
+	Name   string    `json:"name"`
+	URL    string    `json:"url,omitempty"`
+	OldURL string    `json:"old_url,omitempty"`
+	Query  string    `json:"query,omitempty"`
+	User   string    `json:"user,omitempty"`
+}
+
+// EventsStore wraps a Store and publishes an event for every bookmark
+// created, updated or deleted, however it was changed
+type EventsStore struct {
+	Store
+
+	publish func(Event)
+}
+
+// NewEventsStore ...
+func NewEventsStore(store Store, publish func(Event)) *EventsStore {
+	return &EventsStore{Store: store, publish: publish}
+}
+
+// Unwrap returns the wrapped store
+func (s *EventsStore) Unwrap() Store {
+	return s.Store
+}
+
+func (s *EventsStore) old(key []byte) (string, bool) {
+	if !strings.HasPrefix(string(key), "bookmark_") {
+		return "", false
+	}
+	old, err := s.Store.Get(key)
+	if err != nil {
+		return "", true
+	}
+	return string(old), true
+}
+
+// Put ...
+func (s *EventsStore) Put(key, value []byte) error {
+	old, ok := s.old(key)
+	if err := s.Store.Put(key, value); err != nil {
+		return err
+	}
+	if !ok || old == string(value) {
+		return nil
+	}
+
+	event := Event{
+		Type:   EventBookmarkUpdated,
+		Time:   time.Now(),
+		Name:   strings.TrimPrefix(string(key), "bookmark_"),
+		URL:    string(value),
+		OldURL: old,
+	}
+	if old == "" {
+		event.Type = EventBookmarkCreated
+	}
+	s.publish(event)
+	return nil
+}
+
+// Delete ...
+func (s *EventsStore) Delete(key []byte) error {
+	old, ok := s.old(key)
+	if err := s.Store.Delete(key); err != nil {
+		return err
+	}
+	if ok && old != "" {
+		s.publish(Event{
+			Type:   EventBookmarkDeleted,
+			Time:   time.Now(),
+			Name:   strings.TrimPrefix(string(key), "bookmark_"),
+			OldURL: old,
+		})
+	}
+	return nil
+}
+
+// ParseWebhooks parses a comma separated list of webhook urls
+func ParseWebhooks(s string) ([]string, error) {
+	var urls []string
+	for _, u := range strings.Split(s, ",") {
+		u = strings.TrimSpace(u)
+		if u == "" {
+			continue
+		}
+		if !isURL(u) {
+			return nil, fmt.Errorf("invalid webhook url %q", u)
+		}
+		urls = append(urls, u)
+	}
+	return urls, nil
+}
+
+// SignWebhook returns the signature of a webhook request body
+func SignWebhook(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Webhooks POST events as JSON to a list of urls in the background. Each
+// event is retried with backoff up to WebhookMaxAttempts times per url. If
+// the queue fills up (e.g: a webhook is down) events are dropped and
+// counted, so webhooks never block or fail writes or redirects.
+type Webhooks struct {
+	urls     []string
+	secret   string
+	hits     bool
+	counters *Counters
+	client   *http.Client
+
+	retryDelay time.Duration
+
+	queue chan Event
+	done  chan struct{}
+	wg    sync.WaitGroup
+}
+
+// NewWebhooks ... Redirects are only sent if hits is true.
+func NewWebhooks(urls []string, secret string, hits bool, counters *Counters) *Webhooks {
+	return &Webhooks{
+		urls:     urls,
+		secret:   secret,
+		hits:     hits,
+		counters: counters,
+		client:   &http.Client{Timeout: 10 * time.Second, Transport: client.Transport},
+
+		retryDelay: time.Second,
+
+		queue: make(chan Event, WebhookQueueSize),
+		done:  make(chan struct{}),
+	}
+}
+
+// Publish queues an event for the webhooks without blocking. History
+// entries are not sent (redirects are, with hits).
+func (h *Webhooks) Publish(event Event) {
+	if event.Type == EventHistory || (event.Type == EventRedirect && !h.hits) {
+		return
+	}
+
+	select {
+	case h.queue <- event:
+		h.counters.Inc("n_webhook_queued")
+	default:
+		h.counters.Inc("n_webhook_dropped")
+		slog.Warn("webhook queue full, dropping event", "type", event.Type, "name", event.Name)
+	}
+}
+
+func (h *Webhooks) send(url string, event Event, body []byte) error {
+	req, err := http.NewRequest("POST", url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(EventHeader, event.Type)
+	if h.secret != "" {
+		req.Header.Set(SignatureHeader, SignWebhook(h.secret, body))
+	}
+
+	res, err := h.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	io.Copy(ioutil.Discard, res.Body)
+
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return fmt.Errorf("webhook responded with %s", res.Status)
+	}
+	return nil
+}
+
+// deliver sends the event to every url, retrying each with exponential
+// backoff until it succeeds, runs out of attempts or webhooks are stopped
+func (h *Webhooks) deliver(event Event) {
+	body, err := json.Marshal(event)
+	if err != nil {
+		slog.Error("error encoding webhook event", "err", err)
+		return
+	}
+
+	for _, url := range h.urls {
+		delay := h.retryDelay
+		for attempt := 1; ; attempt++ {
+			err := h.send(url, event, body)
+			if err == nil {
+				h.counters.Inc("n_webhook_sent")
+				break
+			}
+
+			h.counters.Inc("n_webhook_failed")
+			if attempt == WebhookMaxAttempts {
+				h.counters.Inc("n_webhook_dropped")
+				slog.Error("error sending to webhook (giving up)", "type", event.Type, "url", url, "err", err)
+				break
+			}
+			slog.Warn("error sending to webhook", "type", event.Type, "url", url, "err", err, "retry_in", delay)
+
+			select {
+			case <-h.done:
+				h.counters.Inc("n_webhook_dropped")
+				return
+			case <-time.After(delay):
+			}
+			delay *= 2
+		}
+	}
+}
+
+// Start starts sending queued events in the background
+func (h *Webhooks) Start() {
+	h.wg.Add(1)
+	go h.run()
+}
+
+func (h *Webhooks) run() {
+	defer h.wg.Done()
+
+	for {
+		select {
+		case event := <-h.queue:
+			h.deliver(event)
+		case <-h.done:
+			return
+		}
+	}
+}
+
+// Stop stops sending events. Pending events are dropped.
+func (h *Webhooks) Stop() {
+	close(h.done)
+	h.wg.Wait()
+	h.counters.IncBy("n_webhook_dropped", int64(len(h.queue)))
+}
+
+// publish publishes an event to /events streams, the webhooks and the
+// event bus (if any)
+func (s *Server) publish(event Event) {
+	if s.learner != nil {
+		s.learner.Changed(event)
+	}
+	s.broker.Publish(event)
+	if s.webhooks != nil {
+		s.webhooks.Publish(event)
+	}
+	if s.eventBus != nil {
+		s.eventBus.Publish(event)
+	}
+}
+
+// publishRedirect publishes a redirect of the query to url
+func (s *Server) publishRedirect(query, name, url string) {
+	s.publish(Event{Type: EventRedirect, Time: time.Now(), Name: name, URL: url, Query: query})
+}
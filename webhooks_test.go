@@ -0,0 +1,157 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseWebhooks(t *testing.T) {
+	assert := assert.New(t)
+
+	urls, err := ParseWebhooks(" https://a.example.com/hook, ,http://b.example.com ")
+	assert.NoError(err)
+	assert.Equal([]string{"https://a.example.com/hook", "http://b.example.com"}, urls)
+
+	urls, err = ParseWebhooks("")
+	assert.NoError(err)
+	assert.Empty(urls)
+
+	_, err = ParseWebhooks("a.example.com")
+	assert.Error(err)
+}
+
+func TestEventsStore(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir("", "golinks")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	store, err := OpenStore(filepath.Join(dir, "test.db"))
+	assert.NoError(err)
+	defer store.Close()
+
+	var events []Event
+	s := NewEventsStore(store, func(event Event) { events = append(events, event) })
+
+	assert.NoError(s.Put([]byte("bookmark_gh"), []byte("https://github.com")))
+	assert.NoError(s.Put([]byte("bookmark_gh"), []byte("https://github.com")))
+	assert.NoError(s.Put([]byte("bookmark_gh"), []byte("https://github.com/%s")))
+	assert.NoError(s.Put([]byte("alias_github"), []byte("gh")))
+	assert.NoError(s.Delete([]byte("bookmark_gh")))
+	assert.NoError(s.Delete([]byte("bookmark_missing")))
+
+	assert.Len(events, 3)
+	assert.Equal(EventBookmarkCreated, events[0].Type)
+	assert.Equal("gh", events[0].Name)
+	assert.Equal("https://github.com", events[0].URL)
+	assert.Equal(EventBookmarkUpdated, events[1].Type)
+	assert.Equal("https://github.com/%s", events[1].URL)
+	assert.Equal("https://github.com", events[1].OldURL)
+	assert.Equal(EventBookmarkDeleted, events[2].Type)
+	assert.Equal("https://github.com/%s", events[2].OldURL)
+}
+
+func TestWebhooks(t *testing.T) {
+	assert := assert.New(t)
+
+	var (
+		mu       sync.Mutex
+		attempts int
+	)
+	received := make(chan Event, 1)
+	hook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		attempts++
+		n := attempts
+		mu.Unlock()
+
+		// The first attempt fails and is retried
+		if n == 1 {
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+
+		body, _ := ioutil.ReadAll(r.Body)
+		assert.Equal(SignWebhook("secret", body), r.Header.Get(SignatureHeader))
+		assert.Equal(EventBookmarkCreated, r.Header.Get(EventHeader))
+
+		var event Event
+		assert.NoError(json.Unmarshal(body, &event))
+		received <- event
+	}))
+	defer hook.Close()
+
+	counters := NewCounters()
+	webhooks := NewWebhooks([]string{hook.URL}, "secret", false, counters)
+	webhooks.retryDelay = time.Millisecond
+	webhooks.Start()
+	defer webhooks.Stop()
+
+	// Redirects are not sent unless hits are enabled
+	webhooks.Publish(Event{Type: EventRedirect, Name: "gh"})
+	webhooks.Publish(Event{Type: EventBookmarkCreated, Name: "gh", URL: "https://github.com"})
+
+	select {
+	case event := <-received:
+		assert.Equal("gh", event.Name)
+		assert.Equal("https://github.com", event.URL)
+	case <-time.After(5 * time.Second):
+		assert.Fail("webhook was not received")
+	}
+
+	mu.Lock()
+	assert.Equal(2, attempts)
+	mu.Unlock()
+}
+
+func TestWebhooksRedirects(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir("", "golinks")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	db, err = OpenStore(filepath.Join(dir, "test.db"))
+	assert.NoError(err)
+	defer db.Close()
+
+	assert.NoError(SaveBookmark("gh", "https://github.com/%s"))
+
+	received := make(chan Event, 1)
+	hook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var event Event
+		assert.NoError(json.NewDecoder(r.Body).Decode(&event))
+		received <- event
+	}))
+	defer hook.Close()
+
+	s, err := NewServer(":8000", Config{Webhooks: []string{hook.URL}, WebhookHits: true})
+	assert.NoError(err)
+	s.webhooks.Start()
+	defer s.webhooks.Stop()
+
+	w := httptest.NewRecorder()
+	r, _ := http.NewRequest("GET", "/?q=gh+golinks", nil)
+	s.router.ServeHTTP(w, r)
+	assert.Equal(http.StatusFound, w.Code)
+
+	select {
+	case event := <-received:
+		assert.Equal(EventRedirect, event.Type)
+		assert.Equal("gh", event.Name)
+		assert.Equal("gh golinks", event.Query)
+		assert.Equal("https://github.com/golinks", event.URL)
+	case <-time.After(5 * time.Second):
+		assert.Fail("webhook was not received")
+	}
+}
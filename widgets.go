@@ -0,0 +1,161 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+// Widgets are the embeddable widgets of the web UI. Each has a template
+// (e.g: widget_search.html) rendered within widget.html, a bare layout
+// without the navbar or any external stylesheets.
+var Widgets = []string{"widget_search", "widget_top"}
+
+const (
+	// DefaultWidgetLinks is how many links the top links widget shows
+	DefaultWidgetLinks = 10
+
+	// MaxWidgetLinks is the most links the top links widget shows
+	MaxWidgetLinks = 50
+)
+
+// WidgetLink is a link shown in the top links widget
+type WidgetLink struct {
+	Name        string
+	URL         string
+	Description string
+	Hits        int64
+}
+
+// TopLinks returns the most used bookmarks, most used first. Bookmarks that
+// were never used (or no longer exist) are left out.
+func TopLinks(limit int) ([]WidgetLink, error) {
+	hits, err := ListHits(HitBookmark)
+	if err != nil {
+		return nil, err
+	}
+	bookmarks, err := ListSiteBookmarks()
+	if err != nil {
+		return nil, err
+	}
+	byName := make(map[string]SiteBookmark)
+	for _, bookmark := range bookmarks {
+		byName[bookmark.Name] = bookmark
+	}
+
+	var links []WidgetLink
+	for _, stats := range hits {
+		if len(links) == limit {
+			break
+		}
+		bookmark, ok := byName[stats.Name]
+		if !ok || stats.Hits == 0 {
+			continue
+		}
+		links = append(links, WidgetLink{
+			Name:        bookmark.Name,
+			URL:         bookmark.URL,
+			Description: bookmark.Description,
+			Hits:        stats.Hits,
+		})
+	}
+	return links, nil
+}
+
+// parseFrameAncestors splits a comma or space separated list of the
+// origins allowed to embed widgets
+func parseFrameAncestors(s string) []string {
+	return strings.FieldsFunc(s, func(r rune) bool {
+		return r == ',' || r == ' ' || r == '\t'
+	})
+}
+
+// checkFrameAncestors validates the sources of -frame-ancestors, so they
+// can't break (or inject directives into) the Content-Security-Policy
+func checkFrameAncestors(config Config) error {
+	for _, source := range parseFrameAncestors(config.FrameAncestors) {
+		switch source {
+		case "'self'", "'none'", "*":
+			continue
+		}
+		if strings.ContainsAny(source, "';\"") {
+			return fmt.Errorf("invalid -frame-ancestors source %q (expected an origin, e.g: https://grafana.example.com)", source)
+		}
+	}
+	return nil
+}
+
+// frameAncestors returns the Content-Security-Policy of widgets: embeddable
+// by golinks itself and the origins of -frame-ancestors
+func (s *Server) frameAncestors() string {
+	sources := []string{"'self'"}
+	for _, source := range parseFrameAncestors(s.config.FrameAncestors) {
+		switch source {
+		case "'none'", "*":
+			return "frame-ancestors " + source
+		case "'self'":
+		default:
+			sources = append(sources, source)
+		}
+	}
+	return "frame-ancestors " + strings.Join(sources, " ")
+}
+
+// renderWidget renders a widget allowing it to be framed by the configured
+// frame ancestors
+func (s *Server) renderWidget(name string, w http.ResponseWriter, r *http.Request, ctx interface{}) {
+	w.Header().Set("Content-Security-Policy", s.frameAncestors())
+	s.render(name, w, r, ctx)
+}
+
+// WidgetSearchHandler serves a search box to embed in dashboards and
+// portals, e.g: /widgets/search?placeholder=Search+go+links. Searches open
+// in the embedding page rather than the frame.
+func (s *Server) WidgetSearchHandler() httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+		s.counters.Inc("n_widget_search")
+
+		placeholder := r.URL.Query().Get("placeholder")
+		if placeholder == "" {
+			placeholder = "Enter command, bookmark or search terms here..."
+		}
+		s.renderWidget("widget_search", w, r, map[string]interface{}{
+			"Placeholder": placeholder,
+		})
+	}
+}
+
+// WidgetTopHandler serves the most used links to embed in dashboards and
+// portals, e.g: /widgets/top?limit=5
+func (s *Server) WidgetTopHandler() httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+		s.counters.Inc("n_widget_top")
+
+		limit := DefaultWidgetLinks
+		if v := r.URL.Query().Get("limit"); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n <= 0 {
+				http.Error(w, "Bad Request: invalid limit", http.StatusBadRequest)
+				return
+			}
+			limit = n
+		}
+		if limit > MaxWidgetLinks {
+			limit = MaxWidgetLinks
+		}
+
+		links, err := TopLinks(limit)
+		if err != nil {
+			slog.Error("error reading top links", "err", err)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+		s.renderWidget("widget_top", w, r, map[string]interface{}{
+			"Links": links,
+		})
+	}
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTopLinks(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir("", "golinks")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	db, err = OpenStore(filepath.Join(dir, "test.db"))
+	assert.NoError(err)
+	defer db.Close()
+
+	assert.NoError(SaveBookmark("gh", "https://github.com/%s"))
+	assert.NoError(SaveBookmark("go", "https://golang.org"))
+	assert.NoError(SaveBookmark("wiki", "https://en.wikipedia.org/wiki/%s"))
+	assert.NoError(db.Put([]byte("description_go"), []byte("The Go website")))
+
+	hits := NewHits(true, 0, NewWritePolicy(0, 0, NewCounters()))
+	hits.Record(HitBookmark, "go", time.Millisecond)
+	hits.Record(HitBookmark, "go", time.Millisecond)
+	hits.Record(HitBookmark, "gh", time.Millisecond)
+	hits.Record(HitBookmark, "deleted", time.Millisecond)
+	hits.Record(HitCommand, "ping", time.Millisecond)
+
+	links, err := TopLinks(DefaultWidgetLinks)
+	assert.NoError(err)
+	assert.Equal([]WidgetLink{
+		{Name: "go", URL: "https://golang.org", Description: "The Go website", Hits: 2},
+		{Name: "gh", URL: "https://github.com/%s", Hits: 1},
+	}, links)
+
+	links, err = TopLinks(1)
+	assert.NoError(err)
+	assert.Len(links, 1)
+}
+
+func TestFrameAncestors(t *testing.T) {
+	assert := assert.New(t)
+
+	testCases := []struct {
+		ancestors string
+		policy    string
+	}{
+		{"", "frame-ancestors 'self'"},
+		{"https://grafana.example.com", "frame-ancestors 'self' https://grafana.example.com"},
+		{"https://a.example.com, 'self' https://b.example.com", "frame-ancestors 'self' https://a.example.com https://b.example.com"},
+		{"*", "frame-ancestors *"},
+		{"'none'", "frame-ancestors 'none'"},
+	}
+	for _, testCase := range testCases {
+		config := Config{FrameAncestors: testCase.ancestors}
+		assert.NoError(checkFrameAncestors(config))
+		s := &Server{config: config}
+		assert.Equal(testCase.policy, s.frameAncestors())
+	}
+
+	assert.Error(checkFrameAncestors(Config{FrameAncestors: "https://a.example.com; script-src *"}))
+	assert.Error(checkFrameAncestors(Config{FrameAncestors: "'unsafe-inline'"}))
+}
+
+func TestWidgets(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir("", "golinks")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	db, err = OpenStore(filepath.Join(dir, "test.db"))
+	assert.NoError(err)
+	defer db.Close()
+
+	_, err = NewServer(":8000", Config{FrameAncestors: "https://a.example.com;"})
+	assert.Error(err)
+
+	s, err := NewServer(":8000", Config{Title: "Search", FrameAncestors: "https://grafana.example.com"})
+	assert.NoError(err)
+
+	get := func(path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r, _ := http.NewRequest("GET", path, nil)
+		s.router.ServeHTTP(w, r)
+		return w
+	}
+
+	w := get("/widgets/search?placeholder=Search+go+links")
+	assert.Equal(http.StatusOK, w.Code)
+	assert.Equal("frame-ancestors 'self' https://grafana.example.com", w.Header().Get("Content-Security-Policy"))
+	assert.Contains(w.Body.String(), `<base target="_top">`)
+	assert.Contains(w.Body.String(), `placeholder="Search go links"`)
+	assert.NotContains(w.Body.String(), "navbar")
+
+	w = get("/widgets/top")
+	assert.Equal(http.StatusOK, w.Code)
+	assert.Contains(w.Body.String(), "No links used yet")
+
+	assert.NoError(SaveBookmark("gh", "https://github.com/%s"))
+	get("/?q=gh+golinks")
+
+	w = get("/widgets/top?limit=5")
+	assert.Equal(http.StatusOK, w.Code)
+	assert.Equal("frame-ancestors 'self' https://grafana.example.com", w.Header().Get("Content-Security-Policy"))
+	assert.Contains(w.Body.String(), `<a href="/?q=gh" title="https://github.com/%s">gh</a>`)
+
+	assert.Equal(http.StatusBadRequest, get("/widgets/top?limit=nope").Code)
+
+	// Only widgets can be framed by other origins
+	assert.Empty(get("/").Header().Get("Content-Security-Policy"))
+}
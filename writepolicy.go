@@ -0,0 +1,92 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultWriteFailureThreshold is the number of consecutive failed
+	// best-effort writes after which they are suspended
+	DefaultWriteFailureThreshold = 5
+
+	// DefaultWriteFailureBackoff is how long best-effort writes are
+	// suspended for after too many consecutive failures
+	DefaultWriteFailureBackoff = time.Minute
+)
+
+// WritePolicy governs best-effort writes made while serving a request (e.g:
+// history). Such writes are never allowed to fail the request: failures are
+// logged and counted instead. After threshold consecutive failures writes are
+// skipped for the backoff so a broken store isn't hit on every query.
+type WritePolicy struct {
+	sync.Mutex
+
+	threshold int
+	backoff   time.Duration
+	counters  *Counters
+
+	failures int
+	until    time.Time
+}
+
+// NewWritePolicy ...
+func NewWritePolicy(threshold int, backoff time.Duration, counters *Counters) *WritePolicy {
+	return &WritePolicy{
+		threshold: threshold,
+		backoff:   backoff,
+		counters:  counters,
+	}
+}
+
+// Suspended reports whether best-effort writes are currently skipped
+func (p *WritePolicy) Suspended() bool {
+	p.Lock()
+	defer p.Unlock()
+
+	return time.Now().Before(p.until)
+}
+
+// write calls f turning any panic into an error
+func write(f func() error) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+	return f()
+}
+
+// Do performs the best-effort write called name (used in counters and logs)
+// unless writes are suspended and reports whether it succeeded
+func (p *WritePolicy) Do(name string, f func() error) bool {
+	if p.Suspended() {
+		p.counters.Inc(fmt.Sprintf("n_%s_skipped", name))
+		return false
+	}
+
+	err := write(f)
+
+	p.Lock()
+	defer p.Unlock()
+
+	if err == nil {
+		p.failures = 0
+		p.counters.Inc(fmt.Sprintf("n_%s", name))
+		return true
+	}
+
+	p.counters.Inc(fmt.Sprintf("n_%s_failed", name))
+	slog.Error("error writing", "name", name, "err", err)
+
+	p.failures++
+	if p.threshold > 0 && p.failures >= p.threshold && p.backoff > 0 {
+		p.failures = 0
+		p.until = time.Now().Add(p.backoff)
+		p.counters.Inc("n_writes_suspended")
+		slog.Warn("suspending best-effort writes after consecutive failures", "backoff", p.backoff, "failures", p.threshold)
+	}
+	return false
+}
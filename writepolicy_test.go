@@ -0,0 +1,113 @@
+package main
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rcrowley/go-metrics"
+	"github.com/stretchr/testify/assert"
+)
+
+// failingStore fails all writes of keys with the given prefix
+type failingStore struct {
+	Store
+	prefix string
+	panics bool
+}
+
+func (s *failingStore) Put(key, value []byte) error {
+	if strings.HasPrefix(string(key), s.prefix) {
+		if s.panics {
+			panic("boom")
+		}
+		return errors.New("disk full")
+	}
+	return s.Store.Put(key, value)
+}
+
+func count(counters *Counters, name string) int64 {
+	counter, ok := counters.r.Get(name).(metrics.Counter)
+	if !ok {
+		return 0
+	}
+	return counter.Count()
+}
+
+func TestWritePolicy(t *testing.T) {
+	assert := assert.New(t)
+
+	counters := NewCounters()
+	p := NewWritePolicy(2, time.Hour, counters)
+
+	fail := func() error { return errors.New("disk full") }
+	succeed := func() error { return nil }
+
+	assert.True(p.Do("test", succeed))
+	assert.False(p.Do("test", fail))
+	assert.True(p.Do("test", succeed))
+	assert.False(p.Suspended(), "a success resets the consecutive failures")
+
+	assert.False(p.Do("test", fail))
+	assert.False(p.Do("test", func() error { panic("boom") }))
+	assert.True(p.Suspended())
+
+	called := false
+	assert.False(p.Do("test", func() error { called = true; return nil }))
+	assert.False(called)
+
+	assert.Equal(int64(2), count(counters, "n_test"))
+	assert.Equal(int64(3), count(counters, "n_test_failed"))
+	assert.Equal(int64(1), count(counters, "n_test_skipped"))
+	assert.Equal(int64(1), count(counters, "n_writes_suspended"))
+
+	// A threshold of 0 never suspends writes
+	p = NewWritePolicy(0, time.Hour, counters)
+	for i := 0; i < 10; i++ {
+		p.Do("test", fail)
+	}
+	assert.False(p.Suspended())
+}
+
+func TestRedirectWithFailingHistory(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir("", "golinks")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	db, err = OpenStore(filepath.Join(dir, "test.db"))
+	assert.NoError(err)
+	defer db.Close()
+
+	assert.NoError(SaveBookmark("gh", "https://github.com/%s"))
+
+	for _, panics := range []bool{false, true} {
+		db = &failingStore{Store: db, prefix: "history_", panics: panics}
+
+		s, err := NewServer(":8000", Config{
+			URL:                   DefaultURL,
+			WriteFailureThreshold: 2,
+			WriteFailureBackoff:   time.Hour,
+		})
+		assert.NoError(err)
+
+		for _, q := range []string{"gh golinks", "foo bar", "gh golinks"} {
+			w := httptest.NewRecorder()
+			r, _ := http.NewRequest("GET", "/?q="+strings.Replace(q, " ", "+", -1), nil)
+			s.router.ServeHTTP(w, r)
+			assert.Equal(http.StatusFound, w.Code, q)
+			assert.NotEmpty(w.Header().Get("Location"), q)
+		}
+
+		assert.Equal(int64(2), count(s.counters, "n_history_failed"))
+		assert.Equal(int64(1), count(s.counters, "n_history_skipped"))
+		assert.Equal(int64(0), count(s.counters, "n_history"))
+	}
+}
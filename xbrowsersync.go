@@ -0,0 +1,216 @@
+package main
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/pbkdf2"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// XBrowserSyncURL is the default xBrowserSync service
+	XBrowserSyncURL = "https://api.xbrowsersync.org"
+
+	// MaxXBrowserSyncBytes is the maximum size of an xBrowserSync response
+	MaxXBrowserSyncBytes = 16 << 20
+
+	// xbrowsersyncIterations are the PBKDF2 iterations xBrowserSync derives
+	// its encryption keys with
+	xbrowsersyncIterations = 250000
+
+	// xbrowsersyncRootPrefix prefixes the names of xBrowserSync's root
+	// folders (toolbar, menu, ...), which are not used as folders
+	xbrowsersyncRootPrefix = "[xbs] "
+)
+
+// ErrXBrowserSyncDecrypt is returned when the bookmarks of an xBrowserSync
+// sync can't be decrypted (usually a wrong password)
+var ErrXBrowserSyncDecrypt = errors.New("error: unable to decrypt xbrowsersync bookmarks (wrong password?)")
+
+// xbrowsersyncItem is a bookmark or folder (with children) of an
+// xBrowserSync sync
+type xbrowsersyncItem struct {
+	Title    string             `json:"title"`
+	URL      string             `json:"url"`
+	Children []xbrowsersyncItem `json:"children"`
+}
+
+// XBrowserSync pulls bookmarks from an xBrowserSync sync, identified by its
+// sync id and decrypted with its password. Syncs are encrypted with AES-GCM
+// using a key derived from the password (and the sync id as the salt) and
+// compressed with LZUTF8.
+type XBrowserSync struct {
+	baseURL  string
+	syncID   string
+	password string
+	client   *http.Client
+
+	keyOnce sync.Once
+	key     []byte
+	keyErr  error
+}
+
+// NewXBrowserSync ...
+func NewXBrowserSync(baseURL, syncID, password string) *XBrowserSync {
+	if baseURL == "" {
+		baseURL = XBrowserSyncURL
+	}
+	return &XBrowserSync{
+		baseURL:  strings.TrimRight(baseURL, "/"),
+		syncID:   syncID,
+		password: password,
+		client:   &http.Client{Timeout: 30 * time.Second, Transport: client.Transport},
+	}
+}
+
+// Name ...
+func (x *XBrowserSync) Name() string {
+	return "xbrowsersync"
+}
+
+func (x *XBrowserSync) decrypt(data string) ([]byte, error) {
+	x.keyOnce.Do(func() {
+		x.key, x.keyErr = pbkdf2.Key(sha256.New, x.password, []byte(x.syncID), xbrowsersyncIterations, 32)
+	})
+	if x.keyErr != nil {
+		return nil, x.keyErr
+	}
+
+	raw, err := base64.StdEncoding.DecodeString(data)
+	if err != nil {
+		return nil, fmt.Errorf("error decoding xbrowsersync bookmarks: %s", err)
+	}
+
+	block, err := aes.NewCipher(x.key)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCMWithNonceSize(block, 16)
+	if err != nil {
+		return nil, err
+	}
+	if len(raw) < gcm.NonceSize() {
+		return nil, ErrXBrowserSyncDecrypt
+	}
+
+	plain, err := gcm.Open(nil, raw[:gcm.NonceSize()], raw[gcm.NonceSize():], nil)
+	if err != nil {
+		return nil, ErrXBrowserSyncDecrypt
+	}
+	return plain, nil
+}
+
+// Fetch returns all bookmarks of the sync
+func (x *XBrowserSync) Fetch() ([]BrowserBookmark, error) {
+	res, err := x.client.Get(fmt.Sprintf("%s/bookmarks/%s", x.baseURL, url.PathEscape(x.syncID)))
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		io.Copy(ioutil.Discard, io.LimitReader(res.Body, MaxXBrowserSyncBytes))
+		return nil, fmt.Errorf("error fetching xbrowsersync bookmarks: %s", res.Status)
+	}
+
+	var body struct {
+		Bookmarks string `json:"bookmarks"`
+	}
+	if err := json.NewDecoder(io.LimitReader(res.Body, MaxXBrowserSyncBytes)).Decode(&body); err != nil {
+		return nil, fmt.Errorf("error decoding xbrowsersync response: %s", err)
+	}
+	if body.Bookmarks == "" {
+		return nil, nil
+	}
+
+	compressed, err := x.decrypt(body.Bookmarks)
+	if err != nil {
+		return nil, err
+	}
+
+	var items []xbrowsersyncItem
+	if err := json.Unmarshal(DecompressLZUTF8(compressed), &items); err != nil {
+		return nil, fmt.Errorf("error decoding xbrowsersync bookmarks: %s", err)
+	}
+
+	var (
+		bookmarks []BrowserBookmark
+		walk      func(items []xbrowsersyncItem, folders []string)
+	)
+	walk = func(items []xbrowsersyncItem, folders []string) {
+		for _, item := range items {
+			if item.URL == "" {
+				if strings.HasPrefix(item.Title, xbrowsersyncRootPrefix) {
+					walk(item.Children, folders)
+				} else {
+					walk(item.Children, append(folders, item.Title))
+				}
+				continue
+			}
+			bookmarks = append(bookmarks, BrowserBookmark{
+				Title:  item.Title,
+				URL:    item.URL,
+				Folder: append([]string(nil), folders...),
+			})
+		}
+	}
+	walk(items, nil)
+
+	return bookmarks, nil
+}
+
+// DecompressLZUTF8 decompresses data compressed with LZUTF8, the
+// compression used by xBrowserSync. Bytes other than the start of a
+// sequence are literals; a sequence (110lllll dddddddd or 111lllll
+// dddddddd dddddddd) copies l bytes from d bytes back in the output.
+func DecompressLZUTF8(data []byte) []byte {
+	out := make([]byte, 0, len(data)*2)
+
+	for i := 0; i < len(data); i++ {
+		b := data[i]
+		if b>>6 != 3 {
+			out = append(out, b)
+			continue
+		}
+
+		// A lead byte of a multi-byte UTF-8 codepoint rather than a sequence
+		if i == len(data)-1 || data[i+1]>>7 == 1 {
+			out = append(out, b)
+			continue
+		}
+
+		length := int(b & 31)
+		distance := int(data[i+1])
+		if b>>5 == 7 {
+			if i+2 >= len(data) {
+				out = append(out, b)
+				continue
+			}
+			distance = distance<<8 | int(data[i+2])
+			i += 2
+		} else {
+			i++
+		}
+
+		start := len(out) - distance
+		if distance == 0 || start < 0 {
+			continue
+		}
+		for j := 0; j < length; j++ {
+			out = append(out, out[start+j])
+		}
+	}
+
+	return out
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/pbkdf2"
+	"crypto/sha256"
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDecompressLZUTF8(t *testing.T) {
+	assert := assert.New(t)
+
+	// Plain ASCII is left alone
+	assert.Equal(`[{"title":"Go"}]`, string(DecompressLZUTF8([]byte(`[{"title":"Go"}]`))))
+
+	// abc + (6 bytes from 3 back)
+	assert.Equal("abcabcabc", string(DecompressLZUTF8([]byte{'a', 'b', 'c', 0xc6, 3})))
+
+	// Long distances use two bytes
+	data := append([]byte("abcd"), make([]byte, 300)...)
+	data = append(data, 0xe4, 0x01, 0x30)
+	assert.Equal("abcd", string(DecompressLZUTF8(data)[304:]))
+
+	// Multi-byte UTF-8 codepoints are literals
+	assert.Equal("☕ é", string(DecompressLZUTF8([]byte("☕ é"))))
+}
+
+// encryptXBrowserSync encrypts bookmarks the way xBrowserSync does (without
+// compressing them, which LZUTF8 decompresses as is)
+func encryptXBrowserSync(t *testing.T, syncID, password, bookmarks string) string {
+	key, err := pbkdf2.Key(sha256.New, password, []byte(syncID), xbrowsersyncIterations, 32)
+	assert.NoError(t, err)
+	block, err := aes.NewCipher(key)
+	assert.NoError(t, err)
+	gcm, err := cipher.NewGCMWithNonceSize(block, 16)
+	assert.NoError(t, err)
+
+	iv := []byte("0123456789abcdef")
+	return base64.StdEncoding.EncodeToString(gcm.Seal(iv, iv, []byte(bookmarks), nil))
+}
+
+func TestXBrowserSync(t *testing.T) {
+	assert := assert.New(t)
+
+	encrypted := encryptXBrowserSync(t, "sync1", "secret", `[
+		{"title": "[xbs] Toolbar", "children": [
+			{"title": "Go Documentation", "url": "https://golang.org/doc/"},
+			{"title": "Work", "children": [
+				{"title": "JIRA", "url": "https://jira.example.com/"}
+			]}
+		]},
+		{"title": "[xbs] Other", "children": []}
+	]`)
+
+	xbs := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/bookmarks/sync1" {
+			http.NotFound(w, r)
+			return
+		}
+		WriteJSON(w, http.StatusOK, map[string]string{
+			"bookmarks": encrypted, "version": "1.5.2",
+		})
+	}))
+	defer xbs.Close()
+
+	bookmarks, err := NewXBrowserSync(xbs.URL, "sync1", "secret").Fetch()
+	assert.NoError(err)
+	assert.Equal([]BrowserBookmark{
+		{Title: "Go Documentation", URL: "https://golang.org/doc/"},
+		{Title: "JIRA", URL: "https://jira.example.com/", Folder: []string{"Work"}},
+	}, bookmarks)
+
+	_, err = NewXBrowserSync(xbs.URL, "sync1", "wrong").Fetch()
+	assert.Equal(ErrXBrowserSyncDecrypt, err)
+
+	_, err = NewXBrowserSync(xbs.URL, "sync2", "secret").Fetch()
+	assert.Error(err)
+}